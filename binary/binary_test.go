@@ -0,0 +1,135 @@
+package binary
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestEncodingRoundtrip(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	varints := []int64{0, -1, 1, -64, 64, math.MinInt64, math.MaxInt64}
+	floats := []float64{0, -1.5, math.Pi, math.Inf(1)}
+
+	for _, i := range varints {
+		WriteVarint(buf, i)
+	}
+
+	for _, f := range floats {
+		WriteFloat64(buf, f)
+	}
+
+	WriteBool(buf, true)
+	WriteBool(buf, false)
+	WriteUvarint64(buf, math.MaxInt64)
+
+	for _, i := range varints {
+		if found := ReadVarint(buf); found != i {
+			t.Errorf("Wrong varint: want: %d got: %d", i, found)
+		}
+	}
+
+	for _, f := range floats {
+		if found := ReadFloat64(buf); found != f {
+			t.Errorf("Wrong float: want: %v got: %v", f, found)
+		}
+	}
+
+	if !ReadBool(buf) || ReadBool(buf) {
+		t.Errorf("Wrong bools")
+	}
+
+	if found := ReadUvarint(buf); found != math.MaxInt64 {
+		t.Errorf("Wrong uvarint: want: %d got: %d", int64(math.MaxInt64), found)
+	}
+}
+
+func TestCheckedEncodingRoundtrip(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	varints := []int64{0, -1, 1, -64, 64, math.MinInt64, math.MaxInt64}
+	floats := []float64{0, -1.5, math.Pi, math.Inf(-1)}
+
+	for _, i := range varints {
+		WriteVarint(buf, i)
+	}
+
+	for _, f := range floats {
+		WriteFloat64(buf, f)
+	}
+
+	WriteBool(buf, true)
+	WriteBool(buf, false)
+
+	for _, i := range varints {
+		if found, err := ReadVarintFull(buf); found != i || err != nil {
+			t.Errorf("Wrong varint: want: %d got: %d %v", i, found, err)
+		}
+	}
+
+	for _, f := range floats {
+		if found, err := ReadFloat64Full(buf); found != f || err != nil {
+			t.Errorf("Wrong float: want: %v got: %v %v", f, found, err)
+		}
+	}
+
+	if found, err := ReadBoolFull(buf); !found || err != nil {
+		t.Errorf("Wrong bool: want: true got: %v %v", found, err)
+	}
+
+	if found, err := ReadBoolFull(buf); found || err != nil {
+		t.Errorf("Wrong bool: want: false got: %v %v", found, err)
+	}
+}
+
+func TestSmallVarints(t *testing.T) {
+	buf := new(bytes.Buffer)
+	WriteVarint(buf, -1)
+
+	if buf.Len() != 1 {
+		t.Errorf("Wrong varint length: want: 1 got: %d", buf.Len())
+	}
+}
+
+func TestCheckedReads(t *testing.T) {
+	buf := new(bytes.Buffer)
+	WriteUvarint(buf, 5)
+	buf.WriteString("abc")
+
+	if _, err := ReadStringMax(bytes.NewBuffer(buf.Bytes()), 3); err != TOO_LONG {
+		t.Errorf("Wrong error: want: %v got: %v", TOO_LONG, err)
+	}
+
+	if _, err := ReadStringMax(bytes.NewBuffer(buf.Bytes()), 10); err != TRUNCATED {
+		t.Errorf("Wrong error: want: %v got: %v", TRUNCATED, err)
+	}
+
+	if _, err := ReadUvarintMax(bytes.NewBuffer([]byte{0x80}), 10); err != TRUNCATED {
+		t.Errorf("Wrong error: want: %v got: %v", TRUNCATED, err)
+	}
+
+	if _, err := ReadInt64Full(bytes.NewBuffer([]byte{1, 2, 3})); err != TRUNCATED {
+		t.Errorf("Wrong error: want: %v got: %v", TRUNCATED, err)
+	}
+
+	if _, err := ReadBoolFull(bytes.NewBuffer([]byte{})); err != TRUNCATED {
+		t.Errorf("Wrong error: want: %v got: %v", TRUNCATED, err)
+	}
+
+	if _, err := ReadFloat64Full(bytes.NewBuffer([]byte{1, 2, 3})); err != TRUNCATED {
+		t.Errorf("Wrong error: want: %v got: %v", TRUNCATED, err)
+	}
+
+	if _, err := ReadVarintFull(bytes.NewBuffer([]byte{0x80})); err != TRUNCATED {
+		t.Errorf("Wrong error: want: %v got: %v", TRUNCATED, err)
+	}
+
+	buf.Reset()
+	WriteUvarint(buf, 3)
+	buf.WriteString("abc")
+
+	if s, err := ReadStringMax(buf, 10); s != "abc" || err != nil {
+		t.Errorf("Wrong string: want: abc,<nil> got: %q,%v", s, err)
+	}
+}
@@ -3,16 +3,46 @@ package binary
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
+	"math"
 )
 
+// Lengths are often read from the input itself, so reads larger than
+// this are buffered as the data arrives rather than allocated up front.
+// Then a corrupt length can't allocate more than there is data to read.
+const MAX_PREALLOCATE = 1 << 16
+
+var TRUNCATED = errors.New("binary: data ends before the value read")
+var TOO_LONG = errors.New("binary: length exceeds the maximum")
+
 func ReadBytes(r io.Reader, num int64) []byte {
+	if num <= 0 {
+		return []byte{}
+	}
+
+	if num > MAX_PREALLOCATE {
+		buf := &bytes.Buffer{}
+		io.CopyN(buf, r, num)
+		return buf.Bytes()
+	}
+
 	bytes := make([]byte, num)
 	n, _ := r.Read(bytes)
 	return bytes[:n]
 }
 
 func ReadBytesAt(r io.ReaderAt, num int64, offset int64) []byte {
+	if num <= 0 {
+		return []byte{}
+	}
+
+	if num > MAX_PREALLOCATE {
+		buf := &bytes.Buffer{}
+		io.CopyN(buf, io.NewSectionReader(r, offset, num), num)
+		return buf.Bytes()
+	}
+
 	bytes := make([]byte, num)
 	n, _ := r.ReadAt(bytes, offset)
 	return bytes[:n]
@@ -51,10 +81,117 @@ func ReadInt64(r io.Reader) int64 {
 }
 
 func ReadInt64At(r io.ReaderAt, offset int64) int64 {
-	b := ReadBytesAt(r, 4, offset)
+	b := ReadBytesAt(r, 8, offset)
 	buf := bytes.NewBuffer(b)
 
 	var i int64
 	binary.Read(buf, binary.LittleEndian, &i)
 	return i
 }
+
+func ReadVarint(r io.ByteReader) int64 {
+	i, _ := binary.ReadVarint(r)
+	return i
+}
+
+func ReadFloat64(r io.Reader) float64 {
+	var i uint64
+	binary.Read(r, binary.LittleEndian, &i)
+	return math.Float64frombits(i)
+}
+
+func ReadBool(r io.ByteReader) bool {
+	b, _ := r.ReadByte()
+	return b == 1
+}
+
+// The readers below return an error rather than a zero value when
+// the data is truncated or corrupt, and lengths read from the data
+// are checked against a maximum, typically the bytes remaining.
+
+func ReadUvarintMax(r io.ByteReader, max int64) (int64, error) {
+	i, err := binary.ReadUvarint(r)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, TRUNCATED
+	} else if err != nil {
+		return 0, err
+	}
+
+	if max < 0 || i > uint64(max) {
+		return 0, TOO_LONG
+	}
+
+	return int64(i), nil
+}
+
+func ReadVarintFull(r io.ByteReader) (int64, error) {
+	i, err := binary.ReadVarint(r)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, TRUNCATED
+	}
+
+	return i, err
+}
+
+func ReadBytesMax(r io.Reader, num, max int64) ([]byte, error) {
+	if num < 0 || num > max {
+		return nil, TOO_LONG
+	}
+
+	b := ReadBytes(r, num)
+	if int64(len(b)) < num {
+		return nil, TRUNCATED
+	}
+
+	return b, nil
+}
+
+// Reads a string prefixed with its uvarint length.
+func ReadStringMax(r interface {
+	io.Reader
+	io.ByteReader
+}, max int64) (string, error) {
+	length, err := ReadUvarintMax(r, max)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := ReadBytesMax(r, length, max)
+	return string(b), err
+}
+
+func ReadInt32Full(r io.Reader) (int64, error) {
+	var i uint32
+	err := readFull(r, &i)
+	return int64(i), err
+}
+
+func ReadInt64Full(r io.Reader) (int64, error) {
+	var i int64
+	err := readFull(r, &i)
+	return i, err
+}
+
+func ReadFloat64Full(r io.Reader) (float64, error) {
+	var i uint64
+	err := readFull(r, &i)
+	return math.Float64frombits(i), err
+}
+
+func ReadBoolFull(r io.ByteReader) (bool, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return false, TRUNCATED
+	}
+
+	return b == 1, nil
+}
+
+func readFull(r io.Reader, i interface{}) error {
+	err := binary.Read(r, binary.LittleEndian, i)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return TRUNCATED
+	}
+
+	return err
+}
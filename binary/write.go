@@ -4,20 +4,41 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"math"
 )
 
 func WriteUvarint(w io.Writer, num int) {
-	b := make([]byte, 8)
+	b := make([]byte, binary.MaxVarintLen64)
 	n := binary.PutUvarint(b, uint64(num))
 	w.Write(b[:n])
 }
 
 func WriteUvarint64(w io.Writer, num int64) {
-	b := make([]byte, 8)
+	b := make([]byte, binary.MaxVarintLen64)
 	n := binary.PutUvarint(b, uint64(num))
 	w.Write(b[:n])
 }
 
+// Signed numbers are zigzag encoded, so small
+// negative numbers are as short as positive ones.
+func WriteVarint(w io.Writer, num int64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutVarint(b, num)
+	w.Write(b[:n])
+}
+
+func WriteFloat64(w io.Writer, num float64) {
+	binary.Write(w, binary.LittleEndian, math.Float64bits(num))
+}
+
+func WriteBool(w io.Writer, b bool) {
+	if b {
+		w.Write([]byte{1})
+	} else {
+		w.Write([]byte{0})
+	}
+}
+
 func WriteInt16(w io.Writer, num int) {
 	binary.Write(w, binary.LittleEndian, uint16(num))
 }
@@ -14,4 +14,8 @@ package blocks
 const (
 	NO_COMPRESSION     = iota
 	SNAPPY_COMPRESSION = iota
+	ZSTD_COMPRESSION   = iota
 )
+
+// Set in a block's encoding when its data is followed by a checksum.
+const CHECKSUMMED = 0x80
@@ -0,0 +1,37 @@
+package blocks
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var BadChecksum = errors.New("block checksum doesn't match its data.")
+
+// Bytes of the CRC32 checksum following a block's data.
+const CHECKSUM_LENGTH = 4
+
+// Returns a copy of the block's data followed by its checksum.
+func checksummed(data []byte) []byte {
+	body := make([]byte, len(data)+CHECKSUM_LENGTH)
+	copy(body, data)
+
+	binary.LittleEndian.PutUint32(body[len(data):], crc32.ChecksumIEEE(data))
+
+	return body
+}
+
+// Returns the block's data, without its checksum, if they match.
+func verified(body []byte) ([]byte, error) {
+	if len(body) < CHECKSUM_LENGTH {
+		return nil, BadChecksum
+	}
+
+	data, sum := body[:len(body)-CHECKSUM_LENGTH], body[len(body)-CHECKSUM_LENGTH:]
+
+	if binary.LittleEndian.Uint32(sum) != crc32.ChecksumIEEE(data) {
+		return nil, BadChecksum
+	}
+
+	return data, nil
+}
@@ -0,0 +1,49 @@
+package blocks
+
+import (
+	"errors"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var UnknownEncoding = errors.New("block encoded with an unknown compression.")
+
+// Both are safe to use concurrently, so are shared by every writer
+// and reader.
+var zstdEncoder, _ = zstd.NewWriter(nil)
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+// Whether blocks with the encoding can be decompressed.
+func known(encoding int) bool {
+	switch encoding {
+	case NO_COMPRESSION, SNAPPY_COMPRESSION, ZSTD_COMPRESSION:
+		return true
+	}
+
+	return false
+}
+
+func compress(encoding int, block []byte) []byte {
+	switch encoding {
+	case SNAPPY_COMPRESSION:
+		return snappy.Encode(nil, block)
+	case ZSTD_COMPRESSION:
+		return zstdEncoder.EncodeAll(block, nil)
+	}
+
+	return block
+}
+
+func decompress(encoding int, body []byte) ([]byte, error) {
+	switch encoding {
+	case NO_COMPRESSION:
+		return body, nil
+	case SNAPPY_COMPRESSION:
+		return snappy.Decode(nil, body)
+	case ZSTD_COMPRESSION:
+		return zstdDecoder.DecodeAll(body, nil)
+	}
+
+	return nil, UnknownEncoding
+}
@@ -4,8 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-
-	"github.com/golang/snappy"
 )
 
 type read struct {
@@ -117,13 +115,23 @@ func (r *FastReader) fetchBlock() (err error) {
 		return fmt.Errorf("Error reading block. %d %d %d %v", length, encoding, n, err)
 	}
 
-	if encoding == SNAPPY_COMPRESSION {
-		body, _ := snappy.Decode(nil, body[:n])
-		r.buffer.Write(body)
-	} else {
-		r.buffer.Write(body[:n])
+	body = body[:n]
+
+	if encoding&CHECKSUMMED != 0 {
+		if body, err = verified(body); err != nil {
+			return
+		}
+
+		encoding &^= CHECKSUMMED
+	}
+
+	if !known(encoding) {
+		return UnknownEncoding
 	}
 
+	body, _ = decompress(encoding, body)
+	r.buffer.Write(body)
+
 	return
 }
 
@@ -10,7 +10,11 @@ import (
 	"github.com/golang/snappy"
 )
 
-var BadSeek = errors.New("block reader can only seek relative to beginning of file.")
+var BadSeek = errors.New("block reader seek with invalid whence.")
+var BadHeader = errors.New("block header length exceeds the maximum block size.")
+
+// Most decompressed blocks kept by a concurrent reader.
+const CACHED_BLOCKS = 16
 
 // Reader has the ability to uncompress and read any potentially compressed
 // data written via blocks.Writer.
@@ -19,6 +23,30 @@ type Reader struct {
 	scratch   *bytes.Buffer
 	reader    io.ReadSeeker
 	blockSize int
+	// Position in the underlying reader, after the scratch space.
+	offset int64
+	// Blocks with data left in the buffer, oldest first.
+	fetched []fetchedBlock
+	workers int
+	// Blocks read ahead which are being decompressed, oldest first.
+	pending []pendingBlock
+	readErr error
+	// Recently decompressed blocks by offset, and their offsets, oldest first.
+	cache  map[int64][]byte
+	cached []int64
+}
+
+type fetchedBlock struct {
+	offset int64
+	length int
+}
+
+type pendingBlock struct {
+	offset int64
+	data   chan []byte
+	err    error
+	// Whether the block was decompressed, so is worth caching.
+	decoded bool
 }
 
 // Transforms a bytestring into a block reader. blockSize must be the same size
@@ -33,7 +61,18 @@ func NewByteReader(b []byte, blockSize int) *Reader {
 // you're attempting to read.  the same size used to write the blocks you're
 // attempting to read.  Otherwise you'll definitely get incorrect results.
 func NewReader(r io.ReadSeeker, blockSize int) *Reader {
-	return &Reader{new(bytes.Buffer), new(bytes.Buffer), r, blockSize}
+	return &Reader{buffer: new(bytes.Buffer), scratch: new(bytes.Buffer), reader: r, blockSize: blockSize}
+}
+
+// Decompresses up to the given number of upcoming blocks at once, while
+// earlier blocks are being read, and keeps the most recently decompressed
+// blocks so seeking back to them doesn't decompress them again.
+func (r *Reader) SetConcurrency(workers int) {
+	r.workers = workers
+
+	if workers > 0 && r.cache == nil {
+		r.cache = make(map[int64][]byte)
+	}
 }
 
 // Implements io.Reader interface.
@@ -88,6 +127,80 @@ func (r *Reader) ensure(length int) (err error) {
 // Fetches the next block from the underlying reader,
 // optionally decompresses it, and adds it to the buffer.
 func (r *Reader) fetchBlock() (err error) {
+	if len(r.pending) == 0 {
+		if r.readErr != nil {
+			return r.readErr
+		}
+
+		r.pending = append(r.pending, r.readBlock())
+	}
+
+	// Keep the workers busy with the blocks after this one.
+	for len(r.pending) <= r.workers && r.readErr == nil {
+		r.pending = append(r.pending, r.readBlock())
+	}
+
+	block := r.pending[0]
+	r.pending = r.pending[1:]
+
+	if block.err != nil {
+		return block.err
+	}
+
+	body := <-block.data
+
+	if block.decoded {
+		r.store(block.offset, body)
+	}
+
+	if len(body) == 0 {
+		return
+	}
+
+	r.prune()
+	r.fetched = append(r.fetched, fetchedBlock{block.offset, len(body)})
+	r.buffer.Write(body)
+
+	return
+}
+
+// Reads the next block from the underlying reader, decompressing
+// it on another goroutine when reading concurrently.
+func (r *Reader) readBlock() pendingBlock {
+	block := pendingBlock{offset: r.offset - int64(r.scratch.Len()), data: make(chan []byte, 1)}
+
+	encoding, body, err := r.readRaw()
+	if err != nil {
+		block.err, r.readErr = err, err
+		return block
+	}
+
+	if !known(encoding) {
+		block.err, r.readErr = UnknownEncoding, UnknownEncoding
+		return block
+	}
+
+	if cached, ok := r.cache[block.offset]; ok {
+		block.data <- cached
+	} else if encoding == NO_COMPRESSION {
+		block.data <- body
+	} else if r.workers > 0 {
+		block.decoded = true
+
+		go func() {
+			decoded, _ := decompress(encoding, body)
+			block.data <- decoded
+		}()
+	} else {
+		decoded, _ := decompress(encoding, body)
+		block.data <- decoded
+	}
+
+	return block
+}
+
+// Reads the next block's encoding and undecoded body.
+func (r *Reader) readRaw() (encoding int, body []byte, err error) {
 	err = r.ensureScratch(uint(headerLen(r.blockSize)))
 	if err != nil {
 		return
@@ -96,13 +209,18 @@ func (r *Reader) fetchBlock() (err error) {
 	head := make([]byte, headerLen(r.blockSize))
 	n, err := r.scratch.Read(head)
 	if n == 0 || err != nil {
-		return fmt.Errorf("Error reading block header. %d %v", n, err)
+		return 0, nil, fmt.Errorf("Error reading block header. %d %v", n, err)
 	}
 
 	length, encoding := parseHeader(r.blockSize, head)
 
 	if length == 0 {
-		return
+		return NO_COMPRESSION, nil, nil
+	}
+
+	// Compressed blocks can be slightly larger than the block size.
+	if length > uint(snappy.MaxEncodedLen(r.blockSize)+CHECKSUM_LENGTH) {
+		return 0, nil, BadHeader
 	}
 
 	err = r.ensureScratch(length)
@@ -110,21 +228,75 @@ func (r *Reader) fetchBlock() (err error) {
 		return
 	}
 
-	body := make([]byte, length)
+	body = make([]byte, length)
 	n, err = r.scratch.Read(body)
 
 	if n == 0 || err != nil {
-		return fmt.Errorf("Error reading block. %d %d %d %v", length, encoding, n, err)
+		return 0, nil, fmt.Errorf("Error reading block. %d %d %d %v", length, encoding, n, err)
 	}
 
-	if encoding == SNAPPY_COMPRESSION {
-		body, _ := snappy.Decode(nil, body[:n])
-		r.buffer.Write(body)
-	} else {
-		r.buffer.Write(body[:n])
+	body = body[:n]
+
+	if encoding&CHECKSUMMED != 0 {
+		if body, err = verified(body); err != nil {
+			return 0, nil, err
+		}
+
+		encoding &^= CHECKSUMMED
 	}
 
-	return
+	return encoding, body, nil
+}
+
+// Keeps the decompressed block, forgetting the oldest kept
+// once more than CACHED_BLOCKS are.
+func (r *Reader) store(offset int64, body []byte) {
+	if r.cache == nil {
+		return
+	}
+
+	if _, ok := r.cache[offset]; !ok {
+		r.cached = append(r.cached, offset)
+	}
+
+	r.cache[offset] = body
+
+	if len(r.cached) > CACHED_BLOCKS {
+		delete(r.cache, r.cached[0])
+		r.cached = r.cached[1:]
+	}
+}
+
+// Forgets blocks which have been completely read.
+func (r *Reader) prune() {
+	buffered := r.buffer.Len()
+
+	// Only the oldest block can have been partially read.
+	for i := len(r.fetched) - 1; i >= 0 && buffered > 0; i-- {
+		buffered -= r.fetched[i].length
+
+		if buffered <= 0 {
+			r.fetched = r.fetched[i:]
+			return
+		}
+	}
+
+	r.fetched = r.fetched[:0]
+}
+
+// The offset of the block holding the next byte to be read.
+func (r *Reader) current() int64 {
+	r.prune()
+
+	if len(r.fetched) > 0 {
+		return r.fetched[0].offset
+	}
+
+	if len(r.pending) > 0 {
+		return r.pending[0].offset
+	}
+
+	return r.offset - int64(r.scratch.Len())
 }
 
 // Ensure the raw scratch space contains at least `length` bytes.
@@ -135,22 +307,42 @@ func (r *Reader) ensureScratch(length uint) (err error) {
 		block := make([]byte, headerLen(r.blockSize)+r.blockSize)
 		n, err = r.reader.Read(block)
 		r.scratch.Write(block[:n])
+		r.offset += int64(n)
 	}
 
 	return
 }
 
-// Implements io.Seeker interface. One limitiation we have is
-// the only valid value of whence is 0, overwise our version of
-// Seek will return an error.
+// Implements io.Seeker interface. Offsets are of blocks within the
+// underlying reader, rather than of the uncompressed data. Seeking
+// relative to the current position is relative to the start of the
+// block holding the next byte to be read, so Seek(0, io.SeekCurrent)
+// returns that block's offset, without moving.
 func (r *Reader) Seek(offset int64, whence int) (int64, error) {
-	if whence != 0 {
+	switch whence {
+	case io.SeekStart, io.SeekEnd:
+	case io.SeekCurrent:
+		if offset == 0 {
+			return r.current(), nil
+		}
+
+		offset, whence = r.current()+offset, io.SeekStart
+	default:
 		return 0, BadSeek
 	}
 
 	r.buffer = new(bytes.Buffer)
 	r.scratch = new(bytes.Buffer)
-	return r.reader.Seek(offset, 0)
+	r.fetched = nil
+	r.pending = nil
+	r.readErr = nil
+
+	n, err := r.reader.Seek(offset, whence)
+	if err == nil {
+		r.offset = n
+	}
+
+	return n, err
 }
 
 // Parses out the header information from a fixed set of bytes.
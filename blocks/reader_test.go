@@ -132,11 +132,139 @@ func TestSeek(t *testing.T) {
 		t.Errorf("Wrong return:\n want: 5,<nil>\n  got: %d,%v", n, err)
 	}
 
-	if n, err := r.Seek(5, 1); n != 0 || err == nil {
-		t.Errorf("Wrong return:\n want: 0,block reader can only seek relative to beginning of file.\n  got: %d,%v", n, err)
+	if n, err := r.Seek(5, 3); n != 0 || err != BadSeek {
+		t.Errorf("Wrong return:\n want: 0,%v\n  got: %d,%v", BadSeek, n, err)
 	}
+}
+
+func TestSeekRelative(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	w := NewWriter(buffer, 5)
+
+	w.Write([]byte("abcdefghijklmnopqrstuvwxyz"))
+	w.Flush()
+
+	r := NewReader(bytes.NewReader(buffer.Bytes()), 5)
+
+	var tests = []struct {
+		offset   int64
+		whence   int
+		position int64
+		result   string
+	}{
+		{-4, io.SeekEnd, 40, "z"},
+		{16, io.SeekStart, 16, "kl"},
+		{0, io.SeekCurrent, 16, "mno"},
+		{0, io.SeekCurrent, 24, ""},
+		{-8, io.SeekCurrent, 16, "klmnopq"},
+		{0, io.SeekCurrent, 24, ""},
+		{8, io.SeekCurrent, 32, "uvwxy"},
+		{-12, io.SeekEnd, 32, "uvwxyz"},
+	}
+
+	for i, test := range tests {
+		n, err := r.Seek(test.offset, test.whence)
+		if n != test.position || err != nil {
+			t.Errorf("Wrong position for Case %d: want: %d got: %d,%v", i, test.position, n, err)
+		}
+
+		bytes := make([]byte, len(test.result))
+		r.Read(bytes)
+
+		if !reflect.DeepEqual(bytes, []byte(test.result)) {
+			t.Errorf("Wrong bytes for Case %d:\n want: %s\n  got: %s", i, test.result, bytes)
+		}
+	}
+}
+
+func TestReadCorruptedHeader(t *testing.T) {
+	// Header claims a 65535 byte block, with a block size of 5.
+	reader := NewReader(bytes.NewReader([]byte("\xff\xff\x00hello")), 5)
+
+	if _, err := reader.Read(make([]byte, 5)); err != BadHeader {
+		t.Errorf("Expected bad header error, found: %v", err)
+	}
+}
+
+func TestReadUnknownEncoding(t *testing.T) {
+	reader := NewReader(bytes.NewReader([]byte("\x05\x00\x09hello")), 5)
+
+	if _, err := reader.Read(make([]byte, 5)); err != UnknownEncoding {
+		t.Errorf("Expected unknown encoding error, found: %v", err)
+	}
+}
+
+func TestReadChecksums(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	w := NewWriter(buffer, 32)
+	w.SetChecksums(true)
+
+	input := bytes.Repeat([]byte("helloworld"), 10)
+
+	w.Write(input)
+	w.Flush()
+
+	readers := func(b []byte) []io.Reader {
+		return []io.Reader{NewByteReader(b, 32), NewFastReader(bytes.NewReader(b), 32, 2)}
+	}
+
+	for i, r := range readers(buffer.Bytes()) {
+		found := make([]byte, len(input))
+
+		if _, err := io.ReadFull(r, found); err != nil || !reflect.DeepEqual(found, input) {
+			t.Errorf("Case %d: Wrong bytes read: %v", i, err)
+		}
+	}
+
+	corrupted := append([]byte{}, buffer.Bytes()...)
+	corrupted[w.Offset(1)+headerLen(32)] ^= 0x01
+
+	for i, r := range readers(corrupted) {
+		if _, err := io.ReadFull(r, make([]byte, len(input))); err != BadChecksum {
+			t.Errorf("Case %d: Expected bad checksum error, found: %v", i, err)
+		}
+	}
+}
 
-	if n, err := r.Seek(5, 2); n != 0 || err == nil {
-		t.Errorf("Wrong return:\n want: 0,block reader can only seek relative to beginning of file.\n  got: %d,%v", n, err)
+func TestConcurrentRead(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	w := NewWriter(buffer, 32)
+
+	// Repeated so blocks are compressed.
+	input := bytes.Repeat([]byte("helloworld"), 100)
+
+	w.Write(input)
+	w.Flush()
+
+	r := NewReader(bytes.NewReader(buffer.Bytes()), 32)
+	r.SetConcurrency(3)
+
+	var err error
+	result := make([]byte, 0)
+	chunk := make([]byte, 7)
+	n := 1
+
+	for n > 0 && err == nil {
+		n, err = r.Read(chunk)
+		result = append(result, chunk[:n]...)
+	}
+
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Wrong bytes:\n want: %s\n  got: %s", input, result)
+	}
+
+	if len(r.cache) == 0 || len(r.cache) > CACHED_BLOCKS {
+		t.Errorf("Wrong number of cached blocks: %d", len(r.cache))
+	}
+
+	for i, block := range []int{30, 0, 12, 30, 29} {
+		r.Seek(int64(w.Offset(block)), io.SeekStart)
+
+		found := make([]byte, 32)
+		r.Read(found)
+
+		if want := input[block*32 : block*32+32]; !reflect.DeepEqual(found, want) {
+			t.Errorf("Wrong bytes for Case %d:\n want: %s\n  got: %s", i, want, found)
+		}
 	}
 }
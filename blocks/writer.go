@@ -4,15 +4,13 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
-
-	"github.com/golang/snappy"
 )
 
 // Writer implements the io.Writer interface and is meant to be
 // used in place of a io.Writer or bufio.Writer when writing data.
 //
 // Data is written in blocks or chunks, and optionally
-// compressed with snappy compression.
+// compressed with snappy or zstd compression, see SetCompression.
 //
 // When data is written, if the buffered amount then exceeds the
 // configured blockSize, the block is encoded and compressed and
@@ -23,22 +21,63 @@ import (
 //
 //     [int16/int32/int64:blockLength][int8:encoding][bytes(blockLength):data]
 //
+// With checksums, data ends with the CRC32 of the rest of it, and the
+// encoding has CHECKSUMMED set.
+//
 // blockLength's type is the smallest fixed length integer size that
 // can contain the max configured blockSize.  For instance,
 // if blockSize is 4096 bytes, we'll used an uint16. If the blockSize
 // is 128 KB, we'll use a uint32, etc.
+//
+// Blocks can optionally be compressed concurrently, see SetConcurrency.
 type Writer struct {
 	buffer    *bytes.Buffer
 	writer    io.Writer
 	Written   int
 	Blocks    int
 	blockSize int
+	encoding  int
+	checksums bool
+	workers   int
+	cut       int
+	offsets   []int
+	pending   []chan encodedBlock
+}
+
+type encodedBlock struct {
+	encoding int
+	data     []byte
 }
 
 // Tranforms any io.Writer into a block writer using the
 // configured max blockSize.
 func NewWriter(w io.Writer, blockSize int) *Writer {
-	return &Writer{new(bytes.Buffer), w, 0, 0, blockSize}
+	return &Writer{buffer: new(bytes.Buffer), writer: w, blockSize: blockSize, encoding: SNAPPY_COMPRESSION}
+}
+
+// Compresses blocks with the given encoding, snappy by default. Any
+// block which compression wouldn't make smaller is written uncompressed.
+func (w *Writer) SetCompression(encoding int) error {
+	if !known(encoding) {
+		return UnknownEncoding
+	}
+
+	w.encoding = encoding
+	return nil
+}
+
+// Follows each block's data with a checksum, which readers verify,
+// so corrupted blocks are reported rather than read.
+func (w *Writer) SetChecksums(enabled bool) {
+	w.checksums = enabled
+}
+
+// Compresses up to the given number of completed blocks at once, while
+// the next block is being filled. Blocks are still written in order,
+// but only once compressed, so Written and Blocks lag behind until
+// the writer is flushed. Use Block and Offset to locate data instead.
+func (w *Writer) SetConcurrency(workers int) {
+	w.workers = workers
 }
 
 // Implements io.Writer interface.
@@ -59,6 +98,21 @@ func (w *Writer) Buffered() int {
 	return w.buffer.Len()
 }
 
+// The number of the block currently being filled, counting from 0.
+func (w *Writer) Block() int {
+	return w.cut
+}
+
+// The offset of the given block in the underlying io.Writer,
+// once it's been written.
+func (w *Writer) Offset(block int) int {
+	if block < len(w.offsets) {
+		return w.offsets[block]
+	}
+
+	return w.Written
+}
+
 // Encodes any remaining buffered data and writes it to
 // the underlying io.Writer. Note: you must cause this
 // method after finshing writing data, as it's very likely,
@@ -74,39 +128,110 @@ func (w *Writer) flush(size int) (n int, err error) {
 	// the data and write it out to the underlying io.Writer.
 	for w.buffer.Len() > size {
 		block := w.buffer.Next(w.blockSize)
-		var encoding = NO_COMPRESSION
+		w.cut += 1
 
-		// Data is only encoded if we successfully encode the block.
-		// Otherwise the block is identified as uncompressed.
-		if encoded := snappy.Encode(nil, block); len(encoded) <= len(block) {
-			encoding = SNAPPY_COMPRESSION
-			block = encoded
+		if w.workers <= 1 {
+			i, err = w.writeBlock(encode(w.encoding, block))
+			n += i
+
+			if err != nil {
+				return
+			}
+
+			continue
 		}
 
-		head := header(w.blockSize, encoding, block)
+		// The buffer reuses its memory, so the block is copied.
+		w.pending = append(w.pending, encodeAsync(w.encoding, append([]byte{}, block...)))
 
-		i, err = w.writer.Write(head)
-		w.Written += i
-		n += i
+		for len(w.pending) >= w.workers {
+			i, err = w.writePending()
+			n += i
 
-		if err != nil {
-			return
+			if err != nil {
+				return
+			}
 		}
+	}
 
-		i, err = w.writer.Write(block)
-		w.Written += i
+	for size == 0 && len(w.pending) > 0 {
+		i, err = w.writePending()
 		n += i
 
 		if err != nil {
 			return
 		}
+	}
+
+	return
+}
 
-		w.Blocks += 1
+// Writes the oldest block being compressed, once it is.
+func (w *Writer) writePending() (int, error) {
+	block := <-w.pending[0]
+	w.pending = w.pending[1:]
+
+	return w.writeBlock(block)
+}
+
+func (w *Writer) writeBlock(block encodedBlock) (n int, err error) {
+	var i int
+
+	w.offsets = append(w.offsets, w.Written)
+
+	encoding, data := block.encoding, block.data
+
+	if w.checksums {
+		encoding, data = encoding|CHECKSUMMED, checksummed(data)
 	}
 
+	head := header(w.blockSize, encoding, data)
+
+	i, err = w.writer.Write(head)
+	w.Written += i
+	n += i
+
+	if err != nil {
+		return
+	}
+
+	i, err = w.writer.Write(data)
+	w.Written += i
+	n += i
+
+	if err != nil {
+		return
+	}
+
+	w.Blocks += 1
+
 	return
 }
 
+// Data is only encoded if we successfully encode the block.
+// Otherwise the block is identified as uncompressed.
+func encode(encoding int, block []byte) encodedBlock {
+	if encoding == NO_COMPRESSION {
+		return encodedBlock{NO_COMPRESSION, block}
+	}
+
+	if encoded := compress(encoding, block); len(encoded) <= len(block) {
+		return encodedBlock{encoding, encoded}
+	}
+
+	return encodedBlock{NO_COMPRESSION, block}
+}
+
+func encodeAsync(encoding int, block []byte) chan encodedBlock {
+	done := make(chan encodedBlock, 1)
+
+	go func() {
+		done <- encode(encoding, block)
+	}()
+
+	return done
+}
+
 // The header consists of two numbers.  The length of the
 // encoded/compressed block, and the encoding of the block data.
 func header(blockSize int, encoding int, block []byte) []byte {
@@ -3,6 +3,7 @@ package blocks
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"reflect"
 	"testing"
 
@@ -180,3 +181,75 @@ func TestMixedBlockCompression(t *testing.T) {
 	}
 
 }
+
+func TestConcurrentWriter(t *testing.T) {
+	serial, concurrent := new(bytes.Buffer), new(bytes.Buffer)
+
+	s := NewWriter(serial, 32)
+	c := NewWriter(concurrent, 32)
+	c.SetConcurrency(4)
+
+	written := make([]int, 0)
+	blocks := make([]int, 0)
+
+	for i := 0; i < 500; i++ {
+		written = append(written, s.Written)
+		blocks = append(blocks, c.Block())
+
+		data := []byte(fmt.Sprintf("event %d ", i))
+		s.Write(data)
+		c.Write(data)
+	}
+
+	s.Flush()
+	c.Flush()
+
+	if !reflect.DeepEqual(serial.Bytes(), concurrent.Bytes()) {
+		t.Errorf("Concurrently compressed blocks differ")
+	}
+
+	if c.Written != s.Written || c.Blocks != s.Blocks || c.Buffered() != 0 {
+		t.Errorf("Wrong state after flush: want: %d %d got: %d %d", s.Written, s.Blocks, c.Written, c.Blocks)
+	}
+
+	for i, block := range blocks {
+		if c.Offset(block) != written[i] {
+			t.Errorf("Wrong offset for write %d: want: %d got: %d", i, written[i], c.Offset(block))
+			break
+		}
+	}
+}
+
+func TestWriterCompression(t *testing.T) {
+	input := bytes.Repeat([]byte("helloworld"), 100)
+
+	for _, encoding := range []int{NO_COMPRESSION, SNAPPY_COMPRESSION, ZSTD_COMPRESSION} {
+		buffer := new(bytes.Buffer)
+		w := NewWriter(buffer, 256)
+
+		if err := w.SetCompression(encoding); err != nil {
+			t.Fatalf("Unable to compress with %d: %v", encoding, err)
+		}
+
+		w.Write(input)
+		w.Flush()
+
+		if _, found := parseHeader(256, buffer.Bytes()); found != encoding {
+			t.Errorf("Wrong encoding: want: %d got: %d", encoding, found)
+		}
+
+		if encoding != NO_COMPRESSION && buffer.Len() >= len(input) {
+			t.Errorf("Blocks weren't compressed with %d: %d bytes", encoding, buffer.Len())
+		}
+
+		found := make([]byte, len(input))
+
+		if _, err := io.ReadFull(NewByteReader(buffer.Bytes(), 256), found); err != nil || !reflect.DeepEqual(found, input) {
+			t.Errorf("Wrong bytes read for %d: %v", encoding, err)
+		}
+	}
+
+	if err := NewWriter(new(bytes.Buffer), 256).SetCompression(9); err != UnknownEncoding {
+		t.Errorf("Wrong error: want: %v got: %v", UnknownEncoding, err)
+	}
+}
@@ -0,0 +1,91 @@
+package bloom
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+var CORRUPTED_FILTER = errors.New("corrupted bloom filter")
+
+// Filter is a bloom filter, which tests whether a key may have been
+// added to it, without false negatives, and with false positives for
+// about 1% of keys given 10 bits for each added.
+type Filter struct {
+	bits []byte
+	k    uint8
+}
+
+// Creates a filter sized for the given number of keys.
+func New(keys, bitsPerKey int) *Filter {
+	// Fewest false positives at ln(2) hashes per bit.
+	k := uint8(float64(bitsPerKey) * 0.69)
+
+	if k < 1 {
+		k = 1
+	} else if k > 30 {
+		k = 30
+	}
+
+	bits := keys * bitsPerKey
+	if bits < 64 {
+		bits = 64
+	}
+
+	return &Filter{bits: make([]byte, (bits+7)/8), k: k}
+}
+
+func (f *Filter) Add(key []byte) {
+	h1, h2 := hash(key)
+	n := uint32(len(f.bits) * 8)
+
+	for i := uint32(0); i < uint32(f.k); i++ {
+		bit := (h1 + i*h2) % n
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Whether the key may have been added. A nil filter may have every key.
+func (f *Filter) MayContain(key []byte) bool {
+	if f == nil {
+		return true
+	}
+
+	h1, h2 := hash(key)
+	n := uint32(len(f.bits) * 8)
+
+	for i := uint32(0); i < uint32(f.k); i++ {
+		bit := (h1 + i*h2) % n
+
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Encodes the filter as its bits followed by its number of hashes.
+func (f *Filter) Bytes() []byte {
+	b := make([]byte, len(f.bits)+1)
+	copy(b, f.bits)
+	b[len(f.bits)] = f.k
+
+	return b
+}
+
+func Decode(b []byte) (*Filter, error) {
+	if len(b) < 2 || b[len(b)-1] < 1 || b[len(b)-1] > 30 {
+		return nil, CORRUPTED_FILTER
+	}
+
+	return &Filter{bits: b[:len(b)-1], k: b[len(b)-1]}, nil
+}
+
+// Two hashes of the key, combined to give each of the filter's.
+func hash(key []byte) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+
+	return uint32(sum), uint32(sum>>32) | 1
+}
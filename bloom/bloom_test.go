@@ -0,0 +1,51 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f := New(1000, 10)
+
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(fmt.Sprint("customer:", i)))
+	}
+
+	f, err := Decode(f.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !f.MayContain([]byte(fmt.Sprint("customer:", i))) {
+			t.Fatalf("Wanted filter to contain key #%v", i)
+		}
+	}
+
+	var positives int
+
+	for i := 1000; i < 11000; i++ {
+		if f.MayContain([]byte(fmt.Sprint("customer:", i))) {
+			positives += 1
+		}
+	}
+
+	if positives > 200 {
+		t.Errorf("Wanted under 2%% false positives, found: %v of 10000", positives)
+	}
+}
+
+func TestDecodeCorruptedFilter(t *testing.T) {
+	for i, b := range [][]byte{nil, {0}, {0xff, 0}, {0xff, 31}} {
+		if _, err := Decode(b); err != CORRUPTED_FILTER {
+			t.Errorf("Case #%v: wanted: %v, found: %v", i, CORRUPTED_FILTER, err)
+		}
+	}
+
+	var f *Filter
+
+	if !f.MayContain([]byte("a")) {
+		t.Errorf("Wanted a nil filter to contain every key")
+	}
+}
@@ -67,5 +67,10 @@ func (r *Reader) Seek(offset int64, whence int) (n int64, err error) {
 
 	r.current = offset
 
-	return r.reader.Seek(offset, r.whence)
+	// Positions are relative to the start of the range.
+	if n, err = r.reader.Seek(offset, r.whence); err == nil {
+		n = offset - r.start
+	}
+
+	return
 }
@@ -0,0 +1,291 @@
+/*
+The client package talks to an esdb cluster over its versioned HTTP API.
+Writes are sent to the raft leader, found through the cluster's status and
+followed as it changes, while reads are spread over every node. Requests
+are retried with backoff when they fail in ways retrying may fix.
+*/
+package client
+
+import (
+	"github.com/customerio/esdb/cluster"
+
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var NO_NODES = errors.New("No nodes to connect to")
+
+// Client makes requests to the nodes of a cluster, given as URLs such
+// as http://localhost:4001. It's safe for concurrent use.
+type Client struct {
+	// Sent with every request, if set, to be authorized by nodes' roles.
+	ApiKey string
+	// How writes are acknowledged, such as cluster.ACK_QUORUM, the
+	// nodes' default if empty.
+	Ack string
+
+	mutex  sync.Mutex
+	nodes  []string
+	leader string
+	next   int
+	retry  cluster.RetryPolicy
+	http   *http.Client
+}
+
+func New(nodes ...string) *Client {
+	c := &Client{nodes: nodes}
+	c.SetRetryPolicy(cluster.DefaultRetryPolicy)
+
+	if len(nodes) > 0 {
+		c.leader = nodes[0]
+	}
+
+	return c
+}
+
+// Changes how requests are retried, and how long each attempt may take.
+func (c *Client) SetRetryPolicy(p cluster.RetryPolicy) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.retry = p
+	c.http = &http.Client{Timeout: p.Timeout}
+}
+
+// The nodes requests are made to, as last discovered.
+func (c *Client) Nodes() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]string{}, c.nodes...)
+}
+
+// The node writes are sent to, as last discovered.
+func (c *Client) Leader() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.leader
+}
+
+// Asks the nodes for the cluster's status, replacing the nodes known
+// with its members and the leader with the one it reports, trying each
+// node until one responds.
+func (c *Client) Discover(ctx context.Context) error {
+	err := NO_NODES
+
+	for _, node := range c.Nodes() {
+		if err = c.discoverFrom(ctx, node); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (c *Client) discoverFrom(ctx context.Context, node string) error {
+	var status struct {
+		Cluster struct {
+			Nodes map[string]json.RawMessage `json:"nodes"`
+		} `json:"cluster"`
+	}
+
+	resp, err := c.send(ctx, "GET", node+"/cluster/status", nil)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return responseError(resp)
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return err
+	}
+
+	leader := ""
+
+	// Unreachable nodes are reported as an error string, not a state.
+	for _, raw := range status.Cluster.Nodes {
+		var state cluster.NodeState
+
+		if json.Unmarshal(raw, &state) == nil && state.State == "leader" {
+			leader = state.Uri
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if members := resp.Header.Get("Cluster-Nodes"); members != "" {
+		c.nodes = strings.Split(members, ",")
+	}
+
+	if leader != "" {
+		c.leader = leader
+	}
+
+	return nil
+}
+
+// Sends the request to the leader, retrying per the policy, following
+// the cluster to a new leader when redirected, and rediscovering it when
+// the leader can't be reached. Unless the request is idempotent, it's
+// only retried when it wasn't sent, or when redirected.
+func (c *Client) toLeader(ctx context.Context, method, path string, body []byte, res interface{}, idempotent bool) error {
+	c.mutex.Lock()
+	retry := c.retry
+	c.mutex.Unlock()
+
+	return retry.Do(func() error {
+		if err := ctx.Err(); err != nil {
+			return cluster.Permanent(err)
+		}
+
+		leader := c.Leader()
+		if leader == "" {
+			return cluster.Permanent(NO_NODES)
+		}
+
+		resp, err := c.send(ctx, method, leader+path, body)
+		if err != nil {
+			c.Discover(ctx)
+
+			if !idempotent && !cluster.Unsent(err) {
+				return cluster.Permanent(err)
+			}
+
+			return err
+		}
+
+		defer resp.Body.Close()
+
+		if redirect := resp.Header.Get("Cluster-Leader"); redirect != "" && resp.StatusCode == 400 {
+			c.mutex.Lock()
+			c.leader = redirect
+			c.mutex.Unlock()
+
+			return cluster.Immediate(cluster.NOT_LEADER_ERROR)
+		}
+
+		if !idempotent && resp.StatusCode >= 300 {
+			return cluster.Permanent(responseError(resp))
+		}
+
+		return decode(resp, res)
+	})
+}
+
+// Sends the request to each node in turn, moving on to the next
+// whenever one fails and retrying per the policy.
+func (c *Client) toAny(ctx context.Context, path string, res interface{}) error {
+	c.mutex.Lock()
+	retry := c.retry
+	c.mutex.Unlock()
+
+	return retry.Do(func() error {
+		if err := ctx.Err(); err != nil {
+			return cluster.Permanent(err)
+		}
+
+		node := c.nextNode()
+		if node == "" {
+			return cluster.Permanent(NO_NODES)
+		}
+
+		resp, err := c.send(ctx, "GET", node+path, nil)
+		if err != nil {
+			return err
+		}
+
+		defer resp.Body.Close()
+
+		return decode(resp, res)
+	})
+}
+
+func (c *Client) nextNode() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.nodes) == 0 {
+		return ""
+	}
+
+	c.next = (c.next + 1) % len(c.nodes)
+
+	return c.nodes[c.next]
+}
+
+func (c *Client) send(ctx context.Context, method, uri string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, uri, r)
+	if err != nil {
+		return nil, cluster.Permanent(err)
+	}
+
+	req = req.WithContext(ctx)
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.ApiKey != "" {
+		req.Header.Set(cluster.API_KEY_HEADER, c.ApiKey)
+	}
+
+	c.mutex.Lock()
+	client := c.http
+	c.mutex.Unlock()
+
+	return client.Do(req)
+}
+
+// Decodes a successful response into res, unless it's nil, and any
+// other as the *cluster.APIError it reports, retried if it's retryable.
+func decode(resp *http.Response, res interface{}) error {
+	if resp.StatusCode >= 300 {
+		err := responseError(resp)
+
+		if e, ok := err.(*cluster.APIError); ok && e.Retryable {
+			return err
+		}
+
+		return cluster.Permanent(err)
+	}
+
+	if res == nil {
+		return nil
+	}
+
+	return cluster.Permanent(json.NewDecoder(resp.Body).Decode(res))
+}
+
+func responseError(resp *http.Response) error {
+	var res cluster.ErrorResponse
+
+	b, _ := ioutil.ReadAll(resp.Body)
+
+	if err := json.Unmarshal(b, &res); err == nil && res.Error.Code != "" {
+		return &res.Error
+	}
+
+	return &cluster.APIError{
+		Code:      "unexpected_response",
+		Message:   resp.Status + ": " + string(b),
+		Retryable: resp.StatusCode >= 500,
+	}
+}
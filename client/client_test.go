@@ -0,0 +1,132 @@
+package client
+
+import (
+	"github.com/customerio/esdb/cluster"
+	"github.com/customerio/esdb/cluster/loopback"
+
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	c, err := loopback.New(1)
+	if err != nil {
+		t.Fatalf("Failed to start cluster: %v", err)
+	}
+
+	defer c.Close()
+
+	leader, err := c.WaitForLeader()
+	if err != nil {
+		t.Fatalf("No leader elected: %v", err)
+	}
+
+	ctx := context.Background()
+	client := New(leader.State().Uri)
+
+	if err := client.Discover(ctx); err != nil || client.Leader() != leader.State().Uri {
+		t.Fatalf("Expected to discover the leader, found: %v %v", client.Leader(), err)
+	}
+
+	for _, body := range []string{"a", "b", "c"} {
+		_, err := client.Write(ctx, Event{
+			Body:    []byte(body),
+			Indexes: map[string]string{"customer": "1"},
+			Headers: map[string]string{"schema": "2"},
+		})
+
+		if err != nil {
+			t.Fatalf("Unable to write: %v", err)
+		}
+	}
+
+	page, err := client.Scan(ctx, "customer", "1", ScanOptions{Limit: 2})
+	if err != nil || len(page.Events) != 2 || string(page.Events[0].Body) != "c" || page.Events[0].Headers["schema"] != "2" {
+		t.Fatalf("Incorrect page: %+v %v", page, err)
+	}
+
+	found := make([]string, 0)
+
+	err = client.ScanAll(ctx, "customer", "1", ScanOptions{Limit: 2}, func(e Event) bool {
+		found = append(found, string(e.Body))
+		return true
+	})
+
+	if err != nil || !reflect.DeepEqual(found, []string{"c", "b", "a"}) {
+		t.Errorf("Expected to page through every event. Wanted: [c b a], found: %v %v", found, err)
+	}
+
+	found = make([]string, 0)
+
+	_, err = client.IterateAll(ctx, ScanOptions{Limit: 2}, func(e Event) bool {
+		found = append(found, string(e.Body))
+		return true
+	})
+
+	if err != nil || !reflect.DeepEqual(found, []string{"a", "b", "c"}) {
+		t.Errorf("Expected to iterate every event. Wanted: [a b c], found: %v %v", found, err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var requests int32
+
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Unavailable, then written.
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(503)
+			w.Write([]byte(`{"error": {"code": "unavailable", "message": "Unavailable", "retryable": true}}`))
+			return
+		}
+
+		w.Write([]byte(`{"events": [], "commit": 7}`))
+	}))
+
+	defer leader.Close()
+
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Cluster-Leader", leader.URL)
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error": {"code": "not_leader", "message": "Not leader", "retryable": true}}`))
+	}))
+
+	defer follower.Close()
+
+	client := New(follower.URL)
+	client.SetRetryPolicy(cluster.RetryPolicy{MaxAttempts: 3})
+
+	if commit, err := client.Write(context.Background(), Event{Body: []byte("a"), Id: "a"}); err != nil || commit != 7 {
+		t.Errorf("Expected to follow the leader and retry, found: %v %v", commit, err)
+	}
+
+	// Without an id, the write may have been written, so isn't retried.
+	atomic.StoreInt32(&requests, 0)
+
+	if _, err := client.Write(context.Background(), Event{Body: []byte("a")}); err == nil || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("Expected a write without an id not to be retried, found: %v after %v requests", err, requests)
+	}
+
+	if client.Leader() != leader.URL {
+		t.Errorf("Expected to follow the leader to %v, found: %v", leader.URL, client.Leader())
+	}
+
+	invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error": {"code": "malformed_body", "message": "Malformed request body", "retryable": false}}`))
+	}))
+
+	defer invalid.Close()
+
+	atomic.StoreInt32(&requests, 0)
+
+	_, err := New(invalid.URL).Write(context.Background(), Event{Body: []byte("a")})
+
+	if e, ok := err.(*cluster.APIError); !ok || e.Code != "malformed_body" || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("Expected the error without retrying, found: %v after %v requests", err, requests)
+	}
+}
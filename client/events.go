@@ -0,0 +1,65 @@
+package client
+
+import (
+	"github.com/customerio/esdb/cluster"
+
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// Event is an event to write, or one scanned, which has only its
+// body and headers.
+type Event struct {
+	Body     []byte
+	Grouping string
+	Indexes  map[string]string
+	Headers  map[string]string
+	// Expires the event this long after it's written, if set.
+	TTL time.Duration
+	// Dropped if an event with the id was written recently, so writes
+	// retried after a timeout aren't written twice.
+	Id string
+}
+
+// Writes the events through the leader, returning the commit they were
+// written at, or 0 if the nodes' default ack doesn't wait for it. Only
+// writes whose events all have ids are retried once they've been sent,
+// as they can't be written twice.
+func (c *Client) Write(ctx context.Context, events ...Event) (uint64, error) {
+	requests := make([]cluster.EventRequest, len(events))
+	idempotent := len(events) > 0
+
+	for i, e := range events {
+		if e.Id == "" {
+			idempotent = false
+		}
+
+		requests[i] = cluster.EventRequest{
+			Body:     string(e.Body),
+			Grouping: e.Grouping,
+			Indexes:  e.Indexes,
+			TTL:      int64(e.TTL / time.Second),
+			Headers:  e.Headers,
+			Id:       e.Id,
+		}
+	}
+
+	body, err := json.Marshal(requests)
+	if err != nil {
+		return 0, err
+	}
+
+	path := cluster.API_VERSION + "/events"
+
+	if c.Ack != "" {
+		path += "?" + url.Values{"ack": {c.Ack}}.Encode()
+	}
+
+	var res cluster.WriteResponse
+
+	err = c.toLeader(ctx, "POST", path, body, &res, idempotent)
+
+	return res.Commit, err
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"github.com/customerio/esdb/cluster"
+
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ScanOptions limits which events a scan or iteration returns, and
+// where it resumes from.
+type ScanOptions struct {
+	// Only events written with the grouping.
+	Grouping string
+	// Only events in streams after the commit.
+	After uint64
+	// Most events in each page, the nodes' default if 0.
+	Limit int
+	// Resumes from where an earlier page left off.
+	Continuation string
+	// Only events with each of the headers.
+	Headers map[string]string
+	// Only events in streams written within the window, if set.
+	Since time.Time
+	Until time.Time
+}
+
+// Page is a page of events scanned or iterated, and the continuation
+// to read the next from.
+type Page struct {
+	Events       []Event
+	Continuation string
+	HasMore      bool
+	MostRecent   int64
+}
+
+// Scans a page of the events with the index value, newest first.
+func (c *Client) Scan(ctx context.Context, index, value string, opts ScanOptions) (*Page, error) {
+	query := opts.query()
+	query.Set("index", index)
+	query.Set("value", value)
+
+	return c.page(ctx, query)
+}
+
+// Iterates a page of every event, oldest first.
+func (c *Client) Iterate(ctx context.Context, opts ScanOptions) (*Page, error) {
+	return c.page(ctx, opts.query())
+}
+
+// Scans every event with the index value, as Scan, fetching each page
+// in turn until the func returns false or there are no more.
+func (c *Client) ScanAll(ctx context.Context, index, value string, opts ScanOptions, f func(Event) bool) error {
+	return c.all(func(continuation string) (*Page, error) {
+		opts.Continuation = continuation
+		return c.Scan(ctx, index, value, opts)
+	}, opts.Continuation, f)
+}
+
+// Iterates every event, as Iterate, fetching each page in turn until
+// the func returns false or it reaches the newest. The continuation
+// returned resumes from there once more are written.
+func (c *Client) IterateAll(ctx context.Context, opts ScanOptions, f func(Event) bool) (string, error) {
+	var last string
+
+	err := c.all(func(continuation string) (*Page, error) {
+		opts.Continuation = continuation
+		page, err := c.Iterate(ctx, opts)
+
+		if err == nil {
+			last = page.Continuation
+		}
+
+		return page, err
+	}, opts.Continuation, f)
+
+	return last, err
+}
+
+func (c *Client) all(fetch func(string) (*Page, error), continuation string, f func(Event) bool) error {
+	for {
+		page, err := fetch(continuation)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range page.Events {
+			if !f(e) {
+				return nil
+			}
+		}
+
+		if !page.HasMore || page.Continuation == "" {
+			return nil
+		}
+
+		continuation = page.Continuation
+	}
+}
+
+func (c *Client) page(ctx context.Context, query url.Values) (*Page, error) {
+	var res cluster.ScanResponse
+
+	if err := c.toAny(ctx, cluster.API_VERSION+"/events?"+query.Encode(), &res); err != nil {
+		return nil, err
+	}
+
+	page := &Page{
+		Events:       make([]Event, len(res.Events)),
+		Continuation: res.Continuation,
+		HasMore:      res.HasMore,
+		MostRecent:   res.MostRecent,
+	}
+
+	for i, body := range res.Events {
+		page.Events[i].Body = []byte(body)
+
+		if i < len(res.Headers) {
+			page.Events[i].Headers = res.Headers[i]
+		}
+	}
+
+	return page, nil
+}
+
+func (o ScanOptions) query() url.Values {
+	query := url.Values{}
+
+	if o.Grouping != "" {
+		query.Set("grouping", o.Grouping)
+	}
+
+	if o.After > 0 {
+		query.Set("after", strconv.FormatUint(o.After, 10))
+	}
+
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+
+	if o.Continuation != "" {
+		query.Set("continuation", o.Continuation)
+	}
+
+	for name, value := range o.Headers {
+		query.Add("header", name+":"+value)
+	}
+
+	if !o.Since.IsZero() {
+		query.Set("since", o.Since.Format(time.RFC3339))
+	}
+
+	if !o.Until.IsZero() {
+		query.Set("until", o.Until.Format(time.RFC3339))
+	}
+
+	return query
+}
@@ -0,0 +1,186 @@
+package cluster
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// Respond once the write is validated, without waiting for it to
+	// be committed. Failures are only logged.
+	ACK_NONE = "none"
+	// Respond once the write is committed by raft and applied by the
+	// leader. The default.
+	ACK_LEADER = "leader"
+	// As ACK_LEADER, but every node also syncs the open stream to disk
+	// as it applies the write, and a quorum of nodes, the leader
+	// included, have done so before the response is sent.
+	ACK_QUORUM = "quorum"
+)
+
+// How long quorum writes wait for enough nodes to apply them.
+const QUORUM_ACK_TIMEOUT = 5 * time.Second
+
+var INVALID_ACK = errors.New("Unknown acknowledgement level, expected none, leader or quorum")
+var QUORUM_TIMEOUT = errors.New("Write was committed, but a quorum of nodes didn't apply it in time")
+
+func parseAck(ack string) (string, error) {
+	switch ack {
+	case "":
+		return ACK_LEADER, nil
+	case ACK_NONE, ACK_LEADER, ACK_QUORUM:
+		return ack, nil
+	}
+
+	return "", INVALID_ACK
+}
+
+// Writes the events, returning once acknowledged at the given level
+// with the commit they were written at. The commit is 0 if the write
+// wasn't waited for.
+func (n *Node) WriteEvents(bodies [][]byte, groupings []string, indexes []map[string]string, ack string) (commit uint64, err error) {
+	return n.WriteEventsWithHeaders(bodies, groupings, indexes, nil, ack)
+}
+
+// Writes the events, as WriteEvents, each with the headers at its
+// position, if any. See stream.Event.Headers.
+func (n *Node) WriteEventsWithHeaders(bodies [][]byte, groupings []string, indexes, headers []map[string]string, ack string) (commit uint64, err error) {
+	return n.WriteEventsWithIds(bodies, groupings, indexes, headers, nil, ack)
+}
+
+// Writes the events, as WriteEventsWithHeaders, each with the id at its
+// position, if any. Events with the id of one written recently are
+// dropped, as are repeats within the batch. See WithDeduplication.
+func (n *Node) WriteEventsWithIds(bodies [][]byte, groupings []string, indexes, headers []map[string]string, ids []string, ack string) (commit uint64, err error) {
+	if n.raft == nil {
+		return 0, errors.New("Raft not yet initialized")
+	}
+
+	if ack, err = parseAck(ack); err != nil {
+		return
+	}
+
+	for _, i := range indexes {
+		if reserved(i) {
+			return 0, RESERVED_INDEX
+		}
+	}
+
+	if n.db.disk.Full() {
+		return 0, DISK_FULL
+	}
+
+	if err := n.writable(); err != nil {
+		return 0, err
+	}
+
+	if n.raft.State() != "leader" {
+		return 0, NOT_LEADER_ERROR
+	}
+
+	// Validates the events as transformed.
+	if bodies, groupings, indexes, headers, ids, err = n.db.transform(bodies, groupings, indexes, headers, ids); err != nil {
+		return 0, err
+	}
+
+	// Every event was dropped, so there's nothing to write.
+	if len(bodies) == 0 {
+		return 0, nil
+	}
+
+	if err := n.db.quotas.admit(bodies, indexes); err != nil {
+		return 0, err
+	}
+
+	if ack == ACK_NONE {
+		for i, body := range bodies {
+			n.unacknowledged.push(queuedEvent{
+				body:     body,
+				grouping: groupingAt(groupings, i),
+				indexes:  indexes[i],
+				headers:  headersAt(headers, i),
+				id:       idAt(ids, i),
+			})
+		}
+
+		return 0, nil
+	}
+
+	return n.do(bodies, groupings, indexes, headers, ids, ack)
+}
+
+// Appends the events, already validated and transformed, to the raft
+// log, returning once acknowledged at the level with their commit.
+func (n *Node) do(bodies [][]byte, groupings []string, indexes, headers []map[string]string, ids []string, ack string) (commit uint64, err error) {
+	command := NewEventsCommand(bodies, groupings, indexes, time.Now().UnixNano())
+	command.Sync = ack == ACK_QUORUM
+
+	if hasHeaders(headers) {
+		command.Headers = headers
+	}
+
+	if hasIds(ids) {
+		command.Ids = ids
+	}
+
+	result, err := n.raft.Do(command)
+
+	if index, ok := result.(uint64); ok {
+		commit = index
+	}
+
+	if err == nil && ack == ACK_QUORUM {
+		err = n.waitForQuorum(commit, QUORUM_ACK_TIMEOUT)
+	}
+
+	return
+}
+
+// Waits for a quorum of nodes, the leader included, to have applied
+// the write at the commit, and so synced it and the writes before it.
+func (n *Node) waitForQuorum(commit uint64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for n.appliedBy(commit) < n.raft.QuorumSize() {
+		if time.Now().After(deadline) {
+			return QUORUM_TIMEOUT
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// How many nodes have applied the writes up to the commit, asking
+// peers until enough have.
+func (n *Node) appliedBy(commit uint64) int {
+	applied := 0
+
+	if n.db.Applied() >= commit {
+		applied++
+	}
+
+	for _, peer := range n.raft.Peers() {
+		if applied >= n.raft.QuorumSize() {
+			break
+		}
+
+		client, call, err := ping(peer, n.db.reader.apiKey, n.tls)
+		if err != nil {
+			continue
+		}
+
+		select {
+		case <-call.Done:
+			if call.Error == nil && call.Reply.(*NodeState).Applied >= commit {
+				applied++
+			}
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		client.Close()
+	}
+
+	return applied
+}
@@ -0,0 +1,125 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteAcknowledgements(t *testing.T) {
+	withNode(func(n *Node) {
+		commit, err := n.WriteEvents([][]byte{[]byte("a")}, nil, []map[string]string{{"a": "1"}}, ACK_LEADER)
+
+		if err != nil || commit != n.raft.CommitIndex() {
+			t.Errorf("Expected commit %v, found: %v %v", n.raft.CommitIndex(), commit, err)
+		}
+
+		synced, err := n.WriteEvents([][]byte{[]byte("b")}, nil, []map[string]string{{"a": "1"}}, ACK_QUORUM)
+
+		if err != nil || synced <= commit {
+			t.Errorf("Expected a later commit than %v, found: %v %v", commit, synced, err)
+		}
+
+		if commit, err := n.WriteEvents([][]byte{[]byte("c")}, nil, []map[string]string{{"a": "1"}}, ACK_NONE); err != nil || commit != 0 {
+			t.Errorf("Expected an unacknowledged write, found: %v %v", commit, err)
+		}
+
+		if _, err := n.WriteEvents([][]byte{[]byte("d")}, nil, []map[string]string{{"a": "1"}}, "all"); err != INVALID_ACK {
+			t.Errorf("Expected invalid ack error, found: %v", err)
+		}
+
+		for n.raft.CommitIndex() == synced {
+			time.Sleep(time.Millisecond)
+		}
+
+		found, _, _ := Query{Index: "a", Value: "1"}.run(n.db)
+
+		if !reflect.DeepEqual(found, []string{"c", "b", "a"}) {
+			t.Errorf("Incorrect events. Wanted: [c b a], found: %v", found)
+		}
+	})
+}
+
+func TestWriteAcknowledgementResponses(t *testing.T) {
+	withNode(func(n *Node) {
+		tests := []struct {
+			ack    string
+			code   int
+			commit bool
+		}{
+			{"", 200, true},
+			{"quorum", 200, true},
+			{"none", 202, false},
+			{"all", 400, false},
+		}
+
+		for i, test := range tests {
+			req, _ := http.NewRequest("POST", "/events?ack="+test.ack, strings.NewReader(`[{"body": "a", "indexes": {"a": "1"}}]`))
+			w := httptest.NewRecorder()
+
+			n.eventHandler(w, req)
+
+			var res map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &res)
+
+			if _, ok := res["commit"]; w.Code != test.code || ok != test.commit {
+				t.Errorf("Case #%v: Wanted: %v with commit: %v, found: %v %v", i, test.code, test.commit, w.Code, res)
+			}
+		}
+	})
+}
+
+func TestQuorumAcknowledgementWaitsForApplies(t *testing.T) {
+	withNode(func(n *Node) {
+		commit, err := n.WriteEvents([][]byte{[]byte("a")}, nil, []map[string]string{{"a": "1"}}, ACK_QUORUM)
+
+		if err != nil || n.db.Applied() != commit {
+			t.Errorf("Expected commit %v to be applied, found: %v %v", commit, n.db.Applied(), err)
+		}
+
+		if state := n.State(); state.Applied != commit {
+			t.Errorf("Expected the node to report commit %v applied, found: %v", commit, state.Applied)
+		}
+
+		if err := n.waitForQuorum(commit, time.Second); err != nil {
+			t.Errorf("Expected the leader alone to be a quorum, found: %v", err)
+		}
+
+		if err := n.waitForQuorum(commit+100, 50*time.Millisecond); err != QUORUM_TIMEOUT {
+			t.Errorf("Expected a timeout waiting for an unapplied index, found: %v", err)
+		}
+	})
+}
+
+func TestUnacknowledgedWritesAreQueued(t *testing.T) {
+	withNode(func(n *Node) {
+		headers := []map[string]string{{"h": "1"}, nil}
+
+		for _, id := range []string{"x", "x", "y"} {
+			if _, err := n.WriteEventsWithIds([][]byte{[]byte(id), []byte(id + "2")}, nil, []map[string]string{{"a": "1"}, {"a": "1"}}, headers, []string{id, id + "2"}, ACK_NONE); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var found []string
+
+		for deadline := time.Now().Add(time.Second); len(found) < 4 && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			found = nil
+
+			n.db.Scan("a", "1", 0, "", func(e *stream.Event) bool {
+				found = append(found, string(e.Data)+e.Headers["h"])
+				return true
+			})
+		}
+
+		if want := []string{"y2", "y1", "x2", "x1"}; !reflect.DeepEqual(found, want) {
+			t.Errorf("Wrong events written. Wanted: %v, found: %v", want, found)
+		}
+	})
+}
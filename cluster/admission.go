@@ -0,0 +1,73 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var OVERLOADED = errors.New("Too many queries are running, try again later")
+var INVALID_QUERY_LIMIT = errors.New("Query limit must not be negative")
+
+// How long queries wait for others to finish before they're
+// refused, unless configured otherwise.
+const DEFAULT_QUERY_QUEUE_TIMEOUT = time.Second
+
+// Admission limits how many scans run at once, so a burst of
+// expensive historical queries can't take the CPU and disk from
+// writes. Queries beyond the limit queue until one finishes, and
+// are refused with OVERLOADED if none does in time. A nil
+// Admission doesn't limit.
+type Admission struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// Limits queries to the given number at once, or returns nil, not
+// limiting them, if that's 0.
+func NewAdmission(limit int, timeout time.Duration) *Admission {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &Admission{make(chan struct{}, limit), timeout}
+}
+
+// Waits for the query to be admitted, returning a func to call once
+// it's finished.
+func (a *Admission) admit(ctx context.Context) (func(), error) {
+	if a == nil {
+		return func() {}, nil
+	}
+
+	release := func() {
+		<-a.slots
+	}
+
+	select {
+	case a.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	timeout := time.NewTimer(a.timeout)
+	defer timeout.Stop()
+
+	select {
+	case a.slots <- struct{}{}:
+		return release, nil
+	case <-timeout.C:
+		return nil, OVERLOADED
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Queries running, and the most which can be.
+func (a *Admission) Running() (int, int) {
+	if a == nil {
+		return 0, 0
+	}
+
+	return len(a.slots), cap(a.slots)
+}
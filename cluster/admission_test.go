@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAdmission(t *testing.T) {
+	a := NewAdmission(1, 10*time.Millisecond)
+
+	release, err := a.admit(context.Background())
+	if err != nil {
+		t.Fatalf("Expected to be admitted, found: %v", err)
+	}
+
+	if _, err := a.admit(context.Background()); err != OVERLOADED {
+		t.Errorf("Expected overloaded error, found: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := a.admit(ctx); err != context.Canceled {
+		t.Errorf("Expected canceled error, found: %v", err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		release()
+	}()
+
+	if _, err := a.admit(context.Background()); err != nil {
+		t.Errorf("Expected to be admitted once released, found: %v", err)
+	}
+
+	if running, limit := a.Running(); running != 1 || limit != 1 {
+		t.Errorf("Wanted 1 of 1 running, found: %v of %v", running, limit)
+	}
+
+	if _, err := (*Admission)(nil).admit(context.Background()); err != nil {
+		t.Errorf("Expected no limit, found: %v", err)
+	}
+}
+
+func TestQueryLimit(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	db, _ := NewDb("tmp", WithQueryLimit(1, time.Millisecond))
+	db.Write(2, []byte("a"), "", map[string]string{"a": "b"}, 1)
+
+	scanning, finish := make(chan bool), make(chan bool)
+
+	go db.Scan("a", "b", 0, "", func(e *stream.Event) bool {
+		scanning <- true
+		<-finish
+		return true
+	})
+
+	<-scanning
+
+	if _, err := db.Iterate(0, "", func(e *stream.Event) bool { return true }); err != OVERLOADED {
+		t.Errorf("Expected overloaded error, found: %v", err)
+	}
+
+	close(finish)
+}
@@ -0,0 +1,251 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Prefix of the versioned HTTP API. Its endpoints are those served
+// without it, whose request and response bodies are described by the
+// types below, except errors are always reported as an ErrorResponse.
+// The unversioned endpoints stay as they were, for existing clients.
+const API_VERSION = "/v1"
+
+// An event to write, POSTed to /v1/events as a JSON array. It expires
+// at ExpiresAt, or TTL seconds after it's written, if either is set.
+type EventRequest struct {
+	Body      string            `json:"body"`
+	Grouping  string            `json:"grouping"`
+	Indexes   map[string]string `json:"indexes"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	TTL       int64             `json:"ttl,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	// Drops the event if one with the id was written recently, so
+	// writes can be retried safely. See WithDeduplication.
+	Id string `json:"id,omitempty"`
+}
+
+// The indexes to write the event with, including its expiry.
+func (e *EventRequest) indexes() map[string]string {
+	switch {
+	case e.ExpiresAt != nil:
+		return Expiring(e.Indexes, *e.ExpiresAt)
+	case e.TTL > 0:
+		return Expiring(e.Indexes, time.Now().Add(time.Duration(e.TTL)*time.Second))
+	}
+
+	return e.Indexes
+}
+
+type WrittenEvent struct {
+	Event    string            `json:"event"`
+	Grouping string            `json:"grouping"`
+	Indexes  map[string]string `json:"indexes"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Id       string            `json:"id,omitempty"`
+}
+
+// The response to writing events. Commit is only set once they're
+// written, so is missing with a 202 status when the write wasn't waited on.
+type WriteResponse struct {
+	Events []WrittenEvent `json:"events"`
+	Commit uint64         `json:"commit,omitempty"`
+}
+
+// The response to GET /v1/events. See Paginate, Truncated and Partial.
+type ScanResponse struct {
+	Events       []string `json:"events"`
+	Continuation string   `json:"continuation"`
+	MostRecent   int64    `json:"most_recent"`
+	Limit        int      `json:"limit"`
+	HasMore      bool     `json:"has_more"`
+	Next         string   `json:"next,omitempty"`
+	Truncated    bool     `json:"truncated,omitempty"`
+	Partial      bool     `json:"partial,omitempty"`
+	// The headers of each event, if any have them.
+	Headers []map[string]string `json:"headers,omitempty"`
+}
+
+// Reports the error alongside what the scan found before it failed,
+// as a batch reports each of its queries.
+func (res *ScanResponse) WithError(err error) BatchResult {
+	kind := Classify(err)
+	return BatchResult{res, err.Error(), kind.Code, kind.Retryable}
+}
+
+// Several queries run at once, POSTed to /v1/events/batch.
+type BatchRequest struct {
+	Limit   int     `json:"limit"`
+	Queries []Query `json:"queries"`
+}
+
+type BatchResult struct {
+	// Missing if the query couldn't start.
+	*ScanResponse
+	// Why the query failed, if it did.
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+}
+
+type BatchResponse struct {
+	Results    []BatchResult `json:"results"`
+	MostRecent int64         `json:"most_recent"`
+}
+
+// The body of every versioned response with an error status. Any
+// other details of the error (such as a conflicting index) are
+// given alongside it.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+var statusCodes = map[int]string{
+	400: "bad_request",
+	401: "unauthenticated",
+	403: "forbidden",
+	404: "not_found",
+	409: "conflict",
+	429: "rate_limited",
+	500: "internal",
+	503: "unavailable",
+	507: "disk_full",
+}
+
+// The error reported by an unversioned response, falling back to
+// one implied by its status for those without an error code.
+func responseError(status int, res map[string]interface{}) APIError {
+	message, _ := res["error"].(string)
+
+	if code, ok := res["code"].(string); ok {
+		retryable, _ := res["retryable"].(bool)
+		delete(res, "code")
+		delete(res, "retryable")
+
+		return APIError{code, message, retryable}
+	}
+
+	return statusError(status, message)
+}
+
+func statusError(status int, message string) APIError {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = strings.ToLower(strings.Replace(http.StatusText(status), " ", "_", -1))
+	}
+
+	if message == "" {
+		message = http.StatusText(status)
+	}
+
+	return APIError{
+		Code:      code,
+		Message:   message,
+		Retryable: status >= 500 || status == 429,
+	}
+}
+
+type versionKey struct{}
+
+// Serves the handler under API_VERSION, so it's given the path it was
+// registered at without the prefix, and its error responses are
+// rewritten as an ErrorResponse.
+func Versioned(handler func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := *r.URL
+		u.Path = strings.TrimPrefix(u.Path, API_VERSION)
+		u.RawPath = strings.TrimPrefix(u.RawPath, API_VERSION)
+
+		r = r.WithContext(context.WithValue(r.Context(), versionKey{}, API_VERSION))
+		r.URL = &u
+
+		vw := &versionedWriter{ResponseWriter: w}
+		handler(vw, r)
+		vw.finish()
+	}
+}
+
+// The path as requested, with the API version of the request (if
+// any) it was made within, for linking to other endpoints.
+func versionedPath(ctx context.Context, path string) string {
+	version, _ := ctx.Value(versionKey{}).(string)
+	return version + path
+}
+
+// Holds back error responses until the handler's finished, so their
+// bodies can be rewritten. Anything else is written straight through.
+type versionedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *versionedWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+
+	w.status = status
+
+	if status < 400 {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *versionedWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(200)
+	}
+
+	if w.status < 400 {
+		return w.ResponseWriter.Write(b)
+	}
+
+	return w.body.Write(b)
+}
+
+func (w *versionedWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.status < 400 {
+		f.Flush()
+	}
+}
+
+func (w *versionedWriter) finish() {
+	if w.status < 400 {
+		return
+	}
+
+	res := make(map[string]interface{})
+	json.Unmarshal(w.body.Bytes(), &res)
+
+	res["error"] = responseError(w.status, res)
+
+	js, _ := json.MarshalIndent(res, "", "  ")
+
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(js)
+	w.ResponseWriter.Write([]byte("\n"))
+}
+
+// The query's /events URL, within the API version of the context.
+func (q Query) versionedUrl(ctx context.Context) *url.URL {
+	u := q.url()
+	u.Path = versionedPath(ctx, u.Path)
+	return u
+}
@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVersionedScan(t *testing.T) {
+	withNode(func(n *Node) {
+		for _, body := range []string{"a", "b", "c"} {
+			trackevent(n, []byte(body), map[string]string{"a": "b"})
+		}
+
+		req := httptest.NewRequest("GET", "/v1/events?index=a&value=b&limit=2", nil)
+		w := httptest.NewRecorder()
+
+		n.mux.ServeHTTP(w, req)
+
+		var res ScanResponse
+		json.Unmarshal(w.Body.Bytes(), &res)
+
+		if w.Code != 200 || !reflect.DeepEqual(res.Events, []string{"c", "b"}) {
+			t.Errorf("Incorrect events. Wanted: [c b], found: %v %v", w.Code, res.Events)
+		}
+
+		if !res.HasMore || !strings.HasPrefix(res.Next, "/v1/events?") {
+			t.Errorf("Expected a versioned next page, found: %v %v", res.HasMore, res.Next)
+		}
+	})
+}
+
+func TestVersionedErrors(t *testing.T) {
+	withNode(func(n *Node) {
+		for i, test := range []struct {
+			method, url string
+			status      int
+			err         APIError
+		}{
+			{"GET", "/v1/events?continuation=x", 400, APIError{"malformed_continuation", MALFORMED_CONTINUATION.Error(), false}},
+			{"POST", "/v1/events", 400, APIError{"malformed_body", MALFORMED_BODY.Error(), false}},
+			{"POST", "/v1/events/compress/1", 404, APIError{"not_found", "Not Found", false}},
+		} {
+			req := httptest.NewRequest(test.method, test.url, strings.NewReader("x"))
+			w := httptest.NewRecorder()
+
+			n.mux.ServeHTTP(w, req)
+
+			var res ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &res)
+
+			if w.Code != test.status || res.Error != test.err {
+				t.Errorf("Case #%v: Wanted: %v %v, found: %v %v", i, test.status, test.err, w.Code, w.Body.String())
+			}
+		}
+
+		// Unversioned endpoints report errors as they always have.
+		req := httptest.NewRequest("GET", "/events?continuation=x", nil)
+		w := httptest.NewRecorder()
+
+		n.mux.ServeHTTP(w, req)
+
+		var res map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &res)
+
+		if res["error"] != MALFORMED_CONTINUATION.Error() {
+			t.Errorf("Expected an unstructured error, found: %v", w.Body.String())
+		}
+	})
+}
+
+func TestVersionedWritesAndBatches(t *testing.T) {
+	withNode(func(n *Node) {
+		req := httptest.NewRequest("POST", "/v1/events", strings.NewReader(`[{"body": "a", "indexes": {"a": "b"}, "id": "1"}]`))
+		w := httptest.NewRecorder()
+
+		n.mux.ServeHTTP(w, req)
+
+		var written WriteResponse
+		json.Unmarshal(w.Body.Bytes(), &written)
+
+		if want := []WrittenEvent{{Event: "a", Indexes: map[string]string{"a": "b"}, Id: "1"}}; w.Code != 200 || written.Commit == 0 || !reflect.DeepEqual(written.Events, want) {
+			t.Errorf("Incorrect write response. Wanted: %v, found: %v %v", want, w.Code, w.Body.String())
+		}
+
+		req = httptest.NewRequest("POST", "/v1/events/batch", strings.NewReader(`{"queries": [{"index": "a", "value": "b"}, {"index": "a", "value": "b", "continuation": "x"}]}`))
+		w = httptest.NewRecorder()
+
+		n.mux.ServeHTTP(w, req)
+
+		var batch BatchResponse
+		json.Unmarshal(w.Body.Bytes(), &batch)
+
+		if len(batch.Results) != 2 || batch.Results[0].ScanResponse == nil || !reflect.DeepEqual(batch.Results[0].Events, []string{"a"}) {
+			t.Fatalf("Incorrect batch results: %v", w.Body.String())
+		}
+
+		if failed := batch.Results[1]; failed.Code != "malformed_continuation" || failed.Error == "" {
+			t.Errorf("Expected the second query to fail, found: %v", w.Body.String())
+		}
+	})
+}
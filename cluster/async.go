@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"sync"
+)
+
+const (
+	DEFAULT_QUEUE_SIZE = 1024
+	// Most events written together from the queue.
+	MAX_ASYNC_BATCH = 1000
+)
+
+// Future is the result of a write made asynchronously.
+type Future struct {
+	done   chan struct{}
+	commit uint64
+	err    error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+func failed(err error) *Future {
+	f := newFuture()
+	f.resolve(0, err)
+	return f
+}
+
+func (f *Future) resolve(commit uint64, err error) {
+	f.commit, f.err = commit, err
+	close(f.done)
+}
+
+// Closed once the write has been committed, or has failed.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Waits for the write, returning the commit it was written at.
+func (f *Future) Wait() (uint64, error) {
+	<-f.done
+	return f.commit, f.err
+}
+
+type queuedEvent struct {
+	body     []byte
+	grouping string
+	indexes  map[string]string
+	headers  map[string]string
+	id       string
+	// Nil if the write isn't acknowledged, so failures go to the
+	// queue's failed instead.
+	future *Future
+}
+
+// Queues writes for a single goroutine to make. Events queued while
+// a write is in flight are written together in the next, so callers
+// can pipeline writes without waiting on each. If an event's refused,
+// failing those written with it, each is written again by itself, so
+// every caller gets the result of its own event.
+type writeQueue struct {
+	queue chan queuedEvent
+	write func(bodies [][]byte, groupings []string, indexes, headers []map[string]string, ids []string) (uint64, error)
+	// Called with each failure of an event queued without a future.
+	failed func(err error)
+	start  sync.Once
+}
+
+func newWriteQueue(write func([][]byte, []string, []map[string]string, []map[string]string, []string) (uint64, error)) *writeQueue {
+	return &writeQueue{
+		queue: make(chan queuedEvent, DEFAULT_QUEUE_SIZE),
+		write: write,
+	}
+}
+
+// Queues the event, blocking only while the queue is full.
+func (q *writeQueue) add(body []byte, grouping string, indexes map[string]string) *Future {
+	f := newFuture()
+	q.push(queuedEvent{body: body, grouping: grouping, indexes: indexes, future: f})
+
+	return f
+}
+
+func (q *writeQueue) push(e queuedEvent) {
+	q.start.Do(func() {
+		go q.run()
+	})
+
+	q.queue <- e
+}
+
+func (q *writeQueue) run() {
+	for first := range q.queue {
+		batch := []queuedEvent{first}
+
+	collect:
+		for len(batch) < MAX_ASYNC_BATCH {
+			select {
+			case e := <-q.queue:
+				batch = append(batch, e)
+			default:
+				break collect
+			}
+		}
+
+		bodies := make([][]byte, len(batch))
+		groupings := make([]string, len(batch))
+		indexes := make([]map[string]string, len(batch))
+		headers := make([]map[string]string, len(batch))
+		ids := make([]string, len(batch))
+
+		for i, e := range batch {
+			bodies[i], groupings[i], indexes[i], headers[i], ids[i] = e.body, e.grouping, e.indexes, e.headers, e.id
+		}
+
+		if !hasHeaders(headers) {
+			headers = nil
+		}
+
+		if !hasIds(ids) {
+			ids = nil
+		}
+
+		commit, err := q.write(bodies, groupings, indexes, headers, ids)
+
+		if len(batch) > 1 && refused(err) {
+			for _, e := range batch {
+				var headers []map[string]string
+				var ids []string
+
+				if e.headers != nil {
+					headers = []map[string]string{e.headers}
+				}
+
+				if e.id != "" {
+					ids = []string{e.id}
+				}
+
+				commit, err := q.write([][]byte{e.body}, []string{e.grouping}, []map[string]string{e.indexes}, headers, ids)
+				q.resolve(e, commit, err)
+			}
+
+			continue
+		}
+
+		for _, e := range batch {
+			q.resolve(e, commit, err)
+		}
+	}
+}
+
+func (q *writeQueue) resolve(e queuedEvent, commit uint64, err error) {
+	if e.future != nil {
+		e.future.resolve(commit, err)
+	} else if err != nil && q.failed != nil {
+		q.failed(err)
+	}
+}
+
+// Whether the error refuses one of the events written, rather than the
+// write, so none were written and the others may be without it. Quotas
+// refuse the events of a namespace, which may be written with others.
+func refused(err error) bool {
+	switch e := err.(type) {
+	case *ValidationError, *UniqueConflictError, *QuotaExceededError:
+		return true
+	case *APIError:
+		switch e.Code {
+		case "invalid_event", "unique_conflict", "reserved_index", "invalid_expiry", "quota_exceeded":
+			return true
+		}
+	}
+
+	return err == RESERVED_INDEX || err == INVALID_EXPIRY
+}
+
+// Queues the event to be written, returning immediately with a
+// future resolved once it's committed and applied.
+func (n *Node) EventAsync(body []byte, grouping string, indexes map[string]string) *Future {
+	if reserved(indexes) {
+		return failed(RESERVED_INDEX)
+	}
+
+	return n.writes.add(body, grouping, indexes)
+}
+
+// Queues the event to be sent to the leader, returning immediately
+// with a future resolved once the leader acknowledges it.
+func (c *Client) EventAsync(content []byte, grouping string, indexes map[string]string) *Future {
+	return c.writes.add(content, grouping, indexes)
+}
@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAsyncWrites(t *testing.T) {
+	withNode(func(n *Node) {
+		futures := []*Future{}
+
+		for _, body := range []string{"a", "b", "c"} {
+			futures = append(futures, n.EventAsync([]byte(body), "", map[string]string{"a": "1"}))
+		}
+
+		for i, f := range futures {
+			if commit, err := f.Wait(); err != nil || commit == 0 {
+				t.Errorf("Case #%v: Expected a commit, found: %v %v", i, commit, err)
+			}
+		}
+
+		if _, err := n.EventAsync([]byte("d"), "", map[string]string{AUDIT_INDEX: "1"}).Wait(); err != RESERVED_INDEX {
+			t.Errorf("Expected reserved index error, found: %v", err)
+		}
+
+		found, _, _ := Query{Index: "a", Value: "1"}.run(n.db)
+
+		if !reflect.DeepEqual(found, []string{"c", "b", "a"}) {
+			t.Errorf("Incorrect events. Wanted: [c b a], found: %v", found)
+		}
+	})
+}
+
+func TestAsyncWritesFailOnlyTheirOwnEvent(t *testing.T) {
+	written := make([]string, 0)
+
+	q := newWriteQueue(func(bodies [][]byte, groupings []string, indexes, _ []map[string]string, _ []string) (uint64, error) {
+		for i, body := range bodies {
+			if string(body) == "bad" {
+				return 0, &ValidationError{i, "", "bad"}
+			} else if string(body) == "down" {
+				return 0, errors.New("down")
+			}
+		}
+
+		for _, body := range bodies {
+			written = append(written, string(body))
+		}
+
+		return uint64(len(written)), nil
+	})
+
+	enqueue := func(bodies ...string) []*Future {
+		futures := make([]*Future, 0)
+
+		for _, body := range bodies {
+			f := newFuture()
+			q.queue <- queuedEvent{body: []byte(body), future: f}
+			futures = append(futures, f)
+		}
+
+		return futures
+	}
+
+	// Queued before the queue starts, so they're written together.
+	futures := enqueue("a", "bad", "c")
+	go q.run()
+
+	for i, want := range []bool{true, false, true} {
+		if _, err := futures[i].Wait(); (err == nil) != want {
+			t.Errorf("Case #%v: Wrong result for the event: %v", i, err)
+		}
+	}
+
+	if !reflect.DeepEqual(written, []string{"a", "c"}) {
+		t.Errorf("Expected the other events to be written, found: %v", written)
+	}
+
+	// Failures of the write itself fail every event with it.
+	for _, f := range enqueue("d", "down") {
+		if _, err := f.Wait(); err == nil || err.Error() != "down" {
+			t.Errorf("Expected the write's error, found: %v", err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Responds with a continuation to iterate from the first event written
+// at or after the RFC 3339 time given, eg: /events/at?time=2017-01-02T00:00:00Z
+func (n *Node) atEventsHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body.Close()
+
+	role, ok := n.auth.Authorize(w, req, READ)
+	if !ok {
+		return
+	}
+
+	if !role.Allows("", "") {
+		Deny(w, FORBIDDEN)
+		return
+	}
+
+	res := make(map[string]interface{})
+
+	at, err := time.Parse(time.RFC3339, req.FormValue("time"))
+
+	if err != nil {
+		res = Fail(w, INVALID_TIME)
+		res["error"] = INVALID_TIME.Error() + ": " + req.FormValue("time")
+	} else {
+		res["meta"] = n.Metadata()
+		res["continuation"] = n.db.ContinuationAt(at.UnixNano())
+	}
+
+	js, _ := json.MarshalIndent(res, "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
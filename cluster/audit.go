@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+	"github.com/jrallison/raft"
+
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const (
+	// Every audit event is chained together under this index and value,
+	// and under AUDIT_ACTION_INDEX by the kind of action it records.
+	AUDIT_INDEX        = "_audit"
+	AUDIT_LOG          = "log"
+	AUDIT_ACTION_INDEX = "_audit_action"
+
+	AUDIT_JOIN     = "join"
+	AUDIT_LEAVE    = "leave"
+	AUDIT_ROTATE   = "rotate"
+	AUDIT_COMPRESS = "compress"
+	AUDIT_REDACT   = "redact"
+	AUDIT_SPLIT    = "split"
+
+	AUDIT_READ_ONLY = "readonly"
+)
+
+var RESERVED_INDEX = errors.New("Index name is reserved for internal use")
+
+// AuditEntry is the body of each audit event.
+type AuditEntry struct {
+	Action    string                 `json:"action"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+}
+
+// AuditCommand records an administrative action which was
+// carried out outside of the replicated log, such as a
+// change to the cluster's membership.
+type AuditCommand struct {
+	Action    string                 `json:"action"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+}
+
+func NewAuditCommand(action string, details map[string]interface{}, timestamp int64) *AuditCommand {
+	return &AuditCommand{
+		Action:    action,
+		Details:   details,
+		Timestamp: timestamp,
+	}
+}
+
+func (c *AuditCommand) CommandName() string {
+	return "audit"
+}
+
+func (c *AuditCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	return new(interface{}), db.audit(db.commit(context.CurrentIndex()), c.Action, c.Details, c.Timestamp)
+}
+
+// Audit events are written alongside regular events, so they're
+// replicated and stored the same way, but are only visible when
+// scanning the audit indexes.
+func (db *DB) audit(commit uint64, action string, details map[string]interface{}, timestamp int64) error {
+	body, err := json.Marshal(AuditEntry{action, details, timestamp})
+	if err != nil {
+		return err
+	}
+
+	indexes := map[string]string{
+		AUDIT_INDEX:        AUDIT_LOG,
+		AUDIT_ACTION_INDEX: action,
+	}
+
+	return db.writeInternal(commit, body, indexes)
+}
+
+// Writes an event the cluster records itself, without the checks and
+// accounting of those users write: it's never unique, deduplicated or
+// counted towards quotas, and doesn't count towards the most recent
+// timestamp or the stream's span.
+func (db *DB) writeInternal(commit uint64, body []byte, indexes map[string]string) error {
+	if commit <= db.current {
+		return nil
+	}
+
+	if db.stream == nil {
+		bytes, _ := stream.Serialize(body, indexes, map[string]int64{})
+		db.mockoffset += int64(len(bytes))
+		return nil
+	}
+
+	if err := db.finishRotation(); err != nil {
+		return err
+	}
+
+	var err error
+
+	timeStream(db.wtimer, db.current, func() {
+		err = db.writeEvent(body, indexes, nil)
+	})
+
+	if err == nil {
+		db.watch.Notify()
+	}
+
+	return err
+}
+
+// Scans the audit log, most recent first. If action
+// is given, only entries recording it are returned.
+func (db *DB) ScanAudit(action string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	if action == "" {
+		return db.Scan(AUDIT_INDEX, AUDIT_LOG, after, continuation, scanner)
+	}
+
+	return db.Scan(AUDIT_ACTION_INDEX, action, after, continuation, scanner)
+}
+
+func audited(e *stream.Event) bool {
+	return e.Indexed(AUDIT_INDEX, AUDIT_LOG)
+}
+
+func reserved(indexes map[string]string) bool {
+	for name := range indexes {
+		if strings.HasPrefix(name, AUDIT_INDEX) || name == TIMESTAMP_INDEX || name == stream.GROUPING_INDEX {
+			return true
+		}
+	}
+
+	return false
+}
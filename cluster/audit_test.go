@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("a"), map[string]string{"a": "b"})
+		trackevent(n, []byte("b"), map[string]string{"a": "b"})
+
+		if err := n.Audit("key", map[string]interface{}{"id": "1"}); err != nil {
+			t.Errorf("Unexpected error recording audit event: %v", err)
+		}
+
+		if err := n.Event([]byte("c"), "", map[string]string{AUDIT_INDEX: AUDIT_LOG}); err != RESERVED_INDEX {
+			t.Errorf("Expected reserved index error, found: %v", err)
+		}
+
+		// Groupings are only given as the event's grouping.
+		if err := n.Event([]byte("c"), "", map[string]string{stream.GROUPING_INDEX: "g"}); err != RESERVED_INDEX {
+			t.Errorf("Expected reserved index error for the grouping index, found: %v", err)
+		}
+
+		actions := make([]string, 0)
+
+		n.db.ScanAudit("", 0, "", func(e *stream.Event) bool {
+			var entry AuditEntry
+			json.Unmarshal(e.Data, &entry)
+			actions = append(actions, entry.Action)
+			return true
+		})
+
+		if !reflect.DeepEqual(actions, []string{"key", AUDIT_ROTATE, AUDIT_ROTATE}) {
+			t.Errorf("Incorrect audit results. Wanted: %v, found: %v", []string{"key", AUDIT_ROTATE, AUDIT_ROTATE}, actions)
+		}
+
+		found := make([]string, 0)
+
+		n.db.Iterate(0, "", func(e *stream.Event) bool {
+			found = append(found, string(e.Data))
+			return true
+		})
+
+		if !reflect.DeepEqual(found, []string{"a", "b"}) {
+			t.Errorf("Audit events should be hidden when iterating. Wanted: %v, found: %v", []string{"a", "b"}, found)
+		}
+	})
+}
+
+func TestAuditEventsSkipUsersChecks(t *testing.T) {
+	db := createDb()
+	db.quotas, _ = NewQuotas([]Quota{{Prefix: "", TotalBytes: 1}})
+
+	db.Rotate(1, 1)
+
+	if err := db.audit(2, AUDIT_JOIN, map[string]interface{}{"name": "a"}, 10); err != nil {
+		t.Fatalf("Unexpected error recording audit event: %v", err)
+	}
+
+	if used := db.quotas.Usage()[0].TotalUsed; used != 0 {
+		t.Errorf("Expected audit events not to count towards quotas, found: %v", used)
+	}
+
+	if db.MostRecent != 0 || !db.span.empty() {
+		t.Errorf("Expected audit events not to count towards the most recent timestamp, found: %v %+v", db.MostRecent, db.span)
+	}
+
+	var found int
+
+	db.ScanAudit(AUDIT_JOIN, 0, "", func(e *stream.Event) bool {
+		found++
+		return true
+	})
+
+	if found != 1 {
+		t.Errorf("Expected the audit event to be written, found: %v", found)
+	}
+}
+
+func TestRotatingFullStreams(t *testing.T) {
+	db := createDb()
+	db.RotateThreshold = 30
+	db.Rotate(1, 1)
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 10)
+	db.rotateIfFull(2, 1, 10)
+
+	if db.current != 1 {
+		t.Fatalf("Expected a stream under the threshold to stay open, found: %v", db.current)
+	}
+
+	db.Write(3, bytes.Repeat([]byte("b"), 40), "", map[string]string{"a": "1"}, 20)
+	db.rotateIfFull(3, 1, 20)
+
+	if db.current != 3 || !reflect.DeepEqual(db.closed, []uint64{1}) {
+		t.Fatalf("Expected the full stream to be closed, found: %v %v", db.current, db.closed)
+	}
+
+	var found []string
+
+	db.ScanAudit(AUDIT_ROTATE, 0, "", func(e *stream.Event) bool {
+		found = append(found, string(e.Data))
+		return true
+	})
+
+	if len(found) != 1 {
+		t.Errorf("Expected the rotation to be audited, found: %v", found)
+	}
+}
@@ -0,0 +1,226 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	READ  = "read"
+	WRITE = "write"
+	ADMIN = "admin"
+
+	// Header carrying the API key of each request.
+	API_KEY_HEADER = "Api-Key"
+)
+
+var UNAUTHENTICATED = errors.New("Missing or unknown API key")
+var FORBIDDEN = errors.New("API key not permitted to perform this request")
+var UNKNOWN_ROLE = errors.New("API key mapped to unknown role")
+var UNKNOWN_OPERATION = errors.New("Unknown operation")
+
+// Role describes what a set of API keys are allowed to do. A role can
+// be limited to certain index names, and to index values beginning with
+// one of the given prefixes. Leaving either empty allows any.
+type Role struct {
+	Operations []string `json:"operations"`
+	Indexes    []string `json:"indexes"`
+	Prefixes   []string `json:"prefixes"`
+}
+
+// Authorizer maps API keys onto roles. A nil Authorizer permits
+// every request, so authorization is only enforced once configured.
+type Authorizer struct {
+	Roles map[string]*Role  `json:"roles"`
+	Keys  map[string]string `json:"keys"`
+}
+
+// Reads a JSON authorization configuration from the given path,
+// which has the following format:
+//
+//	{
+//	  "roles": {
+//	    "ops": { "operations": ["admin"] },
+//	    "acme": { "operations": ["read", "write"], "indexes": ["customer"], "prefixes": ["acme-"] }
+//	  },
+//	  "keys": { "secret-key": "ops", "other-key": "acme" }
+//	}
+func LoadAuthorizer(path string) (*Authorizer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var a Authorizer
+
+	if err = json.Unmarshal(b, &a); err != nil {
+		return nil, err
+	}
+
+	for _, name := range a.Keys {
+		if a.Roles[name] == nil {
+			return nil, errors.New(UNKNOWN_ROLE.Error() + ": " + name)
+		}
+	}
+
+	for _, role := range a.Roles {
+		for _, op := range role.Operations {
+			if op != READ && op != WRITE && op != ADMIN {
+				return nil, errors.New(UNKNOWN_OPERATION.Error() + ": " + op)
+			}
+		}
+	}
+
+	return &a, nil
+}
+
+// Finds the role for the request's API key, returning an error
+// if there is none, or it isn't allowed to perform the operation.
+func (a *Authorizer) Role(req *http.Request, op string) (*Role, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	return a.keyRole(requestKey(req), op)
+}
+
+// The request's API key, from API_KEY_HEADER, or for clients which
+// only speak standard auth, a bearer token or basic auth's password.
+func requestKey(req *http.Request) string {
+	if key := req.Header.Get(API_KEY_HEADER); key != "" {
+		return key
+	}
+
+	if _, password, ok := req.BasicAuth(); ok {
+		return password
+	}
+
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(auth[len("Bearer "):])
+	}
+
+	return ""
+}
+
+// Finds the role for the API key, as Role does for a request's.
+func (a *Authorizer) keyRole(key, op string) (*Role, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	if key == "" {
+		return nil, UNAUTHENTICATED
+	}
+
+	name, ok := a.Keys[key]
+	if !ok {
+		return nil, UNAUTHENTICATED
+	}
+
+	role := a.Roles[name]
+
+	if !role.Can(op) {
+		return nil, FORBIDDEN
+	}
+
+	return role, nil
+}
+
+// Checks the request may perform the operation, responding with
+// a 401 or 403 and returning false if it may not.
+func (a *Authorizer) Authorize(w http.ResponseWriter, req *http.Request, op string) (*Role, bool) {
+	role, err := a.Role(req, op)
+	if err != nil {
+		Deny(w, err)
+		return nil, false
+	}
+
+	return role, true
+}
+
+// Responds to a request which failed authorization.
+func Deny(w http.ResponseWriter, err error) {
+	if err == UNAUTHENTICATED {
+		w.Header().Set("WWW-Authenticate", `Basic realm="esdb"`)
+	}
+
+	respond(w, Fail(w, err))
+}
+
+// Admins can perform any operation.
+func (r *Role) Can(op string) bool {
+	for _, allowed := range r.Operations {
+		if allowed == op || allowed == ADMIN {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether the role has access to the given index value. An empty
+// index refers to every event, so requires an unrestricted role.
+// The audit log is only visible to admins.
+func (r *Role) Allows(index, value string) bool {
+	if r == nil {
+		return true
+	}
+
+	if strings.HasPrefix(index, AUDIT_INDEX) {
+		return r.Can(ADMIN)
+	}
+
+	if index == "" {
+		return len(r.Indexes) == 0 && len(r.Prefixes) == 0
+	}
+
+	return r.allowsIndex(index) && r.allowsValue(value)
+}
+
+// Whether the role has access to every one of the given index values.
+// Events without any are only allowed unrestricted roles, as Allows
+// does for an empty index.
+func (r *Role) AllowsAll(indexes map[string]string) bool {
+	if len(indexes) == 0 {
+		return r.Allows("", "")
+	}
+
+	for index, value := range indexes {
+		if !r.Allows(index, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Role) allowsIndex(index string) bool {
+	if len(r.Indexes) == 0 {
+		return true
+	}
+
+	for _, name := range r.Indexes {
+		if name == index {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Role) allowsValue(value string) bool {
+	if len(r.Prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range r.Prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,188 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func authRequest(key string) *http.Request {
+	req, _ := http.NewRequest("GET", "/events", nil)
+	if key != "" {
+		req.Header.Set(API_KEY_HEADER, key)
+	}
+	return req
+}
+
+func TestAuthorizerRoles(t *testing.T) {
+	a := &Authorizer{
+		Roles: map[string]*Role{
+			"ops":    &Role{Operations: []string{ADMIN}},
+			"reader": &Role{Operations: []string{READ}},
+		},
+		Keys: map[string]string{
+			"ops-key":    "ops",
+			"reader-key": "reader",
+		},
+	}
+
+	tests := []struct {
+		key  string
+		op   string
+		code int
+	}{
+		{"", READ, 401},
+		{"unknown", READ, 401},
+		{"reader-key", READ, 200},
+		{"reader-key", WRITE, 403},
+		{"reader-key", ADMIN, 403},
+		{"ops-key", READ, 200},
+		{"ops-key", WRITE, 200},
+		{"ops-key", ADMIN, 200},
+	}
+
+	for i, test := range tests {
+		w := httptest.NewRecorder()
+
+		_, ok := a.Authorize(w, authRequest(test.key), test.op)
+
+		if ok != (test.code == 200) || w.Code != test.code {
+			t.Errorf("Case #%v: Wanted: %v, found: %v (authorized: %v)", i, test.code, w.Code, ok)
+		}
+	}
+}
+
+func TestNilAuthorizerAllowsEverything(t *testing.T) {
+	var a *Authorizer
+
+	role, ok := a.Authorize(httptest.NewRecorder(), authRequest(""), ADMIN)
+
+	if !ok || !role.Allows("", "") {
+		t.Errorf("Nil authorizer should allow every request")
+	}
+}
+
+func TestRoleIndexRestrictions(t *testing.T) {
+	role := &Role{
+		Operations: []string{READ},
+		Indexes:    []string{"customer"},
+		Prefixes:   []string{"acme-"},
+	}
+
+	tests := []struct {
+		index   string
+		value   string
+		allowed bool
+	}{
+		{"customer", "acme-1", true},
+		{"customer", "other-1", false},
+		{"type", "acme-1", false},
+		{"", "", false},
+	}
+
+	for i, test := range tests {
+		if allowed := role.Allows(test.index, test.value); allowed != test.allowed {
+			t.Errorf("Case #%v: Wanted: %v, found: %v", i, test.allowed, allowed)
+		}
+	}
+
+	if role.AllowsAll(map[string]string{"customer": "acme-1", "type": "order"}) {
+		t.Errorf("Role should not allow writing to unlisted indexes")
+	}
+
+	if role.AllowsAll(map[string]string{}) || !(&Role{}).AllowsAll(map[string]string{}) {
+		t.Errorf("Only unrestricted roles should allow events without indexes")
+	}
+}
+
+func TestAuthorizerStandardAuth(t *testing.T) {
+	a := &Authorizer{
+		Roles: map[string]*Role{"reader": &Role{Operations: []string{READ}}},
+		Keys:  map[string]string{"reader-key": "reader"},
+	}
+
+	basic := authRequest("")
+	basic.SetBasicAuth("anyone", "reader-key")
+
+	bearer := authRequest("")
+	bearer.Header.Set("Authorization", "Bearer reader-key")
+
+	for i, req := range []*http.Request{basic, bearer} {
+		if _, ok := a.Authorize(httptest.NewRecorder(), req, READ); !ok {
+			t.Errorf("Case #%v: Expected the key to be accepted", i)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	a.Authorize(w, authRequest(""), READ)
+
+	if w.Code != 401 || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected a basic auth challenge, found: %v %v", w.Code, w.Header())
+	}
+}
+
+func TestUnauthorizedEventRequestsOnlyReportTheError(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetAuthorizer(&Authorizer{Roles: map[string]*Role{}, Keys: map[string]string{}}, "")
+
+		for _, method := range []string{"GET", "POST"} {
+			req := httptest.NewRequest(method, "/events", nil)
+			w := httptest.NewRecorder()
+
+			n.eventHandler(w, req)
+
+			var res map[string]interface{}
+
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != 401 || res["code"] != "unauthenticated" {
+				t.Errorf("%v: Expected only the error to be written, found: %v %q", method, w.Code, w.Body)
+			}
+		}
+	})
+}
+
+func TestRPCsNeedAnAdminKey(t *testing.T) {
+	n := &Node{}
+
+	served := n.peersOrAdmins(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	w := httptest.NewRecorder()
+	served(w, authRequest(""))
+
+	if w.Code != 200 {
+		t.Errorf("Expected RPCs to be served without an authorizer, found: %v", w.Code)
+	}
+
+	n.auth = &Authorizer{
+		Roles: map[string]*Role{"ops": {Operations: []string{ADMIN}}, "reader": {Operations: []string{READ}}},
+		Keys:  map[string]string{"ops-key": "ops", "reader-key": "reader"},
+	}
+
+	for key, code := range map[string]int{"": 401, "reader-key": 403, "ops-key": 200} {
+		w := httptest.NewRecorder()
+		served(w, authRequest(key))
+
+		if w.Code != code {
+			t.Errorf("%q: Wanted: %v, found: %v", key, code, w.Code)
+		}
+	}
+
+	// Peers send their key with the handshake.
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go dialHTTP(client, "ops-key")
+
+	req, err := http.ReadRequest(bufio.NewReader(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Method != "CONNECT" || requestKey(req) != "ops-key" {
+		t.Errorf("Expected the key with the RPC handshake, found: %v %v", req.Method, req.Header)
+	}
+}
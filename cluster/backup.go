@@ -0,0 +1,165 @@
+package cluster
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Names of the entries in a backup other than its stream files.
+const (
+	BACKUP_MANIFEST = "manifest.json"
+	BACKUP_SNAPSHOT = "snapshot"
+)
+
+// Describes what a backup holds: the DB's metadata, as a replica's
+// manifest does, and how much of the open stream it holds. Streams
+// are named as in the data directory. See RestoreBackup.
+type BackupManifest struct {
+	Metadata Metadata  `json:"metadata"`
+	Offset   int64     `json:"offset"`
+	Created  time.Time `json:"created"`
+}
+
+// Writes a tar of the DB as it is now: a manifest, the metadata saved
+// in raft snapshots, every closed stream, fetching any missing from
+// peers, and the open stream up to its current offset. Writes continue
+// while the streams are copied, and aren't included.
+func (db *DB) Backup(w io.Writer) error {
+	db.refreshReader()
+
+	manifest, snapshot, err := db.backupState()
+	if err != nil {
+		return err
+	}
+
+	// Opened before anything's written, so streams compressed or
+	// removed while copying are still read as they were.
+	files := make([]*os.File, 0, len(manifest.Metadata.Closed))
+
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, commit := range manifest.Metadata.Closed {
+		f, err := db.openClosed(commit)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, f)
+	}
+
+	var open *os.File
+
+	if manifest.Offset > 0 {
+		if open, err = os.Open(db.reader.Path(manifest.Metadata.Current)); err != nil {
+			return err
+		}
+
+		defer open.Close()
+	}
+
+	tw := tar.NewWriter(w)
+
+	js, _ := json.MarshalIndent(manifest, "", "  ")
+
+	if err = writeBackupEntry(tw, BACKUP_MANIFEST, int64(len(js)), manifest.Created, bytes.NewReader(js)); err != nil {
+		return err
+	}
+
+	if err = writeBackupEntry(tw, BACKUP_SNAPSHOT, int64(len(snapshot)), manifest.Created, bytes.NewReader(snapshot)); err != nil {
+		return err
+	}
+
+	for i, f := range files {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Base(db.reader.Path(manifest.Metadata.Closed[i]))
+
+		if err = writeBackupEntry(tw, name, info.Size(), info.ModTime(), f); err != nil {
+			return err
+		}
+	}
+
+	if manifest.Offset > 0 {
+		// Only events before the offset are read, which aren't written to again.
+		events := io.NewSectionReader(open, 0, manifest.Offset)
+		name := filepath.Base(db.reader.Path(manifest.Metadata.Current))
+
+		if err = writeBackupEntry(tw, name, manifest.Offset, manifest.Created, events); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// Captures the DB's state, retrying if a stream's rotated meanwhile,
+// so the manifest, snapshot and open stream's offset agree.
+func (db *DB) backupState() (*BackupManifest, []byte, error) {
+	for {
+		manifest := &BackupManifest{
+			Metadata: db.metadata(),
+			Created:  time.Now().UTC(),
+		}
+
+		// Closed streams are appended to in place.
+		manifest.Metadata.Closed = append([]uint64{}, manifest.Metadata.Closed...)
+
+		s := db.stream
+
+		if s != nil && !s.Closed() {
+			manifest.Offset = s.Offset()
+		}
+
+		snapshot, err := db.Save()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if db.current == manifest.Metadata.Current && db.stream == s {
+			return manifest, snapshot, nil
+		}
+	}
+}
+
+// Opens the closed stream's file, fetching it from peers if missing.
+func (db *DB) openClosed(commit uint64) (*os.File, error) {
+	if _, err := db.reader.retrieveStream(commit, true); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(db.reader.Path(commit))
+
+	// Compressed streams are read where they're written until renamed.
+	if os.IsNotExist(err) {
+		f, err = os.Open(db.reader.compressedpath(commit))
+	}
+
+	return f, err
+}
+
+func writeBackupEntry(tw *tar.Writer, name string, size int64, modified time.Time, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modified,
+	})
+
+	if err == nil {
+		_, err = io.CopyN(tw, r, size)
+	}
+
+	return err
+}
@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	db := createDb()
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 10)
+	db.Rotate(3, 1)
+	db.Write(4, []byte("b"), "", map[string]string{"a": "1"}, 20)
+
+	buf := new(bytes.Buffer)
+
+	if err := db.Backup(buf); err != nil {
+		t.Fatalf("Unable to back up: %v", err)
+	}
+
+	// Written after the backup, so not included.
+	db.Write(5, []byte("c"), "", map[string]string{"a": "1"}, 30)
+
+	os.MkdirAll("tmp/restored", 0755)
+
+	names := make([]string, 0)
+	entries := make(map[string][]byte)
+	r := tar.NewReader(buf)
+
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unable to read backup: %v", err)
+		}
+
+		b, _ := io.ReadAll(r)
+		names = append(names, header.Name)
+		entries[header.Name] = b
+	}
+
+	closed, open := filepath.Base(db.reader.Path(1)), filepath.Base(db.reader.Path(3))
+
+	if wanted := []string{BACKUP_MANIFEST, BACKUP_SNAPSHOT, closed, open}; !reflect.DeepEqual(names, wanted) {
+		t.Fatalf("Wanted entries: %v, found: %v", wanted, names)
+	}
+
+	var manifest BackupManifest
+	json.Unmarshal(entries[BACKUP_MANIFEST], &manifest)
+
+	if meta := manifest.Metadata; meta.Current != 3 || !reflect.DeepEqual(meta.Closed, []uint64{1}) || meta.MostRecent != 20 {
+		t.Errorf("Incorrect manifest: %+v", manifest)
+	}
+
+	restored, _ := NewDb("tmp/restored")
+
+	if err := restored.Recovery(entries[BACKUP_SNAPSHOT]); err != nil || restored.current != 3 {
+		t.Errorf("Wanted the snapshot to recover, found: %v %v", restored.current, err)
+	}
+
+	for name, wanted := range map[string][]string{closed: {"a"}, open: {"b"}} {
+		path := filepath.Join("tmp", "restored", "copy."+name)
+		os.WriteFile(path, entries[name], 0644)
+
+		s, err := stream.Open(path)
+		if err != nil {
+			t.Fatalf("Unable to open %v: %v", name, err)
+		}
+
+		found := make([]string, 0)
+
+		s.Iterate(0, func(e *stream.Event) bool {
+			found = append(found, string(e.Data))
+			return true
+		})
+
+		if !reflect.DeepEqual(found, wanted) {
+			t.Errorf("%v: Wanted: %v, found: %v", name, wanted, found)
+		}
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	db := createDb()
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 10)
+	db.Rotate(3, 1)
+	db.Write(4, []byte("b"), "", map[string]string{"a": "1"}, 20)
+
+	buf := new(bytes.Buffer)
+	db.Backup(buf)
+
+	backup := buf.Bytes()
+
+	manifest, err := RestoreBackup(bytes.NewReader(backup), "tmp/restored")
+	if err != nil {
+		t.Fatalf("Unable to restore: %v", err)
+	}
+
+	replica, err := ReadManifest("tmp/restored")
+	if err != nil || !reflect.DeepEqual(replica.Metadata.Closed, []uint64{1, 3}) || replica.Metadata.Current != manifest.Metadata.Current {
+		t.Fatalf("Wanted a replica manifest of both streams, found: %+v %v", replica, err)
+	}
+
+	reader := NewReader("tmp/restored/stream")
+
+	for commit, wanted := range map[uint64]string{1: "a", 3: "b"} {
+		s, err := stream.Open(reader.Path(commit))
+		if err != nil || !s.Closed() {
+			t.Fatalf("Wanted stream %v to be closed, found: %v", commit, err)
+		}
+
+		found := make([]string, 0)
+
+		s.ScanIndex("a", "1", 0, func(e *stream.Event) bool {
+			found = append(found, string(e.Data))
+			return true
+		})
+
+		if !reflect.DeepEqual(found, []string{wanted}) {
+			t.Errorf("Stream %v: Wanted: [%v], found: %v", commit, wanted, found)
+		}
+	}
+
+	if _, err := RestoreBackup(bytes.NewReader(backup), "tmp/restored"); err != RESTORING_OVER_DATA {
+		t.Errorf("Wanted: %v, found: %v", RESTORING_OVER_DATA, err)
+	}
+
+	if _, err := RestoreBackup(bytes.NewReader(nil), "tmp/empty"); err != NOT_A_BACKUP {
+		t.Errorf("Wanted: %v, found: %v", NOT_A_BACKUP, err)
+	}
+}
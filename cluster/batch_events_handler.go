@@ -0,0 +1,97 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+const MAX_BATCH_QUERIES = 50
+
+// Runs several scans at once, so dashboards can fetch many
+// results in a single round trip. The batch's limit applies
+// to every query which doesn't set its own.
+func (n *Node) batchEventsHandler(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	role, ok := n.auth.Authorize(w, req, READ)
+	if !ok {
+		return
+	}
+
+	if req.Method != "POST" {
+		w.WriteHeader(404)
+		return
+	}
+
+	var b BatchRequest
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &b)
+	}
+
+	if err != nil {
+		respond(w, Fail(w, MALFORMED_BODY))
+		return
+	}
+
+	if len(b.Queries) > MAX_BATCH_QUERIES {
+		respond(w, Fail(w, TOO_MANY_QUERIES))
+		return
+	}
+
+	ctx, cancel := QueryContext(req)
+	defer cancel()
+
+	results := make([]BatchResult, len(b.Queries))
+
+	var wg sync.WaitGroup
+
+	for i, q := range b.Queries {
+		if q.Limit == 0 {
+			q.Limit = b.Limit
+		}
+
+		wg.Add(1)
+
+		go func(i int, q Query) {
+			defer wg.Done()
+			results[i] = n.batchQuery(ctx, role, q)
+		}(i, q)
+	}
+
+	wg.Wait()
+
+	js, _ := json.MarshalIndent(BatchResponse{results, n.db.MostRecent}, "", "  ")
+
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
+
+func (n *Node) batchQuery(ctx context.Context, role *Role, q Query) BatchResult {
+	if !q.AllowedBy(role) {
+		return (*ScanResponse)(nil).WithError(FORBIDDEN)
+	}
+
+	events, headers, continuation, _, err := q.page(ctx, n.db)
+
+	res := &ScanResponse{
+		Events:       events,
+		Continuation: continuation,
+		MostRecent:   n.db.MostRecent,
+		Headers:      headers,
+	}
+
+	paginate(res, q.versionedUrl(ctx), continuation, q.limit(), len(events), q.forward())
+	Truncated(res, events, continuation, q.MaxBytes)
+	Partial(res, ctx)
+
+	if err != nil {
+		return res.WithError(err)
+	}
+
+	return BatchResult{ScanResponse: res}
+}
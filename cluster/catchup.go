@@ -0,0 +1,133 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Most closed streams fetched at once while catching up.
+const CATCH_UP_CONCURRENCY = 4
+
+var CATCHING_UP = errors.New("Fetching closed streams missed while down")
+
+// Fetches every closed stream placed on this node which the cluster
+// has and it doesn't, several at once, before the node reports itself
+// healthy. Without this, a node which was down through many rotations
+// only finds each stream it missed when it's scanned.
+func (n *Node) catchUp(join string) error {
+	self := n.State().Uri
+
+	peers := n.db.peerConnectionStrings()
+	if join != "" {
+		peers = append(peers, n.scheme()+"://"+join)
+	}
+
+	if len(peers) == 0 {
+		return nil
+	}
+
+	meta, from, err := clusterMetadata(n.db.reader.router, n.db.reader.apiKey, n.tls, peers)
+	if err != nil {
+		return err
+	}
+
+	sources := []string{from}
+
+	for _, peer := range meta.Peers {
+		if peer != self && peer != from {
+			sources = append(sources, peer)
+		}
+	}
+
+	missing := make([]uint64, 0)
+
+	for _, commit := range meta.Closed {
+		if _, err := os.Stat(n.db.reader.Path(commit)); os.IsNotExist(err) && n.db.keeps(commit) {
+			missing = append(missing, commit)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	n.db.logger.Println("CATCH UP: Fetching", len(missing), "closed streams from", sources)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+
+	failed := make([]uint64, 0)
+	slots := make(chan struct{}, CATCH_UP_CONCURRENCY)
+
+	for _, commit := range missing {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(commit uint64) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := n.db.reader.fetchStream(sources, commit); err != nil {
+				mutex.Lock()
+				failed = append(failed, commit)
+				mutex.Unlock()
+			}
+		}(commit)
+	}
+
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%v: %v", MISSING_STREAMS, failed)
+	}
+
+	n.db.logger.Println("CATCH UP: Fetched", len(missing), "closed streams")
+
+	return nil
+}
+
+// Fetches the cluster's stream metadata from the first peer
+// which responds, returning which it was.
+func clusterMetadata(router *Router, key string, config *tls.Config, peers []string) (*Metadata, string, error) {
+	var err error
+
+	policy := DefaultRetryPolicy
+	policy.TLS = config
+
+	for _, peer := range router.Order(peers) {
+		c := NewLocalClient(peer, 1)
+		c.ApiKey = key
+		c.SetRetryPolicy(policy)
+
+		var meta *Metadata
+
+		if meta, err = c.StreamsMetadata(); err == nil {
+			return meta, peer, nil
+		}
+	}
+
+	return nil, "", err
+}
+
+// Catches up in the background, reporting the node as unhealthy until
+// it's finished, and degraded if any streams couldn't be fetched.
+func (n *Node) startCatchUp(join string) {
+	atomic.StoreInt32(&n.catchingUp, 1)
+
+	go func() {
+		defer atomic.StoreInt32(&n.catchingUp, 0)
+
+		n.db.supervisor.Run("catchup", func() error {
+			return n.catchUp(join)
+		})
+	}()
+}
+
+// Whether the node is still fetching streams it missed while down.
+func (n *Node) CatchingUp() bool {
+	return atomic.LoadInt32(&n.catchingUp) == 1
+}
@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCatchUp(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(30)
+
+		for _, body := range []string{"a", "b", "c"} {
+			trackevent(n, []byte(body), map[string]string{"a": "b"})
+		}
+
+		if len(n.db.closed) == 0 {
+			t.Fatalf("Expected a closed stream")
+		}
+
+		commit := n.db.closed[len(n.db.closed)-1]
+		path := n.db.reader.Path(commit)
+		data, _ := ioutil.ReadFile(path)
+
+		n.db.refreshReader()
+		os.Remove(path)
+
+		peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/events/meta":
+				js, _ := json.Marshal(Metadata{Closed: []uint64{commit}})
+				w.Write(js)
+			case "/stream/" + filepath.Base(path):
+				w.Write(data)
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+
+		defer peer.Close()
+
+		n.raft.AddPeer("peer", peer.URL)
+
+		if err := n.catchUp(""); err != nil {
+			t.Errorf("Expected catching up to succeed, found: %v", err)
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected stream to be fetched, found: %v", err)
+		}
+
+		// Streams placed elsewhere aren't fetched.
+		os.Remove(path)
+		n.db.placement = Placement{commit: {"peer"}}
+
+		if err := n.catchUp(""); err != nil {
+			t.Errorf("Expected catching up to succeed, found: %v", err)
+		}
+
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected stream not to be fetched, found: %v", err)
+		}
+
+		n.catchingUp = 1
+
+		if err := n.health(); err != CATCHING_UP {
+			t.Errorf("Expected to be catching up, found: %v", err)
+		}
+
+		n.catchingUp = 0
+	})
+}
@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,16 +15,23 @@ import (
 	"time"
 )
 
+// Client writes to the cluster's leader. Applications should use the
+// client package, which also discovers the leader, and scans.
 type Client struct {
 	Nodes  []string
 	Leader string
+	Retry  RetryPolicy
+	ApiKey string
 	conns  pool
 	quit   bool
 	client *http.Client
+	writes *writeQueue
 }
 
 type LocalClient struct {
 	Node   string
+	Retry  RetryPolicy
+	ApiKey string
 	conns  pool
 	client *http.Client
 }
@@ -59,10 +67,15 @@ func NewClient(node string, concurrency int) *Client {
 	c := &Client{
 		Nodes:  []string{node},
 		Leader: node,
+		Retry:  DefaultRetryPolicy,
 		conns:  newPool(concurrency),
-		client: &http.Client{Timeout: 30 * time.Second},
+		client: DefaultRetryPolicy.httpClient(),
 	}
 
+	c.writes = newWriteQueue(func(contents [][]byte, groupings []string, indexes, _ []map[string]string, ids []string) (uint64, error) {
+		return c.writeEventsWithIds(contents, groupings, indexes, ids)
+	})
+
 	go (func() {
 		for {
 			if c.quit {
@@ -79,31 +92,34 @@ func NewClient(node string, concurrency int) *Client {
 }
 
 func NewLocalClient(node string, concurrency int) *LocalClient {
-	return &LocalClient{Node: node, conns: newPool(concurrency), client: &http.Client{Timeout: 30 * time.Second}}
+	return &LocalClient{
+		Node:   node,
+		Retry:  DefaultRetryPolicy,
+		conns:  newPool(concurrency),
+		client: DefaultRetryPolicy.httpClient(),
+	}
+}
+
+// Changes the retry policy used for all requests made by the client.
+func (c *Client) SetRetryPolicy(p RetryPolicy) {
+	c.Retry = p
+	c.client = p.httpClient()
+}
+
+// Changes the retry policy used for all requests made by the client.
+func (c *LocalClient) SetRetryPolicy(p RetryPolicy) {
+	c.Retry = p
+	c.client = p.httpClient()
 }
 
 func (c *LocalClient) StreamsMetadata() (*Metadata, error) {
 	c.conns.get()
 	defer c.conns.release()
 
-	resp, err := c.client.Get(c.Node + "/events/meta")
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
+	var meta Metadata
 
-	if resp.StatusCode != 200 {
-		return nil, parseError(resp.Body)
-	}
+	err := c.get(c.Node+"/events/meta", &meta)
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var meta Metadata
-	err = json.Unmarshal(body, &meta)
 	return &meta, err
 }
 
@@ -122,159 +138,261 @@ func (c *LocalClient) Offset(index, value string) (*Metadata, string, error) {
 	parameters.Add("value", value)
 	dest.RawQuery = parameters.Encode()
 
-	resp, err := c.client.Get(dest.String())
-	if err != nil {
-		return nil, "", err
-	}
+	var or OffsetResponse
 
-	defer resp.Body.Close()
+	err = c.get(dest.String(), &or)
 
-	if resp.StatusCode != 200 {
-		return nil, "", parseError(resp.Body)
-	}
+	return &or.Metadata, or.Continuation, err
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, "", err
-	}
+func (c *LocalClient) get(uri string, result interface{}) error {
+	return c.Retry.Do(func() error {
+		resp, err := send(c.client, c.ApiKey, "GET", uri, nil)
+		if err != nil {
+			return err
+		}
 
-	var or OffsetResponse
-	err = json.Unmarshal(body, &or)
-	return &or.Metadata, or.Continuation, err
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return retryable(resp.StatusCode, parseError(resp.Body))
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+
+		return permanent(json.Unmarshal(body, result))
+	})
 }
 
 func (c *Client) Compress(start, stop uint64) error {
 	c.conns.get()
 	defer c.conns.release()
 
-	reader := strings.NewReader("")
-	resp, err := c.client.Post(c.Leader+"/events/compress/"+strconv.FormatUint(start, 10)+"/"+strconv.FormatUint(stop, 10), "application/json", reader)
-
-	if err != nil {
-		if len(c.Nodes) == 1 && c.Nodes[0] == c.Leader {
-			return err
-		}
+	return c.post("/events/compress/"+strconv.FormatUint(start, 10)+"/"+strconv.FormatUint(stop, 10), []byte{})
+}
 
-		c.Leader = c.Nodes[rand.Intn(len(c.Nodes))]
-		fmt.Println("error when connecting to leader", err, "switching to", c.Leader)
-		return c.Compress(start, stop)
-	}
+// Deletes every event written so far with the given index value.
+func (c *Client) Delete(index, value string) error {
+	c.conns.get()
+	defer c.conns.release()
 
-	defer resp.Body.Close()
+	parameters := url.Values{}
+	parameters.Add("index", index)
+	parameters.Add("value", value)
 
-	leader := resp.Header.Get("Cluster-Leader")
+	return c.post("/events/delete?"+parameters.Encode(), []byte{})
+}
 
-	if resp.StatusCode == 400 && leader != "" {
-		c.Leader = leader
-		return c.Compress(start, stop)
-	}
+// Deletes the individual events, hiding them from scans immediately.
+func (c *Client) SoftDelete(events []EventId) error {
+	c.conns.get()
+	defer c.conns.release()
 
-	if resp.StatusCode != 200 {
-		return parseError(resp.Body)
-	}
+	body, _ := json.Marshal(events)
 
-	return nil
+	return c.post("/events/soft_delete", body)
 }
 
 func (c *Client) Event(content []byte, indexes map[string]string) error {
+	return c.EventWithGrouping(content, "", indexes)
+}
+
+// Writes the event within the grouping, which it can be scanned by.
+func (c *Client) EventWithGrouping(content []byte, grouping string, indexes map[string]string) error {
 	c.conns.get()
 	defer c.conns.release()
-	return c.event(content, indexes)
-}
 
-func (c *Client) event(content []byte, indexes map[string]string) error {
 	body, _ := json.Marshal(map[string]interface{}{
-		"body":    string(content),
-		"indexes": indexes,
+		"body":     string(content),
+		"grouping": grouping,
+		"indexes":  indexes,
 	})
 
-	reader := strings.NewReader(string(body))
-
-	resp, err := c.client.Post(c.Leader+"/events", "application/json", reader)
-	if err != nil {
-		if len(c.Nodes) == 1 && c.Nodes[0] == c.Leader {
-			return err
-		}
-
-		c.Leader = c.Nodes[rand.Intn(len(c.Nodes))]
-		fmt.Println("error when connecting to leader", err, "switching to", c.Leader)
-		return c.event(content, indexes)
-	}
-
-	defer resp.Body.Close()
+	return c.postResult("/events", body, nil, false)
+}
 
-	leader := resp.Header.Get("Cluster-Leader")
+func (c *Client) Events(contents [][]byte, indexes []map[string]string) error {
+	return c.EventsWithGroupings(contents, nil, indexes)
+}
 
-	if resp.StatusCode == 400 && leader != "" {
-		c.Leader = leader
-		return c.event(content, indexes)
-	}
+// Writes the events, each within its grouping, if given.
+func (c *Client) EventsWithGroupings(contents [][]byte, groupings []string, indexes []map[string]string) error {
+	_, err := c.writeEvents(contents, groupings, indexes)
+	return err
+}
 
-	if resp.StatusCode != 200 {
-		return parseError(resp.Body)
-	}
+// Writes the events as Events, dropping those with the id of an event
+// written recently. Retried whenever retrying may help if every event
+// has an id, as they can't be written twice, while writes without are
+// only retried if they weren't sent.
+func (c *Client) EventsWithIds(contents [][]byte, groupings []string, indexes []map[string]string, ids []string) error {
+	_, err := c.writeEventsWithIds(contents, groupings, indexes, ids)
+	return err
+}
 
-	return nil
+// Writes the events, returning the commit they were written at.
+func (c *Client) writeEvents(contents [][]byte, groupings []string, indexes []map[string]string) (uint64, error) {
+	return c.writeEventsWithIds(contents, groupings, indexes, nil)
 }
 
-func (c *Client) Events(contents [][]byte, indexes []map[string]string) error {
+func (c *Client) writeEventsWithIds(contents [][]byte, groupings []string, indexes []map[string]string, ids []string) (uint64, error) {
 	c.conns.get()
 	defer c.conns.release()
-	return c.events(contents, indexes)
-}
 
-func (c *Client) events(contents [][]byte, indexes []map[string]string) error {
 	m := make([]map[string]interface{}, len(contents))
+	idempotent := len(contents) > 0
 
 	for i, content := range contents {
 		m[i] = map[string]interface{}{
-			"body":    string(content),
-			"indexes": indexes[i],
+			"body":     string(content),
+			"grouping": groupingAt(groupings, i),
+			"indexes":  indexes[i],
+		}
+
+		if id := idAt(ids, i); id != "" {
+			m[i]["id"] = id
+		} else {
+			idempotent = false
 		}
 	}
 
 	body, _ := json.Marshal(m)
 
-	reader := strings.NewReader(string(body))
+	var res struct {
+		Commit uint64 `json:"commit"`
+	}
+
+	err := c.postResult("/events", body, &res, idempotent)
+
+	return res.Commit, err
+}
+
+// Posts to the current leader, following the cluster to a new
+// leader when redirected, and retrying according to the policy.
+func (c *Client) post(path string, body []byte) error {
+	return c.postResult(path, body, nil, true)
+}
+
+// Posts as post, decoding the response into res unless it's nil.
+// Unless the request is idempotent, it's only retried when it wasn't
+// sent, or when redirected to the leader, which refuses it unwritten.
+func (c *Client) postResult(path string, body []byte, res interface{}, idempotent bool) error {
+	return c.Retry.Do(func() error {
+		leader := c.Leader
+
+		resp, err := send(c.client, c.ApiKey, "POST", leader+path, body)
+		if err != nil {
+			if len(c.Nodes) > 1 || c.Nodes[0] != leader {
+				c.Leader = c.Nodes[rand.Intn(len(c.Nodes))]
+				fmt.Println("error when connecting to leader", err, "switching to", c.Leader)
+			}
+
+			if !idempotent && !Unsent(err) {
+				return permanent(err)
+			}
 
-	resp, err := c.client.Post(c.Leader+"/events", "application/json", reader)
-	if err != nil {
-		if len(c.Nodes) == 1 && c.Nodes[0] == c.Leader {
 			return err
 		}
 
-		c.Leader = c.Nodes[rand.Intn(len(c.Nodes))]
-		fmt.Println("error when connecting to leader", err, "switching to", c.Leader)
-		return c.events(contents, indexes)
-	}
+		defer resp.Body.Close()
 
-	defer resp.Body.Close()
+		if leader := resp.Header.Get("Cluster-Leader"); resp.StatusCode == 400 && leader != "" {
+			c.Leader = leader
+			return immediate(NOT_LEADER_ERROR)
+		}
+
+		if resp.StatusCode == 409 {
+			return permanent(parseConflict(resp.Body))
+		}
 
-	leader := resp.Header.Get("Cluster-Leader")
+		if resp.StatusCode != 200 {
+			if !idempotent {
+				return permanent(parseError(resp.Body))
+			}
+
+			return retryable(resp.StatusCode, parseError(resp.Body))
+		}
+
+		if res != nil {
+			return json.NewDecoder(resp.Body).Decode(res)
+		}
 
-	if resp.StatusCode == 400 && leader != "" {
-		c.Leader = leader
-		return c.events(contents, indexes)
+		return nil
+	})
+}
+
+// Sends a request, identifying the client by its API key if it has one.
+func send(client *http.Client, key, method, uri string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
 	}
 
-	if resp.StatusCode != 200 {
-		return parseError(resp.Body)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
 
-	return nil
+	if key != "" {
+		req.Header.Set(API_KEY_HEADER, key)
+	}
+
+	return client.Do(req)
 }
 
 func (c *Client) Close() {
 	c.quit = true
 }
 
+// Server errors may be transient, anything else is down to the
+// request and won't change, unless the error says otherwise.
+func retryable(status int, err error) error {
+	if e, ok := err.(*APIError); ok {
+		if e.Retryable {
+			return err
+		}
+
+		return permanent(err)
+	}
+
+	if status >= 500 {
+		return err
+	}
+
+	return permanent(err)
+}
+
+// Parses the error the response reports, as an *APIError if it has a code.
 func parseError(body io.Reader) error {
+	var res struct {
+		Error     string `json:"error"`
+		Code      string `json:"code"`
+		Retryable bool   `json:"retryable"`
+	}
+
 	b, _ := ioutil.ReadAll(body)
+	if err := json.Unmarshal(b, &res); err == nil && res.Code != "" {
+		return &APIError{res.Code, res.Error, res.Retryable}
+	}
+
 	return errors.New("Bad response from log: " + string(b))
 }
 
+func parseConflict(body io.Reader) error {
+	var conflict UniqueConflictError
+
+	b, _ := ioutil.ReadAll(body)
+	if err := json.Unmarshal(b, &conflict); err != nil {
+		return errors.New("Bad response from log: " + string(b))
+	}
+
+	return &conflict
+}
+
 func (c *Client) refreshNodes() error {
-	resp, err := c.client.Get(c.Nodes[0] + "/cluster/status")
+	resp, err := send(c.client, c.ApiKey, "GET", c.Nodes[0]+"/cluster/status", nil)
 	if err != nil {
 		return err
 	}
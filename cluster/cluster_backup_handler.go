@@ -0,0 +1,29 @@
+package cluster
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// GET responds with a tar backup of the node's streams and metadata.
+// See DB.Backup. Failures once the backup's begun can only be logged,
+// and cut the response short.
+func (n *Node) clusterBackupHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body.Close()
+
+	if _, ok := n.auth.Authorize(w, req, ADMIN); !ok {
+		return
+	}
+
+	if req.Method != "GET" {
+		w.WriteHeader(404)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", n.name+".tar"))
+
+	if err := n.db.Backup(w); err != nil {
+		n.db.logger.Println("BACKUP: Failed:", err)
+	}
+}
@@ -0,0 +1,28 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// POST starts draining the node, GET reports its progress.
+func (n *Node) clusterDrainHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body.Close()
+
+	if _, ok := n.auth.Authorize(w, req, ADMIN); !ok {
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+	case "POST":
+		n.Drain()
+	default:
+		w.WriteHeader(404)
+		return
+	}
+
+	js, _ := json.MarshalIndent(n.DrainStatus(), "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,29 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// GET reports each quota's limits, how much of them has been used and
+// how many writes they've refused. Rates and daily bytes are only
+// counted by the leader.
+func (n *Node) clusterQuotasHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body.Close()
+
+	if _, ok := n.auth.Authorize(w, req, ADMIN); !ok {
+		return
+	}
+
+	if req.Method != "GET" {
+		w.WriteHeader(404)
+		return
+	}
+
+	js, _ := json.MarshalIndent(map[string]interface{}{
+		"quotas": n.db.quotas.Usage(),
+	}, "", "  ")
+
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,45 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// GET reports whether the node and cluster are read-only. POST with
+// enabled=true|false switches the whole cluster, or just this node
+// when scope=node.
+func (n *Node) clusterReadOnlyHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body.Close()
+
+	if _, ok := n.auth.Authorize(w, req, ADMIN); !ok {
+		return
+	}
+
+	body := make(map[string]interface{})
+
+	switch req.Method {
+	case "GET":
+	case "POST":
+		readonly := req.FormValue("enabled") != "false"
+
+		if req.FormValue("scope") == "node" {
+			n.SetReadOnly(readonly)
+		} else if err := n.SetClusterReadOnly(readonly); err == NOT_LEADER_ERROR {
+			respond(w, n.notLeader(w))
+			return
+		} else if err != nil {
+			body = Fail(w, err)
+		}
+	default:
+		w.WriteHeader(404)
+		return
+	}
+
+	body["node"] = atomic.LoadInt32(&n.readonly) == 1
+	body["cluster"] = n.db.ReadOnly()
+
+	js, _ := json.MarshalIndent(body, "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
@@ -7,6 +7,10 @@ import (
 )
 
 func (n *Node) clusterRemoveHandler(w http.ResponseWriter, req *http.Request) {
+	if _, ok := n.auth.Authorize(w, req, ADMIN); !ok {
+		return
+	}
+
 	name := strings.Replace(req.URL.Path, "/cluster/remove/", "", 1)
 
 	err := n.RemoveFromCluster(name)
@@ -14,8 +18,7 @@ func (n *Node) clusterRemoveHandler(w http.ResponseWriter, req *http.Request) {
 	body := make(map[string]interface{})
 
 	if err != nil {
-		body["error"] = err.Error()
-		w.WriteHeader(500)
+		body = Fail(w, err)
 	} else {
 		body["status"] = "Node removed."
 	}
@@ -0,0 +1,35 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// POST has every node take a raft snapshot, GET reports this node's
+// most recent one.
+func (n *Node) clusterSnapshotHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body.Close()
+
+	if _, ok := n.auth.Authorize(w, req, ADMIN); !ok {
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+	case "POST":
+		if err := n.TakeSnapshot(); err == NOT_LEADER_ERROR {
+			respond(w, n.notLeader(w))
+			return
+		} else if err != nil {
+			respond(w, Fail(w, err))
+			return
+		}
+	default:
+		w.WriteHeader(404)
+		return
+	}
+
+	js, _ := json.MarshalIndent(n.SnapshotStatus(), "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
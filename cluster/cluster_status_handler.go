@@ -3,6 +3,7 @@ package cluster
 import (
 	"github.com/jrallison/raft"
 
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,52 +13,42 @@ import (
 	"time"
 )
 
+// ClusterStatus describes the cluster as seen by a node: the state of
+// every node it could reach, and why it couldn't reach the others.
+type ClusterStatus struct {
+	Self      string
+	Connected bool
+	Term      uint64
+	Reachable int
+	Members   int
+	Available bool
+	Nodes     map[string]NodeState
+	Errors    map[string]string
+}
+
 func (n *Node) clusterStatusHandler(w http.ResponseWriter, req *http.Request) {
-	body := make(map[string]interface{})
+	if _, ok := n.auth.Authorize(w, req, READ); !ok {
+		return
+	}
 
-	if n.raft.Running() {
-		reachable := 1 // local node
+	body := make(map[string]interface{})
 
+	if status := n.ClusterStatus(); status.Connected {
 		statuses := make(map[string]interface{})
 
-		for name, peer := range n.raft.Peers() {
-			client, call, err := ping(peer)
-
-			if err == nil {
-				defer client.Close()
-
-				reachable += 1
-
-				select {
-				case <-call.Done:
-					if call.Error == nil {
-						statuses[name] = call.Reply
-					} else {
-						err = call.Error
-					}
-				case <-time.After(100 * time.Millisecond):
-					err = errors.New("timeout")
-				}
-			}
-
-			if err != nil {
-				statuses[name] = "error: " + err.Error()
-			}
+		for name, state := range status.Nodes {
+			statuses[name] = state
 		}
 
-		statuses[n.raft.Name()] = n.State()
-
-		body["_self"] = n.raft.Name()
-
-		status := "available"
-
-		if reachable < n.raft.QuorumSize() {
-			status = "unavailable"
+		for name, err := range status.Errors {
+			statuses[name] = "error: " + err
 		}
 
+		body["_self"] = status.Self
+
 		body["cluster"] = map[string]interface{}{
-			"term":   n.raft.Term(),
-			"status": fmt.Sprint(status, " (", reachable, "/", n.raft.MemberCount(), " nodes reachable)"),
+			"term":   status.Term,
+			"status": status.summary(),
 			"nodes":  statuses,
 		}
 	} else {
@@ -70,10 +61,72 @@ func (n *Node) clusterStatusHandler(w http.ResponseWriter, req *http.Request) {
 	w.Write(js)
 }
 
-func ping(peer *raft.Peer) (*rpc.Client, *rpc.Call, error) {
-	host := strings.Replace(peer.ConnectionString, "http://", "", 1)
+// Asks every peer for its state, giving each 100ms to respond.
+func (n *Node) ClusterStatus() ClusterStatus {
+	status := ClusterStatus{
+		Nodes:  make(map[string]NodeState),
+		Errors: make(map[string]string),
+	}
+
+	if !n.raft.Running() {
+		return status
+	}
+
+	status.Reachable = 1 // local node
+
+	for name, peer := range n.raft.Peers() {
+		client, call, err := ping(peer, n.db.reader.apiKey, n.tls)
+
+		if err == nil {
+			defer client.Close()
+
+			status.Reachable += 1
+
+			select {
+			case <-call.Done:
+				if call.Error == nil {
+					status.Nodes[name] = *call.Reply.(*NodeState)
+				} else {
+					err = call.Error
+				}
+			case <-time.After(100 * time.Millisecond):
+				err = errors.New("timeout")
+			}
+		}
+
+		if err != nil {
+			status.Errors[name] = err.Error()
+		}
+	}
+
+	status.Nodes[n.raft.Name()] = n.State()
+
+	status.Self = n.raft.Name()
+	status.Connected = true
+	status.Term = n.raft.Term()
+	status.Members = n.raft.MemberCount()
+	status.Available = status.Reachable >= n.raft.QuorumSize()
+
+	return status
+}
+
+func (s ClusterStatus) summary() string {
+	status := "available"
+
+	if !s.Available {
+		status = "unavailable"
+	}
+
+	return fmt.Sprint(status, " (", s.Reachable, "/", s.Members, " nodes reachable)")
+}
+
+func ping(peer *raft.Peer, key string, config *tls.Config) (*rpc.Client, *rpc.Call, error) {
+	conn, err := dial(hostOf(peer.ConnectionString), config, 100*time.Millisecond)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	client, err := rpc.DialHTTP("tcp", host)
+	client, err := dialHTTP(conn, key)
 	if err != nil {
 		return nil, nil, err
 	}
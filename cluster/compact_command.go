@@ -0,0 +1,31 @@
+package cluster
+
+import (
+	"github.com/jrallison/raft"
+)
+
+// CompactCommand has every node merge consecutive small closed streams
+// in the background, for the leader to compress with CompressCommand
+// once its merge has finished. See WithCompaction.
+type CompactCommand struct {
+	Start     uint64 `json:"start"`
+	Stop      uint64 `json:"stop"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+}
+
+func NewCompactCommand(start, stop uint64, timestamp int64) *CompactCommand {
+	return &CompactCommand{start, stop, timestamp}
+}
+
+func (c *CompactCommand) CommandName() string {
+	return "compact"
+}
+
+func (c *CompactCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	db.compact(c.Start, c.Stop, c.Timestamp)
+
+	return new(interface{}), nil
+}
@@ -0,0 +1,323 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often the leader checks for closed streams small enough to compact.
+const DEFAULT_COMPACTION_INTERVAL = time.Minute
+
+var INVALID_COMPACTION_TARGET = errors.New("Compaction target must not be negative")
+
+// Has the leader merge runs of consecutive closed streams into one, so
+// long as the merged stream stays under the target size in bytes, as
+// esdb-merge and /events/compress do by hand. Tombstoned, deleted and
+// expired events are left out of the merged stream.
+func WithCompaction(target int64) Option {
+	return func(db *DB) error {
+		if target < 0 {
+			return INVALID_COMPACTION_TARGET
+		}
+
+		db.CompactionTarget = target
+		return nil
+	}
+}
+
+type compactor struct {
+	mutex sync.Mutex
+	stop  chan bool
+}
+
+// Has the leader compact streams every interval until stopped, if the
+// DB has a compaction target.
+func (n *Node) startCompaction(interval time.Duration) {
+	if n.db.CompactionTarget == 0 {
+		return
+	}
+
+	n.compaction.mutex.Lock()
+	defer n.compaction.mutex.Unlock()
+
+	if n.compaction.stop != nil {
+		return
+	}
+
+	n.compaction.stop = make(chan bool)
+
+	go func(stop chan bool) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				n.db.supervisor.Run("compaction", n.compactStreams)
+			case <-stop:
+				return
+			}
+		}
+	}(n.compaction.stop)
+}
+
+func (n *Node) stopCompaction() {
+	n.compaction.mutex.Lock()
+	defer n.compaction.mutex.Unlock()
+
+	if n.compaction.stop != nil {
+		close(n.compaction.stop)
+		n.compaction.stop = nil
+	}
+}
+
+// Has the leader compact the oldest run of small streams through raft.
+// Every node merges the streams in the background once the compact
+// command is applied, and they're compressed once the leader's merge
+// has finished, so at least the leader holds the merged stream. One run
+// is compacted at a time.
+func (n *Node) compactStreams() error {
+	if n.raft == nil || n.raft.State() != "leader" || n.db.Following() {
+		return nil
+	}
+
+	if start, m, ok := n.db.merges.next(); ok {
+		if !m.finished {
+			return nil
+		}
+
+		if m.err != nil {
+			n.db.merges.end(start)
+			return m.err
+		}
+
+		_, err := n.raft.Do(NewCompressCommand(start, m.stop, time.Now().UnixNano(), n.db.mergedRemovals(start)))
+		return err
+	}
+
+	start, stop, ok := n.db.compactable()
+	if !ok {
+		return nil
+	}
+
+	_, err := n.raft.Do(NewCompactCommand(start, stop, time.Now().UnixNano()))
+	return err
+}
+
+// The first run of two or more consecutive closed streams whose files
+// together are no larger than the compaction target. Streams missing
+// locally end a run, as their size isn't known.
+func (db *DB) compactable() (start, stop uint64, ok bool) {
+	var size int64
+	var count int
+
+	for _, commit := range db.closed {
+		info, err := os.Stat(db.reader.Path(commit))
+
+		if err != nil || size+info.Size() > db.CompactionTarget {
+			if count > 1 {
+				return start, stop, true
+			}
+
+			size, count = 0, 0
+
+			if err != nil || info.Size() > db.CompactionTarget {
+				continue
+			}
+		}
+
+		if count == 0 {
+			start = commit
+		}
+
+		stop = commit
+		size += info.Size()
+		count++
+	}
+
+	return start, stop, count > 1
+}
+
+// Merges the closed streams between start and stop in the background,
+// so applying the command doesn't hold up the raft log, for the
+// compress command to move into place. Events expired by the leader's
+// clock when it issued the command are left out, rather than by each
+// node's, as are those deleted when it was applied, so every node's
+// merged stream holds the same events. Redacted events are written with
+// their redacted bodies.
+func (db *DB) compact(start, stop uint64, now int64) {
+	commits := make([]uint64, 0)
+
+	for _, commit := range db.closed {
+		if commit >= start && commit <= stop {
+			commits = append(commits, commit)
+		}
+	}
+
+	if len(commits) < 2 {
+		return
+	}
+
+	m := db.merges.begin(start, stop, removalsDigest(db.deleted, db.redactions, start, stop))
+	if m == nil {
+		return
+	}
+
+	tombstones, deleted, redactions := db.tombstones, db.deleted, db.redactions
+	path := db.reader.mergingpath(start)
+
+	db.supervisor.Go("compaction", func() error {
+		err := db.mergeStreams(path, commits, tombstones, deleted, redactions, now)
+
+		if err = db.merges.finish(m, path, db.reader.compressedpath(start), db.reader.removalspath(start), err); err == nil {
+			db.logger.Println("COMPACTION: Merged streams", commits)
+		}
+
+		return err
+	})
+}
+
+func (db *DB) mergeStreams(path string, commits []uint64, tombstones Tombstones, deleted Deletions, redactions Redactions, now int64) error {
+	paths := make([]string, 0, len(commits))
+
+	for _, commit := range commits {
+		if _, err := db.reader.retrieveStream(commit, true); err != nil {
+			return err
+		}
+
+		paths = append(paths, db.reader.Path(commit))
+	}
+
+	return stream.MergeFiltered(path, paths, func(i int, e *stream.Event) bool {
+		db.throttle.Wait(len(e.Data))
+		redactions.apply(commits[i], e)
+		return !hidden(tombstones, deleted, commits[i], e, now)
+	})
+}
+
+// Fetches the merged stream from the leader, whose merge finished
+// before it compressed the streams, replacing this node's copy of the
+// first stream merged.
+func (db *DB) fetchCompacted(start uint64) {
+	peers := db.peerConnectionStrings()
+
+	if db.raft != nil {
+		if leader, ok := db.raft.Peers()[db.raft.Leader()]; ok {
+			peers = []string{leader.ConnectionString}
+		}
+	}
+
+	db.supervisor.Go("compaction", func() error {
+		return db.reader.refetchStream(peers, start)
+	})
+}
+
+// The compactions being merged on this node, by the first stream
+// merged, until their streams are compressed.
+type merges struct {
+	mutex   sync.Mutex
+	running map[uint64]*merge
+}
+
+type merge struct {
+	stop      uint64
+	removals  string
+	finished  bool
+	err       error
+	cancelled bool
+}
+
+// Tracks a merge of the streams, unless they're being merged already,
+// cancelling any other merge into the same stream.
+func (m *merges) begin(start, stop uint64, removals string) *merge {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if running := m.running[start]; running != nil {
+		if running.stop == stop && !running.finished {
+			return nil
+		}
+
+		running.cancelled = true
+	}
+
+	if m.running == nil {
+		m.running = make(map[uint64]*merge)
+	}
+
+	m.running[start] = &merge{stop: stop, removals: removals}
+
+	return m.running[start]
+}
+
+// Moves the merged stream into place for the compress command, with the
+// removals it was merged with, unless the merge failed or was cancelled.
+func (m *merges) finish(merge *merge, path, compressed, removals string, err error) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if merge.cancelled {
+		os.Remove(path)
+		return nil
+	}
+
+	if err == nil {
+		err = ioutil.WriteFile(removals, []byte(merge.removals), 0644)
+	}
+
+	if err == nil {
+		err = os.Rename(path, compressed)
+	}
+
+	if err != nil {
+		os.Remove(path)
+	}
+
+	merge.finished, merge.err = true, err
+
+	return err
+}
+
+// The earliest compaction being merged.
+func (m *merges) next() (uint64, merge, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var start uint64
+	var found *merge
+
+	for commit, merge := range m.running {
+		if found == nil || commit < start {
+			start, found = commit, merge
+		}
+	}
+
+	if found == nil {
+		return 0, merge{}, false
+	}
+
+	return start, *found, true
+}
+
+// Stops tracking the merge into the stream as it's compressed,
+// cancelling it if it's still running. Whether it hadn't finished,
+// so the node's merged stream is missing.
+func (m *merges) end(start uint64) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	merge := m.running[start]
+	if merge == nil {
+		return false
+	}
+
+	delete(m.running, start)
+	merge.cancelled = true
+
+	return !merge.finished || merge.err != nil
+}
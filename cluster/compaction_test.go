@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func waitForMerge(t *testing.T, db *DB) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		if _, m, ok := db.merges.next(); !ok || m.finished {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for streams to merge")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("a"), map[string]string{"customer": "1"})
+		trackevent(n, []byte("b"), map[string]string{"customer": "1"})
+		trackevent(n, []byte("c"), map[string]string{"customer": "1"})
+
+		closed := append([]uint64{}, n.db.closed...)
+
+		if len(closed) < 3 {
+			t.Fatalf("Expected closed streams to compact, found: %v", closed)
+		}
+
+		info, _ := os.Stat(n.db.reader.Path(closed[1]))
+
+		// Room for only two of the streams to be merged at once.
+		n.db.CompactionTarget = 2*info.Size() + 1
+
+		if err := n.compactStreams(); err != nil {
+			t.Fatalf("Unable to compact streams: %v", err)
+		}
+
+		if len(n.db.closed) != len(closed) {
+			t.Errorf("Expected streams to be compressed only once merged, found: %v", n.db.closed)
+		}
+
+		waitForMerge(t, n.db)
+
+		if err := n.compactStreams(); err != nil {
+			t.Fatalf("Unable to compress merged streams: %v", err)
+		}
+
+		if _, _, ok := n.db.merges.next(); ok {
+			t.Errorf("Expected the merge to be forgotten once compressed")
+		}
+
+		if len(n.db.closed) != len(closed)-1 || n.db.closed[0] != closed[0] {
+			t.Errorf("Expected the first two streams to be merged. Wanted: %v, found: %v", closed[1:], n.db.closed)
+		}
+
+		if rw := n.db.rewrites[closed[1]]; rw.Into != closed[0] {
+			t.Errorf("Expected merged stream to be rewritten into the first, found: %+v", rw)
+		}
+
+		found, _, _ := Query{Index: "customer", Value: "1"}.run(n.db)
+
+		if !reflect.DeepEqual(found, []string{"c", "b", "a"}) {
+			t.Errorf("Expected compacted events to be kept. Wanted: [c b a], found: %v", found)
+		}
+
+		n.db.CompactionTarget = 1
+
+		if start, stop, ok := n.db.compactable(); ok {
+			t.Errorf("Expected no streams under the target, found: %v-%v", start, stop)
+		}
+	})
+}
+
+func TestCompressRefetchesStreamsItCantReplace(t *testing.T) {
+	db := createDb()
+
+	db.Rotate(2, 1)
+	db.Rotate(3, 1)
+
+	// Renaming the compressed stream over a directory fails.
+	ioutil.WriteFile(db.reader.compressedpath(1), []byte("compressed"), 0644)
+	os.RemoveAll(db.reader.Path(1))
+	os.MkdirAll(filepath.Join(db.reader.Path(1), "file"), 0755)
+
+	db.Compress(4, 1, 2, "")
+
+	for _, path := range []string{db.reader.compressedpath(1), db.reader.Path(1)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %v to be removed so the stream is fetched, found: %v", path, err)
+		}
+	}
+
+	if !reflect.DeepEqual(db.closed, []uint64{1}) {
+		t.Errorf("Expected the streams to be merged regardless, found: %v", db.closed)
+	}
+}
+
+func TestCompressCancelsUnfinishedMerge(t *testing.T) {
+	db := createDb()
+
+	db.Rotate(2, 1)
+	db.Rotate(3, 1)
+	db.Rotate(4, 1)
+
+	m := db.merges.begin(1, 3, "")
+
+	if db.merges.begin(1, 3, "") != nil {
+		t.Errorf("Expected a running merge not to be started again")
+	}
+
+	db.Compress(5, 1, 3, "")
+
+	if err := db.merges.finish(m, db.reader.mergingpath(1), db.reader.compressedpath(1), db.reader.removalspath(1), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(db.reader.compressedpath(1)); !os.IsNotExist(err) {
+		t.Errorf("Expected a merge finished after compressing to be discarded")
+	}
+
+	if _, _, ok := db.merges.next(); ok {
+		t.Errorf("Expected the merge to be forgotten once compressed")
+	}
+}
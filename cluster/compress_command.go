@@ -5,12 +5,16 @@ import (
 )
 
 type CompressCommand struct {
-	Start uint64 `json:"start"`
-	Stop  uint64 `json:"stop"`
+	Start     uint64 `json:"start"`
+	Stop      uint64 `json:"stop"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	// The deletions and redactions the leader's merged stream was merged
+	// with, from removalsDigest. Unchecked if empty.
+	Removals string `json:"removals,omitempty"`
 }
 
-func NewCompressCommand(start, stop uint64) *CompressCommand {
-	return &CompressCommand{start, stop}
+func NewCompressCommand(start, stop uint64, timestamp int64, removals string) *CompressCommand {
+	return &CompressCommand{start, stop, timestamp, removals}
 }
 
 func (c *CompressCommand) CommandName() string {
@@ -21,7 +25,18 @@ func (c *CompressCommand) Apply(context raft.Context) (interface{}, error) {
 	server := context.Server()
 	db := server.Context().(*DB)
 
-	db.Compress(c.Start, c.Stop)
+	// Events removed since the merge would still be in the merged stream.
+	if c.Removals != "" && removalsDigest(db.deleted, db.redactions, c.Start, c.Stop) != c.Removals {
+		db.discardMerge(c.Start, c.Stop)
+		return new(interface{}), MERGE_OUTDATED
+	}
 
-	return new(interface{}), nil
+	db.Compress(db.commit(context.CurrentIndex()), c.Start, c.Stop, c.Removals)
+
+	err := db.audit(db.commit(context.CurrentIndex()), AUDIT_COMPRESS, map[string]interface{}{
+		"start": c.Start,
+		"stop":  c.Stop,
+	}, c.Timestamp)
+
+	return new(interface{}), err
 }
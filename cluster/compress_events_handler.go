@@ -9,6 +9,10 @@ import (
 func (n *Node) compressEventsHandler(w http.ResponseWriter, req *http.Request) {
 	req.Body.Close()
 
+	if _, ok := n.auth.Authorize(w, req, ADMIN); !ok {
+		return
+	}
+
 	if req.Method != "POST" {
 		w.WriteHeader(404)
 		return
@@ -27,10 +31,7 @@ func (n *Node) compressEventsHandler(w http.ResponseWriter, req *http.Request) {
 		err = n.Compress(uint64(start), uint64(stop))
 
 		if err == NOT_LEADER_ERROR {
-			var uri string
-			uri, err = n.LeaderConnectionString()
-			w.Header().Set("Cluster-Leader", uri)
-			w.WriteHeader(400)
+			respond(w, n.notLeader(w))
 			return
 		}
 	} else {
@@ -39,7 +40,8 @@ func (n *Node) compressEventsHandler(w http.ResponseWriter, req *http.Request) {
 	}
 
 	if err != nil {
-		w.WriteHeader(500)
+		respond(w, Fail(w, err))
+		return
 	}
 
 	w.Write([]byte("\n"))
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func streamCommits() []int {
@@ -55,9 +56,9 @@ func TestCompression(t *testing.T) {
 			t.Errorf("Incorrect committed streams. Wanted: %v, found: %v", expectedCommits, streamCommits())
 		}
 
-		Merge("tmp/teststream", 1, 291, n.db.closed)
+		Merge("tmp/teststream", 1, 291, n.db.closed, n.db.tombstones, n.db.deleted)
 		n.Compress(1, 291)
-		Merge("tmp/teststream", 292, 490, n.db.closed)
+		Merge("tmp/teststream", 292, 490, n.db.closed, n.db.tombstones, n.db.deleted)
 		n.Compress(292, 490)
 		Cleanup("tmp/teststream", n.db.current, n.db.closed)
 
@@ -109,3 +110,198 @@ func TestCompression(t *testing.T) {
 		}
 	})
 }
+
+func TestCompressedStreamVisibility(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("a"), map[string]string{"a": "b"})
+		trackevent(n, []byte("b"), map[string]string{"a": "b"})
+		trackevent(n, []byte("c"), map[string]string{"a": "b"})
+
+		scanned := func() []string {
+			found := make([]string, 0)
+
+			n.db.Scan("a", "b", 0, "", func(e *stream.Event) bool {
+				found = append(found, string(e.Data))
+				return true
+			})
+
+			return found
+		}
+
+		start := n.db.closed[1]
+
+		n.Delete("a", "b")
+		trackevent(n, []byte("d"), map[string]string{"a": "b"})
+
+		Merge("tmp/teststream", start, start, n.db.closed, n.db.tombstones, n.db.deleted)
+
+		// Until the streams are compressed, the compressed stream isn't read.
+		os.Rename(n.db.reader.Path(start), n.db.reader.Path(start)+".moved")
+
+		if s, err := n.db.reader.retrieveStream(start, false); err == nil || s != nil {
+			t.Errorf("Expected not to read the compressed stream before compressing, found: %v", s)
+		}
+
+		// Once they are, it's read in its place until renamed.
+		rewrites := n.db.reader.rewrites
+		n.db.reader.SetRewrites(Rewrites{start: {Into: start}})
+
+		if s, err := n.db.reader.retrieveStream(start, false); err != nil || s == nil {
+			t.Errorf("Expected to read the compressed stream, found: %v", err)
+		}
+
+		n.db.reader.SetRewrites(rewrites)
+
+		n.db.reader.replaceStream(start, func() error {
+			return os.Rename(n.db.reader.Path(start)+".moved", n.db.reader.Path(start))
+		})
+
+		// Caches the original stream before it's compressed.
+		scanned()
+
+		n.Compress(start, start)
+
+		if _, err := os.Stat(n.db.reader.compressedpath(start)); !os.IsNotExist(err) {
+			t.Errorf("Expected the compressed stream to be renamed, found: %v", err)
+		}
+
+		// The cached stream was reopened, so the deleted event is gone from its file.
+		if s, _ := n.db.reader.retrieveStream(start, false); s != nil {
+			found := make([]string, 0)
+
+			s.Iterate(0, func(e *stream.Event) bool {
+				if !audited(e) {
+					found = append(found, string(e.Data))
+				}
+				return true
+			})
+
+			if len(found) != 0 {
+				t.Errorf("Expected the compressed stream to be read, found: %v", found)
+			}
+		}
+
+		if found := scanned(); !reflect.DeepEqual(found, []string{"d"}) {
+			t.Errorf("Incorrect scan after compressing. Wanted: [d], found: %v", found)
+		}
+	})
+}
+
+func TestReconcileCompressions(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	db, _ := NewDb("tmp")
+
+	write := func(path string, close bool) {
+		s, _ := stream.New(path)
+		s.Write([]byte("a"), map[string]string{"a": "b"})
+
+		if close {
+			s.Close()
+		} else {
+			s.Sync()
+		}
+	}
+
+	stale := time.Now().Add(-2 * STALE_COMPRESSION)
+
+	// Renamed into place, as the stream is missing.
+	write(db.reader.compressedpath(2), true)
+
+	// Kept for the compress command.
+	write(db.reader.Path(3), true)
+	write(db.reader.compressedpath(3), true)
+
+	// Rolled back.
+	write(db.reader.compressedpath(4), false)
+	os.Chtimes(db.reader.compressedpath(4), stale, stale)
+
+	// Kept, as the merge may still be running.
+	write(db.reader.compressedpath(5), false)
+
+	db.reconcileCompressions()
+
+	tests := []struct {
+		path   string
+		exists bool
+	}{
+		{db.reader.Path(2), true},
+		{db.reader.compressedpath(2), false},
+		{db.reader.compressedpath(3), true},
+		{db.reader.compressedpath(4), false},
+		{db.reader.compressedpath(5), true},
+	}
+
+	for i, test := range tests {
+		if _, err := os.Stat(test.path); os.IsNotExist(err) == test.exists {
+			t.Errorf("Case #%v: Wanted %v to exist: %v", i, test.path, test.exists)
+		}
+	}
+}
+
+func TestCompressKeepsDeletionsSinceMerge(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		for _, body := range []string{"a", "b", "c"} {
+			trackevent(n, []byte(body), map[string]string{"a": "b"})
+		}
+
+		closed := append([]uint64{}, n.db.closed...)
+		start, stop := closed[0], closed[len(closed)-1]
+
+		if err := Merge("tmp/teststream", start, stop, n.db.closed, n.db.tombstones, n.db.deleted); err != nil {
+			t.Fatal(err)
+		}
+
+		var offset int64
+
+		n.db.Scan("a", "b", 0, "", func(e *stream.Event) bool {
+			offset = e.Offset
+			return string(e.Data) != "b"
+		})
+
+		// Deleted once the streams were merged.
+		if err := n.SoftDelete([]EventId{{closed[1], offset}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := n.Compress(start, stop); err != MERGE_OUTDATED {
+			t.Errorf("Expected a merge from before the delete to be refused, found: %v", err)
+		}
+
+		if !reflect.DeepEqual(n.db.closed, closed) {
+			t.Errorf("Expected the streams to stay uncompressed, found: %v", n.db.closed)
+		}
+
+		iterate := func() []string {
+			found := make([]string, 0)
+
+			n.db.Iterate(0, "", func(e *stream.Event) bool {
+				found = append(found, string(e.Data))
+				return true
+			})
+
+			return found
+		}
+
+		if found := iterate(); !reflect.DeepEqual(found, []string{"a", "c"}) {
+			t.Errorf("Expected the deleted event to stay hidden, found: %v", found)
+		}
+
+		if err := Merge("tmp/teststream", start, stop, n.db.closed, n.db.tombstones, n.db.deleted); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := n.Compress(start, stop); err != nil {
+			t.Fatal(err)
+		}
+
+		if found := iterate(); !reflect.DeepEqual(found, []string{"a", "c"}) {
+			t.Errorf("Expected the deleted event to be removed, found: %v", found)
+		}
+	})
+}
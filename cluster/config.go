@@ -0,0 +1,146 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Environment variables are named after their flag, upper cased
+	// and with this prefix, so -soft-watermark is ESDB_SOFT_WATERMARK.
+	CONFIG_ENV_PREFIX = "ESDB_"
+
+	// Setting for the data path, which is an argument rather than a flag.
+	DATA_SETTING = "data"
+)
+
+var UNKNOWN_SETTING = errors.New("Unknown config setting")
+var INVALID_SETTING = errors.New("Invalid config setting")
+
+// Config holds the settings of a command, keyed by flag name.
+type Config map[string]string
+
+// Reads a JSON config file from the given path, whose keys are the
+// command's flag names. Lists are joined with commas, for flags which
+// take comma separated values:
+//
+//	{
+//	  "data": "/var/lib/esdb",
+//	  "h": "10.0.0.2",
+//	  "p": 4001,
+//	  "join": "10.0.0.1:4001",
+//	  "unique": ["customer", "email"],
+//	  "hard-watermark": 0.95,
+//	  "shutdown-timeout": "1m"
+//	}
+func LoadConfig(path string) (Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings map[string]interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	if err = decoder.Decode(&settings); err != nil {
+		return nil, err
+	}
+
+	config := make(Config, len(settings))
+
+	for name, value := range settings {
+		if config[name], err = configValue(value); err != nil {
+			return nil, errors.New(INVALID_SETTING.Error() + ": " + name)
+		}
+	}
+
+	return config, nil
+}
+
+// Sets every flag not given on the command line, from its environment
+// variable if there is one, and otherwise from the config. Flags
+// therefore take precedence over the environment, which takes
+// precedence over the config file.
+func (c Config) Apply(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	for name := range c {
+		if name != DATA_SETTING && fs.Lookup(name) == nil {
+			return errors.New(UNKNOWN_SETTING.Error() + ": " + name)
+		}
+	}
+
+	var err error
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || err != nil {
+			return
+		}
+
+		value, ok := os.LookupEnv(configEnv(f.Name))
+		if !ok {
+			value, ok = c[f.Name]
+		}
+
+		if ok {
+			if serr := fs.Set(f.Name, value); serr != nil {
+				err = fmt.Errorf("%v: %v: %v", INVALID_SETTING, f.Name, serr)
+			}
+		}
+	})
+
+	return err
+}
+
+// The data path from the environment or config, for when
+// it isn't given as an argument.
+func (c Config) Data() string {
+	if value, ok := os.LookupEnv(configEnv(DATA_SETTING)); ok {
+		return value
+	}
+
+	return c[DATA_SETTING]
+}
+
+func configEnv(name string) string {
+	return CONFIG_ENV_PREFIX + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+func configValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		values := make([]string, len(v))
+
+		for i, item := range v {
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+
+			values[i] = s
+		}
+
+		return strings.Join(values, ","), nil
+	}
+
+	return "", INVALID_SETTING
+}
@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func configFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("h", "localhost", "")
+	fs.Int("p", 4001, "")
+	fs.String("unique", "", "")
+	fs.Float64("hard-watermark", DEFAULT_HARD_WATERMARK, "")
+	fs.Duration("shutdown-timeout", 30*time.Second, "")
+	return fs
+}
+
+func TestLoadingConfig(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	defer os.Remove("tmp/config.json")
+
+	ioutil.WriteFile("tmp/config.json", []byte(`{
+		"data": "/var/lib/esdb",
+		"h": "10.0.0.2",
+		"p": 4005,
+		"unique": ["customer", "email"],
+		"hard-watermark": 0.95,
+		"shutdown-timeout": "1m"
+	}`), 0644)
+
+	config, err := LoadConfig("tmp/config.json")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	os.Setenv("ESDB_HARD_WATERMARK", "0.9")
+	defer os.Unsetenv("ESDB_HARD_WATERMARK")
+
+	fs := configFlags()
+	fs.Parse([]string{"-p", "4010"})
+
+	if err := config.Apply(fs); err != nil {
+		t.Fatalf("Failed to apply config: %v", err)
+	}
+
+	expected := map[string]string{
+		"h":                "10.0.0.2",
+		"p":                "4010",
+		"unique":           "customer,email",
+		"hard-watermark":   "0.9",
+		"shutdown-timeout": "1m0s",
+	}
+
+	for name, value := range expected {
+		if found := fs.Lookup(name).Value.String(); found != value {
+			t.Errorf("Incorrect %v. Wanted: %v, found: %v", name, value, found)
+		}
+	}
+
+	if data := config.Data(); data != "/var/lib/esdb" {
+		t.Errorf("Incorrect data path. Wanted: /var/lib/esdb, found: %v", data)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	if err := (Config{"port": "4001"}).Apply(configFlags()); err == nil {
+		t.Errorf("Expected unknown setting to be rejected")
+	}
+
+	if err := (Config{"p": "high"}).Apply(configFlags()); err == nil {
+		t.Errorf("Expected invalid setting to be rejected")
+	}
+}
@@ -4,16 +4,39 @@ import (
 	"github.com/jrallison/raft"
 
 	"errors"
-	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
 var registerCommands sync.Once
 
+// Every command applied to the DB, whether through raft or standalone.
+func commands() []raft.Command {
+	return []raft.Command{
+		&EventCommand{},
+		&EventsCommand{},
+		&CompressCommand{},
+		&AuditCommand{},
+		&DeleteCommand{},
+		&RedactCommand{},
+		&SoftDeleteCommand{},
+		&ReadOnlyCommand{},
+		&RotateCommand{},
+		&SplitCommand{},
+		&PlaceCommand{},
+		&IdentifyCommand{},
+		&PromoteCommand{},
+		&FollowCommand{},
+		&ExpireCommand{},
+		&CompactCommand{},
+		&SnapshotCommand{},
+	}
+}
+
 func Connect(n *Node, existing string) error {
 	r, err := initRaft(n)
 	if err != nil {
@@ -25,9 +48,11 @@ func Connect(n *Node, existing string) error {
 	if existing != "" {
 		err = joinCluster(n, existing)
 	} else if n.raft.IsLogEmpty() {
-		err = createCluster(n)
+		if err = createCluster(n); err == nil && n.promote {
+			err = promoteReplica(n)
+		}
 	} else {
-		log.Println("Recovered from log")
+		n.db.logger.Println("Recovered from log")
 	}
 
 	return err
@@ -35,14 +60,15 @@ func Connect(n *Node, existing string) error {
 
 func initRaft(n *Node) (raft.Server, error) {
 	registerCommands.Do(func() {
-		raft.RegisterCommand(&EventCommand{})
-		raft.RegisterCommand(&EventsCommand{})
-		raft.RegisterCommand(&CompressCommand{})
+		for _, command := range commands() {
+			raft.RegisterCommand(command)
+		}
 	})
 
 	transporter := raft.NewHTTPTransporter("/raft", 200*time.Millisecond)
+	transporter.Transport.TLSClientConfig = n.tls.Clone()
 
-	s, err := raft.NewServer(n.name, n.path, transporter, n.db, n.db, fmt.Sprint("http://", n.host, ":", n.port))
+	s, err := raft.NewServer(n.name, n.path, transporter, n.db, n.db, n.uri())
 	if err != nil {
 		return nil, err
 	}
@@ -52,6 +78,13 @@ func initRaft(n *Node) (raft.Server, error) {
 
 	n.db.setRaft(s)
 
+	// Streams are placed again as members join or leave.
+	for _, event := range []string{raft.AddPeerEventType, raft.RemovePeerEventType} {
+		s.AddEventListener(event, func(raft.Event) {
+			n.db.replan()
+		})
+	}
+
 	if err := os.MkdirAll(filepath.Join(n.path, "snapshot"), 0744); err != nil {
 		log.Fatalf("Unable to create stream directory: %v", err)
 	}
@@ -60,30 +93,42 @@ func initRaft(n *Node) (raft.Server, error) {
 		return nil, err
 	}
 
-	transporter.Install(s, n)
+	transporter.Install(s, peerMux{n})
 
 	return s, s.Start()
 }
 
 func joinCluster(n *Node, existing string) error {
-	log.Println("Attempting to join cluster:", existing)
+	n.db.logger.Println("Attempting to join cluster:", existing)
 
 	if !n.raft.IsLogEmpty() {
 		return errors.New("Cannot join with an existing log")
 	}
 
-	return executeOn(existing, "Node.JoinCluster", &raft.DefaultJoinCommand{
+	err := executeOn(n.retry, n.db.reader.apiKey, existing, "Node.Join", JoinRequest{
 		Name:             n.raft.Name(),
-		ConnectionString: fmt.Sprintf("http://%s:%d", n.host, n.port),
+		ConnectionString: n.uri(),
+		Id:               n.id,
+		Replace:          n.replace,
 	})
+
+	// Nodes which don't yet check identities are joined as before.
+	if err != nil && strings.Contains(err.Error(), "can't find method") {
+		err = executeOn(n.retry, n.db.reader.apiKey, existing, "Node.JoinCluster", &raft.DefaultJoinCommand{
+			Name:             n.raft.Name(),
+			ConnectionString: n.uri(),
+		})
+	}
+
+	return err
 }
 
 func createCluster(n *Node) error {
-	log.Println("Initializing new cluster")
+	n.db.logger.Println("Initializing new cluster")
 
 	_, err := n.raft.Do(&raft.DefaultJoinCommand{
 		Name:             n.raft.Name(),
-		ConnectionString: fmt.Sprintf("http://%s:%d", n.host, n.port),
+		ConnectionString: n.uri(),
 	})
 
 	return err
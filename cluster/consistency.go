@@ -0,0 +1,140 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var MISSING_STREAMS = errors.New("Closed streams are missing and couldn't be recovered")
+
+// Where files in the stream directory which aren't streams are moved.
+const QUARANTINE_DIR = "quarantine"
+
+var streamFile = regexp.MustCompile(`^events\.(\d+)\.(stream|tmpstream|redacting|splitting)$`)
+
+// Differences found between the streams the DB expects and the
+// files in its directory.
+type Consistency struct {
+	// Closed streams placed on this node without a file.
+	Missing []uint64 `json:"missing,omitempty"`
+	// Stream files which aren't closed or current, such as those merged
+	// into a compressed stream and not yet removed by esdb-cleanup.
+	Extra []uint64 `json:"extra,omitempty"`
+	// Files which aren't streams, moved into QUARANTINE_DIR.
+	Quarantined []string `json:"quarantined,omitempty"`
+}
+
+// Compares the closed and current streams with the files present, once
+// the snapshot and log have been applied. Unknown files are quarantined,
+// and missing streams recovered from peers in the background, rather
+// than discovered when they're scanned.
+func (db *DB) checkConsistency() (Consistency, error) {
+	var c Consistency
+
+	files, err := ioutil.ReadDir(db.reader.dir)
+	if err != nil {
+		return c, err
+	}
+
+	present := make(map[uint64]bool)
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		match := streamFile.FindStringSubmatch(f.Name())
+
+		if match == nil {
+			if err := db.quarantine(f.Name()); err != nil {
+				return c, err
+			}
+
+			c.Quarantined = append(c.Quarantined, f.Name())
+		} else if match[2] == "stream" {
+			commit, _ := strconv.ParseUint(match[1], 10, 64)
+			present[commit] = true
+		}
+	}
+
+	expected := map[uint64]bool{db.current: true}
+
+	for _, commit := range db.closed {
+		expected[commit] = true
+
+		if !present[commit] && db.keeps(commit) {
+			c.Missing = append(c.Missing, commit)
+		}
+	}
+
+	for commit := range present {
+		if !expected[commit] {
+			c.Extra = append(c.Extra, commit)
+		}
+	}
+
+	sort.Sort(OffsetSlice(c.Extra))
+
+	return c, nil
+}
+
+func (db *DB) quarantine(name string) error {
+	dir := filepath.Join(db.reader.dir, QUARANTINE_DIR)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(filepath.Join(db.reader.dir, name), filepath.Join(dir, name))
+}
+
+// Logs what the check found, and recovers the missing streams from
+// peers, degrading the node if any can't be.
+func (db *DB) reconcileStreams() {
+	c, err := db.checkConsistency()
+	if err != nil {
+		db.logger.Println("CONSISTENCY: Unable to check streams:", err)
+		return
+	}
+
+	for _, name := range c.Quarantined {
+		db.logger.Println("CONSISTENCY: Quarantined unknown file", name)
+	}
+
+	if len(c.Extra) > 0 {
+		db.logger.Println("CONSISTENCY: Streams which aren't in use:", c.Extra)
+	}
+
+	// Copies may have been placed elsewhere while the node was down.
+	if len(db.placement) > 0 {
+		db.supervisor.Go("rebalance", db.rebalance)
+	}
+
+	if len(c.Missing) == 0 {
+		return
+	}
+
+	db.logger.Println("CONSISTENCY: Recovering missing streams:", c.Missing)
+
+	db.supervisor.Go("consistency", func() error {
+		failed := make([]uint64, 0)
+
+		for _, commit := range c.Missing {
+			if _, err := db.reader.retrieveStream(commit, true); err != nil {
+				failed = append(failed, commit)
+			}
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("%v: %v", MISSING_STREAMS, failed)
+		}
+
+		return nil
+	})
+}
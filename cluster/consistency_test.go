@@ -0,0 +1,44 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConsistency(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	db, _ := NewDb("tmp")
+	db.closed = []uint64{2, 3, 4}
+
+	for _, commit := range []uint64{2, 4, 7} {
+		ioutil.WriteFile(db.reader.Path(commit), []byte{}, 0644)
+	}
+
+	ioutil.WriteFile(db.reader.compressedpath(3), []byte{}, 0644)
+	ioutil.WriteFile("tmp/notes.txt", []byte{}, 0644)
+	os.MkdirAll("tmp/backups", 0755)
+
+	c, err := db.checkConsistency()
+	if err != nil {
+		t.Fatalf("Error checking consistency: %v", err)
+	}
+
+	expected := Consistency{
+		Missing:     []uint64{3},
+		Extra:       []uint64{7},
+		Quarantined: []string{"notes.txt"},
+	}
+
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("Wanted: %+v, found: %+v", expected, c)
+	}
+
+	if _, err := os.Stat(filepath.Join("tmp", QUARANTINE_DIR, "notes.txt")); err != nil {
+		t.Errorf("Expected notes.txt to be quarantined: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefixes every continuation, so their format can change
+// without older ones being misread. Continuations without a
+// version are from before streams were ever rewritten.
+const CONTINUATION_VERSION = "v1"
+
+var MALFORMED_CONTINUATION = errors.New("Malformed continuation")
+
+// Returned when a continuation refers to a stream which no longer
+// exists, and can't be mapped to where its events are now.
+type ExpiredContinuationError struct {
+	Continuation string
+}
+
+func (e *ExpiredContinuationError) Error() string {
+	return "Continuation " + e.Continuation + " has expired, as the stream it refers to no longer exists. " +
+		"Restart the scan without a continuation, or with one from /events/offset."
+}
+
+// Rewrite records that a closed stream was rewritten, moving its events,
+// so continuations issued beforehand can be mapped to where they are now.
+// Streams which were compressed are moved into the first compressed
+// stream, and split streams into consecutive pieces at the boundaries.
+type Rewrite struct {
+	Epoch      uint64  `json:"epoch"`
+	Into       uint64  `json:"into,omitempty"`
+	Boundaries []int64 `json:"boundaries,omitempty"`
+	// The stream was removed, as it was outside the retention window.
+	Expired bool `json:"expired,omitempty"`
+}
+
+// Rewrites are keyed by the commit of each stream rewritten or created
+// by a rewrite. They're shared with readers, so are replaced rather
+// than modified.
+type Rewrites map[uint64]Rewrite
+
+func (r *Reader) SetRewrites(rewrites Rewrites) {
+	r.rewrites = rewrites
+}
+
+// Records the streams as rewritten at the given commit.
+func (db *DB) rewrite(commit uint64, rewritten map[uint64]Rewrite) {
+	rewrites := make(Rewrites, len(db.rewrites)+len(rewritten))
+
+	for c, rw := range db.rewrites {
+		rewrites[c] = rw
+	}
+
+	for c, rw := range rewritten {
+		rw.Epoch = commit
+		rewrites[c] = rw
+	}
+
+	db.rewrites = rewrites
+	db.revision = commit
+}
+
+// Parses the continuation into the position of the next event to read.
+// Continuations issued before their stream was rewritten are mapped to
+// the start of the stream now holding their events, so some events may
+// be read again, but none are missed. An empty continuation starts from
+// the newest stream in reverse, or the oldest otherwise.
+func (r *Reader) parseContinuation(continuation string, reverse bool) (uint64, int64, error) {
+	return r.parseScanContinuation(continuation, "", "", reverse)
+}
+
+// Parses the continuation as parseContinuation, refusing those signed
+// for a scan of another index value than the one given.
+func (r *Reader) parseScanContinuation(continuation, index, value string, reverse bool) (uint64, int64, error) {
+	commit := r.current
+
+	if !reverse && len(r.closed) > 0 {
+		commit = r.closed[0]
+	}
+
+	if continuation == "" {
+		return commit, 0, nil
+	}
+
+	c, err := r.decodeContinuation(continuation)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if index != "" && c.Index != "" && (c.Index != index || c.Value != value) {
+		return 0, 0, MISMATCHED_CONTINUATION
+	}
+
+	commit, offset, epoch := c.Commit, c.Offset, c.Epoch
+
+	// Nothing more to read.
+	if commit == 0 {
+		return 0, 0, nil
+	}
+
+	// Each rewrite has a later epoch, so this always ends.
+	for {
+		rw, ok := r.rewrites[commit]
+		if !ok || rw.Epoch <= epoch {
+			break
+		}
+
+		if len(rw.Boundaries) > 0 {
+			piece := 0
+
+			if offset == 0 && reverse {
+				piece = len(rw.Boundaries) - 1
+			} else {
+				for i, boundary := range rw.Boundaries {
+					if offset >= boundary {
+						piece = i
+					}
+				}
+			}
+
+			commit += uint64(piece)
+		} else if rw.Into > 0 {
+			commit = rw.Into
+		} else if rw.Expired {
+			// Everything older has expired too.
+			if reverse {
+				return 0, 0, nil
+			}
+
+			commit = r.Next(commit)
+		}
+
+		offset, epoch = 0, rw.Epoch
+	}
+
+	if commit != r.current && !r.isClosed(commit) {
+		return 0, 0, &ExpiredContinuationError{continuation}
+	}
+
+	return commit, offset, nil
+}
+
+// Unsigned continuations are "v1:commit:offset:epoch", or "commit:offset"
+// from before streams were rewritten. Once the reader has a key, only
+// signed continuations are accepted.
+func (r *Reader) decodeContinuation(continuation string) (Continuation, error) {
+	var c Continuation
+	var err error
+
+	if r.continuationKey != nil {
+		return ParseContinuation(continuation, r.continuationKey)
+	}
+
+	parts := strings.Split(continuation, ":")
+
+	switch {
+	case len(parts) == 4 && parts[0] == CONTINUATION_VERSION:
+		if c.Epoch, err = strconv.ParseUint(parts[3], 10, 64); err != nil {
+			return c, MALFORMED_CONTINUATION
+		}
+
+		parts = parts[1:3]
+	case len(parts) != 2:
+		return c, MALFORMED_CONTINUATION
+	}
+
+	if c.Commit, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return c, MALFORMED_CONTINUATION
+	}
+
+	if c.Offset, err = strconv.ParseInt(parts[1], 10, 64); err != nil || c.Offset < 0 {
+		return c, MALFORMED_CONTINUATION
+	}
+
+	return c, nil
+}
+
+// Continuations are the position of the next event to read within the
+// stream starting at commit, and when that stream was last rewritten.
+// An offset of 0 is the start of the stream. Iterating resumes at the
+// position and continues in (commit, offset) order, scans resume there
+// and continue in reverse.
+func (r *Reader) buildContinuation(commit uint64, offset int64) string {
+	return r.buildScanContinuation(commit, offset, "", "")
+}
+
+// Builds a continuation as buildContinuation, which once signed is
+// only accepted by scans of the index value.
+func (r *Reader) buildScanContinuation(commit uint64, offset int64, index, value string) string {
+	if commit == 0 {
+		return ""
+	}
+
+	epoch := r.rewrites[commit].Epoch
+
+	if r.continuationKey != nil {
+		return Continuation{SIGNED_CONTINUATION_VERSION, commit, offset, epoch, index, value}.Sign(r.continuationKey)
+	}
+
+	return fmt.Sprint(CONTINUATION_VERSION, ":", commit, ":", offset, ":", epoch)
+}
+
+func writeRewrites(buf *bytes.Buffer, rewrites Rewrites) {
+	commits := make([]uint64, 0, len(rewrites))
+	for commit := range rewrites {
+		commits = append(commits, commit)
+	}
+
+	sort.Sort(OffsetSlice(commits))
+
+	binary.WriteUvarint(buf, len(commits))
+
+	for _, commit := range commits {
+		rw := rewrites[commit]
+
+		binary.WriteInt64(buf, int64(commit))
+		binary.WriteInt64(buf, int64(rw.Epoch))
+		binary.WriteInt64(buf, int64(rw.Into))
+		binary.WriteUvarint(buf, len(rw.Boundaries))
+
+		for _, boundary := range rw.Boundaries {
+			binary.WriteInt64(buf, boundary)
+		}
+	}
+}
+
+func readRewrites(buf *bytes.Buffer) (Rewrites, error) {
+	rewrites := make(Rewrites)
+
+	// Snapshots taken before streams were rewritten have none.
+	if buf.Len() == 0 {
+		return rewrites, nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var commit, epoch, into, num, boundary int64
+
+		if commit, err = binary.ReadInt64Full(buf); err != nil {
+			break
+		}
+
+		if epoch, err = binary.ReadInt64Full(buf); err != nil {
+			break
+		}
+
+		if into, err = binary.ReadInt64Full(buf); err != nil {
+			break
+		}
+
+		rw := Rewrite{Epoch: uint64(epoch), Into: uint64(into)}
+
+		num, err = binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+		for j := int64(0); j < num && err == nil; j++ {
+			boundary, err = binary.ReadInt64Full(buf)
+			rw.Boundaries = append(rw.Boundaries, boundary)
+		}
+
+		rewrites[uint64(commit)] = rw
+	}
+
+	return rewrites, err
+}
@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParsingContinuations(t *testing.T) {
+	r := NewReader("tmp")
+	r.closed = []uint64{1, 4, 5, 6, 9}
+	r.current = 12
+	r.SetRewrites(Rewrites{
+		// Streams 2 and 3 compressed into 1 at commit 7.
+		1: {Epoch: 7, Into: 1},
+		2: {Epoch: 7, Into: 1},
+		3: {Epoch: 7, Into: 1},
+		// Stream 4 split into 4, 5 and 6 at commit 8.
+		4: {Epoch: 8, Boundaries: []int64{0, 100, 200}},
+		5: {Epoch: 8},
+		6: {Epoch: 8},
+	})
+
+	var tests = []struct {
+		continuation string
+		reverse      bool
+		commit       uint64
+		offset       int64
+	}{
+		{"", true, 12, 0},
+		{"", false, 1, 0},
+		{"9:20", true, 9, 20},
+		{"v1:9:20:0", true, 9, 20},
+		{"v1:1:20:7", true, 1, 20},
+		{"0:0", true, 0, 0},
+		{"2:20", true, 1, 0},
+		{"v1:3:20:6", false, 1, 0},
+		{"4:50", false, 4, 0},
+		{"4:150", false, 5, 0},
+		{"4:250", true, 6, 0},
+		{"4:0", true, 6, 0},
+		{"4:0", false, 4, 0},
+		{"v1:4:150:8", false, 4, 150},
+	}
+
+	for i, test := range tests {
+		commit, offset, err := r.parseContinuation(test.continuation, test.reverse)
+
+		if err != nil || commit != test.commit || offset != test.offset {
+			t.Errorf("Case #%v: Incorrect parse of %q. Wanted: %v %v, found: %v %v %v", i, test.continuation, test.commit, test.offset, commit, offset, err)
+		}
+	}
+
+	for _, continuation := range []string{"1", "a:1", "1:a", "1:-1", "v2:1:1:1", "v1:1:1"} {
+		if _, _, err := r.parseContinuation(continuation, true); err != MALFORMED_CONTINUATION {
+			t.Errorf("Expected %q to be malformed, found: %v", continuation, err)
+		}
+	}
+
+	if _, _, err := r.parseContinuation("10:5", true); Classify(err).Status != 410 {
+		t.Errorf("Expected continuation of an unknown stream to expire, found: %v", err)
+	}
+
+	if continuation := r.buildContinuation(4, 150); continuation != "v1:4:150:8" {
+		t.Errorf("Incorrect continuation. Wanted: v1:4:150:8, found: %v", continuation)
+	}
+}
+
+func TestRecoveringRewrites(t *testing.T) {
+	rewrites := Rewrites{
+		1: {Epoch: 7, Into: 1},
+		4: {Epoch: 8, Boundaries: []int64{0, 100, 200}},
+		5: {Epoch: 8},
+	}
+
+	buf := new(bytes.Buffer)
+	writeRewrites(buf, rewrites)
+
+	if found, err := readRewrites(buf); err != nil || !reflect.DeepEqual(found, rewrites) {
+		t.Errorf("Incorrect rewrites. Wanted: %v, found: %v %v", rewrites, found, err)
+	}
+
+	if found, _ := readRewrites(new(bytes.Buffer)); len(found) != 0 {
+		t.Errorf("Expected no rewrites from an older snapshot, found: %v", found)
+	}
+}
@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CORS describes which cross-origin requests browsers may make,
+// so dashboards can query a server directly without a proxy.
+type CORS struct {
+	Origins []string
+	Methods []string
+	Headers []string
+}
+
+// Wraps the handler, adding CORS headers to requests from allowed
+// origins and answering preflight requests itself. A nil CORS
+// leaves requests untouched.
+func (c *CORS) Handle(handler func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		if c == nil || origin == "" {
+			handler(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+
+		if !c.allows(origin) {
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(403)
+			} else {
+				handler(w, r)
+			}
+
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.Methods, ", "))
+
+			if len(c.Headers) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.Headers, ", "))
+			}
+
+			w.WriteHeader(204)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (c *CORS) allows(origin string) bool {
+	for _, allowed := range c.Origins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	cors := &CORS{
+		Origins: []string{"https://dashboard.example.com"},
+		Methods: []string{"GET"},
+		Headers: []string{API_KEY_HEADER},
+	}
+
+	handler := cors.Handle(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	var tests = []struct {
+		method string
+		origin string
+		code   int
+		allow  string
+	}{
+		{"GET", "", 200, ""},
+		{"GET", "https://dashboard.example.com", 200, "https://dashboard.example.com"},
+		{"GET", "https://other.example.com", 200, ""},
+		{"OPTIONS", "https://dashboard.example.com", 204, "https://dashboard.example.com"},
+		{"OPTIONS", "https://other.example.com", 403, ""},
+	}
+
+	for i, test := range tests {
+		req, _ := http.NewRequest(test.method, "/events", nil)
+
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+
+		if test.method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "GET")
+		}
+
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		if w.Code != test.code {
+			t.Errorf("Case #%v: Incorrect status. Wanted: %v, found: %v", i, test.code, w.Code)
+		}
+
+		if allow := w.Header().Get("Access-Control-Allow-Origin"); allow != test.allow {
+			t.Errorf("Case #%v: Incorrect allowed origin. Wanted: %v, found: %v", i, test.allow, allow)
+		}
+	}
+}
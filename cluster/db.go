@@ -6,12 +6,13 @@ import (
 	"github.com/jrallison/raft"
 
 	"bytes"
+	"context"
 	"errors"
-	"log"
+	"io"
 	"math"
 	"os"
 	"sort"
-	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,29 +35,123 @@ type DB struct {
 	closed          []uint64
 	current         uint64
 	MostRecent      int64
+	recent          *Recent
 	RotateThreshold int64
 	SnapshotBuffer  uint64
+	UniqueIndexes   map[string]bool
+	tombstones      Tombstones
+	deleted         Deletions
+	rewrites        Rewrites
+	spans           Spans
+	span            Span
+	revision        uint64
+	redacting       int32
+	readonly        int32
 	wtimer          Timer
 	rtimer          Timer
+	supervisor      *Supervisor
+	logger          Logger
+	watch           *Watch
+	disk            *DiskMonitor
+	throttle        *Throttle
+	placement       Placement
+	copies          int
+	identities      Identities
 	stream          stream.Stream
+	streamOptions   stream.Options
 	mockoffset      int64
 	raft            raft.Server
+	// Offsets commits from raft log indexes, once promoted from a replica.
+	base uint64
+	// The primary's nodes, if the DB follows one. See WithFollow.
+	following []string
+	quotas    *Quotas
+	// Run on events written through this node. See WithValidator.
+	validators []validator
+	// Run on the leader before events are appended. See WithTransformer.
+	transformers []transformer
+	// How long closed streams are kept, 0 to keep them forever.
+	RetentionDuration time.Duration
+	// Size in bytes closed streams are merged up to, 0 to never compact them.
+	CompactionTarget int64
+	// Set while the stream is failing. See StreamError.
+	failing  int32
+	rotation *rotation
+	// Set as the node stops, so stream operations are no longer retried.
+	stopping int32
+	// Times taking each raft snapshot.
+	stimer Timer
+	// When the open stream is synced. See WithDurability.
+	durability   stream.Durability
+	syncInterval time.Duration
+	// The last commit applied. See DB.Applied.
+	appliedCommit uint64
+	// When the leader snapshots besides rotations. See WithSnapshotPolicy.
+	snapshotEntries  uint64
+	snapshotInterval time.Duration
+	snapshots        snapshots
+	// Buckets events are indexed by under TIMESTAMP_INDEX, 0 for none.
+	timestampResolution time.Duration
+	// Ids of the events last written, so they're not written again.
+	dedup *dedup
+	// Values of UniqueIndexes written to retained streams.
+	uniques Uniques
+	// Compactions merging in the background. See CompactCommand.
+	merges merges
+	// Bodies of redacted events, applied as they're read.
+	redactions Redactions
+	// Set while a rebalance is scheduled for streams fetched to be read.
+	rebalancing int32
 }
 
-func NewDb(path string) *DB {
+func NewDb(path string, opts ...Option) (*DB, error) {
 	db := &DB{
 		dir:             path,
 		reader:          NewReader(path),
 		wtimer:          NilTimer{},
 		rtimer:          NilTimer{},
+		stimer:          NilTimer{},
+		supervisor:      newSupervisor(),
+		logger:          stdLogger{},
+		watch:           NewWatch(),
+		recent:          NewRecent(),
 		RotateThreshold: DEFAULT_ROTATE_THRESHOLD,
 		SnapshotBuffer:  DEFAULT_SNAPSHOT_BUFFER,
+		UniqueIndexes:   make(map[string]bool),
+		tombstones:      make(Tombstones),
+		deleted:         make(Deletions),
+		rewrites:        make(Rewrites),
+		spans:           make(Spans),
+		placement:       make(Placement),
+		identities:      make(Identities),
+		dedup:           newDedup(DEFAULT_DEDUPLICATION_WINDOW),
+		uniques:         make(Uniques),
+		redactions:      make(Redactions),
 	}
 
-	db.Rotate(1, 0)
+	db.reader.fetched = db.fetched
 
-	return db
+	for _, opt := range opts {
+		if err := opt(db); err != nil {
+			return nil, err
+		}
+	}
+
+	// Followers take the primary's streams rather than writing their own.
+	if !db.Following() {
+		if err := db.Rotate(1, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
 
+func newSupervisor() *Supervisor {
+	s := NewSupervisor(DefaultErrorHook)
+	s.SetRetryPolicy("snapshot", DefaultSnapshotRetryPolicy)
+	s.SetRetryPolicy("rebalance", DefaultRebalanceRetryPolicy)
+	return s
 }
 
 func (db *DB) Offset() int64 {
@@ -71,68 +166,197 @@ func (db *DB) setRaft(r raft.Server) {
 	db.raft = r
 }
 
-func (db *DB) Write(commit uint64, body []byte, indexes map[string]string, timestamp int64) error {
+func (db *DB) Write(commit uint64, body []byte, grouping string, indexes map[string]string, timestamp int64) error {
 	if commit <= db.current {
 		// old commit
+		db.recordClosed(commit, []map[string]string{indexes})
 		return nil
 	}
 
 	if db.stream == nil {
-		bytes, _ := stream.Serialize(body, indexes, map[string]int64{})
-		db.mockoffset += int64(len(bytes))
-		return nil
+		return db.replay([][]byte{body}, []string{grouping}, []map[string]string{indexes}, nil, timestamp)
+	}
 
+	if err := db.finishRotation(); err != nil {
+		return err
 	}
 
-	db.wtimer.Time(func() {
-		_, err := db.stream.Write(body, indexes)
-		if err != nil {
-			log.Fatal(err)
-		}
+	if err := db.checkUnique([]map[string]string{indexes}); err != nil {
+		return err
+	}
+
+	var err error
+
+	timeStream(db.wtimer, db.current, func() {
+		err = db.writeEvent(body, db.timestamped(groupedIndexes(grouping, indexes), timestamp), nil)
 	})
 
+	if err != nil {
+		return err
+	}
+
 	if timestamp > db.MostRecent {
 		db.MostRecent = timestamp
 	}
 
+	db.span = db.span.add(timestamp)
+	db.recent.Add(indexes, timestamp)
+	db.applied(body, indexes, "")
+
+	db.watch.Notify()
+
 	return nil
 }
 
-func (db *DB) WriteAll(commit uint64, bodies [][]byte, indexes []map[string]string, timestamp int64) error {
+func (db *DB) WriteAll(commit uint64, bodies [][]byte, groupings []string, indexes []map[string]string, timestamp int64) error {
+	return db.writeAll(commit, bodies, groupings, indexes, nil, nil, timestamp)
+}
+
+// Writes the events, as WriteAll, each with the headers and id at its
+// position, if any. Events with the id of one already written are
+// dropped. See WithDeduplication.
+func (db *DB) writeAll(commit uint64, bodies [][]byte, groupings []string, indexes, headers []map[string]string, ids []string, timestamp int64) error {
 	if commit <= db.current {
 		// old commit
+		db.recordClosed(commit, indexes)
+		return nil
+	}
+
+	if bodies, groupings, indexes, headers, ids = db.deduplicate(bodies, groupings, indexes, headers, ids); len(bodies) == 0 {
 		return nil
 	}
 
 	if db.stream == nil {
-		for i, body := range bodies {
-			bytes, _ := stream.Serialize(body, indexes[i], map[string]int64{})
-			db.mockoffset += int64(len(bytes))
-		}
+		return db.replay(bodies, groupings, indexes, ids, timestamp)
+	}
 
-		return nil
+	if err := db.finishRotation(); err != nil {
+		return err
 	}
 
-	db.wtimer.Time(func() {
-		for i, body := range bodies {
-			_, err := db.stream.Write(body, indexes[i])
-			if err != nil {
-				log.Fatal(err)
+	if err := db.checkUnique(indexes); err != nil {
+		return err
+	}
+
+	var err error
+	var written int
+
+	timeStream(db.wtimer, db.current, func() {
+		for written < len(bodies) && err == nil {
+			err = db.writeEvent(bodies[written], db.timestamped(groupedIndexes(groupingAt(groupings, written), indexes[written]), timestamp), headersAt(headers, written))
+
+			if err == nil {
+				written += 1
 			}
 		}
 	})
 
-	if timestamp > db.MostRecent {
-		db.MostRecent = timestamp
+	if written > 0 {
+		if timestamp > db.MostRecent {
+			db.MostRecent = timestamp
+		}
+
+		db.span = db.span.add(timestamp)
+	}
+
+	// Events before one which failed remain written.
+	for i, body := range bodies[:written] {
+		db.recent.Add(indexes[i], timestamp)
+		db.applied(body, indexes[i], idAt(ids, i))
+	}
+
+	db.watch.Notify()
+
+	return err
+}
+
+// Counts events the log replays into a stream closed already towards
+// the offset it's rotated at, recording them as though written. Events
+// refused or dropped when first written are again, so aren't counted.
+func (db *DB) replay(bodies [][]byte, groupings []string, indexes []map[string]string, ids []string, timestamp int64) error {
+	if err := db.checkUnique(indexes); err != nil {
+		return err
+	}
+
+	for i, body := range bodies {
+		bytes, _ := stream.Serialize(body, db.timestamped(groupedIndexes(groupingAt(groupings, i), indexes[i]), timestamp), map[string]int64{})
+		db.mockoffset += int64(len(bytes))
+		db.applied(body, indexes[i], idAt(ids, i))
 	}
 
 	return nil
 }
 
+// Records an event applied to the stream, whether written or replayed,
+// so those with its id or unique values are refused after, and counts
+// it towards the total bytes of its quotas.
+func (db *DB) applied(body []byte, indexes map[string]string, id string) {
+	db.quotas.record(body, indexes)
+	db.dedup.add(id)
+	db.recordUnique(indexes)
+}
+
+// Writes the event to the open stream. If only syncing it fails, it's
+// synced again rather than written twice.
+func (db *DB) writeEvent(body []byte, indexes, headers map[string]string) error {
+	appended := false
+
+	return db.retryStream("write", db.current, func() (err error) {
+		if appended {
+			return db.stream.Sync()
+		}
+
+		written, err := db.stream.WriteWithHeaders(body, indexes, headers)
+		appended = written > 0
+
+		return err
+	})
+}
+
+// Rotates once the events written at the commit have filled the
+// current stream, auditing the rotation first. The events were written,
+// so failures are only logged, and the rotation is retried before the
+// next are.
+func (db *DB) rotateIfFull(commit, term uint64, timestamp int64) {
+	if db.Offset() <= db.RotateThreshold {
+		return
+	}
+
+	if err := db.auditRotation(commit, timestamp); err != nil {
+		db.logger.Println("AUDIT: Failed to record", AUDIT_ROTATE, err)
+	}
+
+	if err := db.Rotate(commit, term); err != nil {
+		db.logger.Println("ROTATE:", err)
+	}
+}
+
+// Records the current stream's rotation to the stream at the commit.
+func (db *DB) auditRotation(commit uint64, timestamp int64) error {
+	return db.audit(commit, AUDIT_ROTATE, map[string]interface{}{
+		"closed":  db.current,
+		"current": commit,
+	}, timestamp)
+}
+
+// Closes the current stream, and creates the next at the commit. If
+// either fails, the rotation is retried before anything else is
+// written, leaving the current stream open if it couldn't be closed.
+// See retryStream.
 func (db *DB) Rotate(commit, term uint64) error {
-	s, err := db.retrieveStream(commit, false)
-	if err != nil && !strings.Contains(err.Error(), "no such file or directory") {
-		log.Fatal(err)
+	var s stream.Stream
+
+	err := db.retryStream("open", commit, func() (err error) {
+		if s, err = db.retrieveStream(commit, false); err == stream.STREAM_NOT_FOUND || err == RETRIEVED_OPEN_STREAM {
+			err = nil
+		}
+
+		return err
+	})
+
+	if err != nil {
+		db.rotation = &rotation{commit, term}
+		return err
 	}
 
 	if s != nil && s.Closed() {
@@ -140,62 +364,178 @@ func (db *DB) Rotate(commit, term uint64) error {
 		db.stream = nil
 		db.mockoffset = 10
 		db.current = commit
-	} else {
-		if db.stream != nil {
-			start := time.Now()
+		db.rotation = nil
 
-			db.rtimer.Time(func() {
-				err = db.stream.Close() // TODO async close?
-				if err != nil {
-					log.Fatal(err)
-				}
+		return nil
+	}
 
-				db.addClosed(db.current)
+	// Closed already if only creating the next stream failed.
+	if db.stream != nil && !db.stream.Closed() {
+		start := time.Now()
 
-				log.Println("STREAM: Closed", db.current, "in", time.Since(start))
-			})
+		timeStream(db.rtimer, db.current, func() {
+			err = db.retryStream("close", db.current, db.stream.Close) // TODO async close?
+		})
 
-			db.snapshot(commit, term)
+		if err != nil {
+			db.rotation = &rotation{commit, term}
+			return err
 		}
 
-		db.setCurrent(commit)
+		db.addClosed(db.current)
+		db.closeSpan(db.current)
+
+		db.logger.Println("STREAM: Closed", db.current, "in", time.Since(start))
+
+		db.snapshot(commit-db.base, term)
+		db.replan()
 	}
 
+	err = db.retryStream("create", commit, func() error {
+		return db.setCurrent(commit)
+	})
+
+	if err != nil {
+		db.rotation = &rotation{commit, term}
+		return err
+	}
+
+	db.rotation = nil
+
 	return nil
 }
 
 func (db *DB) ScanAll(name, value string, after uint64, scanner stream.Scanner) error {
-	db.reader.Update(db.peerConnectionStrings(), db.closed, db.current, db.stream)
+	db.refreshReader()
 	return db.reader.ScanAll(name, value, after, scanner)
 }
 
 func (db *DB) Scan(name, value string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
-	db.reader.Update(db.peerConnectionStrings(), db.closed, db.current, db.stream)
-	return db.reader.Scan(name, value, after, continuation, scanner)
+	return db.ScanContext(context.Background(), name, value, after, continuation, scanner)
+}
+
+// Scans as Scan, stopping early once the context is done. See Reader.ScanContext.
+func (db *DB) ScanContext(ctx context.Context, name, value string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	db.refreshReader()
+	return db.reader.ScanContext(ctx, name, value, after, continuation, scanner)
+}
+
+// Scans all events written with the given grouping, most recent first.
+// Groupings are chained under a reserved index rather than partitioning
+// streams, whose events stay in the order written. See GROUPING_INDEX.
+func (db *DB) ScanGrouping(grouping string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	return db.Scan(stream.GROUPING_INDEX, grouping, after, continuation, scanner)
+}
+
+// Scans the events written with every one of the index values, most
+// recent first, such as those with both customer=123 and type=purchase.
+func (db *DB) ScanIndexes(indexes map[string]string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	return db.ScanIndexesContext(context.Background(), indexes, after, continuation, scanner)
+}
+
+func (db *DB) ScanIndexesContext(ctx context.Context, indexes map[string]string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	db.refreshReader()
+	return db.reader.ScanIndexesContext(ctx, indexes, after, continuation, scanner)
+}
+
+// Scans the events with a value of the index beginning with the prefix,
+// most recent first, such as every customer in a namespace.
+func (db *DB) ScanPrefix(name, prefix string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	return db.ScanPrefixContext(context.Background(), name, prefix, after, continuation, scanner)
+}
+
+func (db *DB) ScanPrefixContext(ctx context.Context, name, prefix string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	db.refreshReader()
+	return db.reader.ScanPrefixContext(ctx, name, prefix, after, continuation, scanner)
 }
 
 func (db *DB) Iterate(after uint64, continuation string, scanner stream.Scanner) (string, error) {
-	db.reader.Update(db.peerConnectionStrings(), db.closed, db.current, db.stream)
-	return db.reader.Iterate(after, continuation, scanner)
+	return db.IterateContext(context.Background(), after, continuation, scanner)
+}
+
+// Iterates as Iterate, stopping early once the context is done.
+func (db *DB) IterateContext(ctx context.Context, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	db.refreshReader()
+	return db.reader.IterateContext(ctx, after, continuation, scanner)
+}
+
+// Iterates all events from newest to oldest, as used to page through
+// the most recent first.
+func (db *DB) IterateReverse(after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	return db.IterateReverseContext(context.Background(), after, continuation, scanner)
+}
+
+func (db *DB) IterateReverseContext(ctx context.Context, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	db.refreshReader()
+	return db.reader.IterateReverseContext(ctx, after, continuation, scanner)
+}
+
+// The DB's streams and what's been deleted or rewritten in them.
+func (db *DB) metadata() Metadata {
+	return Metadata{
+		Closed:     db.closed,
+		Current:    db.current,
+		MostRecent: db.MostRecent,
+		Indexes:    db.recent.All(),
+		Tombstones: db.tombstones,
+		Deleted:    db.deleted,
+		Redactions: db.redactions,
+		Revision:   db.revision,
+		Rewrites:   db.rewrites,
+		Spans:      db.spans,
+		Span:       db.span,
+	}
 }
 
 func (db *DB) Continuation(name, value string) string {
 	if db.stream != nil {
 		if offset, err := db.stream.First(name, value); err == nil && offset > 0 {
-			return db.reader.buildContinuation(db.current, offset)
+			return db.reader.buildScanContinuation(db.current, offset, name, value)
 		}
 	}
 
-	db.reader.Update(db.peerConnectionStrings(), db.closed, db.current, db.stream)
-	return db.reader.buildContinuation(db.reader.Prev(math.MaxUint64), 0)
+	db.refreshReader()
+	return db.reader.buildScanContinuation(db.reader.Prev(math.MaxUint64), 0, name, value)
+}
+
+func (db *DB) refreshReader() {
+	db.reader.Update(uniqueStrings(append(db.peerConnectionStrings(), db.following...)), db.closed, db.current, db.stream)
+	db.reader.SetTombstones(db.tombstones)
+	db.reader.SetDeleted(db.deleted)
+	db.reader.SetRedactions(db.redactions)
+	db.reader.SetRevision(db.revision)
+	db.reader.SetRewrites(db.rewrites)
+	db.reader.SetSpans(db.spans, db.span)
+}
+
+// Returns an ETag for the page of scan results, unless the page
+// may change. See Reader.ETag.
+func (db *DB) ETag(query, continuation string) (string, bool) {
+	// Closed streams change while being redacted in the background.
+	if atomic.LoadInt32(&db.redacting) > 0 {
+		return "", false
+	}
+
+	db.refreshReader()
+	return db.reader.ETag(query, continuation)
 }
 
-func (db *DB) Compress(start, stop uint64) {
+// Compresses the closed streams between start and stop into the stream
+// merged from them. A node whose merged stream was merged with other
+// removals than the leader's, as given, fetches the leader's instead.
+func (db *DB) Compress(index, start, stop uint64, removals string) {
 	newclosed := make([]uint64, 0, len(db.closed))
+	merged := make([]uint64, 0)
+	rewritten := map[uint64]Rewrite{start: {Into: start}}
+	into := make(map[uint64]uint64)
 
 	for _, commit := range db.closed {
 		if commit < start || commit > stop {
 			newclosed = append(newclosed, commit)
+		} else if commit != start {
+			merged = append(merged, commit)
+			rewritten[commit] = Rewrite{Into: start}
+			into[commit] = start
 		}
 	}
 
@@ -203,13 +543,59 @@ func (db *DB) Compress(start, stop uint64) {
 
 	sort.Sort(OffsetSlice(newclosed))
 
-	if _, err := os.Open(db.reader.compressedpath(start)); !os.IsNotExist(err) {
-		if err := os.Rename(db.reader.compressedpath(start), db.reader.Path(start)); err != nil {
-			log.Fatal(err)
+	unmerged := db.merges.end(start)
+
+	if removals != "" && db.mergedRemovals(start) != removals {
+		os.Remove(db.reader.compressedpath(start))
+		unmerged = true
+	}
+
+	os.Remove(db.reader.removalspath(start))
+
+	// Swapped while holding the stream's lock, so reads of it either
+	// finish with the original, or wait and open the compressed one.
+	if _, err := os.Stat(db.reader.compressedpath(start)); !os.IsNotExist(err) {
+		err = db.reader.replaceStream(start, func() error {
+			return os.Rename(db.reader.compressedpath(start), db.reader.Path(start))
+		})
+
+		// The stream doesn't hold what was merged into it, so it's
+		// fetched from the leader's compressed copy instead.
+		if err != nil {
+			db.logger.Println("Unable to replace compressed stream:", start, err)
+
+			os.Remove(db.reader.compressedpath(start))
+			db.reader.replaceStream(start, func() error {
+				return os.RemoveAll(db.reader.Path(start))
+			})
+
+			db.fetchCompacted(start)
 		}
+	} else if unmerged {
+		db.fetchCompacted(start)
 	}
 
 	db.closed = newclosed
+	db.compressTombstones(start, stop)
+	db.compressDeletions(start, stop)
+	db.compressRedactions(start, stop)
+	db.compressSpans(start, stop)
+	db.moveUniques(into)
+	db.rewrite(index, rewritten)
+
+	// Space is short, so rather than waiting for esdb-cleanup, free
+	// the streams which were merged into the compressed one now.
+	if db.disk.Low() {
+		for _, commit := range merged {
+			db.reader.replaceStream(commit, func() error {
+				err := os.Remove(db.reader.Path(commit))
+				if err != nil && !os.IsNotExist(err) {
+					db.logger.Println("DISK: Unable to remove compressed stream:", err)
+				}
+				return nil
+			})
+		}
+	}
 }
 
 func (db *DB) retrieveStream(commit uint64, fetchMissing bool) (stream.Stream, error) {
@@ -220,8 +606,18 @@ func (db *DB) retrieveStream(commit uint64, fetchMissing bool) (stream.Stream, e
 	return db.reader.retrieveStream(commit, fetchMissing)
 }
 
+// Saves the snapshot raft takes, limited by the throttle, as it's
+// written while writes and scans compete for the disk.
 func (db *DB) SaveAt(index, term uint64) ([]byte, error) {
-	return db.Save()
+	state, err := db.Save()
+	if err != nil || db.throttle == nil {
+		return state, err
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(state)))
+	_, err = io.Copy(db.throttle.Writer(buf), bytes.NewReader(state))
+
+	return buf.Bytes(), err
 }
 
 func (db *DB) Save() ([]byte, error) {
@@ -236,25 +632,194 @@ func (db *DB) Save() ([]byte, error) {
 		binary.WriteInt64(buf, int64(commit))
 	}
 
-	return buf.Bytes(), nil
+	writeTombstones(buf, db.tombstones)
+	writeDeletions(buf, db.deleted)
+	binary.WriteInt64(buf, int64(db.revision))
+
+	binary.WriteBool(buf, atomic.LoadInt32(&db.readonly) == 1)
+
+	writeRewrites(buf, db.rewrites)
+	writeSpans(buf, db.spans)
+	writeRecent(buf, db.recent)
+	writePlacement(buf, db.placement)
+	writeIdentities(buf, db.identities)
+	binary.WriteInt64(buf, int64(db.base))
+	writeTotals(buf, db.quotas.totals())
+	writeExpired(buf, db.rewrites)
+	writeDedup(buf, db.dedup)
+	writeUniques(buf, db.uniques)
+	writeRedactions(buf, db.redactions)
+
+	return encodeSnapshot(buf.Bytes()), nil
 }
 
 func (db *DB) Recovery(b []byte) error {
-	buf := bytes.NewBuffer(b)
+	payload, version, err := decodeSnapshot(b)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(payload)
+
+	current, err := binary.ReadInt64Full(buf)
+	if err != nil {
+		return err
+	}
+
+	if db.Following() {
+		db.current = uint64(current)
+	} else if err = db.setCurrent(uint64(current)); err != nil {
+		return err
+	}
 
-	db.setCurrent(uint64(binary.ReadInt64(buf)))
-	db.MostRecent = binary.ReadInt64(buf)
+	if db.MostRecent, err = binary.ReadInt64Full(buf); err != nil {
+		return err
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
 
-	count := int(binary.ReadUvarint(buf))
+	for i := int64(0); i < count && err == nil; i++ {
+		var commit int64
 
-	for i := 0; i < count; i++ {
-		db.addClosed(uint64(binary.ReadInt64(buf)))
+		if commit, err = binary.ReadInt64Full(buf); err == nil {
+			db.addClosed(uint64(commit))
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !savedFields(buf, version, 1) {
+		return nil
+	}
+
+	if db.tombstones, err = readTombstones(buf); err != nil {
+		return err
+	}
+
+	if db.deleted, err = readDeletions(buf); err != nil {
+		return err
+	}
+
+	if savedFields(buf, version, 1) {
+		var revision int64
+
+		if revision, err = binary.ReadInt64Full(buf); err != nil {
+			return err
+		}
+
+		db.revision = uint64(revision)
+	}
+
+	if savedFields(buf, version, 1) {
+		readonly, err := binary.ReadBoolFull(buf)
+		if err != nil {
+			return err
+		}
+
+		db.setReadOnly(readonly)
+	}
+
+	if db.rewrites, err = readRewrites(buf); err != nil {
+		return err
+	}
+
+	if db.spans, err = readSpans(buf, version); err != nil {
+		return err
+	}
+
+	if db.recent, err = readRecent(buf); err != nil {
+		return err
+	}
+
+	if !savedFields(buf, version, 2) {
+		return nil
+	}
+
+	if db.placement, err = readPlacement(buf); err != nil {
+		return err
+	}
+
+	if db.identities, err = readIdentities(buf); err != nil {
+		return err
+	}
+
+	if savedFields(buf, version, 2) {
+		var base int64
+
+		if base, err = binary.ReadInt64Full(buf); err != nil {
+			return err
+		}
+
+		db.base = uint64(base)
+	}
+
+	totals, err := readTotals(buf)
+	if err != nil {
+		return err
+	}
+
+	db.quotas.setTotals(totals)
+
+	if err = readExpired(buf, db.rewrites); err != nil {
+		return err
+	}
+
+	if err = readDedup(buf, db.dedup); err != nil {
+		return err
+	}
+
+	if db.uniques, err = readUniques(buf, version, db.UniqueIndexes); err != nil {
+		return err
+	}
+
+	if db.redactions, err = readRedactions(buf); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Groupings are stored in each stream as a reserved index, which
+// chains all events in the grouping together within the stream.
+func groupedIndexes(grouping string, indexes map[string]string) map[string]string {
+	if grouping == "" {
+		return indexes
+	}
+
+	grouped := make(map[string]string, len(indexes)+1)
+
+	for name, value := range indexes {
+		grouped[name] = value
+	}
+
+	grouped[stream.GROUPING_INDEX] = grouping
+
+	return grouped
+}
+
+func groupingAt(groupings []string, i int) string {
+	if i < len(groupings) {
+		return groupings[i]
+	}
+
+	return ""
+}
+
+func headersAt(headers []map[string]string, i int) map[string]string {
+	if i < len(headers) {
+		return headers[i]
 	}
 
 	return nil
 }
 
 func (db *DB) peerConnectionStrings() []string {
+	if db.raft == nil {
+		return []string{}
+	}
+
 	peers := make([]string, 0, len(db.raft.Peers()))
 
 	for _, peer := range db.raft.Peers() {
@@ -271,44 +836,65 @@ func (db *DB) addClosed(commit uint64) {
 		}
 	}
 
-	db.closed = append(db.closed, commit)
-}
+	// Shared with readers scanning concurrently, so replaced rather
+	// than sorted in place.
+	closed := make([]uint64, len(db.closed), len(db.closed)+1)
+	copy(closed, db.closed)
+	closed = append(closed, commit)
 
-func (db *DB) setCurrent(commit uint64) {
-	db.current = commit
-	db.mockoffset = 10
+	sort.Sort(OffsetSlice(closed))
+	db.closed = closed
+}
 
+func (db *DB) setCurrent(commit uint64) error {
 	err := os.Remove(db.reader.Path(commit))
-	if err != nil && !strings.Contains(err.Error(), "no such file or directory") {
-		log.Fatal(err)
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
 
-	s, err := stream.New(db.reader.Path(commit))
+	s, err := stream.NewWithOptions(db.reader.Path(commit), db.openStreamOptions())
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
+	db.current = commit
+	db.mockoffset = 10
 	db.stream = s
 
-	log.Println("STREAM: Creating", db.current)
+	db.logger.Println("STREAM: Creating", db.current)
+
+	return nil
 }
 
 func (db *DB) snapshot(index, term uint64) {
-	log.Println("RAFT SNAPSHOT: Starting...")
+	db.logger.Println("RAFT SNAPSHOT: Starting...")
 
 	start := time.Now()
+	applied := index
 
-	go (func() {
-		if index > db.SnapshotBuffer {
-			index = index - db.SnapshotBuffer
-		} else {
-			index = 0
-		}
+	if index > db.SnapshotBuffer {
+		index = index - db.SnapshotBuffer
+	} else {
+		index = 0
+	}
 
-		if err := db.raft.TakeSnapshotFrom(index, term); err != nil {
-			panic(err)
-		}
+	db.snapshotStarted(applied, index, term)
+
+	go func() {
+		db.snapshotFinished(db.supervisor.Run("snapshot", func() error {
+			var err error
+
+			db.stimer.Time(func() {
+				err = db.raft.TakeSnapshotFrom(index, term)
+			})
+
+			if err != nil {
+				return err
+			}
+
+			db.logger.Println("RAFT SNAPSHOT: Complete in", time.Since(start))
 
-		log.Println("RAFT SNAPSHOT: Complete in", time.Since(start))
-	})()
+			return nil
+		}))
+	}()
 }
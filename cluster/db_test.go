@@ -1,7 +1,13 @@
 package cluster
 
 import (
+	"github.com/customerio/esdb/binary"
+	"github.com/customerio/esdb/stream"
+
+	"bytes"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -9,7 +15,8 @@ func createDb() *DB {
 	os.RemoveAll("tmp")
 	os.MkdirAll("tmp", 0755)
 
-	return NewDb("tmp")
+	db, _ := NewDb("tmp")
+	return db
 }
 
 func TestDir(t *testing.T) {
@@ -25,11 +32,334 @@ func TestMostRecent(t *testing.T) {
 
 	db.setCurrent(1)
 
-	db.Write(2, []byte("hello"), map[string]string{}, 1415118695524660)
-	db.Write(3, []byte("hello"), map[string]string{}, 1415118695524662)
-	db.Write(4, []byte("hello"), map[string]string{}, 1415118695524661)
+	db.Write(2, []byte("hello"), "", map[string]string{}, 1415118695524660)
+	db.Write(3, []byte("hello"), "", map[string]string{}, 1415118695524662)
+	db.Write(4, []byte("hello"), "", map[string]string{}, 1415118695524661)
 
 	if db.MostRecent != 1415118695524662 {
 		t.Errorf("Incorrect most recent. Want: %v, Got: %v", 1415118695524662, db.MostRecent)
 	}
 }
+
+func TestUniqueIndexes(t *testing.T) {
+	db := createDb()
+
+	db.setCurrent(1)
+	db.UniqueIndexes["id"] = true
+
+	if err := db.Write(2, []byte("a"), "", map[string]string{"id": "1"}, 1); err != nil {
+		t.Errorf("Unexpected error writing unique event: %v", err)
+	}
+
+	err := db.Write(3, []byte("b"), "", map[string]string{"id": "1", "type": "b"}, 2)
+
+	if conflict, ok := err.(*UniqueConflictError); !ok || conflict.Index != "id" || conflict.Value != "1" {
+		t.Errorf("Expected unique conflict for id:1, got: %v", err)
+	}
+
+	if err := db.Write(4, []byte("c"), "", map[string]string{"id": "2"}, 3); err != nil {
+		t.Errorf("Unexpected error writing unique event: %v", err)
+	}
+
+	err = db.WriteAll(5, [][]byte{[]byte("d"), []byte("e")}, nil, []map[string]string{{"id": "3"}, {"id": "3"}}, 4)
+
+	if _, ok := err.(*UniqueConflictError); !ok {
+		t.Errorf("Expected unique conflict within batch, got: %v", err)
+	}
+
+	for _, index := range []string{"type:b", "id:3"} {
+		parts := strings.SplitN(index, ":", 2)
+
+		if offset, _ := db.stream.First(parts[0], parts[1]); offset != 0 {
+			t.Errorf("Rejected event for %v was written to the stream at: %v", index, offset)
+		}
+	}
+}
+
+func TestUniqueIndexesWithoutStreams(t *testing.T) {
+	db := createDb()
+
+	db.setCurrent(1)
+	db.UniqueIndexes["id"] = true
+
+	db.Write(2, []byte("a"), "", map[string]string{"id": "1"}, 1)
+	db.Rotate(3, 1)
+
+	// Checked against recorded values, even with the stream only held by peers.
+	os.Remove(db.reader.Path(1))
+
+	snapshot, _ := db.Save()
+
+	restored := createDb()
+	restored.UniqueIndexes["id"] = true
+
+	if err := restored.Recovery(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := restored.Write(4, []byte("b"), "", map[string]string{"id": "1"}, 2).(*UniqueConflictError); !ok {
+		t.Errorf("Expected a unique conflict after recovering, found: %v", restored.uniques)
+	}
+
+	// Values of expired streams can be written again.
+	restored.expire(5, []uint64{1})
+
+	if err := restored.Write(6, []byte("c"), "", map[string]string{"id": "1"}, 3); err != nil {
+		t.Errorf("Unexpected error writing a value of an expired stream: %v", err)
+	}
+}
+
+func TestUniqueIndexesReplayed(t *testing.T) {
+	db := createDb()
+
+	db.setCurrent(1)
+	db.UniqueIndexes["id"] = true
+
+	db.Write(2, []byte("a"), "", map[string]string{"id": "1"}, 1)
+	db.Write(3, []byte("b"), "", map[string]string{"id": "1"}, 2)
+	db.Rotate(4, 1)
+
+	// Restarting without a snapshot replays the log into the closed stream.
+	replayed, _ := NewDb("tmp")
+	replayed.UniqueIndexes["id"] = true
+
+	if replayed.stream != nil {
+		t.Fatalf("Expected the closed stream to be replayed into")
+	}
+
+	if err := replayed.Write(2, []byte("a"), "", map[string]string{"id": "1"}, 1); err != nil {
+		t.Errorf("Unexpected error replaying unique event: %v", err)
+	}
+
+	offset := replayed.Offset()
+
+	if _, ok := replayed.Write(3, []byte("b"), "", map[string]string{"id": "1"}, 2).(*UniqueConflictError); !ok {
+		t.Errorf("Expected the refused event to be refused again")
+	}
+
+	if replayed.Offset() != offset {
+		t.Errorf("Expected the refused event not to be counted, offset: %v, wanted: %v", replayed.Offset(), offset)
+	}
+
+	replayed.Rotate(4, 1)
+
+	if _, ok := replayed.Write(5, []byte("c"), "", map[string]string{"id": "1"}, 3).(*UniqueConflictError); !ok {
+		t.Errorf("Expected a unique conflict after replaying, found: %v", replayed.uniques)
+	}
+}
+
+func TestUniqueIndexNames(t *testing.T) {
+	db := createDb()
+
+	db.setCurrent(1)
+	db.UniqueIndexes["a"] = true
+	db.UniqueIndexes["a:b"] = true
+
+	db.Write(2, []byte("a"), "", map[string]string{"a:b": "c"}, 1)
+
+	if err := db.Write(3, []byte("b"), "", map[string]string{"a": "b:c"}, 2); err != nil {
+		t.Errorf("Unexpected conflict between names containing ':': %v", err)
+	}
+}
+
+func TestUpgradingUniques(t *testing.T) {
+	buf := new(bytes.Buffer)
+	writeUniques(buf, Uniques{"user:id:1": 3, "email:a": 5})
+
+	uniques, err := readUniques(buf, 2, map[string]bool{"user": true, "user:id": true})
+
+	if err != nil || !reflect.DeepEqual(uniques, Uniques{uniqueKey("user:id", "1"): 3}) {
+		t.Errorf("Expected keys to be upgraded, found: %v %v", uniques, err)
+	}
+}
+
+func TestIteratingInCommitOrder(t *testing.T) {
+	db := createDb()
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 1)
+	db.Rotate(3, 1)
+	db.Write(4, []byte("b"), "", map[string]string{"a": "1"}, 2)
+	db.Rotate(5, 1)
+	db.Write(6, []byte("c"), "", map[string]string{"a": "1"}, 3)
+	db.Rotate(7, 1)
+
+	// As though recovered from peers in whichever order they responded.
+	db.closed = []uint64{5, 1, 3}
+
+	found := make([]string, 0)
+
+	continuation, _ := db.Iterate(0, "", func(e *stream.Event) bool {
+		found = append(found, string(e.Data))
+		return len(found) < 2
+	})
+
+	if !reflect.DeepEqual(found, []string{"a", "b"}) {
+		t.Errorf("Incorrect iteration order. Wanted: [a b], found: %v", found)
+	}
+
+	found = found[:0]
+
+	db.Iterate(0, continuation, func(e *stream.Event) bool {
+		found = append(found, string(e.Data))
+		return true
+	})
+
+	if !reflect.DeepEqual(found, []string{"c"}) {
+		t.Errorf("Incorrect iteration from continuation %v. Wanted: [c], found: %v", continuation, found)
+	}
+}
+
+func TestContinuationAtTimestamp(t *testing.T) {
+	db := createDb()
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 10)
+	db.Rotate(3, 1)
+	db.Write(4, []byte("b"), "", map[string]string{"a": "1"}, 20)
+	db.Rotate(5, 1)
+	db.Write(6, []byte("c"), "", map[string]string{"a": "1"}, 30)
+
+	var tests = []struct {
+		timestamp int64
+		events    []string
+	}{
+		{5, []string{"a", "b", "c"}},
+		{10, []string{"a", "b", "c"}},
+		{15, []string{"b", "c"}},
+		{30, []string{"c"}},
+		{31, []string{}},
+	}
+
+	for i, test := range tests {
+		found := make([]string, 0)
+
+		db.Iterate(0, db.ContinuationAt(test.timestamp), func(e *stream.Event) bool {
+			found = append(found, string(e.Data))
+			return true
+		})
+
+		if !reflect.DeepEqual(found, test.events) {
+			t.Errorf("Case #%v: Incorrect events. Wanted: %v, found: %v", i, test.events, found)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	writeSpans(buf, db.spans)
+
+	if found, err := readSpans(buf, SNAPSHOT_VERSION); err != nil || !reflect.DeepEqual(found, db.spans) {
+		t.Errorf("Incorrect recovered spans. Wanted: %v, found: %v %v", db.spans, found, err)
+	}
+
+	// Older snapshots wrote the last timestamp in full.
+	buf.Reset()
+	binary.WriteUvarint(buf, 1)
+	binary.WriteInt64(buf, 1)
+	binary.WriteInt64(buf, 10)
+	binary.WriteInt64(buf, 30)
+
+	if found, err := readSpans(buf, 2); err != nil || !reflect.DeepEqual(found, Spans{1: {10, 30}}) {
+		t.Errorf("Incorrect spans recovered from version 2: %v %v", found, err)
+	}
+}
+
+func TestContinuationAtBackfilledTimestamp(t *testing.T) {
+	db := createDb()
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 30)
+	db.Rotate(3, 1)
+	db.Write(4, []byte("b"), "", map[string]string{"a": "1"}, 5)
+	db.Rotate(5, 1)
+	db.Write(6, []byte("c"), "", map[string]string{"a": "1"}, 40)
+
+	found := make([]string, 0)
+
+	db.Iterate(0, db.ContinuationAt(20), func(e *stream.Event) bool {
+		found = append(found, string(e.Data))
+		return true
+	})
+
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(found, want) {
+		t.Errorf("Incorrect events. Wanted: %v, found: %v", want, found)
+	}
+}
+
+func TestMostRecentByIndex(t *testing.T) {
+	db := createDb()
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1", "b": "1"}, 10)
+	db.Write(3, []byte("b"), "", map[string]string{"a": "2"}, 20)
+	db.WriteAll(4, [][]byte{[]byte("c"), []byte("d")}, []string{}, []map[string]string{{"c": "1"}, {"b": "2"}}, 15)
+
+	recent := map[string]int64{"a": 20, "b": 15, "c": 15}
+
+	if found := db.recent.All(); !reflect.DeepEqual(found, recent) {
+		t.Errorf("Incorrect most recent. Wanted: %v, found: %v", recent, found)
+	}
+
+	if found := db.recent.Get("d"); found != 0 {
+		t.Errorf("Incorrect most recent of unknown index. Wanted: 0, found: %v", found)
+	}
+
+	buf := new(bytes.Buffer)
+	writeRecent(buf, db.recent)
+
+	if found, err := readRecent(buf); err != nil || !reflect.DeepEqual(found.All(), recent) {
+		t.Errorf("Incorrect recovered most recent. Wanted: %v, found: %v %v", recent, found.All(), err)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	db := createDb()
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 10)
+	db.Rotate(3, 1)
+	db.Write(4, []byte("b"), "", map[string]string{"a": "1"}, 20)
+
+	// Only held by peers.
+	db.closed = append(db.closed, 2)
+
+	inventory, err := db.Inventory()
+	if err != nil {
+		t.Fatalf("Unable to list inventory: %v", err)
+	}
+
+	if len(inventory) != 3 {
+		t.Fatalf("Incorrect inventory size. Wanted: 3, found: %v", len(inventory))
+	}
+
+	var tests = []struct {
+		commit   uint64
+		state    string
+		location string
+		first    int64
+		digest   bool
+	}{
+		{1, STREAM_CLOSED, LOCATION_LOCAL, 10, true},
+		{2, STREAM_CLOSED, LOCATION_PEER, 0, false},
+		{3, STREAM_OPEN, LOCATION_LOCAL, 20, false},
+	}
+
+	for i, test := range tests {
+		info := inventory[i]
+
+		if info.Commit != test.commit || info.State != test.state || info.Location != test.location || info.First != test.first || (info.Digest != "") != test.digest {
+			t.Errorf("Case #%v: Incorrect stream info: %+v", i, info)
+		}
+	}
+}
+
+func TestAddingClosedStreamsCopies(t *testing.T) {
+	db := createDb()
+	// As a reader holds them, with room to append in place.
+	db.closed = append(make([]uint64, 0, 4), 3, 5)
+	shared := db.closed
+
+	db.addClosed(1)
+
+	if !reflect.DeepEqual(shared[:3], []uint64{3, 5, 0}) {
+		t.Errorf("Expected the streams readers share to be left alone, found: %v", shared[:cap(shared)])
+	}
+
+	if !reflect.DeepEqual(db.closed, []uint64{1, 3, 5}) {
+		t.Errorf("Incorrect closed streams. Wanted: [1 3 5], found: %v", db.closed)
+	}
+}
@@ -0,0 +1,159 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"errors"
+)
+
+// The ids remembered by WithDeduplication, if not given.
+const DEFAULT_DEDUPLICATION_WINDOW = 10000
+
+var INVALID_DEDUPLICATION_WINDOW = errors.New("Deduplication window must not be negative")
+
+// Remembers the ids of the last window events written with one, so
+// those written again with the same id, e.g. by producers retrying a
+// write which timed out, are dropped rather than written twice. A
+// window of 0 is DEFAULT_DEDUPLICATION_WINDOW.
+//
+// Ids are checked as writes are applied, so every node of a cluster
+// must have the same window to drop the same events. Events without an
+// id are always written.
+func WithDeduplication(window int) Option {
+	return func(db *DB) error {
+		if window < 0 {
+			return INVALID_DEDUPLICATION_WINDOW
+		} else if window == 0 {
+			window = DEFAULT_DEDUPLICATION_WINDOW
+		}
+
+		db.dedup.resize(window)
+		return nil
+	}
+}
+
+// The ids of the most recent events written, oldest first.
+type dedup struct {
+	window int
+	seen   map[string]bool
+	order  []string
+}
+
+func newDedup(window int) *dedup {
+	return &dedup{window: window, seen: make(map[string]bool)}
+}
+
+func (d *dedup) contains(id string) bool {
+	return id != "" && d.seen[id]
+}
+
+// Remembers the id, forgetting the oldest once there are more than the window.
+func (d *dedup) add(id string) {
+	if id == "" || d.seen[id] {
+		return
+	}
+
+	d.seen[id] = true
+	d.order = append(d.order, id)
+
+	d.resize(d.window)
+}
+
+func (d *dedup) resize(window int) {
+	d.window = window
+
+	for len(d.order) > d.window {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+}
+
+// Whether any of the events have ids, so commands without any are
+// written to the raft log as they were before ids.
+func hasIds(ids []string) bool {
+	for _, id := range ids {
+		if id != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func idAt(ids []string, i int) string {
+	if i < len(ids) {
+		return ids[i]
+	}
+
+	return ""
+}
+
+// The events still to be written, leaving out those with the id of one
+// already written, or of one before them in the batch.
+func (db *DB) deduplicate(bodies [][]byte, groupings []string, indexes, headers []map[string]string, ids []string) ([][]byte, []string, []map[string]string, []map[string]string, []string) {
+	if !hasIds(ids) {
+		return bodies, groupings, indexes, headers, ids
+	}
+
+	keptBodies := make([][]byte, 0, len(bodies))
+	keptGroupings := make([]string, 0, len(bodies))
+	keptIndexes := make([]map[string]string, 0, len(bodies))
+	keptHeaders := make([]map[string]string, 0, len(bodies))
+	keptIds := make([]string, 0, len(bodies))
+
+	pending := make(map[string]bool)
+
+	for i, body := range bodies {
+		id := idAt(ids, i)
+
+		if db.dedup.contains(id) || pending[id] {
+			continue
+		}
+
+		if id != "" {
+			pending[id] = true
+		}
+
+		keptBodies = append(keptBodies, body)
+		keptGroupings = append(keptGroupings, groupingAt(groupings, i))
+		keptIndexes = append(keptIndexes, indexes[i])
+		keptHeaders = append(keptHeaders, headersAt(headers, i))
+		keptIds = append(keptIds, id)
+	}
+
+	return keptBodies, keptGroupings, keptIndexes, keptHeaders, keptIds
+}
+
+// [uvarint:count]([uvarint:length][bytes:id])..., oldest first.
+func writeDedup(buf *bytes.Buffer, d *dedup) {
+	binary.WriteUvarint(buf, len(d.order))
+
+	for _, id := range d.order {
+		binary.WriteUvarint(buf, len(id))
+		buf.WriteString(id)
+	}
+}
+
+// Restores the ids written by writeDedup, keeping the newest within the window.
+func readDedup(buf *bytes.Buffer, d *dedup) error {
+	d.seen = make(map[string]bool)
+	d.order = nil
+
+	// Snapshots taken before events had ids have none.
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var id string
+
+		if id, err = binary.ReadStringMax(buf, int64(buf.Len())); err == nil {
+			d.add(id)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"reflect"
+	"testing"
+)
+
+func TestDeduplicatesEventsById(t *testing.T) {
+	withNode(func(n *Node) {
+		indexes := []map[string]string{{"customer": "1"}, {"customer": "1"}, {"customer": "1"}}
+
+		write := func(ids ...string) {
+			bodies := make([][]byte, len(ids))
+			for i, id := range ids {
+				bodies[i] = []byte(id + "-" + string(rune('a'+i)))
+			}
+
+			if _, err := n.WriteEventsWithIds(bodies, nil, indexes[:len(ids)], nil, ids, ACK_LEADER); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		write("1", "2")
+		// Retried, with a repeat within the batch and an event without an id.
+		write("2", "", "3")
+		write("3", "3")
+
+		var found []string
+
+		n.db.Scan("customer", "1", 0, "", func(e *stream.Event) bool {
+			found = append(found, string(e.Data))
+			return true
+		})
+
+		if want := []string{"3-c", "-b", "2-b", "1-a"}; !reflect.DeepEqual(found, want) {
+			t.Errorf("Wrong events written. Wanted: %v, found: %v", want, found)
+		}
+	})
+}
+
+func TestDeduplicationWindow(t *testing.T) {
+	d := newDedup(2)
+
+	for _, id := range []string{"a", "b", "a", "c"} {
+		d.add(id)
+	}
+
+	if d.contains("a") || !d.contains("b") || !d.contains("c") || d.contains("") {
+		t.Errorf("Expected only the last 2 ids to be remembered, found: %v", d.order)
+	}
+
+	if _, err := NewDb("tmp", WithDeduplication(-1)); err != INVALID_DEDUPLICATION_WINDOW {
+		t.Errorf("Wrong error for a negative window: %v", err)
+	}
+}
+
+func TestDeduplicationSnapshot(t *testing.T) {
+	db := createDb()
+	db.dedup.add("a")
+	db.dedup.add("b")
+
+	snapshot, _ := db.Save()
+
+	restored := createDb()
+	restored.dedup.resize(1)
+
+	if err := restored.Recovery(snapshot); err != nil {
+		t.Fatalf("Unable to recover snapshot: %v", err)
+	}
+
+	if !reflect.DeepEqual(restored.dedup.order, []string{"b"}) || !restored.dedup.contains("b") {
+		t.Errorf("Expected the newest ids within the window to be restored, found: %v", restored.dedup.order)
+	}
+}
+
+func TestDeduplicationReplayed(t *testing.T) {
+	db := createDb()
+	db.setCurrent(1)
+
+	bodies := [][]byte{[]byte("a")}
+	indexes := []map[string]string{{"customer": "1"}}
+
+	db.writeAll(2, bodies, nil, indexes, nil, []string{"1"}, 1)
+	db.writeAll(3, bodies, nil, indexes, nil, []string{"1"}, 2)
+	db.Rotate(4, 1)
+
+	// Restarting without a snapshot replays the log into the closed stream.
+	replayed, _ := NewDb("tmp")
+
+	replayed.writeAll(2, bodies, nil, indexes, nil, []string{"1"}, 1)
+	offset := replayed.Offset()
+	replayed.writeAll(3, bodies, nil, indexes, nil, []string{"1"}, 2)
+
+	if replayed.Offset() != offset {
+		t.Errorf("Expected the dropped event not to be counted, offset: %v, wanted: %v", replayed.Offset(), offset)
+	}
+
+	if !replayed.dedup.contains("1") {
+		t.Errorf("Expected the replayed id to be remembered, found: %v", replayed.dedup.order)
+	}
+}
@@ -0,0 +1,52 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (n *Node) deleteEventsHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body.Close()
+
+	role, ok := n.auth.Authorize(w, req, WRITE)
+	if !ok {
+		return
+	}
+
+	if req.Method != "POST" {
+		w.WriteHeader(404)
+		return
+	}
+
+	index := req.FormValue("index")
+	value := req.FormValue("value")
+
+	if index == "" {
+		w.WriteHeader(400)
+		return
+	}
+
+	if !role.Allows(index, value) {
+		Deny(w, FORBIDDEN)
+		return
+	}
+
+	err := n.Delete(index, value)
+
+	if err == NOT_LEADER_ERROR {
+		respond(w, n.notLeader(w))
+		return
+	}
+
+	body := make(map[string]interface{})
+
+	if err != nil {
+		body = Fail(w, err)
+	} else {
+		body["deleted"] = map[string]string{index: value}
+	}
+
+	js, _ := json.MarshalIndent(body, "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
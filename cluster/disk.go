@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	DEFAULT_SOFT_WATERMARK = 0.85
+	DEFAULT_HARD_WATERMARK = 0.95
+	DEFAULT_DISK_INTERVAL  = 10 * time.Second
+)
+
+var DISK_FULL = errors.New("Disk usage above hard watermark, rejecting writes")
+var INVALID_WATERMARKS = errors.New("Watermarks must satisfy 0 < soft <= hard <= 1")
+
+// Returns the fraction of the volume holding path which is in use,
+// counting space reserved for root as unavailable, like df does.
+var diskUsage = func(path string) (float64, error) {
+	var fs syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, err
+	}
+
+	used := fs.Blocks - fs.Bfree
+	total := used + fs.Bavail
+
+	if total == 0 {
+		return 0, nil
+	}
+
+	return float64(used) / float64(total), nil
+}
+
+// DiskMonitor periodically checks how full the data volume is. Above
+// the soft watermark the node frees space more aggressively, and above
+// the hard watermark new writes are rejected with DISK_FULL before
+// they reach raft, rather than failing mid-apply once the disk fills.
+// A nil DiskMonitor never reports the disk as full.
+type DiskMonitor struct {
+	path  string
+	soft  float64
+	hard  float64
+	usage uint64
+	stop  chan bool
+	mutex sync.Mutex
+}
+
+func NewDiskMonitor(path string, soft, hard float64) (*DiskMonitor, error) {
+	if soft <= 0 || soft > hard || hard > 1 {
+		return nil, INVALID_WATERMARKS
+	}
+
+	return &DiskMonitor{path: path, soft: soft, hard: hard}, nil
+}
+
+// Refreshes the current usage of the volume.
+func (m *DiskMonitor) Check() (float64, error) {
+	usage, err := diskUsage(m.path)
+	if err != nil {
+		return 0, err
+	}
+
+	previous := m.Usage()
+
+	atomic.StoreUint64(&m.usage, math.Float64bits(usage))
+
+	if usage >= m.hard && previous < m.hard {
+		log.Printf("DISK: %.1f%% used, above hard watermark of %.1f%%, rejecting writes", usage*100, m.hard*100)
+	} else if usage >= m.soft && previous < m.soft {
+		log.Printf("DISK: %.1f%% used, above soft watermark of %.1f%%", usage*100, m.soft*100)
+	}
+
+	return usage, nil
+}
+
+// Checks the volume every interval until stopped, marking the
+// supervisor's "disk" task degraded while above the hard watermark.
+func (m *DiskMonitor) Start(interval time.Duration, supervisor *Supervisor) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.stop != nil {
+		return
+	}
+
+	m.stop = make(chan bool)
+
+	check := func() error {
+		if _, err := m.Check(); err != nil {
+			return err
+		}
+
+		if m.Full() {
+			return fmt.Errorf("%.1f%% of disk in use", m.Usage()*100)
+		}
+
+		return nil
+	}
+
+	supervisor.Run("disk", check)
+
+	go func(stop chan bool) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				supervisor.Run("disk", check)
+			case <-stop:
+				return
+			}
+		}
+	}(m.stop)
+}
+
+func (m *DiskMonitor) Stop() {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// The fraction of the volume in use when last checked.
+func (m *DiskMonitor) Usage() float64 {
+	if m == nil {
+		return 0
+	}
+
+	return math.Float64frombits(atomic.LoadUint64(&m.usage))
+}
+
+// Whether usage is above the soft watermark.
+func (m *DiskMonitor) Low() bool {
+	return m != nil && m.Usage() >= m.soft
+}
+
+// Whether usage is above the hard watermark.
+func (m *DiskMonitor) Full() bool {
+	return m != nil && m.Usage() >= m.hard
+}
@@ -0,0 +1,93 @@
+package cluster
+
+import (
+	"os"
+	"testing"
+)
+
+func withDiskUsage(usage float64, perform func()) {
+	original := diskUsage
+	diskUsage = func(path string) (float64, error) { return usage, nil }
+	defer func() { diskUsage = original }()
+
+	perform()
+}
+
+func TestDiskWatermarks(t *testing.T) {
+	if _, err := NewDiskMonitor("tmp", 0.9, 0.8); err != INVALID_WATERMARKS {
+		t.Errorf("Expected invalid watermarks, found: %v", err)
+	}
+
+	var tests = []struct {
+		usage float64
+		low   bool
+		full  bool
+	}{
+		{0.5, false, false},
+		{0.85, true, false},
+		{0.97, true, true},
+	}
+
+	for i, test := range tests {
+		withDiskUsage(test.usage, func() {
+			m, _ := NewDiskMonitor("tmp", 0.8, 0.95)
+			m.Check()
+
+			if m.Low() != test.low || m.Full() != test.full {
+				t.Errorf("Case #%v: Wanted low: %v full: %v, found low: %v full: %v", i, test.low, test.full, m.Low(), m.Full())
+			}
+		})
+	}
+
+	var m *DiskMonitor
+
+	if m.Low() || m.Full() {
+		t.Errorf("Nil monitor shouldn't report the disk as full")
+	}
+}
+
+func TestRejectingWritesWhenDiskFull(t *testing.T) {
+	withNode(func(n *Node) {
+		withDiskUsage(0.99, func() {
+			n.SetWatermarks(0.8, 0.95)
+			n.db.disk.Check()
+
+			if err := n.Event([]byte("a"), "", map[string]string{"a": "1"}); err != DISK_FULL {
+				t.Errorf("Expected disk full error, found: %v", err)
+			}
+		})
+
+		withDiskUsage(0.1, func() {
+			n.db.disk.Check()
+
+			if err := n.Event([]byte("a"), "", map[string]string{"a": "1"}); err != nil {
+				t.Errorf("Expected write to succeed, found: %v", err)
+			}
+		})
+	})
+}
+
+func TestRemovingCompressedStreamsWhenDiskLow(t *testing.T) {
+	withDiskUsage(0.9, func() {
+		db := createDb()
+		db.disk, _ = NewDiskMonitor("tmp", 0.8, 0.95)
+		db.disk.Check()
+
+		db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 0)
+		db.Rotate(3, 1)
+		db.Write(4, []byte("b"), "", map[string]string{"a": "1"}, 0)
+		db.Rotate(5, 1)
+
+		os.Link(db.reader.Path(1), db.reader.compressedpath(1))
+
+		db.Compress(6, 1, 3, "")
+
+		if _, err := os.Stat(db.reader.Path(3)); !os.IsNotExist(err) {
+			t.Errorf("Expected compressed stream to be removed, found: %v", err)
+		}
+
+		if _, err := os.Stat(db.reader.Path(1)); err != nil {
+			t.Errorf("Expected merged stream to remain, found: %v", err)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package cluster
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var DRAINING_ERROR = errors.New("Node is draining")
+
+// DrainStatus reports the progress of draining a node before it's
+// stopped. Once Safe, the node holds no leadership, has no scans in
+// flight, and stopping it won't interrupt anything.
+type DrainStatus struct {
+	Draining bool   `json:"draining"`
+	Leader   bool   `json:"leader"`
+	InFlight int    `json:"inflight"`
+	Rotated  bool   `json:"rotated"`
+	Safe     bool   `json:"safe"`
+	Error    string `json:"error,omitempty"`
+}
+
+// drainer counts the requests being served, so draining
+// can wait until every one of them has finished.
+type drainer struct {
+	status DrainStatus
+	idle   *sync.Cond
+	mutex  sync.Mutex
+}
+
+func newDrainer() *drainer {
+	d := &drainer{}
+	d.idle = sync.NewCond(&d.mutex)
+	return d
+}
+
+// Records the start of a request, returning false
+// if it shouldn't be served as the node is draining.
+func (d *drainer) begin() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.status.Draining {
+		return false
+	}
+
+	d.status.InFlight += 1
+	return true
+}
+
+func (d *drainer) end() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.status.InFlight -= 1
+
+	if d.status.InFlight == 0 {
+		d.idle.Broadcast()
+	}
+}
+
+// Stops new requests being served, returning false if already draining.
+func (d *drainer) start() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.status.Draining {
+		return false
+	}
+
+	d.status.Draining = true
+	return true
+}
+
+func (d *drainer) wait() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for d.status.InFlight > 0 {
+		d.idle.Wait()
+	}
+}
+
+func (d *drainer) update(f func(s *DrainStatus)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	f(&d.status)
+}
+
+func (d *drainer) current() DrainStatus {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.status
+}
+
+// Serves the request unless the node is draining, in which
+// case a 503 is returned so clients retry on another node.
+func (n *Node) drained(handler func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !n.drain.begin() {
+			respond(w, Fail(w, DRAINING_ERROR))
+			return
+		}
+
+		defer n.drain.end()
+
+		handler(w, req)
+	}
+}
+
+// Prepares the node to be stopped, in the background. New requests
+// are refused, and if leader, the current stream is closed on every
+// node by rotating it. Raft is then stopped, so if the node was
+// leader another is elected, as raft can't hand leadership over.
+// Finally it waits for requests in flight to finish. Use DrainStatus
+// to find out when it's safe to stop the node.
+func (n *Node) Drain() {
+	if !n.drain.start() {
+		return
+	}
+
+	n.db.logger.Println("DRAIN: Draining node")
+
+	go func() {
+		n.drain.wait()
+
+		// Followers have no current stream of their own to close.
+		if n.raft != nil && n.raft.State() == "leader" && !n.db.Following() {
+			_, err := n.raft.Do(NewRotateCommand(time.Now().UnixNano()))
+
+			n.drain.update(func(s *DrainStatus) {
+				if err != nil {
+					s.Error = err.Error()
+				} else {
+					s.Rotated = true
+				}
+			})
+		}
+
+		if n.raft != nil && n.raft.Running() {
+			n.raft.Stop()
+		}
+
+		n.drain.update(func(s *DrainStatus) { s.Safe = true })
+
+		n.db.logger.Println("DRAIN: Safe to stop")
+	}()
+}
+
+func (n *Node) DrainStatus() DrainStatus {
+	status := n.drain.current()
+
+	if n.raft != nil {
+		status.Leader = n.raft.Running() && n.raft.State() == "leader"
+	}
+
+	return status
+}
@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainingNode(t *testing.T) {
+	withNode(func(n *Node) {
+		trackevent(n, []byte("a"), map[string]string{"a": "1"})
+
+		current := n.db.current
+
+		// A scan still in flight.
+		n.drain.begin()
+
+		n.Drain()
+
+		handler := n.drained(func(w http.ResponseWriter, req *http.Request) {
+			t.Errorf("Served request while draining")
+		})
+
+		req, _ := http.NewRequest("GET", "/events?index=a&value=1", nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if w.Code != 503 {
+			t.Errorf("Incorrect response while draining. Wanted: 503, found: %v", w.Code)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		if status := n.DrainStatus(); status.Safe || status.InFlight != 1 {
+			t.Errorf("Drained before scan finished: %v", status)
+		}
+
+		n.drain.end()
+
+		for i := 0; i < 100 && !n.DrainStatus().Safe; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		status := n.DrainStatus()
+
+		if !status.Safe || !status.Rotated || status.Leader {
+			t.Errorf("Incorrect status once drained: %v", status)
+		}
+
+		if !n.db.isClosed(current) {
+			t.Errorf("Expected stream %v to be closed after draining", current)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"sync/atomic"
+	"time"
+)
+
+// Syncs the open stream to disk as the policy says. SYNC_ALWAYS syncs
+// once the events of each command are written, so a batch of them, or
+// writes queued together, share a sync, while SYNC_INTERVAL syncs every
+// interval if written meanwhile. Events acknowledged before they're
+// synced are lost if the node crashes, though not by the cluster, so
+// long as a quorum of nodes hasn't crashed too.
+func WithDurability(d stream.Durability, interval time.Duration) Option {
+	return func(db *DB) error {
+		if err := (stream.Options{Durability: d, SyncInterval: interval}).Validate(); err != nil {
+			return err
+		}
+
+		db.durability, db.syncInterval = d, interval
+		return nil
+	}
+}
+
+// The options streams are created with, which sync in the background
+// if written with SYNC_INTERVAL. The DB syncs streams itself otherwise.
+func (db *DB) openStreamOptions() stream.Options {
+	opts := db.streamOptions
+
+	if db.durability == stream.SYNC_INTERVAL {
+		opts.Durability, opts.SyncInterval = db.durability, db.syncInterval
+	}
+
+	return opts
+}
+
+// Syncs the open stream once a command's events are written at the
+// commit, if the command asked it to be or every command's events are,
+// then records the commit as applied.
+func (db *DB) syncWritten(commit uint64, requested bool) error {
+	if db.stream != nil && (requested || db.durability == stream.SYNC_ALWAYS) {
+		if err := db.stream.Sync(); err != nil {
+			return err
+		}
+	}
+
+	atomic.StoreUint64(&db.appliedCommit, commit)
+	return nil
+}
+
+// The last commit whose events were written, and synced if asked, so
+// quorum writes wait on nodes having applied theirs. See ACK_QUORUM.
+func (db *DB) Applied() uint64 {
+	return atomic.LoadUint64(&db.appliedCommit)
+}
@@ -0,0 +1,124 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// How an error is reported over HTTP: the status responded with, a
+// code clients can branch on, and whether retrying may succeed.
+type ErrorKind struct {
+	Status    int
+	Code      string
+	Retryable bool
+	// Seconds to wait before retrying, sent as Retry-After if set.
+	RetryAfter int
+}
+
+var INTERNAL_ERROR = ErrorKind{500, "internal", true, 0}
+
+var MALFORMED_BODY = errors.New("Malformed request body")
+var INVALID_TIME = errors.New("Invalid time, expected RFC 3339")
+var TOO_MANY_QUERIES = errors.New("Too many queries in the batch")
+
+var errorKinds = map[error]ErrorKind{
+	NOT_LEADER_ERROR:         {400, "not_leader", true, 0},
+	NO_LEADER_ERROR:          {503, "no_leader", true, 1},
+	DRAINING_ERROR:           {503, "draining", true, 0},
+	READ_ONLY_ERROR:          {503, "read_only", true, 0},
+	FOLLOWER_ERROR:           {400, "follower", false, 0},
+	CATCHING_UP:              {503, "catching_up", true, 5},
+	OVERLOADED:               {503, "rate_limited", true, 1},
+	DISK_FULL:                {507, "disk_full", false, 0},
+	UNAUTHENTICATED:          {401, "unauthenticated", false, 0},
+	FORBIDDEN:                {403, "forbidden", false, 0},
+	RESERVED_INDEX:           {400, "reserved_index", false, 0},
+	INVALID_EXPIRY:           {400, "invalid_expiry", false, 0},
+	INVALID_ACK:              {400, "invalid_ack", false, 0},
+	QUORUM_TIMEOUT:           {504, "quorum_timeout", false, 0},
+	MALFORMED_CONTINUATION:   {400, "malformed_continuation", false, 0},
+	FORGED_CONTINUATION:      {400, "forged_continuation", false, 0},
+	MISMATCHED_CONTINUATION:  {400, "mismatched_continuation", false, 0},
+	MALFORMED_BODY:           {400, "malformed_body", false, 0},
+	INVALID_TIME:             {400, "invalid_time", false, 0},
+	TOO_MANY_QUERIES:         {400, "too_many_queries", false, 0},
+	UNKNOWN_STREAM_FORMAT:    {400, "unknown_format", false, 0},
+	REDACTING_UNKNOWN_STREAM: {400, "stream_not_closed", false, 0},
+	SPLITTING_UNKNOWN_STREAM: {400, "stream_not_closed", false, 0},
+	TOO_MANY_SPLITS:          {400, "too_many_splits", false, 0},
+	SPLIT_OUTDATED:           {400, "split_outdated", true, 0},
+	MERGE_OUTDATED:           {400, "merge_outdated", true, 0},
+	stream.STREAM_NOT_FOUND:  {404, "stream_missing", false, 0},
+}
+
+// Classifies the error, treating any not otherwise known as internal.
+func Classify(err error) ErrorKind {
+	switch e := err.(type) {
+	case *ExpiredContinuationError:
+		return ErrorKind{410, "continuation_expired", false, 0}
+	case *MissingStreamError:
+		return ErrorKind{503, "stream_missing", true, 5}
+	case *UniqueConflictError:
+		return ErrorKind{409, "unique_conflict", false, 0}
+	case *ValidationError:
+		return ErrorKind{400, "invalid_event", false, 0}
+	case *StreamError:
+		return ErrorKind{503, "stream_failed", true, 1}
+	case *QuotaExceededError:
+		return ErrorKind{429, "quota_exceeded", e.Limit != QUOTA_TOTAL_BYTES, e.retryAfter()}
+	}
+
+	if kind, ok := errorKinds[err]; ok {
+		return kind
+	}
+
+	return INTERNAL_ERROR
+}
+
+// Responds with the error's status and retry hint, returning the body
+// to report it with, which further details may be added to.
+func Fail(w http.ResponseWriter, err error) map[string]interface{} {
+	kind := Classify(err)
+
+	if kind.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(kind.RetryAfter))
+	}
+
+	w.WriteHeader(kind.Status)
+
+	return errorBody(err)
+}
+
+// Describes the error, by its message, code and whether it's retryable.
+func errorBody(err error) map[string]interface{} {
+	kind := Classify(err)
+
+	return map[string]interface{}{
+		"error":     err.Error(),
+		"code":      kind.Code,
+		"retryable": kind.Retryable,
+	}
+}
+
+// Points the client to the leader with a not_leader error, or fails
+// with NO_LEADER_ERROR if there isn't one.
+func (n *Node) notLeader(w http.ResponseWriter) map[string]interface{} {
+	uri, err := n.LeaderConnectionString()
+	if err != nil {
+		return Fail(w, err)
+	}
+
+	w.Header().Set("Cluster-Leader", uri)
+
+	return Fail(w, NOT_LEADER_ERROR)
+}
+
+func respond(w http.ResponseWriter, body map[string]interface{}) {
+	js, _ := json.MarshalIndent(body, "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	for i, test := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{NOT_LEADER_ERROR, 400, "not_leader"},
+		{OVERLOADED, 503, "rate_limited"},
+		{&ExpiredContinuationError{"1:2"}, 410, "continuation_expired"},
+		{&MissingStreamError{"events.1.stream"}, 503, "stream_missing"},
+		{&UniqueConflictError{"a", "b"}, 409, "unique_conflict"},
+		{errors.New("failed"), 500, "internal"},
+	} {
+		if kind := Classify(test.err); kind.Status != test.status || kind.Code != test.code {
+			t.Errorf("Case #%v: Wanted: %v %v, found: %v %v", i, test.status, test.code, kind.Status, kind.Code)
+		}
+	}
+}
+
+func TestFail(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	res := Fail(w, OVERLOADED)
+
+	if w.Code != 503 || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Wanted a 503 to retry after 1s, found: %v %v", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	if res["error"] != OVERLOADED.Error() || res["code"] != "rate_limited" || res["retryable"] != true {
+		t.Errorf("Incorrect error body: %v", res)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	withNode(func(n *Node) {
+		req := httptest.NewRequest("POST", "/events", strings.NewReader("x"))
+		w := httptest.NewRecorder()
+
+		n.mux.ServeHTTP(w, req)
+
+		var res map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &res)
+
+		if w.Code != 400 || res["code"] != "malformed_body" || res["error"] != MALFORMED_BODY.Error() {
+			t.Errorf("Incorrect error response: %v %v", w.Code, w.Body.String())
+		}
+
+		err := parseError(strings.NewReader(w.Body.String()))
+
+		if e, ok := err.(*APIError); !ok || e.Code != "malformed_body" || e.Retryable {
+			t.Errorf("Expected the client to parse the error, found: %#v", err)
+		}
+	})
+}
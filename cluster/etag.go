@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// Sets the revision of closed streams' contents, which changes
+// whenever events within them are deleted or redacted.
+func (r *Reader) SetRevision(revision uint64) {
+	r.revision = revision
+}
+
+// Returns an ETag for a page of scan results starting from the
+// continuation. Scans run from newest to oldest, so a page starting
+// within a closed stream can only contain events from closed streams,
+// and won't change until the revision does, unless its events expire.
+// Other pages have no ETag.
+func (r *Reader) ETag(query, continuation string) (string, bool) {
+	if continuation == "" {
+		return "", false
+	}
+
+	commit, _, err := r.parseContinuation(continuation, true)
+
+	if err != nil || commit == r.current || !r.isClosed(commit) {
+		return "", false
+	}
+
+	sum := sha1.Sum([]byte(fmt.Sprint(query, "|", continuation, "|", r.revision)))
+
+	return `"` + hex.EncodeToString(sum[:]) + `"`, true
+}
+
+func (r *Reader) isClosed(commit uint64) bool {
+	for _, c := range r.closed {
+		if c == commit {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sets the ETag on the response, returning true and responding
+// with 304 if the client already has this version of the page.
+func NotModified(w http.ResponseWriter, req *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	if match := req.Header.Get("If-None-Match"); match == etag || match == "*" {
+		w.WriteHeader(304)
+		return true
+	}
+
+	return false
+}
+
+// Removes the ETag set by NotModified from a page which will change
+// without the revision doing so, as its events expire, so clients don't
+// cache it. Pages given an ETag had none, so still don't.
+func Uncacheable(w http.ResponseWriter) {
+	w.Header().Del("ETag")
+}
+
+// Identifies a scan for ETags. Pages also depend on how many events,
+// and bytes of them, are requested, so the limits are included.
+func ScanQuery(index, value, grouping string, after int64, limit, maxBytes int) string {
+	return fmt.Sprint(index, ":", value, "|", grouping, "|", after, "|", limit, "|", PageBytes(maxBytes))
+}
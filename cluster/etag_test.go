@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	r := NewReader("tmp")
+	r.Update([]string{}, []uint64{1, 3}, 5, nil)
+
+	if _, ok := r.ETag("a:b", ""); ok {
+		t.Errorf("First page includes the current stream, so should have no ETag")
+	}
+
+	if _, ok := r.ETag("a:b", "5:10"); ok {
+		t.Errorf("Page starting in the current stream should have no ETag")
+	}
+
+	etag, ok := r.ETag("a:b", "3:10")
+	if !ok {
+		t.Fatalf("Page starting in a closed stream should have an ETag")
+	}
+
+	if other, _ := r.ETag("a:c", "3:10"); other == etag {
+		t.Errorf("Different queries should have different ETags")
+	}
+
+	req, _ := http.NewRequest("GET", "/events", nil)
+	req.Header.Set("If-None-Match", etag)
+
+	if w := httptest.NewRecorder(); !NotModified(w, req, etag) || w.Code != 304 {
+		t.Errorf("Matching ETag should not be modified")
+	}
+
+	r.SetRevision(7)
+
+	if revised, _ := r.ETag("a:b", "3:10"); revised == etag {
+		t.Errorf("ETag should change with the revision")
+	}
+}
+
+func TestQueryETags(t *testing.T) {
+	base := Query{Index: "a", Value: "b"}
+
+	shaped := []Query{
+		{Index: "a", Value: "b", Limit: 5},
+		{Index: "a", Value: "b", MaxBytes: 100},
+		{Index: "a", Value: "b", Reverse: true},
+		{Index: "a", Value: "b", Prefix: true},
+		{Index: "a", Value: "b", Since: 1},
+	}
+
+	for i, q := range shaped {
+		if q.etag() == base.etag() {
+			t.Errorf("Case #%v: Expected the page's shape to change the ETag: %v", i, q.etag())
+		}
+	}
+
+	if defaulted := (Query{Index: "a", Value: "b", MaxBytes: MAX_PAGE_BYTES}); defaulted.etag() != base.etag() {
+		t.Errorf("Expected the default page size to have the same ETag")
+	}
+}
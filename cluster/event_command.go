@@ -2,19 +2,22 @@ package cluster
 
 import (
 	"github.com/jrallison/raft"
-
-	"log"
 )
 
 type EventCommand struct {
 	Body      []byte            `json:"body"`
+	Grouping  string            `json:"grouping,omitempty"`
 	Indexes   map[string]string `json:"indexes"`
 	Timestamp int64             `json:"timestamp"`
+	// Drops the event if one with the id was written recently. See
+	// WithDeduplication.
+	Id string `json:"id,omitempty"`
 }
 
-func NewEventCommand(body []byte, indexes map[string]string, timestamp int64) *EventCommand {
+func NewEventCommand(body []byte, grouping string, indexes map[string]string, timestamp int64) *EventCommand {
 	return &EventCommand{
 		Body:      body,
+		Grouping:  grouping,
 		Indexes:   indexes,
 		Timestamp: timestamp,
 	}
@@ -28,15 +31,26 @@ func (c *EventCommand) Apply(context raft.Context) (interface{}, error) {
 	server := context.Server()
 	db := server.Context().(*DB)
 
-	index := context.CurrentIndex()
+	if db.ReadOnly() {
+		return new(interface{}), READ_ONLY_ERROR
+	}
+
+	index := db.commit(context.CurrentIndex())
+
+	var ids []string
 
-	err := db.Write(index, c.Body, c.Indexes, c.Timestamp)
+	if c.Id != "" {
+		ids = []string{c.Id}
+	}
+
+	err := db.writeAll(index, [][]byte{c.Body}, []string{c.Grouping}, []map[string]string{c.Indexes}, nil, ids, c.Timestamp)
+
+	if err == nil {
+		err = db.syncWritten(index, false)
+	}
 
-	if err == nil && db.Offset() > db.RotateThreshold {
-		err = db.Rotate(index, context.CurrentTerm())
-		if err != nil {
-			log.Fatal(err)
-		}
+	if err == nil {
+		db.rotateIfFull(index, context.CurrentTerm(), c.Timestamp)
 	}
 
 	return new(interface{}), err
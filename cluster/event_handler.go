@@ -1,8 +1,6 @@
 package cluster
 
 import (
-	"log"
-
 	"github.com/customerio/esdb/stream"
 
 	"encoding/json"
@@ -10,128 +8,240 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
 )
 
-type event struct {
-	Body    string            `json:"body"`
-	Indexes map[string]string `json:"indexes"`
-}
-
 func (n *Node) eventHandler(w http.ResponseWriter, req *http.Request) {
-	res := make(map[string]interface{})
+	var res interface{} = map[string]interface{}{}
 	var err error
 
-	log.Println(req.Method, req.URL)
+	n.db.logger.Println(req.Method, req.URL)
 
 	switch req.Method {
 	case "POST":
-		res, err = index(n, w, req)
+		role, ok := n.auth.Authorize(w, req, WRITE)
+		if !ok {
+			req.Body.Close()
+			return
+		}
+
+		res, err = index(n, role, w, req)
 	case "GET":
-		res, err = scan(n, w, req)
+		role, ok := n.auth.Authorize(w, req, READ)
+		if !ok {
+			req.Body.Close()
+			return
+		}
+
+		res, err = scan(n, role, w, req)
 	default:
-		log.Println(req.Method, req.URL, 404)
+		n.db.logger.Println(req.Method, req.URL, 404)
 		w.WriteHeader(404)
 	}
 
 	if err != nil {
-		log.Println(req.Method, req.URL, 500, err)
-		w.WriteHeader(500)
-		res["error"] = err.Error()
+		n.db.logger.Println(req.Method, req.URL, Classify(err).Status, err)
+
+		// Scans which failed part way report what they found beforehand.
+		if found, ok := res.(*ScanResponse); ok {
+			Fail(w, err)
+			res = found.WithError(err)
+		} else {
+			res = Fail(w, err)
+		}
 	}
 
 	req.Body.Close()
 
+	// Nothing to write, the client's copy hasn't been modified.
+	if res == nil {
+		return
+	}
+
 	js, _ := json.MarshalIndent(res, "", "  ")
 	w.Write(js)
 	w.Write([]byte("\n"))
 }
 
-func index(n *Node, w http.ResponseWriter, req *http.Request) (map[string]interface{}, error) {
-	var data []*event
+func index(n *Node, role *Role, w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	var data []*EventRequest
 
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		return map[string]interface{}{}, errors.New("Error reading request body")
+		return nil, errors.New("Error reading request body")
 	}
 
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		log.Println(req.Method, req.URL, 400, "Malformed body:", string(body), err)
-		w.WriteHeader(400)
-		return map[string]interface{}{}, nil
+		n.db.logger.Println(req.Method, req.URL, 400, "Malformed body:", string(body), err)
+		return Fail(w, MALFORMED_BODY), nil
 	}
 
 	bodies := make([][]byte, len(data))
+	groupings := make([]string, len(data))
 	indexes := make([]map[string]string, len(data))
-	events := make([]map[string]interface{}, len(data))
+	headers := make([]map[string]string, len(data))
+	ids := make([]string, len(data))
+	events := make([]WrittenEvent, len(data))
 
 	for i, d := range data {
+		if !role.AllowsAll(d.Indexes) || (d.Grouping != "" && !role.Allows(stream.GROUPING_INDEX, d.Grouping)) {
+			n.db.logger.Println(req.Method, req.URL, 403, "Forbidden index")
+			return Fail(w, FORBIDDEN), nil
+		}
+
 		bodies[i] = []byte(d.Body)
-		indexes[i] = d.Indexes
-		events[i] = map[string]interface{}{
-			"event":   d.Body,
-			"indexes": d.Indexes,
+		groupings[i] = d.Grouping
+		indexes[i] = d.indexes()
+		headers[i] = d.Headers
+		ids[i] = d.Id
+		events[i] = WrittenEvent{
+			Event:    d.Body,
+			Grouping: d.Grouping,
+			Indexes:  indexes[i],
+			Headers:  d.Headers,
+			Id:       d.Id,
 		}
 	}
 
-	err = n.Events(bodies, indexes)
+	commit, err := n.WriteEventsWithIds(bodies, groupings, indexes, headers, ids, req.FormValue("ack"))
 
 	if err == NOT_LEADER_ERROR {
-		var uri string
-		uri, err = n.LeaderConnectionString()
-		w.Header().Set("Cluster-Leader", uri)
-
-		if err != nil {
-			return map[string]interface{}{}, err
-		} else {
-			log.Println(req.Method, req.URL, 400, "Not leader")
-			w.WriteHeader(400)
-			return map[string]interface{}{}, nil
+		if n.forwardToLeader(w, req, body) {
+			return nil, nil
 		}
+
+		n.db.logger.Println(req.Method, req.URL, 400, "Not leader")
+		return n.notLeader(w), nil
+	}
+
+	if conflict, ok := err.(*UniqueConflictError); ok {
+		n.db.logger.Println(req.Method, req.URL, 409, conflict)
+
+		res := Fail(w, conflict)
+		res["index"] = conflict.Index
+		res["value"] = conflict.Value
+
+		return res, nil
+	}
+
+	if invalid, ok := err.(*ValidationError); ok {
+		n.db.logger.Println(req.Method, req.URL, 400, invalid)
+
+		res := Fail(w, invalid)
+		res["event"] = invalid.Event
+		res["reason"] = invalid.Reason
+
+		return res, nil
 	}
 
 	if err != nil {
-		return map[string]interface{}{}, err
-	} else {
-		return map[string]interface{}{
-			"events": events,
-		}, nil
+		return nil, err
 	}
+
+	// Not yet written, so there's no commit to report.
+	if commit == 0 {
+		w.WriteHeader(202)
+	}
+
+	return WriteResponse{events, commit}, nil
 }
 
-func scan(n *Node, w http.ResponseWriter, req *http.Request) (map[string]interface{}, error) {
-	var count int
-	var err error
+func scan(n *Node, role *Role, w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	q, err := ParseQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !q.AllowedBy(role) {
+		n.db.logger.Println(req.Method, req.URL, 403, "Forbidden index")
+		return Fail(w, FORBIDDEN), nil
+	}
+
+	if !q.forward() {
+		if etag, ok := n.db.ETag(q.etag(), q.Continuation); ok && NotModified(w, req, etag) {
+			return nil, nil
+		}
+	}
+
+	wait, _ := time.ParseDuration(req.FormValue("wait"))
+
+	ctx, cancel := QueryContext(req)
+	defer cancel()
+
+	events, headers, continuation, expiring, err := q.poll(ctx, n.db, wait)
+
+	if expiring {
+		Uncacheable(w)
+	}
+
+	// Scans which couldn't start are reported without results, while
+	// those which failed part way report what they found beforehand.
+	if err != nil && (Classify(err).Status < 500 || err == OVERLOADED) {
+		return nil, err
+	}
+
+	res := &ScanResponse{
+		Events:       events,
+		Continuation: continuation,
+		MostRecent:   n.db.MostRecent,
+		Headers:      headers,
+	}
+
+	Paginate(res, req, continuation, q.limit(), len(events), q.forward())
+	Truncated(res, events, continuation, q.MaxBytes)
+	Partial(res, ctx)
 
-	index := req.FormValue("index")
-	value := req.FormValue("value")
+	return res, err
+}
+
+// The query given by an /events request's parameters, as nodes and
+// readers both serve it.
+func ParseQuery(req *http.Request) (Query, error) {
 	after, _ := strconv.ParseInt(req.FormValue("after"), 10, 64)
-	continuation := req.FormValue("continuation")
 	limit, _ := strconv.Atoi(req.FormValue("limit"))
+	max, _ := strconv.Atoi(req.FormValue("max_bytes"))
+
+	since, until, err := formWindow(req)
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{
+		Index:        req.FormValue("index"),
+		Value:        req.FormValue("value"),
+		Indexes:      formIndexes(req),
+		Prefix:       req.FormValue("prefix") == "true",
+		Grouping:     req.FormValue("grouping"),
+		After:        after,
+		Continuation: req.FormValue("continuation"),
+		Limit:        limit,
+		MaxBytes:     max,
+		Reverse:      req.FormValue("reverse") == "true",
+		Headers:      formHeaders(req),
+		Since:        since,
+		Until:        until,
+	}, nil
+}
 
-	events := make([]string, 0, limit)
+// Scans may give further indexes as repeated index and value
+// parameters, after the first, to find events with all of them.
+func formIndexes(req *http.Request) map[string]string {
+	names, values := req.Form["index"], req.Form["value"]
 
-	if limit == 0 {
-		limit = 20
+	if len(names) < 2 {
+		return nil
 	}
 
-	if index != "" {
-		continuation, err = n.db.Scan(index, value, uint64(after), continuation, func(e *stream.Event) bool {
-			count += 1
-			events = append(events, string(e.Data))
-			return count < limit
-		})
-	} else {
-		continuation, err = n.db.Iterate(uint64(after), continuation, func(e *stream.Event) bool {
-			count += 1
-			events = append(events, string(e.Data))
-			return count < limit
-		})
+	indexes := make(map[string]string, len(names)-1)
+
+	for i := 1; i < len(names); i++ {
+		if i < len(values) {
+			indexes[names[i]] = values[i]
+		} else {
+			indexes[names[i]] = ""
+		}
 	}
 
-	return map[string]interface{}{
-		"events":       events,
-		"continuation": continuation,
-		"most_recent":  n.db.MostRecent,
-	}, err
+	return indexes
 }
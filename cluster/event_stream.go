@@ -0,0 +1,196 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Formats events can be streamed in.
+const (
+	STREAM_SSE    = "sse"
+	STREAM_NDJSON = "ndjson"
+)
+
+// How long a streamed response may go without anything being written
+// before it's sent a heartbeat, so idle connections aren't dropped.
+const STREAM_HEARTBEAT = 15 * time.Second
+
+var UNKNOWN_STREAM_FORMAT = errors.New("Unknown stream format, expected sse or ndjson")
+
+// EventStream writes events to a response as they're found, flushing
+// each, so scans of any size are sent without being held in memory.
+//
+// As Server-Sent Events, each is a "message" whose data is the event,
+// and the scan ends with an "end" event whose data is a JSON object
+// with its continuation, or an "error" event if it failed. As newline
+// delimited JSON, each line is an object with either the event, or
+// how the scan ended. Heartbeats are SSE comments, or blank lines.
+type EventStream struct {
+	w       io.Writer
+	flusher http.Flusher
+	format  string
+	mutex   sync.Mutex
+	last    time.Time
+	err     error
+	ended   bool
+	stop    chan struct{}
+}
+
+// Starts the response, sending a heartbeat whenever nothing else has
+// been written for the interval, or none if it's 0.
+func NewEventStream(w http.ResponseWriter, format string, heartbeat time.Duration) (*EventStream, error) {
+	switch format {
+	case "", STREAM_SSE:
+		format = STREAM_SSE
+		w.Header().Set("Content-Type", "text/event-stream")
+	case STREAM_NDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		return nil, UNKNOWN_STREAM_FORMAT
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stops proxies such as nginx from buffering the response.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+
+	s := &EventStream{w: w, format: format, stop: make(chan struct{})}
+	s.flusher, _ = w.(http.Flusher)
+
+	s.mutex.Lock()
+	s.flush()
+	s.mutex.Unlock()
+
+	if heartbeat > 0 {
+		go s.heartbeat(heartbeat)
+	}
+
+	return s, nil
+}
+
+// Writes the event, returning false once the response can't be
+// written to, such as when the client has gone, so scans stop.
+func (s *EventStream) Send(e *stream.Event) bool {
+	if s.format == STREAM_SSE {
+		return s.write(sseMessage("", e.Data))
+	}
+
+	js, _ := json.Marshal(map[string]interface{}{"event": string(e.Data)})
+	return s.write(append(js, '\n'))
+}
+
+// Ends the stream, describing how the scan ended, along with the
+// error, if it failed.
+func (s *EventStream) End(res map[string]interface{}, err error) {
+	close(s.stop)
+
+	name := "end"
+
+	if err != nil {
+		name = "error"
+
+		for key, value := range errorBody(err) {
+			res[key] = value
+		}
+	}
+
+	js, _ := json.Marshal(res)
+
+	if s.format == STREAM_SSE {
+		js = sseMessage(name, js)
+	} else {
+		js = append(js, '\n')
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.writeLocked(js)
+
+	// Nothing else is written, even by a heartbeat already under way.
+	s.ended = true
+}
+
+func (s *EventStream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mutex.Lock()
+			idle := time.Since(s.last) >= interval
+			s.mutex.Unlock()
+
+			if !idle {
+				continue
+			}
+
+			if s.format == STREAM_SSE {
+				s.write([]byte(":\n\n"))
+			} else {
+				s.write([]byte("\n"))
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *EventStream) write(b []byte) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writeLocked(b)
+}
+
+// Writes with the mutex held.
+func (s *EventStream) writeLocked(b []byte) bool {
+	if s.err != nil || s.ended {
+		return false
+	}
+
+	if _, s.err = s.w.Write(b); s.err == nil {
+		s.flush()
+	}
+
+	return s.err == nil
+}
+
+func (s *EventStream) flush() {
+	s.last = time.Now()
+
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+// Each line of the data is sent as its own data field, which clients
+// join back together with newlines, so other line endings become them.
+func sseMessage(name string, data []byte) []byte {
+	buf := new(bytes.Buffer)
+
+	if name != "" {
+		buf.WriteString("event: " + name + "\n")
+	}
+
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	data = bytes.Replace(data, []byte("\r"), []byte("\n"), -1)
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteString("\n")
+	}
+
+	buf.WriteString("\n")
+
+	return buf.Bytes()
+}
@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	for i, test := range []struct {
+		format string
+		err    error
+		body   string
+	}{
+		{"", nil, "data: a\n\ndata: b\ndata: c\n\nevent: end\ndata: {\"continuation\":\"x\"}\n\n"},
+		{STREAM_NDJSON, nil, "{\"event\":\"a\"}\n{\"event\":\"b\\nc\"}\n{\"continuation\":\"x\"}\n"},
+		{STREAM_SSE, errors.New("failed"), "data: a\n\ndata: b\ndata: c\n\nevent: error\ndata: {\"code\":\"internal\",\"continuation\":\"x\",\"error\":\"failed\",\"retryable\":true}\n\n"},
+	} {
+		w := httptest.NewRecorder()
+
+		s, err := NewEventStream(w, test.format, 0)
+		if err != nil {
+			t.Fatalf("Case #%v: Unable to start stream: %v", i, err)
+		}
+
+		s.Send(stream.NewEvent([]byte("a"), nil))
+		s.Send(stream.NewEvent([]byte("b\r\nc"), nil))
+		s.End(map[string]interface{}{"continuation": "x"}, test.err)
+
+		if test.format == STREAM_NDJSON {
+			test.body = strings.Replace(test.body, `b\nc`, `b\r\nc`, 1)
+		}
+
+		if w.Body.String() != test.body || !w.Flushed {
+			t.Errorf("Case #%v: Wrong body.\n wanted: %q\n  found: %q", i, test.body, w.Body.String())
+		}
+	}
+
+	if _, err := NewEventStream(httptest.NewRecorder(), "xml", 0); err != UNKNOWN_STREAM_FORMAT {
+		t.Errorf("Wanted: %v, found: %v", UNKNOWN_STREAM_FORMAT, err)
+	}
+}
+
+func TestEventStreamHeartbeat(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	s, _ := NewEventStream(w, STREAM_SSE, 5*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+	s.End(map[string]interface{}{}, nil)
+
+	if body := w.Body.String(); !strings.HasPrefix(body, ":\n\n") || !strings.HasSuffix(body, "event: end\ndata: {}\n\n") {
+		t.Errorf("Wanted heartbeats before the end, found: %q", body)
+	}
+}
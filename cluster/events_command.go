@@ -2,19 +2,25 @@ package cluster
 
 import (
 	"github.com/jrallison/raft"
-
-	"log"
 )
 
 type EventsCommand struct {
 	Bodies    [][]byte            `json:"bodies"`
+	Groupings []string            `json:"groupings,omitempty"`
 	Indexes   []map[string]string `json:"indexes"`
 	Timestamp int64               `json:"timestamp"`
+	// Whether to sync the open stream to disk once written.
+	Sync bool `json:"sync,omitempty"`
+	// The headers of each event, if any have them.
+	Headers []map[string]string `json:"headers,omitempty"`
+	// The id of each event, if any have them. See WithDeduplication.
+	Ids []string `json:"ids,omitempty"`
 }
 
-func NewEventsCommand(bodies [][]byte, indexes []map[string]string, timestamp int64) *EventsCommand {
+func NewEventsCommand(bodies [][]byte, groupings []string, indexes []map[string]string, timestamp int64) *EventsCommand {
 	return &EventsCommand{
 		Bodies:    bodies,
+		Groupings: groupings,
 		Indexes:   indexes,
 		Timestamp: timestamp,
 	}
@@ -28,16 +34,21 @@ func (c *EventsCommand) Apply(context raft.Context) (interface{}, error) {
 	server := context.Server()
 	db := server.Context().(*DB)
 
-	index := context.CurrentIndex()
+	if db.ReadOnly() {
+		return new(interface{}), READ_ONLY_ERROR
+	}
+
+	index := db.commit(context.CurrentIndex())
 
-	err := db.WriteAll(index, c.Bodies, c.Indexes, c.Timestamp)
+	err := db.writeAll(index, c.Bodies, c.Groupings, c.Indexes, c.Headers, c.Ids, c.Timestamp)
+
+	if err == nil {
+		err = db.syncWritten(index, c.Sync)
+	}
 
-	if err == nil && db.Offset() > db.RotateThreshold {
-		err = db.Rotate(index, context.CurrentTerm())
-		if err != nil {
-			log.Fatal(err)
-		}
+	if err == nil {
+		db.rotateIfFull(index, context.CurrentTerm(), c.Timestamp)
 	}
 
-	return new(interface{}), err
+	return index, err
 }
@@ -0,0 +1,33 @@
+package cluster
+
+import (
+	"github.com/jrallison/raft"
+)
+
+// ExpireCommand removes closed streams outside the retention window.
+// See WithRetention.
+type ExpireCommand struct {
+	Commits   []uint64 `json:"commits"`
+	Timestamp int64    `json:"timestamp,omitempty"`
+}
+
+func NewExpireCommand(commits []uint64, timestamp int64) *ExpireCommand {
+	return &ExpireCommand{commits, timestamp}
+}
+
+func (c *ExpireCommand) CommandName() string {
+	return "expire"
+}
+
+func (c *ExpireCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	db.expire(db.commit(context.CurrentIndex()), c.Commits)
+
+	err := db.audit(db.commit(context.CurrentIndex()), AUDIT_EXPIRE, map[string]interface{}{
+		"commits": c.Commits,
+	}, c.Timestamp)
+
+	return new(interface{}), err
+}
@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Events are written with the time they expire (in unix nanoseconds)
+// as a reserved index, so it's kept with them in their stream.
+const EXPIRES_INDEX = "_expires"
+
+var INVALID_EXPIRY = errors.New("Invalid expiry, expected unix nanoseconds")
+
+// Returns a copy of the indexes which expires the event at the given
+// time. Expired events are hidden from scans straight away, and
+// removed when their stream is next compressed, independent of how
+// long the rest of the stream is kept.
+func Expiring(indexes map[string]string, at time.Time) map[string]string {
+	expiring := make(map[string]string, len(indexes)+1)
+
+	for name, value := range indexes {
+		expiring[name] = value
+	}
+
+	expiring[EXPIRES_INDEX] = strconv.FormatInt(at.UnixNano(), 10)
+
+	return expiring
+}
+
+// Fails unless the event's expiry, if it has one, is a valid time.
+func checkExpiry(indexes map[string]string) error {
+	if value, ok := indexes[EXPIRES_INDEX]; ok {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return INVALID_EXPIRY
+		}
+	}
+
+	return nil
+}
+
+// Whether the event has an expiry, so it's hidden from scans once it
+// passes. See Uncacheable.
+func Expires(e *stream.Event) bool {
+	_, ok := e.Value(EXPIRES_INDEX)
+	return ok
+}
+
+// Whether the event has expired by the given time (in unix nanoseconds).
+func expired(e *stream.Event, now int64) bool {
+	value, ok := e.Value(EXPIRES_INDEX)
+	if !ok {
+		return false
+	}
+
+	at, err := strconv.ParseInt(value, 10, 64)
+
+	return err == nil && at <= now
+}
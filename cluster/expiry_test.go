@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpiringEvents(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		soon := time.Now().Add(100 * time.Millisecond)
+		later := time.Now().Add(time.Hour)
+
+		trackevent(n, []byte("a"), Expiring(map[string]string{"customer": "1"}, soon))
+		trackevent(n, []byte("b"), Expiring(map[string]string{"customer": "1"}, later))
+		trackevent(n, []byte("c"), map[string]string{"customer": "1"})
+
+		scanned := func() []string {
+			found := make([]string, 0)
+
+			n.db.Scan("customer", "1", 0, "", func(e *stream.Event) bool {
+				found = append(found, string(e.Data))
+				return true
+			})
+
+			return found
+		}
+
+		if found := scanned(); !reflect.DeepEqual(found, []string{"c", "b", "a"}) {
+			t.Errorf("Incorrect scan results. Wanted: [c b a], found: %v", found)
+		}
+
+		time.Sleep(150 * time.Millisecond)
+
+		if found := scanned(); !reflect.DeepEqual(found, []string{"c", "b"}) {
+			t.Errorf("Expired events should be hidden. Wanted: [c b], found: %v", found)
+		}
+
+		last := n.db.closed[len(n.db.closed)-1]
+
+		Merge("tmp/teststream", 1, last, n.db.closed, n.db.tombstones, n.db.deleted)
+		n.Compress(1, last)
+
+		s, _ := stream.Open(n.db.reader.Path(1))
+		stored := make([]string, 0)
+
+		s.Iterate(0, func(e *stream.Event) bool {
+			if !audited(e) {
+				stored = append(stored, string(e.Data))
+			}
+			return true
+		})
+
+		if !reflect.DeepEqual(stored, []string{"b", "c"}) {
+			t.Errorf("Expired events should be removed when compressing. Wanted: [b c], found: %v", stored)
+		}
+	})
+}
+
+func TestExpiringPagesAreUncacheable(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("a"), Expiring(map[string]string{"customer": "1"}, time.Now().Add(time.Hour)))
+		trackevent(n, []byte("b"), map[string]string{"customer": "1"})
+		trackevent(n, []byte("c"), map[string]string{"customer": "1"})
+
+		continuation := ""
+
+		for i, cached := range []bool{false, true, false} {
+			req := httptest.NewRequest("GET", "/events?index=customer&value=1&limit=1&continuation="+url.QueryEscape(continuation), nil)
+			w := httptest.NewRecorder()
+
+			n.eventHandler(w, req)
+
+			var res ScanResponse
+			json.Unmarshal(w.Body.Bytes(), &res)
+
+			if etag := w.Header().Get("ETag"); (etag != "") != cached {
+				t.Errorf("Case #%v: Wrong ETag for %v: %q", i, res.Events, etag)
+			}
+
+			continuation = res.Continuation
+		}
+	})
+}
+
+func TestInvalidExpiry(t *testing.T) {
+	withNode(func(n *Node) {
+		if err := n.Event([]byte("a"), "", map[string]string{EXPIRES_INDEX: "tomorrow"}); err != INVALID_EXPIRY {
+			t.Errorf("Expected invalid expiry error, found: %v", err)
+		}
+	})
+}
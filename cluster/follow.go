@@ -0,0 +1,232 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How often a follower cluster's leader checks for changes to its
+// primary's streams.
+const DEFAULT_FOLLOW_INTERVAL = 5 * time.Second
+
+var FOLLOWER_ERROR = errors.New("Follower clusters don't accept writes, send them to the primary")
+
+// Makes the cluster a follower of the primary cluster with the given
+// nodes (as host:port). Followers serve reads of the primary's closed
+// streams, which have the same commits as on the primary, so a
+// continuation can be used with either. They reject every write, and
+// don't have a current stream of their own: events written to the
+// primary are only read from a follower once their stream is closed.
+func WithFollow(nodes ...string) Option {
+	return func(db *DB) error {
+		db.following = make([]string, 0, len(nodes))
+
+		for _, node := range nodes {
+			if !strings.HasPrefix(node, "http://") && !strings.HasPrefix(node, "https://") {
+				node = "http://" + node
+			}
+
+			db.following = append(db.following, node)
+		}
+
+		return nil
+	}
+}
+
+// Whether the cluster follows a primary.
+func (db *DB) Following() bool {
+	return len(db.following) > 0
+}
+
+// Fails if the node shouldn't accept writes, as it's read-only or
+// part of a follower cluster.
+func (n *Node) writable() error {
+	if n.db.Following() {
+		return FOLLOWER_ERROR
+	}
+
+	if n.ReadOnly() {
+		return READ_ONLY_ERROR
+	}
+
+	return nil
+}
+
+// Checks the primary for changes every interval until stopped, if the
+// cluster's a follower.
+func (n *Node) startFollowing(interval time.Duration) {
+	if !n.db.Following() {
+		return
+	}
+
+	n.follow.Lock()
+	defer n.follow.Unlock()
+
+	if n.unfollow != nil {
+		return
+	}
+
+	n.unfollow = make(chan bool)
+
+	go func(stop chan bool) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			n.db.supervisor.Run("follow", n.syncPrimary)
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}(n.unfollow)
+}
+
+func (n *Node) stopFollowing() {
+	n.follow.Lock()
+	defer n.follow.Unlock()
+
+	if n.unfollow != nil {
+		close(n.unfollow)
+		n.unfollow = nil
+	}
+}
+
+// Has the leader replicate the primary's metadata through the
+// follower cluster, whenever it's changed.
+func (n *Node) syncPrimary() error {
+	if n.raft == nil || n.raft.State() != "leader" {
+		return nil
+	}
+
+	meta, _, err := clusterMetadata(n.db.reader.router, n.db.reader.apiKey, n.tls, n.db.following)
+	if err != nil {
+		return err
+	}
+
+	if n.db.followed(*meta) {
+		return nil
+	}
+
+	_, err = n.raft.Do(NewFollowCommand(*meta, time.Now().UnixNano()))
+	return err
+}
+
+// Whether the primary's metadata has already been adopted.
+func (db *DB) followed(meta Metadata) bool {
+	return db.current == meta.Current &&
+		db.revision == meta.Revision &&
+		db.MostRecent == meta.MostRecent &&
+		reflect.DeepEqual(db.closed, meta.Closed) &&
+		reflect.DeepEqual(db.tombstones, meta.Tombstones) &&
+		reflect.DeepEqual(db.deleted, meta.Deleted) &&
+		reflect.DeepEqual(db.redactions, meta.Redactions) &&
+		reflect.DeepEqual(db.rewrites, meta.Rewrites)
+}
+
+// Adopts the primary's metadata, then fetches the closed streams this
+// node keeps which it's missing, or which have since been rewritten.
+func (db *DB) follow(meta Metadata) {
+	db.closed = append([]uint64{}, meta.Closed...)
+	db.current = meta.Current
+	db.revision = meta.Revision
+	db.MostRecent = meta.MostRecent
+
+	db.tombstones, db.deleted, db.rewrites = meta.Tombstones, meta.Deleted, meta.Rewrites
+
+	if db.tombstones == nil {
+		db.tombstones = make(Tombstones)
+	}
+
+	if db.deleted == nil {
+		db.deleted = make(Deletions)
+	}
+
+	if db.redactions = meta.Redactions; db.redactions == nil {
+		db.redactions = make(Redactions)
+	}
+
+	if db.rewrites == nil {
+		db.rewrites = make(Rewrites)
+	}
+
+	db.watch.Notify()
+
+	if db.raft != nil {
+		db.supervisor.Go("follow-streams", db.fetchFollowed)
+	}
+}
+
+// Streams are fetched from peers where they can be, as they're
+// nearer, and from the primary otherwise. A copy is kept, or taken
+// from a peer, only if it matches one of the primary's copies, and
+// one fetched from the primary is checked against that node's digest.
+func (db *DB) fetchFollowed() error {
+	db.refreshReader()
+
+	primary, err := closedCopies(db.reader.retry.httpClient(), db.reader.apiKey, db.following)
+	if err != nil {
+		return err
+	}
+
+	peers := db.peerConnectionStrings()
+	failed := make([]uint64, 0)
+
+	for _, commit := range db.closed {
+		holders, ok := primary[commit]
+
+		if !db.keeps(commit) || !ok {
+			continue
+		}
+
+		accepted := make([]string, 0, len(holders))
+		nodes := make([]string, 0, len(holders))
+
+		for node, digest := range holders {
+			accepted = append(accepted, digest)
+			nodes = append(nodes, node)
+		}
+
+		sort.Strings(nodes)
+
+		path := db.reader.Path(commit)
+
+		if stat, err := os.Stat(path); err == nil {
+			if local, err := digests.get(path, stat); err == nil && containsString(accepted, local) {
+				continue
+			}
+		}
+
+		// Peers may not have fetched the latest copy yet.
+		err := MISSING_STREAMS
+		if len(peers) > 0 {
+			err = db.reader.refetchStream(peers, commit, accepted...)
+		}
+
+		for _, node := range nodes {
+			if err == nil {
+				break
+			}
+
+			err = db.reader.refetchStream([]string{node}, commit, holders[node])
+		}
+
+		if err != nil {
+			db.logger.Println("FOLLOW: Unable to fetch stream", commit, err)
+			failed = append(failed, commit)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%v: %v", MISSING_STREAMS, failed)
+	}
+
+	return nil
+}
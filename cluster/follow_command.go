@@ -0,0 +1,29 @@
+package cluster
+
+import (
+	"github.com/jrallison/raft"
+)
+
+// FollowCommand adopts the primary's metadata throughout a follower
+// cluster, so each node serves the primary's closed streams.
+type FollowCommand struct {
+	Metadata  Metadata `json:"metadata"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+func NewFollowCommand(meta Metadata, timestamp int64) *FollowCommand {
+	return &FollowCommand{meta, timestamp}
+}
+
+func (c *FollowCommand) CommandName() string {
+	return "follow"
+}
+
+func (c *FollowCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	db.follow(c.Metadata)
+
+	return new(interface{}), nil
+}
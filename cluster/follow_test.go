@@ -0,0 +1,212 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(30)
+
+		for _, body := range []string{"a", "b", "c", "d", "e"} {
+			trackevent(n, []byte(body), map[string]string{"a": "b"})
+		}
+
+		primary := httptest.NewServer(n.mux)
+		defer primary.Close()
+
+		follower, err := NewNode("tmp/follower", "localhost", 3003, WithFollow(primary.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Connect(follower, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		defer follower.raft.Stop()
+
+		if err := follower.syncPrimary(); err != nil {
+			t.Fatalf("Expected to sync, found: %v", err)
+		}
+
+		if !reflect.DeepEqual(follower.db.closed, n.db.closed) || follower.db.current != n.db.current {
+			t.Fatalf("Expected the primary's streams, found: %v %v", follower.db.closed, follower.db.current)
+		}
+
+		for _, commit := range n.db.closed {
+			for i := 0; i < 100; i++ {
+				if _, err := os.Stat(follower.db.reader.Path(commit)); err == nil {
+					break
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		scan := func(db *DB, continuation string, limit int) ([]string, string) {
+			found := []string{}
+
+			continuation, err := db.Scan("a", "b", 0, continuation, func(e *stream.Event) bool {
+				found = append(found, string(e.Data))
+				return len(found) < limit
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return found, continuation
+		}
+
+		closed := n.db.reader.buildContinuation(n.db.closed[len(n.db.closed)-1], 0)
+		wanted, _ := scan(n.db, closed, 100)
+		found, _ := scan(follower.db, "", 100)
+
+		if len(wanted) == 0 || !reflect.DeepEqual(found, wanted) {
+			t.Errorf("Incorrect events. Wanted: %v, found: %v", wanted, found)
+		}
+
+		// Continuations from the primary resume on the follower.
+		first, continuation := scan(n.db, closed, 1)
+		rest, _ := scan(follower.db, continuation, 100)
+
+		if !reflect.DeepEqual(append(first, rest...), wanted) {
+			t.Errorf("Incorrect events. Wanted: %v, found: %v %v", wanted, first, rest)
+		}
+
+		if err := follower.Event([]byte("f"), "", map[string]string{"a": "b"}); err != FOLLOWER_ERROR {
+			t.Errorf("Expected writes to be rejected, found: %v", err)
+		}
+	})
+}
+
+func TestStandaloneFollower(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(30)
+
+		for _, body := range []string{"a", "b", "c", "d", "e"} {
+			trackevent(n, []byte(body), map[string]string{"a": "b"})
+		}
+
+		primary := httptest.NewServer(n.mux)
+		defer primary.Close()
+
+		replica, err := NewNode("tmp/replica", "localhost", 3004, WithFollow(primary.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		replica.SetStandalone(true)
+		go replica.Start("")
+
+		for replica.raft == nil || !replica.raft.Running() {
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		defer replica.Stop()
+
+		// Outside the primary's raft, which it doesn't count towards.
+		if peers := n.raft.Peers(); len(peers) != 0 {
+			t.Errorf("Expected the replica not to join the primary, found: %v", peers)
+		}
+
+		if err := replica.syncPrimary(); err != nil {
+			t.Fatalf("Expected to sync, found: %v", err)
+		}
+
+		if !reflect.DeepEqual(replica.db.closed, n.db.closed) || replica.db.current != n.db.current {
+			t.Fatalf("Expected the primary's streams, found: %v %v", replica.db.closed, replica.db.current)
+		}
+
+		closed := n.db.reader.buildContinuation(n.db.closed[len(n.db.closed)-1], 0)
+		wanted := []string{}
+
+		n.db.Scan("a", "b", 0, closed, func(e *stream.Event) bool {
+			wanted = append(wanted, string(e.Data))
+			return true
+		})
+
+		var found []string
+
+		for i := 0; i < 100 && !reflect.DeepEqual(found, wanted); i++ {
+			time.Sleep(10 * time.Millisecond)
+
+			found = []string{}
+			replica.db.Scan("a", "b", 0, "", func(e *stream.Event) bool {
+				found = append(found, string(e.Data))
+				return true
+			})
+		}
+
+		if len(wanted) == 0 || !reflect.DeepEqual(found, wanted) {
+			t.Errorf("Incorrect events. Wanted: %v, found: %v", wanted, found)
+		}
+
+		if err := replica.Event([]byte("f"), "", map[string]string{"a": "b"}); err != FOLLOWER_ERROR {
+			t.Errorf("Expected writes to be rejected, found: %v", err)
+		}
+
+		if _, err := replica.WriteEvents([][]byte{[]byte("f")}, nil, []map[string]string{{"a": "b"}}, ACK_LEADER); err != FOLLOWER_ERROR {
+			t.Errorf("Expected batched writes to be rejected, found: %v", err)
+		}
+	})
+}
+
+func TestFollowerChecksCopiesAgainstTheirNode(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(30)
+
+		for _, body := range []string{"a", "b", "c"} {
+			trackevent(n, []byte(body), map[string]string{"a": "b"})
+		}
+
+		primary := httptest.NewServer(n.mux)
+		defer primary.Close()
+
+		// A primary node whose copies differ in layout, and can't be fetched.
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/streams" {
+				http.NotFound(w, r)
+				return
+			}
+
+			streams := make([]StreamInfo, 0)
+			for _, commit := range n.db.closed {
+				streams = append(streams, StreamInfo{Commit: commit, State: STREAM_CLOSED, Location: LOCATION_LOCAL, Digest: "other"})
+			}
+
+			json.NewEncoder(w).Encode(map[string][]StreamInfo{"streams": streams})
+		}))
+		defer other.Close()
+
+		os.RemoveAll("tmp/copies")
+		os.MkdirAll("tmp/copies", 0755)
+
+		db, err := NewDb("tmp/copies")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.following = []string{primary.URL, other.URL}
+		db.closed = n.db.closed
+
+		if err := db.fetchFollowed(); err != nil {
+			t.Fatalf("Expected streams to be fetched from the node listing their digest, found: %v", err)
+		}
+
+		for _, commit := range n.db.closed {
+			if _, err := os.Stat(db.reader.Path(commit)); err != nil {
+				t.Errorf("Expected stream %v to be fetched: %v", commit, err)
+			}
+		}
+	})
+}
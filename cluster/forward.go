@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// Set on requests forwarded to the leader, so a node which has lost
+// leadership since points the client elsewhere rather than forwarding
+// them again.
+const FORWARDED_HEADER = "Cluster-Forwarded"
+
+// Headers of the leader's response relayed to the client.
+var forwardedHeaders = []string{"Content-Type", "Cluster-Leader", "Retry-After", "WWW-Authenticate"}
+
+// Headers of the client's request sent on to the leader, including its
+// credentials, which the leader checks again.
+var relayedHeaders = []string{"Content-Type", "Authorization", API_KEY_HEADER}
+
+// Forwards writes a follower is sent to the leader, relaying its
+// response, so clients can write to any node. Otherwise followers
+// fail them with a not_leader error naming the leader.
+func (n *Node) SetForwarding(forward bool) {
+	n.forward = forward
+}
+
+// Forwards the request, with the body already read from it, to the
+// leader. Nothing's written if it can't be, so the client can still be
+// pointed to the leader, and the request isn't retried, as the leader
+// may have written its events.
+func (n *Node) forwardToLeader(w http.ResponseWriter, req *http.Request, body []byte) bool {
+	if !n.forward || req.Header.Get(FORWARDED_HEADER) != "" {
+		return false
+	}
+
+	leader, err := n.LeaderConnectionString()
+	if err != nil {
+		return false
+	}
+
+	if err = n.relay(w, req, body, leader); err != nil {
+		n.db.logger.Println(req.Method, req.URL, "Unable to forward to leader:", leader, err)
+		return false
+	}
+
+	return true
+}
+
+func (n *Node) relay(w http.ResponseWriter, req *http.Request, body []byte, leader string) error {
+	forwarded, err := http.NewRequest(req.Method, leader+req.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	forwarded.Header.Set(FORWARDED_HEADER, n.name)
+
+	for _, name := range relayedHeaders {
+		if value := req.Header.Get(name); value != "" {
+			forwarded.Header.Set(name, value)
+		}
+	}
+
+	resp, err := n.retry.httpClient().Do(forwarded)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	for _, name := range forwardedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+
+	return nil
+}
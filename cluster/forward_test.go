@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestForwardToLeader(t *testing.T) {
+	withNode(func(n *Node) {
+		var forwarded *http.Request
+		var body []byte
+
+		leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			forwarded = req
+			body, _ = ioutil.ReadAll(req.Body)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(202)
+			w.Write([]byte(`{"events":[]}`))
+		}))
+
+		defer leader.Close()
+
+		events := `[{"body":"a","indexes":{"customer":"1"}}]`
+
+		req := httptest.NewRequest("POST", "/events?ack=none", strings.NewReader(events))
+		req.Header.Set(API_KEY_HEADER, "secret")
+		req.Header.Set("Authorization", "Bearer token")
+
+		w := httptest.NewRecorder()
+
+		if err := n.relay(w, req, []byte(events), leader.URL); err != nil {
+			t.Fatal(err)
+		}
+
+		if forwarded.URL.RequestURI() != "/events?ack=none" || string(body) != events {
+			t.Errorf("Wrong request forwarded: %v %s", forwarded.URL, body)
+		}
+
+		if forwarded.Header.Get(API_KEY_HEADER) != "secret" || forwarded.Header.Get("Authorization") != "Bearer token" || forwarded.Header.Get(FORWARDED_HEADER) == "" {
+			t.Errorf("Wrong headers forwarded: %v", forwarded.Header)
+		}
+
+		if w.Code != 202 || w.Body.String() != `{"events":[]}` || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("Wrong response relayed: %v %v %v", w.Code, w.Header(), w.Body)
+		}
+
+		// Already forwarded once, or forwarding disabled.
+		req.Header.Set(FORWARDED_HEADER, "other")
+		n.SetForwarding(true)
+
+		if n.forwardToLeader(httptest.NewRecorder(), req, []byte(events)) {
+			t.Errorf("Expected a forwarded request not to be forwarded again")
+		}
+
+		req.Header.Del(FORWARDED_HEADER)
+		n.SetForwarding(false)
+
+		if n.forwardToLeader(httptest.NewRecorder(), req, []byte(events)) {
+			t.Errorf("Expected requests not to be forwarded unless enabled")
+		}
+	})
+}
@@ -0,0 +1,331 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/cluster/pb"
+	"github.com/customerio/esdb/stream"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"context"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Metadata carrying the API key of each gRPC request.
+const API_KEY_METADATA = "api-key"
+
+// Serves the node's API over gRPC, as defined by pb/esdb.proto. Each
+// method behaves as its HTTP equivalent, without encoding JSON.
+type grpcServer struct {
+	pb.UnimplementedNodeServer
+	node *Node
+}
+
+func NewGRPCServer(n *Node) *grpc.Server {
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(n.drainedGRPC)}
+
+	if n.tls != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(n.tls)))
+	}
+
+	server := grpc.NewServer(opts...)
+	pb.RegisterNodeServer(server, &grpcServer{node: n})
+
+	return server
+}
+
+// Serves gRPC from the listener, alongside HTTP, once the node starts.
+func (n *Node) SetGRPCListener(l net.Listener) {
+	n.grpcListener = l
+}
+
+func (n *Node) serveGRPC() {
+	log.Println("Serving gRPC at:", n.grpcListener.Addr())
+
+	if err := n.GRPC.Serve(n.grpcListener); err != nil {
+		n.db.logger.Println("gRPC server stopped:", err)
+	}
+}
+
+// Serves the request unless the node is draining, as drained does.
+func (n *Node) drainedGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !n.drain.begin() {
+		return nil, n.grpcError(DRAINING_ERROR)
+	}
+
+	defer n.drain.end()
+
+	res, err := handler(ctx, req)
+	if err != nil {
+		n.db.logger.Println(info.FullMethod, err)
+	}
+
+	return res, err
+}
+
+// Finds the role for the request's API key, as Authorizer.Role does.
+func (n *Node) grpcRole(ctx context.Context, op string) (*Role, error) {
+	var key string
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if keys := md.Get(API_KEY_METADATA); len(keys) > 0 {
+			key = keys[0]
+		}
+	}
+
+	return n.auth.keyRole(key, op)
+}
+
+// Reports the error with the gRPC code nearest its HTTP status, and
+// an ErrorInfo detail with its code, whether it's retryable, and any
+// further details the HTTP API would respond with.
+func (n *Node) grpcError(err error) error {
+	var leader string
+
+	if err == NOT_LEADER_ERROR {
+		if uri, lerr := n.LeaderConnectionString(); lerr != nil {
+			err = lerr
+		} else {
+			leader = uri
+		}
+	}
+
+	kind := Classify(err)
+
+	info := &errdetails.ErrorInfo{
+		Reason: kind.Code,
+		Domain: "esdb",
+		Metadata: map[string]string{
+			"retryable": strconv.FormatBool(kind.Retryable),
+		},
+	}
+
+	switch e := err.(type) {
+	case *UniqueConflictError:
+		info.Metadata["index"] = e.Index
+		info.Metadata["value"] = e.Value
+	case *ValidationError:
+		info.Metadata["event"] = strconv.Itoa(e.Event)
+		info.Metadata["reason"] = e.Reason
+	}
+
+	if leader != "" {
+		info.Metadata["leader"] = leader
+	}
+
+	s := status.New(grpcCode(kind.Status), err.Error())
+
+	if kind.RetryAfter > 0 {
+		s, _ = s.WithDetails(info, &errdetails.RetryInfo{
+			RetryDelay: durationpb.New(time.Duration(kind.RetryAfter) * time.Second),
+		})
+	} else {
+		s, _ = s.WithDetails(info)
+	}
+
+	return s.Err()
+}
+
+func grpcCode(status int) codes.Code {
+	switch status {
+	case 400:
+		return codes.InvalidArgument
+	case 401:
+		return codes.Unauthenticated
+	case 403:
+		return codes.PermissionDenied
+	case 404:
+		return codes.NotFound
+	case 409:
+		return codes.AlreadyExists
+	case 410:
+		return codes.FailedPrecondition
+	case 429, 507:
+		return codes.ResourceExhausted
+	case 503:
+		return codes.Unavailable
+	}
+
+	return codes.Internal
+}
+
+func (s *grpcServer) Write(ctx context.Context, req *pb.WriteRequest) (*pb.WriteResponse, error) {
+	role, err := s.node.grpcRole(ctx, WRITE)
+	if err != nil {
+		return nil, s.node.grpcError(err)
+	}
+
+	bodies := make([][]byte, len(req.Events))
+	groupings := make([]string, len(req.Events))
+	indexes := make([]map[string]string, len(req.Events))
+	headers := make([]map[string]string, len(req.Events))
+
+	for i, e := range req.Events {
+		if !role.AllowsAll(e.Indexes) || (e.Grouping != "" && !role.Allows(stream.GROUPING_INDEX, e.Grouping)) {
+			return nil, s.node.grpcError(FORBIDDEN)
+		}
+
+		bodies[i] = e.Body
+		groupings[i] = e.Grouping
+		indexes[i] = e.Indexes
+		headers[i] = e.Headers
+	}
+
+	commit, err := s.node.WriteEventsWithHeaders(bodies, groupings, indexes, headers, req.Ack)
+	if err != nil {
+		return nil, s.node.grpcError(err)
+	}
+
+	return &pb.WriteResponse{Commit: commit}, nil
+}
+
+func (s *grpcServer) Scan(ctx context.Context, req *pb.ScanRequest) (*pb.ScanResponse, error) {
+	return s.query(ctx, Query{
+		Index:        req.Index,
+		Value:        req.Value,
+		Indexes:      req.Indexes,
+		Prefix:       req.Prefix,
+		Grouping:     req.Grouping,
+		After:        req.After,
+		Continuation: req.Continuation,
+		Limit:        int(req.Limit),
+		MaxBytes:     int(req.MaxBytes),
+		Headers:      req.Headers,
+		Since:        req.Since,
+		Until:        req.Until,
+	})
+}
+
+func (s *grpcServer) Iterate(ctx context.Context, req *pb.IterateRequest) (*pb.ScanResponse, error) {
+	return s.query(ctx, Query{
+		After:        req.After,
+		Continuation: req.Continuation,
+		Limit:        int(req.Limit),
+		MaxBytes:     int(req.MaxBytes),
+		Reverse:      req.Reverse,
+		Headers:      req.Headers,
+		Since:        req.Since,
+		Until:        req.Until,
+	})
+}
+
+// Scans which fail report no results, even if they found some before
+// failing, as a gRPC response can't hold both.
+func (s *grpcServer) query(ctx context.Context, q Query) (*pb.ScanResponse, error) {
+	role, err := s.node.grpcRole(ctx, READ)
+	if err != nil {
+		return nil, s.node.grpcError(err)
+	}
+
+	if !q.AllowedBy(role) {
+		return nil, s.node.grpcError(FORBIDDEN)
+	}
+
+	events, headers, continuation, _, err := q.page(ctx, s.node.db)
+	if err != nil {
+		return nil, s.node.grpcError(err)
+	}
+
+	res := &pb.ScanResponse{
+		Events:       make([][]byte, len(events)),
+		Continuation: continuation,
+		MostRecent:   s.node.db.MostRecent,
+	}
+
+	for i, e := range events {
+		res.Events[i] = []byte(e)
+	}
+
+	for _, h := range headers {
+		res.Headers = append(res.Headers, &pb.Headers{Values: h})
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) Offset(ctx context.Context, req *pb.OffsetRequest) (*pb.OffsetResponse, error) {
+	role, err := s.node.grpcRole(ctx, READ)
+	if err != nil {
+		return nil, s.node.grpcError(err)
+	}
+
+	index, value := req.Index, req.Value
+
+	if index == "" && req.Grouping != "" {
+		index, value = stream.GROUPING_INDEX, req.Grouping
+	}
+
+	if !role.Allows(index, value) {
+		return nil, s.node.grpcError(FORBIDDEN)
+	}
+
+	meta := s.node.Metadata()
+
+	res := &pb.OffsetResponse{
+		Continuation: s.node.db.Continuation(index, value),
+		Meta: &pb.Metadata{
+			Peers:      meta.Peers,
+			Closed:     meta.Closed,
+			Current:    meta.Current,
+			MostRecent: meta.MostRecent,
+		},
+	}
+
+	if index != "" {
+		res.MostRecent = s.node.db.recent.Get(index)
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) ClusterStatus(ctx context.Context, req *pb.ClusterStatusRequest) (*pb.ClusterStatusResponse, error) {
+	if _, err := s.node.grpcRole(ctx, READ); err != nil {
+		return nil, s.node.grpcError(err)
+	}
+
+	c := s.node.ClusterStatus()
+
+	res := &pb.ClusterStatusResponse{
+		Self:   c.Self,
+		Term:   c.Term,
+		Status: c.summary(),
+		Nodes:  make(map[string]*pb.NodeState, len(c.Nodes)),
+		Errors: c.Errors,
+	}
+
+	for name, state := range c.Nodes {
+		res.Nodes[name] = state.proto()
+	}
+
+	return res, nil
+}
+
+func (s NodeState) proto() *pb.NodeState {
+	failures := make(map[string]int64, len(s.Failures))
+
+	for name, count := range s.Failures {
+		failures[name] = int64(count)
+	}
+
+	return &pb.NodeState{
+		Name:       s.Name,
+		Id:         s.Id,
+		State:      s.State,
+		Commit:     s.Commit,
+		Path:       s.Path,
+		Uri:        s.Uri,
+		Degraded:   s.Degraded,
+		Failures:   failures,
+		Disk:       s.Disk,
+		ReadOnly:   s.ReadOnly,
+		CatchingUp: s.CatchingUp,
+		Following:  s.Following,
+	}
+}
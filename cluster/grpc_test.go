@@ -0,0 +1,143 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/cluster/pb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"context"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func withGRPCNode(perform func(n *Node, client pb.NodeClient)) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	node, _ := NewNode("tmp/teststream", "localhost", 3001)
+
+	l, _ := net.Listen("tcp", "localhost:0")
+	node.SetGRPCListener(l)
+
+	go node.Start("")
+
+	for node.raft == nil || !node.raft.Running() || node.GRPC == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	conn, _ := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	defer conn.Close()
+
+	perform(node, pb.NewNodeClient(conn))
+
+	node.Stop()
+}
+
+func TestGRPCWriteAndScan(t *testing.T) {
+	withGRPCNode(func(n *Node, client pb.NodeClient) {
+		ctx := context.Background()
+
+		res, err := client.Write(ctx, &pb.WriteRequest{
+			Events: []*pb.Event{
+				{Body: []byte("a"), Indexes: map[string]string{"customer": "1"}},
+				{Body: []byte("b"), Grouping: "x", Indexes: map[string]string{"customer": "2"}},
+				{Body: []byte("c"), Indexes: map[string]string{"customer": "1"}},
+			},
+		})
+
+		if err != nil || res.Commit == 0 {
+			t.Fatalf("Wanted a commit, found: %v, %v", res, err)
+		}
+
+		scan, err := client.Scan(ctx, &pb.ScanRequest{Index: "customer", Value: "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(scan.Events, [][]byte{[]byte("c"), []byte("a")}) {
+			t.Errorf("Wanted: [c a], found: %q", scan.Events)
+		}
+
+		scan, err = client.Scan(ctx, &pb.ScanRequest{Index: "customer", Value: "1", Limit: 1})
+		if err != nil || len(scan.Events) != 1 {
+			t.Fatalf("Wanted one event, found: %v, %v", scan, err)
+		}
+
+		scan, err = client.Scan(ctx, &pb.ScanRequest{Index: "customer", Value: "1", Continuation: scan.Continuation})
+		if err != nil || !reflect.DeepEqual(scan.Events, [][]byte{[]byte("a")}) {
+			t.Errorf("Wanted: [a], found: %v, %v", scan, err)
+		}
+
+		scan, err = client.Scan(ctx, &pb.ScanRequest{Grouping: "x"})
+		if err != nil || !reflect.DeepEqual(scan.Events, [][]byte{[]byte("b")}) {
+			t.Errorf("Wanted: [b], found: %v, %v", scan, err)
+		}
+
+		scan, err = client.Iterate(ctx, &pb.IterateRequest{Reverse: true})
+		if err != nil || !reflect.DeepEqual(scan.Events, [][]byte{[]byte("c"), []byte("b"), []byte("a")}) {
+			t.Errorf("Wanted: [c b a], found: %v, %v", scan, err)
+		}
+
+		offset, err := client.Offset(ctx, &pb.OffsetRequest{Index: "customer", Value: "1"})
+		if err != nil || offset.Continuation == "" || offset.Meta.Current == 0 {
+			t.Errorf("Wanted an offset, found: %v, %v", offset, err)
+		}
+
+		cluster, err := client.ClusterStatus(ctx, &pb.ClusterStatusRequest{})
+		if err != nil || cluster.Self != n.raft.Name() || cluster.Nodes[n.raft.Name()].Commit == 0 {
+			t.Errorf("Wanted the node's status, found: %v, %v", cluster, err)
+		}
+	})
+}
+
+func TestGRPCErrors(t *testing.T) {
+	withGRPCNode(func(n *Node, client pb.NodeClient) {
+		n.SetAuthorizer(&Authorizer{
+			Roles: map[string]*Role{"acme": {Operations: []string{READ, WRITE}, Indexes: []string{"customer"}}},
+			Keys:  map[string]string{"secret": "acme"},
+		}, "")
+
+		var tests = []struct {
+			key  string
+			ack  string
+			code codes.Code
+			kind string
+		}{
+			{"", "", codes.Unauthenticated, "unauthenticated"},
+			{"unknown", "", codes.Unauthenticated, "unauthenticated"},
+			{"secret", "sometimes", codes.InvalidArgument, "invalid_ack"},
+		}
+
+		for i, test := range tests {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), API_KEY_METADATA, test.key)
+
+			_, err := client.Write(ctx, &pb.WriteRequest{
+				Events: []*pb.Event{{Body: []byte("a"), Indexes: map[string]string{"customer": "1"}}},
+				Ack:    test.ack,
+			})
+
+			s := status.Convert(err)
+
+			if s.Code() != test.code {
+				t.Errorf("Case #%v: wanted: %v, found: %v", i, test.code, s.Code())
+			}
+
+			if details := s.Details(); len(details) == 0 || details[0].(*errdetails.ErrorInfo).Reason != test.kind {
+				t.Errorf("Case #%v: wanted: %v, found: %v", i, test.kind, details)
+			}
+		}
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), API_KEY_METADATA, "secret")
+
+		if _, err := client.Iterate(ctx, &pb.IterateRequest{}); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Wanted iterating to be forbidden, found: %v", err)
+		}
+	})
+}
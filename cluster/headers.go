@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"net/http"
+	"strings"
+)
+
+// Whether any of the events have headers, so commands without any are
+// written to the raft log as they were before headers.
+func hasHeaders(headers []map[string]string) bool {
+	for _, h := range headers {
+		if len(h) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether the event has each of the headers, so scans can filter on
+// them without decoding event bodies.
+func matchesHeaders(e *stream.Event, headers map[string]string) bool {
+	for name, value := range headers {
+		if found, ok := e.Headers[name]; !ok || found != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Scans may be limited to events with headers given as repeated
+// header parameters, each as name:value.
+func formHeaders(req *http.Request) map[string]string {
+	values := req.Form["header"]
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]string, len(values))
+
+	for _, header := range values {
+		parts := strings.SplitN(header, ":", 2)
+
+		if len(parts) == 2 {
+			headers[parts[0]] = parts[1]
+		} else {
+			headers[parts[0]] = ""
+		}
+	}
+
+	return headers
+}
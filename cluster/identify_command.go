@@ -0,0 +1,35 @@
+package cluster
+
+import (
+	"github.com/jrallison/raft"
+)
+
+// IdentifyCommand records the UUID a member joined the cluster with.
+type IdentifyCommand struct {
+	Name string `json:"name"`
+	Id   string `json:"id"`
+}
+
+func NewIdentifyCommand(name, id string) *IdentifyCommand {
+	return &IdentifyCommand{name, id}
+}
+
+func (c *IdentifyCommand) CommandName() string {
+	return "identify"
+}
+
+func (c *IdentifyCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	// Copied, as joins are checked against it as it's applied.
+	identities := make(Identities, len(db.identities)+1)
+	for name, id := range db.identities {
+		identities[name] = id
+	}
+
+	identities[c.Name] = c.Id
+	db.identities = identities
+
+	return new(interface{}), nil
+}
@@ -0,0 +1,196 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+	"github.com/jrallison/raft"
+
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var IDENTITY_CONFLICT = errors.New("Another node has joined the cluster under this name")
+var REPROVISIONED = errors.New("Another member is registered at this node's address")
+
+// Identities records the UUID each member joined with, by name, so a
+// node whose name has been copied to another machine is told apart
+// from it. It's replicated through raft.
+type Identities map[string]string
+
+// Sent to the leader by a node joining the cluster. Nodes only join
+// with an empty log, so a member already registered at its address is
+// a machine which was re-provisioned with an empty disk. It's only
+// replaced (removed from the cluster, so the joining node syncs from
+// scratch) if Replace is set, otherwise the join is rejected.
+type JoinRequest struct {
+	Name             string
+	ConnectionString string
+	Id               string
+	Replace          bool
+}
+
+// Reads the node's UUID, generating one the first time it's started.
+func loadIdentity(path string) (string, error) {
+	file := filepath.Join(path, "id")
+
+	if b, err := ioutil.ReadFile(file); err == nil {
+		return strings.TrimSpace(string(b)), nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+
+	return id, ioutil.WriteFile(file, []byte(id), 0644)
+}
+
+// A random (version 4) UUID.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// The UUID the node was first started with, kept alongside its name.
+func (n *Node) Id() string {
+	return n.id
+}
+
+// Removes members registered at the same address as this node when
+// it joins a cluster, rather than refusing to join. Set when the
+// machine has been re-provisioned with an empty disk.
+func (n *Node) SetReplace(replace bool) {
+	n.replace = replace
+}
+
+// Checks the joining node's identity, returning the names of members
+// registered at its address which it replaces.
+func (n *Node) admit(req JoinRequest) ([]string, error) {
+	if id, ok := n.db.identities[req.Name]; ok && id != req.Id {
+		return nil, IDENTITY_CONFLICT
+	}
+
+	if req.Name == n.raft.Name() {
+		return nil, IDENTITY_CONFLICT
+	}
+
+	stale := make([]string, 0)
+
+	for name, peer := range n.raft.Peers() {
+		if name != req.Name && peer.ConnectionString == req.ConnectionString {
+			stale = append(stale, name)
+		}
+	}
+
+	sort.Strings(stale)
+
+	if len(stale) > 0 && !req.Replace {
+		return nil, fmt.Errorf("%v: %v", REPROVISIONED, stale)
+	}
+
+	return stale, nil
+}
+
+// Joins the node to the cluster on the leader, after removing any
+// members it replaces.
+func (n *Node) join(req JoinRequest) error {
+	stale, err := n.admit(req)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range stale {
+		n.db.logger.Println("JOIN: Replacing", name, "at", req.ConnectionString, "with", req.Name)
+
+		err = executeOnLeader(n, "Node.RemoveFromCluster", &raft.DefaultLeaveCommand{Name: name}, AUDIT_LEAVE, map[string]interface{}{
+			"name":        name,
+			"replaced_by": req.Name,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = executeOnLeader(n, "Node.JoinCluster", &raft.DefaultJoinCommand{
+		Name:             req.Name,
+		ConnectionString: req.ConnectionString,
+	}, AUDIT_JOIN, map[string]interface{}{
+		"name": req.Name,
+		"uri":  req.ConnectionString,
+		"id":   req.Id,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// The leader's recorded once it's joined by another.
+	if _, ok := n.db.identities[n.raft.Name()]; !ok {
+		if _, err = n.raft.Do(NewIdentifyCommand(n.raft.Name(), n.id)); err != nil {
+			return err
+		}
+	}
+
+	_, err = n.raft.Do(NewIdentifyCommand(req.Name, req.Id))
+	return err
+}
+
+func writeIdentities(buf *bytes.Buffer, identities Identities) {
+	names := make([]string, 0, len(identities))
+	for name := range identities {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	binary.WriteUvarint(buf, len(names))
+
+	for _, name := range names {
+		binary.WriteUvarint(buf, len(name))
+		buf.WriteString(name)
+		binary.WriteUvarint(buf, len(identities[name]))
+		buf.WriteString(identities[name])
+	}
+}
+
+func readIdentities(buf *bytes.Buffer) (Identities, error) {
+	identities := make(Identities)
+
+	// Snapshots taken before identities were recorded have none.
+	if buf.Len() == 0 {
+		return identities, nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var name, id string
+
+		if name, err = binary.ReadStringMax(buf, int64(buf.Len())); err != nil {
+			break
+		}
+
+		if id, err = binary.ReadStringMax(buf, int64(buf.Len())); err == nil {
+			identities[name] = id
+		}
+	}
+
+	return identities, err
+}
@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNodeIdentity(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	n, err := NewNode("tmp/identity", "localhost", 3001)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(n.Id()) {
+		t.Errorf("Expected a UUID, found: %v", n.Id())
+	}
+
+	restarted, _ := NewNode("tmp/identity", "localhost", 3001)
+
+	if restarted.Id() != n.Id() || restarted.name != n.name {
+		t.Errorf("Expected identity to be kept, found: %v %v", restarted.Id(), restarted.name)
+	}
+}
+
+func TestJoinIdentity(t *testing.T) {
+	withNode(func(n *Node) {
+		rpc := &NodeRPC{n}
+		req := JoinRequest{Name: "a", ConnectionString: "http://localhost:4002", Id: "1"}
+
+		if err := rpc.Join(req, &NoResponse{}); err != nil {
+			t.Fatalf("Expected to join, found: %v", err)
+		}
+
+		if id := n.db.identities[n.raft.Name()]; id != n.Id() {
+			t.Errorf("Expected own identity to be recorded, found: %v", id)
+		}
+
+		// Joining again as the same node is fine.
+		if err := rpc.Join(req, &NoResponse{}); err != nil {
+			t.Errorf("Expected to join again, found: %v", err)
+		}
+
+		if err := rpc.Join(JoinRequest{Name: "a", ConnectionString: "http://localhost:4003", Id: "2"}, &NoResponse{}); err != IDENTITY_CONFLICT {
+			t.Errorf("Expected an identity conflict, found: %v", err)
+		}
+
+		// Re-provisioned, so it's joining under a new name.
+		req = JoinRequest{Name: "b", ConnectionString: "http://localhost:4002", Id: "3"}
+
+		if err := rpc.Join(req, &NoResponse{}); err == nil || !strings.HasPrefix(err.Error(), REPROVISIONED.Error()) {
+			t.Errorf("Expected join to be rejected, found: %v", err)
+		}
+
+		req.Replace = true
+
+		if err := rpc.Join(req, &NoResponse{}); err != nil {
+			t.Fatalf("Expected to replace member, found: %v", err)
+		}
+
+		if _, ok := n.raft.Peers()["a"]; ok {
+			t.Errorf("Expected replaced member to be removed")
+		}
+
+		if _, ok := n.raft.Peers()["b"]; !ok || n.db.identities["b"] != "3" {
+			t.Errorf("Expected to join as b, found: %v", n.db.identities)
+		}
+
+		state, _ := n.db.Save()
+		recovered, _ := NewDb("tmp")
+
+		if err := recovered.Recovery(state); err != nil || !reflect.DeepEqual(recovered.identities, n.db.identities) {
+			t.Errorf("Incorrect identities recovered: %v %v", recovered.identities, err)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+)
+
+// StreamIndexStats are an index name's stats within one stream.
+type StreamIndexStats struct {
+	Commit uint64 `json:"commit"`
+	State  string `json:"state"`
+	stream.IndexStats
+}
+
+// IndexStats describes an index name's use across the streams held
+// by this node, so the cost of writing events with it can be weighed
+// against how it's scanned. Values are distinct within each stream, so
+// its total counts a value once for each stream it's in.
+type IndexStats struct {
+	Name    string             `json:"name"`
+	Streams []StreamIndexStats `json:"streams"`
+	Total   stream.IndexStats  `json:"total"`
+	// Streams closed before their stats were recorded, or only held
+	// by peers, which aren't fetched.
+	Unknown []uint64 `json:"unknown,omitempty"`
+}
+
+// The stats of the index name in each stream, oldest first, including
+// the current one. Streams without events indexed by it are left out.
+func (db *DB) IndexStats(name string) (*IndexStats, error) {
+	all, unknown, err := db.indexStats()
+	if err != nil {
+		return nil, err
+	}
+
+	if stats, ok := all[name]; ok {
+		return stats, nil
+	}
+
+	return &IndexStats{Name: name, Streams: []StreamIndexStats{}, Unknown: unknown}, nil
+}
+
+// The stats of every index name, as IndexStats.
+func (db *DB) Stats() (map[string]*IndexStats, error) {
+	all, _, err := db.indexStats()
+	return all, err
+}
+
+func (db *DB) indexStats() (map[string]*IndexStats, []uint64, error) {
+	db.refreshReader()
+
+	all := make(map[string]*IndexStats)
+	var unknown []uint64
+
+	for commit := db.reader.Next(0); commit > 0; commit = db.reader.Next(commit) {
+		s, err := db.retrieveStream(commit, false)
+		if err != nil && err != stream.STREAM_NOT_FOUND && err != RETRIEVED_OPEN_STREAM {
+			return nil, nil, err
+		} else if s == nil {
+			unknown = append(unknown, commit)
+			continue
+		}
+
+		stats, err := s.Stats()
+		if err != nil {
+			return nil, nil, err
+		} else if stats == nil {
+			unknown = append(unknown, commit)
+			continue
+		}
+
+		state := STREAM_CLOSED
+		if commit == db.current {
+			state = STREAM_OPEN
+		}
+
+		for name, st := range stats {
+			if all[name] == nil {
+				all[name] = &IndexStats{Name: name}
+			}
+
+			all[name].Streams = append(all[name].Streams, StreamIndexStats{commit, state, st})
+			all[name].Total = all[name].Total.Add(st)
+		}
+	}
+
+	for _, stats := range all {
+		stats.Unknown = unknown
+	}
+
+	return all, unknown, nil
+}
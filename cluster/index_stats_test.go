@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIndexStats(t *testing.T) {
+	withNode(func(n *Node) {
+		trackevent(n, []byte("a"), map[string]string{"customer": "1", "type": "open"})
+		trackevent(n, []byte("b"), map[string]string{"customer": "2"})
+
+		n.SetRotateThreshold(1)
+		trackevent(n, []byte("c"), map[string]string{"customer": "1"})
+		n.SetRotateThreshold(DEFAULT_ROTATE_THRESHOLD)
+
+		trackevent(n, []byte("d"), map[string]string{"customer": "3"})
+
+		stats, err := n.db.IndexStats("customer")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(stats.Streams) != 2 || stats.Streams[0].State != STREAM_CLOSED || stats.Streams[1].State != STREAM_OPEN {
+			t.Fatalf("Expected a closed and open stream, found: %+v", stats.Streams)
+		}
+
+		if found := stats.Streams[0]; found.Values != 2 || found.Events != 3 || found.Bytes == 0 {
+			t.Errorf("Wrong stats for the closed stream: %+v", found)
+		}
+
+		if stats.Total.Values != 3 || stats.Total.Events != 4 {
+			t.Errorf("Wrong total: %+v", stats.Total)
+		}
+
+		w := httptest.NewRecorder()
+		n.statsHandler(w, httptest.NewRequest("GET", "/stats?index=type", nil))
+
+		var found IndexStats
+		json.NewDecoder(w.Body).Decode(&found)
+
+		if w.Code != 200 || found.Name != "type" || found.Total.Events != 1 || len(found.Streams) != 1 {
+			t.Errorf("Wrong stats served: %v %+v", w.Code, found)
+		}
+	})
+}
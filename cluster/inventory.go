@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"os"
+)
+
+const (
+	STREAM_OPEN   = "open"
+	STREAM_CLOSED = "closed"
+
+	// Where a stream's file is, either on this node, or
+	// only on peers, which it's fetched from when needed.
+	LOCATION_LOCAL = "local"
+	LOCATION_PEER  = "peer"
+)
+
+// StreamInfo describes a stream in the inventory. The digest is the
+// base64 encoded SHA-256 of closed streams held locally, as served
+// to peers recovering them.
+type StreamInfo struct {
+	Commit   uint64 `json:"commit"`
+	State    string `json:"state"`
+	Location string `json:"location"`
+	Size     int64  `json:"size"`
+	First    int64  `json:"first,omitempty"`
+	Last     int64  `json:"last,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+}
+
+// Lists every closed stream in commit order, followed by the current
+// one. Timestamps are unknown for streams closed before their span
+// was recorded.
+func (db *DB) Inventory() ([]StreamInfo, error) {
+	db.refreshReader()
+
+	inventory := make([]StreamInfo, 0, len(db.closed)+1)
+	spans := db.spans
+
+	for commit := db.reader.Next(0); commit > 0; commit = db.reader.Next(commit) {
+		info := StreamInfo{
+			Commit:   commit,
+			State:    STREAM_CLOSED,
+			Location: LOCATION_PEER,
+		}
+
+		span := spans[commit]
+
+		if commit == db.current {
+			info.State = STREAM_OPEN
+			span = db.span
+		}
+
+		info.First, info.Last = span.First, span.Last
+
+		if commit == db.current && db.stream != nil {
+			info.Location = LOCATION_LOCAL
+			info.Size = db.stream.Offset()
+		} else if stat, err := os.Stat(db.reader.Path(commit)); err == nil {
+			info.Location = LOCATION_LOCAL
+			info.Size = stat.Size()
+
+			if info.State == STREAM_CLOSED {
+				if info.Digest, err = digests.get(db.reader.Path(commit), stat); err != nil {
+					return nil, err
+				}
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		inventory = append(inventory, info)
+	}
+
+	return inventory, nil
+}
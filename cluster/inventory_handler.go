@@ -0,0 +1,32 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (n *Node) inventoryHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body.Close()
+
+	if role, ok := n.auth.Authorize(w, req, READ); !ok {
+		return
+	} else if !role.Allows("", "") {
+		Deny(w, FORBIDDEN)
+		return
+	}
+
+	res := make(map[string]interface{})
+
+	inventory, err := n.db.Inventory()
+
+	if err != nil {
+		res = Fail(w, err)
+	} else {
+		res["meta"] = n.Metadata()
+		res["streams"] = inventory
+	}
+
+	js, _ := json.MarshalIndent(res, "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,182 @@
+// Package loopback is an integration harness running clusters of nodes
+// within a test's process, so applications using the cluster package
+// can test against several nodes without choosing ports or managing
+// data directories.
+//
+//	c, err := loopback.New(3)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//
+//	defer c.Close()
+//
+//	c.Leader().Event([]byte("a"), "", map[string]string{"customer": "1"})
+//
+// Nodes are real: they listen on ports chosen by the OS on the loopback
+// interface, talk raft and RPCs to each other over it, and write their
+// streams to temporary data directories, which are removed once closed.
+// Nothing is faked in memory, and there's no in-memory variant: raft's
+// log, the streams and the HTTP nodes use to join, forward writes and
+// fetch streams are what's deployed, so are what's tested.
+package loopback
+
+import (
+	"github.com/customerio/esdb/cluster"
+
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	DEFAULT_TIMEOUT = 10 * time.Second
+
+	// How often conditions are checked while waiting for them.
+	POLL_INTERVAL = time.Millisecond
+)
+
+var TIMEOUT = errors.New("Timed out waiting for the cluster")
+
+type Cluster struct {
+	Nodes []*cluster.Node
+	dir   string
+	opts  []cluster.Option
+}
+
+// Starts a cluster of the given number of nodes, each created with the
+// options, returning once each has joined. The first node creates the
+// cluster, so starts as leader.
+func New(size int, opts ...cluster.Option) (*Cluster, error) {
+	dir, err := ioutil.TempDir("", "esdb-loopback")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cluster{dir: dir, opts: opts}
+
+	for i := 0; i < size; i++ {
+		if _, err = c.Add(); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Starts another node, joining it to the cluster.
+func (c *Cluster) Add() (*cluster.Node, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(c.dir, fmt.Sprint("node", len(c.Nodes)))
+
+	n, err := cluster.NewNode(path, "127.0.0.1", 0, c.opts...)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	n.SetListener(l)
+
+	join := ""
+	if len(c.Nodes) > 0 {
+		join = c.Nodes[0].State().Uri[len("http://"):]
+	}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- n.Start(join)
+	}()
+
+	err = c.WaitFor(func() bool {
+		select {
+		case err = <-errs:
+			return true
+		default:
+			return n.Running() && c.joined(n)
+		}
+	})
+
+	if err != nil {
+		n.Stop()
+		return nil, err
+	}
+
+	c.Nodes = append(c.Nodes, n)
+
+	return n, nil
+}
+
+// Whether the first node has added the node to the cluster.
+func (c *Cluster) joined(n *cluster.Node) bool {
+	if len(c.Nodes) == 0 {
+		return true
+	}
+
+	uri := n.State().Uri
+
+	for _, peer := range c.Nodes[0].ClusterConnectionStrings() {
+		if peer == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The node currently leading the cluster, or nil if there's none.
+func (c *Cluster) Leader() *cluster.Node {
+	for _, n := range c.Nodes {
+		if n.Running() && n.State().State == "leader" {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// Waits for a leader to be elected, returning it.
+func (c *Cluster) WaitForLeader() (*cluster.Node, error) {
+	var leader *cluster.Node
+
+	err := c.WaitFor(func() bool {
+		leader = c.Leader()
+		return leader != nil
+	})
+
+	return leader, err
+}
+
+// Waits until the condition is true, returning TIMEOUT if it isn't
+// within DEFAULT_TIMEOUT. Useful for waiting for writes to replicate
+// rather than sleeping for a fixed time.
+func (c *Cluster) WaitFor(condition func() bool) error {
+	deadline := time.Now().Add(DEFAULT_TIMEOUT)
+
+	for !condition() {
+		if time.Now().After(deadline) {
+			return TIMEOUT
+		}
+
+		time.Sleep(POLL_INTERVAL)
+	}
+
+	return nil
+}
+
+// Stops every node, and removes their data.
+func (c *Cluster) Close() {
+	for _, n := range c.Nodes {
+		n.Stop()
+	}
+
+	os.RemoveAll(c.dir)
+}
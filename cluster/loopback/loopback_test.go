@@ -0,0 +1,37 @@
+package loopback
+
+import (
+	"testing"
+)
+
+func TestCluster(t *testing.T) {
+	c, err := New(3)
+	if err != nil {
+		t.Fatalf("Failed to start cluster: %v", err)
+	}
+
+	defer c.Close()
+
+	if len(c.Nodes) != 3 {
+		t.Fatalf("Expected 3 nodes, found: %v", len(c.Nodes))
+	}
+
+	for _, n := range c.Nodes {
+		if !n.Running() {
+			t.Errorf("Expected node to be running: %v", n.State().Uri)
+		}
+	}
+
+	leader, err := c.WaitForLeader()
+	if err != nil {
+		t.Fatalf("No leader elected: %v", err)
+	}
+
+	if err := leader.Event([]byte("a"), "", map[string]string{"a": "1"}); err != nil {
+		t.Errorf("Failed to write to the leader: %v", err)
+	}
+
+	if peers := leader.ClusterConnectionStrings(); len(peers) != 3 {
+		t.Errorf("Expected the leader to know of 3 nodes, found: %v", peers)
+	}
+}
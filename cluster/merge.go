@@ -1,20 +1,149 @@
 package cluster
 
 import (
+	"github.com/customerio/esdb/binary"
 	"github.com/customerio/esdb/stream"
 
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
-func Merge(dbpath string, start, stop uint64, closed []uint64) error {
+var MERGE_OUTDATED = errors.New("Events were deleted or redacted from the streams since they were merged")
+
+// Merges the closed streams between start and stop, physically
+// removing any events which have been deleted or have expired. Streams
+// are merged in commit order, so events in the merged stream keep
+// their order.
+func Merge(dbpath string, start, stop uint64, closed []uint64, tombstones Tombstones, deleted Deletions) error {
+	return MergeThrottled(dbpath, start, stop, closed, tombstones, deleted, nil, nil, time.Now().UnixNano())
+}
+
+// Merges as Merge, writing redacted events with their redacted bodies,
+// limiting the events read by the throttle, and only removing events
+// which expired before the given time (in unix nanoseconds). Each node merges its own copy, so the same time must be
+// given on every node for their copies to match. The deletions and
+// redactions merged are recorded alongside, so the streams aren't
+// compressed if more have been recorded since.
+func MergeThrottled(dbpath string, start, stop uint64, closed []uint64, tombstones Tombstones, deleted Deletions, redactions Redactions, throttle *Throttle, expiredBefore int64) error {
 	paths := make([]string, 0, len(closed))
+	commits := make([]uint64, 0, len(closed))
 
 	for _, commit := range closed {
 		if commit >= start && commit <= stop {
-			paths = append(paths, filepath.Join(dbpath, "stream", fmt.Sprintf("events.%024v.stream", commit)))
+			commits = append(commits, commit)
+		}
+	}
+
+	sort.Sort(OffsetSlice(commits))
+
+	for _, commit := range commits {
+		paths = append(paths, filepath.Join(dbpath, "stream", fmt.Sprintf("events.%024v.stream", commit)))
+	}
+
+	removals := filepath.Join(dbpath, "stream", fmt.Sprintf("events.%024v.removals", start))
+	os.Remove(removals)
+
+	err := stream.MergeFiltered(filepath.Join(dbpath, "stream", fmt.Sprintf("events.%024v.tmpstream", start)), paths, func(i int, e *stream.Event) bool {
+		throttle.Wait(len(e.Data))
+		redactions.apply(commits[i], e)
+		return !hidden(tombstones, deleted, commits[i], e, expiredBefore)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(removals, []byte(removalsDigest(deleted, redactions, start, stop)), 0644)
+}
+
+// Identifies the deletions and redactions of events in the streams
+// between start and stop. Merged streams hold the events as they were
+// when merged, so the digest is compared when they're compressed.
+func removalsDigest(deleted Deletions, redactions Redactions, start, stop uint64) string {
+	buf := &bytes.Buffer{}
+
+	for _, commit := range removedCommits(deleted, redactions, start, stop) {
+		binary.WriteInt64(buf, int64(commit))
+
+		offsets := make([]int64, 0, len(deleted[commit]))
+		for offset := range deleted[commit] {
+			offsets = append(offsets, offset)
+		}
+
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		binary.WriteUvarint(buf, len(offsets))
+
+		for _, offset := range offsets {
+			binary.WriteInt64(buf, offset)
+		}
+
+		offsets = make([]int64, 0, len(redactions[commit]))
+		for offset := range redactions[commit] {
+			offsets = append(offsets, offset)
+		}
+
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		binary.WriteUvarint(buf, len(offsets))
+
+		for _, offset := range offsets {
+			binary.WriteInt64(buf, offset)
+			binary.WriteUvarint(buf, len(redactions[commit][offset]))
+			buf.Write(redactions[commit][offset])
 		}
 	}
 
-	return stream.Merge(filepath.Join(dbpath, "stream", fmt.Sprintf("events.%024v.tmpstream", start)), paths)
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+// The commits between start and stop with deleted or redacted events, in order.
+func removedCommits(deleted Deletions, redactions Redactions, start, stop uint64) []uint64 {
+	seen := make(map[uint64]bool)
+	commits := make([]uint64, 0)
+
+	add := func(commit uint64) {
+		if commit >= start && commit <= stop && !seen[commit] {
+			seen[commit] = true
+			commits = append(commits, commit)
+		}
+	}
+
+	for commit := range deleted {
+		add(commit)
+	}
+
+	for commit := range redactions {
+		add(commit)
+	}
+
+	sort.Sort(OffsetSlice(commits))
+
+	return commits
+}
+
+// The removals the stream merged into the one starting at start was
+// merged with, if it was recorded.
+func (db *DB) mergedRemovals(start uint64) string {
+	b, _ := ioutil.ReadFile(db.reader.removalspath(start))
+	return string(b)
+}
+
+// Removes the stream merged into the one starting at start, once it's
+// finished merging, unless it has the current removals, so the streams
+// can be merged again.
+func (db *DB) discardMerge(start, stop uint64) {
+	db.merges.end(start)
+
+	if merged := db.mergedRemovals(start); merged != "" && merged != removalsDigest(db.deleted, db.redactions, start, stop) {
+		os.Remove(db.reader.compressedpath(start))
+		os.Remove(db.reader.removalspath(start))
+	}
 }
@@ -8,6 +8,10 @@ import (
 func (n *Node) metaEventsHandler(w http.ResponseWriter, req *http.Request) {
 	req.Body.Close()
 
+	if _, ok := n.auth.Authorize(w, req, READ); !ok {
+		return
+	}
+
 	js, _ := json.MarshalIndent(n.Metadata(), "", "  ")
 	w.Write(js)
 	w.Write([]byte("\n"))
@@ -0,0 +1,179 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Bucket upper bounds, in seconds, of the histograms Metrics exports:
+// Prometheus' defaults, with finer ones for single writes.
+var DEFAULT_BUCKETS = []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics exports histograms of timings, and gauges read as they're
+// scraped, in Prometheus' text format.
+type Metrics struct {
+	mutex   sync.Mutex
+	metrics map[string]metric
+}
+
+type metric interface {
+	write(w io.Writer, name string) error
+}
+
+type gauge struct {
+	help  string
+	value func() float64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{metrics: make(map[string]metric)}
+}
+
+// The histogram with the name, added with DEFAULT_BUCKETS if it's new.
+func (m *Metrics) Histogram(name, help string) *Histogram {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if h, ok := m.metrics[name].(*Histogram); ok {
+		return h
+	}
+
+	h := NewHistogram(help, DEFAULT_BUCKETS)
+	m.metrics[name] = h
+
+	return h
+}
+
+// Exports the value returned by the func when scraped as the gauge.
+func (m *Metrics) Gauge(name, help string, value func() float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.metrics[name] = gauge{help, value}
+}
+
+// Writes every metric, ordered by name.
+func (m *Metrics) Write(w io.Writer) error {
+	m.mutex.Lock()
+	names := make([]string, 0, len(m.metrics))
+	metrics := make(map[string]metric, len(m.metrics))
+
+	for name, metric := range m.metrics {
+		names = append(names, name)
+		metrics[name] = metric
+	}
+	m.mutex.Unlock()
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := metrics[name].write(w, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.Write(w)
+}
+
+func (g gauge) write(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, g.help, name, name, formatFloat(g.value()))
+	return err
+}
+
+// Histogram counts the durations observed into buckets, as Prometheus
+// histograms do. It's a Timer, observing how long each func takes.
+type Histogram struct {
+	mutex   sync.Mutex
+	help    string
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func NewHistogram(help string, buckets []float64) *Histogram {
+	return &Histogram{
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Time(f func()) {
+	start := time.Now()
+	f()
+	h.Observe(time.Since(start))
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, le := range h.buckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += seconds
+}
+
+func (h *Histogram) write(w io.Writer, name string) error {
+	h.mutex.Lock()
+	counts := append([]uint64{}, h.counts...)
+	count, sum := h.count, h.sum
+	h.mutex.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, h.help, name); err != nil {
+		return err
+	}
+
+	for i, le := range h.buckets {
+		if _, err := fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(le), counts[i]); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %s\n%s_count %d\n", name, count, name, formatFloat(sum), name, count)
+	return err
+}
+
+// Times the func with both timers, so metrics are kept alongside a
+// timer given by WithMetrics or the node's setters.
+func bothTimers(t Timer, h *Histogram) Timer {
+	return timerPair{t, h}
+}
+
+type timerPair struct {
+	timer     Timer
+	histogram *Histogram
+}
+
+func (p timerPair) Time(f func()) {
+	p.histogram.Time(func() {
+		p.timer.Time(f)
+	})
+}
+
+func (p timerPair) TimeStream(commit uint64, f func()) {
+	p.histogram.Time(func() {
+		timeStream(p.timer, commit, f)
+	})
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
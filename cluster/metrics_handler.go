@@ -0,0 +1,43 @@
+package cluster
+
+import (
+	"net/http"
+)
+
+// Adds the node's metrics, timing writes, rotations, scans and
+// snapshots alongside any timers already set.
+func (n *Node) registerMetrics() {
+	m := NewMetrics()
+
+	n.metrics = m
+	n.db.wtimer = bothTimers(n.db.wtimer, m.Histogram("esdb_write_seconds", "Time taken writing events to the open stream."))
+	n.db.rtimer = bothTimers(n.db.rtimer, m.Histogram("esdb_rotation_seconds", "Time taken closing the open stream and creating the next."))
+	n.db.stimer = bothTimers(n.db.stimer, m.Histogram("esdb_snapshot_seconds", "Time taken taking each raft snapshot."))
+	n.db.reader.RegisterMetrics(m)
+
+	m.Gauge("esdb_raft_commit_index", "The raft log index last committed.", func() float64 {
+		if n.raft == nil {
+			return 0
+		}
+
+		return float64(n.raft.CommitIndex())
+	})
+}
+
+// Adds the reader's metrics, timing scans alongside any timer already
+// set, as esdb-reader exports them too.
+func (r *Reader) RegisterMetrics(m *Metrics) {
+	r.timer = bothTimers(r.timer, m.Histogram("esdb_scan_seconds", "Time taken scanning or iterating each stream."))
+
+	m.Gauge("esdb_open_streams", "Streams held open for reading and writing.", func() float64 {
+		return float64(r.OpenStreams())
+	})
+}
+
+func (n *Node) metricsHandler(w http.ResponseWriter, req *http.Request) {
+	if _, ok := n.auth.Authorize(w, req, READ); !ok {
+		return
+	}
+
+	n.metrics.ServeHTTP(w, req)
+}
@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	h := m.Histogram("esdb_test_seconds", "Test timings.")
+
+	h.Observe(2 * time.Millisecond)
+	h.Observe(time.Minute)
+
+	m.Gauge("esdb_test_streams", "Test streams.", func() float64 { return 3 })
+
+	out := new(strings.Builder)
+	m.Write(out)
+
+	for _, line := range []string{
+		"# TYPE esdb_test_seconds histogram",
+		`esdb_test_seconds_bucket{le="0.001"} 0`,
+		`esdb_test_seconds_bucket{le="0.005"} 1`,
+		`esdb_test_seconds_bucket{le="10"} 1`,
+		`esdb_test_seconds_bucket{le="+Inf"} 2`,
+		"esdb_test_seconds_sum 60.002",
+		"esdb_test_seconds_count 2",
+		"# TYPE esdb_test_streams gauge",
+		"esdb_test_streams 3",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("Expected metrics to include %q, found:\n%v", line, out)
+		}
+	}
+}
+
+func TestNodeMetrics(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("a"), map[string]string{"customer": "1"})
+		trackevent(n, []byte("b"), map[string]string{"customer": "1"})
+
+		Query{Index: "customer", Value: "1"}.run(n.db)
+
+		w := httptest.NewRecorder()
+		n.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		body, _ := ioutil.ReadAll(w.Body)
+
+		for _, name := range []string{"esdb_write_seconds_count", "esdb_rotation_seconds_count", "esdb_scan_seconds_count", "esdb_open_streams", "esdb_raft_commit_index"} {
+			if !strings.Contains(string(body), name+" ") || strings.Contains(string(body), name+" 0\n") {
+				t.Errorf("Expected %v to be recorded, found:\n%s", name, body)
+			}
+		}
+	})
+}
@@ -2,15 +2,20 @@ package cluster
 
 import (
 	"github.com/jrallison/raft"
+	"google.golang.org/grpc"
 
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,42 +23,116 @@ var NOT_LEADER_ERROR = errors.New("Not current leader")
 var NO_LEADER_ERROR = errors.New("No current leader")
 
 type Node struct {
-	name        string
-	host        string
-	port        int
-	path        string
-	db          *DB
-	raft        raft.Server
-	Rest        *RestServer
-	WriteTimer  Timer
-	RotateTimer Timer
+	name       string
+	id         string
+	host       string
+	port       int
+	path       string
+	db         *DB
+	raft       raft.Server
+	retry      RetryPolicy
+	auth       *Authorizer
+	readonly   int32
+	catchingUp int32
+	standalone bool
+	replace    bool
+	promote    bool
+	follow     sync.Mutex
+	unfollow   chan bool
+	retention  retainer
+	drain      *drainer
+	notify     chan bool
+	mux        *http.ServeMux
+	writes     *writeQueue
+	// Writes made with ACK_NONE.
+	unacknowledged *writeQueue
+	listener       net.Listener
+	Rest           *RestServer
+	WriteTimer     Timer
+	RotateTimer    Timer
+
+	// Serves gRPC, if given a listener. See SetGRPCListener.
+	grpcListener net.Listener
+	GRPC         *grpc.Server
+
+	// Runs WithCompaction's compactor on the leader.
+	compaction compactor
+	// Exported on /metrics.
+	metrics *Metrics
+	// Whether followers forward writes. See SetForwarding.
+	forward bool
+	// Runs WithSnapshotPolicy's checks on the leader.
+	snapshotPolicy snapshotter
+	// Serves and calls peers over TLS, if set. See SetTLSConfig.
+	tls *tls.Config
 }
 
 type NodeState struct {
-	Name   string `json:"name"`
-	State  string `json:"state"`
-	Commit uint64 `json:"commit"`
-	Path   string `json:"path"`
-	Uri    string `json:"uri"`
+	Name     string            `json:"name"`
+	Id       string            `json:"id,omitempty"`
+	State    string            `json:"state"`
+	Commit   uint64            `json:"commit"`
+	Path     string            `json:"path"`
+	Uri      string            `json:"uri"`
+	Degraded map[string]string `json:"degraded,omitempty"`
+	Failures map[string]int    `json:"failures,omitempty"`
+	Disk     float64           `json:"disk,omitempty"`
+	ReadOnly bool              `json:"readonly,omitempty"`
+	// Fetching streams missed while down. See Node.CatchingUp.
+	CatchingUp bool `json:"catching_up,omitempty"`
+	// The primary's nodes, if the cluster's a follower.
+	Following []string `json:"following,omitempty"`
+	// The last commit applied. See DB.Applied.
+	Applied uint64 `json:"applied,omitempty"`
 }
 
 type Metadata struct {
-	Peers      []string `json:"peers"`
-	Closed     []uint64 `json:"closed"`
-	Current    uint64   `json:"current"`
-	MostRecent int64    `json:"recent"`
+	Peers      []string         `json:"peers"`
+	Closed     []uint64         `json:"closed"`
+	Current    uint64           `json:"current"`
+	MostRecent int64            `json:"recent"`
+	Indexes    map[string]int64 `json:"indexes,omitempty"`
+	Tombstones Tombstones       `json:"tombstones,omitempty"`
+	Deleted    Deletions        `json:"deleted,omitempty"`
+	Redactions Redactions       `json:"redactions,omitempty"`
+	Revision   uint64           `json:"revision,omitempty"`
+	Rewrites   Rewrites         `json:"rewrites,omitempty"`
+	// When the closed streams and current one were written, so readers
+	// can skip those outside a query's window. See Window.
+	Spans Spans `json:"spans,omitempty"`
+	Span  Span  `json:"span"`
 }
 
-func NewNode(path, host string, port int) (n *Node) {
+func NewNode(path, host string, port int, opts ...Option) (*Node, error) {
 	if err := os.MkdirAll(filepath.Join(path, "stream"), 0744); err != nil {
-		log.Fatalf("Unable to create stream directory: %v", err)
+		return nil, fmt.Errorf("Unable to create stream directory: %v", err)
 	}
 
-	n = &Node{
-		host: host,
-		port: port,
-		path: path,
-		db:   NewDb(filepath.Join(path, "stream")),
+	db, err := NewDb(filepath.Join(path, "stream"), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{
+		host:  host,
+		port:  port,
+		path:  path,
+		db:    db,
+		retry: DefaultRetryPolicy,
+		drain: newDrainer(),
+		mux:   http.NewServeMux(),
+	}
+
+	n.writes = newWriteQueue(func(bodies [][]byte, groupings []string, indexes, headers []map[string]string, ids []string) (uint64, error) {
+		return n.WriteEventsWithIds(bodies, groupings, indexes, headers, ids, ACK_LEADER)
+	})
+
+	// Events already validated and transformed. See ACK_NONE.
+	n.unacknowledged = newWriteQueue(func(bodies [][]byte, groupings []string, indexes, headers []map[string]string, ids []string) (uint64, error) {
+		return n.do(bodies, groupings, indexes, headers, ids, ACK_LEADER)
+	})
+	n.unacknowledged.failed = func(err error) {
+		n.db.logger.Println("WRITE: Unacknowledged write failed:", err)
 	}
 
 	// Read existing name or generate a new one.
@@ -62,45 +141,100 @@ func NewNode(path, host string, port int) (n *Node) {
 	} else {
 		n.name = fmt.Sprintf("%07x", rand.Int())[0:7]
 		if err = ioutil.WriteFile(filepath.Join(path, "name"), []byte(n.name), 0644); err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 	}
 
-	return
+	if n.id, err = loadIdentity(path); err != nil {
+		return nil, err
+	}
+
+	n.registerMetrics()
+
+	return n, nil
 }
 
 func (n *Node) Start(join string) (err error) {
-	log.Printf("Initializing Raft Server: %s", n.path)
+	n.db.reconcileCompressions()
+
+	n.db.logger.Printf("Initializing Raft Server: %s", n.path)
 
-	if err = Connect(n, join); err != nil {
+	if n.standalone {
+		if join != "" {
+			return STANDALONE_ERROR
+		}
+
+		n.db.logger.Println("Running standalone, without raft")
+		err = connectStandalone(n)
+	} else {
+		err = Connect(n, join)
+	}
+
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Println("Initializing HTTP server")
+	n.db.reconcileStreams()
+	n.startCatchUp(join)
+	n.startFollowing(DEFAULT_FOLLOW_INTERVAL)
+	n.startRetention(DEFAULT_RETENTION_INTERVAL)
+	n.startCompaction(DEFAULT_COMPACTION_INTERVAL)
+	n.startSnapshotPolicy(DEFAULT_SNAPSHOT_POLICY_INTERVAL)
+
+	n.db.logger.Println("Initializing HTTP server")
+
+	if n.db.disk != nil {
+		n.db.disk.Start(DEFAULT_DISK_INTERVAL, n.db.supervisor)
+	}
 
 	n.Rest = NewRestServer(n)
 
+	if n.grpcListener != nil {
+		n.GRPC = NewGRPCServer(n)
+		go n.serveGRPC()
+	}
+
+	if os.Getenv("NOTIFY_SOCKET") != "" {
+		n.notify = make(chan bool)
+		go n.notifySystemd(n.notify)
+	}
+
 	return n.Rest.Start()
 }
 
 func (n *Node) Stop() {
+	n.db.disk.Stop()
+	n.stopNotify()
+	n.stopFollowing()
+	n.stopRetention()
+	n.stopCompaction()
+	n.stopSnapshotPolicy()
+
 	if n.Rest != nil {
 		n.Rest.Stop()
 	}
 
+	if n.GRPC != nil {
+		n.GRPC.Stop()
+	}
+
 	if n.raft != nil {
+		atomic.StoreInt32(&n.db.stopping, 1)
 		n.raft.Stop()
 	}
-
-	http.DefaultServeMux = http.NewServeMux()
 }
 
+// Timers are set alongside the node's metrics, which keep timing too.
 func (n *Node) SetWriteTimer(t Timer) {
-	n.db.wtimer = t
+	n.db.wtimer = bothTimers(t, n.metrics.Histogram("esdb_write_seconds", ""))
 }
 
 func (n *Node) SetRotateTimer(t Timer) {
-	n.db.rtimer = t
+	n.db.rtimer = bothTimers(t, n.metrics.Histogram("esdb_rotation_seconds", ""))
+}
+
+func (n *Node) SetScanTimer(t Timer) {
+	n.db.reader.timer = bothTimers(t, n.metrics.Histogram("esdb_scan_seconds", ""))
 }
 
 func (n *Node) SetRotateThreshold(size int64) {
@@ -111,13 +245,130 @@ func (n *Node) SetSnapshotBuffer(count uint64) {
 	n.db.SnapshotBuffer = count
 }
 
-func (n *Node) Event(body []byte, indexes map[string]string) (err error) {
+// Sets the hook called when background work such as
+// snapshotting fails. See ErrorHook.
+func (n *Node) SetErrorHook(hook ErrorHook) {
+	n.db.supervisor.SetHook(hook)
+}
+
+// Returns the errors of any background tasks which have
+// failed and left the node in a degraded state.
+func (n *Node) Degraded() map[string]string {
+	return n.db.supervisor.Degraded()
+}
+
+// Returns how many times in a row each failing background task has failed.
+func (n *Node) Failures() map[string]int {
+	return n.db.supervisor.Failures()
+}
+
+// Sets how failed snapshots are retried before the node is degraded.
+func (n *Node) SetSnapshotRetryPolicy(p RetryPolicy) {
+	n.db.supervisor.SetRetryPolicy("snapshot", p)
+}
+
+// Sets the retry policy for RPCs made to other nodes.
+func (n *Node) SetRetryPolicy(p RetryPolicy) {
+	if p.TLS == nil {
+		p.TLS = n.tls
+	}
+
+	n.retry = p
+}
+
+// Sets the retry policy for fetching missing streams from peers.
+func (n *Node) SetFetchRetryPolicy(p RetryPolicy) {
+	if p.TLS == nil {
+		p.TLS = n.tls
+	}
+
+	n.db.reader.SetRetryPolicy(p)
+}
+
+// Sets how peers are chosen when fetching missing streams.
+func (n *Node) SetRouting(strategy string) error {
+	return n.db.reader.SetRouting(strategy)
+}
+
+// Enforces the authorizer's roles on every HTTP request. The key
+// is sent to peers when fetching missing streams from them, and with
+// RPCs, which need it to have the admin operation unless peers'
+// certificates are verified.
+func (n *Node) SetAuthorizer(a *Authorizer, key string) {
+	n.auth = a
+	n.db.reader.SetApiKey(key)
+}
+
+// Monitors usage of the data volume. Above the soft watermark streams
+// are removed as soon as they're compressed, above the hard watermark
+// writes are rejected. Both are fractions of the volume, e.g. 0.9.
+func (n *Node) SetWatermarks(soft, hard float64) error {
+	monitor, err := NewDiskMonitor(n.path, soft, hard)
+	if err != nil {
+		return err
+	}
+
+	n.db.disk = monitor
+	return nil
+}
+
+func (n *Node) SetUniqueIndexes(names []string) {
+	for _, name := range names {
+		n.db.UniqueIndexes[name] = true
+	}
+}
+
+func (n *Node) Event(body []byte, grouping string, indexes map[string]string) (err error) {
+	if n.raft == nil {
+		return errors.New("Raft not yet initialized")
+	}
+
+	if reserved(indexes) {
+		return RESERVED_INDEX
+	}
+
+	if n.db.disk.Full() {
+		return DISK_FULL
+	}
+
+	if err := n.writable(); err != nil {
+		return err
+	}
+
+	if n.raft.State() != "leader" {
+		return NOT_LEADER_ERROR
+	}
+
+	bodies, groupings, idx, _, _, err := n.db.transform([][]byte{body}, []string{grouping}, []map[string]string{indexes}, nil, nil)
+	if err != nil || len(bodies) == 0 {
+		// Dropped by a transformer, if there's no error.
+		return err
+	}
+
+	if err := n.db.quotas.admit(bodies, idx); err != nil {
+		return err
+	}
+
+	_, err = n.raft.Do(NewEventCommand(bodies[0], groupings[0], idx[0], time.Now().UnixNano()))
+	return
+}
+
+func (n *Node) Events(bodies [][]byte, groupings []string, indexes []map[string]string) (err error) {
+	_, err = n.WriteEvents(bodies, groupings, indexes, ACK_LEADER)
+	return
+}
+
+func (n *Node) Compress(start, stop uint64) (err error) {
 	if n.raft == nil {
 		return errors.New("Raft not yet initialized")
 	}
 
+	if n.db.Following() {
+		return FOLLOWER_ERROR
+	}
+
 	if n.raft.State() == "leader" {
-		_, err = n.raft.Do(NewEventCommand(body, indexes, time.Now().UnixNano()))
+		_, err = n.raft.Do(NewCompressCommand(start, stop, time.Now().UnixNano(), n.db.mergedRemovals(start)))
 	} else {
 		err = NOT_LEADER_ERROR
 	}
@@ -125,13 +376,14 @@ func (n *Node) Event(body []byte, indexes map[string]string) (err error) {
 	return
 }
 
-func (n *Node) Events(bodies [][]byte, indexes []map[string]string) (err error) {
+// Records an administrative action in the audit log.
+func (n *Node) Audit(action string, details map[string]interface{}) (err error) {
 	if n.raft == nil {
 		return errors.New("Raft not yet initialized")
 	}
 
 	if n.raft.State() == "leader" {
-		_, err = n.raft.Do(NewEventsCommand(bodies, indexes, time.Now().UnixNano()))
+		_, err = n.raft.Do(NewAuditCommand(action, details, time.Now().UnixNano()))
 	} else {
 		err = NOT_LEADER_ERROR
 	}
@@ -139,13 +391,111 @@ func (n *Node) Events(bodies [][]byte, indexes []map[string]string) (err error)
 	return
 }
 
-func (n *Node) Compress(start, stop uint64) (err error) {
+// Deletes every event written so far with the given index value.
+func (n *Node) Delete(index, value string) (err error) {
+	if n.raft == nil {
+		return errors.New("Raft not yet initialized")
+	}
+
+	if err := n.writable(); err != nil {
+		return err
+	}
+
+	if n.raft.State() == "leader" {
+		_, err = n.raft.Do(NewDeleteCommand(index, value, time.Now().UnixNano()))
+	} else {
+		err = NOT_LEADER_ERROR
+	}
+
+	return
+}
+
+// Deletes the individual events, hiding them from scans immediately.
+func (n *Node) SoftDelete(events []EventId) (err error) {
+	if n.raft == nil {
+		return errors.New("Raft not yet initialized")
+	}
+
+	if err := n.writable(); err != nil {
+		return err
+	}
+
+	if n.raft.State() == "leader" {
+		_, err = n.raft.Do(NewSoftDeleteCommand(events))
+	} else {
+		err = NOT_LEADER_ERROR
+	}
+
+	return
+}
+
+// Redacts events within a closed stream on every node in the cluster.
+func (n *Node) Redact(commit uint64, redactions []Redaction) (err error) {
+	if n.raft == nil {
+		return errors.New("Raft not yet initialized")
+	}
+
+	if n.db.Following() {
+		return FOLLOWER_ERROR
+	}
+
+	if n.raft.State() != "leader" {
+		err = NOT_LEADER_ERROR
+	} else if err = n.db.checkRedactions(commit, redactions); err == nil {
+		_, err = n.raft.Do(NewRedactCommand(commit, redactions, time.Now().UnixNano()))
+	}
+
+	return
+}
+
+// Switches only this node in or out of read-only mode, rejecting
+// writes sent to it while the rest of the cluster is unaffected.
+func (n *Node) SetReadOnly(readonly bool) {
+	var value int32
+
+	if readonly {
+		value = 1
+	}
+
+	atomic.StoreInt32(&n.readonly, value)
+}
+
+// Switches every node in the cluster in or out of read-only mode.
+func (n *Node) SetClusterReadOnly(readonly bool) (err error) {
+	if n.raft == nil {
+		return errors.New("Raft not yet initialized")
+	}
+
+	if n.raft.State() == "leader" {
+		_, err = n.raft.Do(NewReadOnlyCommand(readonly, time.Now().UnixNano()))
+	} else {
+		err = NOT_LEADER_ERROR
+	}
+
+	return
+}
+
+// Whether writes are rejected, by this node or the whole cluster.
+func (n *Node) ReadOnly() bool {
+	return atomic.LoadInt32(&n.readonly) == 1 || n.db.ReadOnly()
+}
+
+// Splits a closed stream into pieces of roughly size bytes each.
+func (n *Node) Split(commit uint64, size int64) (err error) {
 	if n.raft == nil {
 		return errors.New("Raft not yet initialized")
 	}
 
+	if n.db.Following() {
+		return FOLLOWER_ERROR
+	}
+
 	if n.raft.State() == "leader" {
-		_, err = n.raft.Do(NewCompressCommand(start, stop))
+		var command *SplitCommand
+
+		if command, err = n.db.planSplit(commit, size); err == nil {
+			_, err = n.raft.Do(command)
+		}
 	} else {
 		err = NOT_LEADER_ERROR
 	}
@@ -160,27 +510,50 @@ func (n *Node) RemoveFromCluster(name string) error {
 	}, &NoResponse{})
 }
 
+// Whether the node has started and is taking part in the cluster.
+func (n *Node) Running() bool {
+	return n.raft != nil && n.raft.Running()
+}
+
 func (n *Node) State() NodeState {
 	return NodeState{
 		n.raft.Name(),
+		n.id,
 		n.raft.State(),
 		n.raft.CommitIndex(),
 		n.path,
-		fmt.Sprintf("http://%s:%d", n.host, n.port),
+		n.uri(),
+		n.Degraded(),
+		n.Failures(),
+		n.db.disk.Usage(),
+		n.ReadOnly(),
+		n.CatchingUp(),
+		n.db.following,
+		n.db.Applied(),
 	}
 }
 
 func (n *Node) Metadata() Metadata {
-	return Metadata{
-		Peers:      n.db.peerConnectionStrings(),
-		Closed:     n.db.closed,
-		Current:    n.db.current,
-		MostRecent: n.db.MostRecent,
-	}
+	meta := n.db.metadata()
+	meta.Peers = n.db.peerConnectionStrings()
+
+	return meta
 }
 
+// Registers a handler with the node's HTTP server. Each node has its
+// own, so several can run within a process.
 func (n *Node) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
-	http.HandleFunc(pattern, handler)
+	n.mux.HandleFunc(pattern, handler)
+}
+
+// Serves HTTP from the listener rather than listening on the node's
+// port, which becomes the listener's.
+func (n *Node) SetListener(l net.Listener) {
+	n.listener = l
+
+	if addr, ok := l.Addr().(*net.TCPAddr); ok {
+		n.port = addr.Port
+	}
 }
 
 func (n *Node) LeaderConnectionString() (string, error) {
@@ -194,5 +567,5 @@ func (n *Node) LeaderConnectionString() (string, error) {
 }
 
 func (n *Node) ClusterConnectionStrings() []string {
-	return append(n.db.peerConnectionStrings(), fmt.Sprintf("http://%s:%d", n.host, n.port))
+	return append(n.db.peerConnectionStrings(), n.uri())
 }
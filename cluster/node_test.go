@@ -13,7 +13,7 @@ func withNode(perform func(n *Node)) {
 	os.RemoveAll("tmp")
 	os.MkdirAll("tmp", 0755)
 
-	node := NewNode("tmp/teststream", "localhost", 3001)
+	node, _ := NewNode("tmp/teststream", "localhost", 3001)
 	go node.Start("")
 
 	for node.raft == nil || !node.raft.Running() {
@@ -26,7 +26,11 @@ func withNode(perform func(n *Node)) {
 }
 
 func trackevent(n *Node, data []byte, indexes map[string]string) {
-	n.Event(data, indexes)
+	n.Event(data, "", indexes)
+}
+
+func trackgrouped(n *Node, data []byte, grouping string, indexes map[string]string) {
+	n.Event(data, grouping, indexes)
 }
 
 func TestScanningWithoutRotations(t *testing.T) {
@@ -250,3 +254,52 @@ func TestIteratingAfterWithRotations(t *testing.T) {
 		}
 	})
 }
+
+func TestScanningGroupingsWithRotations(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(50)
+
+		trackgrouped(n, []byte("a"), "1", map[string]string{"a": "b"})
+		trackgrouped(n, []byte("b"), "2", map[string]string{"a": "b"})
+		trackgrouped(n, []byte("c"), "1", map[string]string{"a": "c"})
+		trackgrouped(n, []byte("d"), "2", map[string]string{"a": "b"})
+		trackevent(n, []byte("e"), map[string]string{"a": "b"})
+
+		var tests = []struct {
+			grouping string
+			events   []string
+		}{
+			{"1", []string{"c", "a"}},
+			{"2", []string{"d", "b"}},
+			{"3", []string{}},
+		}
+
+		for i, test := range tests {
+			found := make([]string, 0)
+
+			n.db.ScanGrouping(test.grouping, 0, "", func(e *stream.Event) bool {
+				if e.Grouping() != test.grouping {
+					t.Errorf("Case #%v: Incorrect grouping. Wanted: %v, found: %v", i, test.grouping, e.Grouping())
+				}
+
+				found = append(found, string(e.Data))
+				return true
+			})
+
+			if !reflect.DeepEqual(found, test.events) {
+				t.Errorf("Case #%v: Incorrect stream results. Wanted: %v, found: %v", i, test.events, found)
+			}
+		}
+
+		found := make([]string, 0)
+
+		n.db.Scan("a", "b", 0, "", func(e *stream.Event) bool {
+			found = append(found, string(e.Data))
+			return true
+		})
+
+		if !reflect.DeepEqual(found, []string{"e", "d", "b", "a"}) {
+			t.Errorf("Incorrect stream results. Wanted: %v, found: %v", []string{"e", "d", "b", "a"}, found)
+		}
+	})
+}
@@ -1,6 +1,8 @@
 package cluster
 
 import (
+	"github.com/customerio/esdb/stream"
+
 	"encoding/json"
 	"net/http"
 )
@@ -8,13 +10,33 @@ import (
 func (n *Node) offsetEventsHandler(w http.ResponseWriter, req *http.Request) {
 	req.Body.Close()
 
+	role, ok := n.auth.Authorize(w, req, READ)
+	if !ok {
+		return
+	}
+
 	index := req.FormValue("index")
 	value := req.FormValue("value")
 
-	js, _ := json.MarshalIndent(map[string]interface{}{
+	if grouping := req.FormValue("grouping"); index == "" && grouping != "" {
+		index, value = stream.GROUPING_INDEX, grouping
+	}
+
+	if !role.Allows(index, value) {
+		Deny(w, FORBIDDEN)
+		return
+	}
+
+	res := map[string]interface{}{
 		"meta":         n.Metadata(),
 		"continuation": n.db.Continuation(index, value),
-	}, "", "  ")
+	}
+
+	if index != "" {
+		res["most_recent"] = n.db.recent.Get(index)
+	}
+
+	js, _ := json.MarshalIndent(res, "", "  ")
 
 	w.Write(js)
 	w.Write([]byte("\n"))
@@ -0,0 +1,174 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"errors"
+	"log"
+	"time"
+)
+
+var INVALID_ROTATE_THRESHOLD = errors.New("Rotation threshold must be positive")
+var INVALID_TIMER = errors.New("Timers must not be nil")
+var INVALID_LOGGER = errors.New("Logger must not be nil")
+
+// Option configures a DB, or the DB of a node, as it's created.
+// Options are validated then, so NewDb and NewNode fail rather
+// than the DB misbehaving once it's running.
+type Option func(db *DB) error
+
+// Logger is what the DB and node log to. *log.Logger is a Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+	Println(v ...interface{})
+}
+
+// Logs to the standard logger, so its flags and output are used.
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+func (stdLogger) Println(v ...interface{}) {
+	log.Println(v...)
+}
+
+// Sets the size in bytes at which the open stream is rotated.
+func WithRotateThreshold(size int64) Option {
+	return func(db *DB) error {
+		if size <= 0 {
+			return INVALID_ROTATE_THRESHOLD
+		}
+
+		db.RotateThreshold = size
+		return nil
+	}
+}
+
+// Sets how many commits before each rotation are kept in the raft log
+// when a snapshot is taken, so lagging followers needn't be sent it.
+func WithSnapshotBuffer(count uint64) Option {
+	return func(db *DB) error {
+		db.SnapshotBuffer = count
+		return nil
+	}
+}
+
+// Requires values of the given indexes to be unique across every event.
+func WithUniqueIndexes(names ...string) Option {
+	return func(db *DB) error {
+		for _, name := range names {
+			if reserved(map[string]string{name: ""}) {
+				return RESERVED_INDEX
+			}
+
+			db.UniqueIndexes[name] = true
+		}
+
+		return nil
+	}
+}
+
+// Monitors the disk's usage, removing compressed streams above the soft
+// watermark and rejecting writes above the hard. See DiskMonitor.
+func WithWatermarks(soft, hard float64) Option {
+	return func(db *DB) error {
+		monitor, err := NewDiskMonitor(db.dir, soft, hard)
+		if err != nil {
+			return err
+		}
+
+		db.disk = monitor
+		return nil
+	}
+}
+
+// Times every write to, and rotation of, the open stream. Timers
+// which are StreamTimers are told the open stream's commit.
+func WithMetrics(write, rotate Timer) Option {
+	return func(db *DB) error {
+		if write == nil || rotate == nil {
+			return INVALID_TIMER
+		}
+
+		db.wtimer = write
+		db.rtimer = rotate
+		return nil
+	}
+}
+
+// Limits background IO (snapshots, and recovering streams from peers)
+// to the given number of bytes per second, or 0 for no limit. See Throttle.
+func WithIOLimit(bytesPerSecond int64) Option {
+	return func(db *DB) error {
+		if bytesPerSecond < 0 {
+			return INVALID_IO_LIMIT
+		}
+
+		db.throttle = NewThrottle(bytesPerSecond)
+		db.reader.throttle = db.throttle
+		return nil
+	}
+}
+
+// Keeps the given number of copies of each closed stream, placed over
+// the cluster's nodes and moved as they join or leave, rather than a
+// copy on every node. 0 keeps a copy on every node. See Placement.
+func WithReplicas(copies int) Option {
+	return func(db *DB) error {
+		if copies < 0 {
+			return INVALID_REPLICAS
+		}
+
+		db.copies = copies
+		return nil
+	}
+}
+
+// Times every scan and iteration of each stream, including the time
+// spent in the scanner. Timers which are StreamTimers are told the
+// stream's commit.
+func WithScanTimer(t Timer) Option {
+	return func(db *DB) error {
+		if t == nil {
+			return INVALID_TIMER
+		}
+
+		db.reader.timer = t
+		return nil
+	}
+}
+
+// Limits how many scans and iterations run at once, queueing others
+// for up to the timeout before refusing them. See Admission.
+func WithQueryLimit(limit int, timeout time.Duration) Option {
+	return func(db *DB) error {
+		return db.reader.SetQueryLimit(limit, timeout)
+	}
+}
+
+// Writes the streams the DB creates with the given options, such as
+// their index's block size. See stream.Options.
+func WithStreamOptions(opts stream.Options) Option {
+	return func(db *DB) error {
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+
+		db.streamOptions = opts
+		return nil
+	}
+}
+
+// Logs to the logger rather than the standard logger.
+func WithLogger(logger Logger) Option {
+	return func(db *DB) error {
+		if logger == nil {
+			return INVALID_LOGGER
+		}
+
+		db.logger = logger
+		return nil
+	}
+}
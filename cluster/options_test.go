@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptions(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	logs := new(bytes.Buffer)
+
+	db, err := NewDb("tmp",
+		WithRotateThreshold(100),
+		WithSnapshotBuffer(10),
+		WithUniqueIndexes("email"),
+		WithLogger(log.New(logs, "", 0)),
+	)
+
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+
+	if db.RotateThreshold != 100 || db.SnapshotBuffer != 10 || !db.UniqueIndexes["email"] {
+		t.Errorf("Options not applied: %v %v %v", db.RotateThreshold, db.SnapshotBuffer, db.UniqueIndexes)
+	}
+
+	if !strings.Contains(logs.String(), "STREAM: Creating 1") {
+		t.Errorf("Expected to log to the given logger, found: %q", logs.String())
+	}
+
+	// Streams sync themselves in the background, the DB syncs otherwise.
+	db, _ = NewDb("tmp", WithDurability(stream.SYNC_INTERVAL, time.Second))
+
+	if opts := db.openStreamOptions(); opts.Durability != stream.SYNC_INTERVAL || opts.SyncInterval != time.Second {
+		t.Errorf("Expected streams to sync every interval, found: %+v", opts)
+	}
+
+	db, _ = NewDb("tmp", WithDurability(stream.SYNC_ALWAYS, 0))
+
+	if opts := db.openStreamOptions(); opts.Durability != stream.SYNC_NEVER {
+		t.Errorf("Expected the DB to sync streams once each command's events are written, found: %+v", opts)
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	tests := []struct {
+		opt Option
+		err error
+	}{
+		{WithRotateThreshold(0), INVALID_ROTATE_THRESHOLD},
+		{WithUniqueIndexes(AUDIT_INDEX), RESERVED_INDEX},
+		{WithWatermarks(0.9, 0.8), INVALID_WATERMARKS},
+		{WithMetrics(nil, NilTimer{}), INVALID_TIMER},
+		{WithLogger(nil), INVALID_LOGGER},
+		{WithIOLimit(-1), INVALID_IO_LIMIT},
+		{WithStreamOptions(stream.Options{IndexBlockSize: -1}), stream.INVALID_INDEX_BLOCK_SIZE},
+		{WithDurability(stream.SYNC_INTERVAL, -1), stream.INVALID_SYNC_INTERVAL},
+		{WithCompaction(-1), INVALID_COMPACTION_TARGET},
+		{WithContinuationKey(nil), INVALID_CONTINUATION_KEY},
+	}
+
+	for i, test := range tests {
+		if db, err := NewDb("tmp", test.opt); db != nil || err != test.err {
+			t.Errorf("Case #%v: Wanted: %v, found: %v", i, test.err, err)
+		}
+	}
+
+	if _, err := NewNode("tmp/node", "localhost", 3001, WithRotateThreshold(-1)); err != INVALID_ROTATE_THRESHOLD {
+		t.Errorf("Expected node to be rejected, found: %v", err)
+	}
+}
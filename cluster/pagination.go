@@ -0,0 +1,45 @@
+package cluster
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Adds pagination details to a scan response: the limit applied,
+// whether there are more events to fetch, and (if so) a ready to
+// use URL for the next page with the continuation embedded.
+//
+// Reverse scans are finished once they return an empty continuation.
+// Iterating forwards always returns a continuation, as more events
+// may be written, so has_more reports whether the limit was reached.
+func Paginate(res *ScanResponse, req *http.Request, continuation string, limit, count int, forward bool) {
+	current := *req.URL
+	current.Path = versionedPath(req.Context(), current.Path)
+
+	paginate(res, &current, continuation, limit, count, forward)
+}
+
+func paginate(res *ScanResponse, current *url.URL, continuation string, limit, count int, forward bool) {
+	more := continuation != ""
+	if forward {
+		more = count >= limit
+	}
+
+	res.Limit = limit
+	res.HasMore = more
+
+	if continuation != "" {
+		res.Next = nextPage(current, continuation, limit)
+	}
+}
+
+func nextPage(current *url.URL, continuation string, limit int) string {
+	query := current.Query()
+	query.Set("continuation", continuation)
+	query.Set("limit", strconv.Itoa(limit))
+
+	next := url.URL{Path: current.Path, RawQuery: query.Encode()}
+
+	return next.String()
+}
@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://localhost:4001/events?index=a&value=b&continuation=5:10", nil)
+
+	var tests = []struct {
+		continuation string
+		count        int
+		forward      bool
+		more         bool
+		next         string
+	}{
+		{"3:42", 20, false, true, "/events?continuation=3%3A42&index=a&limit=20&value=b"},
+		{"", 7, false, false, ""},
+		{"9:0", 7, true, false, "/events?continuation=9%3A0&index=a&limit=20&value=b"},
+		{"9:0", 20, true, true, "/events?continuation=9%3A0&index=a&limit=20&value=b"},
+	}
+
+	for i, test := range tests {
+		res := &ScanResponse{}
+
+		Paginate(res, req, test.continuation, 20, test.count, test.forward)
+
+		if res.HasMore != test.more {
+			t.Errorf("Case #%v: Incorrect has_more. Wanted: %v, found: %v", i, test.more, res.HasMore)
+		}
+
+		if res.Next != test.next {
+			t.Errorf("Case #%v: Incorrect next page. Wanted: %v, found: %v", i, test.next, res.Next)
+		}
+
+		if res.Limit != 20 {
+			t.Errorf("Case #%v: Incorrect limit. Wanted: 20, found: %v", i, res.Limit)
+		}
+	}
+}
+
+func TestBatchQueries(t *testing.T) {
+	withNode(func(n *Node) {
+		trackevent(n, []byte("a"), map[string]string{"a": "1"})
+		trackevent(n, []byte("b"), map[string]string{"a": "2"})
+		trackevent(n, []byte("c"), map[string]string{"a": "1"})
+
+		body := `{"limit": 1, "queries": [{"index": "a", "value": "1"}, {"index": "a", "value": "2", "limit": 5}]}`
+
+		req, _ := http.NewRequest("POST", "/events/batch", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		n.batchEventsHandler(w, req)
+
+		var res struct {
+			Results []struct {
+				Events  []string `json:"events"`
+				HasMore bool     `json:"has_more"`
+			} `json:"results"`
+		}
+
+		json.Unmarshal(w.Body.Bytes(), &res)
+
+		if len(res.Results) != 2 {
+			t.Fatalf("Incorrect number of results. Wanted: 2, found: %v", len(res.Results))
+		}
+
+		if !reflect.DeepEqual(res.Results[0].Events, []string{"c"}) || !res.Results[0].HasMore {
+			t.Errorf("Incorrect first result. Wanted: [c] with more, found: %v", res.Results[0])
+		}
+
+		if !reflect.DeepEqual(res.Results[1].Events, []string{"b"}) || res.Results[1].HasMore {
+			t.Errorf("Incorrect second result. Wanted: [b] without more, found: %v", res.Results[1])
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package cluster
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Consecutive failures before a peer is quarantined.
+	QUARANTINE_FAILURES = 3
+	// How long a quarantined peer is avoided before it's probed again.
+	QUARANTINE_DURATION = 30 * time.Second
+	// How long a probe is waited for before another may be made, as the
+	// peer it was handed out for may not have been asked after all.
+	PROBE_TIMEOUT = 10 * time.Second
+)
+
+// Current view of a single peer's health.
+type PeerStatus struct {
+	Requests    int64         `json:"requests"`
+	Errors      int64         `json:"errors"`
+	Failures    int           `json:"consecutive_failures"`
+	Latency     time.Duration `json:"latency"`
+	Quarantined bool          `json:"quarantined"`
+}
+
+// PeerHealth tracks error rates and latencies of requests made to peers,
+// so requests can prefer healthy, fast peers and stay away from peers
+// which keep failing. Quarantined peers are given a single probe request
+// once their quarantine expires; if it fails, they're quarantined again.
+// A probe which isn't recorded within PROBE_TIMEOUT is given up on.
+type PeerHealth struct {
+	peers map[string]*peerStats
+	now   func() time.Time
+	mutex sync.Mutex
+}
+
+type peerStats struct {
+	requests    int64
+	errors      int64
+	failures    int
+	latency     time.Duration
+	quarantined time.Time
+	// When the peer was last handed out for a probe, until it's recorded.
+	probed time.Time
+}
+
+func NewPeerHealth() *PeerHealth {
+	return &PeerHealth{
+		peers: make(map[string]*peerStats),
+		now:   time.Now,
+	}
+}
+
+// Records the outcome of a request made to the peer.
+func (h *PeerHealth) Record(peer string, latency time.Duration, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	stats := h.stats(peer)
+	stats.requests += 1
+	stats.probed = time.Time{}
+
+	if err != nil {
+		stats.errors += 1
+		stats.failures += 1
+
+		if stats.failures >= QUARANTINE_FAILURES {
+			stats.quarantined = h.now().Add(QUARANTINE_DURATION)
+		}
+
+		return
+	}
+
+	stats.failures = 0
+	stats.quarantined = time.Time{}
+
+	// Exponentially weighted, so a peer recovering from a
+	// slow period isn't punished for it forever.
+	if stats.latency == 0 {
+		stats.latency = latency
+	} else {
+		stats.latency = (stats.latency*7 + latency) / 8
+	}
+}
+
+// Orders peers from healthiest to least healthy. Peers without
+// recent failures come first, fastest first, then peers which have
+// been failing. Quarantined peers are left out entirely, unless
+// they're due a probe or there's no one else left to ask.
+func (h *PeerHealth) Order(peers []string) []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.now()
+
+	available := make([]string, 0, len(peers))
+	quarantined := make([]string, 0)
+
+	for _, peer := range peers {
+		stats := h.stats(peer)
+
+		if now.Before(stats.quarantined) {
+			quarantined = append(quarantined, peer)
+		} else if !stats.quarantined.IsZero() && now.Before(stats.probed.Add(PROBE_TIMEOUT)) {
+			// Someone else is already probing this peer.
+			quarantined = append(quarantined, peer)
+		} else {
+			if !stats.quarantined.IsZero() {
+				stats.probed = now
+			}
+
+			available = append(available, peer)
+		}
+	}
+
+	sort.SliceStable(available, func(i, j int) bool {
+		a, b := h.peers[available[i]], h.peers[available[j]]
+
+		if a.failures != b.failures {
+			return a.failures < b.failures
+		}
+
+		return a.latency < b.latency
+	})
+
+	if len(available) == 0 {
+		return quarantined
+	}
+
+	return available
+}
+
+// Returns the current status of every peer we've talked to.
+func (h *PeerHealth) Status() map[string]PeerStatus {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.now()
+	status := make(map[string]PeerStatus, len(h.peers))
+
+	for peer, stats := range h.peers {
+		status[peer] = PeerStatus{
+			Requests:    stats.requests,
+			Errors:      stats.errors,
+			Failures:    stats.failures,
+			Latency:     stats.latency,
+			Quarantined: now.Before(stats.quarantined),
+		}
+	}
+
+	return status
+}
+
+func (h *PeerHealth) stats(peer string) *peerStats {
+	if h.peers[peer] == nil {
+		h.peers[peer] = &peerStats{}
+	}
+
+	return h.peers[peer]
+}
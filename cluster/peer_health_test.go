@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeerHealthOrdering(t *testing.T) {
+	h := NewPeerHealth()
+
+	h.Record("a", 30*time.Millisecond, nil)
+	h.Record("b", 10*time.Millisecond, nil)
+	h.Record("c", 5*time.Millisecond, errors.New("timeout"))
+
+	order := h.Order([]string{"a", "b", "c", "d"})
+
+	if !reflect.DeepEqual(order, []string{"d", "b", "a", "c"}) {
+		t.Errorf("Incorrect peer order. Wanted: %v, found: %v", []string{"d", "b", "a", "c"}, order)
+	}
+}
+
+func TestPeerHealthQuarantine(t *testing.T) {
+	now := time.Now()
+
+	h := NewPeerHealth()
+	h.now = func() time.Time { return now }
+
+	for i := 0; i < QUARANTINE_FAILURES; i++ {
+		h.Record("a", time.Millisecond, errors.New("connection refused"))
+	}
+
+	if !h.Status()["a"].Quarantined {
+		t.Errorf("Peer should be quarantined after %v failures", QUARANTINE_FAILURES)
+	}
+
+	if order := h.Order([]string{"a", "b"}); !reflect.DeepEqual(order, []string{"b"}) {
+		t.Errorf("Quarantined peer should be skipped. Found: %v", order)
+	}
+
+	if order := h.Order([]string{"a"}); !reflect.DeepEqual(order, []string{"a"}) {
+		t.Errorf("Quarantined peer should be used as a last resort. Found: %v", order)
+	}
+
+	now = now.Add(QUARANTINE_DURATION + time.Second)
+
+	if order := h.Order([]string{"a", "b"}); !reflect.DeepEqual(order, []string{"b", "a"}) {
+		t.Errorf("Expired quarantine should allow a probe. Found: %v", order)
+	}
+
+	if order := h.Order([]string{"a", "b"}); !reflect.DeepEqual(order, []string{"b"}) {
+		t.Errorf("Only a single probe should be in flight. Found: %v", order)
+	}
+
+	// The probe was never made, so another's allowed once it times out.
+	now = now.Add(PROBE_TIMEOUT)
+
+	if order := h.Order([]string{"a", "b"}); !reflect.DeepEqual(order, []string{"b", "a"}) {
+		t.Errorf("Timed out probe should allow another. Found: %v", order)
+	}
+
+	// A failed probe quarantines the peer again, and ends the probe.
+	h.Record("a", time.Millisecond, errors.New("connection refused"))
+
+	if order := h.Order([]string{"a", "b"}); !reflect.DeepEqual(order, []string{"b"}) {
+		t.Errorf("Failed probe should quarantine the peer again. Found: %v", order)
+	}
+
+	now = now.Add(QUARANTINE_DURATION + time.Second)
+
+	if order := h.Order([]string{"a", "b"}); !reflect.DeepEqual(order, []string{"b", "a"}) {
+		t.Errorf("Expired quarantine should allow a probe after a failed one. Found: %v", order)
+	}
+
+	h.Record("a", time.Millisecond, nil)
+
+	if h.Status()["a"].Quarantined || h.Status()["a"].Failures != 0 {
+		t.Errorf("Successful probe should end quarantine: %+v", h.Status()["a"])
+	}
+}
@@ -0,0 +1,29 @@
+package cluster
+
+import (
+	"github.com/jrallison/raft"
+)
+
+// PlaceCommand records which nodes keep a copy of each closed
+// stream, so each node fetches or removes its copies to match.
+type PlaceCommand struct {
+	Placement Placement `json:"placement"`
+	Timestamp int64     `json:"timestamp,omitempty"`
+}
+
+func NewPlaceCommand(p Placement, timestamp int64) *PlaceCommand {
+	return &PlaceCommand{p, timestamp}
+}
+
+func (c *PlaceCommand) CommandName() string {
+	return "place"
+}
+
+func (c *PlaceCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	db.place(c.Placement)
+
+	return new(interface{}), nil
+}
@@ -0,0 +1,315 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var INVALID_REPLICAS = errors.New("Replicas must not be negative")
+var UNBALANCED_STREAMS = errors.New("Closed streams couldn't be moved to where they're placed")
+
+// How long a stream fetched to be read by a node it isn't placed on is
+// kept, for the scan or merge which fetched it, before it's removed.
+const FETCHED_STREAM_GRACE = time.Minute
+
+// Placement records which nodes keep a copy of each closed stream,
+// when the cluster keeps fewer copies than it has nodes. Streams
+// without an entry are kept by every node. It's replicated through
+// raft, so every node agrees on where each stream is kept.
+type Placement map[uint64][]string
+
+// Whether the node keeps a copy of the stream.
+func (p Placement) keeps(commit uint64, node string) bool {
+	holders, ok := p[commit]
+	if !ok {
+		return true
+	}
+
+	for _, holder := range holders {
+		if holder == node {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether this node keeps a copy of the stream.
+func (db *DB) keeps(commit uint64) bool {
+	return db.raft == nil || db.placement.keeps(commit, db.raft.Name())
+}
+
+// Chooses the nodes keeping each closed stream by ranking every node
+// on a hash of its name and the stream's commit, and taking the first
+// (rendezvous hashing). Streams are spread evenly over the nodes, and
+// as a node joins or leaves only the copies it gains or held move.
+// With as many copies as nodes, every node keeps every stream.
+func placeStreams(closed []uint64, nodes []string, copies int) Placement {
+	p := make(Placement)
+
+	if copies <= 0 || copies >= len(nodes) {
+		return p
+	}
+
+	for _, commit := range closed {
+		ranked := append([]string{}, nodes...)
+
+		sort.Slice(ranked, func(i, j int) bool {
+			return rank(ranked[i], commit) > rank(ranked[j], commit)
+		})
+
+		holders := ranked[:copies]
+		sort.Strings(holders)
+
+		p[commit] = holders
+	}
+
+	return p
+}
+
+func rank(node string, commit uint64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(node))
+	h.Write([]byte(strconv.FormatUint(commit, 10)))
+	return h.Sum64()
+}
+
+// Has the leader place the closed streams on the current members, if
+// the cluster keeps fewer copies of them than it has nodes. Called as
+// members join or leave, and streams are closed.
+func (db *DB) replan() {
+	if db.copies == 0 || db.raft == nil {
+		return
+	}
+
+	db.supervisor.Go("placement", func() error {
+		if db.raft.State() != "leader" {
+			return nil
+		}
+
+		nodes := []string{db.raft.Name()}
+
+		for name := range db.raft.Peers() {
+			nodes = append(nodes, name)
+		}
+
+		p := placeStreams(db.closed, nodes, db.copies)
+
+		if reflect.DeepEqual(p, db.placement) {
+			return nil
+		}
+
+		_, err := db.raft.Do(NewPlaceCommand(p, time.Now().UnixNano()))
+		return err
+	})
+}
+
+// Records where streams are placed, and moves this node's copies to
+// match in the background.
+func (db *DB) place(p Placement) {
+	db.placement = p
+
+	if db.raft == nil {
+		return
+	}
+
+	db.supervisor.Go("rebalance", db.rebalance)
+}
+
+// Has a rebalance remove the stream once the grace period's passed, if
+// it was fetched by a node it isn't placed on, rather than keeping it
+// until placement next changes. Streams fetched meanwhile are removed
+// by the same rebalance.
+func (db *DB) fetched(commit uint64) {
+	if db.raft == nil || db.keeps(commit) {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&db.rebalancing, 0, 1) {
+		return
+	}
+
+	time.AfterFunc(FETCHED_STREAM_GRACE, func() {
+		atomic.StoreInt32(&db.rebalancing, 0)
+		db.supervisor.Run("rebalance", db.rebalance)
+	})
+}
+
+// Fetches the streams placed on this node which it's missing, then
+// removes its copies of streams placed elsewhere, once the nodes they're
+// placed on have them. Transfers are limited by the IO throttle, as
+// streams are fetched one at a time. Copies fetched to serve scans or
+// merges are removed again by the next rebalance. See fetched.
+func (db *DB) rebalance() error {
+	self := db.raft.Name()
+	placement := db.placement
+	failed := make([]uint64, 0)
+
+	db.refreshReader()
+
+	for _, commit := range db.closed {
+		var err error
+
+		_, missing := os.Stat(db.reader.Path(commit))
+		local, keep := missing == nil, placement.keeps(commit, self)
+
+		if keep && !local {
+			_, err = db.reader.retrieveStream(commit, true)
+		} else if local && !keep {
+			err = db.release(commit, placement[commit])
+		}
+
+		if err != nil {
+			db.logger.Println("REBALANCE: Unable to move stream", commit, err)
+			failed = append(failed, commit)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%v: %v", UNBALANCED_STREAMS, failed)
+	}
+
+	return nil
+}
+
+// Removes the local copy of the stream once each of the nodes holding
+// it has a copy with the same digest, so no copy is lost in between.
+func (db *DB) release(commit uint64, holders []string) error {
+	path := db.reader.Path(commit)
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	digest, err := digests.get(path, stat)
+	if err != nil {
+		return err
+	}
+
+	peers := db.raft.Peers()
+	client := db.reader.retry.httpClient()
+
+	for _, name := range holders {
+		peer, ok := peers[name]
+		if !ok {
+			return fmt.Errorf("%v is placed on %v, which isn't a member", commit, name)
+		}
+
+		if err := holds(client, db.reader.apiKey, peer.ConnectionString, commit, digest); err != nil {
+			return err
+		}
+	}
+
+	db.logger.Println("REBALANCE: Removing stream", commit, "placed on", holders)
+
+	return db.reader.replaceStream(commit, func() error {
+		return os.Remove(path)
+	})
+}
+
+// Checks the peer's inventory for a local copy of the stream.
+func holds(client *http.Client, key, peer string, commit uint64, digest string) error {
+	streams, err := inventoryOf(client, key, peer)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range streams {
+		if info.Commit == commit && info.Location == LOCATION_LOCAL && info.Digest == digest {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%v doesn't yet have a copy of %v", peer, commit)
+}
+
+// Fetches the peer's inventory of streams.
+func inventoryOf(client *http.Client, key, peer string) ([]StreamInfo, error) {
+	resp, err := send(client, key, "GET", peer+"/streams", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var res struct {
+		Streams []StreamInfo `json:"streams"`
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected response from %v: %v", peer, resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+
+	return res.Streams, err
+}
+
+func writePlacement(buf *bytes.Buffer, p Placement) {
+	commits := make([]uint64, 0, len(p))
+	for commit := range p {
+		commits = append(commits, commit)
+	}
+
+	sort.Sort(OffsetSlice(commits))
+
+	binary.WriteUvarint(buf, len(commits))
+
+	for _, commit := range commits {
+		binary.WriteInt64(buf, int64(commit))
+		binary.WriteUvarint(buf, len(p[commit]))
+
+		for _, holder := range p[commit] {
+			binary.WriteUvarint(buf, len(holder))
+			buf.WriteString(holder)
+		}
+	}
+}
+
+func readPlacement(buf *bytes.Buffer) (Placement, error) {
+	p := make(Placement)
+
+	// Snapshots taken before streams were placed have none.
+	if buf.Len() == 0 {
+		return p, nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var commit, holders int64
+
+		if commit, err = binary.ReadInt64Full(buf); err != nil {
+			break
+		}
+
+		if holders, err = binary.ReadUvarintMax(buf, int64(buf.Len())); err != nil {
+			break
+		}
+
+		names := make([]string, holders)
+
+		for j := range names {
+			if names[j], err = binary.ReadStringMax(buf, int64(buf.Len())); err != nil {
+				break
+			}
+		}
+
+		p[uint64(commit)] = names
+	}
+
+	return p, err
+}
@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPlaceStreams(t *testing.T) {
+	closed := make([]uint64, 100)
+	for i := range closed {
+		closed[i] = uint64(i+1) * 10
+	}
+
+	nodes := []string{"a", "b", "c", "d", "e"}
+
+	p := placeStreams(closed, nodes, 2)
+	copies := make(map[string]int)
+
+	for _, commit := range closed {
+		holders := p[commit]
+
+		if len(holders) != 2 || holders[0] == holders[1] {
+			t.Fatalf("Expected 2 holders of %v, found: %v", commit, holders)
+		}
+
+		for _, holder := range holders {
+			copies[holder] += 1
+		}
+	}
+
+	for _, node := range nodes {
+		if copies[node] < 20 || copies[node] > 60 {
+			t.Errorf("Expected copies to be spread evenly, found: %v", copies)
+		}
+	}
+
+	// Only copies placed on the new node move.
+	joined := placeStreams(closed, append(nodes, "f"), 2)
+
+	for _, commit := range closed {
+		for _, holder := range p[commit] {
+			if !joined.keeps(commit, holder) && !joined.keeps(commit, "f") {
+				t.Errorf("Copy of %v on %v moved elsewhere: %v", commit, holder, joined[commit])
+			}
+		}
+	}
+
+	if p := placeStreams(closed, nodes, 5); len(p) != 0 || !p.keeps(10, "a") {
+		t.Errorf("Expected every node to keep every stream, found: %v", p)
+	}
+}
+
+func TestPlacementSnapshot(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	db, _ := NewDb("tmp")
+	db.placement = Placement{10: {"a", "b"}, 20: {"c"}}
+
+	state, _ := db.Save()
+
+	recovered, _ := NewDb("tmp")
+
+	if err := recovered.Recovery(state); err != nil || !reflect.DeepEqual(recovered.placement, db.placement) {
+		t.Errorf("Incorrect placement recovered: %v %v", recovered.placement, err)
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(30)
+
+		for _, body := range []string{"a", "b", "c"} {
+			trackevent(n, []byte(body), map[string]string{"a": "b"})
+		}
+
+		commit := n.db.closed[len(n.db.closed)-1]
+
+		var inventory []StreamInfo
+
+		peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			js, _ := json.Marshal(map[string]interface{}{"streams": inventory})
+			w.Write(js)
+		}))
+
+		defer peer.Close()
+
+		n.raft.AddPeer("peer", peer.URL)
+		n.db.placement = Placement{commit: {"peer"}}
+
+		// The peer hasn't a copy yet, so this node keeps its own.
+		if err := n.db.rebalance(); err == nil {
+			t.Errorf("Expected rebalancing to fail")
+		}
+
+		if _, err := os.Stat(n.db.reader.Path(commit)); err != nil {
+			t.Errorf("Expected stream to be kept, found: %v", err)
+		}
+
+		inventory, _ = n.db.Inventory()
+
+		if err := n.db.rebalance(); err != nil {
+			t.Errorf("Expected rebalancing to succeed, found: %v", err)
+		}
+
+		if _, err := os.Stat(n.db.reader.Path(commit)); !os.IsNotExist(err) {
+			t.Errorf("Expected stream to be removed, found: %v", err)
+		}
+
+		// Fetched again to be read, so it's removed by a later rebalance.
+		n.db.fetched(n.db.current)
+
+		if atomic.LoadInt32(&n.db.rebalancing) != 0 {
+			t.Errorf("Expected no rebalance for a stream placed on this node")
+		}
+
+		n.db.fetched(commit)
+
+		if atomic.LoadInt32(&n.db.rebalancing) != 1 {
+			t.Errorf("Expected a rebalance to be scheduled for a stream placed elsewhere")
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package cluster
+
+import (
+	"github.com/jrallison/raft"
+)
+
+// PromoteCommand starts a new cluster from the closed streams shipped
+// to a standby, as the first command in its log. See promoteReplica.
+type PromoteCommand struct {
+	Metadata  Metadata `json:"metadata"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+func NewPromoteCommand(meta Metadata, timestamp int64) *PromoteCommand {
+	return &PromoteCommand{meta, timestamp}
+}
+
+func (c *PromoteCommand) CommandName() string {
+	return "promote"
+}
+
+func (c *PromoteCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	return new(interface{}), db.promote(context.CurrentIndex(), context.CurrentTerm(), c.Metadata)
+}
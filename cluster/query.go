@@ -0,0 +1,416 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_LIMIT = 20
+	MAX_WAIT      = time.Minute
+	// Most bytes of event data returned in a page of results.
+	MAX_PAGE_BYTES = 8 << 20
+)
+
+// Query describes a single scan of the events. With an index, events
+// with the index value are scanned from newest to oldest, optionally
+// limited to a grouping. With only a grouping, the grouping's events
+// are scanned. Otherwise, all events are iterated from oldest to newest,
+// or newest to oldest with Reverse.
+//
+// Indexes limits a scan to events which also have each of its values,
+// the same as the index and grouping given. Otherwise, with Prefix, the
+// index's events with any value beginning with Value are scanned.
+// Headers limits any query to events with each of its headers, and
+// Since and Until to the streams written between them. See Window.
+type Query struct {
+	Index        string            `json:"index"`
+	Value        string            `json:"value"`
+	Indexes      map[string]string `json:"indexes,omitempty"`
+	Prefix       bool              `json:"prefix,omitempty"`
+	Grouping     string            `json:"grouping"`
+	After        int64             `json:"after"`
+	Continuation string            `json:"continuation"`
+	Limit        int               `json:"limit"`
+	MaxBytes     int               `json:"max_bytes"`
+	Reverse      bool              `json:"reverse"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Since        int64             `json:"since,omitempty"`
+	Until        int64             `json:"until,omitempty"`
+}
+
+// The index value the query reads, for authorization, and the
+// continuation of its newest event. See Reader.RunQuery.
+func (q Query) Scope() (string, string) {
+	if q.Index == "" && q.Grouping != "" {
+		return stream.GROUPING_INDEX, q.Grouping
+	}
+
+	return q.Index, q.Value
+}
+
+// Whether the role may run the query. Events found by a scan of several
+// index values have every one of them, so it's enough for the role to
+// have access to any, unless another is reserved for the audit log.
+func (q Query) AllowedBy(role *Role) bool {
+	if len(q.Indexes) == 0 {
+		return role.Allows(q.Scope())
+	}
+
+	allowed := false
+
+	for name, value := range q.terms() {
+		if role.Allows(name, value) {
+			allowed = true
+		} else if strings.HasPrefix(name, AUDIT_INDEX) {
+			return false
+		}
+	}
+
+	return allowed
+}
+
+// Every index value a scan of several requires, including the query's
+// index and grouping.
+func (q Query) terms() map[string]string {
+	terms := make(map[string]string, len(q.Indexes)+2)
+
+	for name, value := range q.Indexes {
+		terms[name] = value
+	}
+
+	if q.Index != "" {
+		terms[q.Index] = q.Value
+	}
+
+	if q.Grouping != "" {
+		terms[stream.GROUPING_INDEX] = q.Grouping
+	}
+
+	return terms
+}
+
+// The names of the query's further indexes, in order.
+func (q Query) indexNames() []string {
+	names := make([]string, 0, len(q.Indexes))
+	for name := range q.Indexes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// The names of the query's headers, in order.
+func (q Query) headerNames() []string {
+	names := make([]string, 0, len(q.Headers))
+	for name := range q.Headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Identifies the query for ETags. See ScanQuery.
+func (q Query) etag() string {
+	query := ScanQuery(q.Index, q.Value, q.Grouping, q.After, q.limit(), q.MaxBytes)
+
+	for _, name := range q.indexNames() {
+		query += "|" + name + ":" + q.Indexes[name]
+	}
+
+	if q.Prefix {
+		query += "|prefix"
+	}
+
+	if q.Reverse {
+		query += "|reverse"
+	}
+
+	for _, name := range q.headerNames() {
+		query += "|header:" + name + ":" + q.Headers[name]
+	}
+
+	if q.Since > 0 || q.Until > 0 {
+		query += "|window:" + strconv.FormatInt(q.Since, 10) + ":" + strconv.FormatInt(q.Until, 10)
+	}
+
+	return query
+}
+
+func (q Query) forward() bool {
+	return (q.Index == "" || q.chronological()) && q.Grouping == "" && len(q.Indexes) == 0 && !q.Reverse
+}
+
+func (q Query) limit() int {
+	if q.Limit == 0 {
+		return DEFAULT_LIMIT
+	}
+
+	return q.Limit
+}
+
+func (q Query) maxBytes() int {
+	return PageBytes(q.MaxBytes)
+}
+
+// The most bytes of event data to return in a page, given the
+// number asked for. Pages are never larger than MAX_PAGE_BYTES.
+func PageBytes(max int) int {
+	if max <= 0 || max > MAX_PAGE_BYTES {
+		return MAX_PAGE_BYTES
+	}
+
+	return max
+}
+
+// Runs the query, returning the events found and the
+// continuation to fetch the next page of results.
+func (q Query) run(db *DB) ([]string, string, error) {
+	return q.runContext(context.Background(), db)
+}
+
+// Runs the query, stopping early with the events found so far
+// once the context is done. Pages stop once they hold either the
+// query's limit of events or its bytes of event data, whichever
+// comes first, so the event which reaches the byte limit is the
+// last returned. A page always holds at least one event if any
+// are found, however large.
+func (q Query) runContext(ctx context.Context, db *DB) ([]string, string, error) {
+	events, _, continuation, _, err := q.page(ctx, db)
+	return events, continuation, err
+}
+
+// What queries scan, either a node's DB or a Reader of its streams.
+type source interface {
+	ScanContext(ctx context.Context, name, value string, after uint64, continuation string, scanner stream.Scanner) (string, error)
+	ScanIndexesContext(ctx context.Context, indexes map[string]string, after uint64, continuation string, scanner stream.Scanner) (string, error)
+	ScanPrefixContext(ctx context.Context, name, prefix string, after uint64, continuation string, scanner stream.Scanner) (string, error)
+	ScanChronologicalContext(ctx context.Context, after uint64, continuation string, reverse bool, scanner stream.Scanner) (string, error)
+	IterateContext(ctx context.Context, after uint64, continuation string, scanner stream.Scanner) (string, error)
+	IterateReverseContext(ctx context.Context, after uint64, continuation string, scanner stream.Scanner) (string, error)
+}
+
+// Runs the query, as runContext, also returning the headers of each
+// event found, or nil if none of them have any, and whether any of the
+// events expire, so the page changes once they do.
+func (q Query) page(ctx context.Context, db source) ([]string, []map[string]string, string, bool, error) {
+	var count, size int
+	var withHeaders, expiring bool
+
+	ctx = WithWindow(ctx, q.Since, q.Until)
+
+	limit, max := q.limit(), q.maxBytes()
+	events := make([]string, 0, limit)
+	headers := make([]map[string]string, 0, limit)
+
+	found := func(e *stream.Event) bool {
+		if !matchesHeaders(e, q.Headers) {
+			return true
+		}
+
+		count += 1
+		size += len(e.Data)
+		events = append(events, string(e.Data))
+		headers = append(headers, e.Headers)
+		withHeaders = withHeaders || len(e.Headers) > 0
+		expiring = expiring || Expires(e)
+		return count < limit && size < max
+	}
+
+	var continuation string
+	var err error
+
+	if q.chronological() {
+		continuation, err = db.ScanChronologicalContext(ctx, uint64(q.After), q.Continuation, q.Reverse, found)
+	} else if len(q.Indexes) > 0 {
+		continuation, err = db.ScanIndexesContext(ctx, q.terms(), uint64(q.After), q.Continuation, found)
+	} else if q.Prefix && q.Index != "" {
+		continuation, err = db.ScanPrefixContext(ctx, q.Index, q.Value, uint64(q.After), q.Continuation, func(e *stream.Event) bool {
+			if q.Grouping != "" && e.Grouping() != q.Grouping {
+				return true
+			}
+
+			return found(e)
+		})
+	} else if q.Index == "" && q.Grouping != "" {
+		continuation, err = db.ScanContext(ctx, stream.GROUPING_INDEX, q.Grouping, uint64(q.After), q.Continuation, found)
+	} else if q.Index != "" {
+		continuation, err = db.ScanContext(ctx, q.Index, q.Value, uint64(q.After), q.Continuation, func(e *stream.Event) bool {
+			if q.Grouping != "" && e.Grouping() != q.Grouping {
+				return true
+			}
+
+			return found(e)
+		})
+	} else if q.Reverse {
+		continuation, err = db.IterateReverseContext(ctx, uint64(q.After), q.Continuation, found)
+	} else {
+		continuation, err = db.IterateContext(ctx, uint64(q.After), q.Continuation, found)
+	}
+
+	if !withHeaders {
+		headers = nil
+	}
+
+	return events, headers, continuation, expiring, err
+}
+
+// Runs the query, and if nothing is found, waits up to the given
+// duration for new events to be written which it does find. Both
+// stop early once the context is done.
+func (q Query) poll(ctx context.Context, db *DB, wait time.Duration) ([]string, []map[string]string, string, bool, error) {
+	if wait > MAX_WAIT {
+		wait = MAX_WAIT
+	}
+
+	timeout := time.After(wait)
+
+	for {
+		// Fetched before running, so no writes are missed in between.
+		changed := db.watch.Changed()
+
+		events, headers, continuation, expiring, err := q.page(ctx, db)
+
+		if len(events) > 0 || err != nil || wait <= 0 {
+			return events, headers, continuation, expiring, err
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			return events, headers, continuation, expiring, err
+		case <-ctx.Done():
+			return events, headers, continuation, expiring, err
+		}
+	}
+}
+
+// Runs the query against the reader's streams for an /events request,
+// as a node runs it against its own, though without waiting for events
+// to be written. A scan of a single index value resumes from latest,
+// the node's continuation of the value's newest event, unless the query
+// gives its own. Returns nil if the request's ETag matches the page.
+func (r *Reader) RunQuery(w http.ResponseWriter, req *http.Request, q Query, latest string) (*ScanResponse, error) {
+	if index, _ := q.Scope(); q.Continuation == "" && index != "" && len(q.Indexes) == 0 && !q.Prefix && !q.chronological() {
+		q.Continuation = latest
+	}
+
+	if !q.forward() {
+		if etag, ok := r.ETag(q.etag(), q.Continuation); ok && NotModified(w, req, etag) {
+			return nil, nil
+		}
+	}
+
+	ctx, cancel := QueryContext(req)
+	defer cancel()
+
+	events, headers, continuation, expiring, err := q.page(ctx, r)
+
+	if expiring {
+		Uncacheable(w)
+	}
+
+	res := &ScanResponse{
+		Events:       events,
+		Continuation: continuation,
+		Headers:      headers,
+	}
+
+	Paginate(res, req, continuation, q.limit(), len(events), q.forward())
+	Truncated(res, events, continuation, q.MaxBytes)
+	Partial(res, ctx)
+
+	return res, err
+}
+
+// The request's context, cut off after the duration given by its
+// timeout parameter, if any, so long scans return what they've found.
+func QueryContext(req *http.Request) (context.Context, context.CancelFunc) {
+	timeout, _ := time.ParseDuration(req.FormValue("timeout"))
+
+	if timeout > 0 {
+		return context.WithTimeout(req.Context(), timeout)
+	}
+
+	return context.WithCancel(req.Context())
+}
+
+// Marks a scan response as partial if its query timed out before
+// finding all the events it could have. Its continuation resumes it.
+func Partial(res *ScanResponse, ctx context.Context) {
+	if ctx.Err() == context.DeadlineExceeded {
+		res.Partial = true
+		res.HasMore = true
+	}
+}
+
+// Marks a scan response as truncated if its page was cut short by
+// reaching the byte limit. Its continuation fetches the rest.
+func Truncated(res *ScanResponse, events []string, continuation string, max int) {
+	var size int
+
+	for _, e := range events {
+		size += len(e)
+	}
+
+	if size >= PageBytes(max) && continuation != "" {
+		res.Truncated = true
+		res.HasMore = true
+	}
+}
+
+// The /events URL which runs the query.
+func (q Query) url() *url.URL {
+	values := url.Values{}
+
+	for name, value := range map[string]string{"index": q.Index, "value": q.Value, "grouping": q.Grouping, "continuation": q.Continuation} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+
+	// Each further index is given as another index and value.
+	for _, name := range q.indexNames() {
+		values.Add("index", name)
+		values.Add("value", q.Indexes[name])
+	}
+
+	if q.After > 0 {
+		values.Set("after", strconv.FormatInt(q.After, 10))
+	}
+
+	if q.MaxBytes > 0 {
+		values.Set("max_bytes", strconv.Itoa(q.MaxBytes))
+	}
+
+	if q.Reverse {
+		values.Set("reverse", "true")
+	}
+
+	if q.Prefix {
+		values.Set("prefix", "true")
+	}
+
+	for _, name := range q.headerNames() {
+		values.Add("header", name+":"+q.Headers[name])
+	}
+
+	for name, timestamp := range map[string]int64{"since": q.Since, "until": q.Until} {
+		if timestamp > 0 {
+			values.Set(name, time.Unix(0, timestamp).UTC().Format(time.RFC3339Nano))
+		}
+	}
+
+	return &url.URL{Path: "/events", RawQuery: values.Encode()}
+}
@@ -0,0 +1,326 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestQueryCutOff(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(30)
+
+		for _, body := range []string{"a", "b", "c", "d", "e"} {
+			trackevent(n, []byte(body), map[string]string{"a": "b"})
+		}
+
+		for i, forward := range []bool{false, true} {
+			found := make([]string, 0)
+			continuation := ""
+
+			// Each scan is cut off after finding its first event.
+			for j := 0; j < 10; j++ {
+				ctx, cancel := context.WithCancel(context.Background())
+
+				scanner := func(e *stream.Event) bool {
+					found = append(found, string(e.Data))
+					cancel()
+					return true
+				}
+
+				if forward {
+					continuation, _ = n.db.IterateContext(ctx, 0, continuation, scanner)
+				} else {
+					continuation, _ = n.db.ScanContext(ctx, "a", "b", 0, continuation, scanner)
+				}
+
+				if continuation == "" {
+					break
+				}
+			}
+
+			wanted := []string{"e", "d", "c", "b", "a"}
+			if forward {
+				wanted = []string{"a", "b", "c", "d", "e"}
+			}
+
+			if !reflect.DeepEqual(found, wanted) {
+				t.Errorf("Case #%v: Incorrect results. Wanted: %v, found: %v", i, wanted, found)
+			}
+		}
+	})
+}
+
+func TestQueryTimeout(t *testing.T) {
+	withNode(func(n *Node) {
+		trackevent(n, []byte("a"), map[string]string{"a": "b"})
+
+		for i, test := range []struct {
+			url     string
+			partial bool
+		}{
+			{"/events?index=a&value=b", false},
+			{"/events?index=a&value=b&timeout=1ns", true},
+		} {
+			req := httptest.NewRequest("GET", test.url, nil)
+			w := httptest.NewRecorder()
+
+			n.eventHandler(w, req)
+
+			var res map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &res)
+
+			if partial, _ := res["partial"].(bool); w.Code != 200 || partial != test.partial {
+				t.Errorf("Case #%v: Wanted partial: %v, found: %v %v", i, test.partial, w.Code, res)
+			}
+		}
+	})
+}
+
+func TestQueryMaxBytes(t *testing.T) {
+	withNode(func(n *Node) {
+		for _, body := range []string{"aaaa", "bbbb", "cccc", "dddd"} {
+			trackevent(n, []byte(body), map[string]string{"a": "b"})
+		}
+
+		for i, test := range []struct {
+			url       string
+			events    []string
+			truncated bool
+		}{
+			{"/events?index=a&value=b", []string{"dddd", "cccc", "bbbb", "aaaa"}, false},
+			{"/events?index=a&value=b&max_bytes=6", []string{"dddd", "cccc"}, true},
+			{"/events?index=a&value=b&max_bytes=1", []string{"dddd"}, true},
+			{"/events?max_bytes=8", []string{"aaaa", "bbbb"}, true},
+		} {
+			req := httptest.NewRequest("GET", test.url, nil)
+			w := httptest.NewRecorder()
+
+			n.eventHandler(w, req)
+
+			var res struct {
+				Events       []string `json:"events"`
+				Continuation string   `json:"continuation"`
+				Truncated    bool     `json:"truncated"`
+				HasMore      bool     `json:"has_more"`
+			}
+
+			json.Unmarshal(w.Body.Bytes(), &res)
+
+			if !reflect.DeepEqual(res.Events, test.events) || res.Truncated != test.truncated {
+				t.Errorf("Case #%v: Wanted: %v %v, found: %v %v", i, test.events, test.truncated, res.Events, res.Truncated)
+			}
+
+			if test.truncated && (!res.HasMore || res.Continuation == "") {
+				t.Errorf("Case #%v: Expected a continuation for the rest, found: %v %v", i, res.HasMore, res.Continuation)
+			}
+		}
+	})
+}
+
+func TestQueryIndexes(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(60)
+
+		for i, body := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+			indexes := map[string]string{"customer": "1", "type": "view"}
+
+			if i%2 == 0 {
+				indexes["type"] = "purchase"
+			}
+
+			if body == "c" {
+				indexes["customer"] = "2"
+			}
+
+			trackevent(n, []byte(body), indexes)
+		}
+
+		found := make([]string, 0)
+		q := Query{Index: "customer", Value: "1", Indexes: map[string]string{"type": "purchase"}, Limit: 1}
+
+		for i := 0; i < 10; i++ {
+			events, continuation, err := q.run(n.db)
+			if err != nil {
+				t.Fatalf("Unable to scan: %v", err)
+			}
+
+			found = append(found, events...)
+
+			if continuation == "" {
+				break
+			}
+
+			q.Continuation = continuation
+		}
+
+		if wanted := []string{"g", "e", "a"}; !reflect.DeepEqual(found, wanted) {
+			t.Errorf("Incorrect results. Wanted: %v, found: %v", wanted, found)
+		}
+
+		req := httptest.NewRequest("GET", "/events?index=customer&value=1&index=type&value=view", nil)
+		w := httptest.NewRecorder()
+
+		n.eventHandler(w, req)
+
+		var res struct {
+			Events []string `json:"events"`
+		}
+
+		json.Unmarshal(w.Body.Bytes(), &res)
+
+		if wanted := []string{"f", "d", "b"}; w.Code != 200 || !reflect.DeepEqual(res.Events, wanted) {
+			t.Errorf("Incorrect response. Wanted: %v, found: %v %v", wanted, w.Code, w.Body.String())
+		}
+
+		role := &Role{Indexes: []string{"customer"}}
+
+		if !q.AllowedBy(role) || (Query{Index: "type", Value: "view", Indexes: map[string]string{AUDIT_INDEX: AUDIT_LOG}}).AllowedBy(role) {
+			t.Errorf("Wrong access to scans of several indexes")
+		}
+	})
+}
+
+func TestQueryPrefix(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(60)
+
+		for i, body := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+			trackevent(n, []byte(body), map[string]string{"customer": []string{"acme-1", "acme-2", "other-1"}[i%3]})
+		}
+
+		found := make([]string, 0)
+		q := Query{Index: "customer", Value: "acme-", Prefix: true, Limit: 2}
+
+		for i := 0; i < 10; i++ {
+			events, continuation, err := q.run(n.db)
+			if err != nil {
+				t.Fatalf("Unable to scan: %v", err)
+			}
+
+			found = append(found, events...)
+
+			if continuation == "" {
+				break
+			}
+
+			q.Continuation = continuation
+		}
+
+		if wanted := []string{"g", "e", "d", "b", "a"}; !reflect.DeepEqual(found, wanted) {
+			t.Errorf("Incorrect results. Wanted: %v, found: %v", wanted, found)
+		}
+
+		req := httptest.NewRequest("GET", "/events?index=customer&value=other&prefix=true", nil)
+		w := httptest.NewRecorder()
+
+		n.eventHandler(w, req)
+
+		var res struct {
+			Events []string `json:"events"`
+		}
+
+		json.Unmarshal(w.Body.Bytes(), &res)
+
+		if wanted := []string{"f", "c"}; w.Code != 200 || !reflect.DeepEqual(res.Events, wanted) {
+			t.Errorf("Incorrect response. Wanted: %v, found: %v %v", wanted, w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestQueryHeaders(t *testing.T) {
+	withNode(func(n *Node) {
+		_, err := n.WriteEventsWithHeaders(
+			[][]byte{[]byte("a"), []byte("b"), []byte("c")},
+			nil,
+			[]map[string]string{{"customer": "1"}, {"customer": "1"}, {"customer": "1"}},
+			[]map[string]string{{"schema": "1"}, nil, {"schema": "2", "content-type": "text/plain"}},
+			ACK_LEADER,
+		)
+
+		if err != nil {
+			t.Fatalf("Unable to write: %v", err)
+		}
+
+		events, headers, _, _, err := Query{Index: "customer", Value: "1"}.page(context.Background(), n.db)
+
+		wanted := []map[string]string{{"schema": "2", "content-type": "text/plain"}, nil, {"schema": "1"}}
+
+		if err != nil || !reflect.DeepEqual(events, []string{"c", "b", "a"}) || !reflect.DeepEqual(headers, wanted) {
+			t.Errorf("Wanted: [c b a] %v, found: %v %v %v", wanted, events, headers, err)
+		}
+
+		req := httptest.NewRequest("GET", "/events?index=customer&value=1&header=schema:1", nil)
+		w := httptest.NewRecorder()
+
+		n.eventHandler(w, req)
+
+		var res ScanResponse
+
+		json.Unmarshal(w.Body.Bytes(), &res)
+
+		if w.Code != 200 || !reflect.DeepEqual(res.Events, []string{"a"}) || !reflect.DeepEqual(res.Headers, []map[string]string{{"schema": "1"}}) {
+			t.Errorf("Incorrect response. Wanted: [a], found: %v %v", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestReaderQueries(t *testing.T) {
+	db := createDb()
+
+	db.writeAll(2, [][]byte{[]byte("a")}, nil, []map[string]string{{"a": "1", "b": "2"}}, []map[string]string{{"h": "1"}}, nil, 10e9)
+	db.Rotate(3, 1)
+	db.Write(4, []byte("b"), "", map[string]string{"a": "12"}, 20e9)
+	db.Rotate(5, 1)
+	db.Write(6, []byte("c"), "", map[string]string{"a": "1", "b": "2"}, 30e9)
+
+	// As the reader fetches it from the node.
+	var meta Metadata
+	js, _ := json.Marshal(db.metadata())
+	json.Unmarshal(js, &meta)
+
+	if len(meta.Spans) != 2 || meta.Span.First != 30e9 {
+		t.Fatalf("Expected the streams' spans in the metadata, found: %v %v", meta.Spans, meta.Span)
+	}
+
+	r := NewReader(db.reader.dir)
+	r.Update(nil, meta.Closed, meta.Current, db.stream)
+	r.SetSpans(meta.Spans, meta.Span)
+
+	var tests = []struct {
+		query string
+		found []string
+	}{
+		{"index=a&value=1", []string{"c", "a"}},
+		{"index=a&value=1&prefix=true", []string{"c", "b", "a"}},
+		{"index=a&value=1&prefix=true&since=1970-01-01T00:00:15Z", []string{"c", "b"}},
+		{"index=a&value=1&prefix=true&until=1970-01-01T00:00:25Z", []string{"b", "a"}},
+		{"index=a&value=1&index=b&value=2", []string{"c", "a"}},
+		{"index=a&value=1&header=h:1", []string{"a"}},
+		{"reverse=true", []string{"c", "b", "a"}},
+		{"", []string{"a", "b", "c"}},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest("GET", "/events?"+test.query, nil)
+
+		q, err := ParseQuery(req)
+		if err != nil {
+			t.Fatalf("Case #%v: %v", i, err)
+		}
+
+		res, err := r.RunQuery(httptest.NewRecorder(), req, q, "")
+
+		if err != nil || res == nil || !reflect.DeepEqual(res.Events, test.found) {
+			t.Errorf("Case #%v: Incorrect events. Wanted: %v, found: %+v %v", i, test.found, res, err)
+		}
+	}
+
+	if _, err := ParseQuery(httptest.NewRequest("GET", "/events?since=yesterday", nil)); err != INVALID_TIME {
+		t.Errorf("Wanted: %v, found: %v", INVALID_TIME, err)
+	}
+}
@@ -0,0 +1,356 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The limits a quota sets, as reported in a QuotaExceededError.
+const (
+	QUOTA_EVENTS_PER_SECOND = "events_per_second"
+	QUOTA_BYTES_PER_DAY     = "bytes_per_day"
+	QUOTA_TOTAL_BYTES       = "total_bytes"
+)
+
+var INVALID_QUOTA = errors.New("Quota limits must not be negative")
+
+// Quota limits the events written to one namespace: those with an
+// index whose name has the prefix, such as "acme." for a tenant whose
+// indexes are named "acme.customer", "acme.email" and so on. An empty
+// prefix limits writes to every index. Limits of 0 aren't enforced.
+//
+// Event rates and daily bytes are counted by the leader, so start
+// again from nothing when leadership changes. Total bytes are counted
+// by every node as events are applied, from when the quota was first
+// configured, and only grow: events deleted, expired or compressed
+// away since are still counted, so the limit caps what's been written
+// rather than what's kept.
+type Quota struct {
+	Prefix          string  `json:"prefix"`
+	EventsPerSecond float64 `json:"events_per_second,omitempty"`
+	BytesPerDay     int64   `json:"bytes_per_day,omitempty"`
+	TotalBytes      int64   `json:"total_bytes,omitempty"`
+}
+
+// QuotaExceededError is returned when a write would exceed a quota.
+type QuotaExceededError struct {
+	Prefix string
+	Limit  string
+	Quota  float64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("Quota exceeded for %q: %v of %v", e.Prefix, e.Limit, e.Quota)
+}
+
+// Seconds until the limit allows more writes. Those exceeding the
+// total bytes won't succeed until it's raised.
+func (e *QuotaExceededError) retryAfter() int {
+	switch e.Limit {
+	case QUOTA_EVENTS_PER_SECOND:
+		return 1
+	case QUOTA_BYTES_PER_DAY:
+		return int(time.Until(tomorrow(time.Now())).Seconds()) + 1
+	}
+
+	return 0
+}
+
+// How much of a quota has been used, and how many writes it's refused.
+type QuotaUsage struct {
+	Quota
+	TotalUsed int64 `json:"total_used"`
+	UsedToday int64 `json:"used_today"`
+	Rejected  int64 `json:"rejected"`
+}
+
+type quotaState struct {
+	tokens   float64
+	refilled time.Time
+	day      string
+	today    int64
+	total    int64
+	rejected int64
+}
+
+// Quotas enforces each Quota on writes made through the leader.
+type Quotas struct {
+	quotas []Quota
+	state  map[string]*quotaState
+	mutex  sync.Mutex
+	now    func() time.Time
+}
+
+func NewQuotas(quotas []Quota) (*Quotas, error) {
+	q := &Quotas{
+		state: make(map[string]*quotaState),
+		now:   time.Now,
+	}
+
+	for _, quota := range quotas {
+		if quota.EventsPerSecond < 0 || quota.BytesPerDay < 0 || quota.TotalBytes < 0 {
+			return nil, INVALID_QUOTA
+		}
+
+		q.quotas = append(q.quotas, quota)
+		q.state[quota.Prefix] = &quotaState{tokens: quota.EventsPerSecond}
+	}
+
+	return q, nil
+}
+
+// Reads quotas from a JSON file:
+//
+//	{
+//	  "quotas": [
+//	    {"prefix": "acme.", "events_per_second": 500, "bytes_per_day": 1073741824},
+//	    {"prefix": "initech.", "total_bytes": 10737418240}
+//	  ]
+//	}
+func LoadQuotas(path string) (*Quotas, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Quotas []Quota `json:"quotas"`
+	}
+
+	if err = json.Unmarshal(b, &config); err != nil {
+		return nil, err
+	}
+
+	return NewQuotas(config.Quotas)
+}
+
+// Whether any of the event's indexes are within the namespace.
+func (quota Quota) covers(indexes map[string]string) bool {
+	return inNamespace(quota.Prefix, indexes)
+}
+
+// Whether any of the index names have the prefix.
+func inNamespace(prefix string, indexes map[string]string) bool {
+	for name := range indexes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Admits the events if none of the quotas they're within would be
+// exceeded by them, counting them against those quotas. The events
+// are refused together if any would be.
+func (q *Quotas) admit(bodies [][]byte, indexes []map[string]string) error {
+	if q == nil {
+		return nil
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := q.now()
+	day := now.UTC().Format("2006-01-02")
+
+	counts := make([]int, len(q.quotas))
+	sizes := make([]int64, len(q.quotas))
+
+	for i, quota := range q.quotas {
+		for j, body := range bodies {
+			if j < len(indexes) && quota.covers(indexes[j]) {
+				counts[i] += 1
+				sizes[i] += int64(len(body))
+			}
+		}
+	}
+
+	for i, quota := range q.quotas {
+		if counts[i] == 0 {
+			continue
+		}
+
+		state := q.state[quota.Prefix]
+
+		if state.day != day {
+			state.day, state.today = day, 0
+		}
+
+		if quota.EventsPerSecond > 0 {
+			state.tokens += now.Sub(state.refilled).Seconds() * quota.EventsPerSecond
+			state.refilled = now
+
+			if state.tokens > quota.EventsPerSecond {
+				state.tokens = quota.EventsPerSecond
+			}
+		}
+
+		var err error
+
+		switch {
+		case quota.EventsPerSecond > 0 && state.tokens < float64(counts[i]):
+			err = &QuotaExceededError{quota.Prefix, QUOTA_EVENTS_PER_SECOND, quota.EventsPerSecond}
+		case quota.BytesPerDay > 0 && state.today+sizes[i] > quota.BytesPerDay:
+			err = &QuotaExceededError{quota.Prefix, QUOTA_BYTES_PER_DAY, float64(quota.BytesPerDay)}
+		case quota.TotalBytes > 0 && state.total+sizes[i] > quota.TotalBytes:
+			err = &QuotaExceededError{quota.Prefix, QUOTA_TOTAL_BYTES, float64(quota.TotalBytes)}
+		}
+
+		if err != nil {
+			state.rejected += 1
+			return err
+		}
+	}
+
+	for i, quota := range q.quotas {
+		if counts[i] > 0 {
+			state := q.state[quota.Prefix]
+			state.tokens -= float64(counts[i])
+			state.today += sizes[i]
+		}
+	}
+
+	return nil
+}
+
+// Counts an applied event against the total bytes of its quotas.
+func (q *Quotas) record(body []byte, indexes map[string]string) {
+	if q == nil {
+		return
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, quota := range q.quotas {
+		if quota.covers(indexes) {
+			q.state[quota.Prefix].total += int64(len(body))
+		}
+	}
+}
+
+// Reports each quota's usage, in the order they were configured.
+func (q *Quotas) Usage() []QuotaUsage {
+	if q == nil {
+		return []QuotaUsage{}
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	day := q.now().UTC().Format("2006-01-02")
+	usage := make([]QuotaUsage, 0, len(q.quotas))
+
+	for _, quota := range q.quotas {
+		state := q.state[quota.Prefix]
+
+		u := QuotaUsage{Quota: quota, TotalUsed: state.total, Rejected: state.rejected}
+
+		if state.day == day {
+			u.UsedToday = state.today
+		}
+
+		usage = append(usage, u)
+	}
+
+	return usage
+}
+
+// The total bytes used by each quota's namespace.
+func (q *Quotas) totals() map[string]int64 {
+	totals := make(map[string]int64)
+
+	if q == nil {
+		return totals
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for prefix, state := range q.state {
+		totals[prefix] = state.total
+	}
+
+	return totals
+}
+
+// Restores the total bytes used, for the namespaces still configured.
+func (q *Quotas) setTotals(totals map[string]int64) {
+	if q == nil {
+		return
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for prefix, state := range q.state {
+		state.total = totals[prefix]
+	}
+}
+
+// Midnight UTC after the time.
+func tomorrow(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// Limits writes by namespace. See Quota.
+func WithQuotas(q *Quotas) Option {
+	return func(db *DB) error {
+		db.quotas = q
+		return nil
+	}
+}
+
+func writeTotals(buf *bytes.Buffer, totals map[string]int64) {
+	prefixes := make([]string, 0, len(totals))
+	for prefix := range totals {
+		prefixes = append(prefixes, prefix)
+	}
+
+	sort.Strings(prefixes)
+
+	binary.WriteUvarint(buf, len(prefixes))
+
+	for _, prefix := range prefixes {
+		binary.WriteUvarint(buf, len(prefix))
+		buf.WriteString(prefix)
+		binary.WriteInt64(buf, totals[prefix])
+	}
+}
+
+func readTotals(buf *bytes.Buffer) (map[string]int64, error) {
+	totals := make(map[string]int64)
+
+	// Snapshots taken before quotas were counted have none.
+	if buf.Len() == 0 {
+		return totals, nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var prefix string
+		var total int64
+
+		if prefix, err = binary.ReadStringMax(buf, int64(buf.Len())); err != nil {
+			break
+		}
+
+		if total, err = binary.ReadInt64Full(buf); err == nil {
+			totals[prefix] = total
+		}
+	}
+
+	return totals, err
+}
@@ -0,0 +1,177 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuotaRate(t *testing.T) {
+	q, _ := NewQuotas([]Quota{{Prefix: "acme.", EventsPerSecond: 2}})
+
+	now := time.Now()
+	q.now = func() time.Time { return now }
+
+	acme := []map[string]string{{"acme.customer": "1"}}
+
+	for i := 0; i < 2; i++ {
+		if err := q.admit([][]byte{[]byte("a")}, acme); err != nil {
+			t.Fatalf("Expected write within the rate to be admitted, found: %v", err)
+		}
+	}
+
+	err := q.admit([][]byte{[]byte("a")}, acme)
+	if e, ok := err.(*QuotaExceededError); !ok || e.Limit != QUOTA_EVENTS_PER_SECOND {
+		t.Errorf("Expected the rate to be exceeded, found: %v", err)
+	}
+
+	if err := q.admit([][]byte{[]byte("a")}, []map[string]string{{"initech.customer": "1"}}); err != nil {
+		t.Errorf("Expected other namespaces to be unaffected, found: %v", err)
+	}
+
+	now = now.Add(time.Second)
+
+	if err := q.admit([][]byte{[]byte("a")}, acme); err != nil {
+		t.Errorf("Expected the rate to allow writes a second later, found: %v", err)
+	}
+}
+
+func TestQuotaBatchRejectedTogether(t *testing.T) {
+	q, _ := NewQuotas([]Quota{{Prefix: "acme.", BytesPerDay: 5}})
+
+	bodies := [][]byte{[]byte("abc"), []byte("def")}
+	indexes := []map[string]string{{"acme.customer": "1"}, {"acme.customer": "2"}}
+
+	err := q.admit(bodies, indexes)
+	if e, ok := err.(*QuotaExceededError); !ok || e.Limit != QUOTA_BYTES_PER_DAY {
+		t.Fatalf("Expected the daily bytes to be exceeded, found: %v", err)
+	}
+
+	usage := q.Usage()[0]
+
+	if usage.UsedToday != 0 || usage.Rejected != 1 {
+		t.Errorf("Expected nothing of the rejected batch to be counted, found: %+v", usage)
+	}
+
+	if err := q.admit(bodies[:1], indexes[:1]); err != nil {
+		t.Errorf("Expected write within the daily bytes to be admitted, found: %v", err)
+	}
+}
+
+func TestQuotaTotalBytes(t *testing.T) {
+	withNode(func(n *Node) {
+		n.db.quotas, _ = NewQuotas([]Quota{{Prefix: "acme.", TotalBytes: 4}})
+
+		if err := n.Event([]byte("abc"), "", map[string]string{"acme.customer": "1"}); err != nil {
+			t.Fatalf("Expected write within the total to succeed, found: %v", err)
+		}
+
+		err := n.Event([]byte("def"), "", map[string]string{"acme.customer": "1"})
+		if e, ok := err.(*QuotaExceededError); !ok || e.Limit != QUOTA_TOTAL_BYTES {
+			t.Errorf("Expected the total bytes to be exceeded, found: %v", err)
+		}
+
+		if kind := Classify(err); kind.Status != 429 || kind.Code != "quota_exceeded" || kind.Retryable {
+			t.Errorf("Expected a non-retryable 429, found: %+v", kind)
+		}
+
+		if _, err := n.WriteEvents([][]byte{[]byte("g")}, nil, []map[string]string{{"initech.customer": "1"}}, ACK_LEADER); err != nil {
+			t.Errorf("Expected other namespaces to be unaffected, found: %v", err)
+		}
+	})
+}
+
+func TestQuotaMixedNamespaces(t *testing.T) {
+	quotas, _ := NewQuotas([]Quota{{Prefix: "acme.", TotalBytes: 4}, {Prefix: "initech.", TotalBytes: 4}})
+	written := make([]string, 0)
+
+	q := newWriteQueue(func(bodies [][]byte, groupings []string, indexes, _ []map[string]string, _ []string) (uint64, error) {
+		if err := quotas.admit(bodies, indexes); err != nil {
+			return 0, err
+		}
+
+		for i, body := range bodies {
+			quotas.record(body, indexes[i])
+			written = append(written, string(body))
+		}
+
+		return uint64(len(written)), nil
+	})
+
+	events := []struct {
+		body    string
+		indexes map[string]string
+		err     bool
+	}{
+		{"abc", map[string]string{"acme.customer": "1"}, false},
+		{"defgh", map[string]string{"initech.customer": "1"}, true},
+		{"i", map[string]string{"initech.customer": "2"}, false},
+	}
+
+	futures := make([]*Future, len(events))
+
+	// Queued before the queue starts, so they're written together.
+	for i, e := range events {
+		futures[i] = newFuture()
+		q.queue <- queuedEvent{body: []byte(e.body), indexes: e.indexes, future: futures[i]}
+	}
+
+	go q.run()
+
+	for i, e := range events {
+		if _, err := futures[i].Wait(); (err != nil) != e.err {
+			t.Errorf("Case #%v: Wrong result for the event: %v", i, err)
+		}
+	}
+
+	if !reflect.DeepEqual(written, []string{"abc", "i"}) {
+		t.Errorf("Expected only the event over its quota to be refused, found: %v", written)
+	}
+
+	if totals := quotas.totals(); !reflect.DeepEqual(totals, map[string]int64{"acme.": 3, "initech.": 1}) {
+		t.Errorf("Expected each namespace to count its own events, found: %v", totals)
+	}
+}
+
+func TestQuotaTotalsReplayed(t *testing.T) {
+	db := createDb()
+	db.setCurrent(1)
+
+	db.Write(2, []byte("abc"), "", map[string]string{"acme.customer": "1"}, 1)
+	db.Rotate(3, 1)
+
+	// Restarting without a snapshot replays the log into the closed stream.
+	replayed, _ := NewDb("tmp")
+	replayed.quotas, _ = NewQuotas([]Quota{{Prefix: "acme.", TotalBytes: 100}})
+
+	replayed.Write(2, []byte("abc"), "", map[string]string{"acme.customer": "1"}, 1)
+
+	if totals := replayed.quotas.totals(); !reflect.DeepEqual(totals, map[string]int64{"acme.": 3}) {
+		t.Errorf("Expected replayed events to be counted, found: %v", totals)
+	}
+}
+
+func TestQuotaSnapshot(t *testing.T) {
+	db := createDb()
+	db.quotas, _ = NewQuotas([]Quota{{Prefix: "acme.", TotalBytes: 100}})
+	db.quotas.record([]byte("abc"), map[string]string{"acme.customer": "1"})
+
+	snapshot, _ := db.Save()
+
+	restored := createDb()
+	restored.quotas, _ = NewQuotas([]Quota{{Prefix: "acme.", TotalBytes: 100}})
+
+	if err := restored.Recovery(snapshot); err != nil {
+		t.Fatalf("Unable to recover snapshot: %v", err)
+	}
+
+	if totals := restored.quotas.totals(); !reflect.DeepEqual(totals, map[string]int64{"acme.": 3}) {
+		t.Errorf("Expected total bytes to be restored, found: %v", totals)
+	}
+}
+
+func TestInvalidQuota(t *testing.T) {
+	if _, err := NewQuotas([]Quota{{Prefix: "acme.", BytesPerDay: -1}}); err != INVALID_QUOTA {
+		t.Errorf("Expected invalid quota error, found: %v", err)
+	}
+}
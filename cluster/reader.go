@@ -6,12 +6,14 @@ import (
 	"github.com/customerio/esdb/stream"
 	"github.com/customerio/farm"
 
+	"context"
 	"fmt"
 	"math"
+	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
+	"sort"
 	"sync"
+	"time"
 )
 
 type Reader struct {
@@ -22,21 +24,107 @@ type Reader struct {
 	stream  stream.Stream
 	streams map[uint64]stream.Stream
 	mutexes map[uint64]*sync.Mutex
+	lock    sync.Mutex
+	health  *PeerHealth
+	router  *Router
+	retry   RetryPolicy
+	apiKey  string
+	tombs   Tombstones
+	deleted Deletions
+	// Bodies of redacted events, replaced as they're read.
+	redactions Redactions
+	// Where the events of rewritten streams are now.
+	rewrites Rewrites
+	// Changes whenever events in closed streams are deleted or redacted.
+	revision uint64
+	// Limits recovering streams from peers.
+	throttle *Throttle
+	// Times scanning and iterating each stream.
+	timer Timer
+	// Limits the scans and iterations running at once.
+	admission *Admission
+	// When the events of each stream were written. See Window.
+	spans Spans
+	span  Span
+	// How many closed streams are held open. See OpenStreams.
+	opened int64
+	// Signs continuations, if set. See WithContinuationKey.
+	continuationKey []byte
+	// Called with each closed stream fetched from peers to be read.
+	fetched func(commit uint64)
 }
 
 func NewReader(path string) *Reader {
+	health := NewPeerHealth()
+	router, _ := NewRouter(NEAREST, health)
+
 	return &Reader{
 		dir:     path,
 		closed:  make([]uint64, 0),
 		streams: make(map[uint64]stream.Stream),
 		mutexes: make(map[uint64]*sync.Mutex),
+		health:  health,
+		router:  router,
+		retry:   DefaultFetchRetryPolicy,
+		timer:   NilTimer{},
+	}
+}
+
+// Sets how the reader chooses which peers serve its requests,
+// one of ROUND_ROBIN, LEAST_OUTSTANDING or NEAREST (the default).
+func (r *Reader) SetRouting(strategy string) error {
+	router, err := NewRouter(strategy, r.health)
+	if err == nil {
+		r.router = router
+	}
+
+	return err
+}
+
+// Limits how many scans and iterations run at once, queueing others
+// for up to the timeout. See Admission.
+func (r *Reader) SetQueryLimit(limit int, timeout time.Duration) error {
+	if limit < 0 {
+		return INVALID_QUERY_LIMIT
 	}
+
+	r.admission = NewAdmission(limit, timeout)
+	return nil
+}
+
+// Sets the API key sent when fetching missing streams from peers.
+func (r *Reader) SetApiKey(key string) {
+	r.apiKey = key
+}
+
+// Sets the retry policy used when fetching missing streams from peers.
+func (r *Reader) SetRetryPolicy(p RetryPolicy) {
+	r.retry = p
+}
+
+// Sets the tombstones of deleted index values, whose
+// events are hidden from scans.
+func (r *Reader) SetTombstones(t Tombstones) {
+	r.tombs = t
+}
+
+// Sets the individually deleted events, which are hidden from scans.
+func (r *Reader) SetDeleted(d Deletions) {
+	r.deleted = d
+}
+
+// Sets the redacted events, whose bodies are replaced in scans.
+func (r *Reader) SetRedactions(redactions Redactions) {
+	r.redactions = redactions
 }
 
 func (r *Reader) ScanAll(name, value string, after uint64, scanner stream.Scanner) error {
 	var stopped int32
 
-	commit, _ := r.parseContinuation("", true)
+	tombs, deleted, redactions := r.tombs, r.deleted, r.redactions
+	now := time.Now().UnixNano()
+
+	commit, _, _ := r.parseContinuation("", true)
 
 	events := make(chan *stream.Event)
 
@@ -54,13 +142,21 @@ func (r *Reader) ScanAll(name, value string, after uint64, scanner stream.Scanne
 			current := in.(uint64)
 
 			s, err := r.retrieveStream(current, true)
-			if err != nil {
+			if err != nil || s == nil {
 				return nil, err
 			}
 
-			err = s.ScanIndex(name, value, 0, func(e *stream.Event) bool {
-				events <- e
-				return atomic.LoadInt32(&stopped) == 0
+			timeStream(r.timer, current, func() {
+				err = s.ScanIndex(name, value, 0, func(e *stream.Event) bool {
+					if hidden(tombs, deleted, current, e, now) {
+						return atomic.LoadInt32(&stopped) == 0
+					}
+
+					redactions.apply(current, e)
+
+					events <- e
+					return atomic.LoadInt32(&stopped) == 0
+				})
 			})
 
 			return nil, err
@@ -90,20 +186,60 @@ loop:
 }
 
 func (r *Reader) Scan(name, value string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	return r.ScanContext(context.Background(), name, value, after, continuation, scanner)
+}
+
+// Scans as Scan, stopping early once the context is done, between
+// streams or after the scanner is given an event. The continuation
+// returned resumes the scan from where it stopped.
+func (r *Reader) ScanContext(ctx context.Context, name, value string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
 	var stopped bool
 
-	commit, offset := r.parseContinuation(continuation, true)
+	release, err := r.admission.admit(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer release()
+
+	commit, offset, err := r.parseScanContinuation(continuation, name, value, true)
+	if err != nil {
+		return "", err
+	}
+
+	for !stopped && commit > after && ctx.Err() == nil {
+		if skip, past := r.outside(ctx, commit, true); past {
+			commit = 0
+			break
+		} else if skip {
+			commit, offset = r.Prev(commit), 0
+			continue
+		}
 
-	for !stopped && commit > after {
 		s, err := r.retrieveStream(commit, true)
 		if err != nil {
 			return "", err
 		}
 
-		err = s.ScanIndex(name, value, offset, func(e *stream.Event) bool {
-			offset = e.Next(name, value)
-			stopped = !scanner(e)
-			return !stopped
+		// Followers have the primary's current stream only once it's closed.
+		if s == nil {
+			commit, offset = r.Prev(commit), 0
+			continue
+		}
+
+		timeStream(r.timer, commit, func() {
+			err = s.ScanIndex(name, value, offset, func(e *stream.Event) bool {
+				offset = e.Next(name, value)
+
+				if hidden(r.tombs, r.deleted, commit, e, time.Now().UnixNano()) {
+					return true
+				}
+
+				r.redactions.apply(commit, e)
+
+				stopped = !scanner(e) || ctx.Err() != nil
+				return !stopped
+			})
 		})
 
 		if err != nil {
@@ -124,24 +260,207 @@ func (r *Reader) Scan(name, value string, after uint64, continuation string, sca
 		commit = 0
 	}
 
+	return r.buildScanContinuation(commit, offset, name, value), nil
+}
+
+func (r *Reader) ScanGrouping(grouping string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	return r.Scan(stream.GROUPING_INDEX, grouping, after, continuation, scanner)
+}
+
+// Scans as ScanContext, but only events written with every one of the
+// index values, walking each of their chains together so no more events
+// are read than the rarest value has.
+func (r *Reader) ScanIndexesContext(ctx context.Context, indexes map[string]string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	var stopped bool
+
+	release, err := r.admission.admit(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer release()
+
+	commit, offset, err := r.parseContinuation(continuation, true)
+	if err != nil {
+		return "", err
+	}
+
+	for !stopped && commit > after && ctx.Err() == nil {
+		if skip, past := r.outside(ctx, commit, true); past {
+			commit = 0
+			break
+		} else if skip {
+			commit, offset = r.Prev(commit), 0
+			continue
+		}
+
+		s, err := r.retrieveStream(commit, true)
+		if err != nil {
+			return "", err
+		}
+
+		// Followers have the primary's current stream only once it's closed.
+		if s != nil {
+			timeStream(r.timer, commit, func() {
+				offset, err = s.ScanIndexes(indexes, offset, func(e *stream.Event) bool {
+					if hidden(r.tombs, r.deleted, commit, e, time.Now().UnixNano()) {
+						return true
+					}
+
+					r.redactions.apply(commit, e)
+
+					stopped = !scanner(e) || ctx.Err() != nil
+					return !stopped
+				})
+			})
+
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if !stopped {
+			commit = r.Prev(commit)
+			offset = 0
+		}
+	}
+
+	if stopped && offset == 0 {
+		commit = r.Prev(commit)
+	}
+
+	if commit <= after {
+		commit = 0
+	}
+
 	return r.buildContinuation(commit, offset), nil
 }
 
+// Scans as ScanContext, but events with any value of the index which
+// begins with the prefix, such as customer values beginning with "12",
+// in the order they were written.
+func (r *Reader) ScanPrefixContext(ctx context.Context, name, prefix string, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	var stopped bool
+
+	release, err := r.admission.admit(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer release()
+
+	commit, offset, err := r.parseContinuation(continuation, true)
+	if err != nil {
+		return "", err
+	}
+
+	for !stopped && commit > after && ctx.Err() == nil {
+		if skip, past := r.outside(ctx, commit, true); past {
+			commit = 0
+			break
+		} else if skip {
+			commit, offset = r.Prev(commit), 0
+			continue
+		}
+
+		s, err := r.retrieveStream(commit, true)
+		if err != nil {
+			return "", err
+		}
+
+		// Followers have the primary's current stream only once it's closed.
+		if s != nil {
+			timeStream(r.timer, commit, func() {
+				offset, err = s.ScanPrefix(name, prefix, offset, func(e *stream.Event) bool {
+					if hidden(r.tombs, r.deleted, commit, e, time.Now().UnixNano()) {
+						return true
+					}
+
+					r.redactions.apply(commit, e)
+
+					stopped = !scanner(e) || ctx.Err() != nil
+					return !stopped
+				})
+			})
+
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if !stopped {
+			commit = r.Prev(commit)
+			offset = 0
+		}
+	}
+
+	if stopped && offset == 0 {
+		commit = r.Prev(commit)
+	}
+
+	if commit <= after {
+		commit = 0
+	}
+
+	return r.buildContinuation(commit, offset), nil
+}
+
+// Iterates over every event in a total order: by the commit of the
+// stream holding the event, then by its offset within the stream.
+// Compressing streams keeps this order, as merged streams are written
+// in commit order to the first of them. The continuation returned is
+// the position of the next event in this order.
 func (r *Reader) Iterate(after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	return r.IterateContext(context.Background(), after, continuation, scanner)
+}
+
+// Iterates as Iterate, stopping early once the context is done.
+// See ScanContext.
+func (r *Reader) IterateContext(ctx context.Context, after uint64, continuation string, scanner stream.Scanner) (string, error) {
 	var stopped bool
 
-	commit, offset := r.parseContinuation(continuation, false)
+	release, err := r.admission.admit(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer release()
+
+	commit, offset, err := r.parseContinuation(continuation, false)
+	if err != nil {
+		return "", err
+	}
+
+	for !stopped && commit > 0 && ctx.Err() == nil {
+		if skip, past := r.outside(ctx, commit, false); past {
+			commit = 0
+			break
+		} else if skip {
+			commit, offset = r.Next(commit), 0
+			continue
+		}
 
-	for !stopped && commit > 0 {
 		if commit > after {
 			s, err := r.retrieveStream(commit, true)
 			if err != nil {
 				return "", err
 			}
 
-			offset, err = s.Iterate(offset, func(e *stream.Event) bool {
-				stopped = !scanner(e)
-				return !stopped
+			if s == nil {
+				break
+			}
+
+			timeStream(r.timer, commit, func() {
+				offset, err = s.Iterate(offset, func(e *stream.Event) bool {
+					if audited(e) || hidden(r.tombs, r.deleted, commit, e, time.Now().UnixNano()) {
+						return true
+					}
+
+					r.redactions.apply(commit, e)
+
+					stopped = !scanner(e) || ctx.Err() != nil
+					return !stopped
+				})
 			})
 
 			if err != nil {
@@ -158,6 +477,70 @@ func (r *Reader) Iterate(after uint64, continuation string, scanner stream.Scann
 	return r.buildContinuation(commit, offset), nil
 }
 
+// Iterates as IterateContext, but from newest to oldest, so resuming
+// from a continuation returns the events before it.
+func (r *Reader) IterateReverseContext(ctx context.Context, after uint64, continuation string, scanner stream.Scanner) (string, error) {
+	var stopped bool
+
+	release, err := r.admission.admit(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer release()
+
+	commit, offset, err := r.parseContinuation(continuation, true)
+	if err != nil {
+		return "", err
+	}
+
+	for !stopped && commit > after && ctx.Err() == nil {
+		if skip, past := r.outside(ctx, commit, true); past {
+			commit = 0
+			break
+		} else if skip {
+			commit, offset = r.Prev(commit), 0
+			continue
+		}
+
+		s, err := r.retrieveStream(commit, true)
+		if err != nil {
+			return "", err
+		}
+
+		// Followers have the primary's current stream only once it's closed.
+		if s != nil {
+			timeStream(r.timer, commit, func() {
+				offset, err = s.IterateReverse(offset, func(e *stream.Event) bool {
+					if audited(e) || hidden(r.tombs, r.deleted, commit, e, time.Now().UnixNano()) {
+						return true
+					}
+
+					r.redactions.apply(commit, e)
+
+					stopped = !scanner(e) || ctx.Err() != nil
+					return !stopped
+				})
+			})
+
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if !stopped {
+			commit = r.Prev(commit)
+			offset = 0
+		}
+	}
+
+	if commit <= after {
+		return "", nil
+	}
+
+	return r.buildContinuation(commit, offset), nil
+}
+
 func (r *Reader) Prev(commit uint64) uint64 {
 	var result uint64
 
@@ -206,11 +589,41 @@ func (r *Reader) Update(peers []string, closed []uint64, current uint64, stream
 		}
 	}
 
+	// Streams are always read in commit order, however the
+	// list of closed streams was put together.
+	if !sort.IsSorted(OffsetSlice(closed)) {
+		closed = append([]uint64{}, closed...)
+		sort.Sort(OffsetSlice(closed))
+	}
+
 	r.current = current
 	r.stream = stream
 	r.closed = closed
 }
 
+// Records the outcome of a request made to a peer on behalf of this
+// reader (such as fetching stream metadata), so future requests favor
+// healthy peers.
+func (r *Reader) RecordPeer(peer string, latency time.Duration, err error) {
+	r.health.Record(peer, latency, err)
+}
+
+// Orders peers by preference according to the routing strategy,
+// leaving out any which have been quarantined for failing repeatedly.
+func (r *Reader) Route(peers []string) []string {
+	return r.router.Order(peers)
+}
+
+// Marks the start of a request made to a peer on behalf of this
+// reader. The returned function must be called once it completes.
+func (r *Reader) BeginRequest(peer string) func(err error) {
+	return r.router.Begin(peer)
+}
+
+func (r *Reader) PeerStatus() map[string]PeerStatus {
+	return r.health.Status()
+}
+
 func (r *Reader) retrieveStream(commit uint64, fetchMissing bool) (stream.Stream, error) {
 	if commit == r.current {
 		return r.stream, nil
@@ -228,22 +641,37 @@ func (r *Reader) retrieveStream(commit uint64, fetchMissing bool) (stream.Stream
 
 				s, err = stream.Open(r.Path(commit))
 
-				if err != nil && strings.Contains(err.Error(), "no such file or directory") {
+				if err == stream.STREAM_NOT_FOUND {
 					missing = true
 				}
 
+				// Once the streams are compressed, and until it's
+				// renamed, the compressed stream can be read directly
+				// rather than fetched from peers. Before then, it would
+				// repeat the events of the streams merged into it.
+				if rw, ok := r.rewrites[commit]; missing && ok && rw.Into == commit {
+					if compressed, cerr := stream.Open(r.compressedpath(commit)); cerr == nil && compressed.Closed() {
+						s, err, missing = compressed, nil, false
+					} else if cerr == nil {
+						compressed.Close()
+					}
+				}
+
 				if s != nil && !s.Closed() {
-					println("found open stream:", commit)
-					missing = true
-					s = nil
+					s, err, missing = nil, RETRIEVED_OPEN_STREAM, true
 				}
 
 				if missing && fetchMissing {
-					s, err = RecoverStream(r.peers, r.dir, fmt.Sprintf("events.%024v.stream", commit))
+					s, err = recoverStream(r.retry, r.router, r.throttle, r.apiKey, r.peers, r.dir, fmt.Sprintf("events.%024v.stream", commit))
+
+					if err == nil && r.fetched != nil {
+						r.fetched(commit)
+					}
 				}
 
 				if err == nil {
 					r.streams[commit] = s
+					atomic.AddInt64(&r.opened, 1)
 				}
 			}
 		})()
@@ -256,15 +684,97 @@ func (r *Reader) retrieveStream(commit uint64, fetchMissing bool) (stream.Stream
 	return r.streams[commit], nil
 }
 
+// Fetches the closed stream from the first of the peers which has it,
+// unless it's held locally already.
+func (r *Reader) fetchStream(peers []string, commit uint64) error {
+	r.mutex(commit).Lock()
+	defer r.mutex(commit).Unlock()
+
+	if _, err := os.Stat(r.Path(commit)); err == nil {
+		return nil
+	}
+
+	s, err := recoverStream(r.retry, r.router, r.throttle, r.apiKey, peers, r.dir, filepath.Base(r.Path(commit)))
+	if err != nil {
+		return err
+	}
+
+	return s.Close()
+}
+
+// Fetches the closed stream again from the first of the peers which
+// has it, replacing the local copy if what's fetched has one of the
+// digests, when any are given.
+func (r *Reader) refetchStream(peers []string, commit uint64, accepted ...string) error {
+	dir := filepath.Join(r.dir, "fetch")
+	file := filepath.Base(r.Path(commit))
+
+	if err := os.MkdirAll(dir, 0744); err != nil {
+		return err
+	}
+
+	s, err := recoverStream(r.retry, r.router, r.throttle, r.apiKey, peers, dir, file)
+	if err != nil {
+		return err
+	}
+
+	s.Close()
+
+	path := filepath.Join(dir, file)
+
+	if len(accepted) > 0 {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if fetched, err := digests.get(path, stat); err != nil || !containsString(accepted, fetched) {
+			os.Remove(path)
+			return fmt.Errorf("Fetched stream %v doesn't match digests %v", commit, accepted)
+		}
+	}
+
+	return r.replaceStream(commit, func() error {
+		return os.Rename(path, r.Path(commit))
+	})
+}
+
+// Replaces a closed stream's file, so it's reopened when next read.
+func (r *Reader) replaceStream(commit uint64, replace func() error) error {
+	r.mutex(commit).Lock()
+	defer r.mutex(commit).Unlock()
+
+	r.forgetStream(commit)
+
+	return replace()
+}
+
 func (r *Reader) forgetStream(commit uint64) {
 	if r.streams[commit] != nil {
 		r.streams[commit].Close()
+		atomic.AddInt64(&r.opened, -1)
 	}
 
 	delete(r.streams, commit)
 }
 
+// How many streams the reader holds open: the closed streams it has
+// read, and the current one if it has one.
+func (r *Reader) OpenStreams() int {
+	open := int(atomic.LoadInt64(&r.opened))
+
+	if r.stream != nil {
+		open++
+	}
+
+	return open
+}
+
+// Scans run concurrently, so access to the mutexes is guarded too.
 func (r *Reader) mutex(commit uint64) *sync.Mutex {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
 	if r.mutexes[commit] == nil {
 		r.mutexes[commit] = &sync.Mutex{}
 	}
@@ -280,31 +790,18 @@ func (r *Reader) compressedpath(commit uint64) string {
 	return filepath.Join(r.dir, fmt.Sprintf("events.%024v.tmpstream", commit))
 }
 
-func (r *Reader) parseContinuation(continuation string, reverse bool) (uint64, int64) {
-	commit := r.current
-
-	if !reverse && len(r.closed) > 0 {
-		commit = r.closed[0]
-	}
-
-	var offset int64
-
-	if continuation != "" {
-		parts := strings.SplitN(continuation, ":", 2)
+func (r *Reader) removalspath(commit uint64) string {
+	return filepath.Join(r.dir, fmt.Sprintf("events.%024v.removals", commit))
+}
 
-		if len(parts) == 2 {
-			commit, _ = strconv.ParseUint(parts[0], 10, 64)
-			offset, _ = strconv.ParseInt(parts[1], 10, 64)
-		}
-	}
+func (r *Reader) mergingpath(commit uint64) string {
+	return filepath.Join(r.dir, fmt.Sprintf("events.%024v.merging", commit))
+}
 
-	return commit, offset
+func (r *Reader) redactedpath(commit uint64) string {
+	return filepath.Join(r.dir, fmt.Sprintf("events.%024v.redacting", commit))
 }
 
-func (r *Reader) buildContinuation(commit uint64, offset int64) string {
-	if commit > 0 {
-		return fmt.Sprint(commit, ":", offset)
-	} else {
-		return ""
-	}
+func (r *Reader) splitpath(commit uint64) string {
+	return filepath.Join(r.dir, fmt.Sprintf("events.%024v.splitting", commit))
 }
@@ -0,0 +1,60 @@
+package cluster
+
+import (
+	"github.com/jrallison/raft"
+
+	"errors"
+	"sync/atomic"
+)
+
+var READ_ONLY_ERROR = errors.New("Node is in read-only mode")
+
+// ReadOnlyCommand switches the whole cluster in or out of read-only
+// mode. While read-only, writes and deletes are rejected, so streams
+// stop growing and are never rotated, but reads continue as normal.
+type ReadOnlyCommand struct {
+	ReadOnly  bool  `json:"readonly"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+func NewReadOnlyCommand(readonly bool, timestamp int64) *ReadOnlyCommand {
+	return &ReadOnlyCommand{
+		ReadOnly:  readonly,
+		Timestamp: timestamp,
+	}
+}
+
+func (c *ReadOnlyCommand) CommandName() string {
+	return "readonly"
+}
+
+func (c *ReadOnlyCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	db.setReadOnly(c.ReadOnly)
+
+	err := db.audit(db.commit(context.CurrentIndex()), AUDIT_READ_ONLY, map[string]interface{}{
+		"readonly": c.ReadOnly,
+	}, c.Timestamp)
+
+	return new(interface{}), err
+}
+
+func (db *DB) setReadOnly(readonly bool) {
+	var value int32
+
+	if readonly {
+		value = 1
+	}
+
+	atomic.StoreInt32(&db.readonly, value)
+}
+
+// Whether the cluster has been switched to read-only mode, or follows
+// a primary. Commands which write check this as they're applied, so
+// writes already in the log when the switch was made are rejected on
+// every node alike.
+func (db *DB) ReadOnly() bool {
+	return atomic.LoadInt32(&db.readonly) == 1 || db.Following()
+}
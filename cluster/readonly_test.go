@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadOnlyCluster(t *testing.T) {
+	withNode(func(n *Node) {
+		trackevent(n, []byte("a"), map[string]string{"a": "1"})
+
+		if err := n.SetClusterReadOnly(true); err != nil {
+			t.Fatalf("Unable to switch to read-only: %v", err)
+		}
+
+		if err := n.Event([]byte("b"), "", map[string]string{"a": "1"}); err != READ_ONLY_ERROR {
+			t.Errorf("Expected read-only error, found: %v", err)
+		}
+
+		if err := n.Delete("a", "1"); err != READ_ONLY_ERROR {
+			t.Errorf("Expected read-only error, found: %v", err)
+		}
+
+		found, _, _ := Query{Index: "a", Value: "1"}.run(n.db)
+
+		if !reflect.DeepEqual(found, []string{"a"}) {
+			t.Errorf("Incorrect read while read-only. Wanted: [a], found: %v", found)
+		}
+
+		n.SetClusterReadOnly(false)
+
+		if err := n.Event([]byte("b"), "", map[string]string{"a": "1"}); err != nil {
+			t.Errorf("Expected write to succeed, found: %v", err)
+		}
+	})
+}
+
+func TestReadOnlyNode(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetReadOnly(true)
+
+		if err := n.Event([]byte("a"), "", map[string]string{"a": "1"}); err != READ_ONLY_ERROR {
+			t.Errorf("Expected read-only error, found: %v", err)
+		}
+
+		if n.db.ReadOnly() {
+			t.Errorf("Node read-only mode shouldn't affect the cluster")
+		}
+
+		n.SetReadOnly(false)
+
+		if err := n.Event([]byte("a"), "", map[string]string{"a": "1"}); err != nil {
+			t.Errorf("Expected write to succeed, found: %v", err)
+		}
+	})
+}
+
+func TestReadOnlySnapshot(t *testing.T) {
+	db := createDb()
+	db.setReadOnly(true)
+
+	b, _ := db.Save()
+
+	db = createDb()
+	db.Recovery(b)
+
+	if !db.ReadOnly() {
+		t.Errorf("Read-only mode wasn't restored from snapshot")
+	}
+}
@@ -0,0 +1,100 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Recent tracks the timestamp of the most recent event written with
+// each index name, so consumers can cheaply tell whether anything new
+// has been written for the entities they follow.
+type Recent struct {
+	indexes map[string]int64
+	mutex   sync.RWMutex
+}
+
+func NewRecent() *Recent {
+	return &Recent{indexes: make(map[string]int64)}
+}
+
+func (r *Recent) Add(indexes map[string]string, timestamp int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for name := range indexes {
+		if strings.HasPrefix(name, AUDIT_INDEX) {
+			continue
+		}
+
+		if timestamp > r.indexes[name] {
+			r.indexes[name] = timestamp
+		}
+	}
+}
+
+// The most recent timestamp written with the index, or 0 if none.
+func (r *Recent) Get(name string) int64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.indexes[name]
+}
+
+func (r *Recent) All() map[string]int64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	indexes := make(map[string]int64, len(r.indexes))
+
+	for name, timestamp := range r.indexes {
+		indexes[name] = timestamp
+	}
+
+	return indexes
+}
+
+func writeRecent(buf *bytes.Buffer, r *Recent) {
+	indexes := r.All()
+
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	binary.WriteUvarint(buf, len(names))
+
+	for _, name := range names {
+		binary.WriteUvarint(buf, len(name))
+		buf.WriteString(name)
+		binary.WriteInt64(buf, indexes[name])
+	}
+}
+
+func readRecent(buf *bytes.Buffer) (*Recent, error) {
+	r := NewRecent()
+
+	// Snapshots taken before indexes were tracked have none.
+	if buf.Len() == 0 {
+		return r, nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var name string
+
+		if name, err = binary.ReadStringMax(buf, int64(buf.Len())); err != nil {
+			break
+		}
+
+		r.indexes[name], err = binary.ReadInt64Full(buf)
+	}
+
+	return r, err
+}
@@ -0,0 +1,91 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How long an unfinished compressed stream is left untouched before
+// its merge is assumed to have been interrupted, rather than running.
+const STALE_COMPRESSION = 10 * time.Minute
+
+// Finishes or rolls back compressions interrupted by a crash, before
+// the raft log is replayed. Compressed streams are merged into a
+// .tmpstream, then renamed over the first merged stream as the
+// compress command is applied.
+//
+//   - Unfinished compressed streams are removed, once stale, as the
+//     streams they were merged from are untouched. The merge can be
+//     run again.
+//   - Finished ones whose stream is missing are renamed into place, as
+//     the rename must have been interrupted.
+//   - Finished ones whose stream is present are kept, for the compress
+//     command to rename when it's applied or replayed.
+func (db *DB) reconcileCompressions() {
+	// Compactions' merges run in the background, so any left were
+	// interrupted, and are run again if the compact command is replayed.
+	if merging, err := filepath.Glob(filepath.Join(db.reader.dir, "events.*.merging")); err == nil {
+		for _, path := range merging {
+			os.Remove(path)
+		}
+	}
+
+	// Removals are recorded for the merged stream alongside them.
+	if removals, err := filepath.Glob(filepath.Join(db.reader.dir, "events.*.removals")); err == nil {
+		for _, path := range removals {
+			var commit uint64
+
+			if _, err := fmt.Sscanf(filepath.Base(path), "events.%d.removals", &commit); err != nil {
+				continue
+			}
+
+			if _, err := os.Stat(db.reader.compressedpath(commit)); os.IsNotExist(err) {
+				os.Remove(path)
+			}
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(db.reader.dir, "events.*.tmpstream"))
+	if err != nil {
+		db.logger.Println("COMPRESS: Unable to find interrupted compressions:", err)
+		return
+	}
+
+	for _, path := range paths {
+		var commit uint64
+
+		if _, err := fmt.Sscanf(filepath.Base(path), "events.%d.tmpstream", &commit); err != nil {
+			continue
+		}
+
+		closed, err := stream.IsClosed(path)
+		if err != nil {
+			db.logger.Println("COMPRESS: Unable to check compressed stream", commit, err)
+			continue
+		}
+
+		if closed {
+			if _, err := os.Stat(db.reader.Path(commit)); os.IsNotExist(err) {
+				db.logger.Println("COMPRESS: Completing interrupted compression of", commit)
+
+				if err := os.Rename(path, db.reader.Path(commit)); err != nil {
+					db.logger.Println("COMPRESS: Unable to complete compression of", commit, err)
+				}
+			}
+
+			continue
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > STALE_COMPRESSION {
+			db.logger.Println("COMPRESS: Rolling back interrupted compression of", commit)
+
+			if err := os.Remove(path); err != nil {
+				db.logger.Println("COMPRESS: Unable to roll back compression of", commit, err)
+			}
+		}
+	}
+}
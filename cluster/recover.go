@@ -13,21 +13,59 @@ import (
 )
 
 func RecoverStream(peers []string, dir, file string) (stream.Stream, error) {
-	for _, peer := range peers {
-		if s, err := readStream(peer, dir, file); err == nil {
-			return s, err
-		} else {
-			log.Println("RECOVER STREAM: Error", err)
+	router, _ := NewRouter(NEAREST, NewPeerHealth())
+	return recoverStream(DefaultFetchRetryPolicy, router, nil, "", peers, dir, file)
+}
+
+// Attempts to recover the stream from peers in the order preferred by
+// the router, recording the outcome of every attempt. If no peer can
+// provide the stream, we back off and try them all again, per the policy.
+// Downloads are limited by the throttle.
+func recoverStream(policy RetryPolicy, router *Router, throttle *Throttle, key string, peers []string, dir, file string) (s stream.Stream, err error) {
+	client := policy.httpClient()
+
+	err = policy.Do(func() error {
+		for _, peer := range router.Order(peers) {
+			done := router.Begin(peer)
+
+			s, err = readStream(client, throttle, key, peer, dir, file)
+			done(err)
+
+			if err == nil {
+				return nil
+			} else {
+				log.Println("RECOVER STREAM: Error", err)
+			}
 		}
-	}
 
-	return nil, errors.New("couldn't recover stream " + file + " from any peer.")
+		return &MissingStreamError{file}
+	})
+
+	return
+}
+
+// Returned when a stream is missing locally, and no peer can provide it.
+type MissingStreamError struct {
+	File string
+}
+
+func (e *MissingStreamError) Error() string {
+	return "couldn't recover stream " + e.File + " from any peer."
 }
 
-func readStream(host, dir, file string) (stream.Stream, error) {
+func readStream(client *http.Client, throttle *Throttle, key, host, dir, file string) (stream.Stream, error) {
 	log.Println("RECOVER STREAM: Recovering file", file, "from", host)
 
-	resp, err := http.Get(host + "/stream/" + file)
+	req, err := http.NewRequest("GET", host+"/stream/"+file, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != "" {
+		req.Header.Set(API_KEY_HEADER, key)
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -40,13 +78,20 @@ func readStream(host, dir, file string) (stream.Stream, error) {
 
 	path := filepath.Join(dir, file)
 
-	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0755)
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = io.Copy(out, resp.Body)
+	_, err = io.Copy(throttle.Writer(out), resp.Body)
+	out.Close()
+
+	if err == nil {
+		err = verifyDigest(resp.Header.Get("Digest"), path)
+	}
+
 	if err != nil {
+		os.Remove(path)
 		return nil, err
 	}
 
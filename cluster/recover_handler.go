@@ -3,29 +3,161 @@ package cluster
 import (
 	"github.com/customerio/esdb/stream"
 
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// Serves stream files by name, as requested by peers recovering
+// streams they're missing.
 func (n *Node) recoverHandler(w http.ResponseWriter, req *http.Request) {
 	file := strings.Replace(req.URL.Path, "/stream/", "", 1)
 
-	path := filepath.Join(n.db.dir, file)
+	n.serveStream(w, req, filepath.Join(n.db.dir, filepath.Base(file)))
+}
 
-	s, err := stream.Open(path)
+// Serves closed stream files by commit, supporting Range requests
+// so large downloads can be resumed.
+func (n *Node) streamHandler(w http.ResponseWriter, req *http.Request) {
+	commit, err := strconv.ParseUint(strings.Replace(req.URL.Path, "/streams/", "", 1), 10, 64)
 	if err != nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	n.serveStream(w, req, n.db.reader.Path(commit))
+}
+
+func (n *Node) serveStream(w http.ResponseWriter, req *http.Request, path string) {
+	// Raw streams hold every event, so only unrestricted roles can fetch them.
+	if role, ok := n.auth.Authorize(w, req, READ); !ok {
+		return
+	} else if !role.Allows("", "") {
+		Deny(w, FORBIDDEN)
+		return
+	}
+
+	s, err := stream.Open(path)
+	if os.IsNotExist(err) {
+		w.WriteHeader(404)
+		return
+	} else if err != nil {
 		w.WriteHeader(500)
-	} else if !s.Closed() {
+		return
+	}
+
+	closed := s.Closed()
+	s.Close()
+
+	if !closed {
 		w.WriteHeader(404)
-	} else {
-		if f, err := os.Open(path); err != nil {
-			w.WriteHeader(500)
-		} else {
-			io.Copy(w, f)
-			f.Close()
-		}
+		return
 	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+
+	digest, err := digests.get(path, info)
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+
+	// The digest is of the whole file, even when a range is requested.
+	w.Header().Set("Digest", "SHA-256="+digest)
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	http.ServeContent(w, req, filepath.Base(path), info.ModTime(), f)
+}
+
+// Closed streams only change when redacted or compressed, so
+// their digests are cached until the file is modified.
+type digestCache struct {
+	digests map[string]cachedDigest
+	mutex   sync.Mutex
+}
+
+type cachedDigest struct {
+	modified time.Time
+	size     int64
+	digest   string
+}
+
+var digests = &digestCache{digests: make(map[string]cachedDigest)}
+
+func (c *digestCache) get(path string, info os.FileInfo) (string, error) {
+	c.mutex.Lock()
+	cached, ok := c.digests[path]
+	c.mutex.Unlock()
+
+	if ok && cached.modified.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.digest, nil
+	}
+
+	digest, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	c.digests[path] = cachedDigest{info.ModTime(), info.Size(), digest}
+	c.mutex.Unlock()
+
+	return digest, nil
+}
+
+// Returns the base64 encoded SHA-256 digest of the file.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// Checks a downloaded file against the Digest header it was served
+// with. Peers which don't send a digest can't be verified.
+func verifyDigest(header string, path string) error {
+	if !strings.HasPrefix(header, "SHA-256=") {
+		return nil
+	}
+
+	digest, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+
+	if digest != strings.TrimPrefix(header, "SHA-256=") {
+		return fmt.Errorf("digest mismatch for %v", filepath.Base(path))
+	}
+
+	return nil
 }
@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestStreamDownload(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("a"), map[string]string{"a": "b"})
+
+		full, _ := ioutil.ReadFile(n.db.reader.Path(1))
+		digest, _ := fileDigest(n.db.reader.Path(1))
+
+		req, _ := http.NewRequest("GET", "/streams/1", nil)
+		req.Header.Set("Range", "bytes=2-5")
+
+		w := httptest.NewRecorder()
+		n.streamHandler(w, req)
+
+		if w.Code != 206 {
+			t.Errorf("Incorrect status for range request. Wanted: 206, found: %v", w.Code)
+		}
+
+		if body := w.Body.String(); body != string(full[2:6]) {
+			t.Errorf("Incorrect range returned. Wanted: %q, found: %q", full[2:6], body)
+		}
+
+		if header := w.Header().Get("Digest"); header != "SHA-256="+digest {
+			t.Errorf("Incorrect digest. Wanted: %v, found: %v", "SHA-256="+digest, header)
+		}
+
+		// The current stream is still being written to.
+		req, _ = http.NewRequest("GET", "/streams/"+strconv.FormatUint(n.db.current, 10), nil)
+
+		w = httptest.NewRecorder()
+		n.streamHandler(w, req)
+
+		if w.Code != 404 {
+			t.Errorf("Open streams should not be downloadable. Wanted: 404, found: %v", w.Code)
+		}
+	})
+}
@@ -0,0 +1,287 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+	"github.com/customerio/esdb/stream"
+	"github.com/jrallison/raft"
+
+	"bytes"
+	"errors"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var REDACTING_UNKNOWN_STREAM = errors.New("Only closed streams can be redacted")
+
+// Redaction replaces the body of the event at the given offset
+// within a closed stream. A nil or empty body removes it entirely.
+type Redaction struct {
+	Offset int64  `json:"offset"`
+	Body   []byte `json:"body,omitempty"`
+}
+
+type RedactCommand struct {
+	Commit     uint64      `json:"commit"`
+	Redactions []Redaction `json:"redactions"`
+	Timestamp  int64       `json:"timestamp"`
+}
+
+func NewRedactCommand(commit uint64, redactions []Redaction, timestamp int64) *RedactCommand {
+	return &RedactCommand{
+		Commit:     commit,
+		Redactions: redactions,
+		Timestamp:  timestamp,
+	}
+}
+
+func (c *RedactCommand) CommandName() string {
+	return "redact"
+}
+
+func (c *RedactCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	if err := db.Redact(db.commit(context.CurrentIndex()), c.Commit, c.Redactions); err != nil {
+		return new(interface{}), err
+	}
+
+	err := db.audit(db.commit(context.CurrentIndex()), AUDIT_REDACT, map[string]interface{}{
+		"commit": c.Commit,
+		"events": len(c.Redactions),
+	}, c.Timestamp)
+
+	return new(interface{}), err
+}
+
+// Records the redactions, so they're applied to the stream's events as
+// they're read, then rewrites the closed stream in the background with
+// every event redacted in it so far, and swaps it in place of the
+// original. Streams which haven't been fetched yet, or are fetched from
+// a peer which hasn't rewritten its copy, are still read redacted.
+func (db *DB) Redact(index, commit uint64, redactions []Redaction) error {
+	if !db.isClosed(commit) {
+		return REDACTING_UNKNOWN_STREAM
+	}
+
+	redacted := make(Redactions, len(db.redactions)+1)
+
+	for c, bodies := range db.redactions {
+		redacted[c] = bodies
+	}
+
+	bodies := make(map[int64][]byte, len(db.redactions[commit])+len(redactions))
+
+	for offset, body := range db.redactions[commit] {
+		bodies[offset] = body
+	}
+
+	for _, r := range redactions {
+		bodies[r.Offset] = redactedBody(r.Body)
+	}
+
+	redacted[commit] = bodies
+
+	db.redactions = redacted
+	db.revision = index
+
+	atomic.AddInt32(&db.redacting, 1)
+
+	rewrite := func() error {
+		path := db.reader.Path(commit)
+		tmp := db.reader.redactedpath(commit)
+
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+
+		start := time.Now()
+
+		if err := stream.Redact(path, tmp, bodies); err != nil {
+			return err
+		}
+
+		err := db.reader.replaceStream(commit, func() error {
+			return os.Rename(tmp, path)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		db.logger.Println("STREAM: Redacted", len(bodies), "events in", commit, "in", time.Since(start))
+
+		return nil
+	}
+
+	go func() {
+		defer atomic.AddInt32(&db.redacting, -1)
+		db.supervisor.Run("redact", rewrite)
+	}()
+
+	return nil
+}
+
+// Checks the redactions can be made to the closed stream, fetching it
+// from a peer if needed, so they're refused before they're committed.
+func (db *DB) checkRedactions(commit uint64, redactions []Redaction) error {
+	if !db.isClosed(commit) {
+		return REDACTING_UNKNOWN_STREAM
+	}
+
+	if _, err := db.retrieveStream(commit, true); err != nil {
+		return err
+	}
+
+	bodies := make(map[int64][]byte, len(redactions))
+
+	for _, r := range redactions {
+		bodies[r.Offset] = redactedBody(r.Body)
+	}
+
+	return stream.CheckRedactions(db.reader.Path(commit), bodies)
+}
+
+// Bodies are left out of the raft log's JSON when empty, so removing an
+// event's body may arrive as nil. Both are recorded as empty.
+func redactedBody(body []byte) []byte {
+	if body == nil {
+		return []byte{}
+	}
+
+	return body
+}
+
+// Redactions are the bodies events in closed streams were redacted to,
+// keyed by stream commit then offset. Like Deletions, they're shared
+// with readers scanning concurrently, so are replaced rather than
+// modified.
+type Redactions map[uint64]map[int64][]byte
+
+// Replaces the event's body, if it's been redacted.
+func (r Redactions) apply(commit uint64, e *stream.Event) {
+	if body, ok := r[commit][e.Offset]; ok {
+		e.Data = body
+	}
+}
+
+// Merged streams are written with their events redacted, so no longer
+// need them applied.
+func (db *DB) compressRedactions(start, stop uint64) {
+	redacted := make(Redactions, len(db.redactions))
+
+	for commit, bodies := range db.redactions {
+		if commit < start || commit > stop {
+			redacted[commit] = bodies
+		}
+	}
+
+	db.redactions = redacted
+}
+
+func (db *DB) splitRedactions(commit uint64, moved map[int64]stream.Position) {
+	redacted := make(Redactions, len(db.redactions))
+
+	for c, bodies := range db.redactions {
+		if c != commit {
+			redacted[c] = bodies
+		}
+	}
+
+	for offset, body := range db.redactions[commit] {
+		p := moved[offset]
+		piece := commit + uint64(p.Piece)
+
+		if redacted[piece] == nil {
+			redacted[piece] = make(map[int64][]byte)
+		}
+
+		redacted[piece][p.Offset] = body
+	}
+
+	db.redactions = redacted
+}
+
+// [uvarint:streams]([int64:commit][uvarint:events]([int64:offset][uvarint:length][bytes:body])...)...
+func writeRedactions(buf *bytes.Buffer, redactions Redactions) {
+	commits := make([]uint64, 0, len(redactions))
+
+	for commit := range redactions {
+		commits = append(commits, commit)
+	}
+
+	sort.Sort(OffsetSlice(commits))
+
+	binary.WriteUvarint(buf, len(commits))
+
+	for _, commit := range commits {
+		offsets := make([]int64, 0, len(redactions[commit]))
+
+		for offset := range redactions[commit] {
+			offsets = append(offsets, offset)
+		}
+
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+		binary.WriteInt64(buf, int64(commit))
+		binary.WriteUvarint(buf, len(offsets))
+
+		for _, offset := range offsets {
+			binary.WriteInt64(buf, offset)
+			binary.WriteUvarint(buf, len(redactions[commit][offset]))
+			buf.Write(redactions[commit][offset])
+		}
+	}
+}
+
+func readRedactions(buf *bytes.Buffer) (Redactions, error) {
+	redactions := make(Redactions)
+
+	// Snapshots taken before redactions were recorded have none.
+	if buf.Len() == 0 {
+		return redactions, nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var commit, offset int64
+		var events int64
+
+		if commit, err = binary.ReadInt64Full(buf); err != nil {
+			break
+		}
+
+		if events, err = binary.ReadUvarintMax(buf, int64(buf.Len())); err != nil {
+			break
+		}
+
+		bodies := make(map[int64][]byte, events)
+
+		for j := int64(0); j < events && err == nil; j++ {
+			var body string
+
+			if offset, err = binary.ReadInt64Full(buf); err == nil {
+				if body, err = binary.ReadStringMax(buf, int64(buf.Len())); err == nil {
+					bodies[offset] = []byte(body)
+				}
+			}
+		}
+
+		redactions[uint64(commit)] = bodies
+	}
+
+	return redactions, err
+}
+
+func (db *DB) isClosed(commit uint64) bool {
+	for _, c := range db.closed {
+		if c == commit {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type redaction struct {
+	Offset int64  `json:"offset"`
+	Body   string `json:"body"`
+}
+
+func (n *Node) redactEventsHandler(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if _, ok := n.auth.Authorize(w, req, ADMIN); !ok {
+		return
+	}
+
+	if req.Method != "POST" {
+		w.WriteHeader(404)
+		return
+	}
+
+	commit, err := strconv.ParseUint(strings.Replace(req.URL.Path, "/events/redact/", "", 1), 10, 64)
+	if err != nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	var data []*redaction
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &data)
+	}
+
+	if err != nil {
+		respond(w, Fail(w, MALFORMED_BODY))
+		return
+	}
+
+	redactions := make([]Redaction, len(data))
+
+	for i, d := range data {
+		redactions[i] = Redaction{d.Offset, []byte(d.Body)}
+	}
+
+	err = n.Redact(commit, redactions)
+
+	if err == NOT_LEADER_ERROR {
+		respond(w, n.notLeader(w))
+		return
+	}
+
+	res := make(map[string]interface{})
+
+	if err != nil {
+		res = Fail(w, err)
+	} else {
+		res["redacted"] = len(redactions)
+	}
+
+	js, _ := json.MarshalIndent(res, "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRedactingEvents(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("secret"), map[string]string{"a": "b"})
+		trackevent(n, []byte("public"), map[string]string{"a": "b"})
+
+		var offset int64
+
+		n.db.Scan("a", "b", 0, "", func(e *stream.Event) bool {
+			offset = e.Offset
+			return string(e.Data) != "secret"
+		})
+
+		if err := n.Redact(n.db.current, []Redaction{{offset, nil}}); err != REDACTING_UNKNOWN_STREAM {
+			t.Errorf("Expected error redacting open stream, found: %v", err)
+		}
+
+		if err := n.Redact(1, []Redaction{{offset, []byte("[x]")}}); err != nil {
+			t.Errorf("Unexpected error redacting events: %v", err)
+		}
+
+		// Applied as events are read, rather than once the stream's rewritten.
+		found := make([]string, 0)
+
+		n.db.Scan("a", "b", 0, "", func(e *stream.Event) bool {
+			found = append(found, string(e.Data))
+			return true
+		})
+
+		if !reflect.DeepEqual(found, []string{"public", "[x]"}) {
+			t.Errorf("Incorrect redacted results. Wanted: %v, found: %v", []string{"public", "[x]"}, found)
+		}
+
+		if err := n.Redact(1, []Redaction{{offset + 1, nil}}); err != stream.INVALID_REDACTION {
+			t.Errorf("Expected an offset which isn't an event to be refused, found: %v", err)
+		}
+
+		snapshot, _ := n.db.Save()
+
+		os.MkdirAll("tmp/restored", 0755)
+		restored, _ := NewDb("tmp/restored")
+
+		if err := restored.Recovery(snapshot); err != nil {
+			t.Fatalf("Unable to recover snapshot: %v", err)
+		}
+
+		if body, ok := restored.redactions[1][offset]; !ok || string(body) != "[x]" {
+			t.Errorf("Expected redactions to be restored from snapshots, found: %v", restored.redactions)
+		}
+	})
+}
@@ -0,0 +1,427 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_REPLICATION_INTERVAL = 10 * time.Second
+	// Written to a standby's data path once the streams it lists are.
+	REPLICA_MANIFEST = "replica.json"
+)
+
+var NOT_A_REPLICA = errors.New("No replica manifest to promote from")
+
+// ReplicaManifest records what has been shipped to a standby: the
+// primary's metadata as of the last sync, and the digest of each
+// closed stream shipped, so streams rewritten since (by compression or
+// redaction) are shipped again.
+type ReplicaManifest struct {
+	Metadata Metadata          `json:"metadata"`
+	Digests  map[uint64]string `json:"digests"`
+	Synced   time.Time         `json:"synced"`
+}
+
+// How far a standby is behind its primary. Events reach the standby
+// once the stream they're written to is closed, so it's behind by at
+// least the primary's current stream.
+type ReplicationStatus struct {
+	// The most recent stream closed on the primary, and shipped.
+	Primary uint64 `json:"primary"`
+	Shipped uint64 `json:"shipped"`
+	// Closed streams waiting to be shipped, and how long the oldest
+	// of them has been waiting.
+	Pending    int       `json:"pending"`
+	LagSeconds float64   `json:"lag_seconds"`
+	LastSync   time.Time `json:"last_sync,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Replicator asynchronously ships the closed streams of a primary
+// cluster to a standby's data path, for disaster recovery. Once
+// shipped, a node started on the path with promotion enabled starts a
+// new cluster from them. See Node.SetPromote.
+type Replicator struct {
+	nodes  []string
+	path   string
+	reader *Reader
+	logger Logger
+	mutex  sync.Mutex
+	status ReplicationStatus
+	// When each pending stream was first seen on the primary.
+	pending map[uint64]time.Time
+}
+
+// Replicates the cluster of the given nodes (as http://host:port)
+// to the standby data path.
+func NewReplicator(nodes []string, path string) (*Replicator, error) {
+	if err := os.MkdirAll(filepath.Join(path, "stream"), 0744); err != nil {
+		return nil, fmt.Errorf("Unable to create stream directory: %v", err)
+	}
+
+	return &Replicator{
+		nodes:   nodes,
+		path:    path,
+		reader:  NewReader(filepath.Join(path, "stream")),
+		logger:  stdLogger{},
+		pending: make(map[uint64]time.Time),
+	}, nil
+}
+
+// Sets the API key sent to the primary's nodes.
+func (r *Replicator) SetApiKey(key string) {
+	r.reader.SetApiKey(key)
+}
+
+// Limits the bytes per second of streams shipped, 0 for no limit.
+func (r *Replicator) SetIOLimit(bytesPerSecond int64) error {
+	if bytesPerSecond < 0 {
+		return INVALID_IO_LIMIT
+	}
+
+	r.reader.throttle = NewThrottle(bytesPerSecond)
+	return nil
+}
+
+func (r *Replicator) SetLogger(logger Logger) {
+	r.logger = logger
+}
+
+func (r *Replicator) Status() ReplicationStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status := r.status
+
+	for _, seen := range r.pending {
+		if lag := time.Since(seen).Seconds(); lag > status.LagSeconds {
+			status.LagSeconds = lag
+		}
+	}
+
+	return status
+}
+
+// Syncs every interval until stopped.
+func (r *Replicator) Run(interval time.Duration, stop <-chan struct{}) {
+	for {
+		if err := r.Sync(); err != nil {
+			r.logger.Println("REPLICATE: Sync failed:", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Ships each closed stream the standby is missing, or has an outdated
+// copy of, then records the primary's metadata in the manifest. The
+// manifest only lists streams once they're shipped, so a standby is
+// always promoted from a consistent set of streams.
+func (r *Replicator) Sync() (err error) {
+	defer func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if err != nil {
+			r.status.LastError = err.Error()
+		} else {
+			r.status.LastError = ""
+			r.status.LastSync = time.Now()
+		}
+	}()
+
+	meta, _, err := clusterMetadata(r.reader.router, r.reader.apiKey, r.reader.retry.TLS, r.nodes)
+	if err != nil {
+		return err
+	}
+
+	digests, err := closedDigests(r.reader.retry.httpClient(), r.reader.apiKey, append(r.nodes, meta.Peers...))
+	if err != nil {
+		return err
+	}
+
+	manifest, err := ReadManifest(r.path)
+	if os.IsNotExist(err) {
+		manifest, err = &ReplicaManifest{Digests: make(map[uint64]string)}, nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	shipped := make(map[uint64]string)
+	failed := make([]uint64, 0)
+
+	for _, commit := range meta.Closed {
+		r.wait(commit)
+
+		digest, ok := digests[commit]
+		if !ok {
+			failed = append(failed, commit)
+			continue
+		}
+
+		if _, err := os.Stat(r.reader.Path(commit)); err == nil && manifest.Digests[commit] == digest {
+			shipped[commit] = digest
+			r.shipped(commit)
+			continue
+		}
+
+		if err := r.ship(append(r.nodes, meta.Peers...), commit); err != nil {
+			r.logger.Println("REPLICATE: Unable to ship stream", commit, err)
+			failed = append(failed, commit)
+			continue
+		}
+
+		shipped[commit] = digest
+		r.shipped(commit)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%v: %v", MISSING_STREAMS, failed)
+	}
+
+	if err = writeManifest(r.path, &ReplicaManifest{*meta, shipped, time.Now()}); err != nil {
+		return err
+	}
+
+	// Streams merged away by compression are no longer listed.
+	for commit := range manifest.Digests {
+		if _, ok := shipped[commit]; !ok {
+			os.Remove(r.reader.Path(commit))
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.pending = make(map[uint64]time.Time)
+	r.status.Pending = 0
+	r.status.Primary, r.status.Shipped = 0, 0
+
+	if len(meta.Closed) > 0 {
+		r.status.Primary = meta.Closed[len(meta.Closed)-1]
+		r.status.Shipped = r.status.Primary
+	}
+
+	return nil
+}
+
+// The digest of each closed stream, from the inventory of the
+// nodes holding a copy.
+func closedDigests(client *http.Client, key string, nodes []string) (map[uint64]string, error) {
+	copies, err := closedCopies(client, key, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	digests := make(map[uint64]string, len(copies))
+
+	for commit, holders := range copies {
+		for _, digest := range holders {
+			digests[commit] = digest
+		}
+	}
+
+	return digests, nil
+}
+
+// The digest of each node's copy of each closed stream, by commit then
+// node, from the inventory of the nodes. Copies of the same stream may
+// differ in layout, so digests are only comparable with the node's.
+func closedCopies(client *http.Client, key string, nodes []string) (map[uint64]map[string]string, error) {
+	var err error
+
+	copies := make(map[uint64]map[string]string)
+	responded := false
+
+	for _, node := range uniqueStrings(nodes) {
+		var streams []StreamInfo
+
+		if streams, err = inventoryOf(client, key, node); err != nil {
+			continue
+		}
+
+		responded = true
+
+		for _, info := range streams {
+			if info.State == STREAM_CLOSED && info.Location == LOCATION_LOCAL {
+				if copies[info.Commit] == nil {
+					copies[info.Commit] = make(map[string]string)
+				}
+
+				copies[info.Commit][node] = info.Digest
+			}
+		}
+	}
+
+	if !responded {
+		return nil, err
+	}
+
+	return copies, nil
+}
+
+func (r *Replicator) ship(nodes []string, commit uint64) error {
+	reader := r.reader
+
+	s, err := recoverStream(reader.retry, reader.router, reader.throttle, reader.apiKey, uniqueStrings(nodes), reader.dir, filepath.Base(reader.Path(commit)))
+	if err != nil {
+		return err
+	}
+
+	r.logger.Println("REPLICATE: Shipped stream", commit)
+
+	return s.Close()
+}
+
+// Notes the stream as pending, if it's not been seen before.
+func (r *Replicator) wait(commit uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.pending[commit]; !ok {
+		r.pending[commit] = time.Now()
+	}
+
+	r.status.Pending = len(r.pending)
+}
+
+func (r *Replicator) shipped(commit uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.pending, commit)
+	r.status.Pending = len(r.pending)
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reads the manifest of what's been shipped to the standby data path.
+func ReadManifest(path string) (*ReplicaManifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(path, REPLICA_MANIFEST))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ReplicaManifest
+
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// Written to a temporary file then renamed into place, so a standby
+// never reads half a manifest.
+func writeManifest(path string, manifest *ReplicaManifest) error {
+	js, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(path, REPLICA_MANIFEST+".tmp")
+
+	if err := ioutil.WriteFile(tmp, js, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(path, REPLICA_MANIFEST))
+}
+
+// Starts a new cluster from a standby's shipped streams, when the node
+// creates one, rather than an empty cluster. See promoteReplica.
+func (n *Node) SetPromote(promote bool) {
+	n.promote = promote
+}
+
+// Adopts the closed streams and metadata shipped to the node's data
+// path. As the new cluster's raft log starts again from the beginning,
+// its commits are offset by the primary's, so the streams it writes
+// follow those shipped, and existing continuations still refer to them.
+func promoteReplica(n *Node) error {
+	manifest, err := ReadManifest(n.path)
+	if os.IsNotExist(err) {
+		return NOT_A_REPLICA
+	}
+
+	if err != nil {
+		return err
+	}
+
+	n.db.logger.Println("Promoting replica synced at", manifest.Synced, "with", len(manifest.Metadata.Closed), "closed streams")
+
+	_, err = n.raft.Do(NewPromoteCommand(manifest.Metadata, time.Now().UnixNano()))
+	return err
+}
+
+// Offsets the DB's commits by the primary's current one, adopting its
+// closed streams and what's been deleted or rewritten in them.
+func (db *DB) promote(index, term uint64, meta Metadata) error {
+	db.base = meta.Current
+
+	for _, commit := range meta.Closed {
+		db.addClosed(commit)
+	}
+
+	if meta.Tombstones != nil {
+		db.tombstones = meta.Tombstones
+	}
+
+	if meta.Deleted != nil {
+		db.deleted = meta.Deleted
+	}
+
+	if meta.Redactions != nil {
+		db.redactions = meta.Redactions
+	}
+
+	if meta.Rewrites != nil {
+		db.rewrites = meta.Rewrites
+	}
+
+	db.revision = meta.Revision
+	db.MostRecent = meta.MostRecent
+
+	return db.Rotate(db.commit(index), term)
+}
+
+// The commit of the raft log index, offset for promoted replicas.
+func (db *DB) commit(index uint64) uint64 {
+	return db.base + index
+}
@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestReplicate(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(30)
+
+		for _, body := range []string{"a", "b", "c"} {
+			trackevent(n, []byte(body), map[string]string{"a": "b"})
+		}
+
+		primary := httptest.NewServer(n.mux)
+		defer primary.Close()
+
+		r, err := NewReplicator([]string{primary.URL}, "tmp/standby")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.Sync(); err != nil {
+			t.Fatalf("Expected to sync, found: %v", err)
+		}
+
+		manifest, err := ReadManifest("tmp/standby")
+		if err != nil || !reflect.DeepEqual(manifest.Metadata.Closed, n.db.closed) {
+			t.Fatalf("Incorrect manifest: %v %v", manifest, err)
+		}
+
+		for _, commit := range n.db.closed {
+			if _, err := os.Stat(r.reader.Path(commit)); err != nil {
+				t.Errorf("Expected stream %v to be shipped, found: %v", commit, err)
+			}
+		}
+
+		status := r.Status()
+		if status.Pending != 0 || status.Shipped != n.db.closed[len(n.db.closed)-1] || status.LastError != "" {
+			t.Errorf("Incorrect status: %#v", status)
+		}
+
+		standby, _ := NewNode("tmp/standby", "localhost", 3002)
+		standby.SetPromote(true)
+
+		if err := Connect(standby, ""); err != nil {
+			t.Fatalf("Expected to promote, found: %v", err)
+		}
+
+		defer standby.raft.Stop()
+
+		if !reflect.DeepEqual(standby.db.closed, n.db.closed) {
+			t.Errorf("Incorrect closed streams. Wanted: %v, found: %v", n.db.closed, standby.db.closed)
+		}
+
+		if standby.db.current <= n.db.current {
+			t.Errorf("Expected commits to follow the primary's %v, found: %v", n.db.current, standby.db.current)
+		}
+
+		if err := standby.Event([]byte("d"), "", map[string]string{"a": "b"}); err != nil {
+			t.Fatal(err)
+		}
+
+		found := []string{}
+
+		standby.db.Scan("a", "b", 0, "", func(e *stream.Event) bool {
+			found = append(found, string(e.Data))
+			return true
+		})
+
+		if !reflect.DeepEqual(found, []string{"d", "b", "a"}) {
+			t.Errorf("Incorrect events. Wanted: [d b a], found: %v", found)
+		}
+	})
+}
@@ -1,15 +1,19 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/rpc"
 )
 
 type RestServer struct {
-	listen string
-	stop   chan bool
+	listen   string
+	stop     chan bool
+	server   *http.Server
+	listener net.Listener
 }
 
 func Log(handler func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
@@ -20,34 +24,91 @@ func Log(handler func(w http.ResponseWriter, r *http.Request)) func(w http.Respo
 }
 
 func NewRestServer(n *Node) *RestServer {
-	rpc.RegisterName("Node", &NodeRPC{n})
-	rpc.HandleHTTP()
+	server := rpc.NewServer()
+	server.RegisterName("Node", &NodeRPC{n})
+	n.HandleFunc(rpc.DefaultRPCPath, n.peersOrAdmins(server.ServeHTTP))
 
-	n.HandleFunc("/cluster/status", Log(n.clusterStatusHandler))
-	n.HandleFunc("/cluster/remove/", Log(n.clusterRemoveHandler))
+	n.route("/cluster/status", Log(n.clusterStatusHandler))
+	n.route("/cluster/remove/", Log(n.clusterRemoveHandler))
+	n.route("/cluster/readonly", Log(n.clusterReadOnlyHandler))
+	n.route("/cluster/drain", Log(n.clusterDrainHandler))
+	n.route("/cluster/quotas", Log(n.clusterQuotasHandler))
+	n.route("/cluster/backup", Log(n.clusterBackupHandler))
+	n.route("/cluster/snapshot", Log(n.clusterSnapshotHandler))
 
-	n.HandleFunc("/events", n.eventHandler)
-	n.HandleFunc("/events/meta", Log(n.metaEventsHandler))
-	n.HandleFunc("/events/offset", Log(n.offsetEventsHandler))
-	n.HandleFunc("/events/compress/", Log(n.compressEventsHandler))
+	n.route("/metrics", n.metricsHandler)
 
-	n.HandleFunc("/stream/", Log(n.recoverHandler))
+	n.route("/events", n.drained(n.eventHandler))
+	n.route("/events/meta", Log(n.drained(n.metaEventsHandler)))
+	n.route("/events/offset", Log(n.drained(n.offsetEventsHandler)))
+	n.route("/events/at", Log(n.drained(n.atEventsHandler)))
+	n.route("/events/batch", Log(n.drained(n.batchEventsHandler)))
+	n.route("/events/compress/", Log(n.drained(n.compressEventsHandler)))
+	n.route("/events/delete", Log(n.drained(n.deleteEventsHandler)))
+	n.route("/events/redact/", Log(n.drained(n.redactEventsHandler)))
+	n.route("/events/soft_delete", Log(n.drained(n.softDeleteEventsHandler)))
+	n.route("/events/split/", Log(n.drained(n.splitEventsHandler)))
+
+	n.route("/stream/", Log(n.peersOnly(n.drained(n.recoverHandler))))
+	n.route("/streams", Log(n.peersOnly(n.drained(n.inventoryHandler))))
+	n.route("/streams/", Log(n.peersOnly(n.drained(n.streamHandler))))
+	n.route("/stats", Log(n.drained(n.statsHandler)))
 
 	n.HandleFunc("/", Log(func(w http.ResponseWriter, req *http.Request) {
 		w.WriteHeader(404)
 	}))
 
+	listen := fmt.Sprintf("%s:%d", n.host, n.port)
+
+	// Serving adds HTTP/2 to the config's protocols, which the node's
+	// clients share.
+	config := n.tls.Clone()
+
 	return &RestServer{
-		fmt.Sprintf("%s:%d", n.host, n.port),
+		listen,
 		make(chan bool),
+		&http.Server{Addr: listen, Handler: n.mux, TLSConfig: config},
+		n.listener,
 	}
 }
 
-func (s *RestServer) Start() error {
-	log.Println("Listening at:", "http://"+s.listen)
+// Serves the handler at the pattern, and at it within API_VERSION.
+func (n *Node) route(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	n.HandleFunc(pattern, handler)
+	n.HandleFunc(API_VERSION+pattern, Versioned(handler))
+}
+
+func (s *RestServer) Start() (err error) {
+	// Certificates are already loaded into the config.
+	if s.server.TLSConfig != nil {
+		log.Println("Listening at:", "https://"+s.listen)
+
+		if s.listener != nil {
+			err = s.server.ServeTLS(s.listener, "", "")
+		} else {
+			err = s.server.ListenAndServeTLS("", "")
+		}
+	} else {
+		log.Println("Listening at:", "http://"+s.listen)
 
-	return http.ListenAndServe(s.listen, nil)
+		if s.listener != nil {
+			err = s.server.Serve(s.listener)
+		} else {
+			err = s.server.ListenAndServe()
+		}
+	}
+
+	if err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
 }
 
 func (s *RestServer) Stop() {
 }
+
+// Stops listening, and waits for requests being served to finish.
+func (s *RestServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,164 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var NOT_A_BACKUP = errors.New("No backup manifest found, expected a tar from /cluster/backup")
+var RESTORING_OVER_DATA = errors.New("The data path already holds streams, restore to an empty one")
+
+var BACKUP_STREAM = regexp.MustCompile(`^events\.\d{24}\.stream$`)
+
+// Unpacks a backup into the data path, as a standby a node started
+// with promotion enabled starts a new cluster from. See Node.SetPromote.
+//
+// Each stream's header and footer is checked, and the backup's open
+// stream is closed as it's restored, so the events it held are kept
+// and the new cluster's streams follow it. Events written to the node
+// backed up after it was taken are lost.
+func RestoreBackup(r io.Reader, path string) (*BackupManifest, error) {
+	dir := filepath.Join(path, "stream")
+
+	if err := os.MkdirAll(dir, 0744); err != nil {
+		return nil, fmt.Errorf("Unable to create stream directory: %v", err)
+	}
+
+	if existing, _ := filepath.Glob(filepath.Join(dir, "*.stream")); len(existing) > 0 {
+		return nil, RESTORING_OVER_DATA
+	}
+
+	var manifest *BackupManifest
+	var err error
+
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case header.Name == BACKUP_MANIFEST:
+			manifest = &BackupManifest{}
+
+			if err = json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, err
+			}
+		case BACKUP_STREAM.MatchString(header.Name):
+			if err = restoreStream(tr, filepath.Join(dir, header.Name)); err != nil {
+				return nil, fmt.Errorf("%v: %v", header.Name, err)
+			}
+		}
+	}
+
+	if manifest == nil {
+		return nil, NOT_A_BACKUP
+	}
+
+	meta := manifest.Metadata
+	reader := NewReader(dir)
+
+	for _, commit := range meta.Closed {
+		if err = checkRestored(reader.Path(commit), true); err != nil {
+			return nil, err
+		}
+	}
+
+	// Closed now, so the new cluster adopts it with the others.
+	if manifest.Offset > 0 {
+		if err = checkRestored(reader.Path(meta.Current), false); err != nil {
+			return nil, err
+		}
+
+		meta.Closed = append(meta.Closed, meta.Current)
+	}
+
+	err = writeManifest(path, &ReplicaManifest{
+		Metadata: meta,
+		Digests:  make(map[uint64]string),
+		Synced:   manifest.Created,
+	})
+
+	return manifest, err
+}
+
+// Written to a temporary file then renamed into place, so a partly
+// written stream is never mistaken for one restored.
+func restoreStream(r io.Reader, path string) error {
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, r); err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+	}
+
+	return err
+}
+
+// Checks the restored stream's header, and its footer if it should be
+// closed, closing it otherwise.
+func checkRestored(path string, closed bool) error {
+	name := filepath.Base(path)
+
+	header := make([]byte, stream.HEADER_LENGTH)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%v: missing from the backup", name)
+	} else if err != nil {
+		return err
+	}
+
+	_, err = io.ReadFull(f, header)
+	f.Close()
+
+	if err != nil || string(header) != stream.MAGIC_HEADER {
+		return fmt.Errorf("%v: %v", name, stream.CORRUPTED_HEADER)
+	}
+
+	if ok, err := stream.IsClosed(path); err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	} else if closed && !ok {
+		return fmt.Errorf("%v: %v", name, stream.CORRUPTED_FOOTER)
+	}
+
+	// Reads the index of closed streams, or writes it for the open one.
+	s, err := stream.Open(path)
+	if err == nil {
+		err = s.Close()
+	}
+
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How often the leader checks for closed streams outside the retention window.
+const DEFAULT_RETENTION_INTERVAL = time.Minute
+
+const AUDIT_EXPIRE = "expire"
+
+var INVALID_RETENTION = errors.New("Retention must not be negative")
+
+// Removes closed streams once their most recent event is older than
+// the duration. Streams closed before their spans were recorded are
+// kept, as when they were written isn't known. Continuations into a
+// removed stream resume from the oldest stream kept, or end when
+// scanning in reverse.
+func WithRetention(d time.Duration) Option {
+	return func(db *DB) error {
+		if d < 0 {
+			return INVALID_RETENTION
+		}
+
+		db.RetentionDuration = d
+		return nil
+	}
+}
+
+type retainer struct {
+	mutex sync.Mutex
+	stop  chan bool
+}
+
+// Has the leader expire streams every interval until stopped, if the
+// DB has a retention window.
+func (n *Node) startRetention(interval time.Duration) {
+	if n.db.RetentionDuration == 0 {
+		return
+	}
+
+	n.retention.mutex.Lock()
+	defer n.retention.mutex.Unlock()
+
+	if n.retention.stop != nil {
+		return
+	}
+
+	n.retention.stop = make(chan bool)
+
+	go func(stop chan bool) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				n.db.supervisor.Run("retention", n.expireStreams)
+			case <-stop:
+				return
+			}
+		}
+	}(n.retention.stop)
+}
+
+func (n *Node) stopRetention() {
+	n.retention.mutex.Lock()
+	defer n.retention.mutex.Unlock()
+
+	if n.retention.stop != nil {
+		close(n.retention.stop)
+		n.retention.stop = nil
+	}
+}
+
+// Has the leader expire closed streams outside the retention window,
+// through raft, so every node removes the same streams.
+func (n *Node) expireStreams() error {
+	if n.raft == nil || n.raft.State() != "leader" || n.db.Following() {
+		return nil
+	}
+
+	commits := n.db.outsideRetention(time.Now())
+	if len(commits) == 0 {
+		return nil
+	}
+
+	_, err := n.raft.Do(NewExpireCommand(commits, time.Now().UnixNano()))
+	return err
+}
+
+// The closed streams whose most recent event is older than the window.
+func (db *DB) outsideRetention(now time.Time) []uint64 {
+	cutoff := now.Add(-db.RetentionDuration).UnixNano()
+	spans := db.spans
+	commits := make([]uint64, 0)
+
+	for _, commit := range db.closed {
+		if span, ok := spans[commit]; ok && span.Last < cutoff {
+			commits = append(commits, commit)
+		}
+	}
+
+	return commits
+}
+
+// Removes the closed streams, recording them as rewritten at the given
+// commit so continuations into them can be mapped past them.
+func (db *DB) expire(index uint64, commits []uint64) {
+	expiring := make(map[uint64]bool, len(commits))
+	rewritten := make(map[uint64]Rewrite, len(commits))
+
+	for _, commit := range commits {
+		expiring[commit] = true
+		rewritten[commit] = Rewrite{Expired: true}
+	}
+
+	closed := make([]uint64, 0, len(db.closed))
+
+	for _, commit := range db.closed {
+		if !expiring[commit] {
+			closed = append(closed, commit)
+		}
+	}
+
+	spans := db.copySpans()
+	deleted := make(Deletions, len(db.deleted))
+	redactions := make(Redactions, len(db.redactions))
+	placement := make(Placement, len(db.placement))
+
+	for commit, offsets := range db.deleted {
+		if !expiring[commit] {
+			deleted[commit] = offsets
+		}
+	}
+
+	for commit, bodies := range db.redactions {
+		if !expiring[commit] {
+			redactions[commit] = bodies
+		}
+	}
+
+	for commit, holders := range db.placement {
+		if !expiring[commit] {
+			placement[commit] = holders
+		}
+	}
+
+	for commit := range expiring {
+		delete(spans, commit)
+	}
+
+	db.closed, db.spans, db.deleted, db.redactions, db.placement = closed, spans, deleted, redactions, placement
+	db.forgetUniques(expiring)
+	db.rewrite(index, rewritten)
+
+	for _, commit := range commits {
+		path := db.reader.Path(commit)
+
+		db.reader.replaceStream(commit, func() error {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				db.logger.Println("RETENTION: Unable to remove expired stream:", err)
+			}
+			return nil
+		})
+	}
+
+	db.logger.Println("RETENTION: Expired streams", commits)
+}
+
+// Rewrites of expired streams are recorded after the rest, as they
+// were added to snapshots later.
+func writeExpired(buf *bytes.Buffer, rewrites Rewrites) {
+	commits := make([]uint64, 0)
+
+	for commit, rw := range rewrites {
+		if rw.Expired {
+			commits = append(commits, commit)
+		}
+	}
+
+	sort.Sort(OffsetSlice(commits))
+
+	binary.WriteUvarint(buf, len(commits))
+
+	for _, commit := range commits {
+		binary.WriteInt64(buf, int64(commit))
+	}
+}
+
+func readExpired(buf *bytes.Buffer, rewrites Rewrites) error {
+	// Snapshots taken before streams expired have none.
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var commit int64
+
+		if commit, err = binary.ReadInt64Full(buf); err == nil {
+			rw := rewrites[uint64(commit)]
+			rw.Expired = true
+			rewrites[uint64(commit)] = rw
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetention(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("a"), map[string]string{"customer": "1"})
+		trackevent(n, []byte("b"), map[string]string{"customer": "1"})
+
+		oldest := n.db.closed[0]
+		continuation := n.db.reader.buildContinuation(oldest, 0)
+
+		time.Sleep(100 * time.Millisecond)
+
+		trackevent(n, []byte("c"), map[string]string{"customer": "1"})
+
+		n.db.RetentionDuration = 50 * time.Millisecond
+
+		if err := n.expireStreams(); err != nil {
+			t.Fatalf("Unable to expire streams: %v", err)
+		}
+
+		if _, err := os.Stat(n.db.reader.Path(oldest)); !os.IsNotExist(err) {
+			t.Errorf("Expected expired stream to be removed, found: %v", err)
+		}
+
+		found, _, _ := Query{Index: "customer", Value: "1"}.run(n.db)
+
+		if !reflect.DeepEqual(found, []string{"c"}) {
+			t.Errorf("Expected expired streams to be left out. Wanted: [c], found: %v", found)
+		}
+
+		iterated := make([]string, 0)
+
+		_, err := n.db.Iterate(0, continuation, func(e *stream.Event) bool {
+			iterated = append(iterated, string(e.Data))
+			return true
+		})
+
+		if err != nil || !reflect.DeepEqual(iterated, []string{"c"}) {
+			t.Errorf("Expected continuation into an expired stream to resume after it. Wanted: [c], found: %v %v", iterated, err)
+		}
+
+		snapshot, _ := n.db.Save()
+
+		os.MkdirAll("tmp/recovered", 0755)
+		db, _ := NewDb("tmp/recovered")
+
+		if err := db.Recovery(snapshot); err != nil || !db.rewrites[oldest].Expired {
+			t.Errorf("Expected expired streams to be recovered from snapshot, found: %v %v", db.rewrites[oldest], err)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy controls how requests to other nodes are retried.
+type RetryPolicy struct {
+	// Total number of attempts made, including the first.
+	MaxAttempts int
+	// Delay before the first retry, doubled on each following retry.
+	Backoff time.Duration
+	// Upper bound on the delay between retries.
+	MaxBackoff time.Duration
+	// Fraction of each delay which is randomized, so clients
+	// retrying at the same moment spread themselves out.
+	Jitter float64
+	// Time limit for each individual attempt. Zero means no limit.
+	Timeout time.Duration
+	// Used for requests to peers over TLS, e.g. for the certificate they
+	// require of clients. See LoadTLSConfig.
+	TLS *tls.Config
+}
+
+// Used for client calls and RPCs between nodes.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+	Jitter:      0.2,
+	Timeout:     30 * time.Second,
+}
+
+// Used when fetching closed stream files from peers, which can be large.
+var DefaultFetchRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     time.Second,
+	MaxBackoff:  30 * time.Second,
+	Jitter:      0.2,
+	Timeout:     10 * time.Minute,
+}
+
+// Used when taking snapshots fails, before the node is marked degraded.
+var DefaultSnapshotRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     time.Second,
+	MaxBackoff:  time.Minute,
+	Jitter:      0.2,
+}
+
+// Used when moving streams to where they're placed fails, as nodes
+// they're placed on may take a while to fetch their copies.
+var DefaultRebalanceRetryPolicy = RetryPolicy{
+	MaxAttempts: 10,
+	Backoff:     5 * time.Second,
+	MaxBackoff:  5 * time.Minute,
+	Jitter:      0.2,
+}
+
+// Errors which retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Errors which should be retried straight away, such
+// as being redirected to the current leader.
+type immediateError struct {
+	err error
+}
+
+func (e *immediateError) Error() string {
+	return e.err.Error()
+}
+
+// Stops the policy from retrying the error.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err}
+}
+
+// Retries the error without waiting out the backoff.
+func immediate(err error) error {
+	return &immediateError{err}
+}
+
+// Stops the policy retrying the error, for requests made by packages
+// other than this one, such as client.
+func Permanent(err error) error {
+	return permanent(err)
+}
+
+// Retries the error without waiting out the backoff, as when redirected
+// to the leader, for requests made by packages other than this one.
+func Immediate(err error) error {
+	return immediate(err)
+}
+
+// Whether the request failed before it was sent, as the node couldn't
+// be connected to. Writes without ids may have been written if they
+// failed any later, so are only retried if this is true.
+func Unsent(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+
+	e, ok := err.(*net.OpError)
+	return ok && e.Op == "dial"
+}
+
+// Calls f until it succeeds, returns a permanent error, or
+// we run out of attempts. The last error is returned.
+func (p RetryPolicy) Do(f func() error) (err error) {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = f()
+
+		switch e := err.(type) {
+		case nil:
+			return nil
+		case *permanentError:
+			return e.err
+		case *immediateError:
+			err = e.err
+			continue
+		}
+
+		if attempt < attempts {
+			time.Sleep(p.delay(attempt))
+		}
+	}
+
+	return err
+}
+
+// Returns how long to wait after the given failed attempt.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.Backoff
+
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || delay < p.MaxBackoff); i++ {
+		delay *= 2
+	}
+
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		spread := float64(delay) * p.Jitter
+		delay += time.Duration(spread * (2*rand.Float64() - 1))
+	}
+
+	return delay
+}
+
+// An http client which times out each request according to the policy.
+func (p RetryPolicy) httpClient() *http.Client {
+	client := &http.Client{Timeout: p.Timeout}
+
+	if p.TLS != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = p.TLS.Clone()
+		client.Transport = transport
+	}
+
+	return client
+}
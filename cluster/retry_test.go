@@ -0,0 +1,119 @@
+package cluster
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyAttempts(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	var tests = []struct {
+		err      error
+		attempts int
+	}{
+		{nil, 1},
+		{errors.New("refused"), 3},
+		{permanent(errors.New("conflict")), 1},
+	}
+
+	for i, test := range tests {
+		attempts := 0
+
+		err := policy.Do(func() error {
+			attempts += 1
+			return test.err
+		})
+
+		if attempts != test.attempts {
+			t.Errorf("Case #%v: wanted %v attempts, found: %v", i, test.attempts, attempts)
+		}
+
+		if (err == nil) != (test.err == nil) {
+			t.Errorf("Case #%v: unexpected error: %v", i, err)
+		}
+
+		if _, ok := err.(*permanentError); ok {
+			t.Errorf("Case #%v: permanent errors should be unwrapped: %v", i, err)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	var tests = []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+
+	for i, test := range tests {
+		if delay := policy.delay(test.attempt); delay != test.delay {
+			t.Errorf("Case #%v: wanted delay %v, found: %v", i, test.delay, delay)
+		}
+	}
+
+	policy.Jitter = 0.5
+
+	for i := 0; i < 100; i++ {
+		if delay := policy.delay(1); delay < 50*time.Millisecond || delay > 150*time.Millisecond {
+			t.Errorf("Jittered delay out of range: %v", delay)
+		}
+	}
+}
+
+func TestClientOnlyRetriesWritesWithIds(t *testing.T) {
+	var requests int32
+
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(500)
+	}))
+
+	defer leader.Close()
+
+	c := &Client{
+		Nodes:  []string{leader.URL},
+		Leader: leader.URL,
+		Retry:  RetryPolicy{MaxAttempts: 3},
+		conns:  newPool(1),
+		client: http.DefaultClient,
+	}
+
+	indexes := []map[string]string{{"a": "b"}}
+
+	var tests = []struct {
+		write    func() error
+		requests int32
+	}{
+		{func() error { return c.Events([][]byte{[]byte("a")}, indexes) }, 1},
+		{func() error { return c.EventsWithIds([][]byte{[]byte("a")}, nil, indexes, []string{"1"}) }, 3},
+		{func() error { return c.Delete("a", "b") }, 3},
+	}
+
+	for i, test := range tests {
+		atomic.StoreInt32(&requests, 0)
+
+		if err := test.write(); err == nil || atomic.LoadInt32(&requests) != test.requests {
+			t.Errorf("Case #%v: wanted %v requests, found: %v %v", i, test.requests, requests, err)
+		}
+	}
+
+	l, _ := net.Listen("tcp", "localhost:0")
+	l.Close()
+
+	if _, err := http.Get("http://" + l.Addr().String()); !Unsent(err) {
+		t.Errorf("Expected a refused connection to be unsent: %v", err)
+	}
+}
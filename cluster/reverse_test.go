@@ -0,0 +1,46 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIterateReverse(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(40)
+
+		for _, body := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+			trackevent(n, []byte(body), map[string]string{"customer": body})
+		}
+
+		if len(n.db.closed) < 2 {
+			t.Fatalf("Expected events across several streams, found: %v", n.db.closed)
+		}
+
+		q := Query{Reverse: true, Limit: 3}
+		found := make([]string, 0)
+
+		for i := 0; i < 4; i++ {
+			events, continuation, err := q.run(n.db)
+			if err != nil {
+				t.Fatalf("Unable to iterate in reverse: %v", err)
+			}
+
+			found = append(found, events...)
+
+			if continuation == "" {
+				break
+			}
+
+			q.Continuation = continuation
+		}
+
+		if !reflect.DeepEqual(found, []string{"g", "f", "e", "d", "c", "b", "a"}) {
+			t.Errorf("Incorrect reverse results. Wanted: [g f e d c b a], found: %v", found)
+		}
+
+		if q.forward() {
+			t.Errorf("Reverse iteration should be paginated as a scan")
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package cluster
+
+import (
+	"github.com/jrallison/raft"
+)
+
+// RotateCommand closes the current stream on every node and starts
+// a new one, regardless of how large the current stream has grown.
+type RotateCommand struct {
+	Timestamp int64 `json:"timestamp"`
+}
+
+func NewRotateCommand(timestamp int64) *RotateCommand {
+	return &RotateCommand{timestamp}
+}
+
+func (c *RotateCommand) CommandName() string {
+	return "rotate"
+}
+
+func (c *RotateCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	if db.ReadOnly() {
+		return new(interface{}), READ_ONLY_ERROR
+	}
+
+	index := db.commit(context.CurrentIndex())
+
+	if err := db.auditRotation(index, c.Timestamp); err != nil {
+		return new(interface{}), err
+	}
+
+	return new(interface{}), db.Rotate(index, context.CurrentTerm())
+}
@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Spread requests evenly across all healthy peers.
+	ROUND_ROBIN = "round-robin"
+	// Send requests to the peer with the fewest requests in flight.
+	LEAST_OUTSTANDING = "least-outstanding"
+	// Send requests to the peer which has been responding fastest.
+	NEAREST = "nearest"
+)
+
+var UNKNOWN_ROUTING = errors.New("Unknown routing strategy")
+
+// Router decides the order in which peers are asked to serve a
+// request, according to the configured strategy. Regardless of the
+// strategy, quarantined peers are only used as a last resort.
+type Router struct {
+	strategy    string
+	health      *PeerHealth
+	outstanding map[string]int
+	next        int
+	mutex       sync.Mutex
+}
+
+func NewRouter(strategy string, health *PeerHealth) (*Router, error) {
+	switch strategy {
+	case ROUND_ROBIN, LEAST_OUTSTANDING, NEAREST:
+	default:
+		return nil, UNKNOWN_ROUTING
+	}
+
+	return &Router{
+		strategy:    strategy,
+		health:      health,
+		outstanding: make(map[string]int),
+	}, nil
+}
+
+func (r *Router) Strategy() string {
+	return r.strategy
+}
+
+// Orders the peers by preference, most preferred first.
+func (r *Router) Order(peers []string) []string {
+	// Health ordering is by latency, which is all nearest needs.
+	ordered := r.health.Order(peers)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch r.strategy {
+	case ROUND_ROBIN:
+		if len(ordered) > 0 {
+			// Rotate on a stable ordering, so each peer gets its turn.
+			sort.Strings(ordered)
+			start := r.next % len(ordered)
+			ordered = append(ordered[start:], ordered[:start]...)
+			r.next += 1
+		}
+	case LEAST_OUTSTANDING:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return r.outstanding[ordered[i]] < r.outstanding[ordered[j]]
+		})
+	}
+
+	return ordered
+}
+
+// Marks the start of a request to the peer. The returned function must
+// be called with the request's outcome once it completes.
+func (r *Router) Begin(peer string) func(err error) {
+	start := time.Now()
+
+	r.mutex.Lock()
+	r.outstanding[peer] += 1
+	r.mutex.Unlock()
+
+	return func(err error) {
+		r.mutex.Lock()
+		r.outstanding[peer] -= 1
+		r.mutex.Unlock()
+
+		r.health.Record(peer, time.Since(start), err)
+	}
+}
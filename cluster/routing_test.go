@@ -0,0 +1,51 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoundRobinRouting(t *testing.T) {
+	r, _ := NewRouter(ROUND_ROBIN, NewPeerHealth())
+
+	peers := []string{"c", "a", "b"}
+
+	expected := [][]string{
+		{"a", "b", "c"},
+		{"b", "c", "a"},
+		{"c", "a", "b"},
+		{"a", "b", "c"},
+	}
+
+	for i, want := range expected {
+		if order := r.Order(peers); !reflect.DeepEqual(order, want) {
+			t.Errorf("Case #%v: Incorrect peer order. Wanted: %v, found: %v", i, want, order)
+		}
+	}
+}
+
+func TestLeastOutstandingRouting(t *testing.T) {
+	r, _ := NewRouter(LEAST_OUTSTANDING, NewPeerHealth())
+
+	doneA := r.Begin("a")
+	r.Begin("a")
+	doneB := r.Begin("b")
+
+	if order := r.Order([]string{"a", "b", "c"}); !reflect.DeepEqual(order, []string{"c", "b", "a"}) {
+		t.Errorf("Incorrect peer order. Wanted: %v, found: %v", []string{"c", "b", "a"}, order)
+	}
+
+	doneA(nil)
+	doneB(nil)
+	r.Begin("c")
+
+	if order := r.Order([]string{"a", "b", "c"}); order[0] != "b" {
+		t.Errorf("Peer with no outstanding requests should be first. Found: %v", order)
+	}
+}
+
+func TestUnknownRouting(t *testing.T) {
+	if _, err := NewRouter("random", NewPeerHealth()); err != UNKNOWN_ROUTING {
+		t.Errorf("Expected unknown routing error, found: %v", err)
+	}
+}
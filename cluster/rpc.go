@@ -3,9 +3,14 @@ package cluster
 import (
 	"github.com/jrallison/raft"
 
+	"bufio"
+	"crypto/tls"
 	"errors"
+	"io"
+	"net"
+	"net/http"
 	"net/rpc"
-	"strings"
+	"time"
 )
 
 type NodeRPC struct {
@@ -24,23 +29,49 @@ func (n *NodeRPC) State(args NoArgs, reply *NodeState) error {
 }
 
 func (n *NodeRPC) JoinCluster(command raft.DefaultJoinCommand, reply *NoResponse) error {
-	return executeOnLeader(n.node, "Node.JoinCluster", &command)
+	return executeOnLeader(n.node, "Node.JoinCluster", &command, AUDIT_JOIN, map[string]interface{}{
+		"name": command.Name,
+		"uri":  command.ConnectionString,
+	})
+}
+
+// Joins the node to the cluster once its identity has been checked.
+// See JoinRequest.
+func (n *NodeRPC) Join(req JoinRequest, reply *NoResponse) error {
+	if n.node.raft.State() == "leader" {
+		return n.node.join(req)
+	}
+
+	if node, ok := n.node.raft.Peers()[n.node.raft.Leader()]; ok {
+		host := hostOf(node.ConnectionString)
+		return executeOn(n.node.retry, n.node.db.reader.apiKey, host, "Node.Join", req)
+	}
+
+	return errors.New("No current leader.")
 }
 
 func (n *NodeRPC) RemoveFromCluster(command raft.DefaultLeaveCommand, reply *NoResponse) error {
-	return executeOnLeader(n.node, "Node.RemoveFromCluster", &command)
+	return executeOnLeader(n.node, "Node.RemoveFromCluster", &command, AUDIT_LEAVE, map[string]interface{}{
+		"name": command.Name,
+	})
 }
 
-func executeOnLeader(n *Node, message string, command raft.Command) (err error) {
+// Executes the command on the leader, which records the
+// action in the audit log once the command has been applied.
+func executeOnLeader(n *Node, message string, command raft.Command, action string, details map[string]interface{}) (err error) {
 	if n.raft.State() == "leader" {
-		_, err = n.raft.Do(command)
+		if _, err = n.raft.Do(command); err == nil {
+			if aerr := n.Audit(action, details); aerr != nil {
+				n.db.logger.Println("AUDIT: Failed to record", action, aerr)
+			}
+		}
 		return
 	} else {
 		leader := n.raft.Leader()
 
 		if node, ok := n.raft.Peers()[leader]; ok {
-			host := strings.Replace(node.ConnectionString, "http://", "", 1)
-			err = executeOn(host, message, command)
+			host := hostOf(node.ConnectionString)
+			err = executeOn(n.retry, n.db.reader.apiKey, host, message, command)
 			return
 		} else {
 			return errors.New("No current leader.")
@@ -48,13 +79,68 @@ func executeOnLeader(n *Node, message string, command raft.Command) (err error)
 	}
 }
 
-func executeOn(host string, message string, command raft.Command) error {
-	client, err := rpc.DialHTTP("tcp", host)
+// Calls the RPC on the host, sending the API key, if any, as peers
+// require one with the admin operation unless verifying certificates.
+func executeOn(policy RetryPolicy, key, host string, message string, args interface{}) error {
+	return policy.Do(func() error {
+		return call(host, key, message, args, policy.TLS, policy.Timeout)
+	})
+}
+
+func call(host, key string, message string, args interface{}, config *tls.Config, timeout time.Duration) error {
+	conn, err := dial(host, config, timeout)
+	if err != nil {
+		return err
+	}
+
+	client, err := dialHTTP(conn, key)
 	if err != nil {
 		return err
 	}
 
 	defer client.Close()
 
-	return client.Call(message, command, &NoResponse{})
+	done := client.Go(message, args, &NoResponse{}, nil).Done
+
+	var expired <-chan time.Time
+
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+
+	select {
+	case c := <-done:
+		if _, ok := c.Error.(rpc.ServerError); ok {
+			// The remote node received and rejected the
+			// command, sending it again won't help.
+			return permanent(c.Error)
+		}
+
+		return c.Error
+	case <-expired:
+		return errors.New("rpc timeout calling " + message + " on " + host)
+	}
+}
+
+// Same handshake as rpc.DialHTTP, over an existing connection, with
+// the API key, if any.
+func dialHTTP(conn net.Conn, key string) (*rpc.Client, error) {
+	if key != "" {
+		io.WriteString(conn, "CONNECT "+rpc.DefaultRPCPath+" HTTP/1.0\n"+API_KEY_HEADER+": "+key+"\n\n")
+	} else {
+		io.WriteString(conn, "CONNECT "+rpc.DefaultRPCPath+" HTTP/1.0\n\n")
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err == nil && resp.Status == "200 Connected to Go RPC" {
+		return rpc.NewClient(conn), nil
+	}
+
+	if err == nil {
+		err = errors.New("unexpected HTTP response: " + resp.Status)
+	}
+
+	conn.Close()
+
+	return nil, err
 }
@@ -0,0 +1,339 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema validates JSON event bodies against a subset of JSON Schema:
+// type, enum, const, required, properties, additionalProperties, items,
+// minItems, maxItems, minLength, maxLength, pattern, minimum and
+// maximum. Schemas with other keywords, such as $ref or oneOf, are
+// rejected rather than only partly enforced, though annotations such
+// as title and description are allowed.
+type Schema struct {
+	Type                 schemaTypes        `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Const                *interface{}       `json:"const"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+
+	pattern *regexp.Regexp
+}
+
+// The keywords a schema may have: those Schema enforces, and
+// annotations which don't affect validation.
+var schemaKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true, "required": true,
+	"properties": true, "additionalProperties": true, "items": true,
+	"minItems": true, "maxItems": true, "minLength": true, "maxLength": true,
+	"pattern": true, "minimum": true, "maximum": true,
+
+	"$schema": true, "$id": true, "$comment": true, "title": true,
+	"description": true, "default": true, "examples": true,
+}
+
+// The types a value may have, given as a string or an array of them.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+func ParseSchema(b []byte) (*Schema, error) {
+	var s Schema
+
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+
+	if err := checkKeywords(b); err != nil {
+		return nil, err
+	}
+
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Reads a schema for each prefix from a JSON file:
+//
+//	{
+//	  "schemas": [
+//	    {"prefix": "acme.", "schema": {"type": "object", "required": ["type"]}}
+//	  ]
+//	}
+func LoadSchemas(path string) (map[string]*Schema, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Schemas []struct {
+			Prefix string          `json:"prefix"`
+			Schema json.RawMessage `json:"schema"`
+		} `json:"schemas"`
+	}
+
+	if err = json.Unmarshal(b, &config); err != nil {
+		return nil, err
+	}
+
+	schemas := make(map[string]*Schema, len(config.Schemas))
+
+	for _, s := range config.Schemas {
+		if schemas[s.Prefix], err = ParseSchema(s.Schema); err != nil {
+			return nil, fmt.Errorf("Invalid schema for %q: %v", s.Prefix, err)
+		}
+	}
+
+	return schemas, nil
+}
+
+// Fails on the first unsupported keyword, by name, of the schema or
+// those of its properties and items.
+func checkKeywords(b []byte) error {
+	var keywords map[string]json.RawMessage
+
+	if err := json.Unmarshal(b, &keywords); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !schemaKeywords[name] {
+			return fmt.Errorf("Unsupported schema keyword: %q", name)
+		}
+	}
+
+	if items, ok := keywords["items"]; ok {
+		if err := checkKeywords(items); err != nil {
+			return err
+		}
+	}
+
+	var properties map[string]json.RawMessage
+
+	if p, ok := keywords["properties"]; ok {
+		if err := json.Unmarshal(p, &properties); err != nil {
+			return err
+		}
+	}
+
+	names = names[:0]
+	for name := range properties {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := checkKeywords(properties[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) compile() (err error) {
+	if s.Pattern != "" {
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range s.Properties {
+		if err = p.compile(); err != nil {
+			return err
+		}
+	}
+
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+
+	return nil
+}
+
+// Validates the event's body, which must be JSON.
+func (s *Schema) Validate(body []byte, indexes map[string]string) error {
+	var value interface{}
+
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("body isn't JSON: %v", err)
+	}
+
+	return s.check("body", value)
+}
+
+func (s *Schema) check(path string, value interface{}) error {
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		return fmt.Errorf("%v must be %v", path, strings.Join(s.Type, " or "))
+	}
+
+	if s.Const != nil && !reflect.DeepEqual(*s.Const, value) {
+		return fmt.Errorf("%v must be %v", path, *s.Const)
+	}
+
+	if len(s.Enum) > 0 && !contains(s.Enum, value) {
+		return fmt.Errorf("%v must be one of %v", path, s.Enum)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return s.checkObject(path, v)
+	case []interface{}:
+		return s.checkArray(path, v)
+	case string:
+		length := utf8.RuneCountInString(v)
+
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%v must be at least %d characters", path, *s.MinLength)
+		}
+
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%v must be at most %d characters", path, *s.MaxLength)
+		}
+
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fmt.Errorf("%v must match %v", path, s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%v must be at least %v", path, *s.Minimum)
+		}
+
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%v must be at most %v", path, *s.Maximum)
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) checkObject(path string, v map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			return fmt.Errorf("%v.%v is required", path, name)
+		}
+	}
+
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+
+	// Sorted, so the same event is always rejected for the same reason.
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := s.Properties[name]
+
+		if !ok && s.AdditionalProperties != nil && !*s.AdditionalProperties {
+			return fmt.Errorf("%v.%v isn't allowed", path, name)
+		}
+
+		if ok {
+			if err := property.check(path+"."+name, v[name]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) checkArray(path string, v []interface{}) error {
+	if s.MinItems != nil && len(v) < *s.MinItems {
+		return fmt.Errorf("%v must have at least %d items", path, *s.MinItems)
+	}
+
+	if s.MaxItems != nil && len(v) > *s.MaxItems {
+		return fmt.Errorf("%v must have at most %d items", path, *s.MaxItems)
+	}
+
+	if s.Items != nil {
+		for i, item := range v {
+			if err := s.Items.check(fmt.Sprintf("%v[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t schemaTypes) matches(value interface{}) bool {
+	for _, name := range t {
+		switch v := value.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && v == float64(int64(v))) {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func contains(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,74 @@
+package cluster
+
+import (
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"type": "object",
+		"required": ["type", "tags"],
+		"additionalProperties": false,
+		"properties": {
+			"type": {"enum": ["open", "click"]},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string", "pattern": "^[a-z]+$"}},
+			"count": {"type": "integer", "minimum": 0}
+		}
+	}`))
+
+	if err != nil {
+		t.Fatalf("Unable to parse schema: %v", err)
+	}
+
+	tests := []struct {
+		body  string
+		valid bool
+	}{
+		{`{"type": "open", "tags": ["a"]}`, true},
+		{`{"type": "open", "tags": [], "count": 3}`, true},
+		{`{"type": "bounce", "tags": []}`, false},
+		{`{"type": "open"}`, false},
+		{`{"type": "open", "tags": ["A"]}`, false},
+		{`{"type": "open", "tags": ["a", "b", "c"]}`, false},
+		{`{"type": "open", "tags": [], "count": 1.5}`, false},
+		{`{"type": "open", "tags": [], "count": -1}`, false},
+		{`{"type": "open", "tags": [], "other": 1}`, false},
+		{`[]`, false},
+		{`not json`, false},
+	}
+
+	for _, test := range tests {
+		err := schema.Validate([]byte(test.body), nil)
+
+		if test.valid && err != nil {
+			t.Errorf("Expected %v to be valid, found: %v", test.body, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Errorf("Expected %v to be invalid", test.body)
+		}
+	}
+}
+
+func TestUnsupportedSchemaKeywords(t *testing.T) {
+	for i, schema := range []string{
+		`{"$ref": "#/definitions/event"}`,
+		`{"oneOf": [{"type": "string"}, {"type": "number"}]}`,
+		`{"properties": {"a": {"type": "string", "format": "email"}}}`,
+		`{"items": {"anyOf": [{"type": "string"}]}}`,
+	} {
+		if _, err := ParseSchema([]byte(schema)); err == nil {
+			t.Errorf("Case #%v: Expected unsupported keyword to be rejected: %v", i, schema)
+		}
+	}
+
+	if _, err := ParseSchema([]byte(`{"title": "Event", "description": "An event", "properties": {"a": {"type": "string", "title": "A"}}}`)); err != nil {
+		t.Errorf("Expected annotations to be allowed, found: %v", err)
+	}
+}
+
+func TestInvalidSchemaPattern(t *testing.T) {
+	if _, err := ParseSchema([]byte(`{"properties": {"a": {"pattern": "("}}}`)); err == nil {
+		t.Errorf("Expected invalid pattern to be rejected")
+	}
+}
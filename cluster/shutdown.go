@@ -0,0 +1,120 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Stops the node gracefully. New requests are refused, and those being
+// served are given until the context is done to finish. The open stream
+// is then synced to disk, raft is stopped, and every stream held open
+// for reading is closed. The open stream isn't closed, so it continues
+// to be written to once the node is started again.
+//
+// Returns the context's error if requests were still being served
+// when it was done, though the node is stopped regardless.
+func (n *Node) Shutdown(ctx context.Context) (err error) {
+	n.db.logger.Println("SHUTDOWN: Stopping node")
+
+	SdNotify("STOPPING=1")
+	n.stopNotify()
+	n.drain.start()
+
+	idle := make(chan struct{})
+
+	go func() {
+		n.drain.wait()
+		close(idle)
+	}()
+
+	if n.GRPC != nil {
+		go n.GRPC.GracefulStop()
+	}
+
+	if n.Rest != nil {
+		err = n.Rest.Shutdown(ctx)
+	}
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// Ends gRPC requests still being served, should they not have finished.
+	if n.GRPC != nil {
+		n.GRPC.Stop()
+	}
+
+	if n.raft != nil && n.raft.Running() {
+		atomic.StoreInt32(&n.db.stopping, 1)
+		n.raft.Stop()
+	}
+
+	if cerr := n.db.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+
+	n.db.logger.Println("SHUTDOWN: Stopped")
+
+	return
+}
+
+// Syncs the open stream to disk, and closes every stream held open
+// for reading, for when the node is stopping.
+func (db *DB) Close() (err error) {
+	db.disk.Stop()
+
+	if db.stream != nil {
+		err = db.stream.Sync()
+	}
+
+	db.reader.Close()
+
+	return
+}
+
+// Closes every closed stream held open, so they're reopened if read again.
+func (r *Reader) Close() {
+	for _, commit := range r.closed {
+		r.mutex(commit).Lock()
+		r.forgetStream(commit)
+		r.mutex(commit).Unlock()
+	}
+}
+
+// Shuts down once SIGTERM or SIGINT is received, sending the status
+// to exit with. Exits immediately if shutdown doesn't finish in time,
+// or another signal is received while waiting for it to.
+func ShutdownOnSignal(shutdown func(context.Context) error, timeout time.Duration) <-chan int {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	exit := make(chan int, 1)
+
+	go func() {
+		log.Println("Received", <-signals, "shutting down")
+
+		go func() {
+			log.Println("Received", <-signals, "forcing shutdown")
+			os.Exit(1)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if err := shutdown(ctx); err != nil {
+			log.Println("Forced shutdown:", err)
+			os.Exit(1)
+		}
+
+		exit <- 0
+	}()
+
+	return exit
+}
@@ -0,0 +1,46 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShuttingDownNode(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("a"), map[string]string{"a": "1"})
+		trackevent(n, []byte("b"), map[string]string{"a": "1"})
+
+		found, _, _ := Query{Index: "a", Value: "1"}.run(n.db)
+
+		if len(found) != 2 || len(n.db.reader.streams) == 0 {
+			t.Fatalf("Expected closed streams to be held open, found: %v %v", found, len(n.db.reader.streams))
+		}
+
+		// A request which doesn't finish in time.
+		n.drain.begin()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		if err := n.Shutdown(ctx); err != context.DeadlineExceeded {
+			t.Errorf("Expected the shutdown deadline to be exceeded, found: %v", err)
+		}
+
+		n.drain.end()
+
+		if n.raft.Running() {
+			t.Errorf("Expected raft to be stopped")
+		}
+
+		if len(n.db.reader.streams) != 0 {
+			t.Errorf("Expected streams to be closed, found: %v", len(n.db.reader.streams))
+		}
+
+		if n.drain.begin() {
+			t.Errorf("Expected requests to be refused once shut down")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"math"
+)
+
+// The format version of signed continuations, their first byte.
+const SIGNED_CONTINUATION_VERSION = 2
+
+// Bytes of the HMAC-SHA256 kept in signed continuations.
+const CONTINUATION_SIGNATURE_LENGTH = 16
+
+var INVALID_CONTINUATION_KEY = errors.New("Continuation key must not be empty")
+var FORGED_CONTINUATION = errors.New("Continuation signature doesn't match, it was altered or signed with another key")
+var MISMATCHED_CONTINUATION = errors.New("Continuation is from a scan of another index value")
+
+// Continuation is the position a scan or iteration resumes from, and
+// the index value scanned, if any. Signed, it's an opaque token clients
+// can't forge, or use to continue a scan of another index value.
+type Continuation struct {
+	Version byte
+	Commit  uint64
+	Offset  int64
+	Epoch   uint64
+	Index   string
+	Value   string
+}
+
+// Signs continuations with the key, which every node and reader of the
+// cluster must share, so clients can't forge them. Continuations issued
+// without a signature are refused once a key is set.
+func WithContinuationKey(key []byte) Option {
+	return func(db *DB) error {
+		if len(key) == 0 {
+			return INVALID_CONTINUATION_KEY
+		}
+
+		db.reader.SetContinuationKey(key)
+		return nil
+	}
+}
+
+func (r *Reader) SetContinuationKey(key []byte) {
+	r.continuationKey = key
+}
+
+// Reads a continuation key from the file, ignoring surrounding whitespace.
+func LoadContinuationKey(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := bytes.TrimSpace(b)
+	if len(key) == 0 {
+		return nil, INVALID_CONTINUATION_KEY
+	}
+
+	return key, nil
+}
+
+// Encodes the continuation as a URL-safe base64 token, signed with the key.
+func (c Continuation) Sign(key []byte) string {
+	buf := new(bytes.Buffer)
+
+	buf.WriteByte(c.Version)
+	binary.WriteUvarint64(buf, int64(c.Commit))
+	binary.WriteVarint(buf, c.Offset)
+	binary.WriteUvarint64(buf, int64(c.Epoch))
+	binary.WriteUvarint(buf, len(c.Index))
+	buf.WriteString(c.Index)
+	binary.WriteUvarint(buf, len(c.Value))
+	buf.WriteString(c.Value)
+
+	buf.Write(continuationSignature(key, buf.Bytes()))
+
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+// Decodes a token from Continuation.Sign, checking it was signed with the key.
+func ParseContinuation(token string, key []byte) (Continuation, error) {
+	var c Continuation
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) <= CONTINUATION_SIGNATURE_LENGTH {
+		return c, MALFORMED_CONTINUATION
+	}
+
+	body, signature := b[:len(b)-CONTINUATION_SIGNATURE_LENGTH], b[len(b)-CONTINUATION_SIGNATURE_LENGTH:]
+
+	if !hmac.Equal(signature, continuationSignature(key, body)) {
+		return c, FORGED_CONTINUATION
+	}
+
+	buf := bytes.NewBuffer(body)
+
+	if c.Version, _ = buf.ReadByte(); c.Version != SIGNED_CONTINUATION_VERSION {
+		return c, MALFORMED_CONTINUATION
+	}
+
+	var commit, epoch int64
+
+	if commit, err = binary.ReadUvarintMax(buf, math.MaxInt64); err == nil {
+		if c.Offset, err = binary.ReadVarintFull(buf); err == nil {
+			epoch, err = binary.ReadUvarintMax(buf, math.MaxInt64)
+		}
+	}
+
+	if err == nil {
+		if c.Index, err = binary.ReadStringMax(buf, int64(buf.Len())); err == nil {
+			c.Value, err = binary.ReadStringMax(buf, int64(buf.Len()))
+		}
+	}
+
+	if err != nil || buf.Len() > 0 || c.Offset < 0 {
+		return c, MALFORMED_CONTINUATION
+	}
+
+	c.Commit, c.Epoch = uint64(commit), uint64(epoch)
+
+	return c, nil
+}
+
+func continuationSignature(key, body []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+
+	return mac.Sum(nil)[:CONTINUATION_SIGNATURE_LENGTH]
+}
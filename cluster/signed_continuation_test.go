@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSignedContinuations(t *testing.T) {
+	key := []byte("secret")
+
+	c := Continuation{SIGNED_CONTINUATION_VERSION, 4, 150, 8, "customer", "1"}
+	token := c.Sign(key)
+
+	if strings.Contains(token, "150") || strings.Contains(token, "customer") {
+		t.Errorf("Expected an opaque token, found: %v", token)
+	}
+
+	if found, err := ParseContinuation(token, key); err != nil || !reflect.DeepEqual(found, c) {
+		t.Errorf("Incorrect continuation. Wanted: %+v, found: %+v %v", c, found, err)
+	}
+
+	if _, err := ParseContinuation(token, []byte("other")); err != FORGED_CONTINUATION {
+		t.Errorf("Expected a token signed with another key to be refused, found: %v", err)
+	}
+
+	forged := Continuation{SIGNED_CONTINUATION_VERSION, 4, 0, 8, "customer", "1"}.Sign([]byte("other"))
+
+	if _, err := ParseContinuation(forged, key); err != FORGED_CONTINUATION {
+		t.Errorf("Expected a forged token to be refused, found: %v", err)
+	}
+
+	for _, malformed := range []string{"", "v1:4:150:8", "!!", Continuation{Version: 3, Commit: 4}.Sign(key)} {
+		if _, err := ParseContinuation(malformed, key); err != MALFORMED_CONTINUATION {
+			t.Errorf("Expected %q to be malformed, found: %v", malformed, err)
+		}
+	}
+}
+
+func TestScanSignedContinuations(t *testing.T) {
+	r := NewReader("tmp")
+	r.closed = []uint64{1, 4}
+	r.current = 12
+	r.SetRewrites(Rewrites{4: {Epoch: 8}})
+	r.SetContinuationKey([]byte("secret"))
+
+	token := r.buildScanContinuation(4, 150, "customer", "1")
+
+	if commit, offset, err := r.parseScanContinuation(token, "customer", "1", true); err != nil || commit != 4 || offset != 150 {
+		t.Errorf("Incorrect parse of signed continuation. Wanted: 4 150, found: %v %v %v", commit, offset, err)
+	}
+
+	if _, _, err := r.parseScanContinuation(token, "customer", "2", true); err != MISMATCHED_CONTINUATION {
+		t.Errorf("Expected continuation of another index value to be refused, found: %v", err)
+	}
+
+	// Iterations aren't of any index value, so continue from scans' positions.
+	if commit, offset, err := r.parseContinuation(token, false); err != nil || commit != 4 || offset != 150 {
+		t.Errorf("Incorrect parse of signed continuation. Wanted: 4 150, found: %v %v %v", commit, offset, err)
+	}
+
+	if _, _, err := r.parseContinuation("v1:4:150:8", true); err != MALFORMED_CONTINUATION {
+		t.Errorf("Expected unsigned continuation to be refused once signing, found: %v", err)
+	}
+}
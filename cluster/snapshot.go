@@ -0,0 +1,114 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const SNAPSHOT_MAGIC = "ESDBsnapshot"
+
+// The version of the snapshot payload written by Save. Increase it
+// whenever fields are added to the payload, and SNAPSHOT_COMPATIBLE
+// whenever a change means older versions mustn't read the payload.
+// Fields can be appended without changing SNAPSHOT_COMPATIBLE, as
+// older versions ignore any they don't know about.
+//
+// Version 2 appended placement, identities, the base commit, quota
+// totals, expiries, deduplicated ids, uniques and redactions. Version 3
+// prefixes the index name of each unique with its length, which older
+// versions would mistake for values never written, and writes the last
+// timestamp of each span as a varint from its first.
+const (
+	SNAPSHOT_VERSION    = 3
+	SNAPSHOT_COMPATIBLE = 3
+)
+
+var CORRUPTED_SNAPSHOT = errors.New("corrupted snapshot, its digest doesn't match its payload")
+var TRUNCATED_SNAPSHOT = errors.New("corrupted snapshot, payload is shorter than its length")
+
+// Returned when recovering a snapshot saved by a newer version which
+// this version can't read.
+type SnapshotVersionError struct {
+	Version    int64
+	Compatible int64
+}
+
+func (e *SnapshotVersionError) Error() string {
+	return fmt.Sprintf("snapshot version %d requires version %d, this is version %d", e.Version, e.Compatible, SNAPSHOT_VERSION)
+}
+
+// Whether the payload, saved by the version, holds the fields the
+// since version added. Those saved before snapshots were versioned end
+// after any field, so hold the next if there's more to read.
+func savedFields(buf *bytes.Buffer, version, since int64) bool {
+	if version == 0 {
+		return buf.Len() > 0
+	}
+
+	return version >= since
+}
+
+// Wraps the payload in an envelope which records its version and
+// digest, in the following byte format:
+// [bytes(12):magic][uvarint:version][uvarint:compatible][int64:length][bytes(32):sha256][bytes(length):payload]
+func encodeSnapshot(payload []byte) []byte {
+	buf := bytes.NewBuffer([]byte(SNAPSHOT_MAGIC))
+
+	digest := sha256.Sum256(payload)
+
+	binary.WriteUvarint(buf, SNAPSHOT_VERSION)
+	binary.WriteUvarint(buf, SNAPSHOT_COMPATIBLE)
+	binary.WriteInt64(buf, int64(len(payload)))
+	buf.Write(digest[:])
+	buf.Write(payload)
+
+	return buf.Bytes()
+}
+
+// Validates the envelope, returning the payload and the version which
+// saved it. Snapshots saved before they were versioned have no
+// envelope, and are returned as is, as version 0.
+func decodeSnapshot(b []byte) ([]byte, int64, error) {
+	if !bytes.HasPrefix(b, []byte(SNAPSHOT_MAGIC)) {
+		return b, 0, nil
+	}
+
+	buf := bytes.NewBuffer(b[len(SNAPSHOT_MAGIC):])
+
+	version, err := binary.ReadUvarintMax(buf, math.MaxInt64)
+	if err != nil {
+		return nil, 0, TRUNCATED_SNAPSHOT
+	}
+
+	compatible, err := binary.ReadUvarintMax(buf, math.MaxInt64)
+	if err != nil {
+		return nil, 0, TRUNCATED_SNAPSHOT
+	}
+
+	if compatible > SNAPSHOT_VERSION {
+		return nil, 0, &SnapshotVersionError{version, compatible}
+	}
+
+	length, err := binary.ReadInt64Full(buf)
+	if err != nil {
+		return nil, 0, TRUNCATED_SNAPSHOT
+	}
+
+	digest, err := binary.ReadBytesMax(buf, sha256.Size, sha256.Size)
+	if err != nil || length < 0 || length > int64(buf.Len()) {
+		return nil, 0, TRUNCATED_SNAPSHOT
+	}
+
+	payload := buf.Next(int(length))
+
+	if sum := sha256.Sum256(payload); !bytes.Equal(sum[:], digest) {
+		return nil, 0, CORRUPTED_SNAPSHOT
+	}
+
+	return payload, version, nil
+}
@@ -0,0 +1,29 @@
+package cluster
+
+import (
+	"github.com/jrallison/raft"
+)
+
+// SnapshotCommand has every node take a raft snapshot as it's applied,
+// as rotating does, so no commands are applied while it's sized and
+// each node's log is compacted to the same index.
+type SnapshotCommand struct {
+	Timestamp int64 `json:"timestamp"`
+}
+
+func NewSnapshotCommand(timestamp int64) *SnapshotCommand {
+	return &SnapshotCommand{timestamp}
+}
+
+func (c *SnapshotCommand) CommandName() string {
+	return "snapshot"
+}
+
+func (c *SnapshotCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	db.snapshot(context.CurrentIndex(), context.CurrentTerm())
+
+	return new(interface{}), nil
+}
@@ -0,0 +1,177 @@
+package cluster
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// How often the leader checks whether a snapshot's due under the
+// DB's snapshot policy.
+const DEFAULT_SNAPSHOT_POLICY_INTERVAL = time.Second
+
+var INVALID_SNAPSHOT_POLICY = errors.New("Snapshot interval must not be negative")
+
+// SnapshotStatus reports the node's most recent raft snapshot. Running
+// is set until it's written, or the supervisor gives up retrying it,
+// when Error is set.
+type SnapshotStatus struct {
+	Index     uint64    `json:"index"`
+	Term      uint64    `json:"term"`
+	Started   time.Time `json:"started"`
+	Completed time.Time `json:"completed"`
+	Running   bool      `json:"running"`
+	Error     string    `json:"error,omitempty"`
+
+	// The raft index it was taken at, before the snapshot buffer.
+	applied uint64
+}
+
+type snapshots struct {
+	status SnapshotStatus
+	mutex  sync.Mutex
+}
+
+type snapshotter struct {
+	mutex sync.Mutex
+	stop  chan bool
+}
+
+// Has the leader snapshot every node once entries commands have been
+// applied since the last snapshot, or once interval has passed
+// since then if any have, as well as whenever a stream's rotated.
+// Either may be 0 to snapshot only on rotation or when asked to.
+func WithSnapshotPolicy(entries uint64, interval time.Duration) Option {
+	return func(db *DB) error {
+		if interval < 0 {
+			return INVALID_SNAPSHOT_POLICY
+		}
+
+		db.snapshotEntries, db.snapshotInterval = entries, interval
+		return nil
+	}
+}
+
+// Has every node take a raft snapshot, through raft, so its log is
+// compacted without waiting for a stream to rotate.
+func (n *Node) TakeSnapshot() (err error) {
+	if n.raft == nil {
+		return errors.New("Raft not yet initialized")
+	}
+
+	if n.raft.State() == "leader" {
+		_, err = n.raft.Do(NewSnapshotCommand(time.Now().UnixNano()))
+	} else {
+		err = NOT_LEADER_ERROR
+	}
+
+	return
+}
+
+func (n *Node) SnapshotStatus() SnapshotStatus {
+	return n.db.snapshotStatus()
+}
+
+// Has the leader check for snapshots due every interval until the
+// node's stopped, if the DB has a snapshot policy.
+func (n *Node) startSnapshotPolicy(interval time.Duration) {
+	if n.db.snapshotEntries == 0 && n.db.snapshotInterval == 0 {
+		return
+	}
+
+	n.snapshotPolicy.mutex.Lock()
+	defer n.snapshotPolicy.mutex.Unlock()
+
+	if n.snapshotPolicy.stop != nil {
+		return
+	}
+
+	n.snapshotPolicy.stop = make(chan bool)
+
+	go func(stop chan bool) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Snapshots taken before the node started aren't recorded.
+		started := time.Now()
+
+		for {
+			select {
+			case <-ticker.C:
+				if n.snapshotDue(started) {
+					n.db.supervisor.Run("snapshot policy", n.TakeSnapshot)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(n.snapshotPolicy.stop)
+}
+
+func (n *Node) stopSnapshotPolicy() {
+	n.snapshotPolicy.mutex.Lock()
+	defer n.snapshotPolicy.mutex.Unlock()
+
+	if n.snapshotPolicy.stop != nil {
+		close(n.snapshotPolicy.stop)
+		n.snapshotPolicy.stop = nil
+	}
+}
+
+// Whether the leader should snapshot the cluster under the DB's
+// policy. Nothing's due while a snapshot's still being written.
+func (n *Node) snapshotDue(started time.Time) bool {
+	if n.raft == nil || n.raft.State() != "leader" {
+		return false
+	}
+
+	status := n.db.snapshotStatus()
+	applied := n.raft.CommitIndex() - status.applied
+
+	if status.Running || applied == 0 {
+		return false
+	}
+
+	if status.Started.After(started) {
+		started = status.Started
+	}
+
+	if entries := n.db.snapshotEntries; entries > 0 && applied >= entries {
+		return true
+	}
+
+	return n.db.snapshotInterval > 0 && time.Since(started) >= n.db.snapshotInterval
+}
+
+func (db *DB) snapshotStatus() SnapshotStatus {
+	db.snapshots.mutex.Lock()
+	defer db.snapshots.mutex.Unlock()
+
+	return db.snapshots.status
+}
+
+func (db *DB) snapshotStarted(applied, index, term uint64) {
+	db.snapshots.mutex.Lock()
+	defer db.snapshots.mutex.Unlock()
+
+	db.snapshots.status = SnapshotStatus{
+		Index:   index,
+		Term:    term,
+		Started: time.Now().UTC(),
+		Running: true,
+		applied: applied,
+	}
+}
+
+func (db *DB) snapshotFinished(err error) {
+	db.snapshots.mutex.Lock()
+	defer db.snapshots.mutex.Unlock()
+
+	db.snapshots.status.Running = false
+
+	if err != nil {
+		db.snapshots.status.Error = err.Error()
+	} else {
+		db.snapshots.status.Completed = time.Now().UTC()
+	}
+}
@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSnapshotPolicy(t *testing.T) {
+	withNode(func(n *Node) {
+		// Counting the commands applied as the node started.
+		n.db.snapshotEntries = n.raft.CommitIndex() + 3
+		started := time.Now()
+
+		trackevent(n, []byte("a"), map[string]string{"a": "1"})
+
+		if n.snapshotDue(started) {
+			t.Errorf("Expected no snapshot to be due after %d commands", n.raft.CommitIndex())
+		}
+
+		trackevent(n, []byte("b"), map[string]string{"a": "1"})
+		trackevent(n, []byte("c"), map[string]string{"a": "1"})
+
+		if !n.snapshotDue(started) {
+			t.Errorf("Expected a snapshot to be due after %d commands", n.raft.CommitIndex())
+		}
+
+		n.db.snapshotEntries = 0
+		n.db.snapshotInterval = time.Millisecond
+
+		time.Sleep(2 * time.Millisecond)
+
+		if !n.snapshotDue(started) {
+			t.Errorf("Expected a snapshot to be due after %v", n.db.snapshotInterval)
+		}
+	})
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	withNode(func(n *Node) {
+		trackevent(n, []byte("a"), map[string]string{"a": "1"})
+
+		w := httptest.NewRecorder()
+		n.clusterSnapshotHandler(w, httptest.NewRequest("POST", "/cluster/snapshot", nil))
+
+		var status SnapshotStatus
+		json.NewDecoder(w.Body).Decode(&status)
+
+		if w.Code != 200 || status.Started.IsZero() {
+			t.Fatalf("Expected a snapshot to be started, found: %v %+v", w.Code, status)
+		}
+
+		for deadline := time.Now().Add(time.Second); n.SnapshotStatus().Running && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+
+		if status = n.SnapshotStatus(); status.Running || status.Completed.IsZero() || status.Error != "" {
+			t.Errorf("Expected the snapshot to complete, found: %+v", status)
+		}
+
+		if n.snapshotDue(time.Now()) {
+			t.Errorf("Expected no snapshot to be due without a policy")
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRecovery(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	db, _ := NewDb("tmp")
+	db.closed = []uint64{2, 3}
+	db.MostRecent = 12345
+
+	b, _ := db.Save()
+
+	if !bytes.HasPrefix(b, []byte(SNAPSHOT_MAGIC)) {
+		t.Errorf("Expected a versioned snapshot, found: %q", b)
+	}
+
+	recovered, _ := NewDb("tmp")
+
+	if err := recovered.Recovery(b); err != nil {
+		t.Fatalf("Error recovering snapshot: %v", err)
+	}
+
+	if !reflect.DeepEqual(recovered.closed, db.closed) || recovered.MostRecent != db.MostRecent {
+		t.Errorf("Incorrect recovery. Wanted: %v %v, found: %v %v", db.closed, db.MostRecent, recovered.closed, recovered.MostRecent)
+	}
+
+	// Snapshots saved before they were versioned are just the payload.
+	payload, _, _ := decodeSnapshot(b)
+	legacy, _ := NewDb("tmp")
+
+	if err := legacy.Recovery(payload); err != nil || !reflect.DeepEqual(legacy.closed, db.closed) {
+		t.Errorf("Expected unversioned snapshot to be recovered, found: %v %v", legacy.closed, err)
+	}
+}
+
+func TestSnapshotValidation(t *testing.T) {
+	payload := []byte("payload")
+	b := encodeSnapshot(payload)
+
+	corrupted := append([]byte{}, b...)
+	corrupted[len(corrupted)-1] ^= 1
+
+	newer := bytes.NewBuffer([]byte(SNAPSHOT_MAGIC))
+	newer.Write([]byte{SNAPSHOT_VERSION + 1, SNAPSHOT_VERSION + 1})
+
+	// Newer compatible snapshots can have fields appended to the payload.
+	compatible := encodeSnapshot(append(payload, "new field"...))
+
+	// Those saved by version 1 are still read.
+	older := append([]byte(SNAPSHOT_MAGIC), 1, 1)
+	older = append(older, b[len(SNAPSHOT_MAGIC)+2:]...)
+
+	tests := []struct {
+		snapshot []byte
+		payload  []byte
+		version  int64
+		err      error
+	}{
+		{b, payload, SNAPSHOT_VERSION, nil},
+		{corrupted, nil, 0, CORRUPTED_SNAPSHOT},
+		{b[:len(b)-1], nil, 0, TRUNCATED_SNAPSHOT},
+		{b[:len(SNAPSHOT_MAGIC)+4], nil, 0, TRUNCATED_SNAPSHOT},
+		{compatible, []byte("payloadnew field"), SNAPSHOT_VERSION, nil},
+		{older, payload, 1, nil},
+		{payload, payload, 0, nil},
+	}
+
+	for i, test := range tests {
+		if found, version, err := decodeSnapshot(test.snapshot); !reflect.DeepEqual(found, test.payload) || version != test.version || err != test.err {
+			t.Errorf("Case #%v: Wanted: %q %v %v, found: %q %v %v", i, test.payload, test.version, test.err, found, version, err)
+		}
+	}
+
+	if _, _, err := decodeSnapshot(newer.Bytes()); err == nil {
+		t.Errorf("Expected incompatible snapshot to be rejected")
+	} else if e, ok := err.(*SnapshotVersionError); !ok || e.Compatible != SNAPSHOT_VERSION+1 {
+		t.Errorf("Expected snapshot version error, found: %v", err)
+	}
+}
+
+func TestSnapshotsAreDeterministic(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	db, _ := NewDb("tmp")
+	db.tombstones = Tombstones{"a:1": {1, 10}, "b:2": {3, 20}, "c:3": {5, 30}}
+	db.deleted = Deletions{1: {10: true, 20: true, 30: true}, 3: {40: true}, 5: {50: true}}
+	db.rewrites = Rewrites{1: {Epoch: 1}, 3: {Epoch: 2, Into: 1}, 5: {Epoch: 3}}
+	db.spans = Spans{1: {10, 20}, 3: {30, 40}, 5: {50, 60}}
+	db.recent.Add(map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}, 10)
+
+	first, _ := db.Save()
+
+	for i := 0; i < 20; i++ {
+		if b, _ := db.Save(); !bytes.Equal(b, first) {
+			t.Fatalf("Expected the same state to save the same snapshot")
+		}
+	}
+}
+
+func TestRecoveringOlderVersions(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	// Every field of version 1, then bytes a version 2 field would read.
+	payload := new(bytes.Buffer)
+	binary.WriteInt64(payload, 0)
+	binary.WriteInt64(payload, 12345)
+
+	for i := 0; i < 3; i++ {
+		binary.WriteUvarint(payload, 0)
+	}
+
+	binary.WriteInt64(payload, 7)
+	binary.WriteBool(payload, false)
+
+	for i := 0; i < 3; i++ {
+		binary.WriteUvarint(payload, 0)
+	}
+
+	payload.WriteString("later")
+
+	digest := sha256.Sum256(payload.Bytes())
+	b := bytes.NewBuffer(append([]byte(SNAPSHOT_MAGIC), 1, 1))
+	binary.WriteInt64(b, int64(payload.Len()))
+	b.Write(digest[:])
+	b.Write(payload.Bytes())
+
+	db, _ := NewDb("tmp")
+
+	if err := db.Recovery(b.Bytes()); err != nil || db.revision != 7 || db.MostRecent != 12345 || len(db.placement) != 0 {
+		t.Errorf("Expected only version 1's fields to be read, found: %v %v %v %v", db.revision, db.MostRecent, db.placement, err)
+	}
+}
@@ -0,0 +1,153 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+	"github.com/customerio/esdb/stream"
+	"github.com/jrallison/raft"
+
+	"bytes"
+	"sort"
+)
+
+// EventId identifies a single event by the stream it was
+// written to and its offset within that stream.
+type EventId struct {
+	Commit uint64 `json:"commit"`
+	Offset int64  `json:"offset"`
+}
+
+// Deletions is the set of individually deleted events, keyed by
+// stream commit then offset. Like Tombstones, it's shared with
+// readers scanning concurrently, so is replaced rather than modified.
+type Deletions map[uint64]map[int64]bool
+
+func (d Deletions) Hides(commit uint64, e *stream.Event) bool {
+	return d[commit][e.Offset]
+}
+
+type SoftDeleteCommand struct {
+	Events []EventId `json:"events"`
+}
+
+func NewSoftDeleteCommand(events []EventId) *SoftDeleteCommand {
+	return &SoftDeleteCommand{events}
+}
+
+func (c *SoftDeleteCommand) CommandName() string {
+	return "soft_delete"
+}
+
+func (c *SoftDeleteCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	if db.ReadOnly() {
+		return new(interface{}), READ_ONLY_ERROR
+	}
+
+	db.SoftDelete(db.commit(context.CurrentIndex()), c.Events)
+
+	return new(interface{}), nil
+}
+
+// Hides the events from scans immediately. They're
+// physically removed when their streams are compressed.
+func (db *DB) SoftDelete(commit uint64, events []EventId) {
+	deleted := make(Deletions, len(db.deleted))
+
+	for commit, offsets := range db.deleted {
+		deleted[commit] = offsets
+	}
+
+	for _, id := range events {
+		offsets := make(map[int64]bool, len(deleted[id.Commit])+1)
+
+		for offset := range deleted[id.Commit] {
+			offsets[offset] = true
+		}
+
+		offsets[id.Offset] = true
+		deleted[id.Commit] = offsets
+	}
+
+	db.deleted = deleted
+	db.revision = commit
+}
+
+// Compressed streams no longer contain their deleted events.
+func (db *DB) compressDeletions(start, stop uint64) {
+	deleted := make(Deletions, len(db.deleted))
+
+	for commit, offsets := range db.deleted {
+		if commit < start || commit > stop {
+			deleted[commit] = offsets
+		}
+	}
+
+	db.deleted = deleted
+}
+
+// Whether the event, read from the stream starting at the given
+// commit, has been deleted by index value or individually.
+func hidden(tombs Tombstones, deleted Deletions, commit uint64, e *stream.Event, now int64) bool {
+	return deleted.Hides(commit, e) || tombs.Hides(commit, e) || expired(e, now)
+}
+
+func writeDeletions(buf *bytes.Buffer, deleted Deletions) {
+	commits := make([]uint64, 0, len(deleted))
+	for commit := range deleted {
+		commits = append(commits, commit)
+	}
+
+	sort.Sort(OffsetSlice(commits))
+
+	binary.WriteUvarint(buf, len(commits))
+
+	for _, commit := range commits {
+		offsets := make([]int64, 0, len(deleted[commit]))
+		for offset := range deleted[commit] {
+			offsets = append(offsets, offset)
+		}
+
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+		binary.WriteInt64(buf, int64(commit))
+		binary.WriteUvarint(buf, len(offsets))
+
+		for _, offset := range offsets {
+			binary.WriteInt64(buf, offset)
+		}
+	}
+}
+
+func readDeletions(buf *bytes.Buffer) (Deletions, error) {
+	deleted := make(Deletions)
+
+	// Snapshots taken before soft deletes were supported have none.
+	if buf.Len() == 0 {
+		return deleted, nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var commit, num, offset int64
+
+		if commit, err = binary.ReadInt64Full(buf); err != nil {
+			break
+		}
+
+		offsets := make(map[int64]bool)
+
+		num, err = binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+		for j := int64(0); j < num && err == nil; j++ {
+			offset, err = binary.ReadInt64Full(buf)
+			offsets[offset] = true
+		}
+
+		deleted[uint64(commit)] = offsets
+	}
+
+	return deleted, err
+}
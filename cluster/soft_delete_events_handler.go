@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+func (n *Node) softDeleteEventsHandler(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Events are identified by position rather than index,
+	// so only unrestricted roles can delete them.
+	if role, ok := n.auth.Authorize(w, req, WRITE); !ok {
+		return
+	} else if !role.Allows("", "") {
+		Deny(w, FORBIDDEN)
+		return
+	}
+
+	if req.Method != "POST" {
+		w.WriteHeader(404)
+		return
+	}
+
+	var events []EventId
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &events)
+	}
+
+	if err != nil {
+		respond(w, Fail(w, MALFORMED_BODY))
+		return
+	}
+
+	err = n.SoftDelete(events)
+
+	if err == NOT_LEADER_ERROR {
+		respond(w, n.notLeader(w))
+		return
+	}
+
+	res := make(map[string]interface{})
+
+	if err != nil {
+		res = Fail(w, err)
+	} else {
+		res["deleted"] = len(events)
+	}
+
+	js, _ := json.MarshalIndent(res, "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,183 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"sort"
+)
+
+// Span is the range of timestamps of the events written to a stream.
+// Streams without a span were closed before spans were recorded.
+type Span struct {
+	First int64 `json:"first"`
+	Last  int64 `json:"last"`
+}
+
+// Spans of closed streams, keyed by commit. They're replaced
+// rather than modified, so can be read while being updated.
+type Spans map[uint64]Span
+
+func (s Span) empty() bool {
+	return s.First == 0 && s.Last == 0
+}
+
+func (s Span) add(timestamp int64) Span {
+	if s.empty() || timestamp < s.First {
+		s.First = timestamp
+	}
+
+	if timestamp > s.Last {
+		s.Last = timestamp
+	}
+
+	return s
+}
+
+func (s Span) merge(other Span) Span {
+	if other.empty() {
+		return s
+	}
+
+	return s.add(other.First).add(other.Last)
+}
+
+// Returns a continuation to iterate from the first event written at
+// or after the timestamp. Spans are kept per stream, so iteration
+// starts from the beginning of the earliest stream which may contain
+// such events, and can include some written shortly before it.
+func (db *DB) ContinuationAt(timestamp int64) string {
+	db.refreshReader()
+
+	// Nothing written since, so resume from the end.
+	if timestamp > db.MostRecent && db.stream != nil {
+		return db.reader.buildContinuation(db.current, db.stream.Offset())
+	}
+
+	spans := db.spans
+	commit := db.reader.Next(0)
+
+	// Stops at the first stream which may contain such events, as
+	// later streams can hold events written before them.
+	for c := commit; c > 0 && c != db.current; c = db.reader.Next(c) {
+		span, ok := spans[c]
+		if !ok || span.Last >= timestamp {
+			break
+		}
+
+		commit = db.reader.Next(c)
+	}
+
+	return db.reader.buildContinuation(commit, 0)
+}
+
+// Records the span of the current stream as it's closed.
+func (db *DB) closeSpan(commit uint64) {
+	spans := db.copySpans()
+
+	if !db.span.empty() {
+		spans[commit] = db.span
+	}
+
+	db.spans = spans
+	db.span = Span{}
+}
+
+func (db *DB) compressSpans(start, stop uint64) {
+	spans := db.copySpans()
+	merged := Span{}
+
+	for commit, span := range db.spans {
+		if commit >= start && commit <= stop {
+			merged = merged.merge(span)
+			delete(spans, commit)
+		}
+	}
+
+	if !merged.empty() {
+		spans[start] = merged
+	}
+
+	db.spans = spans
+}
+
+// Each piece may hold events from anywhere in the original stream.
+func (db *DB) splitSpans(commit uint64, pieces int) {
+	span, ok := db.spans[commit]
+	if !ok {
+		return
+	}
+
+	spans := db.copySpans()
+
+	for i := 0; i < pieces; i++ {
+		spans[commit+uint64(i)] = span
+	}
+
+	db.spans = spans
+}
+
+func (db *DB) copySpans() Spans {
+	spans := make(Spans, len(db.spans))
+
+	for commit, span := range db.spans {
+		spans[commit] = span
+	}
+
+	return spans
+}
+
+// [uvarint:count]([int64:commit][int64:first][varint:last-first])...
+// Snapshots before version 3 wrote the last timestamp as an int64.
+func writeSpans(buf *bytes.Buffer, spans Spans) {
+	commits := make([]uint64, 0, len(spans))
+	for commit := range spans {
+		commits = append(commits, commit)
+	}
+
+	sort.Sort(OffsetSlice(commits))
+
+	binary.WriteUvarint(buf, len(commits))
+
+	for _, commit := range commits {
+		span := spans[commit]
+
+		binary.WriteInt64(buf, int64(commit))
+		binary.WriteInt64(buf, span.First)
+		binary.WriteVarint(buf, span.Last-span.First)
+	}
+}
+
+func readSpans(buf *bytes.Buffer, version int64) (Spans, error) {
+	spans := make(Spans)
+
+	// Snapshots taken before spans were recorded have none.
+	if buf.Len() == 0 {
+		return spans, nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var commit int64
+		var span Span
+
+		if commit, err = binary.ReadInt64Full(buf); err != nil {
+			break
+		}
+
+		if span.First, err = binary.ReadInt64Full(buf); err != nil {
+			break
+		}
+
+		if version < 3 {
+			span.Last, err = binary.ReadInt64Full(buf)
+		} else if span.Last, err = binary.ReadVarintFull(buf); err == nil {
+			span.Last += span.First
+		}
+
+		spans[uint64(commit)] = span
+	}
+
+	return spans, err
+}
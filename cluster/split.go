@@ -0,0 +1,272 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+	"github.com/jrallison/raft"
+
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+var SPLITTING_UNKNOWN_STREAM = errors.New("Only closed streams can be split")
+var TOO_MANY_SPLITS = errors.New("Not enough commits before the next stream to name every piece")
+var SPLIT_OUTDATED = errors.New("Events were deleted from the stream since the split was planned")
+
+// SplitCommand rewrites a closed stream into several smaller ones. The
+// leader plans the split, so every node splits at the same events and
+// agrees on where deleted events end up, even those which haven't
+// fetched the stream yet. Pieces are named by consecutive commits from
+// the original, so the first piece replaces it.
+type SplitCommand struct {
+	Commit     uint64                    `json:"commit"`
+	Length     int64                     `json:"length"`
+	Boundaries []int64                   `json:"boundaries"`
+	Moved      map[int64]stream.Position `json:"moved,omitempty"`
+	Timestamp  int64                     `json:"timestamp"`
+}
+
+func NewSplitCommand(commit uint64, length int64, boundaries []int64, moved map[int64]stream.Position, timestamp int64) *SplitCommand {
+	return &SplitCommand{
+		Commit:     commit,
+		Length:     length,
+		Boundaries: boundaries,
+		Moved:      moved,
+		Timestamp:  timestamp,
+	}
+}
+
+func (c *SplitCommand) CommandName() string {
+	return "split"
+}
+
+func (c *SplitCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	index := db.commit(context.CurrentIndex())
+
+	if err := db.Split(index, c.Commit, c.Length, c.Boundaries, c.Moved); err != nil {
+		return new(interface{}), err
+	}
+
+	err := db.audit(index, AUDIT_SPLIT, map[string]interface{}{
+		"commit": c.Commit,
+		"pieces": len(c.Boundaries),
+	}, c.Timestamp)
+
+	return new(interface{}), err
+}
+
+// Plans splitting the closed stream into pieces of roughly size bytes.
+// The stream is fetched from a peer first if needed.
+func (db *DB) planSplit(commit uint64, size int64) (*SplitCommand, error) {
+	if !db.isClosed(commit) {
+		return nil, SPLITTING_UNKNOWN_STREAM
+	}
+
+	if _, err := db.retrieveStream(commit, true); err != nil {
+		return nil, err
+	}
+
+	path := db.reader.Path(commit)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	boundaries, moved, err := stream.PlanSplit(path, size, db.splitOffsets(commit))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSplitCommand(commit, info.Size(), boundaries, moved, time.Now().UnixNano()), nil
+}
+
+// Splits the closed stream at the given boundaries, then registers the
+// pieces. Nodes with a copy of the stream rewrite it in the background,
+// any others fetch the pieces from peers when they're needed.
+func (db *DB) Split(index, commit uint64, length int64, boundaries []int64, moved map[int64]stream.Position) error {
+	if !db.isClosed(commit) {
+		return SPLITTING_UNKNOWN_STREAM
+	}
+
+	db.refreshReader()
+
+	if uint64(len(boundaries)) > db.reader.Next(commit)-commit {
+		return TOO_MANY_SPLITS
+	}
+
+	for _, offset := range db.splitOffsets(commit) {
+		if _, ok := moved[offset]; !ok {
+			return SPLIT_OUTDATED
+		}
+	}
+
+	if len(boundaries) < 2 {
+		return nil
+	}
+
+	piece := func(i int) uint64 {
+		return commit + uint64(i)
+	}
+
+	path := db.reader.Path(commit)
+
+	if info, err := os.Stat(path); err == nil && info.Size() == length {
+		db.splitStream(commit, boundaries)
+	} else if err == nil {
+		// Fetched from a peer which had already split it, so
+		// it's only the first piece. Fetch it again when needed.
+		db.reader.replaceStream(commit, func() error {
+			return os.Remove(path)
+		})
+	}
+
+	// Replaced rather than sorted in place, as readers share it.
+	closed := append([]uint64{}, db.closed...)
+
+	for i := 1; i < len(boundaries); i++ {
+		closed = append(closed, piece(i))
+	}
+
+	sort.Sort(OffsetSlice(closed))
+	db.closed = closed
+
+	rewritten := map[uint64]Rewrite{commit: {Boundaries: boundaries}}
+
+	for i := 1; i < len(boundaries); i++ {
+		rewritten[piece(i)] = Rewrite{}
+	}
+
+	db.splitTombstones(commit, moved)
+	db.splitDeletions(commit, moved)
+	db.splitRedactions(commit, moved)
+	db.splitSpans(commit, len(boundaries))
+	// Which piece each value moved to isn't known, so they're kept
+	// until the newest is no longer retained.
+	db.moveUniques(map[uint64]uint64{commit: piece(len(boundaries) - 1)})
+	db.rewrite(index, rewritten)
+
+	return nil
+}
+
+// Splits the node's copy of the stream in the background, so applying
+// the command doesn't hold up the raft log. The pieces' locks are held
+// until it's finished, so reads of them wait for it. If it fails, the
+// first piece is fetched again from peers, rather than serving every
+// piece's events from the original.
+func (db *DB) splitStream(commit uint64, boundaries []int64) {
+	piece := func(i int) uint64 {
+		return commit + uint64(i)
+	}
+
+	for i := range boundaries {
+		db.reader.mutex(piece(i)).Lock()
+		db.reader.forgetStream(piece(i))
+	}
+
+	path := db.reader.Path(commit)
+	peers := db.peerConnectionStrings()
+
+	go func() {
+		err := db.supervisor.Run("split", func() error {
+			start := time.Now()
+
+			err := stream.Split(path, boundaries, func(i int) string {
+				os.Remove(db.reader.splitpath(piece(i)))
+				return db.reader.splitpath(piece(i))
+			})
+
+			for i := len(boundaries) - 1; i >= 0 && err == nil; i-- {
+				err = os.Rename(db.reader.splitpath(piece(i)), db.reader.Path(piece(i)))
+			}
+
+			if err != nil {
+				return err
+			}
+
+			db.logger.Println("STREAM: Split", commit, "into", len(boundaries), "in", time.Since(start))
+			return nil
+		})
+
+		for i := range boundaries {
+			db.reader.mutex(piece(i)).Unlock()
+		}
+
+		if err != nil {
+			db.logger.Println("STREAM: Unable to split", commit, err)
+			db.supervisor.Go("split", func() error {
+				return db.reader.refetchStream(peers, commit)
+			})
+		}
+	}()
+}
+
+// Offsets within the stream which tombstones, soft deletes and
+// redactions refer to.
+func (db *DB) splitOffsets(commit uint64) []int64 {
+	offsets := make([]int64, 0)
+
+	for _, tomb := range db.tombstones {
+		if tomb.Commit == commit {
+			offsets = append(offsets, tomb.Offset)
+		}
+	}
+
+	for offset := range db.deleted[commit] {
+		offsets = append(offsets, offset)
+	}
+
+	for offset := range db.redactions[commit] {
+		offsets = append(offsets, offset)
+	}
+
+	return offsets
+}
+
+func (db *DB) splitTombstones(commit uint64, moved map[int64]stream.Position) {
+	tombstones := make(Tombstones, len(db.tombstones))
+
+	for key, tomb := range db.tombstones {
+		if tomb.Commit == commit {
+			p := moved[tomb.Offset]
+			tomb = Tombstone{commit + uint64(p.Piece), p.Offset}
+
+			// Past the last event, so hides the whole piece.
+			if p.Offset < 0 {
+				tomb.Offset = math.MaxInt64
+			}
+		}
+
+		tombstones[key] = tomb
+	}
+
+	db.tombstones = tombstones
+}
+
+func (db *DB) splitDeletions(commit uint64, moved map[int64]stream.Position) {
+	deleted := make(Deletions, len(db.deleted))
+
+	for c, offsets := range db.deleted {
+		if c != commit {
+			deleted[c] = offsets
+		}
+	}
+
+	for offset := range db.deleted[commit] {
+		p := moved[offset]
+		piece := commit + uint64(p.Piece)
+
+		if deleted[piece] == nil {
+			deleted[piece] = make(map[int64]bool)
+		}
+
+		deleted[piece][p.Offset] = true
+	}
+
+	db.deleted = deleted
+}
@@ -0,0 +1,51 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func (n *Node) splitEventsHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body.Close()
+
+	if _, ok := n.auth.Authorize(w, req, ADMIN); !ok {
+		return
+	}
+
+	if req.Method != "POST" {
+		w.WriteHeader(404)
+		return
+	}
+
+	commit, err := strconv.ParseUint(strings.Replace(req.URL.Path, "/events/split/", "", 1), 10, 64)
+	if err != nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	size, err := strconv.ParseInt(req.FormValue("size"), 10, 64)
+	if err != nil || size <= 0 {
+		size = n.db.RotateThreshold
+	}
+
+	err = n.Split(commit, size)
+
+	if err == NOT_LEADER_ERROR {
+		respond(w, n.notLeader(w))
+		return
+	}
+
+	res := make(map[string]interface{})
+
+	if err != nil {
+		res = Fail(w, err)
+	} else {
+		res["split"] = commit
+	}
+
+	js, _ := json.MarshalIndent(res, "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
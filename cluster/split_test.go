@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplittingStreams(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(100000000)
+
+		trackevent(n, []byte("a"), map[string]string{"a": "1"})
+		trackevent(n, []byte("b"), map[string]string{"a": "2"})
+		trackevent(n, []byte("c"), map[string]string{"a": "1"})
+		trackevent(n, []byte("d"), map[string]string{"a": "2"})
+
+		n.Delete("a", "2")
+
+		commit := n.db.current
+
+		if _, err := n.raft.Do(NewRotateCommand(0)); err != nil {
+			t.Fatalf("Unable to rotate: %v", err)
+		}
+
+		closed := len(n.db.closed)
+
+		if err := n.Split(commit, 1); err != nil {
+			t.Fatalf("Unable to split: %v", err)
+		}
+
+		// Four events, plus the audit of the rotation.
+		if len(n.db.closed) != closed+4 {
+			t.Errorf("Incorrect number of closed streams. Wanted: %v, found: %v", closed+4, len(n.db.closed))
+		}
+
+		var tests = []struct {
+			value  string
+			events []string
+		}{
+			{"1", []string{"c", "a"}},
+			{"2", []string{}},
+		}
+
+		for i, test := range tests {
+			found, _, err := Query{Index: "a", Value: test.value}.run(n.db)
+
+			if err != nil || !reflect.DeepEqual(found, test.events) {
+				t.Errorf("Case #%v: Incorrect scan. Wanted: %v, found: %v %v", i, test.events, found, err)
+			}
+		}
+
+		found, _, _ := Query{}.run(n.db)
+
+		if !reflect.DeepEqual(found, []string{"a", "c"}) {
+			t.Errorf("Incorrect iteration. Wanted: [a c], found: %v", found)
+		}
+
+		if err := n.Split(n.db.current, 1); err != SPLITTING_UNKNOWN_STREAM {
+			t.Errorf("Expected error splitting the current stream, found: %v", err)
+		}
+	})
+}
+
+func TestFailedSplitDegradesNode(t *testing.T) {
+	db := createDb()
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 1)
+	db.Write(3, []byte("b"), "", map[string]string{"a": "1"}, 2)
+	db.Rotate(10, 1)
+
+	split, err := db.planSplit(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Left in the way of the second piece, so it can't be written.
+	os.MkdirAll(filepath.Join(db.reader.splitpath(2), "blocked"), 0755)
+
+	if err := db.Split(11, split.Commit, split.Length, split.Boundaries, split.Moved); err != nil {
+		t.Fatalf("Expected the split to be applied, found: %v", err)
+	}
+
+	// Waits for the split, as the pieces are locked until it's finished.
+	db.reader.mutex(1).Lock()
+	db.reader.mutex(1).Unlock()
+
+	for i := 0; i < 100 && db.supervisor.Degraded()["split"] == ""; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if db.supervisor.Degraded()["split"] == "" {
+		t.Errorf("Expected the failed split to degrade the node")
+	}
+
+	if len(db.closed) != 2 {
+		t.Errorf("Expected the pieces to be registered, found: %v", db.closed)
+	}
+}
@@ -0,0 +1,407 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+	"github.com/jrallison/raft"
+
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+var STANDALONE_ERROR = errors.New("Not supported by a standalone node")
+var UNKNOWN_COMMAND = errors.New("Unknown command in standalone log")
+
+const STANDALONE_TERM = 1
+
+// Runs the node without raft, for development and deployments which
+// don't need consensus. Starting a standalone node fails if asked to
+// join a cluster, and it can't be joined by others.
+func (n *Node) SetStandalone(standalone bool) {
+	n.standalone = standalone
+}
+
+// Standalone stands in for the raft server of a standalone node. Each
+// command is applied to the DB as soon as it's done, using a local
+// commit counter, and appended to a log so it's replayed on restart.
+// The log is compacted whenever the DB takes a snapshot.
+//
+// Methods of raft.Server only used by a raft cluster aren't implemented.
+type Standalone struct {
+	raft.Server
+	name    string
+	conn    string
+	dir     string
+	db      *DB
+	index   uint64
+	running bool
+	log     *os.File
+	mutex   sync.Mutex
+}
+
+type standaloneEntry struct {
+	Index   uint64          `json:"index"`
+	Name    string          `json:"name"`
+	Command json.RawMessage `json:"command"`
+}
+
+type standaloneContext struct {
+	server *Standalone
+	index  uint64
+}
+
+func (c *standaloneContext) Server() raft.Server  { return c.server }
+func (c *standaloneContext) CurrentTerm() uint64  { return STANDALONE_TERM }
+func (c *standaloneContext) CurrentIndex() uint64 { return c.index }
+func (c *standaloneContext) CommitIndex() uint64  { return c.index }
+
+func connectStandalone(n *Node) error {
+	s := &Standalone{
+		name:  n.name,
+		conn:  n.uri(),
+		dir:   filepath.Join(n.path, "standalone"),
+		db:    n.db,
+		index: n.db.current,
+	}
+
+	if err := os.MkdirAll(s.dir, 0744); err != nil {
+		return err
+	}
+
+	n.raft = s
+	n.db.setRaft(s)
+
+	if err := s.LoadSnapshot(); err != nil {
+		return err
+	}
+
+	if err := s.replay(); err != nil {
+		return err
+	}
+
+	return s.Start()
+}
+
+func (s *Standalone) Name() string                    { return s.name }
+func (s *Standalone) Context() interface{}            { return s.db }
+func (s *Standalone) StateMachine() raft.StateMachine { return s.db }
+func (s *Standalone) Leader() string                  { return s.name }
+func (s *Standalone) Path() string                    { return s.dir }
+func (s *Standalone) Term() uint64                    { return STANDALONE_TERM }
+func (s *Standalone) MemberCount() int                { return 1 }
+func (s *Standalone) QuorumSize() int                 { return 1 }
+func (s *Standalone) ConnectionString() string        { return s.conn }
+func (s *Standalone) Peers() map[string]*raft.Peer {
+	return map[string]*raft.Peer{}
+}
+
+func (s *Standalone) State() string {
+	if s.Running() {
+		return "leader"
+	}
+
+	return "stopped"
+}
+
+func (s *Standalone) CommitIndex() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.index
+}
+
+func (s *Standalone) IsLogEmpty() bool {
+	return s.CommitIndex() == s.db.current
+}
+
+func (s *Standalone) AddPeer(name, connectionString string) error {
+	return STANDALONE_ERROR
+}
+
+func (s *Standalone) RemovePeer(name string) error {
+	return STANDALONE_ERROR
+}
+
+func (s *Standalone) Start() (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.log, err = os.OpenFile(s.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	s.running = err == nil
+
+	return
+}
+
+func (s *Standalone) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.running {
+		s.log.Close()
+		s.running = false
+	}
+}
+
+func (s *Standalone) Running() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.running
+}
+
+// Logs and applies the command, returning its result.
+func (s *Standalone) Do(command raft.Command) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.running {
+		return nil, RAFT_STOPPED
+	}
+
+	body, err := json.Marshal(command)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := json.Marshal(standaloneEntry{s.index + 1, command.CommandName(), body})
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.log.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = s.log.Write(append(entry, '\n')); err != nil {
+		return nil, err
+	}
+
+	s.index++
+
+	result, err := s.apply(command, s.index)
+
+	// The command failed rather than being retried, as it's not
+	// replicated, so it's dropped from the log, not replayed on
+	// restart, as the client may retry it.
+	if _, failed := err.(*StreamError); failed {
+		if terr := s.log.Truncate(info.Size()); terr != nil {
+			return result, terr
+		}
+
+		s.index--
+	}
+
+	return result, err
+}
+
+func (s *Standalone) apply(command raft.Command, index uint64) (interface{}, error) {
+	if c, ok := command.(raft.CommandApply); ok {
+		return c.Apply(&standaloneContext{s, index})
+	}
+
+	return nil, nil
+}
+
+func (s *Standalone) TakeSnapshot() error {
+	return s.TakeSnapshotFrom(s.CommitIndex(), STANDALONE_TERM)
+}
+
+// Saves the DB, and removes entries up to the index from the log.
+// As with raft, later entries are replayed over the snapshot.
+func (s *Standalone) TakeSnapshotFrom(index, term uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, err := s.db.Save()
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	binary.WriteInt64(buf, int64(s.index))
+	buf.Write(state)
+
+	if err = writeFileAtomic(s.snapshotPath(), buf.Bytes()); err != nil {
+		return err
+	}
+
+	entries, _, err := s.entries()
+	if err != nil {
+		return err
+	}
+
+	kept := new(bytes.Buffer)
+
+	for _, entry := range entries {
+		if entry.Index > index {
+			line, _ := json.Marshal(entry)
+			kept.Write(append(line, '\n'))
+		}
+	}
+
+	if err = writeFileAtomic(s.logPath(), kept.Bytes()); err != nil {
+		return err
+	}
+
+	if s.running {
+		s.log.Close()
+		s.log, err = os.OpenFile(s.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	}
+
+	return err
+}
+
+// Recovers the DB from the last snapshot taken, if any.
+func (s *Standalone) LoadSnapshot() error {
+	b, err := ioutil.ReadFile(s.snapshotPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(b)
+
+	index, err := binary.ReadInt64Full(buf)
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.Recovery(buf.Bytes()); err != nil {
+		return err
+	}
+
+	s.index = uint64(index)
+
+	return nil
+}
+
+// Applies every entry in the log again, as raft does on restart.
+func (s *Standalone) replay() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries, length, err := s.entries()
+	if err != nil {
+		return err
+	}
+
+	// Drop any partial entry, so new entries aren't appended to it.
+	if err = os.Truncate(s.logPath(), length); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	prototypes := make(map[string]raft.Command)
+
+	for _, command := range commands() {
+		prototypes[command.CommandName()] = command
+	}
+
+	for _, entry := range entries {
+		prototype, ok := prototypes[entry.Name]
+		if !ok {
+			return errors.New(UNKNOWN_COMMAND.Error() + ": " + entry.Name)
+		}
+
+		command := reflect.New(reflect.TypeOf(prototype).Elem()).Interface().(raft.Command)
+
+		if err = json.Unmarshal(entry.Command, command); err != nil {
+			return err
+		}
+
+		if _, err = s.apply(command, entry.Index); err != nil {
+			s.db.logger.Println("STANDALONE: Error replaying", entry.Name, entry.Index, err)
+		}
+
+		if entry.Index > s.index {
+			s.index = entry.Index
+		}
+	}
+
+	if len(entries) > 0 {
+		s.db.logger.Println("STANDALONE: Replayed", len(entries), "commands up to", s.index)
+	}
+
+	return nil
+}
+
+// Reads the log's entries, along with the length of the log they
+// take up. A partially written final entry was never applied, so
+// it's ignored.
+func (s *Standalone) entries() ([]standaloneEntry, int64, error) {
+	file, err := os.Open(s.logPath())
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	defer file.Close()
+
+	entries := make([]standaloneEntry, 0)
+	length := int64(0)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+
+	for scanner.Scan() {
+		var entry standaloneEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+
+		entries = append(entries, entry)
+		length += int64(len(scanner.Bytes())) + 1
+	}
+
+	return entries, length, scanner.Err()
+}
+
+func (s *Standalone) logPath() string {
+	return filepath.Join(s.dir, "log")
+}
+
+func (s *Standalone) snapshotPath() string {
+	return filepath.Join(s.dir, "snapshot")
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	if err := ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// Starts a standalone node without serving HTTP, for embedding
+// the DB within another service.
+func (n *Node) Open() error {
+	n.standalone = true
+
+	n.db.reconcileCompressions()
+
+	if err := connectStandalone(n); err != nil {
+		return err
+	}
+
+	n.db.reconcileStreams()
+
+	if n.db.disk != nil {
+		n.db.disk.Start(DEFAULT_DISK_INTERVAL, n.db.supervisor)
+	}
+
+	return nil
+}
+
+// The node's DB, for scanning its events directly.
+func (n *Node) DB() *DB {
+	return n.db
+}
@@ -0,0 +1,114 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func startStandalone() *Node {
+	n, _ := NewNode("tmp/standalone", "localhost", 3001)
+	n.SetStandalone(true)
+	n.SetRotateThreshold(1)
+	go n.Start("")
+
+	for n.raft == nil || !n.raft.Running() {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return n
+}
+
+func scanned(n *Node, index, value string) []string {
+	found := make([]string, 0)
+
+	n.db.ScanAll(index, value, 0, func(e *stream.Event) bool {
+		found = append(found, string(e.Data))
+		return true
+	})
+
+	return found
+}
+
+func TestStandaloneNode(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	n := startStandalone()
+
+	if err := n.Start("localhost:3002"); err != STANDALONE_ERROR {
+		t.Errorf("Expected joining a cluster to fail, found: %v", err)
+	}
+
+	trackevent(n, []byte("a"), map[string]string{"a": "1"})
+	trackevent(n, []byte("b"), map[string]string{"a": "1"})
+	trackevent(n, []byte("c"), map[string]string{"a": "1"})
+
+	if found := scanned(n, "a", "1"); !reflect.DeepEqual(found, []string{"c", "b", "a"}) {
+		t.Errorf("Incorrect stream results. Wanted: [c b a], found: %v", found)
+	}
+
+	commit := n.raft.CommitIndex()
+
+	// Let any snapshot taken while rotating finish.
+	time.Sleep(50 * time.Millisecond)
+	n.Stop()
+
+	n = startStandalone()
+	defer n.Stop()
+
+	if index := n.raft.CommitIndex(); index != commit {
+		t.Errorf("Incorrect commit after restart. Wanted: %v, found: %v", commit, index)
+	}
+
+	trackevent(n, []byte("d"), map[string]string{"a": "1"})
+
+	if found := scanned(n, "a", "1"); !reflect.DeepEqual(found, []string{"d", "c", "b", "a"}) {
+		t.Errorf("Incorrect stream results after restart. Wanted: [d c b a], found: %v", found)
+	}
+}
+
+func TestStandaloneStreamFailures(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	n := startStandalone()
+	n.SetRotateThreshold(DEFAULT_ROTATE_THRESHOLD)
+
+	trackevent(n, []byte("a"), map[string]string{"a": "1"})
+	commit := n.raft.CommitIndex()
+
+	// Writes to the stream now fail.
+	n.db.stream.Close()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- n.Event([]byte("b"), "", map[string]string{"a": "1"})
+	}()
+
+	select {
+	case err := <-done:
+		if _, ok := err.(*StreamError); !ok {
+			t.Errorf("Expected the write to fail with the stream, found: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the write to fail rather than be retried")
+	}
+
+	if index := n.raft.CommitIndex(); index != commit {
+		t.Errorf("Expected the failed command to be dropped. Wanted commit: %v, found: %v", commit, index)
+	}
+
+	n.Stop()
+
+	n = startStandalone()
+	defer n.Stop()
+
+	if found := scanned(n, "a", "1"); !reflect.DeepEqual(found, []string{"a"}) {
+		t.Errorf("Expected the failed write not to be replayed, found: %v", found)
+	}
+}
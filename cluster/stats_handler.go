@@ -0,0 +1,41 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// GET reports the stats of the index given by the index parameter, or
+// of every index without one. See DB.IndexStats.
+func (n *Node) statsHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body.Close()
+
+	if role, ok := n.auth.Authorize(w, req, READ); !ok {
+		return
+	} else if !role.Allows("", "") {
+		Deny(w, FORBIDDEN)
+		return
+	}
+
+	if req.Method != "GET" {
+		w.WriteHeader(404)
+		return
+	}
+
+	var res interface{}
+	var err error
+
+	if name := req.FormValue("index"); name != "" {
+		res, err = n.db.IndexStats(name)
+	} else {
+		res, err = n.db.Stats()
+	}
+
+	if err != nil {
+		res = Fail(w, err)
+	}
+
+	js, _ := json.MarshalIndent(res, "", "  ")
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// The task the node is degraded under while its stream is failing.
+const STREAM_TASK = "stream"
+
+// StreamError is a failure to write to, close or create the DB's open
+// stream. Commands applied through raft are committed, so have been or
+// will be applied by other nodes, and can't fail on only this one
+// without its streams diverging from theirs. Rather than stopping the
+// node, the operation is retried until it succeeds, and the node stops
+// applying commands and is degraded until then. Commands which aren't
+// replicated, without raft or on a standalone node, fail with it
+// instead, so the client can retry.
+type StreamError struct {
+	Op     string
+	Commit uint64
+	Err    error
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("Unable to %s stream %d: %v", e.Op, e.Commit, e.Err)
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// A rotation which failed, to be retried before anything else is
+// written, so the stream it creates is named by the same commit as
+// on every other node.
+type rotation struct {
+	commit uint64
+	term   uint64
+}
+
+// Used for retrying stream operations while applying committed commands.
+var DefaultStreamRetryPolicy = RetryPolicy{
+	Backoff:    100 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+	Jitter:     0.2,
+}
+
+// Runs the stream operation, retrying it until it succeeds if applying
+// a command replicated through raft, unless the node is stopping.
+func (db *DB) retryStream(op string, commit uint64, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+
+		if err == nil {
+			db.streamRecovered()
+			return nil
+		}
+
+		err = db.streamFailed(op, commit, err)
+
+		if !db.replicated() || atomic.LoadInt32(&db.stopping) == 1 {
+			return err
+		}
+
+		time.Sleep(DefaultStreamRetryPolicy.delay(attempt))
+	}
+}
+
+// Whether commands are applied through raft, so have been or will be
+// by other nodes. Standalone nodes apply them only here.
+func (db *DB) replicated() bool {
+	if db.raft == nil {
+		return false
+	}
+
+	_, standalone := db.raft.(*Standalone)
+
+	return !standalone
+}
+
+func (db *DB) streamFailed(op string, commit uint64, err error) error {
+	err = &StreamError{op, commit, err}
+
+	db.logger.Println("STREAM:", err)
+
+	atomic.StoreInt32(&db.failing, 1)
+	db.supervisor.degrade(STREAM_TASK, err)
+
+	return err
+}
+
+func (db *DB) streamRecovered() {
+	if atomic.CompareAndSwapInt32(&db.failing, 1, 0) {
+		db.supervisor.recover(STREAM_TASK)
+	}
+}
+
+// Retries the rotation which failed, if there is one.
+func (db *DB) finishRotation() error {
+	if db.rotation == nil {
+		return nil
+	}
+
+	return db.Rotate(db.rotation.commit, db.rotation.term)
+}
@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStreamFailures(t *testing.T) {
+	db := createDb()
+
+	db.setCurrent(1)
+
+	if err := db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 1); err != nil {
+		t.Fatalf("Unexpected error writing: %v", err)
+	}
+
+	// Writes to the stream now fail.
+	db.stream.Close()
+
+	err := db.Write(3, []byte("b"), "", map[string]string{"a": "1"}, 2)
+
+	if failed, ok := err.(*StreamError); !ok || failed.Op != "write" || failed.Commit != 1 {
+		t.Errorf("Wanted the write to fail, found: %v", err)
+	}
+
+	if db.supervisor.Degraded()[STREAM_TASK] == "" {
+		t.Errorf("Wanted the DB to be degraded, found: %v", db.supervisor.Degraded())
+	}
+
+	if kind := Classify(err); kind.Status != 503 || !kind.Retryable {
+		t.Errorf("Wanted a retryable 503, found: %v", kind)
+	}
+
+	// The next stream can't be created while its path is taken.
+	os.MkdirAll(filepath.Join(db.reader.Path(4), "taken"), 0755)
+
+	if err := db.Rotate(4, 1); err == nil {
+		t.Errorf("Wanted the rotation to fail")
+	}
+
+	if err := db.WriteAll(5, [][]byte{[]byte("c")}, nil, []map[string]string{{"a": "1"}}, 3); err == nil {
+		t.Errorf("Wanted writes to fail until the rotation succeeds")
+	}
+
+	os.RemoveAll(db.reader.Path(4))
+
+	if err := db.Write(6, []byte("d"), "", map[string]string{"a": "1"}, 4); err != nil {
+		t.Errorf("Wanted the rotation to be retried, found: %v", err)
+	}
+
+	if db.current != 4 || db.rotation != nil {
+		t.Errorf("Wanted stream 4 to be current, found: %v, %v", db.current, db.rotation)
+	}
+
+	if len(db.supervisor.Degraded()) != 0 {
+		t.Errorf("Wanted the DB to recover, found: %v", db.supervisor.Degraded())
+	}
+
+	if offset, _ := db.stream.First("a", "1"); offset == 0 {
+		t.Errorf("Wanted the event to be written to stream 4")
+	}
+}
+
+func TestCommittedStreamFailuresAreRetried(t *testing.T) {
+	withNode(func(n *Node) {
+		trackevent(n, []byte("a"), map[string]string{"a": "1"})
+
+		// The rotation is the next entry, so its stream is named by it.
+		next := n.db.commit(n.raft.CommitIndex() + 1)
+		taken := filepath.Join(n.db.reader.Path(next), "taken")
+
+		os.MkdirAll(taken, 0755)
+
+		done := make(chan error, 1)
+
+		go func() {
+			_, err := n.raft.Do(NewRotateCommand(0))
+			done <- err
+		}()
+
+		for i := 0; i < 200 && n.db.supervisor.Degraded()[STREAM_TASK] == ""; i++ {
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		select {
+		case err := <-done:
+			t.Fatalf("Expected the rotation to be retried rather than fail, found: %v", err)
+		default:
+		}
+
+		os.RemoveAll(n.db.reader.Path(next))
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Unexpected error rotating: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the rotation to be retried")
+		}
+
+		if n.db.current != next || len(n.db.supervisor.Degraded()) != 0 {
+			t.Errorf("Expected stream %v to be created once it could be, found: %v %v", next, n.db.current, n.db.supervisor.Degraded())
+		}
+	})
+}
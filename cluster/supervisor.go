@@ -0,0 +1,185 @@
+package cluster
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// What the supervisor should do after a background task fails.
+type TaskAction int
+
+const (
+	// Run the task again.
+	RETRY TaskAction = iota
+	// Give up on this run of the task, but stay healthy.
+	ABANDON
+	// Give up and mark the node as degraded until the task next succeeds.
+	DEGRADE
+)
+
+// Called whenever a supervised background task fails or panics. The
+// attempt starts at 1 and increases each time the task is retried.
+// Hooks can report the error elsewhere (e.g. an error tracking
+// service), sleep before asking for a retry, or give up.
+type ErrorHook func(task string, attempt int, err error) TaskAction
+
+// Logs the failure and marks the node degraded.
+func DefaultErrorHook(task string, attempt int, err error) TaskAction {
+	log.Println("TASK: Error running", task, "attempt", attempt, err)
+	return DEGRADE
+}
+
+// Supervisor runs background work (snapshots, compression, etc) so
+// failures are handed to an ErrorHook rather than crashing the process.
+type Supervisor struct {
+	hook     ErrorHook
+	degraded map[string]error
+	failures map[string]int
+	policies map[string]RetryPolicy
+	mutex    sync.Mutex
+}
+
+func NewSupervisor(hook ErrorHook) *Supervisor {
+	if hook == nil {
+		hook = DefaultErrorHook
+	}
+
+	return &Supervisor{
+		hook:     hook,
+		degraded: make(map[string]error),
+		failures: make(map[string]int),
+		policies: make(map[string]RetryPolicy),
+	}
+}
+
+func (s *Supervisor) SetHook(hook ErrorHook) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if hook == nil {
+		hook = DefaultErrorHook
+	}
+
+	s.hook = hook
+}
+
+// Retries the task with backoff when the error hook would degrade the
+// node, only degrading it once the policy's attempts are used up.
+func (s *Supervisor) SetRetryPolicy(task string, p RetryPolicy) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.policies[task] = p
+}
+
+// Runs the task in the background.
+func (s *Supervisor) Go(task string, f func() error) {
+	go s.Run(task, f)
+}
+
+// Runs the task until it succeeds or the error hook gives up on it.
+func (s *Supervisor) Run(task string, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := protect(f)
+
+		if err == nil {
+			s.recover(task)
+			return nil
+		}
+
+		s.fail(task)
+
+		switch s.errorHook()(task, attempt, err) {
+		case RETRY:
+			continue
+		case DEGRADE:
+			if p, ok := s.policy(task); ok && attempt < p.MaxAttempts {
+				time.Sleep(p.delay(attempt))
+				continue
+			}
+
+			s.degrade(task, err)
+		}
+
+		return err
+	}
+}
+
+// Returns the latest error for every task which has left the node degraded.
+func (s *Supervisor) Degraded() map[string]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	degraded := make(map[string]string, len(s.degraded))
+
+	for task, err := range s.degraded {
+		degraded[task] = err.Error()
+	}
+
+	return degraded
+}
+
+// Returns how many times in a row each failing task has failed.
+func (s *Supervisor) Failures() map[string]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	failures := make(map[string]int, len(s.failures))
+
+	for task, count := range s.failures {
+		failures[task] = count
+	}
+
+	return failures
+}
+
+func (s *Supervisor) errorHook() ErrorHook {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.hook
+}
+
+func (s *Supervisor) policy(task string) (RetryPolicy, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p, ok := s.policies[task]
+	return p, ok
+}
+
+func (s *Supervisor) fail(task string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failures[task] += 1
+}
+
+func (s *Supervisor) degrade(task string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.degraded[task] = err
+}
+
+func (s *Supervisor) recover(task string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.degraded, task)
+	delete(s.failures, task)
+}
+
+// Converts panics into errors, so a misbehaving task
+// is treated the same as one returning an error.
+func protect(f func() error) (err error) {
+	defer (func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	})()
+
+	return f()
+}
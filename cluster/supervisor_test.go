@@ -0,0 +1,94 @@
+package cluster
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSupervisorRetries(t *testing.T) {
+	attempts := make([]int, 0)
+
+	s := NewSupervisor(func(task string, attempt int, err error) TaskAction {
+		attempts = append(attempts, attempt)
+
+		if attempt < 3 {
+			return RETRY
+		}
+
+		return ABANDON
+	})
+
+	err := s.Run("test", func() error {
+		return errors.New("failed")
+	})
+
+	if err == nil || err.Error() != "failed" {
+		t.Errorf("Wanted task error, found: %v", err)
+	}
+
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) {
+		t.Errorf("Incorrect attempts. Wanted: %v, found: %v", []int{1, 2, 3}, attempts)
+	}
+
+	if len(s.Degraded()) != 0 {
+		t.Errorf("Abandoned task shouldn't degrade the node: %v", s.Degraded())
+	}
+}
+
+func TestSupervisorDegradesOnPanic(t *testing.T) {
+	s := NewSupervisor(func(task string, attempt int, err error) TaskAction {
+		return DEGRADE
+	})
+
+	s.Run("snapshot", func() error {
+		panic("disk on fire")
+	})
+
+	if !reflect.DeepEqual(s.Degraded(), map[string]string{"snapshot": "panic: disk on fire"}) {
+		t.Errorf("Incorrect degraded tasks: %v", s.Degraded())
+	}
+
+	s.Run("snapshot", func() error {
+		return nil
+	})
+
+	if len(s.Degraded()) != 0 {
+		t.Errorf("Successful run should clear degraded state: %v", s.Degraded())
+	}
+}
+
+func TestSupervisorRetryPolicy(t *testing.T) {
+	s := NewSupervisor(func(task string, attempt int, err error) TaskAction {
+		return DEGRADE
+	})
+
+	s.SetRetryPolicy("snapshot", RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	attempts := 0
+	failures := make([]int, 0)
+
+	s.Run("snapshot", func() error {
+		failures = append(failures, s.Failures()["snapshot"])
+		attempts += 1
+
+		if attempts < 3 {
+			return errors.New("failed")
+		}
+
+		return nil
+	})
+
+	if !reflect.DeepEqual(failures, []int{0, 1, 2}) || len(s.Degraded()) != 0 || len(s.Failures()) != 0 {
+		t.Errorf("Expected retries without degrading, found: %v %v %v", failures, s.Degraded(), s.Failures())
+	}
+
+	s.Run("snapshot", func() error {
+		return errors.New("failed")
+	})
+
+	if !reflect.DeepEqual(s.Degraded(), map[string]string{"snapshot": "failed"}) || s.Failures()["snapshot"] != 3 {
+		t.Errorf("Expected to degrade after 3 failures, found: %v %v", s.Degraded(), s.Failures())
+	}
+}
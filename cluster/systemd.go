@@ -0,0 +1,191 @@
+package cluster
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_HEALTH_TIMEOUT = 5 * time.Second
+
+	// How often to check whether the node is ready, while starting.
+	READY_INTERVAL = 100 * time.Millisecond
+)
+
+var RAFT_STOPPED = errors.New("Raft isn't running")
+var STREAM_NOT_WRITABLE = errors.New("Open stream isn't writable")
+var HEALTH_TIMEOUT = errors.New("Health check timed out")
+
+// Sends a state notification to systemd, such as READY=1 or
+// WATCHDOG=1. Does nothing unless run by systemd with notify enabled.
+func SdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// Sockets in the abstract namespace are given with a leading @.
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// How often systemd expects watchdog notifications, or 0
+// if the watchdog isn't enabled for this process.
+func WatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Checks the node is able to accept writes: raft is running and has
+// a leader, and the open stream is writable. As a wedged node may
+// block while being checked, it's unhealthy if the check doesn't
+// finish within the timeout.
+func (n *Node) Health(timeout time.Duration) error {
+	return within(timeout, n.health)
+}
+
+// Checks the node is alive, rather than able to accept writes: raft's
+// loop is running, and can be checked within the timeout. A node
+// without a leader or disk space is alive, and restarting it wouldn't
+// help.
+func (n *Node) Alive(timeout time.Duration) error {
+	return within(timeout, n.alive)
+}
+
+func within(timeout time.Duration, check func() error) error {
+	result := make(chan error, 1)
+
+	go func() {
+		result <- check()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return HEALTH_TIMEOUT
+	}
+}
+
+func (n *Node) alive() error {
+	if n.raft == nil || !n.raft.Running() {
+		return RAFT_STOPPED
+	}
+
+	return nil
+}
+
+func (n *Node) health() error {
+	if err := n.alive(); err != nil {
+		return err
+	}
+
+	if n.raft.Leader() == "" {
+		return NO_LEADER_ERROR
+	}
+
+	if n.db.stream == nil {
+		return STREAM_NOT_WRITABLE
+	}
+
+	if n.db.disk.Full() {
+		return DISK_FULL
+	}
+
+	if n.CatchingUp() {
+		return CATCHING_UP
+	}
+
+	return nil
+}
+
+// Tells systemd the node is ready once it's healthy, then pings
+// the watchdog for as long as it stays alive, so systemd restarts
+// it if it becomes wedged. Whether it's healthy is reported as its
+// status, as restarting a node without a leader or disk space won't
+// give it either.
+func (n *Node) notifySystemd(stop chan bool) {
+	ready := time.NewTicker(READY_INTERVAL)
+
+	for n.Health(DEFAULT_HEALTH_TIMEOUT) != nil {
+		select {
+		case <-stop:
+			ready.Stop()
+			return
+		case <-ready.C:
+		}
+	}
+
+	ready.Stop()
+
+	if err := SdNotify("READY=1"); err != nil {
+		n.db.logger.Println("SYSTEMD: Failed to notify ready:", err)
+	}
+
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	// Check twice per interval, so a single slow check isn't fatal.
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if state, ok := n.watchdog(interval / 4); ok {
+				SdNotify(state)
+			}
+		}
+	}
+}
+
+// The watchdog notification, with the node's health as its status,
+// unless the node isn't alive.
+func (n *Node) watchdog(timeout time.Duration) (string, bool) {
+	if err := n.Alive(timeout); err != nil {
+		n.db.logger.Println("SYSTEMD: Skipping watchdog, not alive:", err)
+		return "", false
+	}
+
+	status := "Healthy"
+
+	if err := n.Health(timeout); err != nil {
+		status = "Unhealthy: " + err.Error()
+	}
+
+	return "WATCHDOG=1\nSTATUS=" + status, true
+}
+
+func (n *Node) stopNotify() {
+	if n.notify != nil {
+		close(n.notify)
+		n.notify = nil
+	}
+}
@@ -0,0 +1,93 @@
+package cluster
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSdNotify(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	if err := SdNotify("READY=1"); err != nil {
+		t.Errorf("Expected nothing to be sent outside systemd, found: %v", err)
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: "tmp/notify", Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", "tmp/notify")
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	if err := SdNotify("READY=1"); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	if n, _ := conn.Read(buf); string(buf[:n]) != "READY=1" {
+		t.Errorf("Incorrect notification. Wanted: READY=1, found: %q", buf[:n])
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	if interval := WatchdogInterval(); interval != 0 {
+		t.Errorf("Expected watchdog to be disabled, found: %v", interval)
+	}
+
+	os.Setenv("WATCHDOG_USEC", "2000000")
+	defer os.Unsetenv("WATCHDOG_USEC")
+
+	if interval := WatchdogInterval(); interval != 2*time.Second {
+		t.Errorf("Incorrect watchdog interval. Wanted: 2s, found: %v", interval)
+	}
+
+	os.Setenv("WATCHDOG_PID", "1")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	if interval := WatchdogInterval(); interval != 0 {
+		t.Errorf("Expected watchdog for another process to be ignored, found: %v", interval)
+	}
+}
+
+func TestNodeHealth(t *testing.T) {
+	withNode(func(n *Node) {
+		if err := n.Health(time.Second); err != nil {
+			t.Errorf("Expected node to be healthy, found: %v", err)
+		}
+
+		stream := n.db.stream
+		n.db.stream = nil
+
+		if err := n.Health(time.Second); err != STREAM_NOT_WRITABLE {
+			t.Errorf("Expected unwritable stream, found: %v", err)
+		}
+
+		if state, ok := n.watchdog(time.Second); !ok || state != "WATCHDOG=1\nSTATUS=Unhealthy: "+STREAM_NOT_WRITABLE.Error() {
+			t.Errorf("Expected an unhealthy node to ping the watchdog, found: %q %v", state, ok)
+		}
+
+		n.db.stream = stream
+
+		if state, ok := n.watchdog(time.Second); !ok || state != "WATCHDOG=1\nSTATUS=Healthy" {
+			t.Errorf("Expected a healthy node to ping the watchdog, found: %q %v", state, ok)
+		}
+
+		n.raft.Stop()
+
+		if _, ok := n.watchdog(time.Second); ok {
+			t.Errorf("Expected a stopped node not to ping the watchdog")
+		}
+
+		if err := n.Health(time.Second); err != RAFT_STOPPED {
+			t.Errorf("Expected raft to be stopped, found: %v", err)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package cluster
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var INVALID_IO_LIMIT = errors.New("IO limit must not be negative")
+
+// How much unused allowance a throttle keeps, so short pauses
+// between reads don't slow those after them.
+const THROTTLE_BURST = 100 * time.Millisecond
+
+// Throttle limits the rate of background IO (snapshots, recovering
+// streams from peers and compression) so it doesn't take the disk's
+// bandwidth from writes and scans. A nil Throttle doesn't limit.
+type Throttle struct {
+	rate  int64
+	next  time.Time
+	mutex sync.Mutex
+}
+
+// Limits IO to the given number of bytes per second,
+// or returns nil, not limiting it, if that's 0.
+func NewThrottle(bytesPerSecond int64) *Throttle {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &Throttle{rate: bytesPerSecond}
+}
+
+// Waits until another n bytes may be read or written.
+func (t *Throttle) Wait(n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+
+	t.mutex.Lock()
+
+	now := time.Now()
+
+	if earliest := now.Add(-THROTTLE_BURST); t.next.Before(earliest) {
+		t.next = earliest
+	}
+
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / t.rate))
+	wait := t.next.Sub(now)
+
+	t.mutex.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Wraps the reader so reads are limited by the throttle.
+func (t *Throttle) Reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+
+	return &throttledReader{r, t}
+}
+
+// Wraps the writer so writes are limited by the throttle.
+func (t *Throttle) Writer(w io.Writer) io.Writer {
+	if t == nil {
+		return w
+	}
+
+	return &throttledWriter{w, t}
+}
+
+type throttledReader struct {
+	reader   io.Reader
+	throttle *Throttle
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.throttle.Wait(n)
+	return n, err
+}
+
+type throttledWriter struct {
+	writer   io.Writer
+	throttle *Throttle
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	w.throttle.Wait(len(p))
+	return w.writer.Write(p)
+}
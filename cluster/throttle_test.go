@@ -0,0 +1,74 @@
+package cluster
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	throttle := NewThrottle(10000)
+
+	start := time.Now()
+
+	// The first 100ms are allowed immediately, as a burst.
+	for i := 0; i < 4; i++ {
+		throttle.Wait(1000)
+	}
+
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected to wait about 300ms, waited: %v", elapsed)
+	}
+}
+
+func TestThrottledCopy(t *testing.T) {
+	throttle := NewThrottle(10000)
+
+	out := new(bytes.Buffer)
+	start := time.Now()
+
+	io.Copy(throttle.Writer(out), throttle.Reader(bytes.NewReader(make([]byte, 1500))))
+
+	if elapsed := time.Since(start); out.Len() != 1500 || elapsed < 150*time.Millisecond {
+		t.Errorf("Expected 1500 bytes copied in about 200ms, found: %v in %v", out.Len(), elapsed)
+	}
+}
+
+func TestNoThrottle(t *testing.T) {
+	var throttle *Throttle = NewThrottle(0)
+
+	if throttle != nil {
+		t.Errorf("Expected no throttle, found: %v", throttle)
+	}
+
+	start := time.Now()
+	throttle.Wait(1 << 30)
+
+	if w := new(bytes.Buffer); throttle.Writer(w) != w {
+		t.Errorf("Expected writer to be unwrapped")
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("Expected not to wait, waited: %v", elapsed)
+	}
+}
+
+func TestThrottledSnapshots(t *testing.T) {
+	db := createDb()
+
+	state, _ := db.Save()
+	rate := int64(len(state) * 4)
+
+	db.throttle = NewThrottle(rate)
+	start := time.Now()
+
+	// A quarter of a second, less the burst allowed immediately.
+	if saved, err := db.SaveAt(0, 0); err != nil || !bytes.Equal(saved, state) {
+		t.Errorf("Expected the throttled snapshot to match, found: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the snapshot to be throttled, took: %v", elapsed)
+	}
+}
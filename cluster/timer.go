@@ -4,8 +4,22 @@ type Timer interface {
 	Time(func())
 }
 
+// Timers which are also StreamTimers are told which stream, by its
+// commit, each timing is for, so a slow stream file can be found.
+type StreamTimer interface {
+	TimeStream(commit uint64, f func())
+}
+
 type NilTimer struct{}
 
 func (NilTimer) Time(f func()) {
 	f()
 }
+
+func timeStream(t Timer, commit uint64, f func()) {
+	if st, ok := t.(StreamTimer); ok {
+		st.TimeStream(commit, f)
+	} else {
+		t.Time(f)
+	}
+}
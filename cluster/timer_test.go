@@ -0,0 +1,49 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"os"
+	"reflect"
+	"testing"
+)
+
+type streamTimes []uint64
+
+func (t *streamTimes) Time(f func()) {
+	f()
+}
+
+func (t *streamTimes) TimeStream(commit uint64, f func()) {
+	*t = append(*t, commit)
+	f()
+}
+
+func TestStreamTimers(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	writes, rotates, scans := &streamTimes{}, &streamTimes{}, &streamTimes{}
+
+	db, _ := NewDb("tmp", WithMetrics(writes, rotates), WithScanTimer(scans))
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "b"}, 1)
+	db.Rotate(3, 0)
+	db.Write(4, []byte("b"), "", map[string]string{"a": "b"}, 2)
+
+	db.Scan("a", "b", 0, "", func(e *stream.Event) bool {
+		return true
+	})
+
+	if !reflect.DeepEqual(*writes, streamTimes{1, 3}) {
+		t.Errorf("Incorrect write timings. Wanted: [1 3], found: %v", *writes)
+	}
+
+	if !reflect.DeepEqual(*rotates, streamTimes{1}) {
+		t.Errorf("Incorrect rotate timings. Wanted: [1], found: %v", *rotates)
+	}
+
+	if !reflect.DeepEqual(*scans, streamTimes{3, 1}) {
+		t.Errorf("Incorrect scan timings. Wanted: [3 1], found: %v", *scans)
+	}
+}
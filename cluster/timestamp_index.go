@@ -0,0 +1,322 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Events are indexed under TIMESTAMP_INDEX by when they were written,
+// with the DB's timestamp index, so they can be scanned in the order
+// written across every stream. See WithTimestampIndex.
+const TIMESTAMP_INDEX = "_ts"
+
+// The resolution of WithTimestampIndex's buckets, if not given.
+const DEFAULT_TIMESTAMP_RESOLUTION = time.Second
+
+var INVALID_TIMESTAMP_RESOLUTION = errors.New("Timestamp index resolution must not be negative")
+
+// Indexes each event written by when the leader wrote it, truncated to
+// the resolution, under TIMESTAMP_INDEX, so the query of TIMESTAMP_INDEX
+// without a value scans every event in the order written, rather than
+// by stream. A resolution of 0 is DEFAULT_TIMESTAMP_RESOLUTION.
+//
+// Each value of the index is a key in its stream's index, so a finer
+// resolution orders events more closely at the cost of larger indexes.
+// Events written within the same bucket are read in the order they're
+// held in streams. Events written before the index was enabled aren't
+// scanned.
+func WithTimestampIndex(resolution time.Duration) Option {
+	return func(db *DB) error {
+		if resolution < 0 {
+			return INVALID_TIMESTAMP_RESOLUTION
+		} else if resolution == 0 {
+			resolution = DEFAULT_TIMESTAMP_RESOLUTION
+		}
+
+		db.timestampResolution = resolution
+		return nil
+	}
+}
+
+// The indexes with the timestamp's bucket, if the DB has a timestamp index.
+func (db *DB) timestamped(indexes map[string]string, timestamp int64) map[string]string {
+	if db.timestampResolution == 0 || timestamp <= 0 {
+		return indexes
+	}
+
+	indexed := make(map[string]string, len(indexes)+1)
+
+	for name, value := range indexes {
+		indexed[name] = value
+	}
+
+	indexed[TIMESTAMP_INDEX] = timestampBucket(timestamp, db.timestampResolution)
+
+	return indexed
+}
+
+// Buckets are zero padded unix nanoseconds, so sort as they're ordered.
+func timestampBucket(timestamp int64, resolution time.Duration) string {
+	return fmt.Sprintf("%020d", timestamp-timestamp%int64(resolution))
+}
+
+// Whether the query scans every event in the order written. See WithTimestampIndex.
+func (q Query) chronological() bool {
+	return q.Index == TIMESTAMP_INDEX && q.Value == "" && q.Grouping == "" && len(q.Indexes) == 0
+}
+
+// Scans as Reader.ScanChronologicalContext.
+func (db *DB) ScanChronologicalContext(ctx context.Context, after uint64, continuation string, reverse bool, scanner stream.Scanner) (string, error) {
+	db.refreshReader()
+	return db.reader.ScanChronologicalContext(ctx, after, continuation, reverse, scanner)
+}
+
+// A bucket of events within a stream.
+type bucket struct {
+	value  string
+	commit uint64
+}
+
+// Scans every event from the stream after the commit with a timestamp,
+// in the order written, oldest first, or newest first in reverse, and
+// within the context's window. Streams wholly outside the window are
+// skipped, as are buckets of those overlapping it.
+//
+// Returns a continuation to resume from, which scanning oldest first
+// is never empty, as further events may be written. Resuming after
+// the stream's been rewritten reads its bucket again.
+func (r *Reader) ScanChronologicalContext(ctx context.Context, after uint64, continuation string, reverse bool, scanner stream.Scanner) (string, error) {
+	release, err := r.admission.admit(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer release()
+
+	start, count, err := r.parseChronologicalContinuation(continuation)
+	if err != nil {
+		return "", err
+	}
+
+	// Read again from the start of its bucket, in either direction.
+	if start.commit == 0 && reverse {
+		start.commit = math.MaxUint64
+	}
+
+	buckets, err := r.buckets(ctx, after, reverse)
+	if err != nil {
+		return "", err
+	}
+
+	// Resumed from the first bucket not yet finished.
+	i := 0
+
+	if start.value != "" {
+		i = sort.Search(len(buckets), func(i int) bool {
+			return !buckets[i].before(start, reverse)
+		})
+	}
+
+	var skip int64
+
+	for ; i < len(buckets) && ctx.Err() == nil; i++ {
+		b := buckets[i]
+
+		s, err := r.retrieveStream(b.commit, true)
+		if err != nil {
+			return "", err
+		}
+
+		// Scanned newest first, as chains are.
+		var events []*stream.Event
+
+		timeStream(r.timer, b.commit, func() {
+			err = s.ScanIndex(TIMESTAMP_INDEX, b.value, 0, func(e *stream.Event) bool {
+				events = append(events, e)
+				return true
+			})
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		if !reverse {
+			for j, k := 0, len(events)-1; j < k; j, k = j+1, k-1 {
+				events[j], events[k] = events[k], events[j]
+			}
+		}
+
+		skip = 0
+
+		if b == start {
+			skip = skipped(count, len(events), reverse)
+		}
+
+		for ; skip < int64(len(events)); skip++ {
+			e := events[skip]
+
+			if audited(e) || hidden(r.tombs, r.deleted, b.commit, e, time.Now().UnixNano()) {
+				continue
+			}
+
+			r.redactions.apply(b.commit, e)
+
+			if !scanner(e) || ctx.Err() != nil {
+				return r.buildChronologicalContinuation(b, skipped(skip+1, len(events), reverse)), nil
+			}
+		}
+
+		start, count = b, skipped(skip, len(events), reverse)
+	}
+
+	// Older events aren't written, so a reverse scan which reaches the
+	// oldest is done.
+	if reverse && i >= len(buckets) {
+		return "", nil
+	}
+
+	if start.value == "" {
+		return continuation, nil
+	}
+
+	return r.buildChronologicalContinuation(start, count), nil
+}
+
+// Continuations count the events of their bucket scanned, or in reverse
+// those left to scan, so events written to it since don't change where
+// the scan resumes. Converts between the count and the events skipped.
+func skipped(count int64, events int, reverse bool) int64 {
+	if !reverse {
+		return count
+	}
+
+	if count > int64(events) {
+		return 0
+	}
+
+	return int64(events) - count
+}
+
+// Every bucket of every stream after the commit within the context's
+// window, in the order scanned.
+func (r *Reader) buckets(ctx context.Context, after uint64, reverse bool) ([]bucket, error) {
+	var since, until string
+
+	if w, ok := ctx.Value(windowKey{}).(Window); ok {
+		if w.Since > 0 {
+			since = fmt.Sprintf("%020d", w.Since)
+		}
+
+		if w.Until > 0 {
+			until = fmt.Sprintf("%020d", w.Until)
+		}
+	}
+
+	var buckets []bucket
+
+	for commit := r.Next(after); commit > 0; commit = r.Next(commit) {
+		if skip, _ := r.outside(ctx, commit, reverse); skip {
+			continue
+		}
+
+		s, err := r.retrieveStream(commit, true)
+		if err != nil {
+			return nil, err
+		}
+
+		// Followers have the primary's current stream only once it's closed.
+		if s == nil {
+			continue
+		}
+
+		values, err := s.Values(TIMESTAMP_INDEX)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, value := range values {
+			// Buckets start at their value, so the one before since may hold some of it.
+			if since != "" && i+1 < len(values) && values[i+1] <= since {
+				continue
+			}
+
+			if until != "" && value > until {
+				break
+			}
+
+			buckets = append(buckets, bucket{value, commit})
+		}
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].before(buckets[j], reverse)
+	})
+
+	return buckets, nil
+}
+
+// Whether the bucket's scanned before the other.
+func (b bucket) before(other bucket, reverse bool) bool {
+	if b.value != other.value {
+		return (b.value < other.value) != reverse
+	}
+
+	return (b.commit < other.commit) != reverse
+}
+
+// Chronological continuations are the bucket being scanned and how
+// many of its events have been, as "bucket:v1:commit:count:epoch",
+// or signed for TIMESTAMP_INDEX once the reader has a key.
+func (r *Reader) buildChronologicalContinuation(b bucket, count int64) string {
+	epoch := r.rewrites[b.commit].Epoch
+
+	if r.continuationKey != nil {
+		return Continuation{SIGNED_CONTINUATION_VERSION, b.commit, count, epoch, TIMESTAMP_INDEX, b.value}.Sign(r.continuationKey)
+	}
+
+	return fmt.Sprint(b.value, ":", CONTINUATION_VERSION, ":", b.commit, ":", count, ":", epoch)
+}
+
+func (r *Reader) parseChronologicalContinuation(continuation string) (bucket, int64, error) {
+	if continuation == "" {
+		return bucket{}, 0, nil
+	}
+
+	var c Continuation
+	var err error
+
+	if r.continuationKey != nil {
+		if c, err = r.decodeContinuation(continuation); err == nil && c.Index != TIMESTAMP_INDEX {
+			err = MISMATCHED_CONTINUATION
+		}
+	} else if parts := strings.SplitN(continuation, ":", 2); len(parts) == 2 {
+		c, err = r.decodeContinuation(parts[1])
+		c.Value = parts[0]
+	} else {
+		err = MALFORMED_CONTINUATION
+	}
+
+	if err != nil {
+		return bucket{}, 0, err
+	}
+
+	if _, perr := strconv.ParseUint(c.Value, 10, 64); perr != nil || c.Offset < 0 {
+		return bucket{}, 0, MALFORMED_CONTINUATION
+	}
+
+	// Its events have moved, so the bucket's read again from its start.
+	if rw, ok := r.rewrites[c.Commit]; ok && rw.Epoch > c.Epoch {
+		return bucket{c.Value, 0}, 0, nil
+	}
+
+	return bucket{c.Value, c.Commit}, c.Offset, nil
+}
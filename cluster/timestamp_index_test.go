@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimestampIndex(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp", 0755)
+
+	db, _ := NewDb("tmp", WithTimestampIndex(time.Second))
+	second := int64(time.Second)
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 1*second)
+	db.Write(3, []byte("b"), "", map[string]string{"a": "1"}, 3*second)
+	db.Write(4, []byte("c"), "", map[string]string{"a": "1"}, 5*second+1)
+	db.Rotate(5, 1)
+
+	// Written by a leader whose clock is behind.
+	db.Write(6, []byte("d"), "", map[string]string{"a": "1"}, 2*second)
+	db.Write(7, []byte("e"), "", map[string]string{"a": "1"}, 4*second)
+	db.Write(8, []byte("f"), "", map[string]string{"a": "1"}, 6*second)
+	db.Write(9, []byte("g"), "", map[string]string{"a": "1"}, 3*second+1)
+
+	scan := func(q Query) []string {
+		var found []string
+
+		for i := 0; i < 10; i++ {
+			events, continuation, err := q.run(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if found = append(found, events...); len(events) == 0 || continuation == "" {
+				break
+			}
+
+			q.Continuation = continuation
+		}
+
+		return found
+	}
+
+	for _, test := range []struct {
+		query Query
+		want  []string
+	}{
+		{Query{Index: TIMESTAMP_INDEX}, []string{"a", "d", "b", "g", "e", "c", "f"}},
+		{Query{Index: TIMESTAMP_INDEX, Limit: 2}, []string{"a", "d", "b", "g", "e", "c", "f"}},
+		{Query{Index: TIMESTAMP_INDEX, Limit: 2, Reverse: true}, []string{"f", "c", "e", "g", "b", "d", "a"}},
+		{Query{Index: TIMESTAMP_INDEX, Since: 3 * second, Until: 4 * second}, []string{"b", "g", "e"}},
+	} {
+		if found := scan(test.query); !reflect.DeepEqual(found, test.want) {
+			t.Errorf("%+v: wanted: %v, found: %v", test.query, test.want, found)
+		}
+	}
+
+	// Resumes with events written since.
+	q := Query{Index: TIMESTAMP_INDEX}
+	_, continuation, _ := q.run(db)
+
+	db.Write(10, []byte("h"), "", map[string]string{"a": "1"}, 6*second+1)
+
+	q.Continuation = continuation
+
+	if events, _, _ := q.run(db); !reflect.DeepEqual(events, []string{"h"}) {
+		t.Errorf("Wanted: [h], found: %v", events)
+	}
+
+	if !reserved(map[string]string{TIMESTAMP_INDEX: "1"}) {
+		t.Errorf("Expected %v to be reserved", TIMESTAMP_INDEX)
+	}
+}
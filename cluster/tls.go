@@ -0,0 +1,147 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var INVALID_TLS_CA = errors.New("No certificates found in TLS CA file")
+
+// Loads the certificate and key a node serves HTTP, raft and RPCs with,
+// which it also presents to its peers when calling them. Given a CA,
+// peers' certificates are verified against it rather than the system's
+// roots, and certificates clients present are verified against it.
+// Peers must present one to reach raft, RPCs and stream fetches, so
+// they authenticate each other: mutual TLS. API clients need not.
+func LoadTLSConfig(cert, key, ca string) (*tls.Config, error) {
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, INVALID_TLS_CA
+		}
+
+		config.RootCAs = pool
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+// Serves HTTP, raft, RPCs and gRPC over TLS, and calls peers with it,
+// so every member of the cluster must be given a config. Must be set
+// before the node starts.
+func (n *Node) SetTLSConfig(c *tls.Config) {
+	n.tls = c
+	n.retry.TLS = c
+	n.db.reader.retry.TLS = c
+}
+
+// Refuses requests without a certificate signed by the config's CA, if
+// it has one, so only peers reach the handler.
+func (n *Node) peersOnly(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if n.tls != nil && n.tls.ClientCAs != nil && (req.TLS == nil || len(req.TLS.VerifiedChains) == 0) {
+			Deny(w, FORBIDDEN)
+			return
+		}
+
+		handler(w, req)
+	}
+}
+
+// Guards RPCs, which join and remove members, so need a peer's
+// certificate, if they're verified, or an API key with the admin
+// operation, if keys are. Without either, any request is served.
+func (n *Node) peersOrAdmins(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		verifying := n.tls != nil && n.tls.ClientCAs != nil
+
+		if verifying && req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+			handler(w, req)
+			return
+		}
+
+		if n.auth != nil {
+			if _, ok := n.auth.Authorize(w, req, ADMIN); !ok {
+				return
+			}
+		} else if verifying {
+			Deny(w, FORBIDDEN)
+			return
+		}
+
+		handler(w, req)
+	}
+}
+
+// Registers raft's handlers as peer only.
+type peerMux struct {
+	n *Node
+}
+
+func (m peerMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.n.HandleFunc(pattern, m.n.peersOnly(handler))
+}
+
+// The scheme of the node's connection strings.
+func (n *Node) scheme() string {
+	if n.tls != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// The connection string peers and clients reach the node at.
+func (n *Node) uri() string {
+	return fmt.Sprintf("%s://%s:%d", n.scheme(), n.host, n.port)
+}
+
+// The host:port of a connection string, for RPCs.
+func hostOf(connectionString string) string {
+	for _, scheme := range []string{"http://", "https://"} {
+		if strings.HasPrefix(connectionString, scheme) {
+			return connectionString[len(scheme):]
+		}
+	}
+
+	return connectionString
+}
+
+// Connects to the host, over TLS if given a config. Zero means no timeout.
+func dial(host string, config *tls.Config, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	if config != nil {
+		// RPCs are served by hijacking HTTP/1 connections.
+		config = config.Clone()
+		config.NextProtos = []string{"http/1.1"}
+
+		return tls.DialWithDialer(dialer, "tcp", host, config)
+	}
+
+	return dialer.Dial("tcp", host)
+}
@@ -0,0 +1,199 @@
+package cluster
+
+import (
+	"github.com/jrallison/raft"
+
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a CA, and a certificate for localhost it signed, to the dir.
+func writeCertificates(t *testing.T, dir string) (cert, key, ca string) {
+	write := func(name, kind string, der []byte) string {
+		path := filepath.Join(dir, name)
+
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "esdb test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	nodeTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	nodeDer, err := x509.CreateCertificate(rand.Reader, nodeTemplate, caTemplate, &nodeKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, _ := x509.MarshalECPrivateKey(nodeKey)
+
+	return write("node.pem", "CERTIFICATE", nodeDer), write("node.key", "EC PRIVATE KEY", keyDer), write("ca.pem", "CERTIFICATE", caDer)
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	os.RemoveAll("tmp/tls")
+	os.MkdirAll("tmp/tls", 0755)
+
+	cert, key, ca := writeCertificates(t, "tmp/tls")
+
+	config, err := LoadTLSConfig(cert, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ClientAuth != tls.NoClientCert || config.RootCAs != nil {
+		t.Errorf("Expected client certificates not to be required without a CA")
+	}
+
+	if config, err = LoadTLSConfig(cert, key, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ClientAuth != tls.VerifyClientCertIfGiven || config.ClientCAs == nil || config.RootCAs == nil {
+		t.Errorf("Expected peers to be verified with the CA")
+	}
+
+	if _, err = LoadTLSConfig(cert, key, key); err != INVALID_TLS_CA {
+		t.Errorf("Wrong error for a CA without certificates: %v", err)
+	}
+}
+
+func TestNodeServesTLS(t *testing.T) {
+	os.RemoveAll("tmp")
+	os.MkdirAll("tmp/tls", 0755)
+
+	cert, key, ca := writeCertificates(t, "tmp/tls")
+
+	config, err := LoadTLSConfig(cert, key, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, _ := NewNode("tmp/teststream", "localhost", 0)
+	n.SetListener(l)
+	n.SetTLSConfig(config)
+
+	go n.Start("")
+	defer n.Stop()
+
+	for n.raft == nil || !n.raft.Running() {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if uri := n.State().Uri; uri[:len("https://")] != "https://" {
+		t.Errorf("Expected an https connection string, got: %v", uri)
+	}
+
+	resp, err := n.retry.httpClient().Get(n.State().Uri + "/cluster/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("Wrong status: %v", resp.StatusCode)
+	}
+
+	// API clients need not present a certificate, but peers must.
+	anonymous := RetryPolicy{TLS: &tls.Config{RootCAs: config.RootCAs}}
+
+	if resp, err = anonymous.httpClient().Get(n.State().Uri + "/cluster/status"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected an API request without a client certificate to be served, got: %v", resp.StatusCode)
+	}
+
+	for _, path := range []string{"/streams", "/stream/0", rpc.DefaultRPCPath, "/raft/appendEntries"} {
+		if resp, err = anonymous.httpClient().Get(n.State().Uri + path); err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != 403 {
+			t.Errorf("Expected %v to be refused without a client certificate, got: %v", path, resp.StatusCode)
+		}
+	}
+
+	if resp, err = n.retry.httpClient().Get(n.State().Uri + "/streams"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode == 403 {
+		t.Errorf("Expected peers to reach /streams")
+	}
+
+	if resp, err = http.Get("http://" + hostOf(n.State().Uri) + "/cluster/status"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != 400 {
+		t.Errorf("Expected plaintext requests to be refused, got: %v", resp.StatusCode)
+	}
+
+	client, call, err := ping(&raft.Peer{ConnectionString: n.State().Uri}, "", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	if c := <-call.Done; c.Error != nil || c.Reply.(*NodeState).Name != n.name {
+		t.Errorf("Wrong RPC reply over TLS: %v %v", c.Error, c.Reply)
+	}
+}
@@ -0,0 +1,157 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+	"github.com/customerio/esdb/stream"
+	"github.com/jrallison/raft"
+
+	"bytes"
+	"sort"
+)
+
+// Tombstone marks the position in the log at which an index value
+// was deleted. Any event with the index value written before that
+// position is hidden from scans, and removed when its stream is
+// next compressed.
+type Tombstone struct {
+	Commit uint64 `json:"commit"`
+	Offset int64  `json:"offset"`
+}
+
+// Tombstones are keyed by "index:value". They're shared with readers
+// scanning concurrently, so are replaced rather than modified.
+type Tombstones map[string]Tombstone
+
+// Whether the event, read from the stream starting at
+// the given commit, was deleted by one of the tombstones.
+func (t Tombstones) Hides(commit uint64, e *stream.Event) bool {
+	if len(t) == 0 {
+		return false
+	}
+
+	for name, value := range e.Indexes() {
+		if tomb, ok := t[name+":"+value]; ok {
+			if commit < tomb.Commit || (commit == tomb.Commit && e.Offset < tomb.Offset) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type DeleteCommand struct {
+	Index     string `json:"index"`
+	Value     string `json:"value"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func NewDeleteCommand(index, value string, timestamp int64) *DeleteCommand {
+	return &DeleteCommand{
+		Index:     index,
+		Value:     value,
+		Timestamp: timestamp,
+	}
+}
+
+func (c *DeleteCommand) CommandName() string {
+	return "delete"
+}
+
+func (c *DeleteCommand) Apply(context raft.Context) (interface{}, error) {
+	server := context.Server()
+	db := server.Context().(*DB)
+
+	if db.ReadOnly() {
+		return new(interface{}), READ_ONLY_ERROR
+	}
+
+	db.Delete(db.commit(context.CurrentIndex()), c.Index, c.Value)
+
+	return new(interface{}), nil
+}
+
+// Deletes every event written so far with the given index value.
+func (db *DB) Delete(commit uint64, index, value string) {
+	if commit <= db.current {
+		// old commit, the tombstone was restored from a snapshot.
+		return
+	}
+
+	tombstones := make(Tombstones, len(db.tombstones)+1)
+
+	for key, tomb := range db.tombstones {
+		tombstones[key] = tomb
+	}
+
+	tombstones[index+":"+value] = Tombstone{db.current, db.Offset()}
+
+	db.tombstones = tombstones
+	db.revision = commit
+}
+
+// Once streams are compressed, any events hidden by tombstones
+// within them have been removed, so the tombstones only need to
+// hide events in earlier streams.
+func (db *DB) compressTombstones(start, stop uint64) {
+	tombstones := make(Tombstones, len(db.tombstones))
+
+	for key, tomb := range db.tombstones {
+		if tomb.Commit >= start && tomb.Commit <= stop {
+			tomb = Tombstone{start, 0}
+		}
+
+		tombstones[key] = tomb
+	}
+
+	db.tombstones = tombstones
+}
+
+func writeTombstones(buf *bytes.Buffer, tombstones Tombstones) {
+	keys := make([]string, 0, len(tombstones))
+	for key := range tombstones {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	binary.WriteUvarint(buf, len(keys))
+
+	for _, key := range keys {
+		tomb := tombstones[key]
+
+		binary.WriteUvarint(buf, len(key))
+		buf.WriteString(key)
+		binary.WriteInt64(buf, int64(tomb.Commit))
+		binary.WriteInt64(buf, tomb.Offset)
+	}
+}
+
+func readTombstones(buf *bytes.Buffer) (Tombstones, error) {
+	tombstones := make(Tombstones)
+
+	// Snapshots taken before deletes were supported have no tombstones.
+	if buf.Len() == 0 {
+		return tombstones, nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var key string
+		var commit, offset int64
+
+		if key, err = binary.ReadStringMax(buf, int64(buf.Len())); err != nil {
+			break
+		}
+
+		if commit, err = binary.ReadInt64Full(buf); err != nil {
+			break
+		}
+
+		offset, err = binary.ReadInt64Full(buf)
+		tombstones[key] = Tombstone{uint64(commit), offset}
+	}
+
+	return tombstones, err
+}
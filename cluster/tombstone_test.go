@@ -0,0 +1,136 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+	"github.com/customerio/esdb/stream"
+
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDeletingEvents(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("a"), map[string]string{"customer": "1"})
+		trackevent(n, []byte("b"), map[string]string{"customer": "2"})
+		trackevent(n, []byte("c"), map[string]string{"customer": "1", "type": "t"})
+
+		if err := n.Delete("customer", "1"); err != nil {
+			t.Errorf("Unexpected error deleting events: %v", err)
+		}
+
+		trackevent(n, []byte("d"), map[string]string{"customer": "1", "type": "t"})
+
+		scanned := func(index, value string) []string {
+			found := make([]string, 0)
+
+			n.db.Scan(index, value, 0, "", func(e *stream.Event) bool {
+				found = append(found, string(e.Data))
+				return true
+			})
+
+			return found
+		}
+
+		iterated := func() []string {
+			found := make([]string, 0)
+
+			n.db.Iterate(0, "", func(e *stream.Event) bool {
+				found = append(found, string(e.Data))
+				return true
+			})
+
+			return found
+		}
+
+		if found := scanned("customer", "1"); !reflect.DeepEqual(found, []string{"d"}) {
+			t.Errorf("Incorrect scan results. Wanted: %v, found: %v", []string{"d"}, found)
+		}
+
+		if found := scanned("type", "t"); !reflect.DeepEqual(found, []string{"d"}) {
+			t.Errorf("Deleted events should be hidden from other indexes. Wanted: %v, found: %v", []string{"d"}, found)
+		}
+
+		if found := iterated(); !reflect.DeepEqual(found, []string{"b", "d"}) {
+			t.Errorf("Incorrect iterate results. Wanted: %v, found: %v", []string{"b", "d"}, found)
+		}
+
+		last := n.db.closed[len(n.db.closed)-1]
+
+		Merge("tmp/teststream", 1, last, n.db.closed, n.db.tombstones, n.db.deleted)
+		n.Compress(1, last)
+
+		s, _ := stream.Open(n.db.reader.Path(1))
+		stored := make([]string, 0)
+
+		s.Iterate(0, func(e *stream.Event) bool {
+			if !audited(e) {
+				stored = append(stored, string(e.Data))
+			}
+			return true
+		})
+
+		if !reflect.DeepEqual(stored, []string{"b", "d"}) {
+			t.Errorf("Deleted events should be removed when compressing. Wanted: %v, found: %v", []string{"b", "d"}, stored)
+		}
+
+		if found := iterated(); !reflect.DeepEqual(found, []string{"b", "d"}) {
+			t.Errorf("Incorrect iterate results after compressing. Wanted: %v, found: %v", []string{"b", "d"}, found)
+		}
+
+		buf := new(bytes.Buffer)
+		writeTombstones(buf, n.db.tombstones)
+
+		snapshot := buf.Bytes()
+
+		if recovered, err := readTombstones(bytes.NewBuffer(snapshot)); err != nil || !reflect.DeepEqual(recovered, n.db.tombstones) {
+			t.Errorf("Tombstones not recovered from snapshot. Wanted: %v, found: %v %v", n.db.tombstones, recovered, err)
+		}
+
+		if _, err := readTombstones(bytes.NewBuffer(snapshot[:len(snapshot)-1])); err != binary.TRUNCATED {
+			t.Errorf("Expected truncated snapshot error, found: %v", err)
+		}
+	})
+}
+
+func TestSoftDeletingEvents(t *testing.T) {
+	withNode(func(n *Node) {
+		n.SetRotateThreshold(1)
+
+		trackevent(n, []byte("a"), map[string]string{"a": "b"})
+		trackevent(n, []byte("b"), map[string]string{"a": "b"})
+		trackevent(n, []byte("c"), map[string]string{"a": "b"})
+
+		var offset int64
+
+		n.db.Scan("a", "b", 0, "", func(e *stream.Event) bool {
+			offset = e.Offset
+			return string(e.Data) != "b"
+		})
+
+		// Event "b" was written to the stream started by "a"'s commit.
+		if err := n.SoftDelete([]EventId{{n.db.closed[1], offset}}); err != nil {
+			t.Errorf("Unexpected error deleting events: %v", err)
+		}
+
+		found := make([]string, 0)
+
+		n.db.Iterate(0, "", func(e *stream.Event) bool {
+			found = append(found, string(e.Data))
+			return true
+		})
+
+		if !reflect.DeepEqual(found, []string{"a", "c"}) {
+			t.Errorf("Incorrect iterate results. Wanted: %v, found: %v", []string{"a", "c"}, found)
+		}
+
+		buf := new(bytes.Buffer)
+		writeDeletions(buf, n.db.deleted)
+
+		if recovered, err := readDeletions(buf); err != nil || !reflect.DeepEqual(recovered, n.db.deleted) {
+			t.Errorf("Deletions not recovered from snapshot. Wanted: %v, found: %v %v", n.db.deleted, recovered, err)
+		}
+	})
+}
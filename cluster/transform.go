@@ -0,0 +1,107 @@
+package cluster
+
+// An event about to be written, as given to a Transformer.
+type PendingEvent struct {
+	Body     []byte
+	Grouping string
+	Indexes  map[string]string
+	Headers  map[string]string
+	// Dropped as a duplicate if recently written. See WithDeduplication.
+	Id string
+}
+
+// Transformer rewrites events on the leader before they're appended to
+// the raft log: normalizing their bodies, deriving further indexes from
+// them, or dropping them altogether by returning false. An error
+// rejects the batch the event was written in.
+//
+// Events are appended as transformed, so every node applies the same
+// events whatever transformers it has, and replaying the log never
+// runs them again. Transformers should be deterministic regardless,
+// so events are transformed the same way whichever node leads.
+type Transformer interface {
+	Transform(event PendingEvent) (PendingEvent, bool, error)
+}
+
+// TransformerFunc adapts a function to a Transformer.
+type TransformerFunc func(event PendingEvent) (PendingEvent, bool, error)
+
+func (f TransformerFunc) Transform(event PendingEvent) (PendingEvent, bool, error) {
+	return f(event)
+}
+
+type transformer struct {
+	prefix string
+	Transformer
+}
+
+// Transforms events with an index whose name has the prefix, as with
+// a Quota, or every event for an empty prefix. Transformers run in the
+// order they're given, each seeing the events as the last left them,
+// before validators check the events as transformed.
+func WithTransformer(prefix string, t Transformer) Option {
+	return func(db *DB) error {
+		db.transformers = append(db.transformers, transformer{prefix, t})
+		return nil
+	}
+}
+
+// Runs every transformer over the events, returning those still to be
+// written once checked as transformed. Each event's indexes are copied
+// first, so those given aren't changed.
+func (db *DB) transform(bodies [][]byte, groupings []string, indexes, headers []map[string]string, ids []string) ([][]byte, []string, []map[string]string, []map[string]string, []string, error) {
+	if len(db.transformers) == 0 {
+		return bodies, groupings, indexes, headers, ids, db.validate(bodies, indexes)
+	}
+
+	keptBodies := make([][]byte, 0, len(bodies))
+	keptGroupings := make([]string, 0, len(bodies))
+	keptIndexes := make([]map[string]string, 0, len(bodies))
+	keptHeaders := make([]map[string]string, 0, len(bodies))
+	keptIds := make([]string, 0, len(bodies))
+
+	for i, body := range bodies {
+		event := PendingEvent{body, groupingAt(groupings, i), make(map[string]string), headersAt(headers, i), idAt(ids, i)}
+
+		if i < len(indexes) {
+			for name, value := range indexes[i] {
+				event.Indexes[name] = value
+			}
+		}
+
+		keep := true
+
+		for _, t := range db.transformers {
+			if t.prefix != "" && !inNamespace(t.prefix, event.Indexes) {
+				continue
+			}
+
+			var err error
+
+			if event, keep, err = t.Transform(event); err != nil {
+				return nil, nil, nil, nil, nil, &ValidationError{i, t.prefix, err.Error()}
+			}
+
+			if !keep {
+				break
+			}
+		}
+
+		if !keep {
+			continue
+		}
+
+		// Positioned as written, though events before were dropped.
+		if err := db.check(i, event.Body, event.Indexes); err != nil {
+			return nil, nil, nil, nil, nil, err
+		}
+
+		keptBodies = append(keptBodies, event.Body)
+		keptGroupings = append(keptGroupings, event.Grouping)
+		keptIndexes = append(keptIndexes, event.Indexes)
+		keptHeaders = append(keptHeaders, event.Headers)
+		keptIds = append(keptIds, event.Id)
+	}
+
+	return keptBodies, keptGroupings, keptIndexes, keptHeaders, keptIds, nil
+}
@@ -0,0 +1,133 @@
+package cluster
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTransformers(t *testing.T) {
+	withNode(func(n *Node) {
+		WithTransformer("acme.", TransformerFunc(func(e PendingEvent) (PendingEvent, bool, error) {
+			if bytes.HasPrefix(e.Body, []byte("debug")) {
+				return e, false, nil
+			}
+
+			if bytes.HasPrefix(e.Body, []byte("bad")) {
+				return e, false, errors.New("bad event")
+			}
+
+			e.Body = bytes.ToUpper(e.Body)
+			e.Indexes["acme.kind"] = string(e.Body[:1])
+
+			return e, true, nil
+		}))(n.db)
+
+		indexes := map[string]string{"acme.customer": "1"}
+
+		if err := n.Event([]byte("abc"), "", indexes); err != nil {
+			t.Fatalf("Expected event to be written, found: %v", err)
+		}
+
+		if !reflect.DeepEqual(indexes, map[string]string{"acme.customer": "1"}) {
+			t.Errorf("Expected the given indexes to be left unchanged, found: %v", indexes)
+		}
+
+		if err := n.Event([]byte("debug"), "", map[string]string{"acme.customer": "1"}); err != nil {
+			t.Errorf("Expected dropped event to succeed, found: %v", err)
+		}
+
+		commit, err := n.WriteEvents(
+			[][]byte{[]byte("debug"), []byte("xyz"), []byte("def")},
+			nil,
+			[]map[string]string{{"acme.customer": "1"}, {"initech.customer": "1"}, {"acme.customer": "1"}},
+			ACK_LEADER,
+		)
+
+		if err != nil || commit == 0 {
+			t.Errorf("Expected events to be written, found: %v %v", commit, err)
+		}
+
+		if _, err := n.WriteEvents([][]byte{[]byte("bad")}, nil, []map[string]string{{"acme.customer": "1"}}, ACK_LEADER); err == nil {
+			t.Errorf("Expected transformer errors to reject the batch")
+		}
+
+		found, _, _ := Query{Index: "acme.customer", Value: "1"}.run(n.db)
+
+		if !reflect.DeepEqual(found, []string{"DEF", "ABC"}) {
+			t.Errorf("Expected transformed events to be written. Wanted: [DEF ABC], found: %v", found)
+		}
+
+		found, _, _ = Query{Index: "acme.kind", Value: "A"}.run(n.db)
+
+		if !reflect.DeepEqual(found, []string{"ABC"}) {
+			t.Errorf("Expected derived index to be written. Wanted: [ABC], found: %v", found)
+		}
+
+		found, _, _ = Query{Index: "initech.customer", Value: "1"}.run(n.db)
+
+		if !reflect.DeepEqual(found, []string{"xyz"}) {
+			t.Errorf("Expected other namespaces to be left alone. Wanted: [xyz], found: %v", found)
+		}
+	})
+}
+
+func TestTransformedEventsAreChecked(t *testing.T) {
+	withNode(func(n *Node) {
+		WithTransformer("", TransformerFunc(func(e PendingEvent) (PendingEvent, bool, error) {
+			switch string(e.Body) {
+			case "drop":
+				return e, false, nil
+			case "audit":
+				e.Indexes[AUDIT_INDEX] = AUDIT_LOG
+			case "expire":
+				e.Indexes[EXPIRES_INDEX] = "soon"
+			case "empty":
+				e.Body = nil
+			}
+
+			return e, true, nil
+		}))(n.db)
+
+		WithValidator("", ValidatorFunc(func(body []byte, indexes map[string]string) error {
+			if len(body) == 0 {
+				return errors.New("empty body")
+			}
+
+			return nil
+		}))(n.db)
+
+		write := func(bodies ...string) error {
+			events := make([][]byte, len(bodies))
+			indexes := make([]map[string]string, len(bodies))
+
+			for i, body := range bodies {
+				events[i], indexes[i] = []byte(body), map[string]string{"a": "1"}
+			}
+
+			_, err := n.WriteEvents(events, nil, indexes, ACK_LEADER)
+			return err
+		}
+
+		if err := write("audit"); err != RESERVED_INDEX {
+			t.Errorf("Expected a reserved index from the transformer to be rejected, found: %v", err)
+		}
+
+		if err := write("expire"); err != INVALID_EXPIRY {
+			t.Errorf("Expected an invalid expiry from the transformer to be rejected, found: %v", err)
+		}
+
+		if err, ok := write("drop", "a", "empty").(*ValidationError); !ok || err.Event != 2 {
+			t.Errorf("Expected the transformed event to be invalid at its position as written, found: %v", err)
+		}
+
+		if err := n.Event([]byte("empty"), "", map[string]string{"a": "1"}); err == nil {
+			t.Errorf("Expected the transformed event to be invalid")
+		}
+
+		if found, _, _ := (Query{Index: "a", Value: "1"}).run(n.db); len(found) != 0 {
+			t.Errorf("Expected no events to be written, found: %v", found)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Returned when an event is written with a value for
+// a unique index which already exists in a retained stream.
+type UniqueConflictError struct {
+	Index string `json:"index"`
+	Value string `json:"value"`
+}
+
+func (e *UniqueConflictError) Error() string {
+	return fmt.Sprintf("Event already exists for unique index %s:%s", e.Index, e.Value)
+}
+
+// The commit of the stream holding each value of a unique index written,
+// keyed by uniqueKey. It's replicated state, kept in
+// snapshots, so every node checks writes against the same values without
+// reading streams, which it may have to fetch from peers.
+type Uniques map[string]uint64
+
+// The name, prefixed by its length so names containing ":" can't
+// collide with other names and values, then the value:
+// "5:email:a@example.com".
+func uniqueKey(name, value string) string {
+	return strconv.Itoa(len(name)) + ":" + name + ":" + value
+}
+
+// Checks each unique index of the given events against the values
+// written to the open stream and every closed stream we're still
+// retaining. Events within the same batch are also checked against
+// each other.
+//
+// This is only ever called while applying raft commands, so
+// every node reaches the same decision for the same log entry.
+func (db *DB) checkUnique(indexes []map[string]string) error {
+	if len(db.UniqueIndexes) == 0 {
+		return nil
+	}
+
+	pending := make(map[string]bool)
+
+	for _, idx := range indexes {
+		for name, value := range idx {
+			if !db.UniqueIndexes[name] {
+				continue
+			}
+
+			key := uniqueKey(name, value)
+
+			if _, exists := db.uniques[key]; exists || pending[key] {
+				return &UniqueConflictError{name, value}
+			}
+
+			pending[key] = true
+		}
+	}
+
+	return nil
+}
+
+// Records the values of unique indexes written to the open stream.
+func (db *DB) recordUnique(indexes map[string]string) {
+	for name, value := range indexes {
+		if db.UniqueIndexes[name] {
+			db.uniques[uniqueKey(name, value)] = db.current
+		}
+	}
+}
+
+// Records the values of events the log replays into a stream closed
+// before the open one. Those already recorded, by the snapshot the
+// node recovered from or by an event written before, are kept, and
+// the events aren't recorded if their write was refused.
+func (db *DB) recordClosed(commit uint64, indexes []map[string]string) {
+	var holding uint64
+
+	// Each stream holds the events after the commit it was rotated at.
+	for _, closed := range db.closed {
+		if closed < commit {
+			holding = closed
+		}
+	}
+
+	if holding == 0 || len(db.UniqueIndexes) == 0 || db.checkUnique(indexes) != nil {
+		return
+	}
+
+	for _, idx := range indexes {
+		for name, value := range idx {
+			if db.UniqueIndexes[name] {
+				db.uniques[uniqueKey(name, value)] = holding
+			}
+		}
+	}
+}
+
+// Moves the values of each stream to the one it was rewritten into.
+func (db *DB) moveUniques(into map[uint64]uint64) {
+	for key, commit := range db.uniques {
+		if to, ok := into[commit]; ok {
+			db.uniques[key] = to
+		}
+	}
+}
+
+// Forgets the values of streams no longer retained, so they can be written again.
+func (db *DB) forgetUniques(commits map[uint64]bool) {
+	for key, commit := range db.uniques {
+		if commits[commit] {
+			delete(db.uniques, key)
+		}
+	}
+}
+
+// [uvarint:count]([uvarint:length][bytes:key][int64:commit])..., sorted by key.
+func writeUniques(buf *bytes.Buffer, uniques Uniques) {
+	keys := make(sort.StringSlice, 0, len(uniques))
+
+	for key := range uniques {
+		keys = append(keys, key)
+	}
+
+	sort.Sort(keys)
+
+	binary.WriteUvarint(buf, len(keys))
+
+	for _, key := range keys {
+		binary.WriteUvarint(buf, len(key))
+		buf.WriteString(key)
+		binary.WriteInt64(buf, int64(uniques[key]))
+	}
+}
+
+// Snapshots before version 3 joined names and values with ":", so
+// their keys are split after the longest of the names which matches.
+func readUniques(buf *bytes.Buffer, version int64, names map[string]bool) (Uniques, error) {
+	uniques := make(Uniques)
+
+	// Snapshots taken before values were recorded have none, so only
+	// values written since are checked.
+	if buf.Len() == 0 {
+		return uniques, nil
+	}
+
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+
+	for i := int64(0); i < count && err == nil; i++ {
+		var key string
+		var commit int64
+
+		if key, err = binary.ReadStringMax(buf, int64(buf.Len())); err != nil {
+			break
+		}
+
+		if commit, err = binary.ReadInt64Full(buf); err != nil {
+			break
+		}
+
+		if version < 3 {
+			if key = upgradeUniqueKey(key, names); key == "" {
+				continue
+			}
+		}
+
+		uniques[key] = uint64(commit)
+	}
+
+	return uniques, err
+}
+
+// The key of a value joined to its name by ":", or "" if none of the
+// names are unique indexes any longer, as its value isn't checked.
+func upgradeUniqueKey(key string, names map[string]bool) string {
+	matched := ""
+
+	for name := range names {
+		if len(name) > len(matched) && strings.HasPrefix(key, name+":") {
+			matched = name
+		}
+	}
+
+	if matched == "" {
+		return ""
+	}
+
+	return uniqueKey(matched, key[len(matched)+1:])
+}
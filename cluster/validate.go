@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"fmt"
+)
+
+// Validator checks an event before it's written, returning an error
+// describing why the event is malformed if it is.
+type Validator interface {
+	Validate(body []byte, indexes map[string]string) error
+}
+
+// ValidatorFunc adapts a function to a Validator.
+type ValidatorFunc func(body []byte, indexes map[string]string) error
+
+func (f ValidatorFunc) Validate(body []byte, indexes map[string]string) error {
+	return f(body, indexes)
+}
+
+// Returned when an event is rejected by a validator. Event is its
+// position in the batch written.
+type ValidationError struct {
+	Event  int
+	Prefix string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Invalid event %d for %q: %v", e.Event, e.Prefix, e.Reason)
+}
+
+type validator struct {
+	prefix string
+	Validator
+}
+
+// Validates events with an index whose name has the prefix, as with a
+// Quota, or every event for an empty prefix. Validators run on the node
+// written to, before events are appended to the raft log, so malformed
+// events never become part of its history. They see events as any
+// transformers left them. See WithTransformer.
+func WithValidator(prefix string, v Validator) Option {
+	return func(db *DB) error {
+		db.validators = append(db.validators, validator{prefix, v})
+		return nil
+	}
+}
+
+// Checks every event against each validator it's within, rejecting
+// the whole batch if any are invalid.
+func (db *DB) validate(bodies [][]byte, indexes []map[string]string) error {
+	for i, body := range bodies {
+		var idx map[string]string
+
+		if i < len(indexes) {
+			idx = indexes[i]
+		}
+
+		if err := db.check(i, body, idx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks the event at the position in its batch as it's to be written:
+// that it has no reserved indexes, a valid expiry, and every validator
+// accepts it.
+func (db *DB) check(i int, body []byte, indexes map[string]string) error {
+	if reserved(indexes) {
+		return RESERVED_INDEX
+	}
+
+	if err := checkExpiry(indexes); err != nil {
+		return err
+	}
+
+	for _, v := range db.validators {
+		if v.prefix != "" && !inNamespace(v.prefix, indexes) {
+			continue
+		}
+
+		if err := v.Validate(body, indexes); err != nil {
+			return &ValidationError{i, v.prefix, err.Error()}
+		}
+	}
+
+	return nil
+}
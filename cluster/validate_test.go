@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidators(t *testing.T) {
+	withNode(func(n *Node) {
+		schema, _ := ParseSchema([]byte(`{"type": "object", "required": ["type"]}`))
+
+		WithValidator("acme.", schema)(n.db)
+		WithValidator("", ValidatorFunc(func(body []byte, indexes map[string]string) error {
+			if len(body) > 32 {
+				return errors.New("body too large")
+			}
+
+			return nil
+		}))(n.db)
+
+		if err := n.Event([]byte(`{"type": "open"}`), "", map[string]string{"acme.customer": "1"}); err != nil {
+			t.Errorf("Expected valid event to be written, found: %v", err)
+		}
+
+		if err := n.Event([]byte("a"), "", map[string]string{"initech.customer": "1"}); err != nil {
+			t.Errorf("Expected other namespaces to be unaffected, found: %v", err)
+		}
+
+		_, err := n.WriteEvents(
+			[][]byte{[]byte(`{"type": "open"}`), []byte(`{}`)},
+			nil,
+			[]map[string]string{{"acme.customer": "1"}, {"acme.customer": "2"}},
+			ACK_LEADER,
+		)
+
+		if e, ok := err.(*ValidationError); !ok || e.Event != 1 || e.Prefix != "acme." {
+			t.Errorf("Expected the second event to be invalid, found: %v", err)
+		}
+
+		if kind := Classify(err); kind.Status != 400 || kind.Code != "invalid_event" {
+			t.Errorf("Expected a 400 invalid_event, found: %+v", kind)
+		}
+
+		if err := n.Event(make([]byte, 64), "", map[string]string{}); err == nil {
+			t.Errorf("Expected events to be checked by validators for every prefix")
+		}
+
+		found, _, _ := Query{Index: "acme.customer", Value: "2"}.run(n.db)
+
+		if len(found) != 0 {
+			t.Errorf("Expected the invalid batch not to be written, found: %v", found)
+		}
+	})
+}
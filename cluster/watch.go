@@ -0,0 +1,32 @@
+package cluster
+
+import (
+	"sync"
+)
+
+// Watch lets goroutines wait for new events to be written. Each call
+// to Changed returns a channel which is closed on the next Notify.
+type Watch struct {
+	changed chan struct{}
+	mutex   sync.Mutex
+}
+
+func NewWatch() *Watch {
+	return &Watch{changed: make(chan struct{})}
+}
+
+func (w *Watch) Changed() <-chan struct{} {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.changed
+}
+
+// Wakes everyone waiting on the current channel.
+func (w *Watch) Notify() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchNotify(t *testing.T) {
+	w := NewWatch()
+
+	changed := w.Changed()
+
+	select {
+	case <-changed:
+		t.Fatalf("Watch changed before notify")
+	default:
+	}
+
+	w.Notify()
+
+	select {
+	case <-changed:
+	default:
+		t.Fatalf("Watch didn't change after notify")
+	}
+
+	select {
+	case <-w.Changed():
+		t.Fatalf("Watch reused closed channel")
+	default:
+	}
+}
+
+func TestPollingForEvents(t *testing.T) {
+	withNode(func(n *Node) {
+		trackevent(n, []byte("a"), map[string]string{"a": "1"})
+
+		q := Query{Index: "a", Value: "2"}
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			trackevent(n, []byte("b"), map[string]string{"a": "1"})
+			trackevent(n, []byte("c"), map[string]string{"a": "2"})
+		}()
+
+		events, _, _, _, err := q.poll(context.Background(), n.db, time.Second)
+		if err != nil {
+			t.Fatalf("Poll failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(events, []string{"c"}) {
+			t.Errorf("Incorrect poll results. Wanted: [c], found: %v", events)
+		}
+
+		start := time.Now()
+
+		events, _, _, _, _ = Query{Index: "a", Value: "3"}.poll(context.Background(), n.db, 50*time.Millisecond)
+
+		if len(events) != 0 || time.Since(start) < 50*time.Millisecond {
+			t.Errorf("Poll returned early with: %v", events)
+		}
+	})
+}
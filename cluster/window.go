@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Window limits scans and iterations to the streams holding events
+// written between two timestamps, in unix nanoseconds, either of which
+// may be 0 to leave that end open.
+//
+// Events don't record when they were written, only their stream's
+// span does, so streams wholly outside the window are skipped and those
+// overlapping it are read in full, including events written shortly
+// outside of it. Streams closed before spans were recorded are always
+// read.
+type Window struct {
+	Since int64
+	Until int64
+}
+
+type windowKey struct{}
+
+// Limits the scans and iterations run with the context to the window.
+func WithWindow(ctx context.Context, since, until int64) context.Context {
+	if since <= 0 && until <= 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, windowKey{}, Window{since, until})
+}
+
+// Whether the stream at the commit can be skipped, as its span is
+// outside the context's window, and whether every stream beyond it in
+// the direction read is too, as streams are written in order, so the
+// read can stop.
+func (r *Reader) outside(ctx context.Context, commit uint64, reverse bool) (skip, past bool) {
+	w, ok := ctx.Value(windowKey{}).(Window)
+	if !ok {
+		return false, false
+	}
+
+	span, known := r.spans[commit]
+
+	if commit == r.current {
+		span, known = r.span, true
+	}
+
+	if !known || span.empty() {
+		return false, false
+	}
+
+	before := w.Since > 0 && span.Last < w.Since
+	after := w.Until > 0 && span.First > w.Until
+
+	if reverse {
+		return before || after, before
+	}
+
+	return before || after, after
+}
+
+// Sets the spans of the closed streams and the current one, so reads
+// can skip those outside their window.
+func (r *Reader) SetSpans(spans Spans, current Span) {
+	r.spans, r.span = spans, current
+}
+
+// The window given by the request's since and until parameters, as
+// RFC 3339 times.
+func formWindow(req *http.Request) (since, until int64, err error) {
+	if since, err = formTime(req, "since"); err == nil {
+		until, err = formTime(req, "until")
+	}
+
+	return
+}
+
+func formTime(req *http.Request, name string) (int64, error) {
+	value := req.FormValue(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, INVALID_TIME
+	}
+
+	return t.UnixNano(), nil
+}
@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"github.com/customerio/esdb/stream"
+
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestScanWindow(t *testing.T) {
+	db := createDb()
+
+	db.Write(2, []byte("a"), "", map[string]string{"a": "1"}, 10)
+	db.Rotate(3, 1)
+	db.Write(4, []byte("b"), "", map[string]string{"a": "1"}, 20)
+	db.Rotate(5, 1)
+	db.Write(6, []byte("c"), "", map[string]string{"a": "1"}, 30)
+
+	var tests = []struct {
+		since, until int64
+		scanned      []string
+		iterated     []string
+	}{
+		{0, 0, []string{"c", "b", "a"}, []string{"a", "b", "c"}},
+		{15, 0, []string{"c", "b"}, []string{"b", "c"}},
+		{0, 25, []string{"b", "a"}, []string{"a", "b"}},
+		{15, 25, []string{"b"}, []string{"b"}},
+		{31, 0, []string{}, []string{}},
+	}
+
+	for i, test := range tests {
+		ctx := WithWindow(context.Background(), test.since, test.until)
+
+		scanned := make([]string, 0)
+		iterated := make([]string, 0)
+
+		continuation, err := db.ScanContext(ctx, "a", "1", 0, "", func(e *stream.Event) bool {
+			scanned = append(scanned, string(e.Data))
+			return true
+		})
+
+		if err != nil || continuation != "" || !reflect.DeepEqual(scanned, test.scanned) {
+			t.Errorf("Case #%v: Incorrect scan. Wanted: %v, found: %v %q %v", i, test.scanned, scanned, continuation, err)
+		}
+
+		_, err = db.IterateContext(ctx, 0, "", func(e *stream.Event) bool {
+			iterated = append(iterated, string(e.Data))
+			return true
+		})
+
+		if err != nil || !reflect.DeepEqual(iterated, test.iterated) {
+			t.Errorf("Case #%v: Incorrect iteration. Wanted: %v, found: %v %v", i, test.iterated, iterated, err)
+		}
+	}
+}
+
+func TestFormWindow(t *testing.T) {
+	req := httptest.NewRequest("GET", "/events?since=1970-01-01T00:00:01Z&until=1970-01-01T00:00:02.5Z", nil)
+
+	if since, until, err := formWindow(req); since != 1e9 || until != 2.5e9 || err != nil {
+		t.Errorf("Wanted: 1s to 2.5s, found: %v %v %v", since, until, err)
+	}
+
+	req = httptest.NewRequest("GET", "/events?since=yesterday", nil)
+
+	if _, _, err := formWindow(req); err != INVALID_TIME {
+		t.Errorf("Wanted: %v, found: %v", INVALID_TIME, err)
+	}
+}
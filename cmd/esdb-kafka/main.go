@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/customerio/esdb/cluster"
+	"github.com/customerio/esdb/ingest"
+
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+var node = flag.String("n", "localhost:4001", "node in the cluster to write to")
+var brokers = flag.String("brokers", "localhost:9092", "comma separated list of kafka brokers")
+var topics = flag.String("topics", "", "comma separated list of topics to consume")
+var mapping = flag.String("mapping", "", "path to JSON topic mapping configuration")
+var checkpoint = flag.String("checkpoint", "kafka.checkpoint", "path to persist consumed offsets")
+var batch = flag.Int("batch", ingest.DEFAULT_BATCH_SIZE, "max # of events written per raft command")
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [arguments]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+
+	flag.Parse()
+
+	if *topics == "" || *mapping == "" {
+		flag.Usage()
+		log.Fatal("topics and mapping are required")
+	}
+
+	log.SetFlags(log.LstdFlags)
+
+	mappings, err := ingest.LoadMappings(*mapping)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cp, err := ingest.OpenCheckpoint(*checkpoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source, err := ingest.NewKafkaSource(strings.Split(*brokers, ","), strings.Split(*topics, ","), cp)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client := cluster.NewClient("http://"+*node, 1)
+	defer client.Close()
+
+	ingester := ingest.New(source, client, mappings, cp)
+	ingester.BatchSize = *batch
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go (func() {
+		<-signals
+		log.Println("Stopping consumers...")
+		source.Close()
+	})()
+
+	if err := ingester.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -7,11 +7,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 )
 
 var node = flag.String("n", "localhost:4001", "url for node")
 var start = flag.Uint64("start", 0, "commit to start merging")
 var stop = flag.Uint64("stop", 0, "commit to stop merging")
+var limit = flag.Int64("io-limit", 0, "bytes of events to merge per second, 0 for no limit")
+var expire = flag.String("expired-before", "", "RFC 3339 time before which expired events are removed, defaulting to the time of the cluster's most recent event")
 
 func init() {
 	flag.Usage = func() {
@@ -45,7 +48,20 @@ func main() {
 		log.Fatal(err)
 	}
 
-	err = cluster.Merge(dbpath, *start, *stop, meta.Closed)
+	// The same for every node merging the same metadata, so their
+	// merged copies match.
+	before := meta.MostRecent
+
+	if *expire != "" {
+		t, err := time.Parse(time.RFC3339, *expire)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		before = t.UnixNano()
+	}
+
+	err = cluster.MergeThrottled(dbpath, *start, *stop, meta.Closed, meta.Tombstones, meta.Deleted, meta.Redactions, cluster.NewThrottle(*limit), before)
 	if err != nil {
 		log.Fatal(err)
 	}
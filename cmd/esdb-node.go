@@ -2,13 +2,17 @@ package main
 
 import (
 	"github.com/customerio/esdb/cluster"
+	"github.com/customerio/esdb/sst"
+	"github.com/customerio/esdb/stream"
 	"github.com/jrallison/raft"
 
 	"flag"
 	"fmt"
 	"log"
 	"math/rand"
+	"net"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -16,8 +20,42 @@ var trace = flag.Bool("trace", false, "Raft trace debugging")
 var debug = flag.Bool("debug", false, "Raft debugging")
 var host = flag.String("h", "localhost", "hostname")
 var port = flag.Int("p", 4001, "port")
+var grpcPort = flag.Int("grpc-port", 0, "port to serve the gRPC API on, 0 to serve only HTTP")
 var join = flag.String("join", "", "host:port of node in a cluster to join")
+var replace = flag.Bool("replace", false, "when joining, replace members registered at this node's address, after re-provisioning it")
+var promote = flag.Bool("promote", false, "start a new cluster from the streams shipped to this standby by esdb-replicate")
+var follow = flag.String("follow", "", "comma separated host:port of a primary cluster's nodes, to serve reads of its streams rather than accept writes")
+var forward = flag.Bool("forward", true, "forward writes sent to this node while a follower to the leader, rather than failing them with not_leader")
+var standalone = flag.Bool("standalone", false, "run a single node without raft")
 var rotate = flag.Int("r", cluster.DEFAULT_ROTATE_THRESHOLD, "rotation threshold in # bytes")
+var indexBlockSize = flag.Int("index-block-size", sst.BlockSize, "bytes in each block of a closed stream's index, larger for disks where seeks are slow")
+var checksums = flag.Bool("checksums", true, "checksum each event written, to detect corruption as events are read")
+var blooms = flag.Bool("bloom-filters", true, "write a bloom filter of each closed stream's index values, so scans skip streams without them")
+var durability = flag.String("durability", "never", "when to sync events written to disk: always, once each write's events are written, interval, or never, leaving it to the OS")
+var syncInterval = flag.Duration("sync-interval", stream.DEFAULT_SYNC_INTERVAL, "how often to sync events written to disk, with -durability interval")
+var retention = flag.Duration("retention", 0, "how long to keep closed streams, after their most recent event, 0 to keep them forever")
+var compactionTarget = flag.Int64("compaction-target", 0, "size in bytes to merge consecutive small closed streams up to, 0 to never compact them")
+var snapshotEntries = flag.Uint64("snapshot-entries", 0, "raft commands to apply between snapshots, besides those taken on rotation, 0 to only snapshot then")
+var snapshotInterval = flag.Duration("snapshot-interval", 0, "longest to go between snapshots while commands are applied, 0 to only snapshot on rotation")
+var timestampIndex = flag.Duration("timestamp-index", 0, "resolution to index events by when they're written at, so they can be scanned in that order across streams, 0 for no timestamp index")
+var dedupWindow = flag.Int("dedup-window", cluster.DEFAULT_DEDUPLICATION_WINDOW, "ids of the most recent events written to remember, dropping events written again with one")
+var unique = flag.String("unique", "", "comma separated list of indexes whose values must be unique")
+var quotas = flag.String("quotas", "", "path to a JSON file of write quotas to enforce by index name prefix")
+var schemas = flag.String("schemas", "", "path to a JSON file of JSON schemas to validate event bodies with by index name prefix")
+var auth = flag.String("auth", "", "path to a JSON file of API keys and roles to enforce")
+var key = flag.String("key", "", "API key to send when fetching streams from peers")
+var tlsCert = flag.String("tls-cert", "", "path to a PEM certificate to serve HTTP, raft and RPCs with over TLS, and present to peers")
+var tlsKey = flag.String("tls-key", "", "path to the PEM private key of -tls-cert")
+var tlsCA = flag.String("tls-ca", "", "path to a PEM CA bundle to verify peers with, requiring raft, RPCs and stream fetches to present a certificate it signed")
+var continuationKey = flag.String("continuation-key", "", "path to a file of the secret to sign continuations with, shared by every node and reader")
+var soft = flag.Float64("soft-watermark", cluster.DEFAULT_SOFT_WATERMARK, "fraction of disk in use above which compressed streams are removed immediately")
+var hard = flag.Float64("hard-watermark", cluster.DEFAULT_HARD_WATERMARK, "fraction of disk in use above which writes are rejected, 0 to disable")
+var limit = flag.Int64("io-limit", 0, "bytes per second of snapshot and stream recovery IO, 0 for no limit")
+var replicas = flag.Int("replicas", 0, "copies of each closed stream to keep across the cluster, 0 for one on every node")
+var queries = flag.Int("max-queries", 0, "most scans to run at once, 0 for no limit")
+var queue = flag.Duration("query-queue-timeout", cluster.DEFAULT_QUERY_QUEUE_TIMEOUT, "how long scans wait to run before they're refused")
+var configFile = flag.String("config", "", "path to a JSON file of settings, keyed by flag name")
+var grace = flag.Duration("shutdown-timeout", 30*time.Second, "how long to wait for requests to finish when stopping")
 
 func init() {
 	flag.Usage = func() {
@@ -31,6 +69,21 @@ func main() {
 
 	flag.Parse()
 
+	config := cluster.Config{}
+
+	if *configFile != "" {
+		c, err := cluster.LoadConfig(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		config = c
+	}
+
+	if err := config.Apply(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
 	if *trace {
 		raft.SetLogLevel(raft.Trace)
 		log.Print("Raft trace debugging enabled.")
@@ -42,25 +95,180 @@ func main() {
 	rand.Seed(time.Now().UnixNano())
 
 	// Set the data directory.
-	if flag.NArg() == 0 {
+	path := flag.Arg(0)
+	if path == "" {
+		path = config.Data()
+	}
+
+	if path == "" {
 		flag.Usage()
 		log.Fatal("Data path argument required")
 	}
 
-	path := flag.Arg(0)
-
 	if err := os.MkdirAll(path, 0744); err != nil {
 		log.Fatalf("Unable to create path: %v", err)
 	}
 
 	log.SetFlags(log.LstdFlags)
 
-	n := cluster.NewNode(path, *host, *port)
+	opts := []cluster.Option{}
 
 	if *rotate > 0 && *rotate != cluster.DEFAULT_ROTATE_THRESHOLD {
 		log.Println("Setting rotation threshold to:", *rotate)
-		n.SetRotateThreshold(int64(*rotate))
+		opts = append(opts, cluster.WithRotateThreshold(int64(*rotate)))
+	}
+
+	if *indexBlockSize != sst.BlockSize || !*checksums || !*blooms {
+		opts = append(opts, cluster.WithStreamOptions(stream.Options{
+			IndexBlockSize: *indexBlockSize,
+			NoChecksums:    !*checksums,
+			NoBloomFilter:  !*blooms,
+		}))
+	}
+
+	if d, err := stream.ParseDurability(*durability); err != nil {
+		log.Fatal(err)
+	} else if d != stream.SYNC_NEVER {
+		log.Println("Syncing events written:", d)
+		opts = append(opts, cluster.WithDurability(d, *syncInterval))
+	}
+
+	if *retention > 0 {
+		log.Println("Keeping closed streams for:", *retention)
+		opts = append(opts, cluster.WithRetention(*retention))
+	}
+
+	if *continuationKey != "" {
+		k, err := cluster.LoadContinuationKey(*continuationKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts = append(opts, cluster.WithContinuationKey(k))
+	}
+
+	if *compactionTarget > 0 {
+		log.Println("Compacting closed streams up to:", *compactionTarget, "bytes")
+		opts = append(opts, cluster.WithCompaction(*compactionTarget))
+	}
+
+	if *timestampIndex > 0 {
+		log.Println("Indexing events by timestamp every:", *timestampIndex)
+		opts = append(opts, cluster.WithTimestampIndex(*timestampIndex))
+	}
+
+	if *snapshotEntries > 0 || *snapshotInterval > 0 {
+		log.Println("Snapshotting every:", *snapshotEntries, "commands or", *snapshotInterval)
+		opts = append(opts, cluster.WithSnapshotPolicy(*snapshotEntries, *snapshotInterval))
+	}
+
+	if *dedupWindow != cluster.DEFAULT_DEDUPLICATION_WINDOW {
+		log.Println("Deduplicating events by the last ids written:", *dedupWindow)
+		opts = append(opts, cluster.WithDeduplication(*dedupWindow))
+	}
+
+	if *unique != "" {
+		log.Println("Enforcing unique indexes:", *unique)
+		opts = append(opts, cluster.WithUniqueIndexes(strings.Split(*unique, ",")...))
+	}
+
+	if *hard > 0 {
+		opts = append(opts, cluster.WithWatermarks(*soft, *hard))
+	}
+
+	if *limit > 0 {
+		opts = append(opts, cluster.WithIOLimit(*limit))
+	}
+
+	if *replicas > 0 {
+		opts = append(opts, cluster.WithReplicas(*replicas))
+	}
+
+	if *queries > 0 {
+		opts = append(opts, cluster.WithQueryLimit(*queries, *queue))
+	}
+
+	if *quotas != "" {
+		q, err := cluster.LoadQuotas(*quotas)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("Enforcing quotas from:", *quotas)
+		opts = append(opts, cluster.WithQuotas(q))
+	}
+
+	if *schemas != "" {
+		s, err := cluster.LoadSchemas(*schemas)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("Validating events with schemas from:", *schemas)
+
+		for prefix, schema := range s {
+			opts = append(opts, cluster.WithValidator(prefix, schema))
+		}
+	}
+
+	if *follow != "" {
+		log.Println("Following primary:", *follow)
+		opts = append(opts, cluster.WithFollow(strings.Split(*follow, ",")...))
+	}
+
+	n, err := cluster.NewNode(path, *host, *port, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *standalone {
+		n.SetStandalone(true)
+	}
+
+	if *replace {
+		n.SetReplace(true)
+	}
+
+	if *promote {
+		n.SetPromote(true)
+	}
+
+	n.SetForwarding(*forward)
+
+	if *tlsCert != "" {
+		c, err := cluster.LoadTLSConfig(*tlsCert, *tlsKey, *tlsCA)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("Serving TLS with:", *tlsCert)
+		n.SetTLSConfig(c)
+	}
+
+	if *auth != "" {
+		a, err := cluster.LoadAuthorizer(*auth)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("Enforcing authorization from:", *auth)
+		n.SetAuthorizer(a, *key)
+	}
+
+	if *grpcPort > 0 {
+		l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", *host, *grpcPort))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		n.SetGRPCListener(l)
+	}
+
+	exit := cluster.ShutdownOnSignal(n.Shutdown, *grace)
+
+	if err := n.Start(*join); err != nil {
+		log.Fatal(err)
 	}
 
-	log.Fatal(n.Start(*join))
+	os.Exit(<-exit)
 }
@@ -4,6 +4,8 @@ import (
 	"github.com/customerio/esdb/cluster"
 	"github.com/customerio/esdb/stream"
 
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -11,12 +13,28 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
-var node = flag.String("n", "localhost:4001", "node to read from")
+var nodes = flag.String("n", "localhost:4001", "comma separated nodes to read from")
+var routing = flag.String("routing", cluster.NEAREST, "how to choose nodes and peers: round-robin, least-outstanding or nearest")
 var host = flag.String("h", "localhost", "hostname")
 var port = flag.Int("p", 4002, "port")
+var auth = flag.String("auth", "", "path to a JSON file of API keys and roles to enforce")
+var key = flag.String("key", "", "API key to send to nodes and peers")
+var tlsCert = flag.String("tls-cert", "", "path to a PEM certificate to serve HTTPS with, and present to nodes and peers")
+var tlsKey = flag.String("tls-key", "", "path to the PEM private key of -tls-cert")
+var tlsCA = flag.String("tls-ca", "", "path to a PEM CA bundle to verify nodes with, and any certificate clients present")
+var continuationKey = flag.String("continuation-key", "", "path to a file of the secret the cluster signs continuations with")
+var corsOrigins = flag.String("cors-origins", "", "comma separated origins allowed to make cross-origin requests, or *")
+var corsMethods = flag.String("cors-methods", "GET", "comma separated methods allowed in cross-origin requests")
+var corsHeaders = flag.String("cors-headers", cluster.API_KEY_HEADER, "comma separated headers allowed in cross-origin requests")
+var queries = flag.Int("max-queries", 0, "most scans to run at once, 0 for no limit")
+var queue = flag.Duration("query-queue-timeout", cluster.DEFAULT_QUERY_QUEUE_TIMEOUT, "how long scans wait to run before they're refused")
+var configFile = flag.String("config", "", "path to a JSON file of settings, keyed by flag name")
+var grace = flag.Duration("shutdown-timeout", 30*time.Second, "how long to wait for requests to finish when stopping")
 
 func init() {
 	flag.Usage = func() {
@@ -30,45 +48,217 @@ func main() {
 
 	flag.Parse()
 
+	config := cluster.Config{}
+
+	if *configFile != "" {
+		c, err := cluster.LoadConfig(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		config = c
+	}
+
+	if err := config.Apply(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
 	// Set the data directory.
-	if flag.NArg() == 0 {
+	path := flag.Arg(0)
+	if path == "" {
+		path = config.Data()
+	}
+
+	if path == "" {
 		flag.Usage()
 		log.Fatal("Data path argument required")
 	}
 
 	log.SetFlags(log.LstdFlags)
 
-	client := cluster.NewLocalClient("http://"+*node, 1)
-	reader := cluster.NewReader(flag.Arg(0))
+	reader := cluster.NewReader(path)
+	if err := reader.SetRouting(*routing); err != nil {
+		log.Fatal(err)
+	}
+
+	reader.SetApiKey(*key)
+
+	if *continuationKey != "" {
+		k, err := cluster.LoadContinuationKey(*continuationKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		reader.SetContinuationKey(k)
+	}
+
+	metrics := cluster.NewMetrics()
+	reader.RegisterMetrics(metrics)
+
+	if err := reader.SetQueryLimit(*queries, *queue); err != nil {
+		log.Fatal(err)
+	}
+
+	var authorizer *cluster.Authorizer
+	if *auth != "" {
+		a, err := cluster.LoadAuthorizer(*auth)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		authorizer = a
+	}
+
+	scheme := "http://"
+	policy := cluster.DefaultRetryPolicy
+
+	var tlsConfig *tls.Config
+	if *tlsCert != "" {
+		c, err := cluster.LoadTLSConfig(*tlsCert, *tlsKey, *tlsCA)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		tlsConfig = c
+		scheme = "https://"
+		policy.TLS = c
+
+		fetch := cluster.DefaultFetchRetryPolicy
+		fetch.TLS = c
+		reader.SetRetryPolicy(fetch)
+	}
+
+	clients := make(map[string]*cluster.LocalClient)
+	for _, node := range strings.Split(*nodes, ",") {
+		clients[node] = cluster.NewLocalClient(scheme+node, 1)
+		clients[node].ApiKey = *key
+		clients[node].SetRetryPolicy(policy)
+	}
 	streams := make(map[uint64]stream.Stream)
 
-	http.HandleFunc("/events", func(w http.ResponseWriter, req *http.Request) {
+	var cors *cluster.CORS
+	if *corsOrigins != "" {
+		cors = &cluster.CORS{
+			Origins: strings.Split(*corsOrigins, ","),
+			Methods: strings.Split(*corsMethods, ","),
+			Headers: strings.Split(*corsHeaders, ","),
+		}
+	}
+
+	// Fetches the streams' metadata, so the reader scans them as they are
+	// now, returning the continuation of the index value's newest event.
+	refresh := func(index, value string) (*cluster.Metadata, string, error) {
+		meta, con, err := offset(reader, clients, index, value)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		reader.Update(meta.Peers, meta.Closed, meta.Current, currentStream(reader, streams, meta.Current))
+		reader.SetTombstones(meta.Tombstones)
+		reader.SetDeleted(meta.Deleted)
+		reader.SetRedactions(meta.Redactions)
+		reader.SetRevision(meta.Revision)
+		reader.SetRewrites(meta.Rewrites)
+		reader.SetSpans(meta.Spans, meta.Span)
+
+		return meta, con, nil
+	}
+
+	route("/events", cors.Handle(func(w http.ResponseWriter, req *http.Request) {
+		req.Body.Close()
+
+		role, ok := authorizer.Authorize(w, req, cluster.READ)
+		if !ok {
+			return
+		}
+
+		q, err := cluster.ParseQuery(req)
+		if err != nil {
+			fail(w, map[string]interface{}{}, err)
+			return
+		}
+
+		if !q.AllowedBy(role) {
+			cluster.Deny(w, cluster.FORBIDDEN)
+			return
+		}
+
+		meta, con, err := refresh(q.Scope())
+
+		if err != nil {
+			fail(w, map[string]interface{}{}, err)
+			return
+		}
+
+		res, err := reader.RunQuery(w, req, q, con)
+
+		// Not modified since the request's ETag.
+		if res == nil && err == nil {
+			return
+		}
+
+		// Scans which couldn't start are reported without results, while
+		// those which failed part way report what they found beforehand.
+		if err != nil && (cluster.Classify(err).Status < 500 || err == cluster.OVERLOADED) {
+			fail(w, map[string]interface{}{}, err)
+			return
+		}
+
+		res.MostRecent = meta.MostRecent
+
+		if err != nil {
+			cluster.Fail(w, err)
+			encode(w, res.WithError(err))
+			return
+		}
+
+		write(w, 200, res)
+	}))
+
+	// Streams every event the scan finds as it's found, rather than a
+	// page of them, with heartbeats while there are none. See
+	// cluster.EventStream for the formats.
+	route("/events/stream", cors.Handle(func(w http.ResponseWriter, req *http.Request) {
 		req.Body.Close()
 
+		role, ok := authorizer.Authorize(w, req, cluster.READ)
+		if !ok {
+			return
+		}
+
 		var count int
-		var err error
 
-		index := req.FormValue("index")
-		value := req.FormValue("value")
+		index, value, grouping := scanIndex(req)
 		after, _ := strconv.ParseInt(req.FormValue("after"), 10, 64)
 		continuation := req.FormValue("continuation")
+		// Streamed scans have no limit unless one is given.
 		limit, _ := strconv.Atoi(req.FormValue("limit"))
 
-		meta, con, err := client.Offset(index, value)
-		if err != nil {
-			write(w, 500, map[string]interface{}{
-				"error": err.Error(),
-			})
+		if !role.Allows(index, value) {
+			cluster.Deny(w, cluster.FORBIDDEN)
+			return
+		}
+
+		meta, con, err := refresh(index, value)
 
+		if err != nil {
+			fail(w, map[string]interface{}{}, err)
 			return
 		}
 
-		reader.Update(meta.Peers, meta.Closed, meta.Current, currentStream(reader, streams, meta.Current))
+		ctx, cancel := cluster.QueryContext(req)
+		defer cancel()
 
-		events := make([]string, 0, limit)
+		events, err := cluster.NewEventStream(w, req.FormValue("format"), cluster.STREAM_HEARTBEAT)
+		if err != nil {
+			fail(w, map[string]interface{}{}, err)
+			return
+		}
 
-		if limit == 0 {
-			limit = 20
+		send := func(e *stream.Event) bool {
+			count += 1
+			return events.Send(e) && (limit <= 0 || count < limit)
 		}
 
 		if index != "" {
@@ -76,37 +266,107 @@ func main() {
 				continuation = con
 			}
 
-			continuation, err = reader.Scan(index, value, uint64(after), continuation, func(e *stream.Event) bool {
-				count += 1
-				events = append(events, string(e.Data))
-				return count < limit
+			continuation, err = reader.ScanContext(ctx, index, value, uint64(after), continuation, func(e *stream.Event) bool {
+				if grouping != "" && e.Grouping() != grouping {
+					return true
+				}
+
+				return send(e)
 			})
 		} else {
-			continuation, err = reader.Iterate(uint64(after), continuation, func(e *stream.Event) bool {
-				count += 1
-				events = append(events, string(e.Data))
-				return count < limit
-			})
+			continuation, err = reader.IterateContext(ctx, uint64(after), continuation, send)
 		}
 
 		res := map[string]interface{}{
-			"events":       events,
 			"continuation": continuation,
 			"most_recent":  meta.MostRecent,
+			"count":        count,
 		}
 
-		if err != nil {
-			res["error"] = err.Error()
-			write(w, 500, res)
+		if ctx.Err() == context.DeadlineExceeded {
+			res["partial"] = true
 		}
 
-		write(w, 200, res)
+		events.End(res, err)
+	}))
+
+	route("/peers", cors.Handle(func(w http.ResponseWriter, req *http.Request) {
+		req.Body.Close()
+
+		if _, ok := authorizer.Authorize(w, req, cluster.READ); !ok {
+			return
+		}
+
+		write(w, 200, map[string]interface{}{
+			"peers": reader.PeerStatus(),
+		})
+	}))
+
+	route("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		req.Body.Close()
+
+		if _, ok := authorizer.Authorize(w, req, cluster.READ); !ok {
+			return
+		}
+
+		metrics.ServeHTTP(w, req)
 	})
 
-	err := http.ListenAndServe(fmt.Sprintf("%s:%d", *host, *port), nil)
-	if err != nil {
+	server := &http.Server{Addr: fmt.Sprintf("%s:%d", *host, *port), TLSConfig: tlsConfig.Clone()}
+
+	exit := cluster.ShutdownOnSignal(func(ctx context.Context) error {
+		err := server.Shutdown(ctx)
+		reader.Close()
+		return err
+	}, *grace)
+
+	var err error
+
+	// Certificates are already loaded into the config.
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+
+	if err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+
+	os.Exit(<-exit)
+}
+
+// Fetches stream metadata from the nodes in the order preferred by the
+// reader's routing strategy, falling back to the next when one fails.
+func offset(r *cluster.Reader, clients map[string]*cluster.LocalClient, index, value string) (meta *cluster.Metadata, con string, err error) {
+	nodes := make([]string, 0, len(clients))
+	for node := range clients {
+		nodes = append(nodes, node)
+	}
+
+	for _, node := range r.Route(nodes) {
+		done := r.BeginRequest(node)
+		meta, con, err = clients[node].Offset(index, value)
+		done(err)
+
+		if err == nil {
+			return
+		}
+	}
+
+	return
+}
+
+// The index value requested, and grouping to limit it to. Scanning a
+// grouping is just scanning its reserved index.
+func scanIndex(req *http.Request) (index, value, grouping string) {
+	index, value, grouping = req.FormValue("index"), req.FormValue("value"), req.FormValue("grouping")
+
+	if index == "" && grouping != "" {
+		index, value, grouping = stream.GROUPING_INDEX, grouping, ""
+	}
+
+	return
 }
 
 var open sync.Mutex
@@ -127,9 +387,28 @@ func currentStream(r *cluster.Reader, streams map[uint64]stream.Stream, current
 	return streams[current]
 }
 
-func write(w http.ResponseWriter, code int, body map[string]interface{}) {
+func write(w http.ResponseWriter, code int, body interface{}) {
 	w.WriteHeader(code)
+	encode(w, body)
+}
+
+// Responds with the error, along with the rest of the response.
+func fail(w http.ResponseWriter, res map[string]interface{}, err error) {
+	for name, value := range cluster.Fail(w, err) {
+		res[name] = value
+	}
+
+	encode(w, res)
+}
+
+func encode(w http.ResponseWriter, body interface{}) {
 	js, _ := json.MarshalIndent(body, "", "  ")
 	w.Write(js)
 	w.Write([]byte("\n"))
 }
+
+// Serves the handler at the pattern, and at it within the versioned API.
+func route(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	http.HandleFunc(pattern, handler)
+	http.HandleFunc(cluster.API_VERSION+pattern, cluster.Versioned(handler))
+}
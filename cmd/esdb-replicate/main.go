@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/customerio/esdb/cluster"
+
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+var nodes = flag.String("n", "localhost:4001", "comma separated nodes of the primary cluster")
+var key = flag.String("key", "", "API key to send to the primary's nodes")
+var interval = flag.Duration("interval", cluster.DEFAULT_REPLICATION_INTERVAL, "how often to ship newly closed streams")
+var limit = flag.Int64("io-limit", 0, "bytes per second of streams shipped, 0 for no limit")
+var status = flag.String("status", "", "host:port to serve replication lag on, at /status")
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [arguments] <standby-data-path>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+
+	flag.Parse()
+
+	path := flag.Arg(0)
+	if path == "" {
+		flag.Usage()
+		log.Fatal("Standby data path argument required")
+	}
+
+	log.SetFlags(log.LstdFlags)
+
+	primary := make([]string, 0)
+	for _, node := range strings.Split(*nodes, ",") {
+		primary = append(primary, "http://"+node)
+	}
+
+	r, err := cluster.NewReplicator(primary, path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r.SetApiKey(*key)
+
+	if err := r.SetIOLimit(*limit); err != nil {
+		log.Fatal(err)
+	}
+
+	if *status != "" {
+		http.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
+			js, _ := json.MarshalIndent(r.Status(), "", "  ")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(js)
+			w.Write([]byte("\n"))
+		})
+
+		go func() {
+			log.Fatal(http.ListenAndServe(*status, nil))
+		}()
+	}
+
+	stop := make(chan struct{})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		log.Println("Received", <-signals, "stopping")
+		close(stop)
+	}()
+
+	log.Println("Replicating", primary, "to", path)
+
+	r.Run(*interval, stop)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/customerio/esdb/cluster"
+
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [arguments] <backup.tar> <data-path> \n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		flag.Usage()
+		log.Fatal("Backup and data path arguments required")
+	}
+
+	backup, path := flag.Arg(0), flag.Arg(1)
+
+	f, err := os.Open(backup)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer f.Close()
+
+	manifest, err := cluster.RestoreBackup(f, path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("Restored", len(manifest.Metadata.Closed), "closed streams and the open stream at", manifest.Metadata.Current, "backed up at", manifest.Created)
+	log.Println("Start a node on", path, "with -promote to start a cluster from them")
+}
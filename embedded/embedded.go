@@ -0,0 +1,136 @@
+// Package embedded runs the event stream database within another Go
+// service, without raft or the HTTP API. Events are written to
+// streams which rotate as they grow, and can be scanned by index
+// value or grouping, or iterated in the order they were written.
+//
+//	db, err := embedded.Open("/var/lib/events", nil)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	defer db.Close()
+//
+//	db.Write([]byte("signed up"), "customer-1", map[string]string{"type": "signup"})
+//
+//	db.Scan("type", "signup", "", func(e *embedded.Event) bool {
+//		fmt.Println(string(e.Data))
+//		return true
+//	})
+//
+// Only one process may open a directory at a time.
+package embedded
+
+import (
+	"github.com/customerio/esdb/cluster"
+	"github.com/customerio/esdb/stream"
+
+	"context"
+	"time"
+)
+
+const DEFAULT_CLOSE_TIMEOUT = 30 * time.Second
+
+type Options struct {
+	// Size in bytes at which the open stream is closed and a new one
+	// started. Defaults to cluster.DEFAULT_ROTATE_THRESHOLD.
+	RotateThreshold int64
+	// Indexes whose values must be unique across every event.
+	UniqueIndexes []string
+	// Fractions of the disk in use above which compressed streams are
+	// removed, and writes rejected. Ignored unless HardWatermark is set.
+	SoftWatermark float64
+	HardWatermark float64
+}
+
+// An event read from the database. The data mustn't be modified.
+type Event struct {
+	Data []byte
+}
+
+// Scanners are given each event in turn, until they return false.
+type Scanner func(*Event) bool
+
+type DB struct {
+	node *cluster.Node
+}
+
+// Opens the database in the given directory, creating it if needed,
+// and recovering anything written before it was last closed.
+func Open(dir string, opts *Options) (*DB, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	options := []cluster.Option{}
+
+	if opts.RotateThreshold > 0 {
+		options = append(options, cluster.WithRotateThreshold(opts.RotateThreshold))
+	}
+
+	if len(opts.UniqueIndexes) > 0 {
+		options = append(options, cluster.WithUniqueIndexes(opts.UniqueIndexes...))
+	}
+
+	if opts.HardWatermark > 0 {
+		options = append(options, cluster.WithWatermarks(opts.SoftWatermark, opts.HardWatermark))
+	}
+
+	n, err := cluster.NewNode(dir, "localhost", 0, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = n.Open(); err != nil {
+		return nil, err
+	}
+
+	return &DB{n}, nil
+}
+
+// Writes an event, with an optional grouping, indexed by the given values.
+func (db *DB) Write(data []byte, grouping string, indexes map[string]string) error {
+	return db.node.Event(data, grouping, indexes)
+}
+
+// Writes the events together, so either all or none are written.
+func (db *DB) WriteAll(data [][]byte, groupings []string, indexes []map[string]string) error {
+	return db.node.Events(data, groupings, indexes)
+}
+
+// Scans events with the given index value, most recent first, from
+// the continuation of a previous scan or the most recent if empty.
+// Returns the continuation to resume the scan from.
+func (db *DB) Scan(index, value, continuation string, scanner Scanner) (string, error) {
+	return db.node.DB().Scan(index, value, 0, continuation, wrap(scanner))
+}
+
+// Scans events in the grouping, most recent first.
+func (db *DB) ScanGrouping(grouping, continuation string, scanner Scanner) (string, error) {
+	return db.node.DB().ScanGrouping(grouping, 0, continuation, wrap(scanner))
+}
+
+// Iterates over every event in the order they were written, from the
+// continuation of a previous iteration or the first event if empty.
+func (db *DB) Iterate(continuation string, scanner Scanner) (string, error) {
+	return db.node.DB().Iterate(0, continuation, wrap(scanner))
+}
+
+// Returns a continuation to iterate from the first event
+// written at or after the given time.
+func (db *DB) ContinuationAt(t time.Time) string {
+	return db.node.DB().ContinuationAt(t.UnixNano())
+}
+
+// Syncs everything written to disk and closes the database.
+func (db *DB) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_CLOSE_TIMEOUT)
+	defer cancel()
+
+	return db.node.Shutdown(ctx)
+}
+
+func wrap(scanner Scanner) stream.Scanner {
+	return func(e *stream.Event) bool {
+		return scanner(&Event{Data: e.Data})
+	}
+}
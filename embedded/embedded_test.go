@@ -0,0 +1,74 @@
+package embedded
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func scan(db *DB, index, value string) []string {
+	found := make([]string, 0)
+
+	db.Scan(index, value, "", func(e *Event) bool {
+		found = append(found, string(e.Data))
+		return true
+	})
+
+	return found
+}
+
+func TestEmbeddedDB(t *testing.T) {
+	os.RemoveAll("tmp")
+	defer os.RemoveAll("tmp")
+
+	db, err := Open("tmp/db", &Options{RotateThreshold: 1})
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+
+	db.Write([]byte("a"), "1", map[string]string{"type": "page"})
+	db.Write([]byte("b"), "2", map[string]string{"type": "click"})
+	db.Write([]byte("c"), "1", map[string]string{"type": "page"})
+
+	if found := scan(db, "type", "page"); !reflect.DeepEqual(found, []string{"c", "a"}) {
+		t.Errorf("Incorrect scan results. Wanted: [c a], found: %v", found)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	if db, err = Open("tmp/db", nil); err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+
+	defer db.Close()
+
+	db.Write([]byte("d"), "2", map[string]string{"type": "page"})
+
+	if found := scan(db, "type", "page"); !reflect.DeepEqual(found, []string{"d", "c", "a"}) {
+		t.Errorf("Incorrect scan results after reopening. Wanted: [d c a], found: %v", found)
+	}
+
+	grouped := make([]string, 0)
+
+	db.ScanGrouping("2", "", func(e *Event) bool {
+		grouped = append(grouped, string(e.Data))
+		return true
+	})
+
+	if !reflect.DeepEqual(grouped, []string{"d", "b"}) {
+		t.Errorf("Incorrect grouping results. Wanted: [d b], found: %v", grouped)
+	}
+
+	iterated := make([]string, 0)
+
+	db.Iterate("", func(e *Event) bool {
+		iterated = append(iterated, string(e.Data))
+		return true
+	})
+
+	if !reflect.DeepEqual(iterated, []string{"a", "b", "c", "d"}) {
+		t.Errorf("Incorrect iteration results. Wanted: [a b c d], found: %v", iterated)
+	}
+}
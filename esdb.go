@@ -2,6 +2,7 @@ package esdb
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"sync"
 
@@ -12,6 +13,8 @@ import (
 
 // TODO Verify(file string) bool
 
+var CORRUPTED_FOOTER = errors.New("corrupted footer, index length exceeds the file's size")
+
 type Db struct {
 	file          *os.File
 	index         *sst.Reader
@@ -84,8 +87,17 @@ func (db *Db) Close() {
 func findIndex(f *os.File) (*sst.Reader, error) {
 	// The last 8 bytes in the file is the length
 	// of the SSTable spaces index.
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
 	f.Seek(-8, 2)
 	indexLen := binary.ReadInt64(f)
 
+	if indexLen < 0 || indexLen > info.Size()-8 {
+		return nil, CORRUPTED_FOOTER
+	}
+
 	return sst.NewReader(bounded.New(f, -8-indexLen, -8), indexLen)
 }
@@ -94,6 +94,40 @@ func TestSpaceIndexes(t *testing.T) {
 	}
 }
 
+func TestChecksummedDb(t *testing.T) {
+	createDb().Close()
+	plain, _ := os.Stat("tmp/test.esdb")
+
+	os.Remove("tmp/checksummed.esdb")
+
+	w, err := New("tmp/checksummed.esdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.SetChecksums(true)
+	populate(w)
+
+	if err = w.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open("tmp/checksummed.esdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if found := fetchSpaceIndex(db, []byte("a"), "i", "i1"); !reflect.DeepEqual(found, []string{"1", "3"}) {
+		t.Errorf("Wrong events read with checksums. wanted: [1 3], found: %v", found)
+	}
+
+	if checksummed, _ := os.Stat("tmp/checksummed.esdb"); checksummed.Size() <= plain.Size() {
+		t.Errorf("Expected blocks to be written with checksums")
+	}
+}
+
 func TestSpaceIteration(t *testing.T) {
 	db := createDb()
 
@@ -2,6 +2,7 @@ package esdb
 
 import (
 	"io"
+	"runtime"
 	"sort"
 
 	"github.com/customerio/esdb/blocks"
@@ -11,14 +12,18 @@ import (
 // grouping to the file in timestamp descending order.
 // Marks the event with which block it's located in,
 // as well as the offset within the block.
-func writeEventBlocks(i *index, out io.Writer) {
+// With checksums, each block is followed by one.
+func writeEventBlocks(i *index, out io.Writer, checksums bool) {
 	sort.Stable(sort.Reverse(i.evs))
 
 	writer := blocks.NewWriter(out, 4096)
+	writer.SetConcurrency(runtime.NumCPU())
+	writer.SetChecksums(checksums)
 
 	for _, event := range i.evs {
-		// mark event with the current location in the file.
-		event.block = i.offset + int64(writer.Written)
+		// mark event with the current block, whose location in
+		// the file is only known once it's been compressed.
+		event.block = int64(writer.Block())
 		event.offset = writer.Buffered()
 
 		// push the encoded event onto the buffer.
@@ -30,5 +35,9 @@ func writeEventBlocks(i *index, out io.Writer) {
 
 	writer.Flush()
 
+	for _, event := range i.evs {
+		event.block = i.offset + int64(writer.Offset(int(event.block)))
+	}
+
 	i.length += int64(writer.Written)
 }
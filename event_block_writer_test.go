@@ -28,7 +28,7 @@ func TestWriteEventBlocksSmall(t *testing.T) {
 
 	index := &index{evs: events{e1, e2, e3, e4}}
 
-	writeEventBlocks(index, w)
+	writeEventBlocks(index, w, false)
 
 	expected := []byte("\x1d\x00\x00\x03\x04\x00\x00\x00def\x01\x03\x00\x00\x00b\x01\x02\x00\x00\x00c\x03\x01\x00\x00\x00abc\x00")
 
@@ -72,7 +72,7 @@ func TestWriteEventBlocksMedium(t *testing.T) {
 
 	index := &index{evs: events{e1, e2, e3, e4}}
 
-	writeEventBlocks(index, w)
+	writeEventBlocks(index, w, false)
 
 	var tests = []struct {
 		event  *Event
@@ -118,7 +118,7 @@ func TestWriteEventBlocksLarge(t *testing.T) {
 
 	index := &index{evs: events{e1, e2, e3, e4}}
 
-	writeEventBlocks(index, w)
+	writeEventBlocks(index, w, false)
 
 	var tests = []struct {
 		event  *Event
@@ -2,6 +2,7 @@ package esdb
 
 import (
 	"io"
+	"runtime"
 	"sort"
 
 	"github.com/customerio/esdb/binary"
@@ -13,10 +14,13 @@ import (
 // in timestamp descending order.
 // Marks the event with which block it's located in,
 // as well as the offset within the block.
-func writeIndexBlocks(i *index, out io.Writer) {
+// With checksums, each block is followed by one.
+func writeIndexBlocks(i *index, out io.Writer, checksums bool) {
 	sort.Stable(sort.Reverse(i.evs))
 
 	writer := blocks.NewWriter(out, 4096)
+	writer.SetConcurrency(runtime.NumCPU())
+	writer.SetChecksums(checksums)
 
 	for _, event := range i.evs {
 		// Each entry in the index is
@@ -21,7 +21,7 @@ func TestWriteIndexBlocksSmall(t *testing.T) {
 
 	index := &index{evs: events{e1, e2, e3, e4}}
 
-	writeIndexBlocks(index, w)
+	writeIndexBlocks(index, w, false)
 
 	if index.length != 36 {
 		t.Errorf("Wrong written length: wanted: 36, found: %d", index.length)
@@ -67,7 +67,7 @@ func TestWriteIndexBlocksMedium(t *testing.T) {
 		index.evs[i] = &Event{Timestamp: i, block: rand.Int63(), offset: rand.Intn(4096)}
 	}
 
-	writeIndexBlocks(index, w)
+	writeIndexBlocks(index, w, false)
 
 	if index.length != 5007 {
 		t.Errorf("Wrong written length: wanted: 5007, found: %d", index.length)
@@ -94,7 +94,7 @@ func TestWriteIndexBlocksLarge(t *testing.T) {
 		index.evs[i] = &Event{Timestamp: i, block: rand.Int63(), offset: rand.Intn(4096)}
 	}
 
-	writeIndexBlocks(index, w)
+	writeIndexBlocks(index, w, false)
 
 	if index.length != 50040 {
 		t.Errorf("Wrong written length: wanted: 50040, found: %d", index.length)
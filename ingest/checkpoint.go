@@ -0,0 +1,69 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Checkpoint tracks the last offset successfully written to the
+// cluster for each topic partition, and persists it to disk so
+// ingestion can resume where it left off after a restart.
+type Checkpoint struct {
+	path    string
+	offsets map[string]int64
+	mutex   sync.Mutex
+}
+
+// Opens the checkpoint at the given path. A missing file is
+// treated as an empty checkpoint.
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	c := &Checkpoint{path: path, offsets: make(map[string]int64)}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return c, json.Unmarshal(b, &c.offsets)
+}
+
+// Returns the last committed offset for the partition, and
+// whether one has been committed at all.
+func (c *Checkpoint) Offset(topic string, partition int32) (int64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	offset, ok := c.offsets[key(topic, partition)]
+	return offset, ok
+}
+
+// Records the offset for the partition and atomically rewrites
+// the checkpoint file.
+func (c *Checkpoint) Commit(topic string, partition int32, offset int64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.offsets[key(topic, partition)] = offset
+
+	b, err := json.Marshal(c.offsets)
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+func key(topic string, partition int32) string {
+	return fmt.Sprint(topic, "/", partition)
+}
@@ -0,0 +1,176 @@
+/*
+The ingest package consumes records from an external log (such as Kafka),
+maps them to events, and writes them through the cluster leader in batches,
+checkpointing consumed offsets once each batch has been committed.
+*/
+package ingest
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	DEFAULT_BATCH_SIZE     = 100
+	DEFAULT_BATCH_INTERVAL = time.Second
+)
+
+// A single record consumed from a topic partition.
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+// Source delivers records from one or more topic partitions, in
+// offset order for each partition. Records are delivered on the
+// channel returned by Records, and the channel is closed once the
+// source has been closed.
+type Source interface {
+	Records() <-chan *Record
+	Errors() <-chan error
+	Close() error
+}
+
+// Writer is satisfied by cluster.Client, which handles finding and
+// following the current raft leader.
+type Writer interface {
+	EventsWithGroupings(bodies [][]byte, groupings []string, indexes []map[string]string) error
+}
+
+type Ingester struct {
+	source        Source
+	writer        Writer
+	mappings      Mappings
+	checkpoint    *Checkpoint
+	BatchSize     int
+	BatchInterval time.Duration
+	RetryInterval time.Duration
+}
+
+func New(source Source, writer Writer, mappings Mappings, checkpoint *Checkpoint) *Ingester {
+	return &Ingester{
+		source:        source,
+		writer:        writer,
+		mappings:      mappings,
+		checkpoint:    checkpoint,
+		BatchSize:     DEFAULT_BATCH_SIZE,
+		BatchInterval: DEFAULT_BATCH_INTERVAL,
+		RetryInterval: time.Second,
+	}
+}
+
+// Consumes records until the source is closed. Records which can't be
+// mapped are logged and skipped. Writes which fail are retried until
+// they succeed, so records are delivered at least once.
+func (i *Ingester) Run() error {
+	b := newBatch()
+
+	ticker := time.NewTicker(i.BatchInterval)
+	defer ticker.Stop()
+
+	records := i.source.Records()
+
+	for {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				return i.flush(b)
+			}
+
+			if i.seen(record) {
+				continue
+			}
+
+			body, grouping, indexes, err := i.mappings.Map(record)
+			if err != nil {
+				log.Println("INGEST: Skipping record:", err)
+				b.skip(record)
+			} else {
+				b.add(record, body, grouping, indexes)
+			}
+
+			if b.len() >= i.BatchSize {
+				if err := i.flush(b); err != nil {
+					return err
+				}
+
+				b = newBatch()
+			}
+
+		case err := <-i.source.Errors():
+			if err != nil {
+				log.Println("INGEST: Source error:", err)
+			}
+
+		case <-ticker.C:
+			if err := i.flush(b); err != nil {
+				return err
+			}
+
+			b = newBatch()
+		}
+	}
+}
+
+// Records at or before the checkpointed offset have already been
+// written, which happens when the source rewinds on restart.
+func (i *Ingester) seen(record *Record) bool {
+	offset, ok := i.checkpoint.Offset(record.Topic, record.Partition)
+	return ok && record.Offset <= offset
+}
+
+func (i *Ingester) flush(b *batch) error {
+	if len(b.bodies) > 0 {
+		for {
+			err := i.writer.EventsWithGroupings(b.bodies, b.groupings, b.indexes)
+			if err == nil {
+				break
+			}
+
+			log.Println("INGEST: Error writing batch, retrying:", err)
+			time.Sleep(i.RetryInterval)
+		}
+	}
+
+	for partition, offset := range b.offsets {
+		if err := i.checkpoint.Commit(partition.topic, partition.partition, offset); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type partition struct {
+	topic     string
+	partition int32
+}
+
+type batch struct {
+	bodies    [][]byte
+	groupings []string
+	indexes   []map[string]string
+	offsets   map[partition]int64
+}
+
+func newBatch() *batch {
+	return &batch{offsets: make(map[partition]int64)}
+}
+
+func (b *batch) add(record *Record, body []byte, grouping string, indexes map[string]string) {
+	b.bodies = append(b.bodies, body)
+	b.groupings = append(b.groupings, grouping)
+	b.indexes = append(b.indexes, indexes)
+	b.skip(record)
+}
+
+func (b *batch) skip(record *Record) {
+	b.offsets[partition{record.Topic, record.Partition}] = record.Offset
+}
+
+func (b *batch) len() int {
+	return len(b.bodies)
+}
@@ -0,0 +1,145 @@
+package ingest
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	records chan *Record
+	errors  chan error
+}
+
+func (s *fakeSource) Records() <-chan *Record { return s.records }
+func (s *fakeSource) Errors() <-chan error    { return s.errors }
+func (s *fakeSource) Close() error            { close(s.records); return nil }
+
+type fakeWriter struct {
+	bodies    []string
+	groupings []string
+	indexes   []map[string]string
+	failures  int
+}
+
+func (w *fakeWriter) EventsWithGroupings(bodies [][]byte, groupings []string, indexes []map[string]string) error {
+	if w.failures > 0 {
+		w.failures -= 1
+		return errors.New("leader unavailable")
+	}
+
+	for i, body := range bodies {
+		w.bodies = append(w.bodies, string(body))
+		w.groupings = append(w.groupings, groupings[i])
+		w.indexes = append(w.indexes, indexes[i])
+	}
+
+	return nil
+}
+
+var mappings = Mappings{
+	"orders": &Mapping{
+		Grouping: "customer.id",
+		Indexes:  map[string]string{"customer": "customer.id", "type": "$key", "total": "total"},
+	},
+}
+
+func TestMap(t *testing.T) {
+	var tests = []struct {
+		record   *Record
+		grouping string
+		indexes  map[string]string
+		err      bool
+	}{
+		{
+			&Record{Topic: "orders", Key: []byte("purchase"), Value: []byte(`{"customer":{"id":12},"total":42.5}`)},
+			"12",
+			map[string]string{"customer": "12", "type": "purchase", "total": "42.5"},
+			false,
+		},
+		{
+			&Record{Topic: "orders", Value: []byte(`{"customer":{"name":"bob"}}`)},
+			"",
+			map[string]string{},
+			false,
+		},
+		{&Record{Topic: "orders", Value: []byte(`not json`)}, "", nil, true},
+		{&Record{Topic: "clicks", Value: []byte(`{}`)}, "", nil, true},
+	}
+
+	for i, test := range tests {
+		body, grouping, indexes, err := mappings.Map(test.record)
+
+		if (err != nil) != test.err {
+			t.Errorf("Case #%v: unexpected error: %v", i, err)
+		}
+
+		if err == nil && string(body) != string(test.record.Value) {
+			t.Errorf("Case #%v: wanted body: %s, found: %s", i, test.record.Value, body)
+		}
+
+		if grouping != test.grouping {
+			t.Errorf("Case #%v: wanted grouping: %v, found: %v", i, test.grouping, grouping)
+		}
+
+		if !reflect.DeepEqual(indexes, test.indexes) {
+			t.Errorf("Case #%v: wanted indexes: %v, found: %v", i, test.indexes, indexes)
+		}
+	}
+}
+
+func TestRunCheckpointsAndResumes(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	os.Remove("tmp/test.checkpoint")
+
+	cp, err := OpenCheckpoint("tmp/test.checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &fakeSource{make(chan *Record, 10), make(chan error)}
+	writer := &fakeWriter{failures: 1}
+
+	for i := 0; i < 3; i++ {
+		source.records <- &Record{Topic: "orders", Partition: 1, Offset: int64(i), Value: []byte(`{"customer":{"id":1}}`)}
+	}
+
+	source.records <- &Record{Topic: "orders", Partition: 1, Offset: 3, Value: []byte(`garbage`)}
+	source.Close()
+
+	ingester := New(source, writer, mappings, cp)
+	ingester.BatchSize = 2
+	ingester.RetryInterval = time.Millisecond
+
+	if err := ingester.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(writer.bodies) != 3 {
+		t.Errorf("Wanted 3 events written, found: %v", writer.bodies)
+	}
+
+	cp, _ = OpenCheckpoint("tmp/test.checkpoint")
+
+	if offset, ok := cp.Offset("orders", 1); !ok || offset != 3 {
+		t.Errorf("Wanted checkpoint at offset 3, found: %v %v", offset, ok)
+	}
+
+	// Replayed records before the checkpoint are skipped.
+	source = &fakeSource{make(chan *Record, 10), make(chan error)}
+	source.records <- &Record{Topic: "orders", Partition: 1, Offset: 2, Value: []byte(`{}`)}
+	source.records <- &Record{Topic: "orders", Partition: 1, Offset: 4, Value: []byte(`{}`)}
+	source.Close()
+
+	writer = &fakeWriter{}
+
+	if err := New(source, writer, mappings, cp).Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(writer.bodies) != 1 {
+		t.Errorf("Wanted only the new record written, found: %v", writer.bodies)
+	}
+}
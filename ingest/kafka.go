@@ -0,0 +1,106 @@
+package ingest
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// KafkaSource consumes every partition of the given topics,
+// resuming each partition after its checkpointed offset.
+type KafkaSource struct {
+	consumer   sarama.Consumer
+	partitions []sarama.PartitionConsumer
+	records    chan *Record
+	errors     chan error
+	wait       sync.WaitGroup
+}
+
+func NewKafkaSource(brokers, topics []string, checkpoint *Checkpoint) (*KafkaSource, error) {
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+
+	consumer, err := sarama.NewConsumer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &KafkaSource{
+		consumer: consumer,
+		records:  make(chan *Record),
+		errors:   make(chan error),
+	}
+
+	for _, topic := range topics {
+		partitions, err := consumer.Partitions(topic)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+
+		for _, partition := range partitions {
+			offset := sarama.OffsetOldest
+
+			if committed, ok := checkpoint.Offset(topic, partition); ok {
+				offset = committed + 1
+			}
+
+			pc, err := consumer.ConsumePartition(topic, partition, offset)
+			if err != nil {
+				s.Close()
+				return nil, err
+			}
+
+			s.partitions = append(s.partitions, pc)
+			s.wait.Add(2)
+
+			go s.forwardMessages(pc)
+			go s.forwardErrors(pc)
+		}
+	}
+
+	go (func() {
+		s.wait.Wait()
+		close(s.records)
+	})()
+
+	return s, nil
+}
+
+func (s *KafkaSource) Records() <-chan *Record {
+	return s.records
+}
+
+func (s *KafkaSource) Errors() <-chan error {
+	return s.errors
+}
+
+func (s *KafkaSource) Close() error {
+	for _, pc := range s.partitions {
+		pc.AsyncClose()
+	}
+
+	return s.consumer.Close()
+}
+
+func (s *KafkaSource) forwardMessages(pc sarama.PartitionConsumer) {
+	defer s.wait.Done()
+
+	for msg := range pc.Messages() {
+		s.records <- &Record{
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Key:       msg.Key,
+			Value:     msg.Value,
+		}
+	}
+}
+
+func (s *KafkaSource) forwardErrors(pc sarama.PartitionConsumer) {
+	defer s.wait.Done()
+
+	for err := range pc.Errors() {
+		s.errors <- err
+	}
+}
@@ -0,0 +1,104 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+var NO_MAPPING = errors.New("no mapping defined for topic")
+
+// Mapping describes how records from a topic are turned into events.
+//
+// Grouping and index values are looked up from the record's JSON value
+// using dotted field paths, e.g. "customer.id". The special path "$key"
+// uses the record's key instead.
+type Mapping struct {
+	Grouping string            `json:"grouping"`
+	Indexes  map[string]string `json:"indexes"`
+}
+
+// Mappings for every consumed topic, keyed by topic name.
+type Mappings map[string]*Mapping
+
+// Reads a JSON mapping configuration from the given path, which
+// has the following format:
+//
+//	{
+//	  "orders": {
+//	    "grouping": "customer_id",
+//	    "indexes": { "customer": "customer_id", "type": "$key" }
+//	  }
+//	}
+func LoadMappings(path string) (Mappings, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings Mappings
+	err = json.Unmarshal(b, &mappings)
+
+	return mappings, err
+}
+
+// Maps a record onto an event body, grouping and indexes. The record
+// value is always stored untouched as the event body.
+func (m Mappings) Map(record *Record) (body []byte, grouping string, indexes map[string]string, err error) {
+	mapping := m[record.Topic]
+	if mapping == nil {
+		return nil, "", nil, NO_MAPPING
+	}
+
+	var doc map[string]interface{}
+
+	if err = json.Unmarshal(record.Value, &doc); err != nil {
+		return nil, "", nil, fmt.Errorf("record %s/%d/%d isn't valid JSON: %v", record.Topic, record.Partition, record.Offset, err)
+	}
+
+	if mapping.Grouping != "" {
+		grouping, _ = lookup(record, doc, mapping.Grouping)
+	}
+
+	indexes = make(map[string]string, len(mapping.Indexes))
+
+	for name, path := range mapping.Indexes {
+		if value, ok := lookup(record, doc, path); ok {
+			indexes[name] = value
+		}
+	}
+
+	return record.Value, grouping, indexes, nil
+}
+
+func lookup(record *Record, doc map[string]interface{}, path string) (string, bool) {
+	if path == "$key" {
+		return string(record.Key), len(record.Key) > 0
+	}
+
+	var current interface{} = doc
+
+	for _, field := range strings.Split(path, ".") {
+		if obj, ok := current.(map[string]interface{}); ok {
+			current, ok = obj[field]
+			if !ok {
+				return "", false
+			}
+		} else {
+			return "", false
+		}
+	}
+
+	switch v := current.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case map[string]interface{}, []interface{}:
+		return "", false
+	default:
+		return fmt.Sprint(v), true
+	}
+}
@@ -11,6 +11,10 @@ import (
 	"github.com/customerio/esdb/sst"
 )
 
+// How many upcoming blocks of events are decompressed
+// while earlier ones are scanned.
+const DECOMPRESS_AHEAD = 4
+
 type Scanner func(*Event) bool
 
 type Space struct {
@@ -27,12 +31,14 @@ type Space struct {
 // the spaces position within the file.
 func openSpace(reader io.ReadSeeker, id []byte, offset, length int64) *Space {
 	if st, err := findSpaceIndex(reader, offset, length); err == nil {
+		events := blocks.NewReader(reader, 4096)
+		events.SetConcurrency(DECOMPRESS_AHEAD)
 
 		return &Space{
 			Id:     id,
 			index:  st,
 			reader: reader,
-			blocks: blocks.NewReader(reader, 4096),
+			blocks: events,
 			offset: offset,
 			length: length,
 		}
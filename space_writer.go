@@ -16,7 +16,8 @@ type spaceWriter struct {
 
 	writer io.Writer
 
-	written bool
+	written   bool
+	checksums bool
 
 	indexes    map[string]*index
 	indexNames sort.StringSlice
@@ -112,9 +113,9 @@ func (w *spaceWriter) writeBlocks(written int64, out io.Writer) (int64, error) {
 		buf := new(bytes.Buffer)
 
 		if strings.HasPrefix(name, "g") {
-			writeEventBlocks(w.indexes[name], buf)
+			writeEventBlocks(w.indexes[name], buf, w.checksums)
 		} else {
-			writeIndexBlocks(w.indexes[name], buf)
+			writeIndexBlocks(w.indexes[name], buf, w.checksums)
 		}
 
 		w.indexes[name].evs = nil
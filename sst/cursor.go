@@ -0,0 +1,258 @@
+package sst
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+var CORRUPTED_INDEX = errors.New("corrupted sst index entry")
+
+// Cursor moves over a table's entries in key order, in either
+// direction. Blocks are decoded whole as the cursor enters them,
+// as their prefix compressed keys can only be read forwards.
+type Cursor struct {
+	reader     *Reader
+	handles    []blockHandle
+	separators [][]byte
+	block      int
+	entries    []entry
+	pos        int
+	err        error
+}
+
+type entry struct {
+	key   []byte
+	value []byte
+}
+
+// Returns a cursor positioned before the first entry.
+func (r *Reader) Cursor() (*Cursor, error) {
+	c := &Cursor{reader: r, block: -1, pos: -1}
+
+	data, err := blockData(r.index)
+	if err != nil {
+		return nil, err
+	}
+
+	iter := &iterator{data: data, key: make([]byte, 0, 256)}
+
+	// Each block's index key is at or after its last key,
+	// and before the first key of the next block.
+	for iter.Next() {
+		h, n := decodeBlockHandle(iter.Value())
+		if n == 0 || n != len(iter.Value()) {
+			return nil, CORRUPTED_INDEX
+		}
+
+		c.handles = append(c.handles, h)
+		c.separators = append(c.separators, append([]byte{}, iter.Key()...))
+	}
+
+	if iter.err != nil {
+		return nil, iter.err
+	}
+
+	return c, nil
+}
+
+// Calls fn with each entry with a key in [start, limit), in order,
+// until it returns false. A nil limit continues to the last entry.
+func (r *Reader) Range(start, limit []byte, fn func(key, value []byte) bool) error {
+	c, err := r.Cursor()
+	if err != nil {
+		return err
+	}
+
+	for ok := c.Seek(start); ok; ok = c.Next() {
+		if limit != nil && bytes.Compare(c.Key(), limit) >= 0 {
+			break
+		}
+
+		if !fn(c.Key(), c.Value()) {
+			break
+		}
+	}
+
+	return c.Err()
+}
+
+// Calls fn with each entry with a key beginning with the prefix.
+func (r *Reader) Prefix(prefix []byte, fn func(key, value []byte) bool) error {
+	return r.Range(prefix, prefixLimit(prefix), fn)
+}
+
+// Positions the cursor at the first entry with a key at or
+// after the given key, returning false if there is none.
+func (c *Cursor) Seek(key []byte) bool {
+	block := sort.Search(len(c.separators), func(i int) bool {
+		return bytes.Compare(c.separators[i], key) >= 0
+	})
+
+	if block == len(c.handles) {
+		c.block, c.entries, c.pos = len(c.handles), nil, 0
+		return false
+	}
+
+	if !c.load(block) {
+		return false
+	}
+
+	c.pos = sort.Search(len(c.entries), func(i int) bool {
+		return bytes.Compare(c.entries[i].key, key) >= 0
+	})
+
+	// Past the block's last key, so the next block's first.
+	if c.pos == len(c.entries) {
+		c.pos--
+		return c.Next()
+	}
+
+	return true
+}
+
+// Positions the cursor at the first entry.
+func (c *Cursor) First() bool {
+	c.block, c.entries, c.pos = -1, nil, -1
+	return c.Next()
+}
+
+// Positions the cursor at the last entry.
+func (c *Cursor) Last() bool {
+	c.block, c.entries, c.pos = len(c.handles), nil, 0
+	return c.Prev()
+}
+
+// Moves to the next entry, returning false once past the last.
+func (c *Cursor) Next() bool {
+	if c.err != nil {
+		return false
+	}
+
+	c.pos++
+
+	for c.pos >= len(c.entries) {
+		if c.block+1 >= len(c.handles) {
+			c.block, c.entries, c.pos = len(c.handles), nil, 0
+			return false
+		}
+
+		if !c.load(c.block + 1) {
+			return false
+		}
+
+		c.pos = 0
+	}
+
+	return true
+}
+
+// Moves to the previous entry, returning false once before the first.
+func (c *Cursor) Prev() bool {
+	if c.err != nil {
+		return false
+	}
+
+	c.pos--
+
+	for c.pos < 0 {
+		if c.block <= 0 {
+			c.block, c.entries, c.pos = -1, nil, -1
+			return false
+		}
+
+		if !c.load(c.block - 1) {
+			return false
+		}
+
+		c.pos = len(c.entries) - 1
+	}
+
+	return true
+}
+
+// Whether the cursor is positioned at an entry.
+func (c *Cursor) Valid() bool {
+	return c.err == nil && c.pos >= 0 && c.pos < len(c.entries)
+}
+
+func (c *Cursor) Key() []byte {
+	if !c.Valid() {
+		return nil
+	}
+	return c.entries[c.pos].key
+}
+
+func (c *Cursor) Value() []byte {
+	if !c.Valid() {
+		return nil
+	}
+	return c.entries[c.pos].value
+}
+
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+func (c *Cursor) load(block int) bool {
+	data, err := c.reader.readBlock(c.handles[block])
+	if err != nil {
+		c.err = err
+		return false
+	}
+
+	if data, err = blockData(data); err != nil {
+		c.err = err
+		return false
+	}
+
+	entries := make([]entry, 0)
+
+	iter := &iterator{data: data, key: make([]byte, 0, 256)}
+
+	for iter.Next() {
+		entries = append(entries, entry{
+			key:   append([]byte{}, iter.Key()...),
+			value: iter.Value(),
+		})
+	}
+
+	if iter.err != nil {
+		c.err = iter.err
+		return false
+	}
+
+	c.block, c.entries = block, entries
+	return true
+}
+
+// The entries of a block, without its trailing restart points.
+func blockData(block []byte) ([]byte, error) {
+	if len(block) < 4 {
+		return nil, CORRUPTED_BLOCK
+	}
+
+	numRestarts := int64(binary.LittleEndian.Uint32(block[len(block)-4:]))
+
+	if 4*numRestarts+4 > int64(len(block)) {
+		return nil, CORRUPTED_BLOCK
+	}
+
+	return block[:int64(len(block))-4*numRestarts-4], nil
+}
+
+// The smallest key greater than every key with the prefix,
+// or nil if there is none.
+func prefixLimit(prefix []byte) []byte {
+	limit := append([]byte{}, prefix...)
+
+	for i := len(limit) - 1; i >= 0; i-- {
+		if limit[i] != 0xff {
+			limit[i]++
+			return limit[:i+1]
+		}
+	}
+
+	return nil
+}
@@ -13,6 +13,10 @@ type blockHandle struct {
 	length int64
 }
 
+var CORRUPTED_FOOTER = errors.New("corrupted sst footer, index block exceeds the table's size")
+var CORRUPTED_BLOCK = errors.New("corrupted sst index, block exceeds the table's size")
+var NOT_FOUND = errors.New("not found")
+
 type Reader struct {
 	reader io.ReadSeeker
 	length int64
@@ -20,6 +24,10 @@ type Reader struct {
 }
 
 func NewReader(r io.ReadSeeker, length int64) (*Reader, error) {
+	if length < int64(FOOTER_SIZE) {
+		return nil, CORRUPTED_FOOTER
+	}
+
 	footer := make([]byte, FOOTER_SIZE)
 
 	r.Seek(length-int64(FOOTER_SIZE), 0)
@@ -35,6 +43,10 @@ func NewReader(r io.ReadSeeker, length int64) (*Reader, error) {
 	_, n := decodeBlockHandle(footer[:])
 	indexBlockHandle, n := decodeBlockHandle(footer[n:])
 
+	if !indexBlockHandle.within(length - int64(FOOTER_SIZE)) {
+		return nil, CORRUPTED_FOOTER
+	}
+
 	reader := &Reader{
 		reader: r,
 		length: length,
@@ -53,7 +65,7 @@ func (r *Reader) Get(key []byte) (value []byte, err error) {
 
 	if !iter.Next() || string(key) != string(iter.Key()) {
 		if err = iter.Close(); err == nil {
-			err = errors.New("not found")
+			err = NOT_FOUND
 		}
 
 		return
@@ -80,6 +92,10 @@ func (r *Reader) Find(key []byte) (Iterator, error) {
 }
 
 func (r *Reader) readBlock(handle blockHandle) ([]byte, error) {
+	if !handle.within(r.length - int64(FOOTER_SIZE)) {
+		return nil, CORRUPTED_BLOCK
+	}
+
 	bytes := make([]byte, handle.length)
 
 	r.reader.Seek(handle.offset, 0)
@@ -135,6 +151,11 @@ func decodeBlockHandle(src []byte) (blockHandle, int) {
 	return blockHandle{int64(offset), int64(length)}, n + m
 }
 
+// Whether the block lies within the first length bytes of the table.
+func (b blockHandle) within(length int64) bool {
+	return b.offset >= 0 && b.length >= 0 && b.offset <= length && b.length <= length-b.offset
+}
+
 func encodeBlockHandle(dst []byte, b blockHandle) int {
 	n := binary.PutUvarint(dst, uint64(b.offset))
 	m := binary.PutUvarint(dst[n:], uint64(b.length))
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"sort"
 	"sync"
 	"testing"
@@ -107,3 +108,103 @@ func TestWriter(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestCursor(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+
+	keys := make([]string, 0)
+
+	// Enough to span many blocks.
+	for i := 0; i < 2000; i += 2 {
+		keys = append(keys, fmt.Sprintf("key%05d", i))
+		w.Set([]byte(keys[len(keys)-1]), []byte(fmt.Sprint(i)))
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := r.Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.handles) < 2 {
+		t.Fatalf("Expected many blocks, found: %v", len(c.handles))
+	}
+
+	found := make([]string, 0)
+	for ok := c.First(); ok; ok = c.Next() {
+		found = append(found, string(c.Key()))
+	}
+
+	if !reflect.DeepEqual(found, keys) {
+		t.Errorf("Incorrect forward iteration, found %v keys", len(found))
+	}
+
+	found = found[:0]
+	for ok := c.Last(); ok; ok = c.Prev() {
+		found = append(found, string(c.Key()))
+	}
+
+	for i, key := range found {
+		if key != keys[len(keys)-1-i] {
+			t.Errorf("Incorrect reverse iteration at %v: %q", i, key)
+			break
+		}
+	}
+
+	var tests = []struct {
+		seek  string
+		found string
+		ok    bool
+	}{
+		{"", "key00000", true},
+		{"key00100", "key00100", true},
+		{"key00101", "key00102", true},
+		{"key01999", "", false},
+		{"z", "", false},
+	}
+
+	for i, test := range tests {
+		ok := c.Seek([]byte(test.seek))
+
+		if ok != test.ok || string(c.Key()) != test.found {
+			t.Errorf("Case #%v: Incorrect seek to %q. Wanted: %q %v, found: %q %v", i, test.seek, test.found, test.ok, c.Key(), ok)
+		}
+	}
+
+	// Seeking then stepping back crosses the previous block.
+	c.Seek([]byte("key01000"))
+	for i := 1; i <= 300; i++ {
+		if !c.Prev() || string(c.Key()) != fmt.Sprintf("key%05d", 1000-2*i) {
+			t.Fatalf("Incorrect step back %v: %q", i, c.Key())
+		}
+	}
+
+	found = found[:0]
+	r.Range([]byte("key00010"), []byte("key00016"), func(key, value []byte) bool {
+		found = append(found, string(key)+"="+string(value))
+		return true
+	})
+
+	if !reflect.DeepEqual(found, []string{"key00010=10", "key00012=12", "key00014=14"}) {
+		t.Errorf("Incorrect range: %v", found)
+	}
+
+	found = found[:0]
+	r.Prefix([]byte("key0198"), func(key, value []byte) bool {
+		found = append(found, string(key))
+		return true
+	})
+
+	if !reflect.DeepEqual(found, []string{"key01980", "key01982", "key01984", "key01986", "key01988"}) {
+		t.Errorf("Incorrect prefix scan: %v", found)
+	}
+}
@@ -23,6 +23,7 @@ type indexEntry struct {
 
 type Writer struct {
 	writer    io.Writer
+	blockSize int
 	offset    uint64
 	prevKey   []byte
 	pendingBH blockHandle
@@ -37,10 +38,17 @@ type Writer struct {
 }
 
 func NewWriter(w io.Writer) *Writer {
+	return NewWriterSize(w, BlockSize)
+}
+
+// Writes blocks of about the given number of bytes, rather than
+// BlockSize. Tables are read the same way whatever their block size.
+func NewWriterSize(w io.Writer, blockSize int) *Writer {
 	return &Writer{
-		writer:   w,
-		prevKey:  make([]byte, 0, 256),
-		restarts: make([]uint32, 0, 256),
+		writer:    w,
+		blockSize: blockSize,
+		prevKey:   make([]byte, 0, 256),
+		restarts:  make([]uint32, 0, 256),
 	}
 }
 
@@ -54,7 +62,7 @@ func (w *Writer) Set(key, value []byte) error {
 	w.append(key, value, w.nEntries%BlockRestartInterval == 0)
 
 	// If the estimated block size is sufficiently large, finish the current block.
-	if w.buf.Len()+4*(len(w.restarts)+1) >= BlockSize {
+	if w.buf.Len()+4*(len(w.restarts)+1) >= w.blockSize {
 		bh, err := w.finishBlock()
 		if err != nil {
 			return err
@@ -7,15 +7,29 @@ import (
 	"os"
 
 	"github.com/customerio/esdb/binary"
+	"github.com/customerio/esdb/bloom"
 	"github.com/customerio/esdb/bounded"
 	"github.com/customerio/esdb/sst"
 )
 
 var WRITING_TO_CLOSED_STREAM = errors.New("stream has been closed")
+var CORRUPTED_FOOTER = errors.New("corrupted stream footer, index length exceeds the stream's size")
+
+// Keys the bloom filter of a closed stream's index values within its
+// index. Index keys are names and values joined by ":", so none is it.
+const BLOOM_KEY = "_bloom"
+
+// Bits of the bloom filter for each index value, giving false positives
+// for about 1% of the values a stream doesn't have.
+const BLOOM_BITS_PER_KEY = 10
 
 type closedStream struct {
 	stream io.ReaderAt
 	index  *sst.Reader
+	// Nil for streams closed without one, which may have any value.
+	filter *bloom.Filter
+	// Nil for streams closed before stats were recorded.
+	stats Stats
 }
 
 func readonly(path string) (Stream, error) {
@@ -39,9 +53,21 @@ func newClosedStream(stream *os.File) (Stream, error) {
 		return nil, err
 	}
 
+	filter, err := findFilter(index)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := findStats(index)
+	if err != nil {
+		return nil, err
+	}
+
 	return &closedStream{
 		stream: stream,
 		index:  index,
+		filter: filter,
+		stats:  stats,
 	}, nil
 }
 
@@ -49,13 +75,23 @@ func (s *closedStream) Write(data []byte, indexes map[string]string) (int, error
 	return 0, WRITING_TO_CLOSED_STREAM
 }
 
+func (s *closedStream) WriteWithHeaders(data []byte, indexes, headers map[string]string) (int, error) {
+	return 0, WRITING_TO_CLOSED_STREAM
+}
+
+// Checks the bloom filter before the index, so streams without the
+// value are usually skipped without reading any of their index.
 func (s *closedStream) First(name, value string) (int64, error) {
 	index := name + ":" + value
 
+	if !s.filter.MayContain([]byte(index)) {
+		return 0, nil
+	}
+
 	val, err := s.index.Get([]byte(index))
 
 	if err != nil {
-		if err.Error() == "not found" {
+		if err == sst.NOT_FOUND {
 			return 0, nil
 		} else {
 			return 0, err
@@ -79,14 +115,57 @@ func (s *closedStream) ScanIndex(name, value string, offset int64, scanner Scann
 	return scanIndex(s, index, offset, scanner)
 }
 
+func (s *closedStream) ScanIndexes(indexes map[string]string, offset int64, scanner Scanner) (int64, error) {
+	return scanIndexes(s, indexes, offset, scanner)
+}
+
+// Scans the events with a value of the index beginning with the prefix,
+// found from the index's keys, which are sorted. See scanChains.
+func (s *closedStream) ScanPrefix(name, prefix string, offset int64, scanner Scanner) (int64, error) {
+	heads := make(map[string]int64)
+
+	err := s.index.Prefix([]byte(name+":"+prefix), func(key, value []byte) bool {
+		heads[string(key)] = binary.ReadUvarint(bytes.NewReader(value))
+		return true
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return scanChains(s, heads, offset, scanner)
+}
+
+// Read from the index's keys, which are sorted.
+func (s *closedStream) Values(name string) ([]string, error) {
+	var values []string
+
+	err := s.index.Prefix([]byte(name+":"), func(key, value []byte) bool {
+		values = append(values, string(key[len(name)+1:]))
+		return true
+	})
+
+	return values, err
+}
+
 func (s *closedStream) Iterate(offset int64, scanner Scanner) (int64, error) {
-	return iterate(s, offset, scanner)
+	return iterateAhead(s, offset, scanner)
+}
+
+func (s *closedStream) IterateReverse(offset int64, scanner Scanner) (int64, error) {
+	return iterateReverse(s, offset, scanner)
 }
 
 func (s *closedStream) Offset() int64 {
 	return 0
 }
 
+// The stats recorded as the stream was closed, nil if it was closed
+// before they were.
+func (s *closedStream) Stats() (Stats, error) {
+	return s.stats, nil
+}
+
 func (s *closedStream) Closed() bool {
 	return true
 }
@@ -99,15 +178,41 @@ func (s *closedStream) Close() error {
 	return nil
 }
 
+// Closed streams are synced as they're closed.
+func (s *closedStream) Sync() error {
+	return nil
+}
+
 func (s *closedStream) reader() io.ReaderAt {
 	return s.stream
 }
 
+func findFilter(index *sst.Reader) (*bloom.Filter, error) {
+	b, err := index.Get([]byte(BLOOM_KEY))
+
+	if err == sst.NOT_FOUND {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return bloom.Decode(b)
+}
+
 func findIndex(f *os.File) (*sst.Reader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
 	// The last 8 bytes in the file is the length
 	// of the SSTable spaces index.
 	f.Seek(-FOOTER_LENGTH-8, 2)
 	indexLen := binary.ReadInt64(f)
 
+	if indexLen < 0 || indexLen > info.Size()-HEADER_LENGTH-FOOTER_LENGTH-8 {
+		return nil, CORRUPTED_FOOTER
+	}
+
 	return sst.NewReader(bounded.New(f, -8-FOOTER_LENGTH-indexLen, -8-FOOTER_LENGTH), indexLen)
 }
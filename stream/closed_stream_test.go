@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"fmt"
 	"os"
 	"reflect"
 	"testing"
@@ -159,3 +160,118 @@ func TestClosedWrite(t *testing.T) {
 		t.Errorf("No error found while writing to closed stream.")
 	}
 }
+
+func TestClosedCorruptedFooter(t *testing.T) {
+	buildStream()
+
+	f, _ := os.OpenFile("tmp/test.stream", os.O_RDWR, 0644)
+	info, _ := f.Stat()
+
+	// Claim the index is far larger than the stream.
+	f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x0f}, info.Size()-FOOTER_LENGTH-8)
+	f.Close()
+
+	if _, err := Open("tmp/test.stream"); err != CORRUPTED_FOOTER {
+		t.Errorf("Expected corrupted footer error, found: %v", err)
+	}
+}
+
+func TestClosedIterateAhead(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	os.Remove("tmp/test.stream")
+
+	s := newStream()
+
+	expected := make([]string, 0)
+
+	for i := 0; i < READ_AHEAD*3; i++ {
+		s.Write([]byte(fmt.Sprint(i)), map[string]string{"a": "a"})
+		expected = append(expected, fmt.Sprint(i))
+	}
+
+	s.Close()
+	s = reopenStream()
+
+	found := make([]string, 0)
+
+	offset, err := s.Iterate(0, func(e *Event) bool {
+		found = append(found, string(e.Data))
+		return len(found) != READ_AHEAD+1
+	})
+
+	if err != nil {
+		t.Errorf("Error found while iterating: %v", err)
+	}
+
+	_, err = s.Iterate(offset, func(e *Event) bool {
+		found = append(found, string(e.Data))
+		return true
+	})
+
+	if err != nil {
+		t.Errorf("Error found while iterating: %v", err)
+	}
+
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Wanted: %v, found: %v", expected, found)
+	}
+}
+
+func TestClosedIterateReverse(t *testing.T) {
+	s := buildStream()
+
+	var offset int64
+	found := make([]string, 0)
+
+	for i := 0; i < 4; i++ {
+		offset, _ = s.IterateReverse(offset, func(e *Event) bool {
+			found = append(found, string(e.Data))
+			return false
+		})
+	}
+
+	if !reflect.DeepEqual(found, []string{"def", "cde", "abc"}) {
+		t.Errorf("Wanted: %v, found: %v", []string{"def", "cde", "abc"}, found)
+	}
+}
+
+func TestClosedBloomFilter(t *testing.T) {
+	for _, filtered := range []bool{true, false} {
+		os.MkdirAll("tmp", 0755)
+		os.Remove("tmp/test.stream")
+
+		s, _ := NewWithOptions("tmp/test.stream", Options{NoBloomFilter: !filtered})
+
+		for i := 0; i < 100; i++ {
+			s.Write([]byte("a"), map[string]string{"a": fmt.Sprint(i)})
+		}
+
+		s.Close()
+
+		closed := reopenStream().(*closedStream)
+
+		if (closed.filter != nil) != filtered {
+			t.Fatalf("Wanted filter: %v, found: %v", filtered, closed.filter)
+		}
+
+		if first, err := closed.First("a", "50"); first == 0 || err != nil {
+			t.Errorf("Wanted offset of a:50, found: %v, %v", first, err)
+		}
+
+		var positives int
+
+		for i := 100; i < 1100; i++ {
+			if first, err := closed.First("a", fmt.Sprint(i)); first != 0 || err != nil {
+				t.Errorf("Wanted a:%v not to be found, found: %v, %v", i, first, err)
+			}
+
+			if closed.filter.MayContain([]byte(fmt.Sprint("a:", i))) {
+				positives += 1
+			}
+		}
+
+		if filtered && positives > 30 {
+			t.Errorf("Wanted few false positives, found: %v of 1000", positives)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Durability is when events written to an open stream are synced to
+// disk. Until then, events written are lost if the machine crashes.
+type Durability int
+
+const (
+	// Leaves syncing to the caller, or the OS.
+	SYNC_NEVER Durability = iota
+	// Syncs after every event written.
+	SYNC_ALWAYS
+	// Syncs in the background every SyncInterval if events were written
+	// meanwhile, so events written together share a sync.
+	SYNC_INTERVAL
+)
+
+// How often streams written with SYNC_INTERVAL are synced, if the
+// options have no SyncInterval.
+const DEFAULT_SYNC_INTERVAL = 100 * time.Millisecond
+
+var INVALID_DURABILITY = errors.New("durability must be always, interval or never")
+var INVALID_SYNC_INTERVAL = errors.New("sync interval must not be negative")
+
+// Parses always, interval or never, as configured by name.
+func ParseDurability(name string) (Durability, error) {
+	switch name {
+	case "never", "":
+		return SYNC_NEVER, nil
+	case "always":
+		return SYNC_ALWAYS, nil
+	case "interval":
+		return SYNC_INTERVAL, nil
+	}
+
+	return SYNC_NEVER, INVALID_DURABILITY
+}
+
+func (d Durability) String() string {
+	switch d {
+	case SYNC_ALWAYS:
+		return "always"
+	case SYNC_INTERVAL:
+		return "interval"
+	}
+
+	return "never"
+}
+
+func (o Options) syncInterval() time.Duration {
+	if o.SyncInterval == 0 {
+		return DEFAULT_SYNC_INTERVAL
+	}
+
+	return o.SyncInterval
+}
+
+// Syncs a stream in the background, once written to since last synced.
+type syncer struct {
+	mutex   sync.Mutex
+	dirty   bool
+	stopped bool
+	stop    chan bool
+}
+
+func startSyncer(interval time.Duration, sync func() error) *syncer {
+	s := &syncer{stop: make(chan bool)}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.flush(sync)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *syncer) written() {
+	s.mutex.Lock()
+	s.dirty = true
+	s.mutex.Unlock()
+}
+
+// Syncs if written, holding the lock so the stream isn't closed meanwhile.
+func (s *syncer) flush(sync func() error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.dirty || s.stopped {
+		return nil
+	}
+
+	s.dirty = false
+
+	return sync()
+}
+
+// Stops syncing, after syncing what was written since last synced.
+func (s *syncer) close(sync func() error) error {
+	err := s.flush(sync)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+
+	return err
+}
@@ -0,0 +1,70 @@
+package stream
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type syncCounter struct {
+	*os.File
+	syncs int32
+}
+
+func (c *syncCounter) Sync() error {
+	atomic.AddInt32(&c.syncs, 1)
+	return c.File.Sync()
+}
+
+func TestDurability(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+
+	for _, test := range []struct {
+		opts  Options
+		syncs int32
+	}{
+		{Options{}, 0},
+		{Options{Durability: SYNC_ALWAYS}, 3},
+		// Written together, so synced once, then once more as closed.
+		{Options{Durability: SYNC_INTERVAL, SyncInterval: 20 * time.Millisecond}, 1},
+	} {
+		os.Remove("tmp/test.stream")
+
+		file, _ := os.OpenFile("tmp/test.stream", os.O_RDWR|os.O_CREATE, 0755)
+		counter := &syncCounter{File: file}
+
+		s, _ := createOpenStream(counter)
+		s.(*openStream).options = test.opts
+
+		for i := 0; i < 3; i++ {
+			if _, err := s.Write([]byte("a"), map[string]string{"a": "1"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+
+		if syncs := atomic.LoadInt32(&counter.syncs); syncs != test.syncs {
+			t.Errorf("Durability %v: wanted %v syncs, found: %v", test.opts.Durability, test.syncs, syncs)
+		}
+
+		s.Write([]byte("b"), map[string]string{"a": "1"})
+
+		if err := s.Close(); err != nil {
+			t.Errorf("Durability %v: unable to close: %v", test.opts.Durability, err)
+		}
+
+		if test.opts.Durability == SYNC_INTERVAL && atomic.LoadInt32(&counter.syncs) != 2 {
+			t.Errorf("Expected events written since last synced to be synced as closed, found: %v syncs", counter.syncs)
+		}
+	}
+
+	if _, err := ParseDurability("sometimes"); err != INVALID_DURABILITY {
+		t.Errorf("Wanted: %v, found: %v", INVALID_DURABILITY, err)
+	}
+
+	if err := (Options{SyncInterval: -1}).Validate(); err != INVALID_SYNC_INTERVAL {
+		t.Errorf("Wanted: %v, found: %v", INVALID_SYNC_INTERVAL, err)
+	}
+}
@@ -0,0 +1,43 @@
+package stream
+
+import (
+	"github.com/customerio/esdb/binary"
+
+	"errors"
+	"fmt"
+)
+
+var STREAM_NOT_FOUND = errors.New("stream not found")
+
+// CorruptedError is returned when an event within a stream can't be
+// decoded, with the offset of the event. Err is the decoding error,
+// such as CORRUPTED_EVENT, which errors.Is matches against.
+type CorruptedError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *CorruptedError) Error() string {
+	return fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+}
+
+func (e *CorruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Whether the error is due to a corrupted event, rather than
+// failing to read the stream.
+func IsCorrupted(err error) bool {
+	var c *CorruptedError
+	return errors.As(err, &c)
+}
+
+// Reports errors decoding the event at the offset as corruption.
+func corrupted(err error, offset int64) error {
+	switch err {
+	case CORRUPTED_EVENT, CORRUPTED_EVENT_LENGTH, CHECKSUM_MISMATCH, binary.TRUNCATED, binary.TOO_LONG:
+		return &CorruptedError{offset, err}
+	}
+
+	return err
+}
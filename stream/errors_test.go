@@ -0,0 +1,43 @@
+package stream
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestOpeningMissingStream(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	os.Remove("tmp/missing.stream")
+
+	if _, err := Open("tmp/missing.stream"); err != STREAM_NOT_FOUND {
+		t.Errorf("Expected stream not to be found, found: %v", err)
+	}
+}
+
+func TestCorruptedErrorOffset(t *testing.T) {
+	rws := &RWS{}
+
+	s, err := createOpenStream(rws)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Write([]byte("abc"), map[string]string{"a": "b"})
+
+	// An event claiming to be 2GB follows the first.
+	offset := int64(len(rws.buf))
+	rws.WriteAt([]byte{0xff, 0xff, 0xff, 0x7f, 'a'}, offset)
+
+	_, err = s.Iterate(0, func(e *Event) bool { return true })
+
+	var corruption *CorruptedError
+
+	if !errors.As(err, &corruption) || corruption.Offset != offset || !errors.Is(err, CORRUPTED_EVENT) {
+		t.Errorf("Expected corrupted event at %v, found: %v", offset, err)
+	}
+
+	if !IsCorrupted(err) || IsCorrupted(STREAM_NOT_FOUND) {
+		t.Errorf("Incorrectly identified corruption: %v", err)
+	}
+}
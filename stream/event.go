@@ -3,17 +3,40 @@ package stream
 import (
 	"bytes"
 	"errors"
+	"hash/crc32"
 	"io"
+	"math"
+	"sort"
 	"strings"
 
 	"github.com/customerio/esdb/binary"
 )
 
 var CORRUPTED_EVENT = errors.New("corrupted event")
+var CORRUPTED_EVENT_LENGTH = errors.New("corrupted event, length exceeds the event's size")
+var CHECKSUM_MISMATCH = errors.New("corrupted event, checksum doesn't match")
+
+// Marks the checksum following an event's offsets. Events written
+// before checksums were have none, and redacted ones are padded with
+// zeros, so neither is mistaken for having one.
+const CHECKSUM_MARKER = 0xc5
+
+// Marks the headers following an event's offsets, if it has any.
+// Readers which predate headers take it for the end of the event, so
+// still read its body, though without checking its checksum.
+const HEADERS_MARKER = 0x48
 
 type Event struct {
-	Data    []byte
+	Data []byte
+	// Metadata written alongside the body, such as its content type
+	// or schema version, which can be read without decoding it.
+	Headers map[string]string
+	// Position of the event within its stream, when read from one.
+	Offset  int64
 	offsets map[string]int64
+	size    int
+	// Encoded without a checksum. See Options.NoChecksums.
+	unchecked bool
 }
 
 func NewEvent(data []byte, offsets map[string]int64) *Event {
@@ -24,6 +47,25 @@ func (e *Event) Next(name, value string) int64 {
 	return e.offsets[name+":"+value]
 }
 
+// Whether the event was written with the given index value.
+func (e *Event) Indexed(name, value string) bool {
+	_, ok := e.offsets[name+":"+value]
+	return ok
+}
+
+// The value the event was indexed with for the given name, if any.
+func (e *Event) Value(name string) (string, bool) {
+	prefix := name + ":"
+
+	for key := range e.offsets {
+		if strings.HasPrefix(key, prefix) {
+			return key[len(prefix):], true
+		}
+	}
+
+	return "", false
+}
+
 func (e *Event) Indexes() map[string]string {
 	indexes := make(map[string]string)
 
@@ -35,8 +77,25 @@ func (e *Event) Indexes() map[string]string {
 	return indexes
 }
 
+func (e *Event) Grouping() string {
+	return e.Indexes()[GROUPING_INDEX]
+}
+
 // Events are encoded in the following byte format:
 // [int32:length][bytes(length):data]
+//
+// Where data is:
+// [uvarint:size][bytes(size):body][uvarint:count][offsets(count)][headers][byte:marker][int32:crc32]
+//
+// Headers are only written if the event has any, as:
+// [byte:marker][uvarint:count][headers(count)]
+//
+// Where each is a uvarint length prefixed name followed by its value.
+// The checksum covers the data before its marker. Streams written with
+// Options.NoChecksums leave out the marker and checksum.
+//
+// Redacted events may be encoded in fewer bytes than their length,
+// and are padded with zeros so later events keep their offsets.
 func (e *Event) push(buf *bytes.Buffer) (int, error) {
 	data := e.encode()
 	binary.WriteInt32(buf, len(data))
@@ -46,6 +105,10 @@ func (e *Event) push(buf *bytes.Buffer) (int, error) {
 }
 
 func (e *Event) length() int {
+	if e.size > 0 {
+		return e.size + 4
+	}
+
 	return len(e.encode()) + 4
 }
 
@@ -57,48 +120,197 @@ func (e *Event) encode() []byte {
 
 	binary.WriteUvarint(buf, len(e.offsets))
 
-	for name, offset := range e.offsets {
+	// Written in order, so the same events are always encoded, and
+	// streams of them written, byte for byte the same.
+	indexes := make([]string, 0, len(e.offsets))
+
+	for name := range e.offsets {
+		indexes = append(indexes, name)
+	}
+
+	sort.Strings(indexes)
+
+	for _, name := range indexes {
 		binary.WriteUvarint(buf, len(name))
 		buf.Write([]byte(name))
-		binary.WriteUvarint64(buf, offset)
+		binary.WriteUvarint64(buf, e.offsets[name])
+	}
+
+	if len(e.Headers) > 0 {
+		buf.WriteByte(HEADERS_MARKER)
+		binary.WriteUvarint(buf, len(e.Headers))
+
+		names := make([]string, 0, len(e.Headers))
+
+		for name := range e.Headers {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			binary.WriteUvarint(buf, len(name))
+			buf.Write([]byte(name))
+			binary.WriteUvarint(buf, len(e.Headers[name]))
+			buf.Write([]byte(e.Headers[name]))
+		}
 	}
 
+	if e.unchecked {
+		return buf.Bytes()
+	}
+
+	sum := crc32.ChecksumIEEE(buf.Bytes())
+
+	buf.WriteByte(CHECKSUM_MARKER)
+	binary.WriteInt32(buf, int(sum))
+
 	return buf.Bytes()
 }
 
 func decodeEvent(b []byte) (*Event, error) {
 	buf := bytes.NewBuffer(b)
 
-	size := binary.ReadUvarint(buf)
+	size, err := binary.ReadUvarintMax(buf, int64(buf.Len()))
+	if err != nil {
+		return nil, CORRUPTED_EVENT_LENGTH
+	}
+
 	data := binary.ReadBytes(buf, size)
 
-	numOffsets := int(binary.ReadUvarint(buf))
+	// Each offset takes at least two bytes.
+	numOffsets, err := binary.ReadUvarintMax(buf, int64(buf.Len()/2))
+	if err != nil {
+		return nil, CORRUPTED_EVENT_LENGTH
+	}
 
 	offsets := make(map[string]int64)
 
-	for i := 0; i < numOffsets; i++ {
-		length := binary.ReadUvarint(buf)
-		name := string(binary.ReadBytes(buf, length))
-		offset := binary.ReadUvarint(buf)
+	for i := int64(0); i < numOffsets; i++ {
+		name, err := binary.ReadStringMax(buf, int64(buf.Len()))
+		if err != nil {
+			return nil, CORRUPTED_EVENT_LENGTH
+		}
+
+		if offsets[name], err = binary.ReadUvarintMax(buf, math.MaxInt64); err != nil {
+			return nil, CORRUPTED_EVENT_LENGTH
+		}
+	}
+
+	headers, err := decodeHeaders(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = verifyChecksum(b[:len(b)-buf.Len()], buf); err != nil {
+		return nil, err
+	}
+
+	event := NewEvent(data, offsets)
+	event.Headers = headers
+
+	return event, nil
+}
+
+// Reads the headers following the event's offsets, if there are any.
+func decodeHeaders(buf *bytes.Buffer) (map[string]string, error) {
+	if buf.Len() == 0 || buf.Bytes()[0] != HEADERS_MARKER {
+		return nil, nil
+	}
+
+	buf.ReadByte()
+
+	// Each header takes at least two bytes.
+	count, err := binary.ReadUvarintMax(buf, int64(buf.Len()/2))
+	if err != nil {
+		return nil, CORRUPTED_EVENT_LENGTH
+	}
+
+	headers := make(map[string]string, count)
+
+	for i := int64(0); i < count; i++ {
+		name, err := binary.ReadStringMax(buf, int64(buf.Len()))
+		if err != nil {
+			return nil, CORRUPTED_EVENT_LENGTH
+		}
+
+		if headers[name], err = binary.ReadStringMax(buf, int64(buf.Len())); err != nil {
+			return nil, CORRUPTED_EVENT_LENGTH
+		}
+	}
+
+	return headers, nil
+}
 
-		offsets[name] = offset
+// Checks the checksum following the encoded event, if there is one.
+func verifyChecksum(encoded []byte, rest *bytes.Buffer) error {
+	if rest.Len() == 0 || rest.Bytes()[0] != CHECKSUM_MARKER {
+		return nil
 	}
 
-	return NewEvent(data, offsets), nil
+	rest.ReadByte()
+
+	sum, err := binary.ReadInt32Full(rest)
+	if err != nil {
+		return CORRUPTED_EVENT_LENGTH
+	}
+
+	if uint32(sum) != crc32.ChecksumIEEE(encoded) {
+		return CHECKSUM_MISMATCH
+	}
+
+	return nil
 }
 
 func pullEvent(r io.ReaderAt, offset int64) (*Event, error) {
-	if size := binary.ReadInt32At(r, offset); size > 0 {
-		offset += 4
+	head, err := readAt(r, 4, offset)
+	if err != nil {
+		return nil, err
+	}
 
-		data := binary.ReadBytesAt(r, size, offset)
+	if size := binary.ReadInt32(bytes.NewReader(head)); len(head) == 4 && size > 0 {
+		data, err := readAt(r, size, offset+4)
+		if err != nil {
+			return nil, err
+		}
 
 		if len(data) < int(size) {
 			return nil, CORRUPTED_EVENT
 		}
 
-		return decodeEvent(data)
+		event, err := decodeEvent(data)
+		if event != nil {
+			event.Offset = offset
+			event.size = int(size)
+		}
+
+		return event, err
 	} else {
 		return nil, io.EOF
 	}
 }
+
+// Reads up to num bytes, returning fewer without an error if the
+// end of the stream is reached. Other errors, such as a failed or
+// short read, are returned so they aren't mistaken for the end.
+func readAt(r io.ReaderAt, num, offset int64) ([]byte, error) {
+	if num <= binary.MAX_PREALLOCATE {
+		b := make([]byte, num)
+
+		n, err := r.ReadAt(b, offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		return b[:n], nil
+	}
+
+	buf := new(bytes.Buffer)
+
+	_, err := io.CopyN(buf, io.NewSectionReader(r, offset, num), num)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
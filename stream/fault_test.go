@@ -0,0 +1,243 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+type fault int
+
+const (
+	TORN_WRITE fault = iota
+	SHORT_READ
+	NO_SPACE
+)
+
+func (f fault) String() string {
+	return []string{"torn write", "short read", "no space"}[f]
+}
+
+var TORN_WRITE_ERROR = errors.New("torn write")
+
+// faultyFile injects a fault into the at'th write or read of a
+// stream file, to simulate the process crashing or the disk
+// misbehaving part way through writing or closing a stream.
+type faultyFile struct {
+	*os.File
+	fault  fault
+	at     int
+	writes int
+	reads  int
+}
+
+func (f *faultyFile) WriteAt(p []byte, off int64) (int, error) {
+	f.writes += 1
+
+	switch {
+	case f.fault == TORN_WRITE && f.writes == f.at:
+		n, _ := f.File.WriteAt(p[:len(p)/2], off)
+		return n, TORN_WRITE_ERROR
+	case f.fault == NO_SPACE && f.writes >= f.at:
+		return 0, syscall.ENOSPC
+	}
+
+	return f.File.WriteAt(p, off)
+}
+
+func (f *faultyFile) ReadAt(p []byte, off int64) (int, error) {
+	f.reads += 1
+
+	if f.fault == SHORT_READ && f.reads == f.at {
+		n, _ := f.File.ReadAt(p[:len(p)/2], off)
+		return n, io.ErrUnexpectedEOF
+	}
+
+	return f.File.ReadAt(p, off)
+}
+
+var faultEvents = []struct {
+	data    string
+	indexes map[string]string
+}{
+	{"abc", map[string]string{"a": "a", "b": "b"}},
+	{"bcd", map[string]string{"b": "b", "c": "c"}},
+	{"cde", map[string]string{"c": "c", "a": "a"}},
+	{"def", map[string]string{"a": "a", "b": "b"}},
+	{"efg", map[string]string{"c": "c"}},
+}
+
+// Creates a stream, writes every event and closes it, with the fault
+// injected at the given write. Returns the events which were
+// acknowledged, and whether closing was.
+func writeFaulty(path string, f fault, at int) (acked []string, closed bool) {
+	os.Remove(path)
+
+	file, _ := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0755)
+	faulty := &faultyFile{File: file, fault: f, at: at}
+
+	s, err := createOpenStream(faulty)
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	for _, e := range faultEvents {
+		if _, err := s.Write([]byte(e.data), e.indexes); err == nil {
+			acked = append(acked, e.data)
+		}
+	}
+
+	closed = s.Close() == nil
+	file.Close()
+
+	return
+}
+
+// Checks what can be read back from the stream after a fault.
+func verifyRecovery(path string, acked []string, closed bool) error {
+	s, err := Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to reopen: %v", err)
+	}
+
+	if closed && !s.Closed() {
+		return errors.New("acknowledged close, but reopened as open")
+	}
+
+	found := make([]string, 0)
+
+	if _, err := s.Iterate(0, func(e *Event) bool {
+		found = append(found, string(e.Data))
+		return true
+	}); err != nil && !errors.Is(err, CORRUPTED_EVENT) {
+		return fmt.Errorf("iterate failed: %v", err)
+	}
+
+	// Every acknowledged event must survive, in order. An event whose
+	// write failed may have been overwritten by the following write,
+	// but no event can appear which was never written at all.
+	if !reflect.DeepEqual(found, append([]string{}, acked...)) {
+		return fmt.Errorf("iterated %v, acknowledged %v", found, acked)
+	}
+
+	for _, index := range []string{"a", "b", "c"} {
+		scanned := make([]string, 0)
+
+		if err := s.ScanIndex(index, index, 0, func(e *Event) bool {
+			scanned = append(scanned, string(e.Data))
+			return true
+		}); err != nil {
+			return fmt.Errorf("scanning %v failed: %v", index, err)
+		}
+
+		wanted := make([]string, 0)
+
+		for i := len(faultEvents) - 1; i >= 0; i-- {
+			e := faultEvents[i]
+			if e.indexes[index] != "" && contains(acked, e.data) {
+				wanted = append(wanted, e.data)
+			}
+		}
+
+		if !reflect.DeepEqual(scanned, wanted) {
+			return fmt.Errorf("scanned %v for %v, wanted %v", scanned, index, wanted)
+		}
+	}
+
+	// An open stream must accept writes once recovered.
+	if !s.Closed() {
+		if _, err := s.Write([]byte("xyz"), map[string]string{"a": "a"}); err != nil {
+			return fmt.Errorf("write after recovery failed: %v", err)
+		}
+
+		offset, _ := s.First("a", "a")
+		if e, err := pullEvent(s.reader(), offset); err != nil || string(e.Data) != "xyz" {
+			return fmt.Errorf("write after recovery unreadable: %v %v", e, err)
+		}
+	}
+
+	s.Close()
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestRecoveryFromWriteFaults(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+
+	// The header, each event, the end of events marker and the footer.
+	writes := 1 + len(faultEvents) + 2
+
+	for _, f := range []fault{TORN_WRITE, NO_SPACE} {
+		for at := 1; at <= writes; at++ {
+			acked, closed := writeFaulty("tmp/fault.stream", f, at)
+
+			// Nothing to recover if the header was never written.
+			if at == 1 {
+				continue
+			}
+
+			if err := verifyRecovery("tmp/fault.stream", acked, closed); err != nil {
+				t.Errorf("%v at write %v: %v", f, at, err)
+			}
+		}
+	}
+}
+
+func TestRecoveryFromShortReads(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+
+	for _, closed := range []bool{false, true} {
+		for at := 1; at <= 20; at++ {
+			os.Remove("tmp/fault.stream")
+
+			s, _ := New("tmp/fault.stream")
+
+			for _, e := range faultEvents {
+				s.Write([]byte(e.data), e.indexes)
+			}
+
+			if closed {
+				s.Close()
+			}
+
+			file, _ := os.OpenFile("tmp/fault.stream", os.O_RDWR, 0755)
+			faulty := &faultyFile{File: file, fault: SHORT_READ, at: at}
+
+			var reopened Stream = newOpenStream(faulty)
+
+			if closed {
+				index, _ := findIndex(file)
+				reopened = &closedStream{stream: faulty, index: index}
+			}
+
+			found := make([]string, 0)
+
+			_, err := reopened.Iterate(0, func(e *Event) bool {
+				found = append(found, string(e.Data))
+				return true
+			})
+
+			// A short read must either fail, or not affect the results.
+			if err == nil && len(found) != len(faultEvents) {
+				t.Errorf("Short read at %v silently returned %v", at, found)
+			}
+
+			file.Close()
+		}
+	}
+}
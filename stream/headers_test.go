@@ -0,0 +1,52 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventHeaders(t *testing.T) {
+	headers := map[string]string{"content-type": "application/json", "schema": "2"}
+
+	for _, opts := range []Options{{}, {NoChecksums: true}} {
+		s := createStream()
+		s.(*openStream).options = opts
+
+		s.WriteWithHeaders([]byte("a"), map[string]string{"a": "1"}, headers)
+		s.Write([]byte("b"), map[string]string{"a": "1"})
+
+		for _, closed := range []bool{false, true} {
+			if closed {
+				s.Close()
+				s = reopenStream()
+			}
+
+			found := make(map[string]map[string]string)
+
+			s.ScanIndex("a", "1", 0, func(e *Event) bool {
+				found[string(e.Data)] = e.Headers
+				return true
+			})
+
+			want := map[string]map[string]string{"a": headers, "b": nil}
+
+			if !reflect.DeepEqual(found, want) {
+				t.Errorf("Options: %+v, closed: %v, wanted: %v, found: %v", opts, closed, want, found)
+			}
+		}
+	}
+}
+
+func TestEventHeadersChecksum(t *testing.T) {
+	event := NewEvent([]byte("a"), map[string]int64{"a:1": 0})
+	event.Headers = map[string]string{"schema": "2"}
+
+	encoded := event.encode()
+
+	// Changing a header's value no longer matches the checksum.
+	encoded[len(encoded)-6] = '3'
+
+	if _, err := decodeEvent(encoded); err != CHECKSUM_MISMATCH {
+		t.Errorf("Wanted: %v, found: %v", CHECKSUM_MISMATCH, err)
+	}
+}
@@ -0,0 +1,125 @@
+package stream
+
+import (
+	"math"
+	"sort"
+)
+
+// Scans the events written with every one of the index values, from
+// newest to oldest. Each index's chain is walked a step at a time in
+// turn, and every event read is checked for all the values, so the
+// scan ends once the shortest chain does, having read about as many
+// events for each index as the rarest value has.
+//
+// Returns the offset to resume from, which is that of the next event
+// on the chains of every value, or 0 once there are none left.
+// Resuming walks only the chains the event at the offset is on, as the
+// others can't be found from it, but finds the same events.
+func scanIndexes(s Stream, indexes map[string]string, offset int64, scanner Scanner) (int64, error) {
+	if len(indexes) == 0 {
+		return 0, nil
+	}
+
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = name + ":" + indexes[name]
+	}
+
+	// Where each chain is up to, or -1 for chains which aren't walked.
+	positions := make([]int64, len(keys))
+
+	if offset <= 0 {
+		for i, name := range names {
+			first, err := s.First(name, indexes[name])
+			if err != nil || first == 0 {
+				return 0, err
+			}
+
+			positions[i] = first
+		}
+	} else {
+		event, err := pullEvent(s.reader(), offset)
+		if err != nil {
+			return offset, corrupted(err, offset)
+		}
+
+		walked := false
+
+		for i, key := range keys {
+			positions[i] = -1
+
+			if _, ok := event.offsets[key]; ok {
+				positions[i], walked = offset, true
+			}
+		}
+
+		if !walked {
+			return 0, nil
+		}
+	}
+
+	// Every chain reaches the events found in the same order, so an
+	// event is only new if it's older than the last found.
+	last := int64(math.MaxInt64)
+
+	for {
+		for i, key := range keys {
+			if positions[i] < 0 {
+				continue
+			}
+
+			// The chain has ended, so every event on all of them was found.
+			if positions[i] == 0 {
+				return 0, nil
+			}
+
+			event, err := pullEvent(s.reader(), positions[i])
+			if err != nil {
+				return positions[i], corrupted(err, positions[i])
+			}
+
+			positions[i] = event.offsets[key]
+
+			if event.Offset >= last || !indexedWith(event, keys) {
+				continue
+			}
+
+			last = event.Offset
+
+			if !scanner(event) {
+				return nextIndexed(event, keys), nil
+			}
+		}
+	}
+}
+
+func indexedWith(e *Event, keys []string) bool {
+	for _, key := range keys {
+		if _, ok := e.offsets[key]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The oldest of the events following e on each chain. No older event
+// on all of them comes before it, so each is reached from it.
+func nextIndexed(e *Event, keys []string) int64 {
+	next := int64(math.MaxInt64)
+
+	for _, key := range keys {
+		if offset := e.offsets[key]; offset < next {
+			next = offset
+		}
+	}
+
+	return next
+}
@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanIndexes(t *testing.T) {
+	s := createStream()
+
+	s.Write([]byte("a"), map[string]string{"customer": "1", "type": "purchase"})
+	s.Write([]byte("b"), map[string]string{"customer": "2", "type": "purchase"})
+	s.Write([]byte("c"), map[string]string{"customer": "1", "type": "view"})
+	s.Write([]byte("d"), map[string]string{"customer": "1", "type": "purchase"})
+	s.Write([]byte("e"), map[string]string{"customer": "2", "type": "view"})
+	s.Write([]byte("f"), map[string]string{"customer": "1", "type": "purchase", "source": "web"})
+
+	var tests = []struct {
+		indexes map[string]string
+		events  []string
+	}{
+		{map[string]string{"customer": "1", "type": "purchase"}, []string{"f", "d", "a"}},
+		{map[string]string{"customer": "2", "type": "purchase"}, []string{"b"}},
+		{map[string]string{"customer": "1", "type": "purchase", "source": "web"}, []string{"f"}},
+		{map[string]string{"customer": "2", "source": "web"}, []string{}},
+		{map[string]string{"customer": "3", "type": "view"}, []string{}},
+		{map[string]string{"type": "view"}, []string{"e", "c"}},
+	}
+
+	for _, closed := range []bool{false, true} {
+		if closed {
+			s.Close()
+			s = reopenStream()
+		}
+
+		for i, test := range tests {
+			found := make([]string, 0)
+
+			offset, err := s.ScanIndexes(test.indexes, 0, func(e *Event) bool {
+				found = append(found, string(e.Data))
+				return true
+			})
+
+			if offset != 0 || err != nil {
+				t.Errorf("Case #%v: wanted: 0,<nil> found: %v,%v", i, offset, err)
+			}
+
+			if !reflect.DeepEqual(found, test.events) {
+				t.Errorf("Case #%v: wanted: %v, found: %v", i, test.events, found)
+			}
+		}
+	}
+}
+
+func TestContinueScanIndexes(t *testing.T) {
+	s := createStream()
+
+	s.Write([]byte("a"), map[string]string{"customer": "1", "type": "purchase"})
+	s.Write([]byte("b"), map[string]string{"customer": "1", "type": "view"})
+	s.Write([]byte("c"), map[string]string{"customer": "1", "type": "purchase"})
+	s.Write([]byte("d"), map[string]string{"customer": "2", "type": "purchase"})
+	s.Write([]byte("e"), map[string]string{"customer": "1", "type": "purchase"})
+
+	var offset int64
+	var err error
+
+	indexes := map[string]string{"customer": "1", "type": "purchase"}
+	found := make([]string, 0)
+
+	for i := 0; i < 3; i++ {
+		offset, err = s.ScanIndexes(indexes, offset, func(e *Event) bool {
+			found = append(found, string(e.Data))
+			return false
+		})
+
+		if err != nil {
+			t.Errorf("Wanted no error, found: %v", err)
+		}
+	}
+
+	if offset != 0 {
+		t.Errorf("Wanted offset: 0, found: %v", offset)
+	}
+
+	if !reflect.DeepEqual(found, []string{"e", "c", "a"}) {
+		t.Errorf("Wanted: %v, found: %v", []string{"e", "c", "a"}, found)
+	}
+}
@@ -5,12 +5,18 @@ import (
 )
 
 func Merge(destination string, streams []string) error {
+	return MergeFiltered(destination, streams, func(int, *Event) bool { return true })
+}
+
+// Merges the streams, leaving out any events for which keep,
+// given the position of the event's stream, returns false.
+func MergeFiltered(destination string, streams []string, keep func(int, *Event) bool) error {
 	m, err := New(destination)
 	if err != nil {
 		return err
 	}
 
-	for _, path := range streams {
+	for i, path := range streams {
 		s, err := Open(path)
 		if err != nil {
 			return err
@@ -19,7 +25,9 @@ func Merge(destination string, streams []string) error {
 		log.Println("merging", path)
 
 		_, err = s.Iterate(0, func(e *Event) bool {
-			m.Write(e.Data, e.Indexes())
+			if keep(i, e) {
+				m.WriteWithHeaders(e.Data, e.Indexes(), e.Headers)
+			}
 			return true
 		})
 
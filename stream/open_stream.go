@@ -6,9 +6,11 @@ import (
 	"io"
 	"os"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/customerio/esdb/binary"
+	"github.com/customerio/esdb/bloom"
 	"github.com/customerio/esdb/sst"
 )
 
@@ -16,11 +18,19 @@ var CORRUPTED_HEADER = errors.New("Incorrect stream file header.")
 
 type openStream struct {
 	stream   Streamer
+	options  Options
 	tails    map[string]int64
 	closed   bool
 	offset   int64
 	length   int
 	initlock sync.Once
+	// Syncs in the background, if written with SYNC_INTERVAL.
+	syncer *syncer
+	// Guards the tails and offset, and reads of the stream while events
+	// are written to it, so only whole events are read.
+	lock sync.RWMutex
+	// Of the events written, without values counted. See Stats.
+	stats Stats
 }
 
 func read(path string) (Stream, error) {
@@ -42,6 +52,7 @@ func createOpenStream(stream Streamer) (Stream, error) {
 		stream: stream,
 		tails:  make(map[string]int64),
 		offset: int64(offset),
+		stats:  make(Stats),
 	}, nil
 }
 
@@ -50,6 +61,10 @@ func newOpenStream(stream Streamer) Stream {
 }
 
 func Serialize(data []byte, indexes map[string]string, tails map[string]int64) ([]byte, error) {
+	return serialize(data, indexes, nil, tails, true)
+}
+
+func serialize(data []byte, indexes, headers map[string]string, tails map[string]int64, checksum bool) ([]byte, error) {
 	offsets := make(map[string]int64)
 
 	for name, value := range indexes {
@@ -63,6 +78,8 @@ func Serialize(data []byte, indexes map[string]string, tails map[string]int64) (
 	}
 
 	event := NewEvent(data, offsets)
+	event.Headers = headers
+	event.unchecked = !checksum
 
 	buf := bytes.NewBuffer([]byte{})
 
@@ -75,15 +92,36 @@ func Serialize(data []byte, indexes map[string]string, tails map[string]int64) (
 }
 
 func (s *openStream) Write(data []byte, indexes map[string]string) (int, error) {
-	if s.Closed() {
-		return 0, WRITING_TO_CLOSED_STREAM
-	}
+	return s.WriteWithHeaders(data, indexes, nil)
+}
 
+func (s *openStream) WriteWithHeaders(data []byte, indexes, headers map[string]string) (int, error) {
 	if err := s.init(); err != nil {
 		return 0, err
 	}
 
-	bytes, err := Serialize(data, indexes, s.tails)
+	written, err := s.append(data, indexes, headers)
+	if err != nil {
+		return 0, err
+	}
+
+	// Synced once the lock's released, so reads don't wait on the disk.
+	if s.options.Durability == SYNC_ALWAYS {
+		err = s.Sync()
+	}
+
+	return written, err
+}
+
+func (s *openStream) append(data []byte, indexes, headers map[string]string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return 0, WRITING_TO_CLOSED_STREAM
+	}
+
+	bytes, err := serialize(data, indexes, headers, s.tails, !s.options.NoChecksums)
 	if err != nil {
 		return 0, err
 	}
@@ -93,14 +131,27 @@ func (s *openStream) Write(data []byte, indexes map[string]string) (int, error)
 		return 0, err
 	}
 
+	names := make([]string, 0, len(indexes))
+
 	for name, value := range indexes {
 		index := name + ":" + value
 		s.tails[index] = s.offset
+		names = append(names, name)
 	}
 
+	s.stats.record(names, int64(written))
+
 	s.offset += int64(written)
 	s.length += 1
 
+	if s.options.Durability == SYNC_INTERVAL {
+		if s.syncer == nil {
+			s.syncer = startSyncer(s.options.syncInterval(), s.Sync)
+		}
+
+		s.syncer.written()
+	}
+
 	return written, nil
 }
 
@@ -108,7 +159,9 @@ func (s *openStream) First(name, value string) (offset int64, err error) {
 	index := name + ":" + value
 
 	if err = s.init(); err == nil {
+		s.lock.RLock()
 		offset = s.tails[index]
+		s.lock.RUnlock()
 	}
 
 	return
@@ -127,46 +180,156 @@ func (s *openStream) ScanIndex(name, value string, offset int64, scanner Scanner
 	return scanIndex(s, index, offset, scanner)
 }
 
+func (s *openStream) ScanIndexes(indexes map[string]string, offset int64, scanner Scanner) (int64, error) {
+	return scanIndexes(s, indexes, offset, scanner)
+}
+
+// Scans the events with a value of the index beginning with the prefix.
+// See scanChains.
+func (s *openStream) ScanPrefix(name, prefix string, offset int64, scanner Scanner) (int64, error) {
+	if err := s.init(); err != nil {
+		return 0, err
+	}
+
+	heads := make(map[string]int64)
+
+	s.lock.RLock()
+	for index, tail := range s.tails {
+		if strings.HasPrefix(index, name+":"+prefix) {
+			heads[index] = tail
+		}
+	}
+	s.lock.RUnlock()
+
+	return scanChains(s, heads, offset, scanner)
+}
+
+func (s *openStream) Values(name string) ([]string, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+
+	var values []string
+
+	s.lock.RLock()
+	for index := range s.tails {
+		if strings.HasPrefix(index, name+":") {
+			values = append(values, index[len(name)+1:])
+		}
+	}
+	s.lock.RUnlock()
+
+	sort.Strings(values)
+
+	return values, nil
+}
+
 func (s *openStream) Iterate(offset int64, scanner Scanner) (int64, error) {
 	return iterate(s, offset, scanner)
 }
 
+// Iterates only the events written when called.
+func (s *openStream) IterateReverse(offset int64, scanner Scanner) (int64, error) {
+	if end := s.Offset(); offset <= 0 || offset > end {
+		offset = end
+	}
+
+	return iterateReverse(s, offset, scanner)
+}
+
 func (s *openStream) Offset() int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	return s.offset
 }
 
+// Flushes events written so far to disk, if the
+// stream is backed by something which can be synced.
+func (s *openStream) Sync() error {
+	if f, ok := s.stream.(interface {
+		Sync() error
+	}); ok {
+		return f.Sync()
+	}
+
+	return nil
+}
+
+// The stats of the events written so far.
+func (s *openStream) Stats() (Stats, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.stats.withValues(s.tails), nil
+}
+
 func (s *openStream) Closed() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	return s.closed
 }
 
 func (s *openStream) reader() io.ReaderAt {
-	return s.stream
+	return lockedReader{s}
 }
 
-func (s *openStream) Close() (err error) {
-	if s.Closed() {
-		return
-	}
+// Reads wait for events being written, so an event's length is never
+// read before the rest of it is written.
+type lockedReader struct {
+	s *openStream
+}
+
+func (r lockedReader) ReadAt(p []byte, offset int64) (int, error) {
+	r.s.lock.RLock()
+	defer r.s.lock.RUnlock()
+
+	return r.s.stream.ReadAt(p, offset)
+}
 
+// Scans still reading the stream as it's closed may fail.
+func (s *openStream) Close() (err error) {
 	err = s.init()
 	if err != nil {
 		return err
 	}
 
-	// Write nil event, to signal end of events.
-	binary.WriteInt32At(s.stream, 0, s.offset)
-	s.offset += 4
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return
+	}
 
-	indexes := make(sort.StringSlice, 0, len(s.tails))
+	indexes := make(sort.StringSlice, 0, len(s.tails)+1)
 
 	for name, _ := range s.tails {
 		indexes = append(indexes, name)
 	}
 
+	var filter *bloom.Filter
+
+	if !s.options.NoBloomFilter {
+		filter = bloom.New(len(s.tails), BLOOM_BITS_PER_KEY)
+
+		for name := range s.tails {
+			filter.Add([]byte(name))
+		}
+
+		indexes = append(indexes, BLOOM_KEY)
+	}
+
+	indexes = append(indexes, STATS_KEY)
+
 	sort.Stable(indexes)
 
 	buf := new(bytes.Buffer)
-	st := sst.NewWriter(buf)
+	st := sst.NewWriterSize(buf, s.options.indexBlockSize())
 
 	// For each grouping or index, we index the section's
 	// byte offset in the file and the length in bytes
@@ -174,7 +337,13 @@ func (s *openStream) Close() (err error) {
 	for _, name := range indexes {
 		buf := new(bytes.Buffer)
 
-		binary.WriteUvarint64(buf, s.tails[name])
+		if name == BLOOM_KEY {
+			buf.Write(filter.Bytes())
+		} else if name == STATS_KEY {
+			buf.Write(s.stats.withValues(s.tails).encode())
+		} else {
+			binary.WriteUvarint64(buf, s.tails[name])
+		}
 
 		if err = st.Set([]byte(name), buf.Bytes()); err != nil {
 			return
@@ -188,13 +357,29 @@ func (s *openStream) Close() (err error) {
 	binary.WriteInt64(buf, int64(len(buf.Bytes())))
 	buf.Write([]byte(MAGIC_FOOTER))
 
-	_, err = s.stream.WriteAt(buf.Bytes(), s.offset)
-	if err == nil {
-		s.closed = true
+	// Write nil event, to signal end of events, along with the
+	// footer so the stream is only closed if both were written.
+	footer := new(bytes.Buffer)
+	binary.WriteInt32(footer, 0)
+	footer.Write(buf.Bytes())
+
+	// If the footer can't be written, the stream is left open, so
+	// events can still be written to it and closing it retried.
+	if _, err = s.stream.WriteAt(footer.Bytes(), s.offset); err != nil {
+		return
+	}
+
+	s.offset += 4
+	s.closed = true
+
+	if s.syncer != nil {
+		err = s.syncer.close(s.Sync)
 	}
 
 	if closer, ok := s.stream.(io.Closer); ok {
-		return closer.Close()
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
 	}
 
 	return
@@ -202,29 +387,38 @@ func (s *openStream) Close() (err error) {
 
 func (s *openStream) init() (e error) {
 	s.initlock.Do(func() {
-		tails, offset, length, err := populate(s)
+		tails, stats, offset, length, err := populate(s)
 
 		e = err
 
 		if e == nil {
+			s.lock.Lock()
 			s.tails = tails
+			s.stats = stats
 			s.offset = offset
 			s.length = length
+			s.lock.Unlock()
 		}
 	})
 
 	return
 }
 
-func populate(s *openStream) (tails map[string]int64, offset int64, length int, err error) {
+func populate(s *openStream) (tails map[string]int64, stats Stats, offset int64, length int, err error) {
 	tails = make(map[string]int64)
+	stats = make(Stats)
 	offset = HEADER_LENGTH
 
 	_, err = iterate(s, 0, func(event *Event) bool {
+		names := make([]string, 0, len(event.offsets))
+
 		for index, _ := range event.offsets {
 			tails[index] = offset
+			names = append(names, indexName(index))
 		}
 
+		stats.record(names, int64(event.length()))
+
 		// set tail for all event indexes
 		offset += int64(event.length())
 		length += 1
@@ -233,7 +427,7 @@ func populate(s *openStream) (tails map[string]int64, offset int64, length int,
 	})
 
 	// If we couldn't decode the last event, it's ok.
-	if err == CORRUPTED_EVENT {
+	if errors.Is(err, CORRUPTED_EVENT) {
 		err = nil
 	}
 
@@ -2,7 +2,9 @@ package stream
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"reflect"
@@ -546,6 +548,56 @@ func TestInterleavedReadWrites(t *testing.T) {
 	}
 }
 
+func TestConcurrentReadWrites(t *testing.T) {
+	s := createStream()
+
+	done := make(chan bool)
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 500; i++ {
+			s.Write([]byte("abc"), map[string]string{"a": "a", fmt.Sprint("b", i%10): "b"})
+		}
+	}()
+
+	// Scans only ever see whole events, however far writes have got.
+	for scanning := true; scanning; {
+		select {
+		case <-done:
+			scanning = false
+		default:
+		}
+
+		if err := s.ScanIndex("a", "a", 0, func(e *Event) bool { return true }); err != nil {
+			t.Fatalf("Unable to scan while writing: %v", err)
+		}
+
+		if _, err := s.Iterate(0, func(e *Event) bool { return true }); err != nil {
+			t.Fatalf("Unable to iterate while writing: %v", err)
+		}
+
+		if _, err := s.IterateReverse(0, func(e *Event) bool { return true }); err != nil {
+			t.Fatalf("Unable to iterate in reverse while writing: %v", err)
+		}
+
+		if _, err := s.ScanPrefix("b", "", 0, func(e *Event) bool { return true }); err != nil {
+			t.Fatalf("Unable to scan prefix while writing: %v", err)
+		}
+	}
+
+	count := 0
+
+	s.Iterate(0, func(e *Event) bool {
+		count++
+		return true
+	})
+
+	if count != 500 {
+		t.Errorf("Wanted: 500 events, found: %v", count)
+	}
+}
+
 func TestRecoverOpenCorruptedLog(t *testing.T) {
 	s := createStream()
 
@@ -575,18 +627,18 @@ func TestFailedWrite(t *testing.T) {
 	s, _ := createOpenStream(rws)
 
 	n, err := s.Write([]byte("abc"), map[string]string{"a": "a", "b": "b", "c": "c"})
-	if n != 24 || err != nil {
-		t.Errorf("Write incorrect results. expected: 24, <nil> found: %v, %v", n, err)
+	if n != 29 || err != nil {
+		t.Errorf("Write incorrect results. expected: 29, <nil> found: %v, %v", n, err)
 	}
 
 	n, err = s.Write([]byte("cde"), map[string]string{"c": "c", "d": "d", "e": "e"})
-	if n != 24 || err != nil {
-		t.Errorf("Write incorrect results. expected: 24, <nil> found: %v, %v", n, err)
+	if n != 29 || err != nil {
+		t.Errorf("Write incorrect results. expected: 29, <nil> found: %v, %v", n, err)
 	}
 
 	n, err = s.Write([]byte("def"), map[string]string{"d": "d", "e": "e", "f": "f"})
-	if n != 24 || err != nil {
-		t.Errorf("Write incorrect results. expected: 24, <nil> found: %v, %v", n, err)
+	if n != 29 || err != nil {
+		t.Errorf("Write incorrect results. expected: 29, <nil> found: %v, %v", n, err)
 	}
 
 	rws.failWrites = true
@@ -597,8 +649,8 @@ func TestFailedWrite(t *testing.T) {
 	rws.failWrites = false
 
 	n, err = s.Write([]byte("fgh"), map[string]string{"f": "f", "g": "g", "h": "h"})
-	if n != 24 || err != nil {
-		t.Errorf("Write incorrect results. expected: 24, <nil> found: %v, %v", n, err)
+	if n != 29 || err != nil {
+		t.Errorf("Write incorrect results. expected: 29, <nil> found: %v, %v", n, err)
 	}
 
 	found := make([]string, 0)
@@ -636,3 +688,75 @@ func TestFailedWrite(t *testing.T) {
 		t.Errorf("Wanted: %v, found: %v", []string{"abc", "cde", "def", "fgh"}, found)
 	}
 }
+
+func TestCorruptedEventLengths(t *testing.T) {
+	var tests = [][]byte{
+		// event length larger than the event
+		{0xff, 0xff, 0xff, 0xff, 0x0f, 'a'},
+		// more offsets than could fit in the event
+		{0x01, 'a', 0xff, 0xff, 0xff, 0x0f},
+		// index name longer than the event
+		{0x01, 'a', 0x01, 0xff, 0xff, 0x0f, 'b'},
+	}
+
+	for i, test := range tests {
+		if _, err := decodeEvent(test); err != CORRUPTED_EVENT_LENGTH {
+			t.Errorf("Case #%v: Expected corrupted length error, found: %v", i, err)
+		}
+	}
+
+	// An event claiming to be 2GB shouldn't be allocated.
+	rws := &RWS{buf: []byte{0xff, 0xff, 0xff, 0x7f, 'a'}}
+
+	if _, err := pullEvent(rws, 0); err != CORRUPTED_EVENT {
+		t.Errorf("Expected corrupted event error, found: %v", err)
+	}
+}
+
+func TestOpenIterateReverse(t *testing.T) {
+	s := createStream()
+
+	s.Write([]byte("abc"), map[string]string{"a": "a"})
+	s.Write([]byte("cde"), map[string]string{"c": "c"})
+
+	found := make([]string, 0)
+
+	offset, err := s.IterateReverse(0, func(e *Event) bool {
+		found = append(found, string(e.Data))
+		return true
+	})
+
+	if err != nil || offset != HEADER_LENGTH {
+		t.Errorf("Error found while iterating: %v %v", offset, err)
+	}
+
+	if !reflect.DeepEqual(found, []string{"cde", "abc"}) {
+		t.Errorf("Wanted: %v, found: %v", []string{"cde", "abc"}, found)
+	}
+}
+
+func TestStreamsAreWrittenDeterministically(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+
+	write := func(path string) []byte {
+		os.Remove(path)
+
+		s, _ := New(path)
+
+		for i := 0; i < 10; i++ {
+			indexes := map[string]string{"a": "1", "b": "2", "c": "3", "d": fmt.Sprint(i), "e": "5", "f": "6"}
+			headers := map[string]string{"x": "1", "y": "2", "z": "3", "w": "4"}
+
+			s.WriteWithHeaders([]byte("event"), indexes, headers)
+		}
+
+		s.Close()
+
+		b, _ := ioutil.ReadFile(path)
+		return b
+	}
+
+	if a, b := write("tmp/a.stream"), write("tmp/b.stream"); !reflect.DeepEqual(a, b) {
+		t.Errorf("Expected streams of the same events to be identical")
+	}
+}
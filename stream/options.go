@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"errors"
+	"time"
+
+	"github.com/customerio/esdb/sst"
+)
+
+var INVALID_INDEX_BLOCK_SIZE = errors.New("index block size must not be negative")
+
+// Options configures how a stream is written. Streams are read the same
+// way whatever they were written with, as each event records whether it
+// has a checksum and the index its blocks, so readers need none.
+type Options struct {
+	// Bytes in each block of the index written as the stream is closed,
+	// sst.BlockSize if 0. Each index value looked up reads a block, so
+	// larger blocks suit disks where seeking costs more than reading.
+	IndexBlockSize int
+	// Writes events without checksums, saving 5 bytes of each, though
+	// they're no longer found to be corrupted as they're read.
+	NoChecksums bool
+	// Leaves the bloom filter of index values out of the index, so
+	// looking up a value the stream doesn't have reads a block of it.
+	NoBloomFilter bool
+	// When events written are synced to disk, SYNC_NEVER by default.
+	Durability Durability
+	// How often SYNC_INTERVAL syncs, DEFAULT_SYNC_INTERVAL if 0.
+	SyncInterval time.Duration
+}
+
+// Checks the options are valid, as NewWithOptions does.
+func (o Options) Validate() error {
+	if o.IndexBlockSize < 0 {
+		return INVALID_INDEX_BLOCK_SIZE
+	}
+
+	if o.Durability < SYNC_NEVER || o.Durability > SYNC_INTERVAL {
+		return INVALID_DURABILITY
+	}
+
+	if o.SyncInterval < 0 {
+		return INVALID_SYNC_INTERVAL
+	}
+
+	return nil
+}
+
+func (o Options) indexBlockSize() int {
+	if o.IndexBlockSize == 0 {
+		return sst.BlockSize
+	}
+
+	return o.IndexBlockSize
+}
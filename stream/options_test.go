@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestStreamOptions(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	os.Remove("tmp/test.stream")
+
+	s, err := NewWithOptions("tmp/test.stream", Options{IndexBlockSize: 64, NoChecksums: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written, _ := s.Write([]byte("a"), map[string]string{"a": "1"})
+
+	if checksummed, _ := Serialize([]byte("a"), map[string]string{"a": "1"}, nil); written != len(checksummed)-5 {
+		t.Errorf("Wanted event without a checksum, found: %v bytes", written)
+	}
+
+	for i := 0; i < 100; i++ {
+		s.Write([]byte("b"), map[string]string{"a": fmt.Sprint(i)})
+	}
+
+	s.Close()
+
+	s = reopenStream()
+
+	// The index is spread over many small blocks.
+	for _, value := range []string{"1", "50", "99"} {
+		found := 0
+
+		s.ScanIndex("a", value, 0, func(e *Event) bool {
+			found += 1
+			return true
+		})
+
+		if wanted := map[string]int{"1": 2, "50": 1, "99": 1}[value]; found != wanted {
+			t.Errorf("Value %v: wanted: %v events, found: %v", value, wanted, found)
+		}
+	}
+
+	if _, err := NewWithOptions("tmp/other.stream", Options{IndexBlockSize: -1}); err != INVALID_INDEX_BLOCK_SIZE {
+		t.Errorf("Wanted: %v, found: %v", INVALID_INDEX_BLOCK_SIZE, err)
+	}
+}
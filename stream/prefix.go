@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"container/heap"
+)
+
+// A chain of events with an index value, and the next event on it.
+type chain struct {
+	index  string
+	offset int64
+}
+
+// chains is a heap of chains, ordered by the newest event next on each.
+type chains []chain
+
+func (c chains) Len() int           { return len(c) }
+func (c chains) Less(i, j int) bool { return c[i].offset > c[j].offset }
+func (c chains) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+func (c *chains) Push(x interface{}) {
+	*c = append(*c, x.(chain))
+}
+
+func (c *chains) Pop() interface{} {
+	old := *c
+	last := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return last
+}
+
+// Scans the events on any of the chains, given by the offset of the
+// newest event on each, from newest to oldest. They're scanned in the
+// order written, as chains are merged by the offset of their events.
+// An event only has one value of each index, so is on only one chain
+// of the values of one index.
+//
+// Returns the offset to resume from, that of the next event on any of
+// the chains, or 0 once there are none left. Resuming skips the events
+// newer than it on each chain, reading them again to do so.
+func scanChains(s Stream, heads map[string]int64, offset int64, scanner Scanner) (int64, error) {
+	next := make(chains, 0, len(heads))
+
+	for index, head := range heads {
+		for offset > 0 && head > offset {
+			event, err := pullEvent(s.reader(), head)
+			if err != nil {
+				return offset, corrupted(err, head)
+			}
+
+			head = event.offsets[index]
+		}
+
+		if head > 0 {
+			next = append(next, chain{index, head})
+		}
+	}
+
+	heap.Init(&next)
+
+	for len(next) > 0 {
+		c := &next[0]
+
+		event, err := pullEvent(s.reader(), c.offset)
+		if err != nil {
+			return c.offset, corrupted(err, c.offset)
+		}
+
+		if c.offset = event.offsets[c.index]; c.offset > 0 {
+			heap.Fix(&next, 0)
+		} else {
+			heap.Pop(&next)
+		}
+
+		if !scanner(event) {
+			if len(next) == 0 {
+				return 0, nil
+			}
+
+			return next[0].offset, nil
+		}
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanPrefix(t *testing.T) {
+	s := createStream()
+
+	s.Write([]byte("a"), map[string]string{"customer": "12"})
+	s.Write([]byte("b"), map[string]string{"customer": "2"})
+	s.Write([]byte("c"), map[string]string{"customer": "123"})
+	s.Write([]byte("d"), map[string]string{"customer": "12", "type": "view"})
+	s.Write([]byte("e"), map[string]string{"customer": "13"})
+	s.Write([]byte("f"), map[string]string{"type": "12"})
+
+	var tests = []struct {
+		name   string
+		prefix string
+		events []string
+	}{
+		{"customer", "12", []string{"d", "c", "a"}},
+		{"customer", "1", []string{"e", "d", "c", "a"}},
+		{"customer", "123", []string{"c"}},
+		{"customer", "", []string{"e", "d", "c", "b", "a"}},
+		{"customer", "3", []string{}},
+		{"type", "", []string{"f", "d"}},
+		{"other", "", []string{}},
+	}
+
+	for _, closed := range []bool{false, true} {
+		if closed {
+			s.Close()
+			s = reopenStream()
+		}
+
+		for i, test := range tests {
+			found := make([]string, 0)
+
+			offset, err := s.ScanPrefix(test.name, test.prefix, 0, func(e *Event) bool {
+				found = append(found, string(e.Data))
+				return true
+			})
+
+			if offset != 0 || err != nil {
+				t.Errorf("Case #%v: wanted: 0,<nil> found: %v,%v", i, offset, err)
+			}
+
+			if !reflect.DeepEqual(found, test.events) {
+				t.Errorf("Case #%v: wanted: %v, found: %v", i, test.events, found)
+			}
+		}
+	}
+}
+
+func TestContinueScanPrefix(t *testing.T) {
+	s := createStream()
+
+	s.Write([]byte("a"), map[string]string{"customer": "10"})
+	s.Write([]byte("b"), map[string]string{"customer": "11"})
+	s.Write([]byte("c"), map[string]string{"customer": "2"})
+	s.Write([]byte("d"), map[string]string{"customer": "10"})
+	s.Write([]byte("e"), map[string]string{"customer": "12"})
+
+	for _, closed := range []bool{false, true} {
+		if closed {
+			s.Close()
+			s = reopenStream()
+		}
+
+		var offset int64
+		var err error
+
+		found := make([]string, 0)
+
+		for i := 0; i < 4; i++ {
+			offset, err = s.ScanPrefix("customer", "1", offset, func(e *Event) bool {
+				found = append(found, string(e.Data))
+				return false
+			})
+
+			if err != nil {
+				t.Errorf("Wanted no error, found: %v", err)
+			}
+		}
+
+		if offset != 0 {
+			t.Errorf("Wanted offset: 0, found: %v", offset)
+		}
+
+		if !reflect.DeepEqual(found, []string{"e", "d", "b", "a"}) {
+			t.Errorf("Wanted: %v, found: %v", []string{"e", "d", "b", "a"}, found)
+		}
+	}
+}
+
+func TestStreamValues(t *testing.T) {
+	s := createStream()
+
+	s.Write([]byte("a"), map[string]string{"a": "2"})
+	s.Write([]byte("b"), map[string]string{"a": "1", "ab": "3"})
+	s.Write([]byte("c"), map[string]string{"a": "2"})
+
+	for _, closed := range []bool{false, true} {
+		if closed {
+			s.Close()
+			s = reopenStream()
+		}
+
+		if values, err := s.Values("a"); err != nil || !reflect.DeepEqual(values, []string{"1", "2"}) {
+			t.Errorf("Closed: %v, wanted: [1 2], found: %v %v", closed, values, err)
+		}
+	}
+}
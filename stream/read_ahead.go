@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"io"
+)
+
+// Most events read ahead of the scanner while iterating.
+const READ_AHEAD = 64
+
+type pulled struct {
+	event *Event
+	err   error
+}
+
+// Iterates as iterate, but reads and decodes upcoming events on
+// another goroutine while the scanner handles earlier ones, so reading
+// the disk overlaps with the scanner. Only safe for streams which are
+// no longer written to.
+func iterateAhead(s Stream, offset int64, scanner Scanner) (int64, error) {
+	offset, err := start(s, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	events := make(chan pulled, READ_AHEAD)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func(offset int64) {
+		defer close(events)
+
+		for {
+			event, err := pullEvent(s.reader(), offset)
+
+			select {
+			case events <- pulled{event, err}:
+			case <-stop:
+				return
+			}
+
+			if err != nil {
+				return
+			}
+
+			offset += int64(event.length())
+		}
+	}(offset)
+
+	for p := range events {
+		if p.err == io.EOF {
+			break
+		} else if p.err != nil {
+			return offset, corrupted(p.err, offset)
+		}
+
+		offset += int64(p.event.length())
+
+		if !scanner(p.event) {
+			break
+		}
+	}
+
+	return offset, nil
+}
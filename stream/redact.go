@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var REDACTING_OPEN_STREAM = errors.New("only closed streams can be redacted")
+var REDACTION_TOO_LARGE = errors.New("redacted event must not be larger than the original")
+var INVALID_REDACTION = errors.New("redacted offset is not an event in the stream")
+
+// Copies the closed stream at path to destination, replacing the
+// bodies of the events at the given offsets. A nil or empty body
+// removes it entirely. Redacted events keep their indexes and headers,
+// and are padded to their original length, so offsets and
+// continuations are preserved. Every redaction is checked before any is
+// written, so none are if one offset isn't an event in the stream.
+func Redact(path, destination string, redactions map[int64][]byte) error {
+	s, err := Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer s.Close()
+
+	if !s.Closed() {
+		return REDACTING_OPEN_STREAM
+	}
+
+	padded, err := redacted(s, redactions)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err == nil {
+		err = redact(out, padded)
+	}
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(destination)
+	}
+
+	return err
+}
+
+// Checks the redactions could be made to the closed stream at path,
+// without making them.
+func CheckRedactions(path string, redactions map[int64][]byte) error {
+	s, err := Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer s.Close()
+
+	if !s.Closed() {
+		return REDACTING_OPEN_STREAM
+	}
+
+	_, err = redacted(s, redactions)
+	return err
+}
+
+// Encodes each redacted event, by offset, padded to the original's length.
+func redacted(s Stream, redactions map[int64][]byte) (map[int64][]byte, error) {
+	padded := make(map[int64][]byte, len(redactions))
+
+	for offset, body := range redactions {
+		event, err := pullEvent(s.reader(), offset)
+		if err == io.EOF || err == CORRUPTED_EVENT || err == CORRUPTED_EVENT_LENGTH {
+			return nil, INVALID_REDACTION
+		} else if err != nil {
+			return nil, err
+		}
+
+		if body == nil {
+			body = []byte{}
+		}
+
+		redacted := NewEvent(body, event.offsets)
+		redacted.Headers = event.Headers
+
+		encoded := redacted.encode()
+
+		if len(encoded) > event.size {
+			return nil, REDACTION_TOO_LARGE
+		}
+
+		padded[offset] = make([]byte, event.size)
+		copy(padded[offset], encoded)
+	}
+
+	return padded, nil
+}
+
+func redact(w io.WriterAt, padded map[int64][]byte) error {
+	for offset, event := range padded {
+		if _, err := w.WriteAt(event, offset+4); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package stream
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	buildStream()
+
+	s := reopenStream()
+
+	offsets := make([]int64, 0)
+	s.Iterate(0, func(e *Event) bool {
+		offsets = append(offsets, e.Offset)
+		return true
+	})
+
+	err := Redact("tmp/test.stream", "tmp/redacted.stream", map[int64][]byte{
+		offsets[0]: nil,
+		offsets[1]: []byte("x"),
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error redacting stream: %v", err)
+	}
+
+	r, err := Open("tmp/redacted.stream")
+	if err != nil {
+		t.Fatalf("Unexpected error opening redacted stream: %v", err)
+	}
+
+	found := make([]string, 0)
+	redacted := make([]int64, 0)
+
+	r.Iterate(0, func(e *Event) bool {
+		found = append(found, string(e.Data))
+		redacted = append(redacted, e.Offset)
+		return true
+	})
+
+	if !reflect.DeepEqual(found, []string{"", "x", "def"}) {
+		t.Errorf("Incorrect redacted events. Wanted: %v, found: %v", []string{"", "x", "def"}, found)
+	}
+
+	if !reflect.DeepEqual(redacted, offsets) {
+		t.Errorf("Redaction moved events. Wanted: %v, found: %v", offsets, redacted)
+	}
+
+	found = found[:0]
+
+	r.ScanIndex("e", "e", 0, func(e *Event) bool {
+		found = append(found, string(e.Data))
+		return true
+	})
+
+	if !reflect.DeepEqual(found, []string{"def", "x"}) {
+		t.Errorf("Incorrect redacted scan. Wanted: %v, found: %v", []string{"def", "x"}, found)
+	}
+
+	err = Redact("tmp/test.stream", "tmp/redacted.stream", map[int64][]byte{
+		offsets[0]: []byte("too long to fit"),
+	})
+
+	if err != REDACTION_TOO_LARGE {
+		t.Errorf("Expected redaction too large error, found: %v", err)
+	}
+
+	// Nothing is redacted unless every offset is an event.
+	err = Redact("tmp/test.stream", "tmp/invalid.stream", map[int64][]byte{
+		offsets[0]:     []byte("x"),
+		offsets[0] + 1: []byte("x"),
+	})
+
+	if err != INVALID_REDACTION {
+		t.Errorf("Expected an invalid offset to be refused, found: %v", err)
+	}
+
+	if _, err := os.Stat("tmp/invalid.stream"); !os.IsNotExist(err) {
+		t.Errorf("Expected no redacted stream to be written, found: %v", err)
+	}
+
+	if err := CheckRedactions("tmp/test.stream", map[int64][]byte{1 << 40: nil}); err != INVALID_REDACTION {
+		t.Errorf("Expected an offset past the end to be refused, found: %v", err)
+	}
+}
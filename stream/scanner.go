@@ -0,0 +1,43 @@
+package stream
+
+// ErrorScanner is a scanner which can fail, such as when it can't
+// decode an event or write it elsewhere. Returning an error stops
+// the scan, as does returning false.
+type ErrorScanner func(*Event) (bool, error)
+
+// Adapts the scanner so it can be given to any scan, returning the
+// Scanner to pass, and a function to call with the scan's error. It
+// returns the scanner's error if it failed, and otherwise the scan's.
+//
+//	scanner, result := stream.Catch(func(e *stream.Event) (bool, error) {
+//		return true, json.Unmarshal(e.Data, &v)
+//	})
+//
+//	_, err := s.Iterate(0, scanner)
+//	err = result(err)
+//
+// As with returning false, continuations returned by the scan
+// resume after the event the scanner failed on.
+func Catch(scanner ErrorScanner) (Scanner, func(error) error) {
+	var failed error
+
+	wrapped := func(e *Event) bool {
+		ok, err := scanner(e)
+		if err != nil {
+			failed = err
+			return false
+		}
+
+		return ok
+	}
+
+	result := func(err error) error {
+		if failed != nil {
+			return failed
+		}
+
+		return err
+	}
+
+	return wrapped, result
+}
@@ -0,0 +1,43 @@
+package stream
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCatchingScannerErrors(t *testing.T) {
+	s := createStream()
+
+	s.Write([]byte("abc"), map[string]string{"a": "b"})
+	s.Write([]byte("bad"), map[string]string{"a": "b"})
+	s.Write([]byte("def"), map[string]string{"a": "b"})
+
+	failure := errors.New("failed to process event")
+	found := make([]string, 0)
+
+	scanner, result := Catch(func(e *Event) (bool, error) {
+		if string(e.Data) == "bad" {
+			return false, failure
+		}
+
+		found = append(found, string(e.Data))
+		return true, nil
+	})
+
+	if _, err := s.Iterate(0, scanner); result(err) != failure {
+		t.Errorf("Expected the scanner's error, found: %v", result(err))
+	}
+
+	if !reflect.DeepEqual(found, []string{"abc"}) {
+		t.Errorf("Expected the scan to stop at the failure, found: %v", found)
+	}
+
+	scanner, result = Catch(func(e *Event) (bool, error) {
+		return true, nil
+	})
+
+	if err := result(s.ScanIndex("a", "b", 0, scanner)); err != nil {
+		t.Errorf("Expected no error, found: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package stream
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+var SPLITTING_OPEN_STREAM = errors.New("only closed streams can be split")
+
+// Position of an event once its stream has been split: the piece it
+// was written to, and its offset within that piece. An Offset of -1
+// refers to the end of the final piece.
+type Position struct {
+	Piece  int   `json:"piece"`
+	Offset int64 `json:"offset"`
+}
+
+// Works out how to split the closed stream at path into pieces holding
+// roughly size bytes of events each. Returns the offset of the first
+// event in each piece, and where the first event at or after each of
+// the given offsets will be once split.
+func PlanSplit(path string, size int64, offsets []int64) ([]int64, map[int64]Position, error) {
+	create := func(piece int) (Stream, error) {
+		return createOpenStream(discard{})
+	}
+
+	return split(path, size, nil, create, offsets)
+}
+
+// Rewrites the closed stream at path into a closed stream for each of
+// the boundaries returned by PlanSplit, at the path destination returns
+// for each piece. Indexes are rebuilt, so each piece stands alone.
+func Split(path string, boundaries []int64, destination func(piece int) string) error {
+	created := make([]string, 0, len(boundaries))
+
+	create := func(piece int) (Stream, error) {
+		created = append(created, destination(piece))
+		return New(destination(piece))
+	}
+
+	_, _, err := split(path, 0, boundaries, create, nil)
+
+	if err != nil {
+		for _, path := range created {
+			os.Remove(path)
+		}
+	}
+
+	return err
+}
+
+// Copies each event into a new piece once the current one has grown
+// beyond size, or the event is at the next of the given boundaries.
+func split(path string, size int64, boundaries []int64, create func(piece int) (Stream, error), offsets []int64) ([]int64, map[int64]Position, error) {
+	s, err := Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer s.Close()
+
+	if !s.Closed() {
+		return nil, nil, SPLITTING_OPEN_STREAM
+	}
+
+	pending := append([]int64{}, offsets...)
+	sort.Sort(int64Slice(pending))
+
+	positions := make(map[int64]Position, len(pending))
+
+	var out Stream
+	var starts []int64
+	piece := -1
+
+	_, iterr := s.Iterate(0, func(e *Event) bool {
+		next := out == nil
+
+		if boundaries != nil {
+			next = piece+1 < len(boundaries) && e.Offset >= boundaries[piece+1]
+		} else if out != nil && out.Offset() >= size {
+			next = true
+		}
+
+		if next {
+			if out != nil {
+				if err = out.Close(); err != nil {
+					return false
+				}
+			}
+
+			piece += 1
+			starts = append(starts, e.Offset)
+
+			if out, err = create(piece); err != nil {
+				return false
+			}
+		}
+
+		for len(pending) > 0 && pending[0] <= e.Offset {
+			positions[pending[0]] = Position{piece, out.Offset()}
+			pending = pending[1:]
+		}
+
+		_, err = out.WriteWithHeaders(e.Data, e.Indexes(), e.Headers)
+		return err == nil
+	})
+
+	if err == nil {
+		err = iterr
+	}
+
+	if out != nil {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	for _, offset := range pending {
+		positions[offset] = Position{piece, -1}
+	}
+
+	return starts, positions, err
+}
+
+// Discards everything written after the header, so events can
+// be written to a stream just to find out where they'd end up.
+type discard struct{}
+
+func (discard) WriteAt(p []byte, off int64) (int, error) {
+	return len(p), nil
+}
+
+func (discard) ReadAt(p []byte, off int64) (int, error) {
+	if off >= HEADER_LENGTH {
+		return 0, io.EOF
+	}
+
+	n := copy(p, MAGIC_HEADER[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+type int64Slice []int64
+
+func (p int64Slice) Len() int           { return len(p) }
+func (p int64Slice) Less(i, j int) bool { return p[i] < p[j] }
+func (p int64Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
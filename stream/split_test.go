@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	buildStream()
+
+	s := reopenStream()
+
+	offsets := make([]int64, 0)
+	s.Iterate(0, func(e *Event) bool {
+		offsets = append(offsets, e.Offset)
+		return true
+	})
+
+	// Small enough for each event to get its own piece.
+	boundaries, positions, err := PlanSplit("tmp/test.stream", 1, []int64{offsets[1], offsets[2] + 1})
+	if err != nil {
+		t.Fatalf("Unexpected error planning split: %v", err)
+	}
+
+	if !reflect.DeepEqual(boundaries, offsets) {
+		t.Errorf("Incorrect boundaries. Wanted: %v, found: %v", offsets, boundaries)
+	}
+
+	if p := positions[offsets[1]]; p.Piece != 1 || p.Offset != HEADER_LENGTH {
+		t.Errorf("Incorrect position of second event: %v", p)
+	}
+
+	if p := positions[offsets[2]+1]; p.Piece != 2 || p.Offset != -1 {
+		t.Errorf("Incorrect position past the last event: %v", p)
+	}
+
+	path := func(piece int) string {
+		return fmt.Sprintf("tmp/split.%v.stream", piece)
+	}
+
+	for i := range boundaries {
+		os.Remove(path(i))
+	}
+
+	if err = Split("tmp/test.stream", boundaries, path); err != nil {
+		t.Fatalf("Unexpected error splitting stream: %v", err)
+	}
+
+	var tests = []struct {
+		event string
+		index string
+	}{
+		{"abc", "a"},
+		{"cde", "c"},
+		{"def", "f"},
+	}
+
+	for i, test := range tests {
+		piece, err := Open(path(i))
+		if err != nil || !piece.Closed() {
+			t.Fatalf("Case #%v: Piece isn't a closed stream: %v", i, err)
+		}
+
+		found := make([]string, 0)
+
+		piece.ScanIndex(test.index, test.index, 0, func(e *Event) bool {
+			found = append(found, string(e.Data))
+			return true
+		})
+
+		if !reflect.DeepEqual(found, []string{test.event}) {
+			t.Errorf("Case #%v: Incorrect scan. Wanted: [%v], found: %v", i, test.event, found)
+		}
+	}
+}
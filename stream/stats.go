@@ -0,0 +1,142 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/customerio/esdb/binary"
+	"github.com/customerio/esdb/sst"
+)
+
+var CORRUPTED_STATS = errors.New("corrupted stream stats")
+
+// Keys the stats of a closed stream's indexes within its index, as
+// BLOOM_KEY does its bloom filter.
+const STATS_KEY = "_stats"
+
+// Describes the use of an index name within a stream: how many distinct
+// values it has, how many events are chained by them, and the bytes
+// of those events, so the cost of indexing by it can be weighed.
+type IndexStats struct {
+	Values int64 `json:"values"`
+	Events int64 `json:"events"`
+	Bytes  int64 `json:"bytes"`
+}
+
+func (s IndexStats) Add(other IndexStats) IndexStats {
+	return IndexStats{s.Values + other.Values, s.Events + other.Events, s.Bytes + other.Bytes}
+}
+
+// The stats of each of a stream's index names, including events'
+// groupings under GROUPING_INDEX.
+type Stats map[string]IndexStats
+
+// Records an event of the given size written with the indexes.
+func (s Stats) record(indexes []string, size int64) {
+	for _, name := range indexes {
+		st := s[name]
+		st.Events += 1
+		st.Bytes += size
+		s[name] = st
+	}
+}
+
+// The stats with each name's count of values, from the tails of the
+// open stream's chains.
+func (s Stats) withValues(tails map[string]int64) Stats {
+	stats := make(Stats, len(s))
+
+	for name, st := range s {
+		st.Values = 0
+		stats[name] = st
+	}
+
+	for index := range tails {
+		name := indexName(index)
+
+		st := stats[name]
+		st.Values += 1
+		stats[name] = st
+	}
+
+	return stats
+}
+
+// Indexes are keyed by name and value joined by ":".
+func indexName(index string) string {
+	if i := strings.Index(index, ":"); i >= 0 {
+		return index[:i]
+	}
+
+	return index
+}
+
+// [uvarint:count]([uvarint:length][bytes:name][uvarint:values][uvarint:events][uvarint:bytes])...
+func (s Stats) encode() []byte {
+	names := make(sort.StringSlice, 0, len(s))
+
+	for name := range s {
+		names = append(names, name)
+	}
+
+	sort.Stable(names)
+
+	buf := new(bytes.Buffer)
+	binary.WriteUvarint(buf, len(names))
+
+	for _, name := range names {
+		st := s[name]
+
+		binary.WriteUvarint(buf, len(name))
+		buf.WriteString(name)
+		binary.WriteUvarint64(buf, st.Values)
+		binary.WriteUvarint64(buf, st.Events)
+		binary.WriteUvarint64(buf, st.Bytes)
+	}
+
+	return buf.Bytes()
+}
+
+func decodeStats(b []byte) (Stats, error) {
+	r := bytes.NewReader(b)
+
+	count, err := binary.ReadUvarintMax(r, int64(len(b)))
+	if err != nil {
+		return nil, CORRUPTED_STATS
+	}
+
+	stats := make(Stats, count)
+
+	for i := int64(0); i < count; i++ {
+		name, err := binary.ReadStringMax(r, int64(r.Len()))
+		if err != nil {
+			return nil, CORRUPTED_STATS
+		}
+
+		var fields [3]int64
+
+		for j := range fields {
+			if fields[j], err = binary.ReadUvarintMax(r, 1<<62); err != nil {
+				return nil, CORRUPTED_STATS
+			}
+		}
+
+		stats[name] = IndexStats{fields[0], fields[1], fields[2]}
+	}
+
+	return stats, nil
+}
+
+func findStats(index *sst.Reader) (Stats, error) {
+	b, err := index.Get([]byte(STATS_KEY))
+
+	if err == sst.NOT_FOUND {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return decodeStats(b)
+}
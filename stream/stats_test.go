@@ -0,0 +1,48 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStreamStats(t *testing.T) {
+	s := createStream()
+
+	a, _ := s.Write([]byte("a"), map[string]string{"customer": "1", "type": "open"})
+	b, _ := s.Write([]byte("bb"), map[string]string{"customer": "2", "type": "open"})
+	c, _ := s.Write([]byte("ccc"), map[string]string{"customer": "1"})
+
+	want := Stats{
+		"customer": {Values: 2, Events: 3, Bytes: int64(a + b + c)},
+		"type":     {Values: 1, Events: 2, Bytes: int64(a + b)},
+	}
+
+	check := func(state string, s Stream) {
+		if found, err := s.Stats(); err != nil || !reflect.DeepEqual(found, want) {
+			t.Errorf("%v: wanted: %v, found: %v %v", state, want, found, err)
+		}
+	}
+
+	check("open", s)
+
+	// Recounted as the open stream's reopened.
+	check("reopened", reopenStream())
+
+	s.Close()
+
+	check("closed", reopenStream())
+}
+
+func TestStatsEncoding(t *testing.T) {
+	stats := Stats{"a": {1, 2, 3}, "_grouping": {4, 5, 6}}
+
+	if found, err := decodeStats(stats.encode()); err != nil || !reflect.DeepEqual(found, stats) {
+		t.Errorf("Wanted: %v, found: %v %v", stats, found, err)
+	}
+
+	encoded := stats.encode()
+
+	if _, err := decodeStats(encoded[:len(encoded)-1]); err != CORRUPTED_STATS {
+		t.Errorf("Wanted: %v, found: %v", CORRUPTED_STATS, err)
+	}
+}
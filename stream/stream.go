@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"bytes"
 	"io"
 	"os"
 
@@ -12,6 +13,11 @@ const (
 	MAGIC_FOOTER = "closedESDBstream"
 )
 
+// Events written with a grouping are chained together under
+// this reserved index name, so each grouping can be scanned
+// without touching events outside of it.
+const GROUPING_INDEX = "_grouping"
+
 var HEADER_LENGTH = int64(len(MAGIC_HEADER))
 var FOOTER_LENGTH = int64(len(MAGIC_FOOTER))
 
@@ -31,46 +37,86 @@ type request struct {
 
 type Stream interface {
 	Write(data []byte, indexes map[string]string) (int, error)
+	// Writes the event, as Write, along with headers read back as the
+	// event's Headers.
+	WriteWithHeaders(data []byte, indexes, headers map[string]string) (int, error)
 	First(name, value string) (int64, error)
 	ScanIndex(name, value string, offset int64, scanner Scanner) error
+	ScanIndexes(indexes map[string]string, offset int64, scanner Scanner) (int64, error)
+	ScanPrefix(name, prefix string, offset int64, scanner Scanner) (int64, error)
+	// The distinct values of the index, sorted.
+	Values(name string) ([]string, error)
 	Iterate(offset int64, scanner Scanner) (int64, error)
+	IterateReverse(offset int64, scanner Scanner) (int64, error)
 	Offset() int64
 	Closed() bool
+	// The stats of each index name, which aren't known for streams
+	// closed before they were recorded.
+	Stats() (Stats, error)
 	Close() error
+	Sync() error
 	reader() io.ReaderAt
 }
 
 // Creates a new open stream at the given path. If the
 // file already exists, an error will be returned.
 func New(path string) (Stream, error) {
+	return NewWithOptions(path, Options{})
+}
+
+// Creates a new open stream, as New, written with the given options.
+func NewWithOptions(path string, opts Options) (Stream, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
 	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0755)
 	if err != nil {
 		return nil, err
 	}
 
-	return createOpenStream(file)
+	s, err := createOpenStream(file)
+	if err == nil {
+		s.(*openStream).options = opts
+	}
+
+	return s, err
 }
 
 func Open(path string) (Stream, error) {
-	file, err := os.Open(path)
+	closed, err := IsClosed(path)
 	if err != nil {
 		return nil, err
 	}
 
-	file.Seek(-FOOTER_LENGTH, 2)
-	footer := binary.ReadBytes(file, FOOTER_LENGTH)
-	file.Close()
-
 	// 2 states a stream file can be in:
 	// Closed: if footer is present, no additional writes allowed, read-only.
 	// Open:   repopulate indexes into memory, allow additional writes.
-	if string(footer) == string(MAGIC_FOOTER) {
+	if closed {
 		return readonly(path)
 	} else {
 		return read(path)
 	}
 }
 
+// Whether the stream file has been closed, checked without opening
+// it as a stream, so one still being written isn't modified.
+func IsClosed(path string) (bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, STREAM_NOT_FOUND
+	} else if err != nil {
+		return false, err
+	}
+
+	defer file.Close()
+
+	file.Seek(-FOOTER_LENGTH, 2)
+	footer := binary.ReadBytes(file, FOOTER_LENGTH)
+
+	return string(footer) == string(MAGIC_FOOTER), nil
+}
+
 func scanIndex(s Stream, index string, offset int64, scanner Scanner) error {
 	for offset > 0 {
 		event, err := pullEvent(s.reader(), offset)
@@ -82,7 +128,7 @@ func scanIndex(s Stream, index string, offset int64, scanner Scanner) error {
 				offset = 0
 			}
 		} else {
-			return err
+			return corrupted(err, offset)
 		}
 	}
 
@@ -90,18 +136,11 @@ func scanIndex(s Stream, index string, offset int64, scanner Scanner) error {
 }
 
 func iterate(s Stream, offset int64, scanner Scanner) (int64, error) {
-	if offset <= 0 {
-		header := binary.ReadBytesAt(s.reader(), HEADER_LENGTH, 0)
-
-		if string(header) != string(MAGIC_HEADER) {
-			return 0, CORRUPTED_HEADER
-		}
-
-		offset = HEADER_LENGTH
+	offset, err := start(s, offset)
+	if err != nil {
+		return 0, err
 	}
 
-	var err error
-
 	for err == nil {
 		event, e := pullEvent(s.reader(), offset)
 
@@ -119,6 +158,69 @@ func iterate(s Stream, offset int64, scanner Scanner) (int64, error) {
 	if err == io.EOF {
 		return offset, nil
 	} else {
-		return offset, err
+		return offset, corrupted(err, offset)
 	}
 }
+
+// Iterates newest first from the event before the offset, or from the
+// last event for an offset of 0, returning the offset to resume from:
+// that of the last event scanned, or of the first event once every
+// event has been. Events are length prefixed, so their offsets are
+// found by reading each length from the start of the stream, and only
+// the offsets are held while iterating.
+func iterateReverse(s Stream, offset int64, scanner Scanner) (int64, error) {
+	pos, err := start(s, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	offsets := make([]int64, 0)
+
+	for offset <= 0 || pos < offset {
+		head, err := readAt(s.reader(), 4, pos)
+		if err != nil {
+			return 0, corrupted(err, pos)
+		}
+
+		if len(head) < 4 {
+			break
+		}
+
+		size := binary.ReadInt32(bytes.NewReader(head))
+		if size <= 0 {
+			break
+		}
+
+		offsets = append(offsets, pos)
+		pos += 4 + size
+	}
+
+	for i := len(offsets) - 1; i >= 0; i-- {
+		event, err := pullEvent(s.reader(), offsets[i])
+		if err != nil {
+			return offsets[i], corrupted(err, offsets[i])
+		}
+
+		if !scanner(event) {
+			return offsets[i], nil
+		}
+	}
+
+	return HEADER_LENGTH, nil
+}
+
+// The offset to iterate from, checking the header when starting
+// from the beginning of the stream.
+func start(s Stream, offset int64) (int64, error) {
+	if offset > 0 {
+		return offset, nil
+	}
+
+	header := binary.ReadBytesAt(s.reader(), HEADER_LENGTH, 0)
+
+	if string(header) != string(MAGIC_HEADER) {
+		return 0, CORRUPTED_HEADER
+	}
+
+	return HEADER_LENGTH, nil
+}
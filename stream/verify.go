@@ -0,0 +1,31 @@
+package stream
+
+import (
+	"os"
+)
+
+// Reads every event in the stream file, checking each can be decoded
+// and matches its checksum, if it was written with one. Returns a
+// CorruptedError with the offset of the first event which doesn't, so
+// corruption is found before scans reach it. The last event of an open
+// stream may be reported if it was being written when the process
+// stopped. The file isn't modified.
+func Verify(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return STREAM_NOT_FOUND
+	} else if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	// Only read, so an open stream isn't closed once verified.
+	s := &openStream{stream: file}
+
+	_, err = iterate(s, 0, func(*Event) bool {
+		return true
+	})
+
+	return err
+}
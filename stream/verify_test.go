@@ -0,0 +1,70 @@
+package stream
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/customerio/esdb/binary"
+)
+
+func TestVerify(t *testing.T) {
+	for _, closed := range []bool{false, true} {
+		s := createStream()
+
+		s.Write([]byte("abc"), map[string]string{"a": "a"})
+		s.Write([]byte("cde"), map[string]string{"a": "a"})
+		s.Write([]byte("def"), map[string]string{"a": "a"})
+
+		offsets := make([]int64, 0)
+		s.Iterate(0, func(e *Event) bool {
+			offsets = append(offsets, e.Offset)
+			return true
+		})
+
+		if closed {
+			s.Close()
+		}
+
+		if err := Verify("tmp/test.stream"); err != nil {
+			t.Errorf("Closed: %v, Wanted no error, found: %v", closed, err)
+		}
+
+		// Flip a bit in the second event's body.
+		file, _ := os.OpenFile("tmp/test.stream", os.O_RDWR, 0755)
+		file.WriteAt([]byte{'c' ^ 0x01}, offsets[1]+5)
+		file.Close()
+
+		err := Verify("tmp/test.stream")
+
+		if c, ok := err.(*CorruptedError); !ok || c.Offset != offsets[1] || c.Err != CHECKSUM_MISMATCH {
+			t.Errorf("Closed: %v, Wanted checksum mismatch at %d, found: %v", closed, offsets[1], err)
+		}
+	}
+
+	if err := Verify("tmp/missing.stream"); err != STREAM_NOT_FOUND {
+		t.Errorf("Wanted: %v, found: %v", STREAM_NOT_FOUND, err)
+	}
+}
+
+func TestDecodeWithoutChecksum(t *testing.T) {
+	// Events written before checksums end with their offsets, or are
+	// padded with zeros once redacted.
+	for _, padding := range []int{0, 3} {
+		buf := new(bytes.Buffer)
+
+		binary.WriteUvarint(buf, 3)
+		buf.WriteString("abc")
+		binary.WriteUvarint(buf, 1)
+		binary.WriteUvarint(buf, 3)
+		buf.WriteString("a:a")
+		binary.WriteUvarint64(buf, 10)
+		buf.Write(make([]byte, padding))
+
+		e, err := decodeEvent(buf.Bytes())
+
+		if err != nil || string(e.Data) != "abc" || e.Next("a", "a") != 10 {
+			t.Errorf("Padding %d: Wanted event, found: %v %v", padding, e, err)
+		}
+	}
+}
@@ -19,6 +19,7 @@ type Writer struct {
 	spaceOffsets map[string]int64
 	spaceLengths map[string]int64
 	written      bool
+	checksums    bool
 }
 
 // Creates a new ESDB database at the given path. If the
@@ -38,6 +39,13 @@ func New(path string) (*Writer, error) {
 	}, nil
 }
 
+// Follows each block of events and indexes with a checksum, which
+// readers verify, so corrupted blocks aren't read. Files written with
+// checksums can't be read by versions of esdb from before them.
+func (w *Writer) SetChecksums(enabled bool) {
+	w.checksums = enabled
+}
+
 // Adds a new event to the specified space, with grouping and indexes. Events aren't
 // written to the file until writer.Flush(spaceId) or writer.Write() is called.
 func (w *Writer) Add(spaceId []byte, data []byte, timestamp int, grouping string, indexes map[string]string) error {
@@ -85,6 +93,7 @@ func (w *Writer) Write() (err error) {
 }
 
 func (w *Writer) writeSpace(space *spaceWriter) (err error) {
+	space.checksums = w.checksums
 	length, err := space.write()
 
 	if err == nil {